@@ -1,22 +1,54 @@
+// Package client implements a Go client for the HTTP API v2 of Cayley.
 package client
 
 import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
 	"fmt"
 	"io"
+	"io/ioutil"
 	"net/http"
 	"net/url"
+	"strconv"
+	"time"
 
+	"github.com/cayleygraph/cayley/graph/journal"
 	"github.com/cayleygraph/cayley/quad"
+	"github.com/cayleygraph/cayley/quad/nquads"
 	"github.com/cayleygraph/cayley/quad/pquads"
 )
 
+// New creates a client for a Cayley server with a given address, e.g. "http://localhost:64210".
 func New(addr string) *Client {
-	return &Client{addr: addr, cli: http.DefaultClient}
+	return NewClient(addr, nil)
+}
+
+// Options configures the client.
+type Options struct {
+	// HTTPClient is used to send requests. http.DefaultClient is used if not set.
+	HTTPClient *http.Client
+	// Header is added to each request, for example to pass credentials or a role for access policies.
+	Header http.Header
+}
+
+// NewClient creates a client for a Cayley server with a given address. Options may be nil.
+func NewClient(addr string, opts *Options) *Client {
+	c := &Client{addr: addr, cli: http.DefaultClient}
+	if opts != nil {
+		if opts.HTTPClient != nil {
+			c.cli = opts.HTTPClient
+		}
+		c.hdr = opts.Header
+	}
+	return c
 }
 
 type Client struct {
 	addr string
 	cli  *http.Client
+	hdr  http.Header
 }
 
 func (c *Client) SetHttpClient(cli *http.Client) {
@@ -34,30 +66,131 @@ func (c *Client) url(s string, q map[string]string) string {
 	return addr
 }
 
-type errRequestFailed struct {
+// RequestError is returned when the server responds with an unexpected status code.
+type RequestError struct {
 	Status     string
 	StatusCode int
+	// Message is an error message returned by the server, if any.
+	Message string
 }
 
-func (e errRequestFailed) Error() string {
+func (e *RequestError) Error() string {
+	if e.Message != "" {
+		return fmt.Sprintf("request failed: %d %v: %s", e.StatusCode, e.Status, e.Message)
+	}
 	return fmt.Sprintf("request failed: %d %v", e.StatusCode, e.Status)
 }
-func (c *Client) QuadReader() (quad.ReadCloser, error) {
-	resp, err := http.Get(c.url("/api/v2/read", map[string]string{
-		"format": "pquads",
-	}))
+
+// errorFrom reads an error message from the response body and closes it.
+func errorFrom(resp *http.Response) error {
+	defer resp.Body.Close()
+	e := &RequestError{StatusCode: resp.StatusCode, Status: resp.Status}
+	data, _ := ioutil.ReadAll(io.LimitReader(resp.Body, 64*1024))
+	var msg struct {
+		Error string `json:"error"`
+	}
+	if json.Unmarshal(data, &msg) == nil && msg.Error != "" {
+		e.Message = msg.Error
+	} else {
+		e.Message = string(bytes.TrimSpace(data))
+	}
+	return e
+}
+
+// do sends the request with headers from client options. Response body is closed if the status is not 200 OK.
+func (c *Client) do(req *http.Request) (*http.Response, error) {
+	for k, vals := range c.hdr {
+		for _, v := range vals {
+			req.Header.Add(k, v)
+		}
+	}
+	resp, err := c.cli.Do(req)
 	if err != nil {
 		return nil, err
 	}
 	if resp.StatusCode != http.StatusOK {
-		resp.Body.Close()
-		return nil, errRequestFailed{StatusCode: resp.StatusCode, Status: resp.Status}
+		return nil, errorFrom(resp)
+	}
+	return resp, nil
+}
+
+func (c *Client) get(ctx context.Context, path string, q map[string]string) (*http.Response, error) {
+	req, err := http.NewRequest("GET", c.url(path, q), nil)
+	if err != nil {
+		return nil, err
+	}
+	return c.do(req.WithContext(ctx))
+}
+
+func (c *Client) QuadReader() (quad.ReadCloser, error) {
+	return c.QuadReaderFor(quad.Quad{}, 0)
+}
+
+// QuadReaderFor reads quads matching a given pattern. Nil values in the pattern match any value.
+// If limit is positive, the server returns at most limit quads.
+func (c *Client) QuadReaderFor(pattern quad.Quad, limit int) (quad.ReadCloser, error) {
+	return c.QuadReaderContext(context.Background(), pattern, limit)
+}
+
+// QuadReaderContext is the same as QuadReaderFor, but the request is bound to a given context.
+func (c *Client) QuadReaderContext(ctx context.Context, pattern quad.Quad, limit int) (quad.ReadCloser, error) {
+	q := map[string]string{
+		"format": "pquads",
+	}
+	for _, d := range quad.Directions {
+		if v := pattern.Get(d); v != nil {
+			q[d.String()] = v.String()
+		}
+	}
+	if limit > 0 {
+		q["limit"] = strconv.Itoa(limit)
+	}
+	resp, err := c.get(ctx, "/api/v2/read", q)
+	if err != nil {
+		return nil, err
 	}
 	r := pquads.NewReader(resp.Body, 10*1024*1024)
 	r.SetCloser(resp.Body)
 	return r, nil
 }
 
+// NodeReader reads nodes of the database. If limit is positive, the server returns at most limit nodes.
+func (c *Client) NodeReader(ctx context.Context, limit int) (*NodeReader, error) {
+	var q map[string]string
+	if limit > 0 {
+		q = map[string]string{"limit": strconv.Itoa(limit)}
+	}
+	resp, err := c.get(ctx, "/api/v2/nodes", q)
+	if err != nil {
+		return nil, err
+	}
+	return &NodeReader{body: resp.Body, r: bufio.NewReader(resp.Body)}, nil
+}
+
+// NodeReader reads nodes returned by the server, one at a time.
+type NodeReader struct {
+	body io.ReadCloser
+	r    *bufio.Reader
+	err  error
+}
+
+// ReadNode returns the next node. It returns io.EOF if there are no more nodes.
+func (r *NodeReader) ReadNode() (quad.Value, error) {
+	for r.err == nil {
+		var line []byte
+		line, r.err = r.r.ReadBytes('\n')
+		if line = bytes.TrimSpace(line); len(line) != 0 {
+			return nquads.UnmarshalValue(line)
+		}
+	}
+	return nil, r.err
+}
+
+// Close closes the response stream.
+func (r *NodeReader) Close() error {
+	return r.body.Close()
+}
+
 type funcCloser struct {
 	f      func() error
 	closed bool
@@ -71,11 +204,25 @@ func (c funcCloser) Close() error {
 	return c.f()
 }
 func (c *Client) QuadWriter() (quad.WriteCloser, error) {
+	return c.quadWriter("/api/v2/write")
+}
+
+// QuadDeleter returns a writer that removes all written quads from the database.
+func (c *Client) QuadDeleter() (quad.WriteCloser, error) {
+	return c.quadWriter("/api/v2/delete")
+}
+
+func (c *Client) quadWriter(path string) (quad.WriteCloser, error) {
+	return c.quadWriterContext(context.Background(), path)
+}
+
+func (c *Client) quadWriterContext(ctx context.Context, path string) (quad.WriteCloser, error) {
 	pr, pw := io.Pipe()
-	req, err := http.NewRequest("POST", c.url("/api/v2/write", nil), pr)
+	req, err := http.NewRequest("POST", c.url(path, nil), pr)
 	if err != nil {
 		return nil, err
 	}
+	req = req.WithContext(ctx)
 	req.Header.Set("Content-Type", pquads.ContentType)
 	errc := make(chan error, 1)
 	go func() {
@@ -83,12 +230,9 @@ func (c *Client) QuadWriter() (quad.WriteCloser, error) {
 			close(errc)
 			pr.Close()
 		}()
-		resp, err := c.cli.Do(req)
-		if resp != nil && resp.Body != nil {
-			defer resp.Body.Close()
-		}
-		if err == nil && resp.StatusCode != http.StatusOK {
-			err = errRequestFailed{StatusCode: resp.StatusCode, Status: resp.Status}
+		resp, err := c.do(req)
+		if err == nil {
+			resp.Body.Close()
 		}
 		errc <- err
 	}()
@@ -102,3 +246,136 @@ func (c *Client) QuadWriter() (quad.WriteCloser, error) {
 	}})
 	return qw, nil
 }
+
+// Info is a subset of information about the server returned by /api/v2/info.
+type Info struct {
+	Version   string   `json:"version"`
+	Backend   string   `json:"backend"`
+	ReadOnly  bool     `json:"read_only"`
+	Size      int64    `json:"size"`
+	Horizon   int64    `json:"horizon,omitempty"`
+	Languages []string `json:"languages,omitempty"`
+}
+
+// Info returns information about the server and the size of its database.
+func (c *Client) Info() (*Info, error) {
+	resp, err := c.get(context.Background(), "/api/v2/info", nil)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	var info Info
+	if err = json.NewDecoder(resp.Body).Decode(&info); err != nil {
+		return nil, err
+	}
+	return &info, nil
+}
+
+// Load writes all quads from the reader to the database. It returns the number of quads sent to the server.
+func (c *Client) Load(ctx context.Context, r quad.Reader) (int, error) {
+	w, err := c.quadWriterContext(ctx, "/api/v2/write")
+	if err != nil {
+		return 0, err
+	}
+	n, err := quad.Copy(w, r)
+	if err != nil {
+		w.Close()
+		return n, err
+	}
+	return n, w.Close()
+}
+
+// Dump writes all quads of the database to the writer. It returns the number of quads written.
+func (c *Client) Dump(ctx context.Context, w quad.Writer) (int, error) {
+	resp, err := c.get(ctx, "/api/v2/read", map[string]string{"format": "pquads"})
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close()
+	r := pquads.NewReader(resp.Body, 10*1024*1024)
+	defer r.Close()
+	return quad.Copy(w, r)
+}
+
+// QueryOptions are optional parameters of a query.
+type QueryOptions struct {
+	// Limit is the maximal number of results. Server-wide limit is used if not set.
+	Limit int
+	// Timeout of the query. Server cannot exceed a server-wide timeout.
+	Timeout time.Duration
+	// CompactIRIs requests IRIs to be compacted with registered namespaces.
+	CompactIRIs bool
+}
+
+// QueryResult is a result of a query.
+type QueryResult struct {
+	// Result is a JSON document returned by the query. Its structure depends on the query language.
+	Result json.RawMessage `json:"result"`
+	// Truncated is set if the query reached the limit of results.
+	Truncated bool `json:"truncated,omitempty"`
+}
+
+// Decode unmarshals query results into the value pointed by out, as json.Unmarshal does.
+func (r *QueryResult) Decode(out interface{}) error {
+	return json.Unmarshal(r.Result, out)
+}
+
+// Query runs a query in a given language, for example "gizmo". Options may be nil.
+func (c *Client) Query(ctx context.Context, lang, qu string, opts *QueryOptions) (*QueryResult, error) {
+	q := map[string]string{"lang": lang}
+	if opts != nil {
+		if opts.Limit > 0 {
+			q["limit"] = strconv.Itoa(opts.Limit)
+		}
+		if opts.Timeout > 0 {
+			q["timeout"] = opts.Timeout.String()
+		}
+		if opts.CompactIRIs {
+			q["iris"] = "compact"
+		}
+	}
+	req, err := http.NewRequest("POST", c.url("/api/v2/query", q), bytes.NewBufferString(qu))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "text/plain")
+	resp, err := c.do(req.WithContext(ctx))
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	var res QueryResult
+	if err = json.NewDecoder(resp.Body).Decode(&res); err != nil {
+		return nil, err
+	}
+	return &res, nil
+}
+
+// Watch calls fnc for each change committed to the database, starting from a given horizon.
+// It waits for new changes until the context is cancelled, or fnc returns an error.
+// The server must have the journal enabled.
+func (c *Client) Watch(ctx context.Context, from int64, fnc func(e *journal.Entry) error) error {
+	resp, err := c.get(ctx, "/api/v2/journal", map[string]string{
+		"from":   strconv.FormatInt(from, 10),
+		"follow": "true",
+	})
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	r := journal.NewReader(resp.Body, from)
+	for {
+		e, err := r.ReadEntry()
+		if err == io.EOF {
+			return nil
+		} else if err != nil {
+			if ctx.Err() != nil {
+				return ctx.Err()
+			}
+			return err
+		}
+		if err = fnc(e); err != nil {
+			return err
+		}
+	}
+}
@@ -13,6 +13,10 @@
 // limitations under the License.
 
 // Package clog provides a logging interface for cayley packages.
+//
+// Besides printf-style functions, it provides leveled structured logging with fields
+// attached to the context (see Log and WithFields). Custom loggers can implement
+// StructuredLogger to receive fields as-is, instead of a formatted message.
 package clog
 
 import "log"
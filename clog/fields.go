@@ -0,0 +1,179 @@
+// Copyright 2017 The Cayley Authors. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package clog
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"strings"
+)
+
+// Level is a severity level of a log message.
+type Level int
+
+const (
+	LevelDebug = Level(iota)
+	LevelInfo
+	LevelWarning
+	LevelError
+)
+
+func (l Level) String() string {
+	switch l {
+	case LevelDebug:
+		return "debug"
+	case LevelInfo:
+		return "info"
+	case LevelWarning:
+		return "warning"
+	case LevelError:
+		return "error"
+	}
+	return fmt.Sprintf("level(%d)", int(l))
+}
+
+// Field is a key-value pair attached to a structured log message.
+type Field struct {
+	Key   string
+	Value interface{}
+}
+
+// F is a shorthand for creating a log field.
+func F(key string, val interface{}) Field {
+	return Field{Key: key, Value: val}
+}
+
+// StructuredLogger is an optional interface for loggers that accept messages with fields.
+// It can be implemented by an adapter for zap, zerolog or any other structured logging library.
+//
+// Fields include ones attached to the context with WithFields, followed by message-specific fields.
+// The context is passed as-is, so implementations can extract their own values from it (i.e. trace ids).
+type StructuredLogger interface {
+	Logger
+	Log(ctx context.Context, lvl Level, msg string, fields []Field)
+}
+
+type ctxFieldsKey struct{}
+
+// WithFields returns a context with fields that will be added to all messages logged with this context.
+func WithFields(ctx context.Context, fields ...Field) context.Context {
+	if len(fields) == 0 {
+		return ctx
+	}
+	prev := FieldsFrom(ctx)
+	arr := make([]Field, 0, len(prev)+len(fields))
+	arr = append(arr, prev...)
+	arr = append(arr, fields...)
+	return context.WithValue(ctx, ctxFieldsKey{}, arr)
+}
+
+// FieldsFrom returns all log fields attached to the context.
+func FieldsFrom(ctx context.Context) []Field {
+	if ctx == nil {
+		return nil
+	}
+	fields, _ := ctx.Value(ctxFieldsKey{}).([]Field)
+	return fields
+}
+
+// RequestIDKey is a log field name for request ids.
+const RequestIDKey = "request_id"
+
+type ctxRequestIDKey struct{}
+
+// WithRequestID returns a context with a given request id. The id is also added as a log field.
+func WithRequestID(ctx context.Context, id string) context.Context {
+	ctx = context.WithValue(ctx, ctxRequestIDKey{}, id)
+	return WithFields(ctx, F(RequestIDKey, id))
+}
+
+// RequestID returns a request id stored in the context, or an empty string if it's not set.
+func RequestID(ctx context.Context) string {
+	if ctx == nil {
+		return ""
+	}
+	id, _ := ctx.Value(ctxRequestIDKey{}).(string)
+	return id
+}
+
+// Log writes a structured message with a given level. Fields attached to the context are added to the message.
+//
+// If current logger does not implement StructuredLogger, fields are formatted as key=value pairs
+// and written after the message. Debug messages are written only if verbosity is 2 or higher.
+func Log(ctx context.Context, lvl Level, msg string, fields ...Field) {
+	l := logger
+	if l == nil {
+		return
+	}
+	if cf := FieldsFrom(ctx); len(cf) != 0 {
+		fields = append(cf[:len(cf):len(cf)], fields...)
+	}
+	if sl, ok := l.(StructuredLogger); ok {
+		sl.Log(ctx, lvl, msg, fields)
+		return
+	}
+	if lvl == LevelDebug && !l.V(2) {
+		return
+	}
+	msg = formatFields(msg, fields)
+	switch {
+	case lvl >= LevelError:
+		l.Errorf("%s", msg)
+	case lvl == LevelWarning:
+		l.Warningf("%s", msg)
+	default:
+		l.Infof("%s", msg)
+	}
+}
+
+// Debug logs a structured debug message.
+func Debug(ctx context.Context, msg string, fields ...Field) {
+	Log(ctx, LevelDebug, msg, fields...)
+}
+
+// Info logs a structured information message.
+func Info(ctx context.Context, msg string, fields ...Field) {
+	Log(ctx, LevelInfo, msg, fields...)
+}
+
+// Warning logs a structured warning message.
+func Warning(ctx context.Context, msg string, fields ...Field) {
+	Log(ctx, LevelWarning, msg, fields...)
+}
+
+// Error logs a structured error message.
+func Error(ctx context.Context, msg string, fields ...Field) {
+	Log(ctx, LevelError, msg, fields...)
+}
+
+// formatFields appends fields to the message in a key=value form.
+func formatFields(msg string, fields []Field) string {
+	if len(fields) == 0 {
+		return msg
+	}
+	buf := bytes.NewBufferString(msg)
+	for _, f := range fields {
+		buf.WriteByte(' ')
+		buf.WriteString(f.Key)
+		buf.WriteByte('=')
+		s := fmt.Sprint(f.Value)
+		if s == "" || strings.ContainsAny(s, " \t\n\"=") {
+			s = fmt.Sprintf("%q", s)
+		}
+		buf.WriteString(s)
+	}
+	return buf.String()
+}
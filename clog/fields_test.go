@@ -0,0 +1,61 @@
+package clog
+
+import (
+	"context"
+	"fmt"
+	"testing"
+)
+
+type testLogger struct {
+	stdlog
+	msgs []string
+}
+
+func (l *testLogger) Infof(format string, args ...interface{}) {
+	l.msgs = append(l.msgs, "I "+fmt.Sprintf(format, args...))
+}
+func (l *testLogger) Warningf(format string, args ...interface{}) {
+	l.msgs = append(l.msgs, "W "+fmt.Sprintf(format, args...))
+}
+
+type testStructLogger struct {
+	testLogger
+	fields []Field
+}
+
+func (l *testStructLogger) Log(ctx context.Context, lvl Level, msg string, fields []Field) {
+	l.msgs = append(l.msgs, lvl.String()+" "+msg)
+	l.fields = append(l.fields, fields...)
+}
+
+func TestLogFields(t *testing.T) {
+	defer SetLogger(logger)
+
+	ctx := WithRequestID(context.Background(), "abc")
+	ctx = WithFields(ctx, F("user", "bob"))
+	if id := RequestID(ctx); id != "abc" {
+		t.Fatalf("unexpected request id: %q", id)
+	}
+
+	l := &testLogger{}
+	SetLogger(l)
+	Info(ctx, "query", F("lang", "gizmo"), F("query", `g.V("a").All()`))
+	Warning(context.Background(), "slow", F("empty", ""))
+	Debug(ctx, "skipped")
+	expect := []string{
+		`I query request_id=abc user=bob lang=gizmo query="g.V(\"a\").All()"`,
+		`W slow empty=""`,
+	}
+	if fmt.Sprint(l.msgs) != fmt.Sprint(expect) {
+		t.Fatalf("unexpected messages:\n%q\nvs\n%q", l.msgs, expect)
+	}
+
+	sl := &testStructLogger{}
+	SetLogger(sl)
+	Error(ctx, "failed", F("n", 1))
+	if fmt.Sprint(sl.msgs) != "[error failed]" || len(sl.msgs) != 1 {
+		t.Fatalf("unexpected messages: %q", sl.msgs)
+	} else if exp := []Field{F(RequestIDKey, "abc"), F("user", "bob"), F("n", 1)}; fmt.Sprint(sl.fields) != fmt.Sprint(exp) {
+		t.Fatalf("unexpected fields: %v", sl.fields)
+	}
+}
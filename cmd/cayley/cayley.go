@@ -30,6 +30,7 @@ import (
 	"github.com/cayleygraph/cayley/clog"
 	_ "github.com/cayleygraph/cayley/clog/glog"
 	"github.com/cayleygraph/cayley/graph"
+	"github.com/cayleygraph/cayley/internal"
 	"github.com/cayleygraph/cayley/quad"
 	"github.com/cayleygraph/cayley/version"
 
@@ -42,6 +43,7 @@ import (
 	_ "github.com/cayleygraph/cayley/quad/graphml"
 	_ "github.com/cayleygraph/cayley/quad/json"
 	_ "github.com/cayleygraph/cayley/quad/jsonld"
+	_ "github.com/cayleygraph/cayley/quad/neo4j"
 	_ "github.com/cayleygraph/cayley/quad/nquads"
 	_ "github.com/cayleygraph/cayley/quad/pquads"
 
@@ -52,6 +54,7 @@ import (
 	_ "github.com/cayleygraph/cayley/query/gizmo"
 	_ "github.com/cayleygraph/cayley/query/graphql"
 	_ "github.com/cayleygraph/cayley/query/mql"
+	_ "github.com/cayleygraph/cayley/query/pathjson"
 	_ "github.com/cayleygraph/cayley/query/sexp"
 )
 
@@ -79,6 +82,7 @@ var (
 			graph.IgnoreDuplicates = viper.GetBool("load.ignore_duplicates")
 			graph.IgnoreMissing = viper.GetBool("load.ignore_missing")
 			quad.DefaultBatch = viper.GetInt("load.batch")
+			internal.LoadBlankNodes = viper.GetString("load.blank_nodes")
 			return nil
 		},
 	}
@@ -120,11 +124,23 @@ func init() {
 		command.NewLoadDatabaseCmd(),
 		command.NewDumpDatabaseCmd(),
 		command.NewUpgradeCmd(),
+		command.NewMaintenanceCmd(),
+		command.NewFsckCmd(),
+		command.NewMigrateCmd(),
+		command.NewDiffCmd(),
+		command.NewApplyCmd(),
+		command.NewDigestCmd(),
+		command.NewKeygenCmd(),
+		command.NewReplayCmd(),
+		command.NewUndeleteCmd(),
+		command.NewPurgeCmd(),
 		command.NewReplCmd(),
 		command.NewQueryCmd(),
 		command.NewHttpCmd(),
 		command.NewConvertCmd(),
 		command.NewDedupCommand(),
+		command.NewBenchCmd(),
+		command.NewGenDataCmd(),
 	)
 	rootCmd.PersistentFlags().StringP("config", "c", "", "path to an explicit configuration file")
 
@@ -136,6 +152,7 @@ func init() {
 	rootCmd.PersistentFlags().Bool("dup", true, "don't stop loading on duplicated on add")
 	rootCmd.PersistentFlags().Bool("missing", false, "don't stop loading on missing key on delete")
 	rootCmd.PersistentFlags().Int("batch", quad.DefaultBatch, "size of quads batch to load at once")
+	rootCmd.PersistentFlags().String("bnodes", internal.BlankNodesKeep, `how to load blank nodes ("keep", "rename" to make them unique to each file, "skolem" to replace them with stable IRIs)`)
 
 	rootCmd.PersistentFlags().String("memprofile", "", "path to output memory profile")
 	rootCmd.PersistentFlags().String("cpuprofile", "", "path to output cpu profile")
@@ -147,6 +164,7 @@ func init() {
 	viper.BindPFlag("load.ignore_duplicates", rootCmd.PersistentFlags().Lookup("dup"))
 	viper.BindPFlag("load.ignore_missing", rootCmd.PersistentFlags().Lookup("missing"))
 	viper.BindPFlag(command.KeyLoadBatch, rootCmd.PersistentFlags().Lookup("batch"))
+	viper.BindPFlag("load.blank_nodes", rootCmd.PersistentFlags().Lookup("bnodes"))
 
 	// make both store.path and store.address work
 	viper.RegisterAlias(command.KeyPath, command.KeyAddress)
@@ -0,0 +1,72 @@
+package command
+
+import (
+	"fmt"
+
+	"github.com/spf13/viper"
+
+	"github.com/cayleygraph/cayley/graph/acl"
+	"github.com/cayleygraph/cayley/quad"
+)
+
+const (
+	keySecurityRoles       = "security.roles"
+	keySecurityRoleHeader  = "security.role_header"
+	keySecurityDefaultRole = "security.default_role"
+	keySecurityAdminToken  = "security.admin_token"
+)
+
+type ruleConfig struct {
+	Action    string `mapstructure:"action"`
+	Predicate string `mapstructure:"predicate"`
+	Graph     string `mapstructure:"graph"`
+}
+
+type roleConfig struct {
+	Default string       `mapstructure:"default"`
+	Admin   bool         `mapstructure:"admin"`
+	Rules   []ruleConfig `mapstructure:"rules"`
+}
+
+// accessPolicies reads access policies of all roles from the configuration.
+func accessPolicies() (map[string]*acl.Policy, error) {
+	if !viper.IsSet(keySecurityRoles) {
+		return nil, nil
+	}
+	var roles map[string]roleConfig
+	if err := viper.UnmarshalKey(keySecurityRoles, &roles); err != nil {
+		return nil, fmt.Errorf("cannot read %s: %v", keySecurityRoles, err)
+	}
+	out := make(map[string]*acl.Policy, len(roles))
+	for name, rc := range roles {
+		p := &acl.Policy{Admin: rc.Admin}
+		switch rc.Default {
+		case "", "allow":
+		case "deny":
+			p.DenyByDefault = true
+		default:
+			return nil, fmt.Errorf("role %q: unknown default action: %q", name, rc.Default)
+		}
+		for _, r := range rc.Rules {
+			var rule acl.Rule
+			switch r.Action {
+			case "allow":
+			case "deny":
+				rule.Deny = true
+			default:
+				return nil, fmt.Errorf("role %q: unknown action: %q", name, r.Action)
+			}
+			rule.Predicate = r.Predicate
+			if r.Graph != "" {
+				v := quad.StringToValue(r.Graph)
+				if _, ok := v.(quad.String); ok {
+					v = quad.IRI(r.Graph)
+				}
+				rule.Label = v
+			}
+			p.Rules = append(p.Rules, rule)
+		}
+		out[name] = p
+	}
+	return out, nil
+}
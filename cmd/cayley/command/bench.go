@@ -0,0 +1,114 @@
+package command
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"text/tabwriter"
+	"time"
+
+	"github.com/spf13/cobra"
+
+	"github.com/cayleygraph/cayley/clog"
+	"github.com/cayleygraph/cayley/graph"
+	"github.com/cayleygraph/cayley/internal"
+	"github.com/cayleygraph/cayley/internal/bench"
+	"github.com/cayleygraph/cayley/quad"
+)
+
+func NewBenchCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "bench",
+		Short: "Load a dataset into the database and run a standard query mix against it.",
+		RunE: func(cmd *cobra.Command, args []string) error {
+			printBackendInfo()
+			p := mustSetupProfile(cmd)
+			defer mustFinishProfile(p)
+
+			if init, err := cmd.Flags().GetBool("init"); err != nil {
+				return err
+			} else if init {
+				if err = initDatabase(); err != nil {
+					return err
+				}
+			}
+			h, err := openDatabase()
+			if err != nil {
+				return err
+			}
+			defer h.Close()
+
+			ctx, cancel := getContext()
+			defer cancel()
+
+			nodes, _ := cmd.Flags().GetInt("nodes")
+			degree, _ := cmd.Flags().GetInt("degree")
+			seed, _ := cmd.Flags().GetInt64("seed")
+			dur, _ := cmd.Flags().GetDuration("duration")
+			n, _ := cmd.Flags().GetInt("queries")
+			if dur <= 0 && n <= 0 {
+				return fmt.Errorf("either duration or number of queries must be set")
+			}
+
+			var d *bench.Dataset
+			start := time.Now()
+			if load, _ := cmd.Flags().GetString(flagLoad); load != "" {
+				typ, _ := cmd.Flags().GetString(flagLoadFormat)
+				if bl, ok := graph.AsBulkLoader(h.QuadStore); ok {
+					err = internal.BulkLoad(bl, load, typ)
+				} else {
+					err = internal.Load(h.QuadWriter, quad.DefaultBatch, load, typ)
+				}
+				if err != nil {
+					return err
+				}
+				fmt.Printf("loaded %q in %v\n", load, time.Since(start))
+				d, err = bench.Sample(ctx, h.QuadStore, 10000)
+				if err != nil {
+					return err
+				}
+			} else if nodes > 0 {
+				var qr quad.Reader
+				qr, d = bench.Synthetic(nodes, degree, seed)
+				w := graph.NewWriter(h.QuadWriter)
+				cnt, err := quad.CopyBatch(w, qr, quad.DefaultBatch)
+				if err != nil {
+					return err
+				} else if err = w.Close(); err != nil {
+					return err
+				}
+				fmt.Printf("loaded %d synthetic quads in %v\n", cnt, time.Since(start))
+			} else {
+				if d, err = bench.Sample(ctx, h.QuadStore, 10000); err != nil {
+					return err
+				}
+			}
+
+			tw := tabwriter.NewWriter(os.Stdout, 0, 8, 2, ' ', 0)
+			fmt.Fprintln(tw, "query\tops\tops/s\tp50\tp90\tp99\tmax\tresults")
+			for i, q := range bench.Queries {
+				clog.Infof("running %q queries: %s", q.Name, q.Desc)
+				res, err := bench.Run(ctx, h.QuadStore, d, q, dur, n, seed+int64(i))
+				if err == context.Canceled {
+					break
+				} else if err != nil {
+					return fmt.Errorf("%s: %v", q.Name, err)
+				} else if res.Ops == 0 {
+					fmt.Fprintf(tw, "%s\tskipped\n", res.Name)
+					continue
+				}
+				fmt.Fprintf(tw, "%s\t%d\t%.1f\t%v\t%v\t%v\t%v\t%d\n",
+					res.Name, res.Ops, res.Throughput(), res.P50, res.P90, res.P99, res.Max, res.Results)
+			}
+			return tw.Flush()
+		},
+	}
+	cmd.Flags().Bool("init", false, "initialize the database before using it")
+	registerLoadFlags(cmd)
+	cmd.Flags().Int("nodes", 10000, "number of nodes in a synthetic dataset; it is loaded if no quad file is specified (0 to use existing data)")
+	cmd.Flags().Int("degree", 5, "number of out links of each node in a synthetic dataset")
+	cmd.Flags().Int64("seed", 1, "random seed for a synthetic dataset and queries")
+	cmd.Flags().Duration("duration", 10*time.Second, "time to run each query type")
+	cmd.Flags().Int("queries", 0, "maximal number of queries of each type (0 for no limit)")
+	return cmd
+}
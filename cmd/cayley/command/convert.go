@@ -70,6 +70,48 @@ func (r *multiReader) Close() error {
 	return nil
 }
 
+// filterReader passes only quads that have one of the specified labels and predicates.
+// Empty sets are ignored.
+type filterReader struct {
+	qr      quad.Reader
+	labels  map[quad.Value]struct{}
+	preds   map[quad.Value]struct{}
+	skipped int
+}
+
+func valueSet(arr []string) map[quad.Value]struct{} {
+	if len(arr) == 0 {
+		return nil
+	}
+	m := make(map[quad.Value]struct{}, len(arr))
+	for _, s := range arr {
+		m[quad.StringToValue(s)] = struct{}{}
+	}
+	return m
+}
+
+func (r *filterReader) ReadQuad() (quad.Quad, error) {
+	for {
+		q, err := r.qr.ReadQuad()
+		if err != nil {
+			return q, err
+		}
+		if r.labels != nil {
+			if _, ok := r.labels[q.Label]; !ok {
+				r.skipped++
+				continue
+			}
+		}
+		if r.preds != nil {
+			if _, ok := r.preds[q.Predicate]; !ok {
+				r.skipped++
+				continue
+			}
+		}
+		return q, nil
+	}
+}
+
 func NewConvertCmd() *cobra.Command {
 	cmd := &cobra.Command{
 		Use:     "convert",
@@ -104,11 +146,27 @@ func NewConvertCmd() *cobra.Command {
 					return internal.QuadReaderFor(path, loadf)
 				}))
 			}
-			// TODO: print additional stats
-			return writerQuadsTo(dump, dumpf, &multi)
+			labels, _ := cmd.Flags().GetStringSlice("graph")
+			preds, _ := cmd.Flags().GetStringSlice("predicate")
+			if len(labels) == 0 && len(preds) == 0 {
+				// TODO: print additional stats
+				return writerQuadsTo(dump, dumpf, &multi)
+			}
+			fr := &filterReader{qr: &multi, labels: valueSet(labels), preds: valueSet(preds)}
+			if err := writerQuadsTo(dump, dumpf, fr); err != nil {
+				return err
+			}
+			if dump == "-" {
+				clog.Infof("%d entries were skipped", fr.skipped)
+			} else {
+				fmt.Printf("%d entries were skipped\n", fr.skipped)
+			}
+			return nil
 		},
 	}
 	registerLoadFlags(cmd)
 	registerDumpFlags(cmd)
+	cmd.Flags().StringSlice("graph", nil, `convert only quads from specified graphs (ex: "<graph>")`)
+	cmd.Flags().StringSlice("predicate", nil, `convert only quads with specified predicates (ex: "<follows>")`)
 	return cmd
 }
@@ -1,6 +1,7 @@
 package command
 
 import (
+	"context"
 	"errors"
 	"fmt"
 	"os"
@@ -8,14 +9,20 @@ import (
 	"runtime/pprof"
 	"sort"
 	"strings"
+	"time"
 
 	"github.com/spf13/cobra"
 	"github.com/spf13/viper"
 
 	"github.com/cayleygraph/cayley/clog"
 	"github.com/cayleygraph/cayley/graph"
+	"github.com/cayleygraph/cayley/graph/journal"
+	"github.com/cayleygraph/cayley/graph/sameas"
+	"github.com/cayleygraph/cayley/graph/textindex/bleve"
+	"github.com/cayleygraph/cayley/graph/vectorindex/hnsw"
 	"github.com/cayleygraph/cayley/internal"
 	"github.com/cayleygraph/cayley/quad"
+	"github.com/cayleygraph/cayley/schema"
 )
 
 const (
@@ -25,6 +32,15 @@ const (
 	KeyReadOnly = "store.read_only"
 	KeyOptions  = "store.options"
 
+	KeyJournal       = "store.journal"
+	KeyJournalNoSync = "store.journal_nosync"
+
+	KeyTextIndex   = "store.text_index"
+	KeyVectorIndex = "store.vector_index"
+
+	KeySameAs          = "store.same_as"
+	KeySameAsPredicate = "store.same_as_predicate"
+
 	KeyLoadBatch = "load.batch"
 )
 
@@ -33,6 +49,9 @@ const (
 	flagLoadFormat = "load_format"
 	flagDump       = "dump"
 	flagDumpFormat = "dump_format"
+	flagSign       = "sign"
+	flagVerify     = "verify"
+	flagRepair     = "repair"
 )
 
 var ErrNotPersistent = errors.New("database type is not persistent")
@@ -94,6 +113,15 @@ func NewLoadDatabaseCmd() *cobra.Command {
 			if load == "" {
 				return errors.New("quads file must be specified")
 			}
+			typ, _ := cmd.Flags().GetString(flagLoadFormat)
+			var qr quad.ReadCloser
+			if key, _ := cmd.Flags().GetString(flagVerify); key != "" {
+				var err error
+				if qr, err = openVerified(key, load, typ); err != nil {
+					return err
+				}
+				defer qr.Close()
+			}
 			if init, err := cmd.Flags().GetBool("init"); err != nil {
 				return err
 			} else if init {
@@ -108,14 +136,25 @@ func NewLoadDatabaseCmd() *cobra.Command {
 			defer h.Close()
 
 			// TODO: check read-only flag in config before that?
-			typ, _ := cmd.Flags().GetString(flagLoadFormat)
-			if err = internal.Load(h.QuadWriter, quad.DefaultBatch, load, typ); err != nil {
+			bl, bulk := graph.AsBulkLoader(h.QuadStore)
+			switch {
+			case qr != nil && bulk:
+				err = bl.BulkLoad(qr)
+			case qr != nil:
+				err = internal.LoadReader(h.QuadWriter, quad.DefaultBatch, qr)
+			case bulk:
+				err = internal.BulkLoad(bl, load, typ)
+			default:
+				err = internal.Load(h.QuadWriter, quad.DefaultBatch, load, typ)
+			}
+			if err != nil {
 				return err
 			}
 
 			if dump, _ := cmd.Flags().GetString(flagDump); dump != "" {
 				typ, _ := cmd.Flags().GetString(flagDumpFormat)
-				if err = dumpDatabase(h, dump, typ); err != nil {
+				key, _ := cmd.Flags().GetString(flagSign)
+				if err = dumpDatabase(h, dump, typ, key); err != nil {
 					return err
 				}
 			}
@@ -125,6 +164,8 @@ func NewLoadDatabaseCmd() *cobra.Command {
 	cmd.Flags().Bool("init", false, "initialize the database before using it")
 	registerLoadFlags(cmd)
 	registerDumpFlags(cmd)
+	cmd.Flags().String(flagVerify, "", "public key to verify the signature of the quad file with; unsigned or tampered files are not loaded")
+	cmd.Flags().String(flagSign, "", "private key to sign the dump with")
 	return cmd
 }
 
@@ -145,10 +186,12 @@ func NewDumpDatabaseCmd() *cobra.Command {
 			defer h.Close()
 
 			typ, _ := cmd.Flags().GetString(flagDumpFormat)
-			return dumpDatabase(h, dump, typ)
+			key, _ := cmd.Flags().GetString(flagSign)
+			return dumpDatabase(h, dump, typ, key)
 		},
 	}
 	registerDumpFlags(cmd)
+	cmd.Flags().String(flagSign, "", `private key to sign the dump with; the signature is written to a file with ".sig" extension`)
 	return cmd
 }
 
@@ -171,6 +214,68 @@ func NewUpgradeCmd() *cobra.Command {
 	return cmd
 }
 
+func NewMaintenanceCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "maintenance",
+		Short: "Compact the database to reclaim space left after removed data.",
+		RunE: func(cmd *cobra.Command, args []string) error {
+			printBackendInfo()
+			h, err := openDatabase()
+			if err != nil {
+				return err
+			}
+			defer h.Close()
+			m, ok := graph.AsMaintainer(h.QuadStore)
+			if !ok {
+				return graph.ErrOperationNotSupported
+			}
+			clog.Infof("compacting database...")
+			start := time.Now()
+			if err = m.Compact(context.Background()); err != nil {
+				return err
+			}
+			clog.Infof("compacted in %v", time.Since(start))
+			return nil
+		},
+	}
+	return cmd
+}
+
+func NewFsckCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "fsck",
+		Short: "Check the database for inconsistencies and optionally repair them.",
+		RunE: func(cmd *cobra.Command, args []string) error {
+			printBackendInfo()
+			repair, _ := cmd.Flags().GetBool(flagRepair)
+			h, err := openDatabase()
+			if err != nil {
+				return err
+			}
+			defer h.Close()
+			c, ok := graph.AsChecker(h.QuadStore)
+			if !ok {
+				return graph.ErrOperationNotSupported
+			}
+			start := time.Now()
+			probs, err := c.Check(context.Background(), repair)
+			for _, p := range probs {
+				fmt.Println(p)
+			}
+			if err != nil {
+				return err
+			}
+			clog.Infof("checked in %v, %d problems found", time.Since(start), len(probs))
+			if len(probs) != 0 && !repair {
+				return fmt.Errorf("database is inconsistent, run with --%s to fix it", flagRepair)
+			}
+			return nil
+		},
+	}
+	cmd.Flags().Bool(flagRepair, false, "fix found problems")
+	return cmd
+}
+
 func printBackendInfo() {
 	name := viper.GetString(KeyBackend)
 	path := viper.GetString(KeyAddress)
@@ -191,10 +296,71 @@ func openDatabase() (*graph.Handle, error) {
 	name := viper.GetString(KeyBackend)
 	path := viper.GetString(KeyAddress)
 	opts := graph.Options(viper.GetStringMap(KeyOptions))
+	if viper.GetBool(KeyReadOnly) {
+		// open the backend in read-only mode as well, if it supports it
+		ro := make(graph.Options, len(opts)+1)
+		for k, v := range opts {
+			ro[k] = v
+		}
+		if _, ok := ro["read_only"]; !ok {
+			ro["read_only"] = true
+		}
+		opts = ro
+	}
 	qs, err := graph.NewQuadStore(name, path, opts)
 	if err != nil {
 		return nil, err
 	}
+	// indexes must be updated by all writes, including the ones recorded in the journal
+	if tpath := viper.GetString(KeyTextIndex); tpath != "" {
+		idx, created, err := bleve.OpenOrNew(tpath)
+		if err != nil {
+			qs.Close()
+			return nil, err
+		}
+		if created {
+			clog.Infof("indexing text values in %q", tpath)
+			if err = graph.IndexAllText(context.TODO(), qs, idx); err != nil {
+				idx.Close()
+				qs.Close()
+				return nil, err
+			}
+		}
+		qs = graph.WithTextIndex(qs, idx)
+	}
+	if viper.GetBool(KeyVectorIndex) {
+		// the index is not persisted, thus it must be rebuilt on each start
+		idx := hnsw.New(nil)
+		if err = graph.IndexAllVectors(context.TODO(), qs, idx); err != nil {
+			qs.Close()
+			return nil, err
+		}
+		qs = graph.WithVectorIndex(qs, idx)
+	}
+	if jpath := viper.GetString(KeyJournal); jpath != "" {
+		j, err := journal.Open(jpath, viper.GetBool(KeyJournalNoSync))
+		if err != nil {
+			qs.Close()
+			return nil, err
+		}
+		qs = journal.Wrap(qs, j)
+	}
+	if viper.GetBool(KeySameAs) {
+		var pred quad.Value
+		if p := viper.GetString(KeySameAsPredicate); p != "" {
+			pred = quad.IRI(p)
+		}
+		sqs, err := sameas.New(context.TODO(), qs, pred)
+		if err != nil {
+			qs.Close()
+			return nil, err
+		}
+		qs = sqs
+	}
+	// make namespaces persisted in the database available to all query languages
+	if err = schema.LoadNamespaces(context.TODO(), qs, nil); err != nil {
+		clog.Warningf("cannot load namespaces: %v", err)
+	}
 	qw, err := graph.NewQuadWriter("single", qs, opts)
 	if err != nil {
 		return nil, err
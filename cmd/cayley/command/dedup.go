@@ -7,6 +7,7 @@ import (
 	"fmt"
 	"hash"
 	"sort"
+	"strings"
 	"time"
 
 	"github.com/spf13/cobra"
@@ -16,6 +17,7 @@ import (
 	"github.com/cayleygraph/cayley/graph"
 	"github.com/cayleygraph/cayley/graph/path"
 	"github.com/cayleygraph/cayley/quad"
+	"github.com/cayleygraph/cayley/voc/owl"
 	"github.com/cayleygraph/cayley/voc/rdf"
 )
 
@@ -26,32 +28,342 @@ func iriFlag(s string, err error) (quad.IRI, error) {
 	return quad.IRI(s), nil
 }
 
+const (
+	dedupRuleProps  = "props"
+	dedupRuleValue  = "value"
+	dedupRuleSameAs = "sameas"
+)
+
 func NewDedupCommand() *cobra.Command {
 	cmd := &cobra.Command{
 		Use:   "dedup",
-		Short: "Deduplicate bnode values",
+		Short: "Merge duplicate nodes",
+		Long: `Merge nodes that are considered identical, rewriting all quads that reference them.
+
+Supported rules:
+  props   merges bnodes of a given type that have exactly the same properties (default if --type is set)
+  value   merges nodes with the same value after normalization; see --normalize
+  sameas  merges nodes connected with owl:sameAs links (or a predicate set with --sameas)
+
+Nodes are merged into the node with the smallest value, preferring IRIs for sameas rule.
+All quads of merged nodes are rewritten in the same transaction.`,
 		RunE: func(cmd *cobra.Command, args []string) error {
 			ctx := context.Background()
+			pred, _ := iriFlag(cmd.Flags().GetString("pred"))
+			typ, _ := iriFlag(cmd.Flags().GetString("type"))
+			rule, _ := cmd.Flags().GetString("rule")
+			if rule == "" && typ != "" {
+				rule = dedupRuleProps
+			}
+			var find func(ctx context.Context, qs graph.QuadStore) ([]dedupGroup, error)
+			switch rule {
+			case dedupRuleProps:
+				if typ == "" {
+					return errors.New("no type is specified")
+				}
+			case dedupRuleValue:
+				names, _ := cmd.Flags().GetStringSlice("normalize")
+				norm, err := parseNormalize(names)
+				if err != nil {
+					return err
+				}
+				find = func(ctx context.Context, qs graph.QuadStore) ([]dedupGroup, error) {
+					return groupByValue(ctx, qs, pred, typ, norm)
+				}
+			case dedupRuleSameAs:
+				same, _ := iriFlag(cmd.Flags().GetString("sameas"))
+				find = func(ctx context.Context, qs graph.QuadStore) ([]dedupGroup, error) {
+					return groupSameAs(ctx, qs, same)
+				}
+			case "":
+				return errors.New("no rule is specified")
+			default:
+				return fmt.Errorf("unsupported rule: %q", rule)
+			}
+			dry, _ := cmd.Flags().GetBool("dry-run")
+			if dry && find == nil {
+				return errors.New("dry run is not supported for props rule")
+			}
+
 			printBackendInfo()
 			h, err := openDatabase()
 			if err != nil {
 				return err
 			}
 			defer h.Close()
-
-			pred, _ := iriFlag(cmd.Flags().GetString("pred"))
-			typ, _ := iriFlag(cmd.Flags().GetString("type"))
-			if typ == "" {
-				return errors.New("no type is specified")
+			if find == nil {
+				return dedupProperties(ctx, h, pred, typ)
+			}
+			groups, err := find(ctx, h.QuadStore)
+			if err != nil {
+				return err
+			}
+			if dry {
+				for _, g := range groups {
+					fmt.Println(g)
+				}
+				return nil
 			}
-			return dedupProperties(ctx, h, pred, typ)
+			return mergeGroups(ctx, h, groups)
 		},
 	}
+	cmd.Flags().String("rule", "", "rule to find duplicates: props, value or sameas")
 	cmd.Flags().String("pred", rdf.Type, "type predicate to use to find nodes")
-	cmd.Flags().String("type", "", "type value to use to find nodes")
+	cmd.Flags().String("type", "", "type value to use to find nodes; value rule checks all nodes if not set")
+	cmd.Flags().StringSlice("normalize", []string{normSpace}, "normalization for value rule: space, case, slash")
+	cmd.Flags().String("sameas", owl.SameAs, "predicate linking identical nodes for sameas rule")
+	cmd.Flags().Bool("dry-run", false, "only print nodes that will be merged")
 	return cmd
 }
 
+// dedupGroup is a set of nodes that will be merged, and the quads that link them.
+type dedupGroup struct {
+	graph.NodeMerge
+	links []quad.Quad // links between nodes of the group; removed after the merge
+}
+
+func (g dedupGroup) String() string {
+	s := quad.StringOf(g.Into) + " <-"
+	for _, v := range g.Nodes {
+		s += " " + quad.StringOf(v)
+	}
+	return s
+}
+
+const (
+	normSpace = "space" // trim and collapse whitespace
+	normCase  = "case"  // convert to lower case
+	normSlash = "slash" // remove trailing slashes from IRIs
+)
+
+type normalizer struct {
+	space, lower, slash bool
+}
+
+func parseNormalize(names []string) (normalizer, error) {
+	var n normalizer
+	for _, name := range names {
+		switch strings.TrimSpace(name) {
+		case normSpace:
+			n.space = true
+		case normCase:
+			n.lower = true
+		case normSlash:
+			n.slash = true
+		case "":
+		default:
+			return n, fmt.Errorf("unsupported normalization: %q", name)
+		}
+	}
+	return n, nil
+}
+
+func (n normalizer) text(s string) string {
+	if n.space {
+		s = strings.Join(strings.Fields(s), " ")
+	}
+	if n.lower {
+		s = strings.ToLower(s)
+	}
+	return s
+}
+
+// key returns a normalized key of the value. Only values of the same kind (and type or language) have the same key.
+// Blank nodes cannot be compared by value and are skipped.
+func (n normalizer) key(v quad.Value) (string, bool) {
+	switch v := v.(type) {
+	case quad.BNode:
+		return "", false
+	case quad.IRI:
+		s := string(v.Full())
+		if n.slash {
+			s = strings.TrimRight(s, "/")
+		}
+		return "i:" + n.text(s), true
+	case quad.String:
+		return "s:" + n.text(string(v)), true
+	case quad.LangString:
+		return "l:" + strings.ToLower(v.Lang) + ":" + n.text(string(v.Value)), true
+	case quad.TypedString:
+		return "t:" + string(v.Type.Full()) + ":" + n.text(string(v.Value)), true
+	case nil:
+		return "", false
+	}
+	return "v:" + quad.StringOf(v), true
+}
+
+// newDedupGroup creates a group that merges all nodes into the first one after sorting.
+func newDedupGroup(vals []quad.Value, less func(a, b quad.Value) bool) dedupGroup {
+	sort.Slice(vals, func(i, j int) bool { return less(vals[i], vals[j]) })
+	return dedupGroup{NodeMerge: graph.NodeMerge{Into: vals[0], Nodes: vals[1:]}}
+}
+
+func stringLess(a, b quad.Value) bool {
+	return quad.StringOf(a) < quad.StringOf(b)
+}
+
+// groupByValue finds nodes with the same value after normalization.
+// If the type is set, only nodes of that type are checked.
+func groupByValue(ctx context.Context, qs graph.QuadStore, pred, typ quad.IRI, norm normalizer) ([]dedupGroup, error) {
+	var it graph.Iterator
+	if typ != "" {
+		it = path.StartPath(qs).Has(pred, typ).BuildIterator()
+	} else {
+		it = qs.NodesAllIterator()
+	}
+	var (
+		byKey = make(map[string][]quad.Value)
+		keys  []string
+	)
+	err := graph.Iterate(ctx, it).EachValue(qs, func(v quad.Value) {
+		k, ok := norm.key(v)
+		if !ok {
+			return
+		}
+		if _, ok := byKey[k]; !ok {
+			keys = append(keys, k)
+		}
+		byKey[k] = append(byKey[k], v)
+	})
+	if err != nil {
+		return nil, err
+	}
+	var out []dedupGroup
+	for _, k := range keys {
+		if vals := byKey[k]; len(vals) > 1 {
+			out = append(out, newDedupGroup(vals, stringLess))
+		}
+	}
+	return out, nil
+}
+
+// groupSameAs finds sets of nodes connected by a given predicate.
+func groupSameAs(ctx context.Context, qs graph.QuadStore, same quad.IRI) ([]dedupGroup, error) {
+	ref := qs.ValueOf(same)
+	if ref == nil {
+		return nil, nil
+	}
+	// union-find over string representations of values
+	var (
+		parent = make(map[string]string)
+		vals   = make(map[string]quad.Value)
+		links  []quad.Quad
+	)
+	var root func(k string) string
+	root = func(k string) string {
+		p, ok := parent[k]
+		if !ok || p == k {
+			return k
+		}
+		r := root(p)
+		parent[k] = r
+		return r
+	}
+	it := qs.QuadIterator(quad.Predicate, ref)
+	defer it.Close()
+	for it.Next(ctx) {
+		q := qs.Quad(it.Result())
+		s, o := quad.StringOf(q.Subject), quad.StringOf(q.Object)
+		vals[s], vals[o] = q.Subject, q.Object
+		links = append(links, q)
+		if rs, ro := root(s), root(o); rs != ro {
+			parent[rs] = ro
+		}
+	}
+	if err := it.Err(); err != nil {
+		return nil, err
+	}
+	var (
+		members = make(map[string][]quad.Value)
+		roots   []string
+	)
+	for k, v := range vals {
+		r := root(k)
+		if _, ok := members[r]; !ok {
+			roots = append(roots, r)
+		}
+		members[r] = append(members[r], v)
+	}
+	sort.Strings(roots)
+	var (
+		out   []dedupGroup
+		index = make(map[string]int)
+	)
+	for _, r := range roots {
+		if len(members[r]) < 2 {
+			continue
+		}
+		index[r] = len(out)
+		out = append(out, newDedupGroup(members[r], func(a, b quad.Value) bool {
+			// prefer IRIs over blank nodes and literals
+			_, ia := a.(quad.IRI)
+			_, ib := b.(quad.IRI)
+			if ia != ib {
+				return ia
+			}
+			return stringLess(a, b)
+		}))
+	}
+	for _, q := range links {
+		if i, ok := index[root(quad.StringOf(q.Subject))]; ok {
+			out[i].links = append(out[i].links, q)
+		}
+	}
+	return out, nil
+}
+
+// mergeGroups merges nodes of each group. Groups are merged in batches, each batch in a single transaction.
+func mergeGroups(ctx context.Context, h *graph.Handle, groups []dedupGroup) error {
+	batch := viper.GetInt(KeyLoadBatch)
+	if batch == 0 {
+		batch = quad.DefaultBatch
+	}
+	start := time.Now()
+	merged, quads := 0, 0
+	for len(groups) != 0 {
+		n, size := 0, 0
+		for n < len(groups) && (n == 0 || size+len(groups[n].Nodes) <= batch) {
+			size += len(groups[n].Nodes)
+			n++
+		}
+		cur := groups[:n]
+		groups = groups[n:]
+
+		merges := make([]graph.NodeMerge, 0, len(cur))
+		for _, g := range cur {
+			merges = append(merges, g.NodeMerge)
+		}
+		m, err := graph.NewMerger(merges...)
+		if err != nil {
+			return err
+		}
+		tx := graph.NewTransaction()
+		cnt, err := m.Apply(ctx, h.QuadStore, tx)
+		if err != nil {
+			return err
+		}
+		loops := make(map[quad.Quad]struct{})
+		for _, g := range cur {
+			for _, q := range g.links {
+				// links become loops after the merge
+				q = m.Quad(q)
+				if _, ok := loops[q]; !ok {
+					loops[q] = struct{}{}
+					tx.RemoveQuad(q)
+				}
+			}
+		}
+		if err = h.ApplyTransaction(tx); err != nil {
+			return err
+		}
+		merged += m.Len()
+		quads += cnt
+		clog.Infof("merged %d nodes, rewritten %d quads", merged, quads)
+	}
+	clog.Infof("merged %d nodes in %v", merged, time.Since(start))
+	return nil
+}
+
 func valueLess(a, b graph.Value) bool {
 	// TODO(dennwc): more effective way
 	s1, s2 := fmt.Sprint(a), fmt.Sprint(b)
@@ -0,0 +1,113 @@
+package command
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+
+	"github.com/cayleygraph/cayley/clog"
+	"github.com/cayleygraph/cayley/graph"
+	"github.com/cayleygraph/cayley/graph/patch"
+)
+
+func NewDiffCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "diff",
+		Short: "Write changes between two databases as a patch.",
+		Long: "Compare two databases and write a patch that transforms the source database into the destination one.\n\n" +
+			"The patch can be applied to another copy of the source database with \"cayley apply\".",
+		RunE: func(cmd *cobra.Command, args []string) error {
+			from, _ := cmd.Flags().GetString(flagFrom)
+			fromDB, _ := cmd.Flags().GetString(flagFromDB)
+			to, _ := cmd.Flags().GetString(flagTo)
+			toDB, _ := cmd.Flags().GetString(flagToDB)
+			if from == "" || to == "" {
+				return errors.New("both source and destination backends must be specified")
+			}
+			a, err := graph.NewQuadStore(from, fromDB, graph.Options{"read_only": true})
+			if err != nil {
+				return fmt.Errorf("cannot open source: %v", err)
+			}
+			defer a.Close()
+			b, err := graph.NewQuadStore(to, toDB, graph.Options{"read_only": true})
+			if err != nil {
+				return fmt.Errorf("cannot open destination: %v", err)
+			}
+			defer b.Close()
+
+			var w io.Writer = os.Stdout
+			if out, _ := cmd.Flags().GetString("out"); out != "-" {
+				f, err := os.Create(out)
+				if err != nil {
+					return fmt.Errorf("could not create file %q: %v", out, err)
+				}
+				defer f.Close()
+				w = f
+			}
+			ctx, cancel := context.WithCancel(context.Background())
+			defer cancel()
+			deltas, errc := graph.Diff(ctx, a, b)
+			pw := patch.NewWriter(w)
+			pw.WriteComment(fmt.Sprintf("diff from %s (%s) to %s (%s)", from, fromDB, to, toDB))
+			n, err := patch.Copy(pw, deltas)
+			if err != nil {
+				return err
+			} else if err = <-errc; err != nil {
+				return err
+			}
+			clog.Infof("found %d changes", n)
+			return nil
+		},
+	}
+	cmd.Flags().String(flagFrom, "", "source database backend")
+	cmd.Flags().String(flagFromDB, "", "source database path or address")
+	cmd.Flags().String(flagTo, "", "destination database backend")
+	cmd.Flags().String(flagToDB, "", "destination database path or address")
+	cmd.Flags().StringP("out", "o", "-", `patch file to write ("-" for stdout)`)
+	return cmd
+}
+
+func NewApplyCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "apply <patch>",
+		Short: "Apply a patch to the database.",
+		Long: "Apply a patch written by \"cayley diff\" to the database (\"-\" reads the patch from stdin).\n\n" +
+			"Changes are applied in transactions of the load batch size, unless --atomic is set.",
+		Args: cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			printBackendInfo()
+			var r io.Reader = os.Stdin
+			if args[0] != "-" {
+				f, err := os.Open(args[0])
+				if err != nil {
+					return err
+				}
+				defer f.Close()
+				r = f
+			}
+			h, err := openDatabase()
+			if err != nil {
+				return err
+			}
+			defer h.Close()
+
+			batch := viper.GetInt(KeyLoadBatch)
+			if atomic, _ := cmd.Flags().GetBool("atomic"); atomic {
+				batch = 0
+			}
+			n, err := patch.Apply(h.QuadWriter, patch.NewReader(r), batch)
+			if err != nil {
+				return fmt.Errorf("applied %d changes: %v", n, err)
+			}
+			clog.Infof("applied %d changes", n)
+			return nil
+		},
+	}
+	cmd.Flags().Bool("atomic", false, "apply the whole patch in a single transaction")
+	return cmd
+}
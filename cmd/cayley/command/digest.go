@@ -0,0 +1,55 @@
+package command
+
+import (
+	"context"
+	"encoding/hex"
+	"fmt"
+
+	"github.com/spf13/cobra"
+
+	"github.com/cayleygraph/cayley/graph"
+	"github.com/cayleygraph/cayley/internal"
+)
+
+func NewDigestCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "digest [file]",
+		Short: "Print a digest of the database or a quad file.",
+		Long: "Print a SHA-256 digest of all quads in the database, or in a quad file if it is specified (\"-\" for stdin).\n\n" +
+			"The digest does not depend on the order of quads and on labels of blank nodes, " +
+			"thus it can be used to verify that replicas and dumps have the same content. " +
+			"Quad files must not contain duplicate quads.",
+		Args: cobra.MaximumNArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			ctx := context.Background()
+			var (
+				sum []byte
+				err error
+			)
+			if len(args) == 1 {
+				typ, _ := cmd.Flags().GetString(flagLoadFormat)
+				qr, rerr := internal.QuadReaderFor(args[0], typ)
+				if rerr != nil {
+					return rerr
+				}
+				defer qr.Close()
+				sum, err = graph.DigestReader(ctx, qr)
+			} else {
+				printBackendInfo()
+				h, herr := openDatabase()
+				if herr != nil {
+					return herr
+				}
+				defer h.Close()
+				sum, err = graph.Digest(ctx, h.QuadStore)
+			}
+			if err != nil {
+				return err
+			}
+			fmt.Println(hex.EncodeToString(sum))
+			return nil
+		},
+	}
+	cmd.Flags().String(flagLoadFormat, "", "quad file format to use instead of auto-detection")
+	return cmd
+}
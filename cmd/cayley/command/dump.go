@@ -2,6 +2,7 @@ package command
 
 import (
 	"compress/gzip"
+	"errors"
 	"fmt"
 	"io"
 	"os"
@@ -10,6 +11,8 @@ import (
 
 	"github.com/cayleygraph/cayley/clog"
 	"github.com/cayleygraph/cayley/graph"
+	"github.com/cayleygraph/cayley/internal"
+	"github.com/cayleygraph/cayley/internal/sign"
 	"github.com/cayleygraph/cayley/quad"
 )
 
@@ -66,9 +69,58 @@ func writerQuadsTo(path string, typ string, qr quad.Reader) error {
 	return nil
 }
 
-func dumpDatabase(h *graph.Handle, path string, typ string) error {
+// dumpDatabase writes all quads to a file. If the key is set, the dump is signed with it (see sign package).
+func dumpDatabase(h *graph.Handle, path string, typ string, key string) error {
 	//TODO: add possible support for exporting specific queries only
 	qr := graph.NewQuadStoreReader(h.QuadStore)
 	defer qr.Close()
-	return writerQuadsTo(path, typ, qr)
+	if key == "" {
+		return writerQuadsTo(path, typ, qr)
+	} else if path == "-" {
+		return errors.New("cannot sign a dump written to stdout")
+	}
+	priv, err := sign.ReadPrivateKey(key)
+	if err != nil {
+		return err
+	}
+	if err = writerQuadsTo(path, typ, qr); err != nil {
+		return err
+	}
+	if err = sign.SignFile(priv, path); err != nil {
+		return err
+	}
+	fmt.Printf("signature was written to %q\n", path+sign.Ext)
+	return nil
+}
+
+// openVerified opens a quad file and checks its signature with the public key.
+// Quads are read from the same file handle that was verified.
+func openVerified(key string, path, typ string) (quad.ReadCloser, error) {
+	if path == "-" {
+		return nil, errors.New("cannot verify a signature of stdin")
+	}
+	pub, err := sign.ReadPublicKey(key)
+	if err != nil {
+		return nil, err
+	}
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	digest, err := sign.Digest(f)
+	if err == nil {
+		err = sign.Verify(pub, path, digest)
+		if err != nil {
+			err = fmt.Errorf("refusing to load %q: %v", path, err)
+		}
+	}
+	if err == nil {
+		_, err = f.Seek(0, io.SeekStart)
+	}
+	if err != nil {
+		f.Close()
+		return nil, err
+	}
+	clog.Infof("signature of %q is valid", path)
+	return internal.QuadReaderFrom(f, path, typ)
 }
@@ -0,0 +1,51 @@
+package command
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/spf13/cobra"
+
+	"github.com/cayleygraph/cayley/graph/graphtest/gen"
+	"github.com/cayleygraph/cayley/quad"
+)
+
+func NewGenDataCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "gen-data",
+		Short: "Generate a synthetic graph for load testing and benchmarks.",
+		RunE: func(cmd *cobra.Command, args []string) error {
+			dump, _ := cmd.Flags().GetString(flagDump)
+			if dump == "" && len(args) == 1 {
+				dump = args[0]
+			}
+			if dump == "" {
+				return errors.New("output file must be specified")
+			}
+			dumpf, _ := cmd.Flags().GetString(flagDumpFormat)
+			model, _ := cmd.Flags().GetString("model")
+			nodes, _ := cmd.Flags().GetInt("nodes")
+			degree, _ := cmd.Flags().GetInt("degree")
+			seed, _ := cmd.Flags().GetInt64("seed")
+
+			var qr quad.Reader
+			switch model {
+			case "ba":
+				qr = gen.BarabasiAlbert(nodes, degree, seed)
+			case "social":
+				c := gen.DefaultSocial(nodes)
+				c.Knows, c.Seed = degree, seed
+				qr = c.SocialNetwork()
+			default:
+				return fmt.Errorf("unsupported graph model: %q", model)
+			}
+			return writerQuadsTo(dump, dumpf, qr)
+		},
+	}
+	registerDumpFlags(cmd)
+	cmd.Flags().String("model", "ba", `graph model: "ba" (Barabási–Albert) or "social" (LDBC-like social network)`)
+	cmd.Flags().Int("nodes", 10000, "number of nodes (persons for social network)")
+	cmd.Flags().Int("degree", 5, "number of links of each new node")
+	cmd.Flags().Int64("seed", 1, "random seed")
+	return cmd
+}
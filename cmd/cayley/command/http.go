@@ -1,8 +1,13 @@
 package command
 
 import (
+	"context"
+	"fmt"
 	"net"
 	"net/http"
+	"os"
+	"os/signal"
+	"syscall"
 	"time"
 
 	"github.com/spf13/cobra"
@@ -10,11 +15,124 @@ import (
 
 	"github.com/cayleygraph/cayley/clog"
 	"github.com/cayleygraph/cayley/graph"
+	"github.com/cayleygraph/cayley/graph/audit"
 	"github.com/cayleygraph/cayley/internal"
 	chttp "github.com/cayleygraph/cayley/internal/http"
 	"github.com/cayleygraph/cayley/quad"
+	cayleyhttp "github.com/cayleygraph/cayley/server/http"
 )
 
+const (
+	keyIdempotencySize = "http.idempotency.size"
+	keyIdempotencyTTL  = "http.idempotency.ttl"
+
+	keyLogVerbosity = "log.verbosity"
+
+	keyShutdownTimeout = "http.shutdown_timeout"
+
+	keyAuditSink            = "audit.sink"
+	keyAuditAddress         = "audit.address"
+	keyAuditPrincipalHeader = "audit.principal_header"
+)
+
+// httpConfig returns settings of the HTTP server from the current configuration.
+func httpConfig() (*chttp.Config, error) {
+	roles, err := accessPolicies()
+	if err != nil {
+		return nil, err
+	}
+	return &chttp.Config{
+		Timeout:     viper.GetDuration(keyQueryTimeout),
+		ReadOnly:    viper.GetBool(KeyReadOnly),
+		MaxScanned:  viper.GetInt64(keyQueryMaxScanned),
+		CompactIRIs: viper.GetBool(keyCompactIRIs),
+		TypedValues: viper.GetBool(keyTypedValues),
+		Backend:     viper.GetString(KeyBackend),
+		CacheSize:   viper.GetInt(keyQueryCacheSize),
+		CacheTTL:    viper.GetDuration(keyQueryCacheTTL),
+		Parallelism: viper.GetInt(keyQueryParallelism),
+
+		IdempotencySize: viper.GetInt(keyIdempotencySize),
+		IdempotencyTTL:  viper.GetDuration(keyIdempotencyTTL),
+
+		Roles:       roles,
+		RoleHeader:  viper.GetString(keySecurityRoleHeader),
+		DefaultRole: viper.GetString(keySecurityDefaultRole),
+		AdminToken:  viper.GetString(keySecurityAdminToken),
+
+		PrincipalHeader: viper.GetString(keyAuditPrincipalHeader),
+	}, nil
+}
+
+func setupLogVerbosity() {
+	if viper.IsSet(keyLogVerbosity) {
+		clog.SetV(viper.GetInt(keyLogVerbosity))
+	}
+}
+
+// reloadHTTPConfig reads the config file again and applies global settings.
+// Settings of the HTTP server are returned to be applied by the caller.
+//
+// It must not be called concurrently; APIv2.Reload serializes calls of the reload function.
+func reloadHTTPConfig() (*chttp.Config, error) {
+	err := viper.ReadInConfig()
+	if _, ok := err.(viper.ConfigFileNotFoundError); !ok && err != nil {
+		return nil, err
+	}
+	setupLogVerbosity()
+	setupSlowLog()
+	return httpConfig()
+}
+
+// openAuditSink opens a sink for the audit log of the HTTP server. It returns nil if the audit log is disabled.
+// Events are written in background, thus slow sinks do not delay requests.
+func openAuditSink() (audit.Sink, error) {
+	typ := viper.GetString(keyAuditSink)
+	if typ == "" {
+		return nil, nil
+	}
+	s, err := audit.NewSink(typ, viper.GetString(keyAuditAddress))
+	if err != nil {
+		return nil, err
+	}
+	clog.Infof("writing audit log to %s sink", typ)
+	return audit.NewAsync(s, 0), nil
+}
+
+// loadOrStop loads a file to the database, and stops after the current batch if the process is asked to stop.
+func loadOrStop(h *graph.Handle, stop <-chan os.Signal, path, typ string) error {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	errc := make(chan error, 1)
+	go func() {
+		errc <- internal.LoadContext(ctx, h.QuadWriter, quad.DefaultBatch, path, typ)
+	}()
+	select {
+	case err := <-errc:
+		return err
+	case sig := <-stop:
+		clog.Infof("received %v, stopping the load", sig)
+		cancel()
+		<-errc
+		return fmt.Errorf("load of %q was interrupted", path)
+	}
+}
+
+// reloadOnSignal reloads the configuration of the server each time the process receives SIGHUP.
+func reloadOnSignal(api2 *cayleyhttp.APIv2) {
+	ch := make(chan os.Signal, 1)
+	signal.Notify(ch, syscall.SIGHUP)
+	go func() {
+		for range ch {
+			if err := api2.Reload(); err != nil {
+				clog.Errorf("failed to reload configuration: %v", err)
+			} else {
+				clog.Infof("configuration reloaded")
+			}
+		}
+	}()
+}
+
 func NewHttpCmd() *cobra.Command {
 	cmd := &cobra.Command{
 		Use:   "http",
@@ -24,7 +142,9 @@ func NewHttpCmd() *cobra.Command {
 			p := mustSetupProfile(cmd)
 			defer mustFinishProfile(p)
 
-			timeout := viper.GetDuration(keyQueryTimeout)
+			setupLogVerbosity()
+			setupSlowLog()
+			setupSpill()
 			if init, err := cmd.Flags().GetBool("init"); err != nil {
 				return err
 			} else if init {
@@ -40,31 +160,68 @@ func NewHttpCmd() *cobra.Command {
 			}
 			defer h.Close()
 
-			ro := viper.GetBool(KeyReadOnly)
+			stop := make(chan os.Signal, 1)
+			signal.Notify(stop, os.Interrupt, syscall.SIGTERM)
+			defer signal.Stop(stop)
+
 			if load, _ := cmd.Flags().GetString(flagLoad); load != "" {
 				typ, _ := cmd.Flags().GetString(flagLoadFormat)
 				// TODO: check read-only flag in config before that?
 				start := time.Now()
-				if err = internal.Load(h.QuadWriter, quad.DefaultBatch, load, typ); err != nil {
+				if err = loadOrStop(h, stop, load, typ); err != nil {
 					return err
 				}
 				clog.Infof("loaded %q in %v", load, time.Since(start))
 			}
 
-			err = chttp.SetupRoutes(h, &chttp.Config{
-				Timeout:  timeout,
-				ReadOnly: ro,
-			})
+			sink, err := openAuditSink()
+			if err != nil {
+				return err
+			} else if sink != nil {
+				defer sink.Close()
+			}
+			cfg, err := httpConfig()
+			if err != nil {
+				return err
+			}
+			// the sink is opened once, thus changes of its settings require a restart
+			cfg.Audit = sink
+			cfg.Reload = func() (*chttp.Config, error) {
+				nc, err := reloadHTTPConfig()
+				if err != nil {
+					return nil, err
+				}
+				nc.Audit = sink
+				return nc, nil
+			}
+			api2, err := chttp.Setup(h, cfg)
 			if err != nil {
 				return err
 			}
+			reloadOnSignal(api2)
 			host, _ := cmd.Flags().GetString("host")
 			phost := host
 			if host, port, err := net.SplitHostPort(host); err == nil && host == "" {
 				phost = net.JoinHostPort("localhost", port)
 			}
 			clog.Infof("listening on %s, web interface at http://%s", host, phost)
-			return http.ListenAndServe(host, nil)
+			srv := chttp.NewServer(host, http.DefaultServeMux)
+			errc := make(chan error, 1)
+			go func() {
+				errc <- srv.ListenAndServe()
+			}()
+			select {
+			case err = <-errc:
+				return err
+			case sig := <-stop:
+				grace := viper.GetDuration(keyShutdownTimeout)
+				clog.Infof("received %v, shutting down (grace period %v)", sig, grace)
+				if err = srv.Shutdown(grace); err != nil {
+					return err
+				}
+				clog.Infof("all requests finished, closing the database")
+				return nil
+			}
 		},
 	}
 	cmd.Flags().String("host", "127.0.0.1:64210", "host:port to listen on")
@@ -72,6 +229,26 @@ func NewHttpCmd() *cobra.Command {
 	cmd.Flags().DurationP("timeout", "t", 30*time.Second, "elapsed time until an individual query times out")
 	cmd.Flags().StringVar(&chttp.AssetsPath, "assets", "", "explicit path to the HTTP assets")
 	registerLoadFlags(cmd)
+	registerSlowLogFlags(cmd)
+	registerSpillFlags(cmd)
+	cmd.Flags().Int64("max_scanned", 0, "maximal number of primitives a single query can read from the backend (0 for no limit)")
 	viper.BindPFlag(keyQueryTimeout, cmd.Flags().Lookup("timeout"))
+	cmd.Flags().Bool("compact_iris", false, "compact IRIs in query results to prefixed names of registered namespaces")
+	viper.BindPFlag(keyQueryMaxScanned, cmd.Flags().Lookup("max_scanned"))
+	viper.BindPFlag(keyCompactIRIs, cmd.Flags().Lookup("compact_iris"))
+	cmd.Flags().Bool("typed_values", false, "encode values in query results with explicit type information")
+	viper.BindPFlag(keyTypedValues, cmd.Flags().Lookup("typed_values"))
+	cmd.Flags().Int("cache_size", 0, "maximal number of cached query results (0 to disable the cache)")
+	cmd.Flags().Duration("cache_ttl", 0, "maximal age of cached query results (0 for no limit)")
+	viper.BindPFlag(keyQueryCacheSize, cmd.Flags().Lookup("cache_size"))
+	viper.BindPFlag(keyQueryCacheTTL, cmd.Flags().Lookup("cache_ttl"))
+	cmd.Flags().Int("parallelism", 1, "maximal number of goroutines a single query can use to evaluate independent branches (1 to disable)")
+	viper.BindPFlag(keyQueryParallelism, cmd.Flags().Lookup("parallelism"))
+	cmd.Flags().Int("idempotency_size", 0, "maximal number of stored results of writes with an Idempotency-Key header (0 to ignore the header)")
+	cmd.Flags().Duration("idempotency_ttl", 24*time.Hour, "time after which an idempotency key can be reused (0 for no limit)")
+	viper.BindPFlag(keyIdempotencySize, cmd.Flags().Lookup("idempotency_size"))
+	viper.BindPFlag(keyIdempotencyTTL, cmd.Flags().Lookup("idempotency_ttl"))
+	cmd.Flags().Duration("shutdown_timeout", 30*time.Second, "time to wait for running requests on shutdown before cancelling them (0 to wait forever)")
+	viper.BindPFlag(keyShutdownTimeout, cmd.Flags().Lookup("shutdown_timeout"))
 	return cmd
 }
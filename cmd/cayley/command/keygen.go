@@ -0,0 +1,28 @@
+package command
+
+import (
+	"fmt"
+
+	"github.com/spf13/cobra"
+
+	"github.com/cayleygraph/cayley/internal/sign"
+)
+
+func NewKeygenCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "keygen <name>",
+		Short: "Generate a key pair for signing dumps.",
+		Long: "Generate an ed25519 key pair and write it to <name>.key and <name>.pub files.\n\n" +
+			"Dumps are signed with the private key (\"cayley dump --sign <name>.key\") and verified " +
+			"with the public key when loaded (\"cayley load --verify <name>.pub\").",
+		Args: cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if err := sign.GenerateKeys(args[0]); err != nil {
+				return err
+			}
+			fmt.Printf("keys were written to %q and %q\n", args[0]+".key", args[0]+".pub")
+			return nil
+		},
+	}
+	return cmd
+}
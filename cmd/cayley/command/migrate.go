@@ -0,0 +1,196 @@
+package command
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+
+	"github.com/cayleygraph/cayley/clog"
+	"github.com/cayleygraph/cayley/graph"
+	"github.com/cayleygraph/cayley/quad"
+)
+
+const (
+	flagFrom   = "from"
+	flagFromDB = "from-db"
+	flagTo     = "to"
+	flagToDB   = "to-db"
+)
+
+func NewMigrateCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "migrate",
+		Short: "Copy all quads from one database to another.",
+		Long: "Copy all quads from one database to another without an intermediate file.\n\n" +
+			"Quads are streamed in batches, labels are preserved. Internal identifiers of nodes and quads " +
+			"are specific to each backend and are assigned by the destination database.",
+		RunE: func(cmd *cobra.Command, args []string) error {
+			from, _ := cmd.Flags().GetString(flagFrom)
+			fromDB, _ := cmd.Flags().GetString(flagFromDB)
+			to, _ := cmd.Flags().GetString(flagTo)
+			toDB, _ := cmd.Flags().GetString(flagToDB)
+			if from == "" || to == "" {
+				return errors.New("both source and destination backends must be specified")
+			} else if from == to && fromDB == toDB {
+				return errors.New("source and destination are the same database")
+			}
+			clog.Infof("migrating from %q (%s) to %q (%s)", from, fromDB, to, toDB)
+			if init, _ := cmd.Flags().GetBool("init"); init {
+				if err := graph.InitQuadStore(to, toDB, nil); err != nil {
+					return err
+				}
+			}
+			src, err := graph.NewQuadStore(from, fromDB, graph.Options{"read_only": true})
+			if err != nil {
+				return fmt.Errorf("cannot open source: %v", err)
+			}
+			defer src.Close()
+			dst, err := graph.NewQuadStore(to, toDB, nil)
+			if err != nil {
+				return fmt.Errorf("cannot open destination: %v", err)
+			}
+			defer dst.Close()
+			// batches are retried as a whole, thus some quads may already exist
+			qw, err := graph.NewQuadWriter("single", dst, graph.Options{"ignore_duplicate": true})
+			if err != nil {
+				return err
+			}
+			defer qw.Close()
+
+			retries, _ := cmd.Flags().GetInt("retry")
+			m := &migration{
+				w:       qw,
+				batch:   viper.GetInt(KeyLoadBatch),
+				retries: retries,
+			}
+			if bar, _ := cmd.Flags().GetBool("progress"); bar {
+				m.progress = &progressBar{w: os.Stderr, total: src.Size()}
+			}
+			qr := graph.NewQuadStoreReader(src)
+			defer qr.Close()
+			start := time.Now()
+			n, err := m.run(qr)
+			if err != nil {
+				return err
+			}
+			clog.Infof("migrated %d quads in %v", n, time.Since(start))
+			return nil
+		},
+	}
+	cmd.Flags().String(flagFrom, "", "source database backend")
+	cmd.Flags().String(flagFromDB, "", "source database path or address")
+	cmd.Flags().String(flagTo, "", "destination database backend")
+	cmd.Flags().String(flagToDB, "", "destination database path or address")
+	cmd.Flags().Bool("init", false, "initialize the destination database before using it")
+	cmd.Flags().Int("retry", 3, "number of retries for each failed batch")
+	cmd.Flags().Bool("progress", true, "show progress bar")
+	return cmd
+}
+
+type migration struct {
+	w        graph.QuadWriter
+	batch    int
+	retries  int
+	progress *progressBar
+}
+
+func (m *migration) run(r quad.Reader) (int64, error) {
+	if m.batch <= 0 {
+		m.batch = quad.DefaultBatch
+	}
+	buf := make([]quad.Quad, 0, m.batch)
+	var n int64
+	for {
+		q, err := r.ReadQuad()
+		if err != nil && err != io.EOF {
+			return n, err
+		}
+		eof := err == io.EOF
+		if !eof {
+			buf = append(buf, q)
+		}
+		if len(buf) != 0 && (eof || len(buf) == cap(buf)) {
+			if err = m.write(buf); err != nil {
+				return n, err
+			}
+			n += int64(len(buf))
+			m.progress.Set(n)
+			buf = buf[:0]
+		}
+		if eof {
+			m.progress.Done()
+			return n, nil
+		}
+	}
+}
+
+// write writes a batch of quads, retrying with an increasing delay on failures.
+func (m *migration) write(quads []quad.Quad) error {
+	for i := 0; ; i++ {
+		err := m.w.AddQuadSet(quads)
+		if err == nil || i >= m.retries {
+			return err
+		}
+		clog.Warningf("batch failed (attempt %d of %d): %v", i+1, m.retries+1, err)
+		time.Sleep(time.Duration(i+1) * time.Second)
+	}
+}
+
+const progressWidth = 40
+
+// progressBar prints a single-line progress bar to a terminal.
+type progressBar struct {
+	w     io.Writer
+	total int64 // estimated, can be less than the actual number of quads
+	start time.Time
+	last  time.Time
+	n     int64
+}
+
+func (p *progressBar) Set(n int64) {
+	if p == nil {
+		return
+	}
+	now := time.Now()
+	if p.start.IsZero() {
+		p.start = now
+	}
+	p.n = n
+	if now.Sub(p.last) < 200*time.Millisecond {
+		return
+	}
+	p.last = now
+	p.print(now)
+}
+
+func (p *progressBar) Done() {
+	if p == nil {
+		return
+	}
+	p.print(time.Now())
+	fmt.Fprintln(p.w)
+}
+
+func (p *progressBar) print(now time.Time) {
+	var rate float64
+	if dt := now.Sub(p.start).Seconds(); dt > 0 {
+		rate = float64(p.n) / dt
+	}
+	if p.total <= 0 {
+		fmt.Fprintf(p.w, "\r%d quads, %.0f quads/s", p.n, rate)
+		return
+	}
+	frac := float64(p.n) / float64(p.total)
+	if frac > 1 {
+		frac = 1
+	}
+	done := int(frac * progressWidth)
+	bar := strings.Repeat("=", done) + strings.Repeat(" ", progressWidth-done)
+	fmt.Fprintf(p.w, "\r[%s] %3.0f%% %d/%d quads, %.0f quads/s", bar, frac*100, p.n, p.total, rate)
+}
@@ -15,6 +15,7 @@ import (
 
 	"github.com/cayleygraph/cayley/clog"
 	"github.com/cayleygraph/cayley/graph"
+	"github.com/cayleygraph/cayley/graph/iterator"
 	"github.com/cayleygraph/cayley/internal"
 	"github.com/cayleygraph/cayley/internal/repl"
 	"github.com/cayleygraph/cayley/quad"
@@ -22,7 +23,22 @@ import (
 )
 
 const (
-	keyQueryTimeout = "query.timeout"
+	keyQueryTimeout    = "query.timeout"
+	keyQueryMaxScanned = "query.max_scanned"
+
+	keySlowQueryThreshold = "query.slow_log.threshold"
+	keySlowQueryPlanRate  = "query.slow_log.plan_rate"
+
+	keySpillMaxValues = "query.spill.max_values"
+	keySpillDir       = "query.spill.dir"
+
+	keyCompactIRIs = "query.compact_iris"
+	keyTypedValues = "query.typed_values"
+
+	keyQueryCacheSize = "query.cache.size"
+	keyQueryCacheTTL  = "query.cache.ttl"
+
+	keyQueryParallelism = "query.parallelism"
 )
 
 func getContext() (context.Context, func()) {
@@ -71,6 +87,40 @@ func registerQueryFlags(cmd *cobra.Command) {
 	cmd.Flags().DurationP("timeout", "t", 30*time.Second, "elapsed time until an individual query times out")
 	viper.BindPFlag(keyQueryTimeout, cmd.Flags().Lookup("timeout"))
 	registerLoadFlags(cmd)
+	registerSlowLogFlags(cmd)
+	registerSpillFlags(cmd)
+}
+
+func registerSlowLogFlags(cmd *cobra.Command) {
+	cmd.Flags().Duration("slow_query", 0, "log queries that run longer than this duration (0 to disable)")
+	cmd.Flags().Float64("slow_query_plan", 0, "fraction of slow queries to log with a full query plan (0..1)")
+	viper.BindPFlag(keySlowQueryThreshold, cmd.Flags().Lookup("slow_query"))
+	viper.BindPFlag(keySlowQueryPlanRate, cmd.Flags().Lookup("slow_query_plan"))
+}
+
+func setupSlowLog() {
+	opt := graph.SlowLogOptions{
+		Threshold: viper.GetDuration(keySlowQueryThreshold),
+		PlanRate:  viper.GetFloat64(keySlowQueryPlanRate),
+	}
+	graph.SetSlowLog(opt)
+	if opt.Threshold > 0 {
+		clog.Infof("logging queries slower than %v", opt.Threshold)
+	}
+}
+
+func registerSpillFlags(cmd *cobra.Command) {
+	cmd.Flags().Int("spill_values", 0, "number of values a single iterator can hold in memory before moving them to disk (0 to disable)")
+	cmd.Flags().String("spill_dir", "", "directory for temporary files of iterators (defaults to system temp dir)")
+	viper.BindPFlag(keySpillMaxValues, cmd.Flags().Lookup("spill_values"))
+	viper.BindPFlag(keySpillDir, cmd.Flags().Lookup("spill_dir"))
+}
+
+func setupSpill() {
+	iterator.Spill = iterator.SpillOptions{
+		MaxValues: viper.GetInt(keySpillMaxValues),
+		Dir:       viper.GetString(keySpillDir),
+	}
 }
 
 func NewReplCmd() *cobra.Command {
@@ -87,6 +137,8 @@ func NewReplCmd() *cobra.Command {
 				return err
 			}
 			defer h.Close()
+			setupSlowLog()
+			setupSpill()
 
 			ctx, cancel := getContext()
 			defer cancel()
@@ -142,6 +194,9 @@ func NewQueryCmd() *cobra.Command {
 			if err != nil {
 				return err
 			}
+			setupSlowLog()
+			setupSpill()
+			ctx = graph.WithQueryInfo(ctx, lang, querystr)
 
 			l := query.GetLanguage(lang)
 			if l == nil {
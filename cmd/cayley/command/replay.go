@@ -0,0 +1,43 @@
+package command
+
+import (
+	"fmt"
+
+	"github.com/spf13/cobra"
+
+	"github.com/cayleygraph/cayley/clog"
+	"github.com/cayleygraph/cayley/graph/journal"
+)
+
+func NewReplayCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "replay <journal>",
+		Short: "Apply changes recorded in a journal to the database.",
+		Long: "Apply committed transactions recorded in a journal (see store.journal) to the database, " +
+			"each in a separate transaction. Use --from and --to to select a range of horizons.",
+		Args: cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			from, _ := cmd.Flags().GetInt64("from")
+			to, _ := cmd.Flags().GetInt64("to")
+			printBackendInfo()
+			h, err := openDatabase()
+			if err != nil {
+				return err
+			}
+			defer h.Close()
+			last, err := journal.Replay(h.QuadWriter, args[0], from, to)
+			if err != nil {
+				return err
+			}
+			if last == 0 {
+				clog.Infof("no transactions to replay")
+				return nil
+			}
+			fmt.Println(last)
+			return nil
+		},
+	}
+	cmd.Flags().Int64("from", 0, "first horizon to replay")
+	cmd.Flags().Int64("to", 0, "last horizon to replay (0 for all)")
+	return cmd
+}
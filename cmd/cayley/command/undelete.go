@@ -0,0 +1,118 @@
+package command
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/spf13/cobra"
+
+	"github.com/cayleygraph/cayley/clog"
+	"github.com/cayleygraph/cayley/graph"
+)
+
+var errNoSoftDelete = errors.New("database does not support soft deletes; see soft_delete option")
+
+// parseTimeFlag parses a flag value either as an RFC 3339 timestamp, or as a duration before now.
+func parseTimeFlag(cmd *cobra.Command, name string) (time.Time, error) {
+	s, _ := cmd.Flags().GetString(name)
+	if s == "" {
+		return time.Time{}, nil
+	}
+	if d, err := time.ParseDuration(s); err == nil {
+		return time.Now().Add(-d), nil
+	}
+	t, err := time.Parse(time.RFC3339, s)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("invalid %s value: expected a timestamp or a duration: %q", name, s)
+	}
+	return t, nil
+}
+
+func openSoftDeleter() (*graph.Handle, graph.SoftDeleter, error) {
+	printBackendInfo()
+	h, err := openDatabase()
+	if err != nil {
+		return nil, nil, err
+	}
+	sd, ok := graph.AsSoftDeleter(h.QuadStore)
+	if !ok {
+		h.Close()
+		return nil, nil, errNoSoftDelete
+	}
+	return h, sd, nil
+}
+
+func NewUndeleteCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "undelete",
+		Short: "List or restore removed quads.",
+		Long: "Restore quads removed in a given time range from a database with soft deletes enabled.\n\n" +
+			"Time can be set as an RFC 3339 timestamp, or as a duration before now (e.g. \"2h\").",
+		RunE: func(cmd *cobra.Command, args []string) error {
+			since, err := parseTimeFlag(cmd, "since")
+			if err != nil {
+				return err
+			}
+			until, err := parseTimeFlag(cmd, "until")
+			if err != nil {
+				return err
+			}
+			h, sd, err := openSoftDeleter()
+			if err != nil {
+				return err
+			}
+			defer h.Close()
+			ctx := context.Background()
+			if list, _ := cmd.Flags().GetBool("list"); list {
+				return sd.Tombstones(ctx, since, until, func(t graph.Tombstone) error {
+					_, err := fmt.Printf("%s\t%s\n", t.Deleted.Format(time.RFC3339), t.Quad.NQuad())
+					return err
+				})
+			}
+			// restored quads are written like any other changes, thus they are recorded in the journal
+			n, err := graph.Undelete(ctx, sd, h.QuadWriter, since, until, nil)
+			if err != nil {
+				return err
+			}
+			clog.Infof("restored %d quads", n)
+			return nil
+		},
+	}
+	cmd.Flags().String("since", "", "restore quads removed at or after this time")
+	cmd.Flags().String("until", "", "restore quads removed before this time")
+	cmd.Flags().Bool("list", false, "only print removed quads with the time of removal")
+	return cmd
+}
+
+func NewPurgeCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "purge",
+		Short: "Permanently remove deleted quads.",
+		Long: "Permanently remove quads deleted before a given time from a database with soft deletes enabled. " +
+			"Purged quads can no longer be restored.\n\n" +
+			"Time can be set as an RFC 3339 timestamp, or as a duration before now (e.g. \"720h\").",
+		RunE: func(cmd *cobra.Command, args []string) error {
+			before, err := parseTimeFlag(cmd, "before")
+			if err != nil {
+				return err
+			} else if before.IsZero() {
+				return errors.New("time must be specified")
+			}
+			h, sd, err := openSoftDeleter()
+			if err != nil {
+				return err
+			}
+			defer h.Close()
+			n, err := sd.Purge(context.Background(), before)
+			if err != nil {
+				return err
+			}
+			clog.Infof("purged %d quads", n)
+			return nil
+		},
+	}
+	cmd.Flags().String("before", "", "purge quads removed before this time")
+	return cmd
+}
@@ -83,6 +83,18 @@ func writeDocs(w io.Writer, dp *doc.Package) {
 			Title: "Path object",
 			Name:  "path",
 		},
+		"timeObject": {
+			Title: "The `time` object",
+			Name:  "time",
+		},
+		"uriObject": {
+			Title: "The `uri` object",
+			Name:  "uri",
+		},
+		"stringsObject": {
+			Title: "The `strings` object",
+			Name:  "strings",
+		},
 	}
 	for _, tp := range dp.Types {
 		t, ok := names[tp.Name]
@@ -0,0 +1,39 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+
+	"github.com/cayleygraph/cayley"
+	"github.com/cayleygraph/cayley/quad"
+	"github.com/cayleygraph/cayley/query"
+
+	// Register the language. The same import in a custom build of the cayley command
+	// makes the language available in the REPL and in the HTTP API.
+	_ "github.com/cayleygraph/cayley/examples/hello_language/pathlang"
+)
+
+func main() {
+	store, err := cayley.NewMemoryGraph()
+	if err != nil {
+		log.Fatalln(err)
+	}
+	store.AddQuadSet([]quad.Quad{
+		quad.MakeIRI("alice", "follows", "bob", ""),
+		quad.MakeIRI("charlie", "follows", "bob", ""),
+		quad.MakeIRI("bob", "follows", "dani", ""),
+	})
+
+	// Languages are looked up by name, as the HTTP server and the REPL do it.
+	ses := query.NewSession(store, "pathlang")
+
+	out := make(chan query.Result)
+	go ses.Execute(context.Background(), "<alice> <follows> ^<follows>", out, -1)
+	for r := range out {
+		if err := r.Err(); err != nil {
+			log.Fatalln(err)
+		}
+		fmt.Println(r.Result())
+	}
+}
@@ -0,0 +1,159 @@
+// Package pathlang is a skeleton of a query language that can be registered in Cayley from an external package.
+//
+// A query is a start node followed by a list of predicates to traverse. Predicates prefixed with "^"
+// are traversed in reverse direction. For example, this query returns followers of people that alice follows:
+//
+//	<alice> <follows> ^<follows>
+package pathlang
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/cayleygraph/cayley/graph"
+	"github.com/cayleygraph/cayley/graph/iterator"
+	"github.com/cayleygraph/cayley/graph/path"
+	"github.com/cayleygraph/cayley/quad"
+	"github.com/cayleygraph/cayley/query"
+)
+
+// Name of the query language.
+const Name = "pathlang"
+
+// ContentType is a MIME type of queries. Requests with this type are sent to this language by the HTTP server.
+const ContentType = "text/x-pathlang"
+
+func init() {
+	// importing the package is enough to make the language available in the REPL and in the HTTP API
+	query.RegisterLanguage(query.Language{
+		Name: Name,
+		Session: func(qs graph.QuadStore) query.Session {
+			return NewSession(qs)
+		},
+		REPL: func(qs graph.QuadStore) query.REPLSession {
+			return NewSession(qs)
+		},
+		HTTP: func(qs graph.QuadStore) query.HTTP {
+			return NewSession(qs)
+		},
+		ContentTypes: []string{ContentType},
+	})
+}
+
+var (
+	_ query.HTTP         = (*Session)(nil)
+	_ query.HTTPStreamer = (*Session)(nil)
+	_ query.REPLSession  = (*Session)(nil)
+)
+
+// Session runs path queries on a quad store.
+type Session struct {
+	qs graph.QuadStore
+
+	// results collated for HTTP
+	results []interface{}
+	err     error
+}
+
+// NewSession creates a new session for a quad store.
+func NewSession(qs graph.QuadStore) *Session {
+	return &Session{qs: qs}
+}
+
+// Parse converts a query to a path.
+func Parse(qs graph.QuadStore, qu string) (*path.Path, error) {
+	tokens := strings.Fields(qu)
+	if len(tokens) == 0 {
+		return nil, fmt.Errorf("%s: query is empty", Name)
+	}
+	p := path.StartPath(qs, quad.StringToValue(tokens[0]))
+	for _, t := range tokens[1:] {
+		if strings.HasPrefix(t, "^") {
+			p = p.In(quad.StringToValue(t[1:]))
+		} else {
+			p = p.Out(quad.StringToValue(t))
+		}
+	}
+	return p, nil
+}
+
+// Result is a single node returned by the query.
+type Result struct {
+	Value quad.Value
+}
+
+func (r Result) Result() interface{} { return r.Value }
+func (r Result) Err() error          { return nil }
+
+// Execute implements query.Session.
+func (s *Session) Execute(ctx context.Context, qu string, out chan query.Result, limit int) {
+	defer close(out)
+	send := func(r query.Result) bool {
+		select {
+		case out <- r:
+			return true
+		case <-ctx.Done():
+			return false
+		}
+	}
+	p, err := Parse(s.qs, qu)
+	if err != nil {
+		send(query.ErrorResult(err))
+		return
+	}
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	err = p.Iterate(ctx).Limit(limit).EachValue(s.qs, func(v quad.Value) {
+		if !send(Result{Value: v}) {
+			cancel()
+		}
+	})
+	if err != nil && err != context.Canceled {
+		send(query.ErrorResult(err))
+	}
+}
+
+// FormatREPL implements query.REPLSession.
+func (s *Session) FormatREPL(r query.Result) string {
+	if err := r.Err(); err != nil {
+		return fmt.Sprintf("error: %v\n", err)
+	}
+	return fmt.Sprintln("=>", quad.StringOf(r.Result().(quad.Value)))
+}
+
+// ShapeOf implements query.HTTP.
+func (s *Session) ShapeOf(qu string) (interface{}, error) {
+	p, err := Parse(s.qs, qu)
+	if err != nil {
+		return nil, err
+	}
+	out := make(map[string]interface{})
+	iterator.OutputQueryShapeForIterator(p.BuildIterator(), s.qs, out)
+	return out, nil
+}
+
+// ConvertResult implements query.HTTPStreamer. Results are streamed to HTTP clients if it is implemented.
+func (s *Session) ConvertResult(r query.Result) (interface{}, error) {
+	if err := r.Err(); err != nil {
+		return nil, err
+	}
+	return quad.StringOf(r.Result().(quad.Value)), nil
+}
+
+// Collate implements query.HTTP.
+func (s *Session) Collate(r query.Result) {
+	v, err := s.ConvertResult(r)
+	if err != nil {
+		s.err = err
+		return
+	}
+	s.results = append(s.results, v)
+}
+
+// Results implements query.HTTP.
+func (s *Session) Results() (interface{}, error) {
+	out, err := s.results, s.err
+	s.results, s.err = nil, nil
+	return out, err
+}
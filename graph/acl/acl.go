@@ -0,0 +1,189 @@
+// Copyright 2017 The Cayley Authors. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package acl implements access policies that hide a part of the graph from some users.
+//
+// A policy is a list of rules that allow or deny access to quads by predicate IRI prefix or by graph label.
+// Quads denied by the policy are removed from all quad iterators of a wrapped store, thus they are
+// invisible to all query languages, and writes of such quads are rejected.
+//
+// Policies only apply to quads. Nodes that are not used by any allowed quad are not listed by the wrapped
+// store, but can still be looked up by value.
+package acl
+
+import (
+	"context"
+	"errors"
+	"strings"
+
+	"github.com/cayleygraph/cayley/graph"
+	"github.com/cayleygraph/cayley/graph/iterator"
+	"github.com/cayleygraph/cayley/quad"
+)
+
+// ErrAccessDenied is returned when writing a quad that is denied by the policy.
+var ErrAccessDenied = errors.New("acl: access denied")
+
+// Rule allows or denies access to quads with a given predicate IRI prefix in a given graph.
+// Empty fields match any quad.
+type Rule struct {
+	Deny      bool
+	Predicate string     // prefix of predicate IRI
+	Label     quad.Value // graph label
+}
+
+// Matches checks if the rule applies to the quad.
+func (r Rule) Matches(q quad.Quad) bool {
+	if r.Predicate != "" {
+		p, ok := q.Predicate.(quad.IRI)
+		if !ok || !strings.HasPrefix(string(p), r.Predicate) {
+			return false
+		}
+	}
+	if r.Label != nil && (q.Label == nil || q.Label.String() != r.Label.String()) {
+		return false
+	}
+	return true
+}
+
+// Policy is a list of access rules of a single role. The first matching rule applies.
+// Nil policy allows access to all quads.
+type Policy struct {
+	Rules []Rule
+	// DenyByDefault denies access to quads that do not match any rule.
+	DenyByDefault bool
+	// Admin allows access to administrative endpoints of the HTTP API, such as configuration reload.
+	Admin bool
+}
+
+// Allowed checks if the quad is accessible under the policy.
+func (p *Policy) Allowed(q quad.Quad) bool {
+	if p == nil {
+		return true
+	}
+	for _, r := range p.Rules {
+		if r.Matches(q) {
+			return !r.Deny
+		}
+	}
+	return !p.DenyByDefault
+}
+
+// Middleware returns a writer middleware that rejects the whole set of deltas if any of the quads is denied.
+func (p *Policy) Middleware() graph.WriterMiddleware {
+	return graph.ValidateDeltas(func(d graph.Delta) error {
+		if !p.Allowed(d.Quad) {
+			return ErrAccessDenied
+		}
+		return nil
+	})
+}
+
+// Filter returns deltas that are allowed by the policy.
+func (p *Policy) Filter(in []graph.Delta) []graph.Delta {
+	if p == nil {
+		return in
+	}
+	out := make([]graph.Delta, 0, len(in))
+	for _, d := range in {
+		if p.Allowed(d.Quad) {
+			out = append(out, d)
+		}
+	}
+	return out
+}
+
+var _ graph.QuadStore = (*QuadStore)(nil)
+
+// QuadStore hides quads denied by the policy from all reads and rejects writes of such quads.
+//
+// Optional interfaces implemented by the underlying store are not exposed by the wrapper,
+// except for graph.ContextQuadStore.
+type QuadStore struct {
+	graph.QuadStore
+	p     *Policy
+	apply graph.ApplyDeltasFunc
+}
+
+// Wrap returns a quad store that enforces a given policy.
+func Wrap(qs graph.QuadStore, p *Policy) *QuadStore {
+	return &QuadStore{QuadStore: qs, p: p, apply: p.Middleware()(qs.ApplyDeltas)}
+}
+
+// Policy returns the policy enforced by the store.
+func (qs *QuadStore) Policy() *Policy {
+	return qs.p
+}
+
+func (qs *QuadStore) ApplyDeltas(in []graph.Delta, opts graph.IgnoreOpts) error {
+	return qs.apply(in, opts)
+}
+
+func (qs *QuadStore) QuadIterator(d quad.Direction, v graph.Value) graph.Iterator {
+	return NewIterator(qs.QuadStore.QuadIterator(d, v), qs.QuadStore, qs.p)
+}
+
+func (qs *QuadStore) QuadsAllIterator() graph.Iterator {
+	return NewIterator(qs.QuadStore.QuadsAllIterator(), qs.QuadStore, qs.p)
+}
+
+// NodesAllIterator returns only nodes that are used by at least one quad allowed by the policy.
+func (qs *QuadStore) NodesAllIterator() graph.Iterator {
+	if qs.p == nil {
+		return qs.QuadStore.NodesAllIterator()
+	}
+	return iterator.NewValueFilter(qs.QuadStore.NodesAllIterator(), qs.QuadStore, "acl", qs.visible)
+}
+
+// visible checks if a node is used by any quad allowed by the policy.
+func (qs *QuadStore) visible(v quad.Value) bool {
+	ref := qs.QuadStore.ValueOf(v)
+	if ref == nil {
+		return false
+	}
+	ctx := context.TODO()
+	for _, d := range quad.Directions {
+		it := qs.QuadIterator(d, ref)
+		ok := it.Next(ctx)
+		it.Close()
+		if ok {
+			return true
+		}
+	}
+	return false
+}
+
+// OptimizeIterator does not pass iterators to the underlying store, since it may replace
+// filtered quad iterators with its own ones.
+func (qs *QuadStore) OptimizeIterator(it graph.Iterator) (graph.Iterator, bool) {
+	return it, false
+}
+
+var _ graph.ContextQuadStore = (*QuadStore)(nil)
+
+func (qs *QuadStore) ValueOfContext(ctx context.Context, v quad.Value) (graph.Value, error) {
+	return graph.ValueOf(ctx, qs.QuadStore, v)
+}
+
+func (qs *QuadStore) NameOfContext(ctx context.Context, v graph.Value) (quad.Value, error) {
+	return graph.NameOf(ctx, qs.QuadStore, v)
+}
+
+func (qs *QuadStore) QuadContext(ctx context.Context, v graph.Value) (quad.Quad, error) {
+	return graph.QuadOf(ctx, qs.QuadStore, v)
+}
+
+func (qs *QuadStore) SizeContext(ctx context.Context) (int64, error) {
+	return graph.SizeOf(ctx, qs.QuadStore)
+}
@@ -0,0 +1,62 @@
+package acl_test
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/cayleygraph/cayley/graph"
+	"github.com/cayleygraph/cayley/graph/acl"
+	"github.com/cayleygraph/cayley/graph/graphtest/testutil"
+	"github.com/cayleygraph/cayley/graph/memstore"
+	"github.com/cayleygraph/cayley/graph/path"
+	"github.com/cayleygraph/cayley/quad"
+)
+
+func TestPolicy(t *testing.T) {
+	base := memstore.New(
+		quad.MakeIRI("alice", "ex:name", "Alice", ""),
+		quad.MakeIRI("alice", "ex:salary", "100", ""),
+		quad.MakeIRI("alice", "ex:salary_band", "B", ""),
+		quad.MakeIRI("alice", "follows", "bob", ""),
+		quad.MakeIRI("alice", "follows", "carol", "hr"),
+	)
+	qs := acl.Wrap(base, &acl.Policy{Rules: []acl.Rule{
+		{Deny: true, Predicate: "ex:salary"},
+		{Deny: true, Label: quad.IRI("hr")},
+	}})
+
+	alice := quad.IRI("alice")
+	require.Equal(t, []string{"<Alice>"}, testutil.Collect(t, path.StartPath(qs, alice).Out(quad.IRI("ex:name"))))
+	require.Equal(t, []string(nil), testutil.Collect(t, path.StartPath(qs, alice).Out(quad.IRI("ex:salary"))))
+	require.Equal(t, []string{"<bob>"}, testutil.Collect(t, path.StartPath(qs, alice).Out(quad.IRI("follows"))))
+	require.Equal(t, []string{"<ex:name>", "<follows>"}, testutil.Collect(t, path.StartPath(qs, alice).OutPredicates().Unique()))
+	// nodes of denied quads are not listed
+	require.Equal(t, []string{"<Alice>", "<alice>", "<bob>", "<ex:name>", "<follows>"}, testutil.Collect(t, path.StartPath(qs)))
+
+	all, err := quad.ReadAll(graph.NewQuadStoreReader(qs))
+	require.NoError(t, err)
+	require.Len(t, all, 2)
+
+	err = qs.ApplyDeltas([]graph.Delta{
+		{Action: graph.Add, Quad: quad.MakeIRI("bob", "ex:name", "Bob", "")},
+		{Action: graph.Add, Quad: quad.MakeIRI("bob", "ex:salary", "200", "")},
+	}, graph.IgnoreOpts{})
+	require.Equal(t, acl.ErrAccessDenied, err.(*graph.DeltaError).Err)
+	err = qs.ApplyDeltas([]graph.Delta{
+		{Action: graph.Delete, Quad: quad.MakeIRI("alice", "ex:salary", "100", "")},
+	}, graph.IgnoreOpts{})
+	require.Error(t, err)
+	all, err = quad.ReadAll(graph.NewQuadStoreReader(base))
+	require.NoError(t, err)
+	require.Len(t, all, 5)
+
+	// rules are applied in order
+	p := &acl.Policy{DenyByDefault: true, Rules: []acl.Rule{
+		{Deny: true, Predicate: "ex:salary_"},
+		{Predicate: "ex:"},
+	}}
+	require.True(t, p.Allowed(quad.MakeIRI("alice", "ex:salary", "100", "")))
+	require.False(t, p.Allowed(quad.MakeIRI("alice", "ex:salary_band", "B", "")))
+	require.False(t, p.Allowed(quad.MakeIRI("alice", "follows", "bob", "")))
+}
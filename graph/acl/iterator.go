@@ -0,0 +1,157 @@
+// Copyright 2017 The Cayley Authors. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package acl
+
+import (
+	"context"
+
+	"github.com/cayleygraph/cayley/graph"
+	"github.com/cayleygraph/cayley/graph/iterator"
+)
+
+// Type is the type of iterators that filter quads by a policy.
+const Type = graph.Type("acl")
+
+var _ graph.Iterator = &Iterator{}
+
+// Iterator passes only quads allowed by the policy.
+type Iterator struct {
+	uid    uint64
+	tags   graph.Tagger
+	sub    graph.Iterator
+	qs     graph.QuadStore
+	p      *Policy
+	result graph.Value
+	err    error
+}
+
+// NewIterator creates an iterator that filters quads of a given iterator.
+func NewIterator(sub graph.Iterator, qs graph.QuadStore, p *Policy) *Iterator {
+	return &Iterator{
+		uid: iterator.NextUID(),
+		sub: sub,
+		qs:  qs,
+		p:   p,
+	}
+}
+
+func (it *Iterator) UID() uint64 {
+	return it.uid
+}
+
+func (it *Iterator) test(v graph.Value) bool {
+	return it.p.Allowed(it.qs.Quad(v))
+}
+
+func (it *Iterator) Close() error {
+	return it.sub.Close()
+}
+
+func (it *Iterator) Reset() {
+	it.sub.Reset()
+	it.err = nil
+	it.result = nil
+}
+
+func (it *Iterator) Tagger() *graph.Tagger {
+	return &it.tags
+}
+
+func (it *Iterator) Clone() graph.Iterator {
+	out := NewIterator(it.sub.Clone(), it.qs, it.p)
+	out.tags.CopyFrom(it)
+	return out
+}
+
+func (it *Iterator) Next(ctx context.Context) bool {
+	for it.sub.Next(ctx) {
+		v := it.sub.Result()
+		if it.test(v) {
+			it.result = v
+			return true
+		}
+	}
+	it.err = it.sub.Err()
+	return false
+}
+
+func (it *Iterator) Err() error {
+	return it.err
+}
+
+func (it *Iterator) Result() graph.Value {
+	return it.result
+}
+
+func (it *Iterator) NextPath(ctx context.Context) bool {
+	for {
+		if !it.sub.NextPath(ctx) {
+			it.err = it.sub.Err()
+			return false
+		}
+		if it.test(it.sub.Result()) {
+			break
+		}
+	}
+	it.result = it.sub.Result()
+	return true
+}
+
+func (it *Iterator) SubIterators() []graph.Iterator {
+	return []graph.Iterator{it.sub}
+}
+
+func (it *Iterator) Contains(ctx context.Context, v graph.Value) bool {
+	if !it.test(v) {
+		return false
+	}
+	if !it.sub.Contains(ctx, v) {
+		it.err = it.sub.Err()
+		return false
+	}
+	it.result = v
+	return true
+}
+
+func (it *Iterator) Type() graph.Type {
+	return Type
+}
+
+func (it *Iterator) String() string {
+	return "ACL"
+}
+
+func (it *Iterator) Optimize() (graph.Iterator, bool) {
+	sub, changed := it.sub.Optimize()
+	if changed {
+		it.sub.Close()
+		it.sub = sub
+	}
+	return it, false
+}
+
+func (it *Iterator) Stats() graph.IteratorStats {
+	return it.sub.Stats()
+}
+
+func (it *Iterator) TagResults(dst map[string]graph.Value) {
+	it.tags.TagResult(dst, it.Result())
+	it.sub.TagResults(dst)
+}
+
+func (it *Iterator) Size() (int64, bool) {
+	n, _ := it.sub.Size()
+	return n, false
+}
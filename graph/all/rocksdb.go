@@ -0,0 +1,8 @@
+// +build rocksdb
+
+package all
+
+import (
+	// requires cgo and RocksDB library
+	_ "github.com/cayleygraph/cayley/graph/kv/rocksdb"
+)
@@ -0,0 +1,219 @@
+// Copyright 2017 The Cayley Authors. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package audit implements an audit trail of queries and writes.
+//
+// Each audited operation is described by an Event that records who ran it, when, the query text or applied
+// changes, how long it took and how many results it returned. Events are written to a Sink. Sinks are
+// registered by name, and the package provides "file", "graph" and "webhook" sinks.
+package audit
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/cayleygraph/cayley/graph"
+	"github.com/cayleygraph/cayley/quad"
+)
+
+// Operations recorded in the audit log.
+const (
+	OpQuery = "query"
+	OpWrite = "write"
+)
+
+// MaxEventQuads is the maximal number of added and removed quads recorded in a single event.
+// Changes above this limit are only counted in Results, and the event is marked as truncated.
+const MaxEventQuads = 1000
+
+// Event describes a single audited operation.
+type Event struct {
+	Time      time.Time
+	Principal string // user that ran the operation, if known
+	RequestID string
+	Op        string
+	Lang      string // query language
+	Query     string
+	Added     []quad.Quad
+	Removed   []quad.Quad
+	Truncated bool // some of the changes were not recorded, see MaxEventQuads
+	Duration  time.Duration
+	Results   int64 // number of query results or applied changes
+	Error     string
+}
+
+type jsonEvent struct {
+	Time      time.Time   `json:"time"`
+	Principal string      `json:"principal,omitempty"`
+	RequestID string      `json:"request_id,omitempty"`
+	Op        string      `json:"op"`
+	Lang      string      `json:"lang,omitempty"`
+	Query     string      `json:"query,omitempty"`
+	Added     []quad.Quad `json:"added,omitempty"`
+	Removed   []quad.Quad `json:"removed,omitempty"`
+	Truncated bool        `json:"truncated,omitempty"`
+	Duration  string      `json:"duration"`
+	Results   int64       `json:"results"`
+	Error     string      `json:"error,omitempty"`
+}
+
+// MarshalJSON implements json.Marshaler. Duration is written as a string.
+func (e *Event) MarshalJSON() ([]byte, error) {
+	return json.Marshal(jsonEvent{
+		Time: e.Time, Principal: e.Principal, RequestID: e.RequestID,
+		Op: e.Op, Lang: e.Lang, Query: e.Query,
+		Added: e.Added, Removed: e.Removed, Truncated: e.Truncated,
+		Duration: e.Duration.String(), Results: e.Results, Error: e.Error,
+	})
+}
+
+// Record collects an event while the operation is running. It is safe for concurrent use.
+type Record struct {
+	mu    sync.Mutex
+	start time.Time
+	e     Event
+}
+
+// NewRecord starts recording an operation of a given principal. If the operation is empty, it is set by the first
+// call to SetQuery or AddDeltas.
+func NewRecord(op, principal string) *Record {
+	now := time.Now()
+	return &Record{start: now, e: Event{Time: now, Op: op, Principal: principal}}
+}
+
+// SetRequestID sets an id of the request that runs the operation.
+func (r *Record) SetRequestID(id string) {
+	r.mu.Lock()
+	r.e.RequestID = id
+	r.mu.Unlock()
+}
+
+// SetQuery records a query text.
+func (r *Record) SetQuery(lang, qu string) {
+	r.mu.Lock()
+	if r.e.Op == "" {
+		r.e.Op = OpQuery
+	}
+	r.e.Lang, r.e.Query = lang, qu
+	r.mu.Unlock()
+}
+
+// AddResults increments the number of query results.
+func (r *Record) AddResults(n int) {
+	r.mu.Lock()
+	r.e.Results += int64(n)
+	r.mu.Unlock()
+}
+
+// AddDeltas records applied changes. Only the first MaxEventQuads changes are stored in the event.
+func (r *Record) AddDeltas(in []graph.Delta) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.e.Op == "" {
+		r.e.Op = OpWrite
+	}
+	for _, d := range in {
+		if len(r.e.Added)+len(r.e.Removed) >= MaxEventQuads {
+			r.e.Truncated = true
+			break
+		}
+		switch d.Action {
+		case graph.Add:
+			r.e.Added = append(r.e.Added, d.Quad)
+		case graph.Delete:
+			r.e.Removed = append(r.e.Removed, d.Quad)
+		}
+	}
+	r.e.Results += int64(len(in))
+}
+
+// Finish returns an event for the recorded operation, or nil if the operation is still unknown.
+// Error is recorded if it is not nil.
+func (r *Record) Finish(err error) *Event {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.e.Op == "" {
+		return nil
+	}
+	e := r.e
+	e.Duration = time.Since(r.start)
+	if err != nil {
+		e.Error = err.Error()
+	}
+	return &e
+}
+
+// ObserveDeltas returns a writer middleware that records applied deltas.
+func (r *Record) ObserveDeltas() graph.WriterMiddleware {
+	return graph.ObserveDeltas(r.AddDeltas)
+}
+
+type recordKey struct{}
+
+// WithRecord attaches a record to the context.
+func WithRecord(ctx context.Context, r *Record) context.Context {
+	return context.WithValue(ctx, recordKey{}, r)
+}
+
+// RecordFrom returns a record attached to the context, or nil if the operation is not audited.
+func RecordFrom(ctx context.Context) *Record {
+	r, _ := ctx.Value(recordKey{}).(*Record)
+	return r
+}
+
+// Sink stores audit events.
+type Sink interface {
+	// Write stores an event. It may be called concurrently.
+	Write(ctx context.Context, e *Event) error
+	Close() error
+}
+
+// NewSinkFunc creates a sink with a given address.
+type NewSinkFunc func(addr string) (Sink, error)
+
+var sinks = make(map[string]NewSinkFunc)
+
+// RegisterSink registers a sink type with a given name.
+func RegisterSink(name string, fnc NewSinkFunc) {
+	if fnc == nil {
+		panic("NewSinkFunc must not be nil")
+	}
+	if _, ok := sinks[name]; ok {
+		panic(fmt.Sprintf("Already registered audit sink %q.", name))
+	}
+	sinks[name] = fnc
+}
+
+// NewSink creates a sink of a registered type.
+func NewSink(name, addr string) (Sink, error) {
+	fnc, ok := sinks[name]
+	if !ok {
+		return nil, fmt.Errorf("audit: unknown sink type: %q", name)
+	}
+	return fnc(addr)
+}
+
+// SinkTypes returns names of all registered sink types.
+func SinkTypes() []string {
+	out := make([]string, 0, len(sinks))
+	for name := range sinks {
+		out = append(out, name)
+	}
+	sort.Strings(out)
+	return out
+}
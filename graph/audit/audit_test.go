@@ -0,0 +1,195 @@
+package audit_test
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/cayleygraph/cayley/graph"
+	"github.com/cayleygraph/cayley/graph/audit"
+	"github.com/cayleygraph/cayley/graph/memstore"
+	"github.com/cayleygraph/cayley/quad"
+	_ "github.com/cayleygraph/cayley/writer"
+)
+
+func newHandle(t testing.TB) *graph.Handle {
+	qs := memstore.New()
+	qw, err := graph.NewQuadWriter("single", qs, nil)
+	require.NoError(t, err)
+	return &graph.Handle{QuadStore: qs, QuadWriter: qw}
+}
+
+func TestRecord(t *testing.T) {
+	rec := audit.NewRecord("", "alice")
+	require.Nil(t, rec.Finish(nil))
+
+	h := newHandle(t)
+	qs := graph.WithWriterMiddleware(h.QuadStore, rec.ObserveDeltas())
+	err := qs.ApplyDeltas([]graph.Delta{
+		{Action: graph.Add, Quad: quad.MakeIRI("a", "b", "c", "")},
+		{Action: graph.Add, Quad: quad.MakeIRI("a", "b", "d", "")},
+	}, graph.IgnoreOpts{})
+	require.NoError(t, err)
+	err = qs.ApplyDeltas([]graph.Delta{
+		{Action: graph.Delete, Quad: quad.MakeIRI("a", "b", "c", "")},
+	}, graph.IgnoreOpts{})
+	require.NoError(t, err)
+
+	e := rec.Finish(errors.New("failed"))
+	require.NotNil(t, e)
+	require.Equal(t, audit.OpWrite, e.Op)
+	require.Equal(t, "alice", e.Principal)
+	require.Equal(t, "failed", e.Error)
+	require.Equal(t, int64(3), e.Results)
+	require.Equal(t, []quad.Quad{quad.MakeIRI("a", "b", "c", ""), quad.MakeIRI("a", "b", "d", "")}, e.Added)
+	require.Equal(t, []quad.Quad{quad.MakeIRI("a", "b", "c", "")}, e.Removed)
+
+	ctx := audit.WithRecord(context.Background(), rec)
+	require.True(t, audit.RecordFrom(ctx) == rec)
+	require.Nil(t, audit.RecordFrom(context.Background()))
+}
+
+func queryEvent() *audit.Event {
+	rec := audit.NewRecord(audit.OpQuery, "bob")
+	rec.SetQuery("gizmo", "g.V().All()")
+	rec.AddResults(2)
+	return rec.Finish(nil)
+}
+
+func TestFileSink(t *testing.T) {
+	dir, err := ioutil.TempDir("", "cayley_audit")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "audit.log")
+
+	s, err := audit.NewSink("file", path)
+	require.NoError(t, err)
+	ctx := context.TODO()
+	require.NoError(t, s.Write(ctx, queryEvent()))
+	require.NoError(t, s.Write(ctx, queryEvent()))
+	require.NoError(t, s.Close())
+
+	data, err := ioutil.ReadFile(path)
+	require.NoError(t, err)
+	lines := strings.Split(strings.TrimSpace(string(data)), "\n")
+	require.Len(t, lines, 2)
+	var e map[string]interface{}
+	require.NoError(t, json.Unmarshal([]byte(lines[0]), &e))
+	require.Equal(t, "bob", e["principal"])
+	require.Equal(t, "query", e["op"])
+	require.Equal(t, "g.V().All()", e["query"])
+	require.Equal(t, float64(2), e["results"])
+}
+
+func TestGraphSink(t *testing.T) {
+	h := newHandle(t)
+	s := audit.NewGraphSink(h.QuadWriter, audit.Graph)
+	require.NoError(t, s.Write(context.TODO(), queryEvent()))
+
+	all, err := quad.ReadAll(graph.NewQuadStoreReader(h.QuadStore))
+	require.NoError(t, err)
+	got := make(map[quad.Value]quad.Value)
+	for _, q := range all {
+		require.Equal(t, audit.Graph, q.Label)
+		got[q.Predicate] = q.Object
+	}
+	require.Equal(t, quad.String("bob"), got[audit.PredPrincipal])
+	require.Equal(t, quad.String("g.V().All()"), got[audit.PredQuery])
+	require.Equal(t, quad.Int(2), got[audit.PredResults])
+}
+
+func TestWebhook(t *testing.T) {
+	var got []map[string]interface{}
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var e map[string]interface{}
+		if err := json.NewDecoder(r.Body).Decode(&e); err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		got = append(got, e)
+	}))
+	defer srv.Close()
+
+	s, err := audit.NewSink("webhook", srv.URL)
+	require.NoError(t, err)
+	require.NoError(t, s.Write(context.TODO(), queryEvent()))
+	require.Len(t, got, 1)
+	require.Equal(t, "bob", got[0]["principal"])
+
+	srv404 := httptest.NewServer(http.NotFoundHandler())
+	defer srv404.Close()
+	s, err = audit.NewSink("webhook", srv404.URL)
+	require.NoError(t, err)
+	require.Error(t, s.Write(context.TODO(), queryEvent()))
+}
+
+func TestRecordTruncated(t *testing.T) {
+	rec := audit.NewRecord("", "alice")
+	in := make([]graph.Delta, audit.MaxEventQuads+10)
+	for i := range in {
+		in[i] = graph.Delta{Action: graph.Add, Quad: quad.Make(quad.IRI("a"), quad.IRI("b"), quad.Int(i), nil)}
+	}
+	rec.AddDeltas(in)
+	e := rec.Finish(nil)
+	require.True(t, e.Truncated)
+	require.Len(t, e.Added, audit.MaxEventQuads)
+	require.Equal(t, int64(len(in)), e.Results)
+}
+
+func TestOpenGraph(t *testing.T) {
+	s, err := audit.NewSink("graph", "memstore")
+	require.NoError(t, err)
+	defer s.Close()
+	require.NoError(t, s.Write(context.TODO(), queryEvent()))
+
+	_, err = audit.NewSink("graph", "")
+	require.Error(t, err)
+}
+
+// blockingSink waits for a signal before writing each event.
+type blockingSink struct {
+	wait   chan struct{}
+	events []*audit.Event
+	closed bool
+}
+
+func (s *blockingSink) Write(_ context.Context, e *audit.Event) error {
+	<-s.wait
+	s.events = append(s.events, e)
+	return nil
+}
+
+func (s *blockingSink) Close() error {
+	s.closed = true
+	return nil
+}
+
+func TestAsyncSink(t *testing.T) {
+	bs := &blockingSink{wait: make(chan struct{})}
+	s := audit.NewAsync(bs, 1)
+	ctx := context.TODO()
+	// the writer is blocked, thus the buffer fills up quickly
+	n := 0
+	var err error
+	for i := 0; i < 100 && err == nil; i++ {
+		if err = s.Write(ctx, queryEvent()); err == nil {
+			n++
+		}
+	}
+	require.Equal(t, audit.ErrDropped, err)
+
+	close(bs.wait)
+	require.NoError(t, s.Close())
+	require.Len(t, bs.events, n)
+	require.True(t, bs.closed)
+	require.Error(t, s.Write(ctx, queryEvent()))
+}
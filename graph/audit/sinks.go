@@ -0,0 +1,318 @@
+// Copyright 2017 The Cayley Authors. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package audit
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/cayleygraph/cayley/clog"
+	"github.com/cayleygraph/cayley/graph"
+	"github.com/cayleygraph/cayley/quad"
+)
+
+func init() {
+	RegisterSink("file", func(addr string) (Sink, error) {
+		return OpenFile(addr)
+	})
+	RegisterSink("graph", func(addr string) (Sink, error) {
+		return OpenGraph(addr)
+	})
+	RegisterSink("webhook", func(addr string) (Sink, error) {
+		if addr == "" {
+			return nil, errors.New("audit: webhook URL is not set")
+		}
+		return NewWebhook(addr, 0), nil
+	})
+}
+
+var _ Sink = (*FileSink)(nil)
+
+// FileSink appends events to a file, one JSON object per line.
+type FileSink struct {
+	mu sync.Mutex
+	f  *os.File
+}
+
+// OpenFile opens a file sink, creating the file if necessary. Path "-" writes events to stdout.
+func OpenFile(path string) (*FileSink, error) {
+	if path == "" {
+		return nil, errors.New("audit: file path is not set")
+	} else if path == "-" {
+		return &FileSink{f: os.Stdout}, nil
+	}
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0600)
+	if err != nil {
+		return nil, err
+	}
+	return &FileSink{f: f}, nil
+}
+
+func (s *FileSink) Write(_ context.Context, e *Event) error {
+	data, err := json.Marshal(e)
+	if err != nil {
+		return err
+	}
+	data = append(data, '\n')
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	_, err = s.f.Write(data)
+	return err
+}
+
+func (s *FileSink) Close() error {
+	if s.f == os.Stdout {
+		return nil
+	}
+	return s.f.Close()
+}
+
+// Vocabulary of events written by the graph sink. Events are stored as quads with Graph label:
+//
+//	_:audit<id> <cayley:op> "query" <cayley:audit> .
+//	_:audit<id> <cayley:principal> "alice" <cayley:audit> .
+//	_:audit<id> <cayley:time> "time"^^<xsd:dateTime> <cayley:audit> .
+//	_:audit<id> <cayley:query> "g.V().All()" <cayley:audit> .
+//
+// Each applied change is stored as an N-Quad string prefixed with "+" or "-" (see graph/patch).
+const (
+	Graph         = quad.IRI("cayley:audit")
+	PredOp        = quad.IRI("cayley:op")
+	PredPrincipal = quad.IRI("cayley:principal")
+	PredTime      = quad.IRI("cayley:time")
+	PredRequestID = quad.IRI("cayley:request_id")
+	PredLang      = quad.IRI("cayley:lang")
+	PredQuery     = quad.IRI("cayley:query")
+	PredChange    = quad.IRI("cayley:change")
+	PredDuration  = quad.IRI("cayley:duration")
+	PredResults   = quad.IRI("cayley:results")
+	PredError     = quad.IRI("cayley:error")
+	PredTruncated = quad.IRI("cayley:truncated")
+)
+
+// Quads returns quads that describe the event in a given graph.
+func (e *Event) Quads(label quad.Value) []quad.Quad {
+	var b [8]byte
+	rand.Read(b[:])
+	n := quad.BNode("audit" + hex.EncodeToString(b[:]))
+	out := []quad.Quad{
+		{Subject: n, Predicate: PredOp, Object: quad.String(e.Op), Label: label},
+		{Subject: n, Predicate: PredTime, Object: quad.Time(e.Time), Label: label},
+		{Subject: n, Predicate: PredDuration, Object: quad.String(e.Duration.String()), Label: label},
+		{Subject: n, Predicate: PredResults, Object: quad.Int(e.Results), Label: label},
+	}
+	add := func(p quad.IRI, s string) {
+		if s != "" {
+			out = append(out, quad.Quad{Subject: n, Predicate: p, Object: quad.String(s), Label: label})
+		}
+	}
+	add(PredPrincipal, e.Principal)
+	add(PredRequestID, e.RequestID)
+	add(PredLang, e.Lang)
+	add(PredQuery, e.Query)
+	add(PredError, e.Error)
+	if e.Truncated {
+		out = append(out, quad.Quad{Subject: n, Predicate: PredTruncated, Object: quad.Bool(true), Label: label})
+	}
+	for _, q := range e.Added {
+		add(PredChange, "+ "+q.NQuad())
+	}
+	for _, q := range e.Removed {
+		add(PredChange, "- "+q.NQuad())
+	}
+	return out
+}
+
+var _ Sink = (*GraphSink)(nil)
+
+// GraphSink writes events as quads to a given writer.
+//
+// The audit trail should not be stored in the audited database, since any user that can write to it
+// would be able to alter the trail. See OpenGraph.
+type GraphSink struct {
+	qw    graph.QuadWriter
+	label quad.Value
+	qs    graph.QuadStore // closed with the sink, if set
+}
+
+// NewGraphSink creates a sink that writes events with a given label.
+func NewGraphSink(qw graph.QuadWriter, label quad.Value) *GraphSink {
+	return &GraphSink{qw: qw, label: label}
+}
+
+// OpenGraph opens a separate database for the audit trail and returns a sink that writes events to it,
+// with Graph label. Address has the form "backend:path", for example "bolt:/var/lib/cayley/audit".
+// The database is initialized if necessary.
+func OpenGraph(addr string) (*GraphSink, error) {
+	if addr == "" {
+		return nil, errors.New("audit: graph database is not set")
+	}
+	backend, path := addr, ""
+	if i := strings.Index(addr, ":"); i >= 0 {
+		backend, path = addr[:i], addr[i+1:]
+	}
+	err := graph.InitQuadStore(backend, path, nil)
+	if err != nil && err != graph.ErrDatabaseExists && err != graph.ErrOperationNotSupported {
+		return nil, err
+	}
+	qs, err := graph.NewQuadStore(backend, path, nil)
+	if err != nil {
+		return nil, err
+	}
+	qw, err := graph.NewQuadWriter("single", qs, nil)
+	if err != nil {
+		qs.Close()
+		return nil, err
+	}
+	return &GraphSink{qw: qw, label: Graph, qs: qs}, nil
+}
+
+func (s *GraphSink) Write(_ context.Context, e *Event) error {
+	return s.qw.AddQuadSet(e.Quads(s.label))
+}
+
+func (s *GraphSink) Close() error {
+	if s.qs == nil {
+		return nil
+	}
+	err := s.qw.Close()
+	if err2 := s.qs.Close(); err == nil {
+		err = err2
+	}
+	return err
+}
+
+// DefaultWebhookTimeout is a timeout for delivering a single event to a webhook.
+const DefaultWebhookTimeout = 10 * time.Second
+
+var _ Sink = (*Webhook)(nil)
+
+// Webhook posts each event as a JSON object to a given URL.
+type Webhook struct {
+	url string
+	cli *http.Client
+}
+
+// NewWebhook creates a webhook sink. Zero timeout means DefaultWebhookTimeout.
+func NewWebhook(url string, timeout time.Duration) *Webhook {
+	if timeout <= 0 {
+		timeout = DefaultWebhookTimeout
+	}
+	return &Webhook{url: url, cli: &http.Client{Timeout: timeout}}
+}
+
+func (s *Webhook) Write(ctx context.Context, e *Event) error {
+	data, err := json.Marshal(e)
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequest("POST", s.url, bytes.NewReader(data))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := s.cli.Do(req.WithContext(ctx))
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	io.Copy(ioutil.Discard, resp.Body)
+	if resp.StatusCode/100 != 2 {
+		return fmt.Errorf("audit: webhook returned %s", resp.Status)
+	}
+	return nil
+}
+
+func (s *Webhook) Close() error {
+	return nil
+}
+
+// DefaultAsyncBuffer is a default number of events buffered by an asynchronous sink.
+const DefaultAsyncBuffer = 1024
+
+// ErrDropped is returned by an asynchronous sink if an event is dropped because the buffer is full.
+var ErrDropped = errors.New("audit: event dropped, sink buffer is full")
+
+var _ Sink = (*AsyncSink)(nil)
+
+// AsyncSink writes events to another sink in background, thus slow sinks do not delay audited requests.
+// If the buffer is full, events are dropped and Write returns ErrDropped.
+type AsyncSink struct {
+	s    Sink
+	mu   sync.RWMutex
+	c    chan *Event
+	done chan struct{}
+}
+
+// NewAsync starts writing events to a given sink in background. Zero size means DefaultAsyncBuffer.
+// Closing the returned sink writes the remaining events and closes the underlying sink.
+func NewAsync(s Sink, size int) *AsyncSink {
+	if size <= 0 {
+		size = DefaultAsyncBuffer
+	}
+	a := &AsyncSink{s: s, c: make(chan *Event, size), done: make(chan struct{})}
+	go a.run(a.c)
+	return a
+}
+
+func (s *AsyncSink) run(c <-chan *Event) {
+	defer close(s.done)
+	// the request that produced an event may already be finished, thus its context is not used
+	ctx := context.Background()
+	for e := range c {
+		if err := s.s.Write(ctx, e); err != nil {
+			clog.Errorf("failed to write audit event: %v", err)
+		}
+	}
+}
+
+func (s *AsyncSink) Write(_ context.Context, e *Event) error {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	if s.c == nil {
+		return errors.New("audit: sink is closed")
+	}
+	select {
+	case s.c <- e:
+		return nil
+	default:
+		return ErrDropped
+	}
+}
+
+func (s *AsyncSink) Close() error {
+	s.mu.Lock()
+	if s.c == nil {
+		s.mu.Unlock()
+		return nil
+	}
+	close(s.c)
+	s.c = nil
+	s.mu.Unlock()
+	<-s.done
+	return s.s.Close()
+}
@@ -0,0 +1,306 @@
+// Copyright 2017 The Cayley Authors. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package graph
+
+import (
+	"fmt"
+	"io"
+	"sort"
+	"sync"
+
+	"github.com/cayleygraph/cayley/quad"
+	"github.com/cayleygraph/cayley/voc/rdf"
+)
+
+// ConstraintKind is a kind of constraint that was violated.
+type ConstraintKind int
+
+const (
+	// ConstraintMaxObjects is violated when a subject has too many objects for a predicate.
+	ConstraintMaxObjects ConstraintKind = iota + 1
+	// ConstraintRequired is violated when a node of a given type has no values for a required predicate.
+	ConstraintRequired
+	// ConstraintUnique is violated when the same object of a unique predicate is used by multiple subjects.
+	ConstraintUnique
+)
+
+func (k ConstraintKind) String() string {
+	switch k {
+	case ConstraintMaxObjects:
+		return "max_objects"
+	case ConstraintRequired:
+		return "required"
+	case ConstraintUnique:
+		return "unique"
+	}
+	return fmt.Sprintf("ConstraintKind(%d)", int(k))
+}
+
+// ConstraintError is returned when deltas violate one of the constraints.
+type ConstraintError struct {
+	Kind      ConstraintKind
+	Subject   quad.Value
+	Predicate quad.Value
+	// Object is a duplicate value for ConstraintUnique.
+	Object quad.Value
+	// Type is a type of the subject for ConstraintRequired.
+	Type quad.Value
+	// Limit is the maximal number of objects for ConstraintMaxObjects.
+	Limit int
+}
+
+func (e *ConstraintError) Error() string {
+	switch e.Kind {
+	case ConstraintMaxObjects:
+		return fmt.Sprintf("constraint violation: %v has more than %d values for %v", e.Subject, e.Limit, e.Predicate)
+	case ConstraintRequired:
+		return fmt.Sprintf("constraint violation: %v of type %v has no values for %v", e.Subject, e.Type, e.Predicate)
+	case ConstraintUnique:
+		return fmt.Sprintf("constraint violation: value %v for %v is used by multiple subjects, including %v", e.Object, e.Predicate, e.Subject)
+	}
+	return fmt.Sprintf("constraint violation: %v", e.Kind)
+}
+
+// IsConstraintViolation checks if an error is a ConstraintError or wraps one.
+func IsConstraintViolation(err error) bool {
+	for err != nil {
+		if _, ok := err.(*ConstraintError); ok {
+			return true
+		}
+		u, ok := err.(interface {
+			Unwrap() error
+		})
+		if !ok {
+			return false
+		}
+		err = u.Unwrap()
+	}
+	return false
+}
+
+// PredicateConstraints restrict values of a single predicate. Zero value means no restrictions.
+type PredicateConstraints struct {
+	// MaxObjects is the maximal number of distinct objects a subject can have for the predicate.
+	MaxObjects int
+	// Unique requires each object of the predicate to be used by a single subject only.
+	Unique bool
+}
+
+// Constraints is a registry of constraints checked for each set of deltas before it is applied.
+// Quads are matched regardless of their labels.
+//
+// Only nodes and values affected by deltas are checked, thus violations that already exist
+// in the store do not prevent unrelated writes. Each check reads related quads from the store,
+// which makes writes slower, and concurrent writers may still violate constraints.
+type Constraints struct {
+	mu       sync.RWMutex
+	preds    map[quad.Value]PredicateConstraints
+	required map[quad.Value][]quad.Value
+}
+
+// NewConstraints creates an empty constraint registry.
+func NewConstraints() *Constraints {
+	return &Constraints{
+		preds:    make(map[quad.Value]PredicateConstraints),
+		required: make(map[quad.Value][]quad.Value),
+	}
+}
+
+// SetPredicate sets constraints for a predicate. Zero value removes all constraints of the predicate.
+func (c *Constraints) SetPredicate(pred quad.Value, pc PredicateConstraints) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if pc == (PredicateConstraints{}) {
+		delete(c.preds, pred)
+	} else {
+		c.preds[pred] = pc
+	}
+}
+
+// Require sets a list of predicates that must have at least one value for each node of a given type
+// (an object of rdf:type). Calling it without predicates removes the requirement.
+func (c *Constraints) Require(typ quad.Value, preds ...quad.Value) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if len(preds) == 0 {
+		delete(c.required, typ)
+	} else {
+		c.required[typ] = append([]quad.Value{}, preds...)
+	}
+}
+
+// Middleware returns a writer middleware that rejects deltas violating constraints with ConstraintError.
+func (c *Constraints) Middleware(qs QuadStore) WriterMiddleware {
+	return func(next ApplyDeltasFunc) ApplyDeltasFunc {
+		return func(in []Delta, opts IgnoreOpts) error {
+			if err := c.Check(qs, in); err != nil {
+				return err
+			}
+			return next(in, opts)
+		}
+	}
+}
+
+type valuePair struct {
+	a, b quad.Value
+}
+
+// Check returns a ConstraintError if the store violates constraints after applying deltas.
+func (c *Constraints) Check(qs QuadStore, in []Delta) error {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	if len(c.preds) == 0 && len(c.required) == 0 {
+		return nil
+	}
+	typ := quad.IRI(rdf.Type).Full()
+	requiredPreds := make(map[quad.Value]struct{})
+	for _, preds := range c.required {
+		for _, p := range preds {
+			requiredPreds[p] = struct{}{}
+		}
+	}
+	var (
+		card, uniq []valuePair
+		subs       []quad.Value
+		seen       = make(map[interface{}]struct{})
+	)
+	once := func(k interface{}) bool {
+		if _, ok := seen[k]; ok {
+			return false
+		}
+		seen[k] = struct{}{}
+		return true
+	}
+	for _, d := range in {
+		q := d.Quad
+		if d.Action == Add {
+			pc := c.preds[q.Predicate]
+			if k := (valuePair{q.Subject, q.Predicate}); pc.MaxObjects > 0 && once(k) {
+				card = append(card, k)
+			}
+			if k := (valuePair{q.Predicate, q.Object}); pc.Unique && once(k) {
+				uniq = append(uniq, k)
+			}
+		}
+		check := false
+		if d.Action == Add && isType(q.Predicate, typ) {
+			_, check = c.required[q.Object]
+		} else if d.Action == Delete {
+			_, check = requiredPreds[q.Predicate]
+		}
+		if check && once(q.Subject) {
+			subs = append(subs, q.Subject)
+		}
+	}
+	for _, k := range card {
+		set, err := quadsAfter(qs, quad.Quad{Subject: k.a, Predicate: k.b}, in)
+		if err != nil {
+			return err
+		}
+		objs := make(map[quad.Value]struct{})
+		for q := range set {
+			objs[q.Object] = struct{}{}
+		}
+		if limit := c.preds[k.b].MaxObjects; len(objs) > limit {
+			return &ConstraintError{Kind: ConstraintMaxObjects, Subject: k.a, Predicate: k.b, Limit: limit}
+		}
+	}
+	for _, k := range uniq {
+		set, err := quadsAfter(qs, quad.Quad{Predicate: k.a, Object: k.b}, in)
+		if err != nil {
+			return err
+		}
+		subjs := make(map[quad.Value]struct{})
+		var first quad.Value
+		for q := range set {
+			subjs[q.Subject] = struct{}{}
+			if first == nil || quad.StringOf(q.Subject) < quad.StringOf(first) {
+				first = q.Subject
+			}
+		}
+		if len(subjs) > 1 {
+			return &ConstraintError{Kind: ConstraintUnique, Subject: first, Predicate: k.a, Object: k.b}
+		}
+	}
+	for _, s := range subs {
+		set, err := quadsAfter(qs, quad.Quad{Subject: s}, in)
+		if err != nil {
+			return err
+		}
+		var types []quad.Value
+		preds := make(map[quad.Value]struct{})
+		for q := range set {
+			preds[q.Predicate] = struct{}{}
+			if isType(q.Predicate, typ) {
+				if _, ok := c.required[q.Object]; ok {
+					types = append(types, q.Object)
+				}
+			}
+		}
+		sort.Slice(types, func(i, j int) bool {
+			return quad.StringOf(types[i]) < quad.StringOf(types[j])
+		})
+		for _, t := range types {
+			for _, p := range c.required[t] {
+				if _, ok := preds[p]; !ok {
+					return &ConstraintError{Kind: ConstraintRequired, Subject: s, Predicate: p, Type: t}
+				}
+			}
+		}
+	}
+	return nil
+}
+
+// isType checks if the predicate is rdf:type, in either full or short form.
+func isType(p quad.Value, typ quad.IRI) bool {
+	iri, ok := p.(quad.IRI)
+	return ok && iri.Full() == typ
+}
+
+// quadsAfter returns a set of quads matching the pattern after applying deltas to the store.
+func quadsAfter(qs QuadStore, pattern quad.Quad, in []Delta) (map[quad.Quad]struct{}, error) {
+	set := make(map[quad.Quad]struct{})
+	qr := NewMatchingReader(qs, pattern)
+	defer qr.Close()
+	for {
+		q, err := qr.ReadQuad()
+		if err == io.EOF {
+			break
+		} else if err != nil {
+			return nil, err
+		}
+		set[q] = struct{}{}
+	}
+	for _, d := range in {
+		if !matchesPattern(pattern, d.Quad) {
+			continue
+		}
+		if d.Action == Add {
+			set[d.Quad] = struct{}{}
+		} else {
+			delete(set, d.Quad)
+		}
+	}
+	return set, nil
+}
+
+func matchesPattern(pattern, q quad.Quad) bool {
+	for _, d := range quad.Directions {
+		if v := pattern.Get(d); v != nil && v != q.Get(d) {
+			return false
+		}
+	}
+	return true
+}
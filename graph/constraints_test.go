@@ -0,0 +1,78 @@
+package graph_test
+
+import (
+	"testing"
+
+	"github.com/cayleygraph/cayley/graph"
+	"github.com/cayleygraph/cayley/graph/memstore"
+	"github.com/cayleygraph/cayley/quad"
+	"github.com/cayleygraph/cayley/voc/rdf"
+	_ "github.com/cayleygraph/cayley/writer"
+)
+
+func TestConstraints(t *testing.T) {
+	var (
+		user  = quad.IRI("User")
+		email = quad.IRI("email")
+		name  = quad.IRI("name")
+		typ   = quad.IRI(rdf.Type)
+	)
+	c := graph.NewConstraints()
+	c.SetPredicate(email, graph.PredicateConstraints{MaxObjects: 1, Unique: true})
+	c.Require(user, name)
+
+	st := memstore.New()
+	qw, err := graph.NewQuadWriter("single", graph.WithWriterMiddleware(st, c.Middleware(st)), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expect := func(err error, kind graph.ConstraintKind) {
+		t.Helper()
+		if kind == 0 {
+			if err != nil {
+				t.Fatal(err)
+			}
+			return
+		}
+		if !graph.IsConstraintViolation(err) {
+			t.Fatalf("expected constraint violation, got: %v", err)
+		} else if k := err.(*graph.ConstraintError).Kind; k != kind {
+			t.Fatalf("expected %v violation, got: %v", kind, k)
+		}
+	}
+	alice, bob := quad.IRI("alice"), quad.IRI("bob")
+	expect(qw.AddQuadSet([]quad.Quad{
+		{Subject: alice, Predicate: typ, Object: user},
+		{Subject: alice, Predicate: name, Object: quad.String("Alice")},
+		{Subject: alice, Predicate: email, Object: quad.String("alice@example.com")},
+	}), 0)
+
+	// second email of the same user
+	expect(qw.AddQuad(quad.Quad{Subject: alice, Predicate: email, Object: quad.String("a@example.com")}), graph.ConstraintMaxObjects)
+	// the same email in a different graph is fine
+	expect(qw.AddQuad(quad.Quad{Subject: alice, Predicate: email, Object: quad.String("alice@example.com"), Label: quad.IRI("g")}), 0)
+	// replacing an email in a single transaction is fine
+	expect(qw.ApplyTransaction(&graph.Transaction{Deltas: []graph.Delta{
+		{Action: graph.Delete, Quad: quad.Quad{Subject: alice, Predicate: email, Object: quad.String("alice@example.com")}},
+		{Action: graph.Delete, Quad: quad.Quad{Subject: alice, Predicate: email, Object: quad.String("alice@example.com"), Label: quad.IRI("g")}},
+		{Action: graph.Add, Quad: quad.Quad{Subject: alice, Predicate: email, Object: quad.String("a@example.com")}},
+	}}), 0)
+
+	// email of another user
+	expect(qw.AddQuadSet([]quad.Quad{
+		{Subject: bob, Predicate: typ, Object: user},
+		{Subject: bob, Predicate: name, Object: quad.String("Bob")},
+		{Subject: bob, Predicate: email, Object: quad.String("a@example.com")},
+	}), graph.ConstraintUnique)
+	// user without a name
+	expect(qw.AddQuad(quad.Quad{Subject: bob, Predicate: typ, Object: user}), graph.ConstraintRequired)
+	expect(qw.RemoveQuad(quad.Quad{Subject: alice, Predicate: name, Object: quad.String("Alice")}), graph.ConstraintRequired)
+
+	// nothing was written by rejected deltas
+	all, err := quad.ReadAll(graph.NewQuadStoreReader(st))
+	if err != nil {
+		t.Fatal(err)
+	} else if len(all) != 3 {
+		t.Fatalf("unexpected quads: %v", all)
+	}
+}
@@ -0,0 +1,90 @@
+// Copyright 2017 The Cayley Authors. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package graph
+
+import (
+	"context"
+	"io"
+
+	"github.com/cayleygraph/cayley/quad"
+)
+
+// Diff streams changes that transform the store a into the store b: quads of a that are missing
+// in b are sent as Delete deltas, followed by quads of b that are missing in a as Add deltas.
+//
+// The delta channel is closed when both stores are compared, after which the error channel
+// receives the result of the comparison. Cancelling the context stops the comparison.
+//
+// Each quad is looked up in the other store separately, thus stores should have indexes
+// that allow to find quads by their values efficiently.
+func Diff(ctx context.Context, a, b QuadStore) (<-chan Delta, <-chan error) {
+	out := make(chan Delta)
+	errc := make(chan error, 1)
+	go func() {
+		defer close(errc)
+		err := diffMissing(ctx, a, b, Delete, out)
+		if err == nil {
+			err = diffMissing(ctx, b, a, Add, out)
+		}
+		close(out)
+		errc <- err
+	}()
+	return out, errc
+}
+
+// diffMissing sends quads of the store from that are not in the store to as deltas with a given action.
+func diffMissing(ctx context.Context, from, to QuadStore, act Procedure, out chan<- Delta) error {
+	qr := NewQuadStoreReader(from)
+	defer qr.Close()
+	for {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		q, err := qr.ReadQuad()
+		if err == io.EOF {
+			return nil
+		} else if err != nil {
+			return err
+		}
+		ok, err := hasQuad(to, q)
+		if err != nil {
+			return err
+		} else if ok {
+			continue
+		}
+		select {
+		case out <- Delta{Action: act, Quad: q}:
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+}
+
+// hasQuad checks if the store contains exactly the same quad.
+func hasQuad(qs QuadStore, q quad.Quad) (bool, error) {
+	// a pattern with nil label matches quads with any label
+	qr := NewMatchingReader(qs, q)
+	defer qr.Close()
+	for {
+		q2, err := qr.ReadQuad()
+		if err == io.EOF {
+			return false, nil
+		} else if err != nil {
+			return false, err
+		} else if q2 == q {
+			return true, nil
+		}
+	}
+}
@@ -0,0 +1,127 @@
+// Copyright 2017 The Cayley Authors. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package graph
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/binary"
+	"io"
+
+	"github.com/cayleygraph/cayley/quad"
+)
+
+// DigestSize is the size of a digest in bytes.
+const DigestSize = sha256.Size
+
+// Digest calculates a SHA-256 digest of all quads in the store.
+// See DigestReader for details.
+func Digest(ctx context.Context, qs QuadStore) ([]byte, error) {
+	qr := NewQuadStoreReader(qs)
+	defer qr.Close()
+	return DigestReader(ctx, qr)
+}
+
+// DigestReader calculates a SHA-256 digest of a set of quads. See Digester for details.
+func DigestReader(ctx context.Context, r quad.Reader) ([]byte, error) {
+	var d Digester
+	for {
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+		q, err := r.ReadQuad()
+		if err == io.EOF {
+			break
+		} else if err != nil {
+			return nil, err
+		}
+		d.Add(q)
+	}
+	return d.Sum(), nil
+}
+
+// Digester calculates a SHA-256 digest of a set of quads. The digest does not depend on the order
+// of quads and on labels of blank nodes, thus two stores or dumps with the same content produce
+// the same digest.
+//
+// Each quad is hashed separately in N-Quads form and hashes are summed, so quads without blank nodes
+// are processed in constant memory. Quads with blank nodes are kept in memory and hashed after
+// the blank nodes are relabeled with quad.CanonicalBlankNodes.
+//
+// Quads are treated as a set, thus the same quad must not be added twice.
+type Digester struct {
+	sum    [DigestSize]byte
+	n      uint64
+	bnodes []quad.Quad
+}
+
+// Add adds a quad to the digest.
+func (d *Digester) Add(q quad.Quad) {
+	if hasBlankNodes(q) {
+		d.bnodes = append(d.bnodes, q)
+		return
+	}
+	d.add(q)
+}
+
+func (d *Digester) add(q quad.Quad) {
+	h := sha256.Sum256([]byte(q.NQuad()))
+	// addition modulo 2^256 does not depend on the order of quads
+	var carry uint
+	for i := len(d.sum) - 1; i >= 0; i-- {
+		s := uint(d.sum[i]) + uint(h[i]) + carry
+		d.sum[i], carry = byte(s), s>>8
+	}
+	d.n++
+}
+
+// Sum returns the digest of all added quads. No quads can be added after calling it.
+func (d *Digester) Sum() []byte {
+	for _, q := range quad.CanonicalBlankNodes(d.bnodes) {
+		d.add(q)
+	}
+	d.bnodes = nil
+	h := sha256.New()
+	h.Write(d.sum[:])
+	binary.Write(h, binary.BigEndian, d.n)
+	return h.Sum(nil)
+}
+
+// Reader returns a quad reader that adds all quads read from r to the digest.
+func (d *Digester) Reader(r quad.Reader) quad.Reader {
+	return &digestReader{r: r, d: d}
+}
+
+type digestReader struct {
+	r quad.Reader
+	d *Digester
+}
+
+func (r *digestReader) ReadQuad() (quad.Quad, error) {
+	q, err := r.r.ReadQuad()
+	if err == nil {
+		r.d.Add(q)
+	}
+	return q, err
+}
+
+func hasBlankNodes(q quad.Quad) bool {
+	for _, d := range quad.Directions {
+		if _, ok := q.Get(d).(quad.BNode); ok {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,51 @@
+package graph
+
+import (
+	"bytes"
+	"context"
+	"testing"
+
+	"github.com/cayleygraph/cayley/quad"
+)
+
+func TestDigestReader(t *testing.T) {
+	digest := func(quads ...quad.Quad) []byte {
+		h, err := DigestReader(context.TODO(), quad.NewReader(quads))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(h) != DigestSize {
+			t.Fatalf("unexpected digest size: %d", len(h))
+		}
+		return h
+	}
+	var (
+		q1 = quad.MakeIRI("alice", "follows", "bob", "")
+		q2 = quad.MakeIRI("bob", "follows", "carol", "")
+		q3 = quad.MakeIRI("bob", "follows", "carol", "g")
+	)
+	bnodes := func(a, b string) []quad.Quad {
+		return []quad.Quad{
+			{Subject: quad.IRI("alice"), Predicate: quad.IRI("address"), Object: quad.BNode(a)},
+			{Subject: quad.BNode(a), Predicate: quad.IRI("geo"), Object: quad.BNode(b)},
+		}
+	}
+
+	if !bytes.Equal(digest(q1, q2), digest(q2, q1)) {
+		t.Error("digest depends on the order of quads")
+	}
+	if bytes.Equal(digest(q1, q2), digest(q1, q3)) {
+		t.Error("digest does not depend on labels")
+	}
+	if bytes.Equal(digest(), digest(q1)) {
+		t.Error("digest of an empty set is the same as for a single quad")
+	}
+	d1 := digest(append(bnodes("a", "b"), q1)...)
+	d2 := digest(append([]quad.Quad{q1}, bnodes("x", "y")...)...)
+	if !bytes.Equal(d1, d2) {
+		t.Error("digest depends on blank node labels")
+	}
+	if bytes.Equal(d1, digest(append(bnodes("a", "a"), q1)...)) {
+		t.Error("digest does not depend on the graph structure")
+	}
+}
@@ -0,0 +1,140 @@
+// Copyright 2017 The Cayley Authors. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package graph
+
+import (
+	"context"
+	"errors"
+)
+
+// Errors below are shared by all backends. Backends may return them as-is, or wrapped in DeltaError
+// or BackendError; use Is* functions or Cause to check for a specific error.
+var (
+	// ErrNotWritable is returned when a write is attempted on a read-only store or snapshot.
+	ErrNotWritable = errors.New("database is read-only")
+	// ErrUnsupported is returned when an operation is not supported by the backend.
+	ErrUnsupported = ErrOperationNotSupported
+)
+
+// BackendError wraps an error returned by a remote database of the backend, for example a connection failure
+// or a query error. Errors of local storage, such as key-value backends, are not wrapped.
+type BackendError struct {
+	Backend string // name of the backend or database driver
+	Err     error
+}
+
+func (e *BackendError) Error() string {
+	return e.Backend + ": " + e.Err.Error()
+}
+
+// Unwrap returns the original error of the database.
+func (e *BackendError) Unwrap() error {
+	return e.Err
+}
+
+// WrapBackend wraps an error of the underlying database into BackendError.
+//
+// Nil errors, context errors and errors that are already classified (errors declared in this package,
+// BackendError and ConstraintError) are returned as-is. For DeltaError, only the error it records is wrapped.
+func WrapBackend(name string, err error) error {
+	if de, ok := err.(*DeltaError); ok {
+		if isKnown(de.Err) {
+			return err
+		}
+		return &DeltaError{Delta: de.Delta, Err: &BackendError{Backend: name, Err: de.Err}}
+	}
+	if err == nil || isKnown(err) {
+		return err
+	}
+	return &BackendError{Backend: name, Err: err}
+}
+
+func isKnown(err error) bool {
+	switch err.(type) {
+	case *BackendError, *ConstraintError:
+		return true
+	}
+	switch err {
+	case nil, ErrQuadExists, ErrQuadNotExist, ErrInvalidAction, ErrNodeNotExists, ErrConflict,
+		ErrNotWritable, ErrUnsupported, ErrDatabaseExists, ErrNotInitialized,
+		ErrTextSearchNotSupported, ErrVectorSearchNotSupported,
+		context.Canceled, context.DeadlineExceeded:
+		return true
+	}
+	return false
+}
+
+// Cause returns the innermost error by following the chain of wrapped errors.
+// Errors are unwrapped if they implement the Unwrap() error method.
+func Cause(err error) error {
+	for err != nil {
+		u, ok := err.(interface {
+			Unwrap() error
+		})
+		if !ok {
+			break
+		}
+		next := u.Unwrap()
+		if next == nil {
+			break
+		}
+		err = next
+	}
+	return err
+}
+
+// isErr checks if an error or any error it wraps is equal to the target.
+func isErr(err, target error) bool {
+	for err != nil {
+		if err == target {
+			return true
+		}
+		u, ok := err.(interface {
+			Unwrap() error
+		})
+		if !ok {
+			return false
+		}
+		err = u.Unwrap()
+	}
+	return false
+}
+
+// IsNotWritable returns whether an error is caused by a write to a read-only store.
+func IsNotWritable(err error) bool {
+	return isErr(err, ErrNotWritable)
+}
+
+// IsUnsupported returns whether an error is caused by an operation not supported by the backend.
+func IsUnsupported(err error) bool {
+	return isErr(err, ErrUnsupported)
+}
+
+// IsBackendError returns whether an error was returned by the underlying database of the backend.
+func IsBackendError(err error) bool {
+	for err != nil {
+		if _, ok := err.(*BackendError); ok {
+			return true
+		}
+		u, ok := err.(interface {
+			Unwrap() error
+		})
+		if !ok {
+			return false
+		}
+		err = u.Unwrap()
+	}
+	return false
+}
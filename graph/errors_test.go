@@ -0,0 +1,77 @@
+package graph_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/cayleygraph/cayley/graph"
+	"github.com/cayleygraph/cayley/quad"
+)
+
+func TestWrapBackend(t *testing.T) {
+	errDB := errors.New("connection refused")
+	d := graph.Delta{Quad: quad.MakeIRI("a", "b", "c", ""), Action: graph.Add}
+
+	if err := graph.WrapBackend("sql", nil); err != nil {
+		t.Fatalf("expected no error, got: %v", err)
+	}
+	for _, err := range []error{
+		graph.ErrQuadExists, graph.ErrNotWritable, graph.ErrUnsupported, context.Canceled,
+		&graph.DeltaError{Delta: d, Err: graph.ErrQuadExists},
+		&graph.DeltaError{Delta: d, Err: &graph.ConstraintError{Kind: graph.ConstraintUnique}},
+	} {
+		if got := graph.WrapBackend("sql", err); got != err {
+			t.Errorf("known error should not be wrapped: %v", got)
+		}
+	}
+
+	err := graph.WrapBackend("sql", errDB)
+	if !graph.IsBackendError(err) {
+		t.Fatalf("expected a backend error, got: %v", err)
+	} else if graph.Cause(err) != errDB {
+		t.Fatalf("unexpected cause: %v", graph.Cause(err))
+	} else if err.Error() != "sql: connection refused" {
+		t.Fatalf("unexpected message: %q", err.Error())
+	}
+	if got := graph.WrapBackend("sql", err); got != err {
+		t.Fatalf("backend error should not be wrapped twice: %v", got)
+	}
+
+	err = graph.WrapBackend("nosql", &graph.DeltaError{Delta: d, Err: errDB})
+	de, ok := err.(*graph.DeltaError)
+	if !ok || de.Delta != d {
+		t.Fatalf("expected a delta error, got: %v", err)
+	} else if !graph.IsBackendError(err) || graph.Cause(err) != errDB {
+		t.Fatalf("expected a wrapped backend error, got: %v", err)
+	}
+}
+
+func TestErrorChecks(t *testing.T) {
+	d := graph.Delta{Quad: quad.MakeIRI("a", "b", "c", ""), Action: graph.Add}
+	wrap := func(err error) error {
+		return &graph.DeltaError{Delta: d, Err: &graph.BackendError{Backend: "kv", Err: err}}
+	}
+	for _, c := range []struct {
+		err   error
+		check func(error) bool
+	}{
+		{graph.ErrQuadExists, graph.IsQuadExist},
+		{graph.ErrQuadNotExist, graph.IsQuadNotExist},
+		{graph.ErrInvalidAction, graph.IsInvalidAction},
+		{graph.ErrConflict, graph.IsConflict},
+		{graph.ErrNotWritable, graph.IsNotWritable},
+		{graph.ErrOperationNotSupported, graph.IsUnsupported},
+	} {
+		if !c.check(c.err) {
+			t.Errorf("check failed for %v", c.err)
+		} else if !c.check(wrap(c.err)) {
+			t.Errorf("check failed for wrapped %v", c.err)
+		} else if c.check(errors.New(c.err.Error())) {
+			t.Errorf("check should not match error text: %v", c.err)
+		}
+	}
+	if graph.IsBackendError(graph.ErrQuadExists) {
+		t.Error("unexpected backend error")
+	}
+}
@@ -0,0 +1,159 @@
+// Copyright 2017 The Cayley Authors. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package graph
+
+// Features describes optional capabilities of a quad store.
+//
+// Implementing an optional interface (like Versioned or Maintainer) does not guarantee that the capability
+// is available: it may depend on the options the store was opened with, or on the underlying database.
+type Features struct {
+	// NodeGC is set if nodes that are no longer referenced by any quad are removed automatically.
+	// It can only be reported by the store itself.
+	NodeGC bool `json:"node_gc,omitempty"`
+	// Transactions is set if ApplyDeltas applies all deltas atomically.
+	Transactions bool `json:"transactions,omitempty"`
+	// Horizons is set if the store supports conditional writes. See Versioned.
+	Horizons bool `json:"horizons,omitempty"`
+	// Compaction is set if the store supports online compaction. See Maintainer.
+	Compaction bool `json:"compaction,omitempty"`
+	// Check is set if the store can verify consistency of its data. See Checker.
+	Check bool `json:"check,omitempty"`
+	// SoftDelete is set if removed quads are kept until they are purged. See SoftDeleter.
+	SoftDelete bool `json:"soft_delete,omitempty"`
+	// BulkLoad is set if the store supports bulk loading. See BulkLoader.
+	BulkLoad bool `json:"bulk_load,omitempty"`
+}
+
+// FeatureReporter is an optional interface for quad stores that report their capabilities.
+type FeatureReporter interface {
+	// Features returns capabilities of the store. The result must not change while the store is open.
+	Features() Features
+}
+
+// Unwrapper is an optional interface for quad stores that wrap another store.
+//
+// Helpers like AsVersioned look for optional interfaces in the chain of wrapped stores, thus a wrapper
+// does not hide capabilities of the underlying store. Wrappers that change how data is written must
+// implement optional interfaces that write to the store (like Versioned or BulkLoader) themselves.
+type Unwrapper interface {
+	// Unwrap returns the underlying quad store.
+	Unwrap() QuadStore
+}
+
+// unwrap calls fnc for the store and each store it wraps, until fnc returns true.
+func unwrap(qs QuadStore, fnc func(qs QuadStore) bool) bool {
+	for qs != nil {
+		if fnc(qs) {
+			return true
+		}
+		u, ok := qs.(Unwrapper)
+		if !ok {
+			return false
+		}
+		qs = u.Unwrap()
+	}
+	return false
+}
+
+// FeaturesOf returns capabilities of a quad store. It calls Features if the store implements FeatureReporter.
+// Wrappers that implement Unwrapper report capabilities of the underlying store.
+// Otherwise, capabilities are guessed from optional interfaces implemented by the store, and capabilities
+// that cannot be detected this way are reported as unsupported.
+func FeaturesOf(qs QuadStore) Features {
+	if fr, ok := qs.(FeatureReporter); ok {
+		return fr.Features()
+	} else if u, ok := qs.(Unwrapper); ok {
+		return FeaturesOf(u.Unwrap())
+	}
+	var f Features
+	_, f.Horizons = qs.(Versioned)
+	_, f.Compaction = qs.(Maintainer)
+	_, f.Check = qs.(Checker)
+	_, f.SoftDelete = qs.(SoftDeleter)
+	_, f.BulkLoad = qs.(BulkLoader)
+	return f
+}
+
+// AsVersioned returns the store as Versioned, if it supports conditional writes.
+// Unlike a type assertion, it also checks that Horizons feature is reported by the store,
+// and looks for the interface in stores wrapped by it.
+func AsVersioned(qs QuadStore) (Versioned, bool) {
+	var vs Versioned
+	ok := FeaturesOf(qs).Horizons && unwrap(qs, func(qs QuadStore) (ok bool) {
+		vs, ok = qs.(Versioned)
+		return
+	})
+	return vs, ok
+}
+
+// AsSoftDeleter returns the store as SoftDeleter, if soft deletes are enabled for it.
+func AsSoftDeleter(qs QuadStore) (SoftDeleter, bool) {
+	var sd SoftDeleter
+	ok := FeaturesOf(qs).SoftDelete && unwrap(qs, func(qs QuadStore) (ok bool) {
+		sd, ok = qs.(SoftDeleter)
+		return
+	})
+	return sd, ok
+}
+
+// AsBulkLoader returns the store as BulkLoader, if it supports bulk loading.
+func AsBulkLoader(qs QuadStore) (BulkLoader, bool) {
+	var bl BulkLoader
+	ok := FeaturesOf(qs).BulkLoad && unwrap(qs, func(qs QuadStore) (ok bool) {
+		bl, ok = qs.(BulkLoader)
+		return
+	})
+	return bl, ok
+}
+
+// AsMaintainer returns the store as Maintainer, if it supports online compaction.
+func AsMaintainer(qs QuadStore) (Maintainer, bool) {
+	var m Maintainer
+	ok := FeaturesOf(qs).Compaction && unwrap(qs, func(qs QuadStore) (ok bool) {
+		m, ok = qs.(Maintainer)
+		return
+	})
+	return m, ok
+}
+
+// AsChecker returns the store as Checker, if it can verify consistency of its data.
+func AsChecker(qs QuadStore) (Checker, bool) {
+	var c Checker
+	ok := FeaturesOf(qs).Check && unwrap(qs, func(qs QuadStore) (ok bool) {
+		c, ok = qs.(Checker)
+		return
+	})
+	return c, ok
+}
+
+// AsTextIndexer returns the store as TextIndexer, if it supports full-text search.
+func AsTextIndexer(qs QuadStore) (TextIndexer, bool) {
+	var idx TextIndexer
+	ok := unwrap(qs, func(qs QuadStore) (ok bool) {
+		idx, ok = qs.(TextIndexer)
+		return
+	})
+	return idx, ok
+}
+
+// AsVectorIndexer returns the store as VectorIndexer, if it supports similarity search.
+func AsVectorIndexer(qs QuadStore) (VectorIndexer, bool) {
+	var idx VectorIndexer
+	ok := unwrap(qs, func(qs QuadStore) (ok bool) {
+		idx, ok = qs.(VectorIndexer)
+		return
+	})
+	return idx, ok
+}
@@ -0,0 +1,55 @@
+package graph_test
+
+import (
+	"context"
+	"testing"
+
+	"github.com/cayleygraph/cayley/graph"
+	"github.com/cayleygraph/cayley/graph/graphmock"
+)
+
+// versionedStore implements Versioned, but may report that horizons are not supported.
+type versionedStore struct {
+	graphmock.Store
+	features *graph.Features
+}
+
+func (qs *versionedStore) Horizon() int64 { return 1 }
+
+func (qs *versionedStore) ApplyDeltasSince(in []graph.Delta, opts graph.IgnoreOpts, horizon int64) error {
+	return qs.ApplyDeltas(in, opts)
+}
+
+func (qs *versionedStore) Compact(ctx context.Context) error { return nil }
+
+type reportingStore struct {
+	versionedStore
+}
+
+func (qs *reportingStore) Features() graph.Features { return *qs.features }
+
+func TestFeaturesOf(t *testing.T) {
+	if f := graph.FeaturesOf(&graphmock.Store{}); f != (graph.Features{}) {
+		t.Fatalf("unexpected features: %+v", f)
+	}
+
+	qs := &versionedStore{}
+	if f := graph.FeaturesOf(qs); f != (graph.Features{Horizons: true, Compaction: true}) {
+		t.Fatalf("unexpected features: %+v", f)
+	}
+	if _, ok := graph.AsVersioned(qs); !ok {
+		t.Fatal("expected a versioned store")
+	}
+
+	rs := &reportingStore{versionedStore{features: &graph.Features{Transactions: true}}}
+	if f := graph.FeaturesOf(rs); f != (graph.Features{Transactions: true}) {
+		t.Fatalf("unexpected features: %+v", f)
+	}
+	if _, ok := graph.AsVersioned(rs); ok {
+		t.Fatal("store does not support horizons")
+	}
+	rs.features.Horizons = true
+	if _, ok := graph.AsVersioned(rs); !ok {
+		t.Fatal("expected a versioned store")
+	}
+}
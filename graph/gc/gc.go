@@ -0,0 +1,158 @@
+// Copyright 2017 The Cayley Authors. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package gc implements background garbage collection for quad stores that
+// keep reference counters for nodes and cannot always remove unused entries
+// at the time quads are deleted.
+package gc
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/cayleygraph/cayley/clog"
+	"github.com/cayleygraph/cayley/graph"
+)
+
+// Sweeper is implemented by quad stores that can remove unreferenced nodes
+// and deleted quads in bulk.
+type Sweeper interface {
+	// Sweep removes nodes that are no longer referenced by any quad, as well as
+	// other garbage left after deletions. It returns the number of removed entries.
+	Sweep(ctx context.Context) (int64, error)
+}
+
+const (
+	// DefaultInterval is the default interval between sweeps.
+	DefaultInterval = time.Minute
+	// DefaultThreshold is the default number of deletions that triggers a sweep.
+	DefaultThreshold = 10000
+)
+
+// Options controls when a sweep is triggered.
+type Options struct {
+	// Interval is the maximal time between a deletion and a sweep that collects it.
+	// Zero disables background collection.
+	Interval time.Duration
+	// Threshold is the number of deletions that triggers a sweep before the interval ends.
+	// Zero means that sweeps are only triggered by the interval.
+	Threshold int
+}
+
+// OptionsFrom reads collector options from quad store options.
+//
+// Supported keys are "gc_interval" (a duration string) and "gc_threshold".
+func OptionsFrom(opts graph.Options) (Options, error) {
+	o := Options{Interval: DefaultInterval, Threshold: DefaultThreshold}
+	if s, err := opts.StringKey("gc_interval", ""); err != nil {
+		return o, err
+	} else if s != "" {
+		if o.Interval, err = time.ParseDuration(s); err != nil {
+			return o, err
+		}
+	}
+	var err error
+	o.Threshold, err = opts.IntKey("gc_threshold", o.Threshold)
+	return o, err
+}
+
+// Collector runs sweeps in background after deletions.
+type Collector struct {
+	s   Sweeper
+	opt Options
+
+	mu      sync.Mutex // serializes sweeps
+	pending chan int
+	once    sync.Once
+	stop    chan struct{}
+	done    chan struct{}
+}
+
+// New creates a collector for a given store and starts it.
+// Collector must be closed when the store is closed.
+func New(s Sweeper, opt Options) *Collector {
+	c := &Collector{s: s, opt: opt}
+	if opt.Interval > 0 {
+		c.pending = make(chan int, 1)
+		c.stop, c.done = make(chan struct{}), make(chan struct{})
+		go c.run()
+	}
+	return c
+}
+
+// Deleted notifies the collector that n references were removed from the store.
+// It never blocks.
+func (c *Collector) Deleted(n int) {
+	if c == nil || c.pending == nil || n <= 0 {
+		return
+	}
+	for {
+		select {
+		case c.pending <- n:
+			return
+		case m := <-c.pending:
+			n += m
+		}
+	}
+}
+
+// Sweep runs the sweep immediately.
+func (c *Collector) Sweep(ctx context.Context) (int64, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.s.Sweep(ctx)
+}
+
+func (c *Collector) run() {
+	defer close(c.done)
+	var (
+		deleted int
+		timer   <-chan time.Time
+	)
+	for {
+		select {
+		case <-c.stop:
+			return
+		case n := <-c.pending:
+			deleted += n
+			if timer == nil {
+				timer = time.After(c.opt.Interval)
+			}
+			if c.opt.Threshold <= 0 || deleted < c.opt.Threshold {
+				continue
+			}
+		case <-timer:
+		}
+		deleted, timer = 0, nil
+		n, err := c.Sweep(context.Background())
+		if err != nil {
+			clog.Errorf("gc: sweep failed: %v", err)
+		} else if n != 0 && clog.V(1) {
+			clog.Infof("gc: removed %d entries", n)
+		}
+	}
+}
+
+// Close stops the background collection.
+func (c *Collector) Close() error {
+	if c == nil || c.stop == nil {
+		return nil
+	}
+	c.once.Do(func() {
+		close(c.stop)
+		<-c.done
+	})
+	return nil
+}
@@ -0,0 +1,42 @@
+package gc
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+type sweeper chan struct{}
+
+func (s sweeper) Sweep(ctx context.Context) (int64, error) {
+	s <- struct{}{}
+	return 1, nil
+}
+
+func TestCollector(t *testing.T) {
+	s := make(sweeper, 10)
+	c := New(s, Options{Interval: time.Hour, Threshold: 3})
+	defer c.Close()
+
+	c.Deleted(2)
+	select {
+	case <-s:
+		t.Fatal("sweep before threshold")
+	case <-time.After(50 * time.Millisecond):
+	}
+	c.Deleted(1)
+	select {
+	case <-s:
+	case <-time.After(time.Second):
+		t.Fatal("no sweep after threshold")
+	}
+
+	c2 := New(s, Options{Interval: 10 * time.Millisecond})
+	defer c2.Close()
+	c2.Deleted(1)
+	select {
+	case <-s:
+	case <-time.After(time.Second):
+		t.Fatal("no sweep after interval")
+	}
+}
@@ -0,0 +1,180 @@
+package graphtest
+
+import (
+	"context"
+	"fmt"
+	"math/rand"
+	"testing"
+
+	"github.com/cayleygraph/cayley/graph"
+	"github.com/cayleygraph/cayley/graph/graphtest/gen"
+	"github.com/cayleygraph/cayley/graph/graphtest/testutil"
+	"github.com/cayleygraph/cayley/graph/path"
+	"github.com/cayleygraph/cayley/quad"
+	"github.com/stretchr/testify/require"
+)
+
+const (
+	benchNodes  = 2000 // number of nodes in the benchmark graph
+	benchDegree = 5    // number of links of each node
+	benchBatch  = 1000 // number of quads in a single write
+)
+
+// BenchmarkAll runs a standard set of benchmarks for a quad store: quad iterator scans, joins, writes and deletes.
+//
+// Benchmarks use a scale-free graph generated with gen.BarabasiAlbert, so results are comparable between backends.
+// A single database is created for the whole run, thus it is suitable for backends that are slow to set up.
+func BenchmarkAll(b *testing.B, gen testutil.DatabaseFunc, conf *Config) {
+	if conf == nil {
+		conf = &Config{}
+	}
+	qs, opts, closer := gen(b)
+	defer closer()
+	s := &benchStore{qs: qs, w: testutil.MakeWriter(b, qs, opts)}
+	for _, batch := range benchGraph(b) {
+		require.NoError(b, s.w.AddQuadSet(batch))
+	}
+	// write benchmarks go last, since they change the graph
+	for _, bt := range benchmarks {
+		b.Run(bt.name, func(b *testing.B) {
+			bt.bench(b, s, conf)
+		})
+	}
+}
+
+type benchStore struct {
+	qs      graph.QuadStore
+	w       graph.QuadWriter
+	batches int // number of generated batches
+}
+
+// uniqueBatch returns a batch of quads that are not present in the store.
+func (s *benchStore) uniqueBatch() []quad.Quad {
+	s.batches++
+	quads := make([]quad.Quad, 0, benchBatch)
+	for i := 0; i < benchBatch; i++ {
+		quads = append(quads, quad.Quad{
+			Subject:   quad.IRI(fmt.Sprintf("b%d-s%d", s.batches, i)),
+			Predicate: gen.Link,
+			Object:    quad.IRI(fmt.Sprintf("b%d-o%d", s.batches, i%10)),
+		})
+	}
+	return quads
+}
+
+var benchmarks = []struct {
+	name  string
+	bench func(b *testing.B, s *benchStore, conf *Config)
+}{
+	{"scan all", benchmarkScanAll},
+	{"quad iterator", benchmarkQuadIterator},
+	{"and", benchmarkAnd},
+	{"2-hop", benchmark2Hop},
+	{"write", benchmarkWrite},
+	{"delete", benchmarkDelete},
+}
+
+// benchGraph returns quads of the benchmark graph, split into batches.
+func benchGraph(t testing.TB) [][]quad.Quad {
+	quads, err := quad.ReadAll(gen.BarabasiAlbert(benchNodes, benchDegree, 1))
+	require.NoError(t, err)
+	var out [][]quad.Quad
+	for len(quads) > 0 {
+		n := benchBatch
+		if n > len(quads) {
+			n = len(quads)
+		}
+		out = append(out, quads[:n])
+		quads = quads[n:]
+	}
+	return out
+}
+
+func benchNode(rnd *rand.Rand) quad.Value {
+	return quad.IRI(fmt.Sprintf("n%d", rnd.Intn(benchNodes)))
+}
+
+// benchmarkWrite measures writes of new quads in batches.
+func benchmarkWrite(b *testing.B, s *benchStore, _ *Config) {
+	for i := 0; i < b.N; i++ {
+		b.StopTimer()
+		batch := s.uniqueBatch()
+		b.StartTimer()
+		require.NoError(b, s.w.AddQuadSet(batch))
+	}
+}
+
+// benchmarkDelete measures deletes of quad batches.
+func benchmarkDelete(b *testing.B, s *benchStore, _ *Config) {
+	for i := 0; i < b.N; i++ {
+		b.StopTimer()
+		batch := s.uniqueBatch()
+		require.NoError(b, s.w.AddQuadSet(batch))
+		tx := graph.NewTransaction()
+		for _, q := range batch {
+			tx.RemoveQuad(q)
+		}
+		b.StartTimer()
+		require.NoError(b, s.w.ApplyTransaction(tx))
+	}
+}
+
+// benchmarkScanAll measures a full scan of all quads.
+func benchmarkScanAll(b *testing.B, s *benchStore, _ *Config) {
+	qs := s.qs
+	ctx := context.TODO()
+	for i := 0; i < b.N; i++ {
+		it := qs.QuadsAllIterator()
+		n := 0
+		for it.Next(ctx) {
+			n++
+		}
+		require.NoError(b, it.Err())
+		it.Close()
+		if n == 0 {
+			b.Fatal("no quads")
+		}
+	}
+}
+
+// benchmarkQuadIterator measures lookups of quads by subject and object of random nodes.
+func benchmarkQuadIterator(b *testing.B, s *benchStore, _ *Config) {
+	qs := s.qs
+	ctx := context.TODO()
+	rnd := rand.New(rand.NewSource(1))
+	for i := 0; i < b.N; i++ {
+		v := qs.ValueOf(benchNode(rnd))
+		for _, d := range []quad.Direction{quad.Subject, quad.Object} {
+			it := qs.QuadIterator(d, v)
+			for it.Next(ctx) {
+			}
+			require.NoError(b, it.Err())
+			it.Close()
+		}
+	}
+}
+
+// benchmarkAnd measures a join of nodes that link to two random nodes.
+func benchmarkAnd(b *testing.B, s *benchStore, _ *Config) {
+	qs := s.qs
+	ctx := context.TODO()
+	rnd := rand.New(rand.NewSource(1))
+	for i := 0; i < b.N; i++ {
+		p := path.StartPath(qs, benchNode(rnd)).In(gen.Link).
+			And(path.StartPath(qs, benchNode(rnd)).In(gen.Link))
+		_, err := p.Iterate(ctx).Count()
+		require.NoError(b, err)
+	}
+}
+
+// benchmark2Hop measures a traversal to nodes two links away from a random node.
+func benchmark2Hop(b *testing.B, s *benchStore, _ *Config) {
+	qs := s.qs
+	ctx := context.TODO()
+	rnd := rand.New(rand.NewSource(1))
+	for i := 0; i < b.N; i++ {
+		p := path.StartPath(qs, benchNode(rnd)).Out(gen.Link).Out(gen.Link)
+		_, err := p.Iterate(ctx).Count()
+		require.NoError(b, err)
+	}
+}
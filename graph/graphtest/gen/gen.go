@@ -0,0 +1,104 @@
+// Package gen generates large synthetic graphs for load testing and reproducible benchmarks.
+//
+// All generators are deterministic: the same parameters and seed always produce the same sequence of quads.
+// Quads are generated on the fly, so graphs of any size can be written without holding them in memory.
+package gen
+
+import (
+	"io"
+	"math/rand"
+	"strconv"
+
+	"github.com/cayleygraph/cayley/quad"
+)
+
+// Link is a predicate used for edges of generated graphs that have no specific semantics.
+const Link = quad.IRI("link")
+
+// reader is a quad.Reader that calls a step function to generate quads into the buffer.
+type reader struct {
+	buf  []quad.Quad
+	step func(buf []quad.Quad) ([]quad.Quad, bool)
+	done bool
+}
+
+func (r *reader) ReadQuad() (quad.Quad, error) {
+	for len(r.buf) == 0 {
+		if r.done {
+			return quad.Quad{}, io.EOF
+		}
+		var more bool
+		r.buf, more = r.step(r.buf[:0])
+		r.done = !more
+	}
+	q := r.buf[0]
+	r.buf = r.buf[1:]
+	return q, nil
+}
+
+func node(prefix string, i int) quad.IRI {
+	return quad.IRI(prefix + strconv.Itoa(i))
+}
+
+// preferential implements Barabási–Albert preferential attachment: each new node is linked to m distinct
+// existing nodes, chosen with probability proportional to their degree.
+type preferential struct {
+	m       int
+	rnd     *rand.Rand
+	n       int     // number of added nodes
+	targets []int32 // each node is repeated once per its edge
+	picked  map[int]struct{}
+}
+
+func newPreferential(m int, rnd *rand.Rand) *preferential {
+	if m < 1 {
+		m = 1
+	}
+	return &preferential{m: m, rnd: rnd, picked: make(map[int]struct{}, m)}
+}
+
+// add adds a new node and returns its index and the nodes it links to.
+// First m nodes are linked to all previous nodes.
+func (p *preferential) add(dst []int) (int, []int) {
+	cur := p.n
+	p.n++
+	if cur <= p.m {
+		for i := 0; i < cur; i++ {
+			dst = append(dst, i)
+		}
+	} else {
+		for k := range p.picked {
+			delete(p.picked, k)
+		}
+		for len(p.picked) < p.m {
+			t := int(p.targets[p.rnd.Intn(len(p.targets))])
+			if _, ok := p.picked[t]; ok {
+				continue
+			}
+			p.picked[t] = struct{}{}
+			dst = append(dst, t)
+		}
+	}
+	for _, t := range dst {
+		p.targets = append(p.targets, int32(t), int32(cur))
+	}
+	return cur, dst
+}
+
+// BarabasiAlbert returns a scale-free graph with n nodes, where each new node links to m existing nodes
+// with Barabási–Albert preferential attachment. Nodes are named <n0>, <n1>, etc. and linked with Link predicate.
+func BarabasiAlbert(n, m int, seed int64) quad.Reader {
+	p := newPreferential(m, rand.New(rand.NewSource(seed)))
+	var links []int
+	return &reader{step: func(buf []quad.Quad) ([]quad.Quad, bool) {
+		if p.n >= n {
+			return buf, false
+		}
+		var cur int
+		cur, links = p.add(links[:0])
+		for _, t := range links {
+			buf = append(buf, quad.Quad{Subject: node("n", cur), Predicate: Link, Object: node("n", t)})
+		}
+		return buf, p.n < n
+	}}
+}
@@ -0,0 +1,50 @@
+package gen
+
+import (
+	"testing"
+
+	"github.com/cayleygraph/cayley/quad"
+	"github.com/cayleygraph/cayley/voc/rdf"
+	"github.com/stretchr/testify/require"
+)
+
+func TestBarabasiAlbert(t *testing.T) {
+	const n, m = 1000, 3
+	quads, err := quad.ReadAll(BarabasiAlbert(n, m, 1))
+	require.NoError(t, err)
+	// first m nodes are linked to all previous nodes
+	require.Len(t, quads, m*(m-1)/2+(n-m)*m)
+
+	seen := make(map[quad.Quad]struct{})
+	degree := make(map[quad.Value]int)
+	for _, q := range quads {
+		require.NotEqual(t, q.Subject, q.Object)
+		seen[q] = struct{}{}
+		degree[q.Object]++
+	}
+	require.Len(t, seen, len(quads), "duplicate links")
+	require.True(t, degree[quad.IRI("n0")] > 5*m, "hubs are expected to appear")
+
+	again, err := quad.ReadAll(BarabasiAlbert(n, m, 1))
+	require.NoError(t, err)
+	require.Equal(t, quads, again)
+}
+
+func TestSocialNetwork(t *testing.T) {
+	c := DefaultSocial(200)
+	quads, err := quad.ReadAll(c.SocialNetwork())
+	require.NoError(t, err)
+
+	types := make(map[quad.Value]int)
+	for _, q := range quads {
+		if q.Predicate == quad.IRI(rdf.Type) {
+			types[q.Object]++
+		}
+	}
+	require.Equal(t, c.Persons, types[Person])
+	require.True(t, types[Post] > 0)
+
+	again, err := quad.ReadAll(c.SocialNetwork())
+	require.NoError(t, err)
+	require.Equal(t, quads, again)
+}
@@ -0,0 +1,116 @@
+package gen
+
+import (
+	"math/rand"
+	"strconv"
+	"time"
+
+	"github.com/cayleygraph/cayley/quad"
+	"github.com/cayleygraph/cayley/voc/rdf"
+)
+
+// Vocabulary of the social network dataset.
+const (
+	Person  = quad.IRI("Person")
+	Post    = quad.IRI("Post")
+	Name    = quad.IRI("name")
+	Born    = quad.IRI("birthday")
+	LivesIn = quad.IRI("livesIn")
+	Knows   = quad.IRI("knows")
+	Creator = quad.IRI("hasCreator")
+	Created = quad.IRI("creationDate")
+	HasTag  = quad.IRI("hasTag")
+	Likes   = quad.IRI("likes")
+)
+
+// Social describes parameters of a social network dataset, similar to LDBC Social Network Benchmark.
+type Social struct {
+	Persons int // number of persons
+	Knows   int // number of persons each new person knows; friendships follow power-law degree distribution
+	Posts   int // average number of posts created by each person
+	Likes   int // average number of likes of each post
+	Cities  int // number of cities
+	Tags    int // number of tags; tag popularity follows Zipf distribution
+	Seed    int64
+}
+
+// DefaultSocial returns parameters of a social network with a given number of persons.
+func DefaultSocial(persons int) Social {
+	return Social{
+		Persons: persons,
+		Knows:   5,
+		Posts:   3,
+		Likes:   2,
+		Cities:  persons/1000 + 1,
+		Tags:    persons/100 + 10,
+		Seed:    1,
+	}
+}
+
+var (
+	firstNames = []string{"Alice", "Bob", "Carol", "Dave", "Eve", "Frank", "Grace", "Heidi", "Ivan", "Judy", "Mallory", "Oscar", "Peggy", "Trent", "Victor", "Walter"}
+	lastNames  = []string{"Smith", "Johnson", "Williams", "Brown", "Jones", "Garcia", "Miller", "Davis", "Lopez", "Wilson", "Anderson", "Taylor"}
+
+	epoch = time.Date(2010, 1, 1, 0, 0, 0, 0, time.UTC)
+)
+
+// SocialNetwork returns an LDBC-like social network: persons with names, birthdays and cities,
+// who know each other, create posts with tags and like posts of other persons.
+// Persons are generated first, followed by their posts.
+func (c Social) SocialNetwork() quad.Reader {
+	rnd := rand.New(rand.NewSource(c.Seed))
+	p := newPreferential(c.Knows, rnd)
+	var tags *rand.Zipf
+	if c.Tags > 1 {
+		tags = rand.NewZipf(rnd, 1.1, 1, uint64(c.Tags-1))
+	}
+	var (
+		links []int
+		post  int
+		cur   int // current person in posts phase
+	)
+	typ := quad.IRI(rdf.Type)
+	return &reader{step: func(buf []quad.Quad) ([]quad.Quad, bool) {
+		if p.n < c.Persons {
+			var i int
+			i, links = p.add(links[:0])
+			s := node("person", i)
+			name := firstNames[rnd.Intn(len(firstNames))] + " " + lastNames[rnd.Intn(len(lastNames))]
+			born := epoch.AddDate(-18-rnd.Intn(60), 0, -rnd.Intn(365))
+			buf = append(buf,
+				quad.Quad{Subject: s, Predicate: typ, Object: Person},
+				quad.Quad{Subject: s, Predicate: Name, Object: quad.String(name)},
+				quad.Quad{Subject: s, Predicate: Born, Object: quad.Time(born)},
+			)
+			if c.Cities > 0 {
+				buf = append(buf, quad.Quad{Subject: s, Predicate: LivesIn, Object: node("city", rnd.Intn(c.Cities))})
+			}
+			for _, t := range links {
+				buf = append(buf, quad.Quad{Subject: s, Predicate: Knows, Object: node("person", t)})
+			}
+			return buf, true
+		}
+		if cur >= c.Persons || c.Posts <= 0 {
+			return buf, false
+		}
+		creator := node("person", cur)
+		cur++
+		for n := rnd.Intn(2*c.Posts + 1); n > 0; n-- {
+			s := node("post", post)
+			post++
+			created := epoch.Add(time.Duration(rnd.Int63n(int64(5 * 365 * 24 * time.Hour))))
+			buf = append(buf,
+				quad.Quad{Subject: s, Predicate: typ, Object: Post},
+				quad.Quad{Subject: s, Predicate: Creator, Object: creator},
+				quad.Quad{Subject: s, Predicate: Created, Object: quad.Time(created)},
+			)
+			if tags != nil {
+				buf = append(buf, quad.Quad{Subject: s, Predicate: HasTag, Object: quad.IRI("tag" + strconv.FormatUint(tags.Uint64(), 10))})
+			}
+			for k := rnd.Intn(2*c.Likes + 1); k > 0; k-- {
+				buf = append(buf, quad.Quad{Subject: node("person", rnd.Intn(c.Persons)), Predicate: Likes, Object: s})
+			}
+		}
+		return buf, cur < c.Persons
+	}}
+}
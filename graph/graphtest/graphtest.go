@@ -2,6 +2,7 @@ package graphtest
 
 import (
 	"context"
+	"fmt"
 	"sort"
 	"testing"
 	"time"
@@ -32,6 +33,13 @@ type Config struct {
 	SkipSizeCheckAfterDelete bool
 	// TODO(dennwc): these stores are not garbage-collecting nodes after quad removal
 	SkipNodeDelAfterQuadDel bool
+
+	// Reopen enables durability tests. It must close the quad store and open it again from the same storage.
+	// If kill is set, the store should be released without a clean shutdown to emulate a crash.
+	// Backends that cannot do this should return ErrOperationNotSupported, and the case is skipped.
+	// The test closes the reopened store, but the closer returned by the database function is still called,
+	// thus it should tolerate the original store being closed already.
+	Reopen func(t testing.TB, qs graph.QuadStore, kill bool) (graph.QuadStore, error)
 }
 
 var graphTests = []struct {
@@ -48,9 +56,11 @@ var graphTests = []struct {
 	{"load typed quad", TestLoadTypedQuads},
 	{"add and remove", TestAddRemove},
 	{"node delete", TestNodeDelete},
+	{"replace and set quad", TestReplaceSetQuad},
 	{"iterators and next result order", TestIteratorsAndNextResultOrderA},
 	{"compare typed values", TestCompareTypedValues},
 	{"schema", TestSchema},
+	{"reopen", TestReopen},
 }
 
 func TestAll(t *testing.T, gen testutil.DatabaseFunc, conf *Config) {
@@ -857,6 +867,47 @@ func TestNodeDelete(t testing.TB, gen testutil.DatabaseFunc, conf *Config) {
 	})
 }
 
+func TestReplaceSetQuad(t testing.TB, gen testutil.DatabaseFunc, conf *Config) {
+	qs, opts, closer := gen(t)
+	defer closer()
+
+	w := testutil.MakeWriter(t, qs, opts, MakeQuadSet()...)
+
+	exp := MakeQuadSet()
+	remove := func(del quad.Quad) {
+		for i, q := range exp {
+			if q == del {
+				exp = append(exp[:i], exp[i+1:]...)
+				return
+			}
+		}
+	}
+
+	old, nq := quad.Make("E", "follows", "F", nil), quad.Make("E", "follows", "A", nil)
+	err := w.ReplaceQuad(old, nq)
+	require.NoError(t, err)
+	remove(old)
+	exp = append(exp, nq)
+	ExpectIteratedQuads(t, qs, qs.QuadsAllIterator(), exp, true)
+
+	// C follows B and D, only D should remain
+	err = w.SetQuad(quad.Raw("C"), quad.Raw("follows"), quad.Raw("D"), nil)
+	require.NoError(t, err)
+	remove(quad.Make("C", "follows", "B", nil))
+	ExpectIteratedQuads(t, qs, qs.QuadsAllIterator(), exp, true)
+
+	// quads with other labels are not affected
+	err = w.SetQuad(quad.Raw("B"), quad.Raw("status"), quad.Raw("uncool"), nil)
+	require.NoError(t, err)
+	exp = append(exp, quad.Make("B", "status", "uncool", nil))
+	ExpectIteratedQuads(t, qs, qs.QuadsAllIterator(), exp, true)
+
+	// setting an existing value is a no-op
+	err = w.SetQuad(quad.Raw("B"), quad.Raw("status"), quad.Raw("cool"), quad.Raw("status_graph"))
+	require.NoError(t, err)
+	ExpectIteratedQuads(t, qs, qs.QuadsAllIterator(), exp, true)
+}
+
 func TestSchema(t testing.TB, gen testutil.DatabaseFunc, conf *Config) {
 	qs, opts, closer := gen(t)
 	defer closer()
@@ -886,3 +937,57 @@ func TestSchema(t testing.TB, gen testutil.DatabaseFunc, conf *Config) {
 	require.NoError(t, err)
 	require.Equal(t, p, p2)
 }
+
+func TestReopen(t testing.TB, gen testutil.DatabaseFunc, conf *Config) {
+	if conf.Reopen == nil {
+		t.SkipNow()
+	}
+	qs, opts, closer := gen(t)
+	defer closer()
+
+	w := testutil.MakeWriter(t, qs, opts, MakeQuadSet()...)
+	// deletions must be persisted as well
+	err := w.RemoveQuad(MakeQuadSet()[0])
+	require.NoError(t, err)
+
+	reopened := false
+	defer func() {
+		if reopened {
+			qs.Close()
+		}
+	}()
+	for i, kill := range []bool{false, true} {
+		size := qs.Size()
+		quads := IteratedQuads(t, qs, qs.QuadsAllIterator())
+		var horizon int64
+		if v, ok := graph.AsVersioned(qs); ok {
+			horizon = v.Horizon()
+		}
+
+		nqs, err := conf.Reopen(t, qs, kill)
+		if err == graph.ErrOperationNotSupported {
+			t.Logf("reopen is not supported, kill: %v", kill)
+			continue
+		}
+		require.NoError(t, err, "kill: %v", kill)
+		qs, reopened = nqs, true
+
+		if !conf.SkipSizeCheckAfterDelete {
+			require.Equal(t, size, qs.Size(), "kill: %v", kill)
+		}
+		require.Equal(t, quads, IteratedQuads(t, qs, qs.QuadsAllIterator()), "kill: %v", kill)
+		if v, ok := graph.AsVersioned(qs); ok {
+			require.True(t, v.Horizon() >= horizon, "horizon moved back after reopen: %d vs %d", v.Horizon(), horizon)
+		}
+		if c, ok := graph.AsChecker(qs); ok {
+			problems, err := c.Check(context.TODO(), false)
+			require.NoError(t, err)
+			require.Len(t, problems, 0, "kill: %v", kill)
+		}
+
+		// store must accept writes after reopening
+		w = testutil.MakeWriter(t, qs, opts)
+		err = w.AddQuad(quad.Make("H", "follows", fmt.Sprintf("reopen%d", i), nil))
+		require.NoError(t, err)
+	}
+}
@@ -1,11 +1,14 @@
 package testutil
 
 import (
+	"context"
 	"os"
 	"path/filepath"
+	"sort"
 	"testing"
 
 	"github.com/cayleygraph/cayley/graph"
+	"github.com/cayleygraph/cayley/graph/path"
 	"github.com/cayleygraph/cayley/quad"
 	"github.com/cayleygraph/cayley/quad/nquads"
 	"github.com/cayleygraph/cayley/writer"
@@ -48,3 +51,21 @@ func MakeWriter(t testing.TB, qs graph.QuadStore, opts graph.Options, data ...qu
 	}
 	return w
 }
+
+// Collect returns sorted unique string values of all results of the path. See quad.ToString.
+func Collect(t testing.TB, p *path.Path) []string {
+	vals, err := p.Iterate(context.TODO()).Paths(false).AllValues(nil)
+	require.NoError(t, err)
+	seen := make(map[string]struct{})
+	var out []string
+	for _, v := range vals {
+		s := quad.ToString(v)
+		if _, ok := seen[s]; ok {
+			continue
+		}
+		seen[s] = struct{}{}
+		out = append(out, s)
+	}
+	sort.Strings(out)
+	return out
+}
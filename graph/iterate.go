@@ -4,6 +4,7 @@ import (
 	"context"
 	"encoding/json"
 	"fmt"
+	"time"
 
 	"github.com/cayleygraph/cayley/clog"
 	"github.com/cayleygraph/cayley/quad"
@@ -20,11 +21,19 @@ type IterateChain struct {
 
 	limit int
 	n     int
+
+	started time.Time
+
+	cancel context.CancelFunc // cancels the iteration if a value cannot be loaded
+	err    error              // error of loading a value
 }
 
 // Iterate is a set of helpers for iteration. Context may be used to cancel execution.
 // Iterator will be optimized and closed after execution.
 //
+// MaxResults of query Limits in the context is not applied by the chain, since the chain may be a part of
+// a larger query; it is applied by the code that returns results to the client. See Limits.
+//
 // By default, iteration has no limit and includes sub-paths.
 func Iterate(ctx context.Context, it Iterator) *IterateChain {
 	if ctx == nil {
@@ -60,7 +69,40 @@ func (c *IterateChain) nextPath() bool {
 	}
 	return ok
 }
+
+// batchSize is the number of results requested from BatchIterator at once.
+const batchSize = 64
+
+// nextBatch is a batched version of next. It must only be used if sub-paths are disabled.
+func (c *IterateChain) nextBatch(dst []Value) int {
+	select {
+	case <-c.ctx.Done():
+		return 0
+	default:
+	}
+	n := len(dst)
+	if c.limit >= 0 && c.limit-c.n < n {
+		n = c.limit - c.n
+	}
+	if n <= 0 {
+		return 0
+	}
+	n = NextBatch(c.ctx, c.it, dst[:n])
+	c.n += n
+	return n
+}
+
+// batched checks if results can be read in batches.
+func (c *IterateChain) batched() bool {
+	if c.paths {
+		return false
+	}
+	_, ok := c.it.(BatchIterator)
+	return ok
+}
+
 func (c *IterateChain) start() {
+	c.started = time.Now()
 	if c.optimize {
 		c.it, _ = c.it.Optimize()
 		if c.qs != nil {
@@ -78,6 +120,7 @@ func (c *IterateChain) start() {
 }
 func (c *IterateChain) end() {
 	c.it.Close()
+	logSlowQuery(c.ctx, c.it, time.Since(c.started))
 	if !clog.V(2) {
 		return
 	}
@@ -117,6 +160,15 @@ func (c *IterateChain) UnOptimized() *IterateChain {
 func (c *IterateChain) Each(fnc func(Value)) error {
 	c.start()
 	defer c.end()
+	if c.batched() {
+		buf := make([]Value, batchSize)
+		for n := c.nextBatch(buf); n != 0; n = c.nextBatch(buf) {
+			for _, v := range buf[:n] {
+				fnc(v)
+			}
+		}
+		return c.it.Err()
+	}
 	done := c.ctx.Done()
 
 	for c.next() {
@@ -174,8 +226,15 @@ iteration:
 func (c *IterateChain) All() ([]Value, error) {
 	c.start()
 	defer c.end()
-	done := c.ctx.Done()
 	var out []Value
+	if c.batched() {
+		buf := make([]Value, batchSize)
+		for n := c.nextBatch(buf); n != 0; n = c.nextBatch(buf) {
+			out = append(out, buf[:n]...)
+		}
+		return out, c.it.Err()
+	}
+	done := c.ctx.Done()
 iteration:
 	for c.next() {
 		select {
@@ -266,40 +325,106 @@ func (c *IterateChain) TagEach(fnc func(map[string]Value)) error {
 	return c.it.Err()
 }
 
+// TagPathsEach will run a provided callback for each result of the iterator with tag maps of all sub-paths
+// to that result. Unlike TagEach, the limit applies to the number of results, not the number of sub-paths.
+//
+// Note that the iterator may return the same result multiple times.
+func (c *IterateChain) TagPathsEach(fnc func(Value, []map[string]Value)) error {
+	c.start()
+	defer c.end()
+	done := c.ctx.Done()
+
+	for c.next() {
+		select {
+		case <-done:
+			return c.ctx.Err()
+		default:
+		}
+		res := c.it.Result()
+		tags := make(map[string]Value)
+		c.it.TagResults(tags)
+		paths := []map[string]Value{tags}
+		for c.paths && c.it.NextPath(c.ctx) {
+			select {
+			case <-done:
+				return c.ctx.Err()
+			default:
+			}
+			tags := make(map[string]Value, len(tags))
+			c.it.TagResults(tags)
+			paths = append(paths, tags)
+		}
+		fnc(res, paths)
+	}
+	return c.it.Err()
+}
+
 var errNoQuadStore = fmt.Errorf("no quad store in Iterate")
 
-// EachValue is an analog of Each, but it will additionally call NameOf
-// for each graph.Value before passing it to a callback.
-func (c *IterateChain) EachValue(qs QuadStore, fnc func(quad.Value)) error {
+// loadValues prepares the chain to load values from the quad store with nameOf.
+// Returned function must be called when the iteration is done.
+func (c *IterateChain) loadValues(qs QuadStore) (context.CancelFunc, error) {
 	if qs != nil {
 		c.qs = qs
 	}
 	if c.qs == nil {
-		return errNoQuadStore
+		return nil, errNoQuadStore
+	}
+	c.ctx, c.cancel = context.WithCancel(c.ctx)
+	return c.cancel, nil
+}
+
+// nameOf loads a value with the context of the iteration, thus the request to the quad store is cancelled
+// with the iteration. The first error stops the iteration, and is returned by valuesErr.
+func (c *IterateChain) nameOf(v Value) quad.Value {
+	nv, err := NameOf(c.ctx, c.qs, v)
+	if err != nil && c.err == nil {
+		c.err = err
+		c.cancel()
+	}
+	return nv
+}
+
+// valuesErr returns an error of loading values, or a given iteration error.
+func (c *IterateChain) valuesErr(err error) error {
+	if c.err != nil {
+		return c.err
+	}
+	return err
+}
+
+// EachValue is an analog of Each, but it will additionally call NameOf
+// for each graph.Value before passing it to a callback.
+func (c *IterateChain) EachValue(qs QuadStore, fnc func(quad.Value)) error {
+	cancel, err := c.loadValues(qs)
+	if err != nil {
+		return err
 	}
+	defer cancel()
 	// TODO(dennwc): batch NameOf?
-	return c.Each(func(v Value) {
-		if nv := c.qs.NameOf(v); nv != nil {
+	err = c.Each(func(v Value) {
+		if nv := c.nameOf(v); nv != nil {
 			fnc(nv)
 		}
 	})
+	return c.valuesErr(err)
 }
 
 // EachValuePair is an analog of Each, but it will additionally call NameOf
 // for each graph.Value before passing it to a callback. Original value will be passed as well.
 func (c *IterateChain) EachValuePair(qs QuadStore, fnc func(Value, quad.Value)) error {
-	if qs != nil {
-		c.qs = qs
-	}
-	if c.qs == nil {
-		return errNoQuadStore
+	cancel, err := c.loadValues(qs)
+	if err != nil {
+		return err
 	}
+	defer cancel()
 	// TODO(dennwc): batch NameOf?
-	return c.Each(func(v Value) {
-		if nv := c.qs.NameOf(v); nv != nil {
+	err = c.Each(func(v Value) {
+		if nv := c.nameOf(v); nv != nil {
 			fnc(v, nv)
 		}
 	})
+	return c.valuesErr(err)
 }
 
 // AllValues is an analog of All, but it will additionally call NameOf
@@ -324,8 +449,7 @@ func (c *IterateChain) FirstValue(qs QuadStore) (quad.Value, error) {
 	if err != nil || v == nil {
 		return nil, err
 	}
-	// TODO: return an error from NameOf once we have it exposed
-	return c.qs.NameOf(v), nil
+	return NameOf(c.ctx, c.qs, v)
 }
 
 // SendValues is an analog of Send, but it will additionally call NameOf
@@ -341,14 +465,16 @@ func (c *IterateChain) SendValues(qs QuadStore, out chan<- quad.Value) error {
 	defer c.end()
 	done := c.ctx.Done()
 	send := func(v Value) error {
-		nv := c.qs.NameOf(c.it.Result())
-		if nv == nil {
+		nv, err := NameOf(c.ctx, c.qs, v)
+		if err != nil {
+			return err
+		} else if nv == nil {
 			return nil
 		}
 		select {
 		case <-done:
 			return c.ctx.Err()
-		case out <- c.qs.NameOf(c.it.Result()):
+		case out <- nv:
 		}
 		return nil
 	}
@@ -368,17 +494,19 @@ func (c *IterateChain) SendValues(qs QuadStore, out chan<- quad.Value) error {
 // TagValues is an analog of TagEach, but it will additionally call NameOf
 // for each graph.Value before passing the map to a callback.
 func (c *IterateChain) TagValues(qs QuadStore, fnc func(map[string]quad.Value)) error {
-	if qs != nil {
-		c.qs = qs
+	cancel, err := c.loadValues(qs)
+	if err != nil {
+		return err
 	}
-	if c.qs == nil {
-		return errNoQuadStore
-	}
-	return c.TagEach(func(m map[string]Value) {
+	defer cancel()
+	err = c.TagEach(func(m map[string]Value) {
 		vm := make(map[string]quad.Value, len(m))
 		for k, v := range m {
-			vm[k] = c.qs.NameOf(v) // TODO(dennwc): batch NameOf?
+			vm[k] = c.nameOf(v) // TODO(dennwc): batch NameOf?
+		}
+		if c.err == nil {
+			fnc(vm)
 		}
-		fnc(vm)
 	})
+	return c.valuesErr(err)
 }
@@ -215,6 +215,32 @@ type NoNext interface {
 	NoNext()
 }
 
+// BatchIterator is an optional interface for iterators that can return multiple results at once.
+type BatchIterator interface {
+	Iterator
+	// NextBatch advances the iterator and writes up to len(dst) results to dst.
+	// It returns the number of results written, or zero if no further advancement
+	// is possible. Err should be consulted to distinguish it from an error.
+	//
+	// Results returned this way are not tagged and NextPath should not be called
+	// for them. After the call, Result returns the last value written to dst.
+	NextBatch(ctx context.Context, dst []Value) int
+}
+
+// NextBatch advances an iterator and writes up to len(dst) results to dst.
+// It uses BatchIterator if implemented, and calls Next for each result otherwise.
+func NextBatch(ctx context.Context, it Iterator, dst []Value) int {
+	if bit, ok := it.(BatchIterator); ok {
+		return bit.NextBatch(ctx, dst)
+	}
+	n := 0
+	for n < len(dst) && it.Next(ctx) {
+		dst[n] = it.Result()
+		n++
+	}
+	return n
+}
+
 // Height is a convienence function to measure the height of an iterator tree.
 func Height(it Iterator, until Type) int {
 	if it.Type() == until {
@@ -268,8 +294,17 @@ const (
 	Limit       = Type("limit")
 	Skip        = Type("skip")
 	Regex       = Type("regexp")
+	Language    = Type("language")
+	ValueFilter = Type("value_filter")
 	Count       = Type("count")
 	Recursive   = Type("recursive")
+
+	ProvenanceTags = Type("provenance")
+	View           = Type("view")
+	Overlay        = Type("overlay")
+	Remote         = Type("remote")
+	Virtual        = Type("virtual")
+	TextSearch     = Type("text_search")
 )
 
 // String returns a string representation of the Type.
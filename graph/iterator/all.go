@@ -102,7 +102,7 @@ func (it *Int64) String() string {
 func (it *Int64) Next(ctx context.Context) bool {
 	graph.NextLogIn(it)
 	it.runstats.Next += 1
-	if it.at == -1 {
+	if it.at == -1 || !graph.ScanPrimitive(ctx) {
 		return graph.NextLogOut(it, false)
 	}
 	val := it.at
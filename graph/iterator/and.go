@@ -21,7 +21,7 @@ import (
 	"github.com/cayleygraph/cayley/graph"
 )
 
-var _ graph.Iterator = &And{}
+var _ graph.BatchIterator = &And{}
 
 // The And iterator. Consists of a number of subiterators, the primary of which will
 // be Next()ed if next is called.
@@ -144,6 +144,29 @@ func (it *And) Next(ctx context.Context) bool {
 	return graph.NextLogOut(it, false)
 }
 
+// NextBatch reads a batch of results from the primary iterator and filters them in place.
+func (it *And) NextBatch(ctx context.Context, dst []graph.Value) int {
+	n := 0
+	for n < len(dst) {
+		m := graph.NextBatch(ctx, it.primaryIt, dst[n:])
+		if m == 0 {
+			it.err = it.primaryIt.Err()
+			break
+		}
+		for _, v := range dst[n : n+m] {
+			if it.subItsContain(ctx, v, nil) {
+				dst[n] = v
+				n++
+			}
+		}
+	}
+	it.runstats.Next += int64(n)
+	if n > 0 {
+		it.result = dst[n-1]
+	}
+	return n
+}
+
 func (it *And) Err() error {
 	if err := it.err; err != nil {
 		return err
@@ -165,6 +188,12 @@ func (it *And) Result() graph.Value {
 
 // Checks a value against the non-primary iterators, in order.
 func (it *And) subItsContain(ctx context.Context, val graph.Value, lastResult graph.Value) bool {
+	if len(it.internalIterators) > 1 {
+		if n := graph.AcquireWorkers(ctx, len(it.internalIterators)-1); n > 0 {
+			defer graph.ReleaseWorkers(ctx, n)
+			return it.subItsContainParallel(ctx, n, val, lastResult)
+		}
+	}
 	var subIsGood = true
 	for i, sub := range it.internalIterators {
 		subIsGood = sub.Contains(ctx, val)
@@ -180,6 +209,28 @@ func (it *And) subItsContain(ctx context.Context, val graph.Value, lastResult gr
 	return subIsGood
 }
 
+// subItsContainParallel is the same as subItsContain, but checks all subiterators concurrently,
+// using n additional goroutines.
+func (it *And) subItsContainParallel(ctx context.Context, n int, val graph.Value, lastResult graph.Value) bool {
+	subs := it.internalIterators
+	good := make([]bool, len(subs))
+	parallelDo(n, len(subs), func(i int) {
+		good[i] = subs[i].Contains(ctx, val)
+	})
+	for _, ok := range good {
+		if ok {
+			continue
+		}
+		if lastResult != nil {
+			parallelDo(n, len(subs), func(i int) {
+				subs[i].Contains(ctx, lastResult)
+			})
+		}
+		return false
+	}
+	return true
+}
+
 func (it *And) checkContainsList(ctx context.Context, val graph.Value, lastResult graph.Value) bool {
 	ok := true
 	for i, c := range it.checkList {
@@ -17,6 +17,7 @@ package iterator_test
 import (
 	"context"
 	"errors"
+	"reflect"
 	"testing"
 
 	"github.com/cayleygraph/cayley/graph"
@@ -181,3 +182,82 @@ func TestAndIteratorErr(t *testing.T) {
 		t.Errorf("And iterator did not pass through underlying Err")
 	}
 }
+
+func TestAndNextBatch(t *testing.T) {
+	ctx := context.TODO()
+	qs := &graphmock.Oldstore{
+		Data: []string{},
+		Iter: NewFixed(),
+	}
+	fix1 := NewFixed(
+		Int64Node(1),
+		Int64Node(2),
+		Int64Node(3),
+		Int64Node(4),
+		Int64Node(5),
+	)
+	fix2 := NewFixed(
+		Int64Node(2),
+		Int64Node(4),
+		Int64Node(5),
+	)
+	and := NewAnd(qs, fix1, fix2)
+
+	var got []graph.Value
+	buf := make([]graph.Value, 2)
+	for n := graph.NextBatch(ctx, and, buf); n != 0; n = graph.NextBatch(ctx, and, buf) {
+		got = append(got, buf[:n]...)
+	}
+	if err := and.Err(); err != nil {
+		t.Fatal(err)
+	}
+	expect := []graph.Value{Int64Node(2), Int64Node(4), Int64Node(5)}
+	if len(got) != len(expect) {
+		t.Fatalf("unexpected results: %v", got)
+	}
+	for i := range expect {
+		if got[i] != expect[i] {
+			t.Errorf("unexpected result %d: %v vs %v", i, got[i], expect[i])
+		}
+	}
+	if and.Result() != Int64Node(5) {
+		t.Errorf("unexpected last result: %v", and.Result())
+	}
+}
+
+func TestAndIteratorParallel(t *testing.T) {
+	ctx := graph.WithParallelism(context.TODO(), 4)
+	qs := &graphmock.Oldstore{
+		Data: []string{},
+		Iter: NewFixed(),
+	}
+	primary := NewInt64(1, 20, true)
+	sub1 := NewFixed(Int64Node(2), Int64Node(3), Int64Node(5), Int64Node(8), Int64Node(13))
+	sub1.Tagger().Add("a")
+	sub2 := NewInt64(3, 13, true)
+	sub3 := NewFixed(Int64Node(1), Int64Node(3), Int64Node(5), Int64Node(13), Int64Node(21))
+	sub3.Tagger().Add("b")
+	and := NewAnd(qs, primary, sub1, sub2, sub3)
+
+	var got []int
+	for and.Next(ctx) {
+		v := and.Result().(Int64Node)
+		got = append(got, int(v))
+		tags := make(map[string]graph.Value)
+		and.TagResults(tags)
+		if tags["a"] != v || tags["b"] != v {
+			t.Errorf("unexpected tags for %d: %v", v, tags)
+		}
+	}
+	if exp := []int{3, 5, 13}; !reflect.DeepEqual(got, exp) {
+		t.Errorf("unexpected results: %v vs %v", got, exp)
+	}
+	if and.Contains(ctx, Int64Node(8)) || !and.Contains(ctx, Int64Node(5)) {
+		t.Errorf("unexpected Contains results")
+	}
+	if n := graph.AcquireWorkers(ctx, 3); n != 3 {
+		t.Errorf("workers were not returned to the pool")
+	} else {
+		graph.ReleaseWorkers(ctx, n)
+	}
+}
@@ -17,6 +17,7 @@ type Count struct {
 	tags   graph.Tagger
 	result quad.Value
 	qs     graph.QuadStore
+	err    error
 }
 
 // NewCount creates a new iterator to count a number of results from a provided subiterator.
@@ -36,6 +37,7 @@ func (it *Count) UID() uint64 {
 func (it *Count) Reset() {
 	it.done = false
 	it.result = nil
+	it.err = nil
 	it.it.Reset()
 }
 
@@ -76,6 +78,9 @@ func (it *Count) Next(ctx context.Context) bool {
 }
 
 func (it *Count) Err() error {
+	if it.err != nil {
+		return it.err
+	}
 	return it.it.Err()
 }
 
@@ -94,7 +99,12 @@ func (it *Count) Contains(ctx context.Context, val graph.Value) bool {
 		return v.NameOf() == it.result
 	}
 	if it.qs != nil {
-		return it.qs.NameOf(val) == it.result
+		name, err := graph.NameOf(ctx, it.qs, val)
+		if err != nil {
+			it.err = err
+			return false
+		}
+		return name == it.result
 	}
 	return false
 }
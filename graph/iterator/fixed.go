@@ -27,7 +27,7 @@ import (
 	"github.com/cayleygraph/cayley/graph"
 )
 
-var _ graph.Iterator = &Fixed{}
+var _ graph.BatchIterator = &Fixed{}
 
 // A Fixed iterator consists of it's values, an index (where it is in the process of Next()ing) and
 // an equality function.
@@ -120,6 +120,15 @@ func (it *Fixed) Next(ctx context.Context) bool {
 	return graph.NextLogOut(it, true)
 }
 
+func (it *Fixed) NextBatch(ctx context.Context, dst []graph.Value) int {
+	n := copy(dst, it.values[it.lastIndex:])
+	if n > 0 {
+		it.lastIndex += n
+		it.result = dst[n-1]
+	}
+	return n
+}
+
 func (it *Fixed) Err() error {
 	return nil
 }
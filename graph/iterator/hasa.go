@@ -42,7 +42,7 @@ import (
 	"github.com/cayleygraph/cayley/quad"
 )
 
-var _ graph.Iterator = &HasA{}
+var _ graph.BatchIterator = &HasA{}
 
 // A HasA consists of a reference back to the graph.QuadStore that it references,
 // a primary subiterator, a direction in which the quads for that subiterator point,
@@ -223,6 +223,24 @@ func (it *HasA) Next(ctx context.Context) bool {
 	return graph.NextLogOut(it, true)
 }
 
+// NextBatch reads a batch of quads from the primary iterator and replaces them with their nodes in place.
+func (it *HasA) NextBatch(ctx context.Context, dst []graph.Value) int {
+	if it.resultIt != nil {
+		it.resultIt.Close()
+	}
+	n := graph.NextBatch(ctx, it.primaryIt, dst)
+	if n == 0 {
+		it.err = it.primaryIt.Err()
+		return 0
+	}
+	for i, q := range dst[:n] {
+		dst[i] = it.qs.QuadDirection(q, it.dir)
+	}
+	it.runstats.Next += int64(n)
+	it.result = dst[n-1]
+	return n
+}
+
 func (it *HasA) Err() error {
 	return it.err
 }
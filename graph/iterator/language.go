@@ -0,0 +1,180 @@
+// Copyright 2017 The Cayley Authors. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package iterator
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/cayleygraph/cayley/graph"
+	"github.com/cayleygraph/cayley/quad"
+)
+
+var _ graph.Iterator = &Language{}
+
+// Language is a filter that passes only language-tagged strings with one of the given languages.
+// Language tags are compared case-insensitively. An empty language tag matches plain strings.
+type Language struct {
+	uid    uint64
+	tags   graph.Tagger
+	subIt  graph.Iterator
+	langs  []string
+	qs     graph.QuadStore
+	result graph.Value
+	err    error
+}
+
+func NewLanguage(sub graph.Iterator, qs graph.QuadStore, langs ...string) *Language {
+	return &Language{
+		uid:   NextUID(),
+		subIt: sub,
+		langs: langs,
+		qs:    qs,
+	}
+}
+
+func (it *Language) UID() uint64 {
+	return it.uid
+}
+
+// Languages returns a list of languages that are accepted by the filter.
+func (it *Language) Languages() []string { return it.langs }
+
+func (it *Language) testLang(ctx context.Context, val graph.Value) bool {
+	v, err := graph.NameOf(ctx, it.qs, val)
+	if err != nil {
+		it.err = err
+		return false
+	}
+	var lang string
+	switch s := v.(type) {
+	case quad.LangString:
+		lang = s.Lang
+	case quad.String:
+	default:
+		return false
+	}
+	for _, l := range it.langs {
+		if strings.EqualFold(l, lang) {
+			return true
+		}
+	}
+	return false
+}
+
+func (it *Language) Close() error {
+	return it.subIt.Close()
+}
+
+func (it *Language) Reset() {
+	it.subIt.Reset()
+	it.err = nil
+	it.result = nil
+}
+
+func (it *Language) Tagger() *graph.Tagger {
+	return &it.tags
+}
+
+func (it *Language) Clone() graph.Iterator {
+	out := NewLanguage(it.subIt.Clone(), it.qs, it.langs...)
+	out.tags.CopyFrom(it)
+	return out
+}
+
+func (it *Language) Next(ctx context.Context) bool {
+	for it.subIt.Next(ctx) {
+		val := it.subIt.Result()
+		if it.testLang(ctx, val) {
+			it.result = val
+			return true
+		} else if it.err != nil {
+			return false
+		}
+	}
+	it.err = it.subIt.Err()
+	return false
+}
+
+func (it *Language) Err() error {
+	return it.err
+}
+
+func (it *Language) Result() graph.Value {
+	return it.result
+}
+
+func (it *Language) NextPath(ctx context.Context) bool {
+	for {
+		if !it.subIt.NextPath(ctx) {
+			it.err = it.subIt.Err()
+			return false
+		}
+		if it.testLang(ctx, it.subIt.Result()) {
+			break
+		} else if it.err != nil {
+			return false
+		}
+	}
+	it.result = it.subIt.Result()
+	return true
+}
+
+func (it *Language) SubIterators() []graph.Iterator {
+	return []graph.Iterator{it.subIt}
+}
+
+func (it *Language) Contains(ctx context.Context, val graph.Value) bool {
+	if !it.testLang(ctx, val) {
+		return false
+	}
+	if !it.subIt.Contains(ctx, val) {
+		it.err = it.subIt.Err()
+		return false
+	}
+	it.result = val
+	return true
+}
+
+func (it *Language) Type() graph.Type {
+	return graph.Language
+}
+
+func (it *Language) String() string {
+	return fmt.Sprintf("Language(%v)", it.langs)
+}
+
+func (it *Language) Optimize() (graph.Iterator, bool) {
+	newSub, changed := it.subIt.Optimize()
+	if changed {
+		it.subIt.Close()
+		it.subIt = newSub
+	}
+	return it, false
+}
+
+func (it *Language) Stats() graph.IteratorStats {
+	return it.subIt.Stats()
+}
+
+func (it *Language) TagResults(dst map[string]graph.Value) {
+	it.tags.TagResult(dst, it.Result())
+	it.subIt.TagResults(dst)
+}
+
+func (it *Language) Size() (int64, bool) {
+	return 0, false
+}
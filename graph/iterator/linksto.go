@@ -34,10 +34,11 @@ import (
 	"fmt"
 
 	"github.com/cayleygraph/cayley/graph"
+	"github.com/cayleygraph/cayley/graph/stats"
 	"github.com/cayleygraph/cayley/quad"
 )
 
-var _ graph.Iterator = &LinksTo{}
+var _ graph.BatchIterator = &LinksTo{}
 
 // A LinksTo has a reference back to the graph.QuadStore (to create the iterators
 // for each node) the subiterator, and the direction the iterator comes from.
@@ -174,6 +175,32 @@ func (it *LinksTo) Next(ctx context.Context) bool {
 	}
 }
 
+// NextBatch fills dst with links of one or more primary values.
+func (it *LinksTo) NextBatch(ctx context.Context, dst []graph.Value) int {
+	n := 0
+	for n < len(dst) {
+		if m := graph.NextBatch(ctx, it.nextIt, dst[n:]); m != 0 {
+			it.runstats.ContainsNext += int64(m)
+			n += m
+			continue
+		}
+		if it.err = it.nextIt.Err(); it.err != nil {
+			break
+		}
+		if !it.primaryIt.Next(ctx) {
+			it.err = it.primaryIt.Err()
+			break
+		}
+		it.nextIt.Close()
+		it.nextIt = it.qs.QuadIterator(it.dir, it.primaryIt.Result())
+	}
+	it.runstats.Next += int64(n)
+	if n > 0 {
+		it.result = dst[n-1]
+	}
+	return n
+}
+
 func (it *LinksTo) Err() error {
 	return it.err
 }
@@ -207,18 +234,28 @@ func (it *LinksTo) NextPath(ctx context.Context) bool {
 // Register the LinksTo.
 func (it *LinksTo) Type() graph.Type { return graph.LinksTo }
 
-// Return a guess as to how big or costly it is to next the iterator.
+// Stats returns a guess as to how big or costly it is to next the iterator.
+//
+// If the subiterator is fixed and the quad store implements stats.Estimator, the size is the sum
+// of estimates for each value, and it is exact only if all the estimates are. Otherwise, the size
+// is a rough guess that assumes a fixed number of quads per value.
 func (it *LinksTo) Stats() graph.IteratorStats {
 	subitStats := it.primaryIt.Stats()
-	// TODO(barakmich): These should really come from the quadstore itself
 	fanoutFactor := int64(20)
 	checkConstant := int64(1)
 	nextConstant := int64(2)
+	size, exact := fanoutFactor*subitStats.Size, false
+	if e, ok := it.qs.(stats.Estimator); ok {
+		// quad store can tell us how many quads are linked to a fixed set of values
+		if fixed, ok := it.primaryIt.(*Fixed); ok {
+			size, exact = stats.QuadsWithAny(e, it.dir, fixed.values)
+		}
+	}
 	return graph.IteratorStats{
 		NextCost:     nextConstant + subitStats.NextCost,
 		ContainsCost: checkConstant + subitStats.ContainsCost,
-		Size:         fanoutFactor * subitStats.Size,
-		ExactSize:    false,
+		Size:         size,
+		ExactSize:    exact,
 		Next:         it.runstats.Next,
 		Contains:     it.runstats.Contains,
 		ContainsNext: it.runstats.ContainsNext,
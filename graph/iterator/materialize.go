@@ -18,6 +18,7 @@ package iterator
 
 import (
 	"context"
+	"sync"
 
 	"github.com/cayleygraph/cayley/clog"
 	"github.com/cayleygraph/cayley/graph"
@@ -25,6 +26,8 @@ import (
 
 var _ graph.Iterator = &Materialize{}
 
+// MaterializeLimit is the maximal number of values Materialize keeps in memory. Both results
+// and their tags are counted. When exceeded, Materialize reads the subiterator directly.
 const MaterializeLimit = 1000
 
 type result struct {
@@ -32,20 +35,29 @@ type result struct {
 	tags map[string]graph.Value
 }
 
-type Materialize struct {
-	uid         uint64
-	tags        graph.Tagger
+// materialized holds results of the subiterator. It is shared by all clones of Materialize,
+// thus the subiterator is only evaluated once by whichever clone runs first.
+type materialized struct {
+	mu          sync.Mutex
 	containsMap map[interface{}]int
 	values      [][]result
 	actualSize  int64
-	expectSize  int64
-	index       int
-	subindex    int
-	subIt       graph.Iterator
 	hasRun      bool
 	aborted     bool
-	runstats    graph.IteratorStats
-	err         error
+}
+
+type Materialize struct {
+	uid        uint64
+	tags       graph.Tagger
+	m          *materialized
+	expectSize int64
+	index      int
+	subindex   int
+	subIt      graph.Iterator
+	hasRun     bool
+	aborted    bool
+	runstats   graph.IteratorStats
+	err        error
 }
 
 func NewMaterialize(sub graph.Iterator) *Materialize {
@@ -54,11 +66,11 @@ func NewMaterialize(sub graph.Iterator) *Materialize {
 
 func NewMaterializeWithSize(sub graph.Iterator, size int64) *Materialize {
 	return &Materialize{
-		uid:         NextUID(),
-		expectSize:  size,
-		containsMap: make(map[interface{}]int),
-		subIt:       sub,
-		index:       -1,
+		uid:        NextUID(),
+		expectSize: size,
+		m:          &materialized{containsMap: make(map[interface{}]int)},
+		subIt:      sub,
+		index:      -1,
 	}
 }
 
@@ -72,9 +84,10 @@ func (it *Materialize) Reset() {
 }
 
 func (it *Materialize) Close() error {
-	it.containsMap = nil
-	it.values = nil
+	// results might be still used by clones, so only drop the reference
+	it.m = &materialized{containsMap: make(map[interface{}]int)}
 	it.hasRun = false
+	it.aborted = false
 	return it.subIt.Close()
 }
 
@@ -99,22 +112,20 @@ func (it *Materialize) TagResults(dst map[string]graph.Value) {
 	for _, tag := range it.tags.Tags() {
 		dst[tag] = it.Result()
 	}
-	for tag, value := range it.values[it.index][it.subindex].tags {
+	for tag, value := range it.m.values[it.index][it.subindex].tags {
 		dst[tag] = value
 	}
 }
 
+// Clone returns a copy of the iterator that shares materialized results with the original.
+// If none of them have run yet, the subiterator will be evaluated by the first one that does.
 func (it *Materialize) Clone() graph.Iterator {
-	out := NewMaterialize(it.subIt.Clone())
+	out := NewMaterializeWithSize(it.subIt.Clone(), it.expectSize)
 	out.tags.CopyFrom(it)
-	if it.hasRun {
-		out.hasRun = true
-		out.aborted = it.aborted
-		out.err = it.err
-		out.values = it.values
-		out.containsMap = it.containsMap
-		out.actualSize = it.actualSize
-	}
+	out.m = it.m
+	out.hasRun = it.hasRun
+	out.aborted = it.aborted
+	out.err = it.err
 	return out
 }
 
@@ -129,16 +140,16 @@ func (it *Materialize) Result() graph.Value {
 	if it.aborted {
 		return it.subIt.Result()
 	}
-	if len(it.values) == 0 {
+	if len(it.m.values) == 0 {
 		return nil
 	}
 	if it.index == -1 {
 		return nil
 	}
-	if it.index >= len(it.values) {
+	if it.index >= len(it.m.values) {
 		return nil
 	}
-	return it.values[it.index][it.subindex].id
+	return it.m.values[it.index][it.subindex].id
 }
 
 func (it *Materialize) SubIterators() []graph.Iterator {
@@ -161,12 +172,12 @@ func (it *Materialize) Optimize() (graph.Iterator, bool) {
 func (it *Materialize) Size() (int64, bool) {
 	if it.hasRun && !it.aborted {
 		if clog.V(2) {
-			clog.Infof("returning size %v", it.actualSize)
+			clog.Infof("returning size %v", it.m.actualSize)
 		}
-		return it.actualSize, true
+		return it.m.actualSize, true
 	}
 	if clog.V(2) {
-		clog.Infof("bailing size %v", it.actualSize)
+		clog.Infof("bailing size %v", it.m.actualSize)
 	}
 	return it.subIt.Size()
 }
@@ -212,7 +223,7 @@ func (it *Materialize) Next(ctx context.Context) bool {
 
 	it.index++
 	it.subindex = 0
-	if it.index >= len(it.values) {
+	if it.index >= len(it.m.values) {
 		return graph.NextLogOut(it, false)
 	}
 	return graph.NextLogOut(it, true)
@@ -235,7 +246,7 @@ func (it *Materialize) Contains(ctx context.Context, v graph.Value) bool {
 		return it.subIt.Contains(ctx, v)
 	}
 	key := graph.ToKey(v)
-	if i, ok := it.containsMap[key]; ok {
+	if i, ok := it.m.containsMap[key]; ok {
 		it.index = i
 		it.subindex = 0
 		return graph.ContainsLogOut(it, v, true)
@@ -255,7 +266,7 @@ func (it *Materialize) NextPath(ctx context.Context) bool {
 	}
 
 	it.subindex++
-	if it.subindex >= len(it.values[it.index]) {
+	if it.subindex >= len(it.m.values[it.index]) {
 		// Don't go off the end of the world
 		it.subindex--
 		return false
@@ -264,51 +275,82 @@ func (it *Materialize) NextPath(ctx context.Context) bool {
 }
 
 func (it *Materialize) materializeSet(ctx context.Context) {
-	i := 0
+	m := it.m
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if !m.hasRun {
+		if err := m.materialize(ctx, it.subIt); err != nil {
+			it.err = err
+			return
+		}
+	}
+	it.hasRun = true
+	it.aborted = m.aborted
+}
+
+// materializeLimit returns the maximal number of values Materialize keeps in memory.
+// Results cannot be moved to disk, since values are opaque to the iterator, thus
+// Materialize reads the subiterator directly when the spill limit is lower.
+func materializeLimit() int {
+	if n := Spill.MaxValues; n > 0 && n < MaterializeLimit {
+		return n
+	}
+	return MaterializeLimit
+}
+
+func (m *materialized) materialize(ctx context.Context, sub graph.Iterator) error {
+	n := 0
 	mn := 0
-	for it.subIt.Next(ctx) {
-		i++
-		if i > MaterializeLimit {
-			it.aborted = true
-			break
+	limit := materializeLimit()
+	// add stores the current result of the subiterator, if it fits into the limit
+	add := func(id graph.Value, index int) bool {
+		tags := make(map[string]graph.Value, mn)
+		sub.TagResults(tags)
+		if len(tags) > mn {
+			mn = len(tags)
+		}
+		n += 1 + len(tags)
+		if n > limit {
+			m.aborted = true
+			return false
 		}
-		id := it.subIt.Result()
+		m.values[index] = append(m.values[index], result{id: id, tags: tags})
+		m.actualSize += 1
+		return true
+	}
+	for !m.aborted && sub.Next(ctx) {
+		id := sub.Result()
 		val := graph.ToKey(id)
-		if _, ok := it.containsMap[val]; !ok {
-			it.containsMap[val] = len(it.values)
-			it.values = append(it.values, nil)
+		if _, ok := m.containsMap[val]; !ok {
+			m.containsMap[val] = len(m.values)
+			m.values = append(m.values, nil)
 		}
-		index := it.containsMap[val]
-		tags := make(map[string]graph.Value, mn)
-		it.subIt.TagResults(tags)
-		if n := len(tags); n > mn {
-			n = mn
+		index := m.containsMap[val]
+		if !add(id, index) {
+			break
 		}
-		it.values[index] = append(it.values[index], result{id: id, tags: tags})
-		it.actualSize += 1
-		for it.subIt.NextPath(ctx) {
-			i++
-			if i > MaterializeLimit {
-				it.aborted = true
+		for sub.NextPath(ctx) {
+			if !add(id, index) {
 				break
 			}
-			tags := make(map[string]graph.Value, mn)
-			it.subIt.TagResults(tags)
-			if n := len(tags); n > mn {
-				n = mn
-			}
-			it.values[index] = append(it.values[index], result{id: id, tags: tags})
-			it.actualSize += 1
 		}
 	}
-	it.err = it.subIt.Err()
-	if it.err == nil && it.aborted {
+	if err := sub.Err(); err != nil {
+		// allow other clones to retry
+		m.values = nil
+		m.containsMap = make(map[interface{}]int)
+		m.actualSize = 0
+		m.aborted = false
+		return err
+	}
+	if m.aborted {
 		if clog.V(2) {
 			clog.Infof("Aborting subiterator")
 		}
-		it.values = nil
-		it.containsMap = nil
-		it.subIt.Reset()
+		m.values = nil
+		m.containsMap = nil
+		sub.Reset()
 	}
-	it.hasRun = true
+	m.hasRun = true
+	return nil
 }
@@ -19,7 +19,9 @@ import (
 	"errors"
 	"testing"
 
+	"github.com/cayleygraph/cayley/graph"
 	. "github.com/cayleygraph/cayley/graph/iterator"
+	"github.com/stretchr/testify/require"
 )
 
 func TestMaterializeIteratorError(t *testing.T) {
@@ -74,3 +76,59 @@ func TestMaterializeIteratorErrorAbort(t *testing.T) {
 		t.Errorf("Materialize iterator did not pass through underlying Err")
 	}
 }
+
+func TestMaterializeIteratorCloneShared(t *testing.T) {
+	ctx := context.TODO()
+	mIt := NewMaterialize(NewFixed(Int64Node(1), Int64Node(2), Int64Node(3)))
+	// clone before running, so both iterators have their own subiterator
+	cIt := mIt.Clone()
+
+	var got []graph.Value
+	for mIt.Next(ctx) {
+		got = append(got, mIt.Result())
+	}
+	require.Len(t, got, 3)
+
+	var cloned []graph.Value
+	for cIt.Next(ctx) {
+		cloned = append(cloned, cIt.Result())
+	}
+	require.NoError(t, cIt.Err())
+	require.Equal(t, got, cloned)
+	require.Nil(t, cIt.SubIterators()[0].Result(), "clone evaluated the subiterator again")
+}
+
+func TestMaterializeIteratorSpillLimit(t *testing.T) {
+	defer func(opt SpillOptions) {
+		Spill = opt
+	}(Spill)
+	Spill = SpillOptions{MaxValues: 2}
+
+	// Unique has an inexact size, thus it is visible if Materialize keeps the results
+	mIt := NewMaterialize(NewUnique(NewInt64(1, 3, true)))
+	require.Equal(t, []int{1, 2, 3}, iterated(mIt))
+	require.NoError(t, mIt.Err())
+	_, exact := mIt.Size()
+	require.False(t, exact, "results should not be kept in memory")
+}
+
+func TestMaterializeIteratorTagsLimit(t *testing.T) {
+	defer func(opt SpillOptions) {
+		Spill = opt
+	}(Spill)
+	Spill = SpillOptions{MaxValues: 4}
+
+	mIt := NewMaterialize(NewUnique(NewInt64(1, 3, true)))
+	require.Equal(t, []int{1, 2, 3}, iterated(mIt))
+	_, exact := mIt.Size()
+	require.True(t, exact, "results should be kept in memory")
+
+	// tags of results are kept in memory as well
+	sub := NewUnique(NewInt64(1, 3, true))
+	sub.Tagger().Add("x")
+	mIt = NewMaterialize(sub)
+	require.Equal(t, []int{1, 2, 3}, iterated(mIt))
+	require.NoError(t, mIt.Err())
+	_, exact = mIt.Size()
+	require.False(t, exact, "results should not be kept in memory")
+}
@@ -37,6 +37,9 @@ type Or struct {
 	currentIterator   int
 	result            graph.Value
 	err               error
+
+	// par is set when branches are iterated concurrently
+	par *parallelOr
 }
 
 func NewOr(sub ...graph.Iterator) *Or {
@@ -66,6 +69,7 @@ func (it *Or) UID() uint64 {
 
 // Reset all internal iterators
 func (it *Or) Reset() {
+	it.stopParallel()
 	for _, sub := range it.internalIterators {
 		sub.Reset()
 	}
@@ -115,11 +119,21 @@ func (it *Or) AddSubIterator(sub graph.Iterator) {
 // Next advances the Or graph.iterator. Because the Or is the union of its
 // subiterators, it must produce from all subiterators -- unless it it
 // shortcircuiting, in which case, it is the first one that returns anything.
+//
+// If the query allows parallel execution (see graph.WithParallelism), subiterators of
+// a non-shortcircuiting Or are iterated concurrently and results are returned in no particular order.
+// Such an Or must not be used with Contains until it's Reset.
 func (it *Or) Next(ctx context.Context) bool {
 	if it.currentIterator >= len(it.internalIterators) {
 		return false
 	}
 	graph.NextLogIn(it)
+	if it.currentIterator == -1 && it.par == nil && !it.isShortCircuiting && len(it.internalIterators) > 1 {
+		it.par = newParallelOr(ctx, it.internalIterators)
+	}
+	if it.par != nil {
+		return graph.NextLogOut(it, it.nextParallel())
+	}
 	var first bool
 	for {
 		if it.currentIterator == -1 {
@@ -150,6 +164,26 @@ func (it *Or) Next(ctx context.Context) bool {
 	return graph.NextLogOut(it, false)
 }
 
+func (it *Or) nextParallel() bool {
+	i, err := it.par.next()
+	if err != nil || i < 0 {
+		it.err = err
+		it.stopParallel()
+		it.currentIterator = len(it.internalIterators)
+		return false
+	}
+	it.currentIterator = i
+	it.result = it.internalIterators[i].Result()
+	return true
+}
+
+func (it *Or) stopParallel() {
+	if it.par != nil {
+		it.par.stop()
+		it.par = nil
+	}
+}
+
 func (it *Or) Err() error {
 	return it.err
 }
@@ -179,6 +213,7 @@ func (it *Or) subItsContain(ctx context.Context, val graph.Value) (bool, error)
 // Check a value against the entire graph.iterator, in order.
 func (it *Or) Contains(ctx context.Context, val graph.Value) bool {
 	graph.ContainsLogIn(it, val)
+	it.stopParallel()
 	anyGood, err := it.subItsContain(ctx, val)
 	if err != nil {
 		it.err = err
@@ -242,6 +277,7 @@ func (it *Or) cleanUp() {}
 // follow this contract, the Or follows the contract.  It closes all
 // subiterators it can, but returns the first error it encounters.
 func (it *Or) Close() error {
+	it.stopParallel()
 	it.cleanUp()
 
 	var err error
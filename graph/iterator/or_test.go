@@ -18,6 +18,7 @@ import (
 	"context"
 	"errors"
 	"reflect"
+	"sort"
 	"testing"
 
 	"github.com/cayleygraph/cayley/graph"
@@ -204,3 +205,50 @@ func TestShortCircuitOrIteratorErr(t *testing.T) {
 		t.Errorf("Or iterator did not pass through underlying Err")
 	}
 }
+
+func TestOrIteratorParallel(t *testing.T) {
+	ctx := graph.WithParallelism(context.TODO(), 3)
+	tagged := NewFixed(Int64Node(20), Int64Node(21))
+	tagged.Tagger().Add("x")
+	or := NewOr(
+		NewFixed(Int64Node(1), Int64Node(2), Int64Node(3)),
+		NewFixed(Int64Node(3), Int64Node(9)),
+		NewInt64(10, 12, true),
+		tagged,
+	)
+	expect := []int{1, 2, 3, 3, 9, 10, 11, 12, 20, 21}
+	for i := 0; i < 2; i++ {
+		var got []int
+		for or.Next(ctx) {
+			v := int(or.Result().(Int64Node))
+			got = append(got, v)
+			tags := make(map[string]graph.Value)
+			or.TagResults(tags)
+			if _, ok := tags["x"]; ok != (v >= 20) {
+				t.Errorf("unexpected tags for %d: %v", v, tags)
+			}
+		}
+		sort.Ints(got)
+		if !reflect.DeepEqual(got, expect) {
+			t.Errorf("Failed to iterate Or correctly on repeat %d, got:%v expect:%v", i, got, expect)
+		}
+		or.Reset()
+	}
+	if n := graph.AcquireWorkers(ctx, 2); n != 2 {
+		t.Errorf("workers were not returned to the pool")
+	} else {
+		graph.ReleaseWorkers(ctx, n)
+	}
+
+	wantErr := errors.New("unique")
+	or = NewOr(
+		NewFixed(Int64Node(1)),
+		newTestIterator(false, wantErr),
+	)
+	for or.Next(ctx) {
+	}
+	if or.Err() != wantErr {
+		t.Errorf("Or iterator did not pass through underlying Err")
+	}
+	or.Close()
+}
@@ -0,0 +1,168 @@
+// Copyright 2017 The Cayley Authors. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package iterator
+
+// Parallel execution of independent branches of And and Or iterators.
+// Goroutines are taken from a per-query pool (see graph.WithParallelism) without blocking,
+// so nested iterators fall back to sequential execution when the pool is exhausted.
+
+import (
+	"context"
+	"sync"
+	"sync/atomic"
+
+	"github.com/cayleygraph/cayley/graph"
+)
+
+// parallelDo calls fnc for each index in [0, cnt), using n additional goroutines along with the calling one.
+func parallelDo(n, cnt int, fnc func(i int)) {
+	var (
+		next = int32(-1)
+		wg   sync.WaitGroup
+	)
+	work := func() {
+		for {
+			i := int(atomic.AddInt32(&next, 1))
+			if i >= cnt {
+				return
+			}
+			fnc(i)
+		}
+	}
+	wg.Add(n)
+	for j := 0; j < n; j++ {
+		go func() {
+			defer wg.Done()
+			work()
+		}()
+	}
+	work()
+	wg.Wait()
+}
+
+type parallelResult struct {
+	worker int
+	branch int // -1 if the worker is done
+	err    error
+}
+
+// parallelOr iterates branches of an Or concurrently.
+//
+// Each worker advances its branches one result at a time: after a result is sent,
+// the worker waits until the consumer asks for the next one, so the state of the branch
+// (tags, NextPath) stays valid while the result is being used.
+type parallelOr struct {
+	ctx     context.Context
+	workers int
+	req     []chan struct{}
+	out     chan parallelResult
+	done    chan struct{}
+	wg      sync.WaitGroup
+	active  int
+	cur     int // worker that produced the current result; -1 if none
+}
+
+// newParallelOr starts iterating sub-iterators concurrently.
+// It returns nil if the query doesn't have enough goroutines available.
+func newParallelOr(ctx context.Context, subs []graph.Iterator) *parallelOr {
+	n := graph.AcquireWorkers(ctx, len(subs))
+	if n < 2 {
+		graph.ReleaseWorkers(ctx, n)
+		return nil
+	}
+	p := &parallelOr{
+		ctx:     ctx,
+		workers: n,
+		req:     make([]chan struct{}, n),
+		out:     make(chan parallelResult, n),
+		done:    make(chan struct{}),
+		active:  n,
+		cur:     -1,
+	}
+	for w := 0; w < n; w++ {
+		var branches []int
+		for b := w; b < len(subs); b += n {
+			branches = append(branches, b)
+		}
+		p.req[w] = make(chan struct{}, 1)
+		p.req[w] <- struct{}{}
+		p.wg.Add(1)
+		go p.run(w, subs, branches)
+	}
+	return p
+}
+
+func (p *parallelOr) wait(w int) bool {
+	select {
+	case <-p.req[w]:
+		return true
+	case <-p.done:
+		return false
+	}
+}
+
+func (p *parallelOr) run(w int, subs []graph.Iterator, branches []int) {
+	defer p.wg.Done()
+	if !p.wait(w) {
+		return
+	}
+	for _, b := range branches {
+		sub := subs[b]
+		for sub.Next(p.ctx) {
+			p.out <- parallelResult{worker: w, branch: b}
+			if !p.wait(w) {
+				return
+			}
+		}
+		if err := sub.Err(); err != nil {
+			p.out <- parallelResult{worker: w, branch: -1, err: err}
+			return
+		}
+	}
+	p.out <- parallelResult{worker: w, branch: -1}
+}
+
+// next returns the index of a sub-iterator that has the next result, or -1 if there are no more results.
+func (p *parallelOr) next() (int, error) {
+	if p.cur >= 0 {
+		p.req[p.cur] <- struct{}{}
+		p.cur = -1
+	}
+	for p.active > 0 {
+		var r parallelResult
+		select {
+		case r = <-p.out:
+		case <-p.ctx.Done():
+			return -1, p.ctx.Err()
+		}
+		if r.branch < 0 {
+			p.active--
+			if r.err != nil {
+				return -1, r.err
+			}
+			continue
+		}
+		p.cur = r.worker
+		return r.branch, nil
+	}
+	return -1, nil
+}
+
+// stop waits for all workers to exit and returns goroutines to the query pool.
+func (p *parallelOr) stop() {
+	close(p.done)
+	p.wg.Wait()
+	graph.ReleaseWorkers(p.ctx, p.workers)
+}
@@ -0,0 +1,119 @@
+package iterator
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/cayleygraph/cayley/graph"
+	"github.com/cayleygraph/cayley/quad"
+)
+
+var _ graph.Iterator = &Provenance{}
+
+// Provenance iterator tags quads from its subiterator with an author and time of their provenance records.
+//
+// Quads without a record are not tagged. See graph.Provenance.
+type Provenance struct {
+	uid        uint64
+	qs         graph.QuadStore
+	subIt      graph.Iterator
+	author, tm string
+}
+
+// NewProvenance creates an iterator that tags quads from a subiterator.
+// Empty tag names are not tagged.
+func NewProvenance(qs graph.QuadStore, subIt graph.Iterator, author, tm string) *Provenance {
+	return &Provenance{
+		uid:    NextUID(),
+		qs:     qs,
+		subIt:  subIt,
+		author: author,
+		tm:     tm,
+	}
+}
+
+func (it *Provenance) UID() uint64 {
+	return it.uid
+}
+
+func (it *Provenance) Reset() {
+	it.subIt.Reset()
+}
+
+func (it *Provenance) Tagger() *graph.Tagger {
+	return it.subIt.Tagger()
+}
+
+func (it *Provenance) TagResults(dst map[string]graph.Value) {
+	it.subIt.TagResults(dst)
+	res := it.subIt.Result()
+	if res == nil {
+		return
+	}
+	rec, err := graph.Provenance(it.qs, it.qs.Quad(res))
+	if err != nil || rec == nil {
+		return
+	}
+	if it.author != "" && rec.Author != "" {
+		if v := it.qs.ValueOf(quad.String(rec.Author)); v != nil {
+			dst[it.author] = v
+		}
+	}
+	if it.tm != "" && !rec.Time.IsZero() {
+		if v := it.qs.ValueOf(quad.Time(rec.Time)); v != nil {
+			dst[it.tm] = v
+		}
+	}
+}
+
+func (it *Provenance) Clone() graph.Iterator {
+	return NewProvenance(it.qs, it.subIt.Clone(), it.author, it.tm)
+}
+
+func (it *Provenance) SubIterators() []graph.Iterator {
+	return []graph.Iterator{it.subIt}
+}
+
+func (it *Provenance) Next(ctx context.Context) bool {
+	return it.subIt.Next(ctx)
+}
+
+func (it *Provenance) Err() error {
+	return it.subIt.Err()
+}
+
+func (it *Provenance) Result() graph.Value {
+	return it.subIt.Result()
+}
+
+func (it *Provenance) Contains(ctx context.Context, val graph.Value) bool {
+	return it.subIt.Contains(ctx, val)
+}
+
+func (it *Provenance) NextPath(ctx context.Context) bool {
+	return it.subIt.NextPath(ctx)
+}
+
+func (it *Provenance) Close() error {
+	return it.subIt.Close()
+}
+
+func (it *Provenance) Type() graph.Type { return graph.ProvenanceTags }
+
+func (it *Provenance) Optimize() (graph.Iterator, bool) {
+	sub, opt := it.subIt.Optimize()
+	it.subIt = sub
+	return it, opt
+}
+
+func (it *Provenance) Stats() graph.IteratorStats {
+	return it.subIt.Stats()
+}
+
+func (it *Provenance) Size() (int64, bool) {
+	return it.subIt.Size()
+}
+
+func (it *Provenance) String() string {
+	return fmt.Sprintf("Provenance(%q, %q)", it.author, it.tm)
+}
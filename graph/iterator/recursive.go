@@ -8,74 +8,168 @@ import (
 	"github.com/cayleygraph/cayley/quad"
 )
 
+// RecursiveStrategy is an order in which the Recursive iterator visits nodes.
+type RecursiveStrategy int
+
+const (
+	// BreadthFirst visits all nodes at one depth before going deeper.
+	// Depth of each result is the length of the shortest path to it.
+	BreadthFirst = RecursiveStrategy(iota)
+	// DepthFirst follows each branch as deep as possible before going to the next one.
+	// It keeps fewer nodes in memory, but the depth of a result may be larger than the shortest path to it.
+	DepthFirst
+)
+
+// RecursiveOptions configures the Recursive iterator.
+type RecursiveOptions struct {
+	// MaxDepth is the maximal number of recursive steps.
+	// Zero means DefaultMaxRecursiveSteps, and a negative value removes the limit.
+	MaxDepth int
+	// Strategy sets the order of the traversal.
+	Strategy RecursiveStrategy
+	// MaxResults limits the number of results. Zero means no limit.
+	MaxResults int
+	// CycleTags enables cycle reporting. If the morphism leads from a node back to one of its ancestors,
+	// this node is returned once more with these tags set to the ancestor.
+	//
+	// Ancestors are only known while the visited set is in memory, thus some cycles may not be reported after spilling.
+	CycleTags []string
+	// Spill configures storage of the set of visited nodes.
+	Spill SpillOptions
+}
+
 // Recursive iterator takes a base iterator and a morphism to be applied recursively, for each result.
 type Recursive struct {
 	uid      uint64
 	tags     graph.Tagger
 	subIt    graph.Iterator
-	result   seenAt
+	result   recNode
 	runstats graph.IteratorStats
 	err      error
 
 	qs            graph.QuadStore
 	morphism      graph.ApplyMorphism
-	seen          map[interface{}]seenAt
+	opt           RecursiveOptions
+	started       bool
+	seen          *spillSet
+	info          map[interface{}]recNode
 	nextIt        graph.Iterator
 	depth         int
-	maxDepth      int
 	pathMap       map[interface{}][]map[string]graph.Value
 	pathIndex     int
 	containsValue graph.Value
 	depthTags     graph.Tagger
-	depthCache    []graph.Value
-	baseIt        graph.FixedIterator
+	depthCache    []recNode
+	parents       map[interface{}]recNode
+	stack         []recFrame
+	count         int
+	cycle         graph.Value
+	truncated     bool
+}
+
+// recNode is a node visited by the Recursive iterator.
+type recNode struct {
+	val    graph.Value
+	depth  int
+	base   graph.Value // node of the subiterator this one was reached from
+	parent graph.Value
 }
 
-type seenAt struct {
-	depth int
-	val   graph.Value
+// recFrame is a node that is being expanded by the depth-first traversal.
+type recFrame struct {
+	node recNode
+	it   graph.Iterator
 }
 
+const recursiveBaseTag = "__base_recursive"
+
 var _ graph.Iterator = &Recursive{}
 
 var DefaultMaxRecursiveSteps = 50
 
+// NewRecursive creates a breadth-first Recursive iterator. Negative maxDepth removes the limit on recursive steps.
+//
+// Set of visited nodes is moved to disk if it grows above the limit set in Spill.
 func NewRecursive(qs graph.QuadStore, it graph.Iterator, morphism graph.ApplyMorphism, maxDepth int) *Recursive {
-	if maxDepth == 0 {
-		maxDepth = DefaultMaxRecursiveSteps
-	}
-
-	return &Recursive{
-		uid:   NextUID(),
-		subIt: it,
+	return NewRecursiveWithOptions(qs, it, morphism, RecursiveOptions{
+		MaxDepth: maxDepth,
+		Spill:    Spill,
+	})
+}
 
-		qs:            qs,
-		morphism:      morphism,
-		seen:          make(map[interface{}]seenAt),
-		nextIt:        &Null{},
-		baseIt:        NewFixed(),
-		pathMap:       make(map[interface{}][]map[string]graph.Value),
-		containsValue: nil,
-		maxDepth:      maxDepth,
+// NewRecursiveWithOptions creates a Recursive iterator with the given options.
+func NewRecursiveWithOptions(qs graph.QuadStore, it graph.Iterator, morphism graph.ApplyMorphism, opt RecursiveOptions) *Recursive {
+	if opt.MaxDepth == 0 {
+		opt.MaxDepth = DefaultMaxRecursiveSteps
 	}
+	r := &Recursive{
+		uid:      NextUID(),
+		subIt:    it,
+		qs:       qs,
+		morphism: morphism,
+		opt:      opt,
+	}
+	r.reset()
+	return r
 }
 
 func (it *Recursive) UID() uint64 {
 	return it.uid
 }
 
-func (it *Recursive) Reset() {
-	it.result.val = nil
-	it.result.depth = 0
+// Options returns options of the iterator.
+func (it *Recursive) Options() RecursiveOptions {
+	return it.opt
+}
+
+func (it *Recursive) reset() {
+	it.result = recNode{}
 	it.err = nil
-	it.subIt.Reset()
-	it.seen = make(map[interface{}]seenAt)
+	it.started = false
+	if it.seen != nil {
+		it.seen.Close()
+	}
+	it.seen = newSpillSet(it.opt.Spill)
+	it.info = make(map[interface{}]recNode)
 	it.pathMap = make(map[interface{}][]map[string]graph.Value)
 	it.containsValue = nil
 	it.pathIndex = 0
+	it.closeStack()
+	if it.nextIt != nil {
+		it.nextIt.Close()
+	}
 	it.nextIt = &Null{}
-	it.baseIt = NewFixed()
 	it.depth = 0
+	it.depthCache = nil
+	it.parents = nil
+	it.count = 0
+	it.cycle = nil
+	it.truncated = false
+}
+
+func (it *Recursive) closeStack() error {
+	var last error
+	for _, f := range it.stack {
+		if f.it == it.nextIt {
+			continue
+		}
+		if err := f.it.Close(); err != nil {
+			last = err
+		}
+	}
+	it.stack = nil
+	return last
+}
+
+func (it *Recursive) Reset() {
+	it.subIt.Reset()
+	it.reset()
+}
+
+// Truncated reports if some nodes were not expanded because of the depth limit,
+// or some results were dropped because of the result limit.
+func (it *Recursive) Truncated() bool {
+	return it.truncated
 }
 
 func (it *Recursive) Tagger() *graph.Tagger {
@@ -89,6 +183,11 @@ func (it *Recursive) AddDepthTag(s string) {
 func (it *Recursive) TagResults(dst map[string]graph.Value) {
 	it.tags.TagResult(dst, it.Result())
 	it.depthTags.TagResult(dst, graph.PreFetched(quad.Int(it.result.depth)))
+	if it.cycle != nil {
+		for _, tag := range it.opt.CycleTags {
+			dst[tag] = it.cycle
+		}
+	}
 
 	if it.containsValue != nil {
 		paths := it.pathMap[graph.ToKey(it.containsValue)]
@@ -100,12 +199,12 @@ func (it *Recursive) TagResults(dst map[string]graph.Value) {
 	}
 	if it.nextIt != nil {
 		it.nextIt.TagResults(dst)
-		delete(dst, "__base_recursive")
+		delete(dst, recursiveBaseTag)
 	}
 }
 
 func (it *Recursive) Clone() graph.Iterator {
-	n := NewRecursive(it.qs, it.subIt.Clone(), it.morphism, it.maxDepth)
+	n := NewRecursiveWithOptions(it.qs, it.subIt.Clone(), it.morphism, it.opt)
 	n.tags.CopyFrom(it)
 	n.depthTags.CopyFromTagger(&it.depthTags)
 	return n
@@ -115,97 +214,233 @@ func (it *Recursive) SubIterators() []graph.Iterator {
 	return []graph.Iterator{it.subIt}
 }
 
-func (it *Recursive) Next(ctx context.Context) bool {
-	it.pathIndex = 0
-	if it.depth == 0 {
-		for it.subIt.Next(ctx) {
-			res := it.subIt.Result()
-			it.depthCache = append(it.depthCache, it.subIt.Result())
+// depthLimited checks if nodes at a given depth should not be expanded further.
+func (it *Recursive) depthLimited(depth int) bool {
+	if it.opt.MaxDepth >= 0 && depth >= it.opt.MaxDepth {
+		it.truncated = true
+		return true
+	}
+	return false
+}
+
+// start loads all results of the subiterator. They are the nodes at depth zero.
+func (it *Recursive) start(ctx context.Context) {
+	it.started = true
+	for it.subIt.Next(ctx) {
+		res := it.subIt.Result()
+		it.depthCache = append(it.depthCache, recNode{val: res, base: res})
+		tags := make(map[string]graph.Value)
+		it.subIt.TagResults(tags)
+		key := graph.ToKey(res)
+		it.pathMap[key] = append(it.pathMap[key], tags)
+		for it.subIt.NextPath(ctx) {
 			tags := make(map[string]graph.Value)
 			it.subIt.TagResults(tags)
-			key := graph.ToKey(res)
 			it.pathMap[key] = append(it.pathMap[key], tags)
-			for it.subIt.NextPath(ctx) {
-				tags := make(map[string]graph.Value)
-				it.subIt.TagResults(tags)
-				it.pathMap[key] = append(it.pathMap[key], tags)
-			}
 		}
 	}
-	if it.depth >= it.maxDepth {
+	it.err = it.subIt.Err()
+}
+
+func (it *Recursive) Next(ctx context.Context) bool {
+	graph.NextLogIn(it)
+	it.runstats.Next += 1
+	it.pathIndex = 0
+	it.cycle = nil
+	if !it.started {
+		it.start(ctx)
+	}
+	if it.err != nil {
 		return graph.NextLogOut(it, false)
 	}
+	var ok bool
+	if it.opt.Strategy == DepthFirst {
+		ok = it.nextDepthFirst(ctx)
+	} else {
+		ok = it.nextBreadthFirst(ctx)
+	}
+	if ok && it.opt.MaxResults > 0 && it.count >= it.opt.MaxResults {
+		it.truncated = true
+		ok = false
+	}
+	if !ok {
+		return graph.NextLogOut(it, false)
+	}
+	it.count++
+	return graph.NextLogOut(it, true)
+}
+
+func (it *Recursive) nextBreadthFirst(ctx context.Context) bool {
 	for {
-		ok := it.nextIt.Next(ctx)
-		if !ok {
-			if len(it.depthCache) == 0 {
-				return graph.NextLogOut(it, false)
+		if !it.nextIt.Next(ctx) {
+			if it.err = it.nextIt.Err(); it.err != nil {
+				return false
+			}
+			if len(it.depthCache) == 0 || it.depthLimited(it.depth) {
+				return false
 			}
 			it.depth++
-			it.baseIt = NewFixed()
-			for _, x := range it.depthCache {
-				it.baseIt.Add(x)
+			it.parents = make(map[interface{}]recNode, len(it.depthCache))
+			base := NewFixed()
+			for _, n := range it.depthCache {
+				it.parents[graph.ToKey(n.val)] = n
+				base.Add(n.val)
 			}
-			it.baseIt.Tagger().Add("__base_recursive")
+			base.Tagger().Add(recursiveBaseTag)
 			it.depthCache = nil
-			it.nextIt = it.morphism(it.qs, it.baseIt)
+			it.nextIt.Close()
+			it.nextIt = it.morphism(it.qs, base)
 			continue
 		}
-		val := it.nextIt.Result()
 		results := make(map[string]graph.Value)
 		it.nextIt.TagResults(results)
-		key := graph.ToKey(val)
-		if _, ok := it.seen[key]; ok {
+		parent := it.parents[graph.ToKey(results[recursiveBaseTag])]
+		if !it.visit(it.nextIt.Result(), parent) {
+			if it.err != nil {
+				return false
+			}
 			continue
 		}
-		it.seen[key] = seenAt{
-			val:   results["__base_recursive"],
-			depth: it.depth,
+		if it.cycle == nil {
+			it.depthCache = append(it.depthCache, it.result)
 		}
-		it.result.depth = it.depth
-		it.result.val = val
-		it.containsValue = it.getBaseValue(val)
-		it.depthCache = append(it.depthCache, val)
-		break
+		return true
 	}
-	return graph.NextLogOut(it, true)
 }
 
-func (it *Recursive) Err() error {
-	return it.err
+func (it *Recursive) nextDepthFirst(ctx context.Context) bool {
+	for {
+		if len(it.stack) == 0 {
+			if len(it.depthCache) == 0 {
+				return false
+			}
+			// depth cache holds results of the subiterator that are not yet expanded
+			n := it.depthCache[0]
+			it.depthCache = it.depthCache[1:]
+			it.push(n)
+			continue
+		}
+		f := it.stack[len(it.stack)-1]
+		if !f.it.Next(ctx) {
+			if it.err = f.it.Err(); it.err != nil {
+				return false
+			}
+			it.stack = it.stack[:len(it.stack)-1]
+			if f.it != it.nextIt {
+				f.it.Close()
+			}
+			continue
+		}
+		if !it.visit(f.it.Result(), f.node) {
+			if it.err != nil {
+				return false
+			}
+			continue
+		}
+		if it.nextIt != f.it && !it.inStack(it.nextIt) {
+			it.nextIt.Close()
+		}
+		it.nextIt = f.it
+		if it.cycle == nil {
+			it.push(it.result)
+		}
+		return true
+	}
 }
 
-func (it *Recursive) Result() graph.Value {
-	return it.result.val
+func (it *Recursive) inStack(sub graph.Iterator) bool {
+	for _, f := range it.stack {
+		if f.it == sub {
+			return true
+		}
+	}
+	return false
 }
 
-func (it *Recursive) getBaseValue(val graph.Value) graph.Value {
-	var at seenAt
-	var ok bool
-	if at, ok = it.seen[graph.ToKey(val)]; !ok {
-		panic("trying to getBaseValue of something unseen")
+// push starts expanding the node in depth-first order.
+func (it *Recursive) push(n recNode) {
+	if it.depthLimited(n.depth) {
+		return
 	}
-	for at.depth != 1 {
-		if at.depth == 0 {
-			panic("seen chain is broken")
+	base := NewFixed(n.val)
+	base.Tagger().Add(recursiveBaseTag)
+	it.stack = append(it.stack, recFrame{node: n, it: it.morphism(it.qs, base)})
+}
+
+// visit marks the node reached from the parent as visited. It returns false if the node was already visited.
+//
+// If cycle reporting is enabled and the node is an ancestor of the parent, the parent is set as a result instead.
+func (it *Recursive) visit(val graph.Value, parent recNode) bool {
+	key := graph.ToKey(val)
+	added, err := it.seen.Add(key)
+	if err != nil {
+		it.err = err
+		return false
+	}
+	if !added {
+		if len(it.opt.CycleTags) == 0 || !it.isAncestor(key, parent) {
+			return false
+		}
+		it.result = parent
+		it.containsValue = parent.base
+		it.cycle = val
+		return true
+	}
+	if len(it.seen.mem) == 0 {
+		// visited set was moved to disk, drop the rest of the node info as well
+		it.info = make(map[interface{}]recNode)
+	}
+	n := recNode{val: val, depth: parent.depth + 1, base: parent.base, parent: parent.val}
+	it.info[key] = n
+	it.result = n
+	it.containsValue = n.base
+	return true
+}
+
+// isAncestor checks if the node with a given key is on the path to the node n, or is the node itself.
+func (it *Recursive) isAncestor(key interface{}, n recNode) bool {
+	for {
+		if graph.ToKey(n.val) == key {
+			return true
+		}
+		if n.depth <= 1 {
+			return n.parent != nil && graph.ToKey(n.parent) == key
+		}
+		var ok bool
+		if n, ok = it.info[graph.ToKey(n.parent)]; !ok {
+			return false
 		}
-		at = it.seen[graph.ToKey(at.val)]
 	}
-	return at.val
+}
+
+func (it *Recursive) Err() error {
+	return it.err
+}
+
+func (it *Recursive) Result() graph.Value {
+	return it.result.val
 }
 
 func (it *Recursive) Contains(ctx context.Context, val graph.Value) bool {
 	graph.ContainsLogIn(it, val)
+	it.runstats.Contains += 1
 	it.pathIndex = 0
 	key := graph.ToKey(val)
-	if at, ok := it.seen[key]; ok {
-		it.containsValue = it.getBaseValue(val)
-		it.result.depth = at.depth
-		it.result.val = val
+	if n, ok := it.info[key]; ok {
+		it.result = n
+		it.containsValue = n.base
+		it.cycle = nil
 		return graph.ContainsLogOut(it, val, true)
 	}
+	if ok, err := it.seen.spilled(key); err != nil {
+		it.err = err
+		return graph.ContainsLogOut(it, val, false)
+	} else if ok {
+		// node info was dropped when spilling, so run the traversal again to find it
+		it.Reset()
+	}
 	for it.Next(ctx) {
-		if graph.ToKey(it.Result()) == key {
+		if it.cycle == nil && graph.ToKey(it.Result()) == key {
 			return graph.ContainsLogOut(it, val, true)
 		}
 	}
@@ -225,11 +460,17 @@ func (it *Recursive) Close() error {
 	if err != nil {
 		return err
 	}
+	if err = it.closeStack(); err != nil {
+		return err
+	}
 	err = it.nextIt.Close()
 	if err != nil {
 		return err
 	}
-	it.seen = nil
+	if err = it.seen.Close(); err != nil {
+		return err
+	}
+	it.info = nil
 	return it.err
 }
 
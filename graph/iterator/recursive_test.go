@@ -16,6 +16,7 @@ package iterator_test
 
 import (
 	"context"
+	"fmt"
 	"reflect"
 	"sort"
 	"testing"
@@ -118,3 +119,116 @@ func TestRecursiveNextPath(t *testing.T) {
 		t.Errorf("Failed to check NextPath, got: %v, expected: %v", got, expected)
 	}
 }
+
+func runRecursive(t *testing.T, r *Recursive) []string {
+	ctx := context.TODO()
+	qs := rec_test_qs
+	var got []string
+	for r.Next(ctx) {
+		res := make(map[string]graph.Value)
+		r.TagResults(res)
+		s := fmt.Sprintf("%s:%v", quad.ToString(qs.NameOf(r.Result())), quad.NativeOf(qs.NameOf(res["depth"])))
+		if c, ok := res["cycle"]; ok {
+			s += ">" + quad.ToString(qs.NameOf(c))
+		}
+		got = append(got, s)
+	}
+	if err := r.Err(); err != nil {
+		t.Fatal(err)
+	}
+	sort.Strings(got)
+	return got
+}
+
+var recursiveOptionsCases = []struct {
+	name      string
+	opt       RecursiveOptions
+	expect    []string
+	truncated bool
+}{
+	{
+		name:   "depth first",
+		opt:    RecursiveOptions{Strategy: DepthFirst},
+		expect: []string{"bob:1", "charlie:2", "dani:3", "emily:4"},
+	},
+	{
+		name:      "max depth",
+		opt:       RecursiveOptions{MaxDepth: 2},
+		expect:    []string{"bob:1", "charlie:2"},
+		truncated: true,
+	},
+	{
+		name:      "max depth dfs",
+		opt:       RecursiveOptions{MaxDepth: 2, Strategy: DepthFirst},
+		expect:    []string{"bob:1", "charlie:2"},
+		truncated: true,
+	},
+	{
+		name:   "no depth limit",
+		opt:    RecursiveOptions{MaxDepth: -1},
+		expect: []string{"bob:1", "charlie:2", "dani:3", "emily:4"},
+	},
+	{
+		name:      "max results",
+		opt:       RecursiveOptions{MaxResults: 3},
+		expect:    []string{"bob:1", "charlie:2", "dani:3"},
+		truncated: true,
+	},
+	{
+		name:   "cycles",
+		opt:    RecursiveOptions{CycleTags: []string{"cycle"}},
+		expect: []string{"bob:1", "charlie:2", "charlie:2>bob", "dani:3", "emily:4"},
+	},
+	{
+		name:   "cycles dfs",
+		opt:    RecursiveOptions{CycleTags: []string{"cycle"}, Strategy: DepthFirst},
+		expect: []string{"bob:1", "charlie:2", "charlie:2>bob", "dani:3", "emily:4"},
+	},
+	{
+		name:   "spill",
+		opt:    RecursiveOptions{Spill: SpillOptions{MaxValues: 2}},
+		expect: []string{"bob:1", "charlie:2", "dani:3", "emily:4"},
+	},
+}
+
+func TestRecursiveOptions(t *testing.T) {
+	qs := rec_test_qs
+	for _, c := range recursiveOptionsCases {
+		t.Run(c.name, func(t *testing.T) {
+			start := NewFixed(graph.PreFetched(quad.Raw("alice")))
+			r := NewRecursiveWithOptions(qs, start, singleHop("parent"), c.opt)
+			defer r.Close()
+			r.AddDepthTag("depth")
+			got := runRecursive(t, r)
+			if !reflect.DeepEqual(got, c.expect) {
+				t.Errorf("unexpected results, got: %v, expected: %v", got, c.expect)
+			}
+			if r.Truncated() != c.truncated {
+				t.Errorf("unexpected truncated flag: %v", r.Truncated())
+			}
+		})
+	}
+}
+
+func TestRecursiveContainsSpilled(t *testing.T) {
+	ctx := context.TODO()
+	qs := rec_test_qs
+	start := NewFixed(graph.PreFetched(quad.Raw("alice")))
+	r := NewRecursiveWithOptions(qs, start, singleHop("parent"), RecursiveOptions{
+		Spill: SpillOptions{MaxValues: 2},
+	})
+	defer r.Close()
+	r.AddDepthTag("depth")
+	if !r.Contains(ctx, qs.ValueOf(quad.Raw("emily"))) {
+		t.Fatal("expected to find a node")
+	}
+	// information about this node was moved to disk
+	if !r.Contains(ctx, qs.ValueOf(quad.Raw("bob"))) {
+		t.Fatal("expected to find a spilled node")
+	}
+	res := make(map[string]graph.Value)
+	r.TagResults(res)
+	if d := qs.NameOf(res["depth"]); d != quad.Int(1) {
+		t.Errorf("unexpected depth: %v", d)
+	}
+}
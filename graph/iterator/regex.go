@@ -66,9 +66,13 @@ func (it *Regex) AllowRefs(v bool) {
 	it.allowRefs = v
 }
 
-func (it *Regex) testRegex(val graph.Value) bool {
+func (it *Regex) testRegex(ctx context.Context, val graph.Value) bool {
+	v, err := graph.NameOf(ctx, it.qs, val)
+	if err != nil {
+		it.err = err
+		return false
+	}
 	// Type switch to avoid coercing and testing numeric types
-	v := it.qs.NameOf(val)
 	switch v := v.(type) {
 	case quad.String:
 		return it.re.MatchString(string(v))
@@ -114,9 +118,11 @@ func (it *Regex) Clone() graph.Iterator {
 func (it *Regex) Next(ctx context.Context) bool {
 	for it.subIt.Next(ctx) {
 		val := it.subIt.Result()
-		if it.testRegex(val) {
+		if it.testRegex(ctx, val) {
 			it.result = val
 			return true
+		} else if it.err != nil {
+			return false
 		}
 	}
 	it.err = it.subIt.Err()
@@ -138,8 +144,10 @@ func (it *Regex) NextPath(ctx context.Context) bool {
 			it.err = it.subIt.Err()
 			return false
 		}
-		if it.testRegex(it.subIt.Result()) {
+		if it.testRegex(ctx, it.subIt.Result()) {
 			break
+		} else if it.err != nil {
+			return false
 		}
 	}
 	it.result = it.subIt.Result()
@@ -151,14 +159,15 @@ func (it *Regex) SubIterators() []graph.Iterator {
 }
 
 func (it *Regex) Contains(ctx context.Context, val graph.Value) bool {
-	if !it.testRegex(val) {
+	if !it.testRegex(ctx, val) {
 		return false
 	}
-	ok := it.subIt.Contains(ctx, val)
-	if !ok {
+	if !it.subIt.Contains(ctx, val) {
 		it.err = it.subIt.Err()
+		return false
 	}
-	return ok
+	it.result = val
+	return true
 }
 
 // Registers the Regex iterator.
@@ -0,0 +1,358 @@
+// Copyright 2017 The Cayley Authors. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package iterator
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"hash/fnv"
+	"io"
+	"io/ioutil"
+	"math"
+	"os"
+	"sort"
+)
+
+// SpillOptions configures spilling of iterator state to disk.
+type SpillOptions struct {
+	// MaxValues is the maximal number of values an iterator can keep in memory.
+	// When exceeded, values are moved to temporary files, and Materialize stops caching results.
+	// Zero disables spilling. Materialize never keeps more than MaterializeLimit values.
+	MaxValues int
+	// Dir is a directory for temporary files. Default temporary directory is used if empty.
+	Dir string
+}
+
+// Spill is a global configuration for spilling iterator state to disk.
+var Spill SpillOptions
+
+const (
+	spillKeySize = 16               // size of a hashed key in spill files
+	spillRecSize = spillKeySize + 8 // size of an index record: a hashed key and an offset of the key
+	spillMaxRuns = 8                // merge spill files when there are more of them
+)
+
+type spillKey [spillKeySize]byte
+
+// encodeKey serializes a value key. Spilled keys are compared by their serialized form.
+func encodeKey(k interface{}) []byte {
+	return []byte(fmt.Sprintf("%T:%#v", k, k))
+}
+
+// hashKey returns a hash of a serialized key that is used to sort spill files.
+func hashKey(b []byte) (h spillKey) {
+	f := fnv.New128a()
+	f.Write(b)
+	f.Sum(h[:0])
+	return
+}
+
+// spillSet is a set of value keys that is moved to disk when it grows above
+// the limit. Keys are kept in memory as is, while spilled keys are serialized
+// and sorted by their 128 bit hashes. Keys with the same hash are compared in full.
+type spillSet struct {
+	opt  SpillOptions
+	mem  map[interface{}]struct{}
+	runs []*spillRun
+}
+
+func newSpillSet(opt SpillOptions) *spillSet {
+	return &spillSet{opt: opt, mem: make(map[interface{}]struct{})}
+}
+
+// Add adds a key to the set. It returns false if the key is already in the set.
+func (s *spillSet) Add(k interface{}) (bool, error) {
+	if _, ok := s.mem[k]; ok {
+		return false, nil
+	}
+	if ok, err := s.spilled(k); err != nil || ok {
+		return false, err
+	}
+	s.mem[k] = struct{}{}
+	if s.opt.MaxValues > 0 && len(s.mem) >= s.opt.MaxValues {
+		if err := s.spill(); err != nil {
+			return false, err
+		}
+	}
+	return true, nil
+}
+
+// spilled checks if the key was moved to disk.
+func (s *spillSet) spilled(k interface{}) (bool, error) {
+	if len(s.runs) == 0 {
+		return false, nil
+	}
+	b := encodeKey(k)
+	h := hashKey(b)
+	for _, r := range s.runs {
+		if ok, err := r.Contains(h, b); err != nil || ok {
+			return ok, err
+		}
+	}
+	return false, nil
+}
+
+// spillEntry is a serialized key with its hash.
+type spillEntry struct {
+	h   spillKey
+	key []byte
+}
+
+func (e *spillEntry) less(e2 *spillEntry) bool {
+	if c := bytes.Compare(e.h[:], e2.h[:]); c != 0 {
+		return c < 0
+	}
+	return bytes.Compare(e.key, e2.key) < 0
+}
+
+// spill writes all in-memory keys to a new sorted file.
+func (s *spillSet) spill() error {
+	keys := make([]spillEntry, 0, len(s.mem))
+	for k := range s.mem {
+		b := encodeKey(k)
+		keys = append(keys, spillEntry{h: hashKey(b), key: b})
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		return keys[i].less(&keys[j])
+	})
+	r, err := s.writeRun(func(add func(e *spillEntry) error) error {
+		for i := range keys {
+			if err := add(&keys[i]); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	s.mem = make(map[interface{}]struct{})
+	s.runs = append(s.runs, r)
+	if len(s.runs) > spillMaxRuns {
+		return s.merge()
+	}
+	return nil
+}
+
+func (s *spillSet) tempFile() (*os.File, error) {
+	return ioutil.TempFile(s.opt.Dir, "cayley-spill-")
+}
+
+// writeRun creates a new spill file. Entries must be added in sorted order.
+func (s *spillSet) writeRun(write func(add func(e *spillEntry) error) error) (*spillRun, error) {
+	idx, err := s.tempFile()
+	if err != nil {
+		return nil, err
+	}
+	data, err := s.tempFile()
+	if err != nil {
+		removeFile(idx)
+		return nil, err
+	}
+	r := &spillRun{idx: idx, data: data}
+	var (
+		iw  = bufio.NewWriter(idx)
+		dw  = bufio.NewWriter(data)
+		off int64
+		rec [spillRecSize]byte
+		buf [binary.MaxVarintLen64]byte
+	)
+	err = write(func(e *spillEntry) error {
+		copy(rec[:], e.h[:])
+		binary.BigEndian.PutUint64(rec[spillKeySize:], uint64(off))
+		if _, err := iw.Write(rec[:]); err != nil {
+			return err
+		}
+		n := binary.PutUvarint(buf[:], uint64(len(e.key)))
+		if _, err := dw.Write(buf[:n]); err != nil {
+			return err
+		}
+		if _, err := dw.Write(e.key); err != nil {
+			return err
+		}
+		off += int64(n + len(e.key))
+		r.n++
+		return nil
+	})
+	if err == nil {
+		err = iw.Flush()
+	}
+	if err == nil {
+		err = dw.Flush()
+	}
+	if err != nil {
+		r.Close()
+		return nil, err
+	}
+	return r, nil
+}
+
+// merge combines all spill files into a single one.
+func (s *spillSet) merge() error {
+	type head struct {
+		idx, data *bufio.Reader
+		e         spillEntry
+		ok        bool
+	}
+	heads := make([]*head, 0, len(s.runs))
+	next := func(h *head) error {
+		var rec [spillRecSize]byte
+		_, err := io.ReadFull(h.idx, rec[:])
+		if err == io.EOF {
+			h.ok = false
+			return nil
+		} else if err != nil {
+			return err
+		}
+		copy(h.e.h[:], rec[:])
+		// keys are stored in the same order as the index
+		h.e.key, err = readKey(h.data)
+		h.ok = err == nil
+		return err
+	}
+	for _, r := range s.runs {
+		h := &head{
+			idx:  bufio.NewReader(io.NewSectionReader(r.idx, 0, r.n*spillRecSize)),
+			data: bufio.NewReader(io.NewSectionReader(r.data, 0, math.MaxInt64)),
+		}
+		if err := next(h); err != nil {
+			return err
+		}
+		heads = append(heads, h)
+	}
+	r, err := s.writeRun(func(add func(e *spillEntry) error) error {
+		for {
+			var min *head
+			for _, h := range heads {
+				if h.ok && (min == nil || h.e.less(&min.e)) {
+					min = h
+				}
+			}
+			if min == nil {
+				return nil
+			}
+			// keys are never added twice, thus runs have no duplicates
+			if err := add(&min.e); err != nil {
+				return err
+			}
+			if err := next(min); err != nil {
+				return err
+			}
+		}
+	})
+	if err != nil {
+		return err
+	}
+	for _, old := range s.runs {
+		old.Close()
+	}
+	s.runs = []*spillRun{r}
+	return nil
+}
+
+// Close removes all temporary files.
+func (s *spillSet) Close() error {
+	var last error
+	for _, r := range s.runs {
+		if err := r.Close(); err != nil {
+			last = err
+		}
+	}
+	s.runs = nil
+	s.mem = nil
+	return last
+}
+
+// readKey reads a single serialized key prefixed with its length.
+func readKey(r *bufio.Reader) ([]byte, error) {
+	n, err := binary.ReadUvarint(r)
+	if err != nil {
+		return nil, err
+	}
+	b := make([]byte, n)
+	if _, err = io.ReadFull(r, b); err != nil {
+		return nil, err
+	}
+	return b, nil
+}
+
+// spillRun is a pair of temporary files with unique keys. Index file has fixed-size records
+// sorted by the hash of keys, and each record points to a serialized key in the data file.
+type spillRun struct {
+	idx  *os.File
+	data *os.File
+	n    int64
+}
+
+// record reads the hash and the offset of the i-th key in the index.
+func (r *spillRun) record(i int64) (h spillKey, off int64, err error) {
+	var rec [spillRecSize]byte
+	if _, err = r.idx.ReadAt(rec[:], i*spillRecSize); err != nil {
+		return
+	}
+	copy(h[:], rec[:])
+	off = int64(binary.BigEndian.Uint64(rec[spillKeySize:]))
+	return
+}
+
+// Contains checks if the key is in the file with a binary search by its hash.
+func (r *spillRun) Contains(h spillKey, key []byte) (bool, error) {
+	var err error
+	i := sort.Search(int(r.n), func(i int) bool {
+		if err != nil {
+			return true
+		}
+		var h2 spillKey
+		h2, _, err = r.record(int64(i))
+		return bytes.Compare(h2[:], h[:]) >= 0
+	})
+	if err != nil {
+		return false, err
+	}
+	// hashes might collide, so compare all keys with the same hash
+	for ; int64(i) < r.n; i++ {
+		h2, off, err := r.record(int64(i))
+		if err != nil {
+			return false, err
+		} else if h2 != h {
+			return false, nil
+		}
+		key2, err := readKey(bufio.NewReader(io.NewSectionReader(r.data, off, math.MaxInt64-off)))
+		if err != nil {
+			return false, err
+		} else if bytes.Equal(key, key2) {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+func (r *spillRun) Close() error {
+	err := removeFile(r.idx)
+	if err2 := removeFile(r.data); err == nil {
+		err = err2
+	}
+	return err
+}
+
+func removeFile(f *os.File) error {
+	err := f.Close()
+	if err2 := os.Remove(f.Name()); err == nil {
+		err = err2
+	}
+	return err
+}
@@ -0,0 +1,91 @@
+// Copyright 2017 The Cayley Authors. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package iterator
+
+import (
+	"io/ioutil"
+	"os"
+	"testing"
+)
+
+func TestSpillHashCollision(t *testing.T) {
+	dir, err := ioutil.TempDir("", "cayley_test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	s := newSpillSet(SpillOptions{MaxValues: 2, Dir: dir})
+	defer s.Close()
+
+	// write keys with the same hash directly, since FNV collisions are hard to find
+	var h spillKey
+	h[0] = 1
+	entries := []spillEntry{
+		{h: h, key: []byte("a")},
+		{h: h, key: []byte("c")},
+	}
+	r, err := s.writeRun(func(add func(e *spillEntry) error) error {
+		for i := range entries {
+			if err := add(&entries[i]); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	s.runs = append(s.runs, r)
+	for _, c := range []struct {
+		key    string
+		expect bool
+	}{
+		{"a", true},
+		{"b", false},
+		{"c", true},
+	} {
+		ok, err := r.Contains(h, []byte(c.key))
+		if err != nil {
+			t.Fatal(err)
+		} else if ok != c.expect {
+			t.Errorf("unexpected result for %q: %v", c.key, ok)
+		}
+	}
+
+	// spilled keys must survive a merge
+	for i := 0; i < 2*spillMaxRuns*2; i++ {
+		if ok, err := s.Add(i); err != nil {
+			t.Fatal(err)
+		} else if !ok {
+			t.Fatalf("key %d is reported as a duplicate", i)
+		}
+	}
+	if len(s.runs) > spillMaxRuns {
+		t.Fatalf("expected runs to be merged, got %d", len(s.runs))
+	}
+	for i := 0; i < 2*spillMaxRuns*2; i++ {
+		if ok, err := s.Add(i); err != nil {
+			t.Fatal(err)
+		} else if ok {
+			t.Fatalf("key %d is not found after a merge", i)
+		}
+	}
+	if ok, err := s.runs[0].Contains(h, []byte("c")); err != nil || !ok {
+		t.Fatalf("colliding key is lost after a merge: %v, %v", ok, err)
+	}
+	if ok, err := s.spilled("x"); err != nil || ok {
+		t.Fatalf("unexpected key: %v, %v", ok, err)
+	}
+}
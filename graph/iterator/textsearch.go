@@ -0,0 +1,200 @@
+package iterator
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/cayleygraph/cayley/graph"
+)
+
+var _ graph.Iterator = &TextSearch{}
+
+// textSearchPage is the number of results loaded from a text index by a single request.
+const textSearchPage = 100
+
+// TextSearch iterates over nodes with string values that match a full-text query.
+// Results are loaded from the index lazily, one page at a time, and are returned in order of relevance.
+type TextSearch struct {
+	uid   uint64
+	tags  graph.Tagger
+	qs    graph.QuadStore
+	idx   graph.TextIndexer
+	query string
+	limit int
+
+	vals   []graph.Value            // nodes loaded from the index so far
+	seen   map[interface{}]struct{} // keys of loaded nodes
+	off    int                      // number of search results loaded so far
+	done   bool                     // all results were loaded
+	ind    int
+	result graph.Value
+	err    error
+}
+
+// NewTextSearch creates an iterator that returns nodes matching a full-text query.
+// Zero or negative limit means no limit.
+func NewTextSearch(qs graph.QuadStore, idx graph.TextIndexer, query string, limit int) *TextSearch {
+	return &TextSearch{
+		uid:   NextUID(),
+		qs:    qs,
+		idx:   idx,
+		query: query,
+		limit: limit,
+		seen:  make(map[interface{}]struct{}),
+	}
+}
+
+// loadPage loads the next page of search results.
+func (it *TextSearch) loadPage(ctx context.Context) error {
+	n := textSearchPage
+	if it.limit > 0 && it.limit-it.off < n {
+		n = it.limit - it.off
+	}
+	vals, err := it.idx.SearchText(ctx, it.query, it.off, n)
+	if err != nil {
+		return err
+	}
+	it.off += len(vals)
+	if len(vals) < n || (it.limit > 0 && it.off >= it.limit) {
+		it.done = true
+	}
+	for _, v := range vals {
+		// value might be already removed from the graph
+		ref, err := graph.ValueOf(ctx, it.qs, v)
+		if err != nil {
+			return err
+		} else if ref == nil {
+			continue
+		}
+		key := graph.ToKey(ref)
+		if _, ok := it.seen[key]; ok {
+			continue
+		}
+		it.seen[key] = struct{}{}
+		it.vals = append(it.vals, ref)
+	}
+	return nil
+}
+
+func (it *TextSearch) UID() uint64 {
+	return it.uid
+}
+
+func (it *TextSearch) Reset() {
+	it.ind = 0
+	it.result = nil
+	it.err = nil
+}
+
+func (it *TextSearch) Close() error {
+	it.vals, it.seen = nil, nil
+	return nil
+}
+
+func (it *TextSearch) Tagger() *graph.Tagger {
+	return &it.tags
+}
+
+func (it *TextSearch) TagResults(dst map[string]graph.Value) {
+	it.tags.TagResult(dst, it.Result())
+}
+
+func (it *TextSearch) Clone() graph.Iterator {
+	out := NewTextSearch(it.qs, it.idx, it.query, it.limit)
+	out.tags.CopyFrom(it)
+	return out
+}
+
+func (it *TextSearch) String() string {
+	return fmt.Sprintf("TextSearch(%q, %d)", it.query, it.limit)
+}
+
+func (it *TextSearch) Type() graph.Type { return graph.TextSearch }
+
+func (it *TextSearch) Next(ctx context.Context) bool {
+	graph.NextLogIn(it)
+	for it.ind >= len(it.vals) {
+		if it.done || it.err != nil {
+			return graph.NextLogOut(it, false)
+		}
+		if err := it.loadPage(ctx); err != nil {
+			it.err = err
+			return graph.NextLogOut(it, false)
+		}
+	}
+	it.result = it.vals[it.ind]
+	it.ind++
+	return graph.NextLogOut(it, true)
+}
+
+// Contains checks if a node matches the query. It may load all search results.
+func (it *TextSearch) Contains(ctx context.Context, v graph.Value) bool {
+	graph.ContainsLogIn(it, v)
+	key := graph.ToKey(v)
+	if _, ok := it.seen[key]; ok {
+		it.result = v
+		return graph.ContainsLogOut(it, v, true)
+	}
+	if it.done || it.err != nil {
+		return graph.ContainsLogOut(it, v, false)
+	}
+	// only string values can match, so there is no need to load the results
+	if name, err := graph.NameOf(ctx, it.qs, v); err != nil {
+		it.err = err
+		return graph.ContainsLogOut(it, v, false)
+	} else if name == nil || !graph.IsTextValue(name) {
+		return graph.ContainsLogOut(it, v, false)
+	}
+	for !it.done {
+		if err := it.loadPage(ctx); err != nil {
+			it.err = err
+			return graph.ContainsLogOut(it, v, false)
+		}
+		if _, ok := it.seen[key]; ok {
+			it.result = v
+			return graph.ContainsLogOut(it, v, true)
+		}
+	}
+	return graph.ContainsLogOut(it, v, false)
+}
+
+func (it *TextSearch) Err() error {
+	return it.err
+}
+
+func (it *TextSearch) Result() graph.Value {
+	return it.result
+}
+
+func (it *TextSearch) NextPath(ctx context.Context) bool {
+	return false
+}
+
+func (it *TextSearch) SubIterators() []graph.Iterator {
+	return nil
+}
+
+func (it *TextSearch) Optimize() (graph.Iterator, bool) {
+	return it, false
+}
+
+// Size returns the number of results if all of them were loaded, or an estimate otherwise.
+func (it *TextSearch) Size() (int64, bool) {
+	if it.done {
+		return int64(len(it.vals)), true
+	}
+	if it.limit > 0 {
+		return int64(it.limit), false
+	}
+	return textSearchPage, false
+}
+
+func (it *TextSearch) Stats() graph.IteratorStats {
+	s, exact := it.Size()
+	return graph.IteratorStats{
+		ContainsCost: 1,
+		NextCost:     1,
+		Size:         s,
+		ExactSize:    exact,
+	}
+}
@@ -9,6 +9,8 @@ import (
 var _ graph.Iterator = &Unique{}
 
 // Unique iterator removes duplicate values from it's subiterator.
+//
+// Set of seen values is moved to disk if it grows above the limit set in Spill.
 type Unique struct {
 	uid      uint64
 	tags     graph.Tagger
@@ -16,14 +18,14 @@ type Unique struct {
 	result   graph.Value
 	runstats graph.IteratorStats
 	err      error
-	seen     map[interface{}]bool
+	seen     *spillSet
 }
 
 func NewUnique(subIt graph.Iterator) *Unique {
 	return &Unique{
 		uid:   NextUID(),
 		subIt: subIt,
-		seen:  make(map[interface{}]bool),
+		seen:  newSpillSet(Spill),
 	}
 }
 
@@ -35,7 +37,11 @@ func (it *Unique) UID() uint64 {
 func (it *Unique) Reset() {
 	it.result = nil
 	it.subIt.Reset()
-	it.seen = make(map[interface{}]bool)
+	it.err = nil
+	if it.seen != nil {
+		it.seen.Close()
+	}
+	it.seen = newSpillSet(Spill)
 }
 
 func (it *Unique) Tagger() *graph.Tagger {
@@ -70,10 +76,12 @@ func (it *Unique) Next(ctx context.Context) bool {
 
 	for it.subIt.Next(ctx) {
 		curr := it.subIt.Result()
-		key := graph.ToKey(curr)
-		if ok := it.seen[key]; !ok {
+		ok, err := it.seen.Add(graph.ToKey(curr))
+		if err != nil {
+			it.err = err
+			return graph.NextLogOut(it, false)
+		} else if ok {
 			it.result = curr
-			it.seen[key] = true
 			return graph.NextLogOut(it, true)
 		}
 	}
@@ -94,7 +102,11 @@ func (it *Unique) Result() graph.Value {
 func (it *Unique) Contains(ctx context.Context, val graph.Value) bool {
 	graph.ContainsLogIn(it, val)
 	it.runstats.Contains += 1
-	return graph.ContainsLogOut(it, val, it.subIt.Contains(ctx, val))
+	ok := it.subIt.Contains(ctx, val)
+	if ok {
+		it.result = val
+	}
+	return graph.ContainsLogOut(it, val, ok)
 }
 
 // NextPath for unique always returns false. If we were to return multiple
@@ -106,7 +118,10 @@ func (it *Unique) NextPath(ctx context.Context) bool {
 
 // Close closes the primary iterators.
 func (it *Unique) Close() error {
-	it.seen = nil
+	if it.seen != nil {
+		it.seen.Close()
+		it.seen = nil
+	}
 	return it.subIt.Close()
 }
 
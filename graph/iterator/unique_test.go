@@ -2,6 +2,8 @@ package iterator_test
 
 import (
 	"context"
+	"io/ioutil"
+	"os"
 	"reflect"
 	"testing"
 
@@ -34,3 +36,34 @@ func TestUniqueIteratorBasics(t *testing.T) {
 		}
 	}
 }
+
+func TestUniqueIteratorSpill(t *testing.T) {
+	defer func(opt SpillOptions) {
+		Spill = opt
+	}(Spill)
+	dir, err := ioutil.TempDir("", "cayley_test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	Spill = SpillOptions{MaxValues: 3, Dir: dir}
+
+	allIt := NewFixed()
+	var expect []int
+	for i := 0; i < 50; i++ {
+		expect = append(expect, i)
+		allIt.Add(Int64Node(i))
+	}
+	for i := 49; i >= 0; i-- {
+		allIt.Add(Int64Node(i))
+	}
+
+	u := NewUnique(allIt)
+	defer u.Close()
+	if got := iterated(u); !reflect.DeepEqual(got, expect) {
+		t.Errorf("Failed to iterate Unique correctly: got:%v expected:%v", got, expect)
+	}
+	if err := u.Err(); err != nil {
+		t.Fatal(err)
+	}
+}
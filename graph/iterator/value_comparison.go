@@ -77,8 +77,12 @@ func (it *Comparison) Operator() Operator { return it.op }
 
 // Here's the non-boilerplate part of the ValueComparison iterator. Given a value
 // and our operator, determine whether or not we meet the requirement.
-func (it *Comparison) doComparison(val graph.Value) bool {
-	qval := it.qs.NameOf(val)
+func (it *Comparison) doComparison(ctx context.Context, val graph.Value) bool {
+	qval, err := graph.NameOf(ctx, it.qs, val)
+	if err != nil {
+		it.err = err
+		return false
+	}
 	switch cVal := it.val.(type) {
 	case quad.Int:
 		if cVal2, ok := qval.(quad.Int); ok {
@@ -198,9 +202,11 @@ func (it *Comparison) Clone() graph.Iterator {
 func (it *Comparison) Next(ctx context.Context) bool {
 	for it.subIt.Next(ctx) {
 		val := it.subIt.Result()
-		if it.doComparison(val) {
+		if it.doComparison(ctx, val) {
 			it.result = val
 			return true
+		} else if it.err != nil {
+			return false
 		}
 	}
 	it.err = it.subIt.Err()
@@ -222,8 +228,10 @@ func (it *Comparison) NextPath(ctx context.Context) bool {
 			it.err = it.subIt.Err()
 			return false
 		}
-		if it.doComparison(it.subIt.Result()) {
+		if it.doComparison(ctx, it.subIt.Result()) {
 			break
+		} else if it.err != nil {
+			return false
 		}
 	}
 	it.result = it.subIt.Result()
@@ -235,14 +243,15 @@ func (it *Comparison) SubIterators() []graph.Iterator {
 }
 
 func (it *Comparison) Contains(ctx context.Context, val graph.Value) bool {
-	if !it.doComparison(val) {
+	if !it.doComparison(ctx, val) {
 		return false
 	}
-	ok := it.subIt.Contains(ctx, val)
-	if !ok {
+	if !it.subIt.Contains(ctx, val) {
 		it.err = it.subIt.Err()
+		return false
 	}
-	return ok
+	it.result = val
+	return true
 }
 
 // If we failed the check, then the subiterator should not contribute to the result
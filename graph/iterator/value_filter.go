@@ -0,0 +1,167 @@
+// Copyright 2017 The Cayley Authors. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package iterator
+
+import (
+	"context"
+
+	"github.com/cayleygraph/cayley/graph"
+	"github.com/cayleygraph/cayley/quad"
+)
+
+var _ graph.Iterator = &ValueFilter{}
+
+// ValueFilterFunc checks if a value passes the filter.
+type ValueFilterFunc func(quad.Value) bool
+
+// ValueFilter is a filter that passes only values accepted by a given function.
+type ValueFilter struct {
+	uid    uint64
+	tags   graph.Tagger
+	subIt  graph.Iterator
+	name   string
+	filter ValueFilterFunc
+	qs     graph.QuadStore
+	result graph.Value
+	err    error
+}
+
+// NewValueFilter creates a filter iterator. Name is only used to describe the iterator.
+func NewValueFilter(sub graph.Iterator, qs graph.QuadStore, name string, filter ValueFilterFunc) *ValueFilter {
+	return &ValueFilter{
+		uid:    NextUID(),
+		subIt:  sub,
+		name:   name,
+		filter: filter,
+		qs:     qs,
+	}
+}
+
+func (it *ValueFilter) UID() uint64 {
+	return it.uid
+}
+
+func (it *ValueFilter) test(ctx context.Context, val graph.Value) bool {
+	v, err := graph.NameOf(ctx, it.qs, val)
+	if err != nil {
+		it.err = err
+		return false
+	}
+	return it.filter(v)
+}
+
+func (it *ValueFilter) Close() error {
+	return it.subIt.Close()
+}
+
+func (it *ValueFilter) Reset() {
+	it.subIt.Reset()
+	it.err = nil
+	it.result = nil
+}
+
+func (it *ValueFilter) Tagger() *graph.Tagger {
+	return &it.tags
+}
+
+func (it *ValueFilter) Clone() graph.Iterator {
+	out := NewValueFilter(it.subIt.Clone(), it.qs, it.name, it.filter)
+	out.tags.CopyFrom(it)
+	return out
+}
+
+func (it *ValueFilter) Next(ctx context.Context) bool {
+	for it.subIt.Next(ctx) {
+		val := it.subIt.Result()
+		if it.test(ctx, val) {
+			it.result = val
+			return true
+		} else if it.err != nil {
+			return false
+		}
+	}
+	it.err = it.subIt.Err()
+	return false
+}
+
+func (it *ValueFilter) Err() error {
+	return it.err
+}
+
+func (it *ValueFilter) Result() graph.Value {
+	return it.result
+}
+
+func (it *ValueFilter) NextPath(ctx context.Context) bool {
+	for {
+		if !it.subIt.NextPath(ctx) {
+			it.err = it.subIt.Err()
+			return false
+		}
+		if it.test(ctx, it.subIt.Result()) {
+			break
+		} else if it.err != nil {
+			return false
+		}
+	}
+	it.result = it.subIt.Result()
+	return true
+}
+
+func (it *ValueFilter) SubIterators() []graph.Iterator {
+	return []graph.Iterator{it.subIt}
+}
+
+func (it *ValueFilter) Contains(ctx context.Context, val graph.Value) bool {
+	if !it.test(ctx, val) {
+		return false
+	}
+	if !it.subIt.Contains(ctx, val) {
+		it.err = it.subIt.Err()
+		return false
+	}
+	it.result = val
+	return true
+}
+
+func (it *ValueFilter) Type() graph.Type {
+	return graph.ValueFilter
+}
+
+func (it *ValueFilter) String() string {
+	return "ValueFilter(" + it.name + ")"
+}
+
+func (it *ValueFilter) Optimize() (graph.Iterator, bool) {
+	newSub, changed := it.subIt.Optimize()
+	if changed {
+		it.subIt.Close()
+		it.subIt = newSub
+	}
+	return it, false
+}
+
+func (it *ValueFilter) Stats() graph.IteratorStats {
+	return it.subIt.Stats()
+}
+
+func (it *ValueFilter) TagResults(dst map[string]graph.Value) {
+	it.tags.TagResult(dst, it.Result())
+	it.subIt.TagResults(dst)
+}
+
+func (it *ValueFilter) Size() (int64, bool) {
+	return 0, false
+}
@@ -0,0 +1,406 @@
+// Copyright 2017 The Cayley Authors. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package journal implements an append-only journal of deltas applied to a quad store.
+//
+// Journal can be attached to any backend. Each set of deltas is written to the journal before it is
+// applied to the store, followed by a commit or rollback record after the store returns. Sets of deltas
+// are numbered with increasing horizons, thus the journal can be tailed from a given horizon to replicate
+// changes to another store.
+//
+// The journal is a patch (see graph/patch) with additional records in comments:
+//
+//	# tx 1 2017-06-01T10:00:00Z
+//	+ <alice> <follows> <bob> .
+//	# commit 1
+//
+// Ignore options the deltas were applied with are listed after the time, e.g. "# tx 2 <time> ignore_dup".
+//
+// Transactions without a commit record are not returned by readers. They were either rolled back,
+// or the process has crashed before the store returned, in which case changes may still be in the store.
+package journal
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/cayleygraph/cayley/graph"
+	"github.com/cayleygraph/cayley/graph/patch"
+	"github.com/cayleygraph/cayley/graph/shape"
+	"github.com/cayleygraph/cayley/quad"
+)
+
+const (
+	recTx       = "tx"
+	recCommit   = "commit"
+	recRollback = "rollback"
+
+	optIgnoreDup     = "ignore_dup"
+	optIgnoreMissing = "ignore_missing"
+)
+
+// ErrClosed is returned when writing to a closed journal.
+var ErrClosed = errors.New("journal: closed")
+
+// Entry is a set of deltas applied to the store in a single call.
+type Entry struct {
+	Horizon int64
+	Time    time.Time
+	Opts    graph.IgnoreOpts
+	Deltas  []graph.Delta
+}
+
+// Journal is an append-only log of applied deltas, stored in a file.
+type Journal struct {
+	path   string
+	nosync bool
+
+	mu      sync.Mutex
+	f       *os.File
+	w       *patch.Writer
+	next    int64
+	changed chan struct{}
+	closed  bool
+}
+
+// Open opens a journal file, creating it if necessary. If nosync is set, the file is not synced to disk
+// after each transaction.
+//
+// A partially written record at the end of the file is removed.
+func Open(path string, nosync bool) (*Journal, error) {
+	f, err := os.OpenFile(path, os.O_RDWR|os.O_CREATE, 0644)
+	if err != nil {
+		return nil, err
+	}
+	last, size, err := scan(f)
+	if err != nil {
+		f.Close()
+		return nil, err
+	}
+	if err = f.Truncate(size); err != nil {
+		f.Close()
+		return nil, err
+	} else if _, err = f.Seek(size, io.SeekStart); err != nil {
+		f.Close()
+		return nil, err
+	}
+	return &Journal{
+		path: path, nosync: nosync,
+		f: f, w: patch.NewWriter(f),
+		next:    last + 1,
+		changed: make(chan struct{}),
+	}, nil
+}
+
+// scan returns the last horizon written to the journal and the size of its complete lines.
+func scan(f *os.File) (int64, int64, error) {
+	var (
+		last, size int64
+		r          = bufio.NewReader(f)
+	)
+	for {
+		line, err := r.ReadBytes('\n')
+		if err == io.EOF {
+			return last, size, nil
+		} else if err != nil {
+			return 0, 0, err
+		}
+		size += int64(len(line))
+		if typ, h, ok := parseRecord(string(bytes.TrimSpace(line))); ok && typ == recTx && h > last {
+			last = h
+		}
+	}
+}
+
+// Path returns the path of the journal file.
+func (j *Journal) Path() string {
+	return j.path
+}
+
+// Horizon returns a horizon that will be assigned to the next transaction.
+func (j *Journal) Horizon() int64 {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	return j.next
+}
+
+// Middleware returns a writer middleware that records deltas in the journal.
+//
+// Deltas are written before they are applied, and the journal is locked until the store returns,
+// thus horizons are assigned in the same order as changes are applied. This serializes all writes.
+func (j *Journal) Middleware() graph.WriterMiddleware {
+	return func(next graph.ApplyDeltasFunc) graph.ApplyDeltasFunc {
+		return func(in []graph.Delta, opts graph.IgnoreOpts) error {
+			return j.apply(in, opts, func() error {
+				return next(in, opts)
+			})
+		}
+	}
+}
+
+// apply records deltas in the journal and calls fnc to apply them to the store.
+func (j *Journal) apply(in []graph.Delta, opts graph.IgnoreOpts, fnc func() error) error {
+	return j.tx(opts, func(w *patch.Writer) error {
+		if err := writeDeltas(w, in); err != nil {
+			return err
+		}
+		return w.Flush()
+	}, fnc)
+}
+
+// tx records a transaction in the journal. Deltas are written by write before fnc applies them to the store,
+// or by fnc itself if write is nil. The journal is locked until fnc returns.
+func (j *Journal) tx(opts graph.IgnoreOpts, write func(w *patch.Writer) error, fnc func() error) error {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	if j.closed {
+		return ErrClosed
+	}
+	h := j.next
+	if err := writeTxHeader(j.w, h, time.Now(), opts); err != nil {
+		return err
+	}
+	if write != nil {
+		if err := write(j.w); err != nil {
+			return err
+		}
+	}
+	j.next++
+	err := fnc()
+	rec := recCommit
+	if err != nil {
+		rec = recRollback
+	}
+	if werr := j.writeRecord(rec, h); werr != nil && err == nil {
+		// store was changed, but we cannot record it
+		return fmt.Errorf("journal: cannot commit transaction %d: %v", h, werr)
+	}
+	if err == nil {
+		close(j.changed)
+		j.changed = make(chan struct{})
+	}
+	return err
+}
+
+func writeTxHeader(w *patch.Writer, h int64, t time.Time, opts graph.IgnoreOpts) error {
+	rec := fmt.Sprintf("%s %d %s", recTx, h, t.UTC().Format(time.RFC3339Nano))
+	if opts.IgnoreDup {
+		rec += " " + optIgnoreDup
+	}
+	if opts.IgnoreMissing {
+		rec += " " + optIgnoreMissing
+	}
+	return w.WriteComment(rec)
+}
+
+func writeDeltas(w *patch.Writer, in []graph.Delta) error {
+	for _, d := range in {
+		if err := w.WriteDelta(d); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// WriteEntry writes a committed entry in the journal format, thus it can be read with NewReader.
+func WriteEntry(w *patch.Writer, e *Entry) error {
+	if err := writeTxHeader(w, e.Horizon, e.Time, e.Opts); err != nil {
+		return err
+	} else if err = writeDeltas(w, e.Deltas); err != nil {
+		return err
+	}
+	return w.WriteComment(fmt.Sprintf("%s %d", recCommit, e.Horizon))
+}
+
+func (j *Journal) writeRecord(rec string, h int64) error {
+	if err := j.w.WriteComment(fmt.Sprintf("%s %d", rec, h)); err != nil {
+		return err
+	} else if err = j.w.Flush(); err != nil {
+		return err
+	}
+	if j.nosync {
+		return nil
+	}
+	return j.f.Sync()
+}
+
+// wait returns a channel that is closed after the next commit, or when the journal is closed.
+func (j *Journal) wait() (<-chan struct{}, bool) {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	return j.changed, j.closed
+}
+
+// Close closes the journal file. Tailing readers return after reading all committed entries.
+func (j *Journal) Close() error {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	if j.closed {
+		return nil
+	}
+	j.closed = true
+	close(j.changed)
+	err := j.w.Flush()
+	if err2 := j.f.Close(); err == nil {
+		err = err2
+	}
+	return err
+}
+
+// QuadStore is a quad store that records all changes in a journal.
+//
+// Optional interfaces of the underlying store are available through graph.Unwrapper. Conditional writes
+// and bulk loads are recorded in the journal as well.
+type QuadStore struct {
+	graph.QuadStore
+	j     *Journal
+	apply graph.ApplyDeltasFunc
+}
+
+// Wrap returns a quad store that records all changes in a journal. Closing the store closes the journal.
+func Wrap(qs graph.QuadStore, j *Journal) *QuadStore {
+	return &QuadStore{QuadStore: qs, j: j, apply: j.Middleware()(qs.ApplyDeltas)}
+}
+
+var (
+	_ graph.Unwrapper        = (*QuadStore)(nil)
+	_ graph.Versioned        = (*QuadStore)(nil)
+	_ graph.BulkLoader       = (*QuadStore)(nil)
+	_ graph.ContextQuadStore = (*QuadStore)(nil)
+	_ shape.Optimizer        = (*QuadStore)(nil)
+	_ shape.Rewriter         = (*QuadStore)(nil)
+)
+
+// Journal returns the journal of the store.
+func (qs *QuadStore) Journal() *Journal {
+	return qs.j
+}
+
+// Unwrap implements graph.Unwrapper.
+func (qs *QuadStore) Unwrap() graph.QuadStore {
+	return qs.QuadStore
+}
+
+func (qs *QuadStore) ApplyDeltas(in []graph.Delta, opts graph.IgnoreOpts) error {
+	return qs.apply(in, opts)
+}
+
+func (qs *QuadStore) ValueOfContext(ctx context.Context, v quad.Value) (graph.Value, error) {
+	return graph.ValueOf(ctx, qs.QuadStore, v)
+}
+
+func (qs *QuadStore) NameOfContext(ctx context.Context, v graph.Value) (quad.Value, error) {
+	return graph.NameOf(ctx, qs.QuadStore, v)
+}
+
+func (qs *QuadStore) QuadContext(ctx context.Context, v graph.Value) (quad.Quad, error) {
+	return graph.QuadOf(ctx, qs.QuadStore, v)
+}
+
+func (qs *QuadStore) SizeContext(ctx context.Context) (int64, error) {
+	return graph.SizeOf(ctx, qs.QuadStore)
+}
+
+// OptimizeShape implements shape.Optimizer by passing shapes to the underlying store.
+func (qs *QuadStore) OptimizeShape(s shape.Shape) (shape.Shape, bool) {
+	return shape.OptimizeWith(qs.QuadStore, s)
+}
+
+// RewriteShape implements shape.Rewriter by passing shapes to the underlying store.
+func (qs *QuadStore) RewriteShape(s shape.Shape) (shape.Shape, bool) {
+	return shape.RewriteWith(qs.QuadStore, s)
+}
+
+// Horizon implements graph.Versioned, if it is supported by the underlying store.
+func (qs *QuadStore) Horizon() int64 {
+	if vs, ok := graph.AsVersioned(qs.QuadStore); ok {
+		return vs.Horizon()
+	}
+	return 1
+}
+
+// ApplyDeltasSince implements graph.Versioned, if it is supported by the underlying store.
+func (qs *QuadStore) ApplyDeltasSince(in []graph.Delta, opts graph.IgnoreOpts, horizon int64) error {
+	vs, ok := graph.AsVersioned(qs.QuadStore)
+	if !ok {
+		return graph.ErrOperationNotSupported
+	}
+	return qs.j.apply(in, opts, func() error {
+		return vs.ApplyDeltasSince(in, opts, horizon)
+	})
+}
+
+// BulkLoad implements graph.BulkLoader, if it is supported by the underlying store.
+// All quads are recorded in the journal as a single transaction.
+func (qs *QuadStore) BulkLoad(r quad.Reader) error {
+	bl, ok := graph.AsBulkLoader(qs.QuadStore)
+	if !ok {
+		return graph.ErrOperationNotSupported
+	}
+	return qs.j.tx(graph.IgnoreOpts{}, nil, func() error {
+		tr := &teeReader{r: r, w: qs.j.w}
+		if err := bl.BulkLoad(tr); err != nil {
+			return err
+		}
+		return qs.j.w.Flush()
+	})
+}
+
+// teeReader records quads read by the store in the journal.
+type teeReader struct {
+	r quad.Reader
+	w *patch.Writer
+}
+
+func (r *teeReader) ReadQuad() (quad.Quad, error) {
+	q, err := r.r.ReadQuad()
+	if err != nil {
+		return q, err
+	}
+	if err = r.w.WriteDelta(graph.Delta{Quad: q, Action: graph.Add}); err != nil {
+		return quad.Quad{}, err
+	}
+	return q, nil
+}
+
+func (qs *QuadStore) Close() error {
+	err := qs.QuadStore.Close()
+	if err2 := qs.j.Close(); err == nil {
+		err = err2
+	}
+	return err
+}
+
+// From returns the journal of a store, or nil if the store was not wrapped with Wrap.
+// Stores that wrap the journal store are unwrapped with graph.Unwrapper.
+func From(qs graph.QuadStore) *Journal {
+	for qs != nil {
+		if jqs, ok := qs.(*QuadStore); ok {
+			return jqs.j
+		}
+		u, ok := qs.(graph.Unwrapper)
+		if !ok {
+			break
+		}
+		qs = u.Unwrap()
+	}
+	return nil
+}
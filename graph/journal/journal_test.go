@@ -0,0 +1,274 @@
+package journal_test
+
+import (
+	"context"
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/cayleygraph/cayley/graph"
+	"github.com/cayleygraph/cayley/graph/journal"
+	"github.com/cayleygraph/cayley/graph/memstore"
+	"github.com/cayleygraph/cayley/graph/shape"
+	"github.com/cayleygraph/cayley/quad"
+	_ "github.com/cayleygraph/cayley/writer"
+)
+
+func newQuad(s, o string) quad.Quad {
+	return quad.MakeIRI(s, "follows", o, "")
+}
+
+func TestJournal(t *testing.T) {
+	dir, err := ioutil.TempDir("", "cayley_journal")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "journal.nq")
+
+	j, err := journal.Open(path, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	qs := journal.Wrap(memstore.New(), j)
+	if journal.From(qs) != j {
+		t.Fatal("expected journal of the store")
+	}
+	qw, err := graph.NewQuadWriter("single", qs, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = qw.AddQuad(newQuad("a", "b")); err != nil {
+		t.Fatal(err)
+	}
+	// rolled back transaction is not returned by readers
+	if err = qw.RemoveQuad(newQuad("a", "c")); err == nil {
+		t.Fatal("expected an error")
+	}
+	if err = qw.AddQuadSet([]quad.Quad{newQuad("b", "c"), newQuad("c", "d")}); err != nil {
+		t.Fatal(err)
+	}
+	if h := j.Horizon(); h != 4 {
+		t.Fatalf("unexpected horizon: %d", h)
+	}
+	if err = qs.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	// write a partial record, as if the process crashed
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	f.WriteString("# tx 4\n+ <d> <follows> <e>")
+	f.Close()
+
+	var got []*journal.Entry
+	err = journal.ReadFile(path, 0, func(e *journal.Entry) error {
+		got = append(got, e)
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(got) != 2 {
+		t.Fatalf("unexpected entries: %v", got)
+	} else if got[0].Horizon != 1 || len(got[0].Deltas) != 1 {
+		t.Fatalf("unexpected entry: %v", got[0])
+	} else if got[1].Horizon != 3 || len(got[1].Deltas) != 2 {
+		t.Fatalf("unexpected entry: %v", got[1])
+	} else if got[1].Time.IsZero() {
+		t.Fatal("expected entry time")
+	}
+
+	// reopened journal continues after the last transaction
+	j, err = journal.Open(path, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer j.Close()
+	if h := j.Horizon(); h != 5 {
+		t.Fatalf("unexpected horizon: %d", h)
+	}
+	st := memstore.New()
+	qw, err = graph.NewQuadWriter("single", st, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	last, err := journal.Replay(qw, path, 0, 0)
+	if err != nil {
+		t.Fatal(err)
+	} else if last != 3 {
+		t.Fatalf("unexpected last horizon: %d", last)
+	}
+	all, err := quad.ReadAll(graph.NewQuadStoreReader(st))
+	if err != nil {
+		t.Fatal(err)
+	} else if len(all) != 3 {
+		t.Fatalf("unexpected quads: %v", all)
+	}
+}
+
+func TestTail(t *testing.T) {
+	dir, err := ioutil.TempDir("", "cayley_journal")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	j, err := journal.Open(filepath.Join(dir, "journal.nq"), true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	qs := journal.Wrap(memstore.New(), j)
+	defer qs.Close()
+	for _, q := range []quad.Quad{newQuad("a", "b"), newQuad("b", "c")} {
+		if err = qs.ApplyDeltas([]graph.Delta{{Action: graph.Add, Quad: q}}, graph.IgnoreOpts{}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	errStop := errors.New("stop")
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	entries := make(chan *journal.Entry)
+	done := make(chan error, 1)
+	go func() {
+		done <- j.Tail(ctx, 2, func(e *journal.Entry) error {
+			entries <- e
+			if e.Horizon == 3 {
+				return errStop
+			}
+			return nil
+		})
+	}()
+	if e := <-entries; e.Horizon != 2 {
+		t.Fatalf("unexpected entry: %v", e)
+	}
+	// written after the tail has started
+	if err = qs.ApplyDeltas([]graph.Delta{{Action: graph.Add, Quad: newQuad("c", "d")}}, graph.IgnoreOpts{}); err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case e := <-entries:
+		if e.Horizon != 3 || e.Deltas[0].Quad != newQuad("c", "d") {
+			t.Fatalf("unexpected entry: %v", e)
+		}
+	case <-ctx.Done():
+		t.Fatal("timeout")
+	}
+	if err = <-done; err != errStop {
+		t.Fatalf("unexpected error: %v", err)
+	}
+}
+
+// wrapper is a store that wraps the journal store.
+type wrapper struct {
+	graph.QuadStore
+}
+
+func (qs wrapper) Unwrap() graph.QuadStore { return qs.QuadStore }
+
+func TestJournalOptions(t *testing.T) {
+	dir, err := ioutil.TempDir("", "cayley_journal")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "journal.nq")
+
+	j, err := journal.Open(path, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	qs := journal.Wrap(memstore.New(), j)
+	if journal.From(wrapper{qs}) != j {
+		t.Fatal("expected journal of the wrapped store")
+	}
+	add := []graph.Delta{{Action: graph.Add, Quad: newQuad("a", "b")}}
+	if err = qs.ApplyDeltas(add, graph.IgnoreOpts{}); err != nil {
+		t.Fatal(err)
+	} else if err = qs.ApplyDeltas(add, graph.IgnoreOpts{IgnoreDup: true}); err != nil {
+		t.Fatal(err)
+	}
+	vs, ok := graph.AsVersioned(wrapper{qs})
+	if !ok {
+		t.Fatal("expected a versioned store")
+	}
+	h := vs.Horizon()
+	add = []graph.Delta{{Action: graph.Add, Quad: newQuad("b", "c")}}
+	if err = vs.ApplyDeltasSince(add, graph.IgnoreOpts{}, h); err != nil {
+		t.Fatal(err)
+	}
+	if err = qs.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	var got []*journal.Entry
+	err = journal.ReadFile(path, 0, func(e *journal.Entry) error {
+		got = append(got, e)
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	} else if len(got) != 3 {
+		t.Fatalf("unexpected entries: %v", got)
+	} else if got[0].Opts.IgnoreDup || !got[1].Opts.IgnoreDup || got[1].Opts.IgnoreMissing {
+		t.Fatalf("unexpected options: %v, %v", got[0].Opts, got[1].Opts)
+	}
+
+	// duplicate is ignored by the replay as well
+	st := memstore.New()
+	qw, err := graph.NewQuadWriter("single", st, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if last, err := journal.Replay(qw, path, 0, 0); err != nil {
+		t.Fatal(err)
+	} else if last != 3 {
+		t.Fatalf("unexpected last horizon: %d", last)
+	}
+	all, err := quad.ReadAll(graph.NewQuadStoreReader(st))
+	if err != nil {
+		t.Fatal(err)
+	} else if len(all) != 2 {
+		t.Fatalf("unexpected quads: %v", all)
+	}
+}
+
+// emptyStore rewrites all shapes listing nodes to an empty set.
+type emptyStore struct {
+	graph.QuadStore
+}
+
+func (emptyStore) RewriteShape(s shape.Shape) (shape.Shape, bool) {
+	if _, ok := s.(shape.AllNodes); ok {
+		return shape.Null{}, true
+	}
+	return s, false
+}
+
+func TestJournalShapes(t *testing.T) {
+	dir, err := ioutil.TempDir("", "cayley_journal")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	j, err := journal.Open(filepath.Join(dir, "journal.nq"), true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	qs := journal.Wrap(emptyStore{memstore.New()}, j)
+	defer qs.Close()
+
+	s, opt := shape.Optimize(shape.AllNodes{}, qs)
+	if !opt {
+		t.Fatal("expected the shape to be rewritten by the underlying store")
+	} else if _, ok := s.(shape.Null); !ok {
+		t.Fatalf("unexpected shape: %#v", s)
+	}
+}
@@ -0,0 +1,209 @@
+// Copyright 2017 The Cayley Authors. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package journal
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/cayleygraph/cayley/graph"
+	"github.com/cayleygraph/cayley/graph/patch"
+)
+
+// parseRecord parses a journal record stored in a comment, e.g. "# commit 1".
+func parseRecord(line string) (string, int64, bool) {
+	if !strings.HasPrefix(line, "#") {
+		return "", 0, false
+	}
+	f := strings.Fields(line[1:])
+	if len(f) < 2 {
+		return "", 0, false
+	}
+	switch f[0] {
+	case recTx, recCommit, recRollback:
+	default:
+		return "", 0, false
+	}
+	h, err := strconv.ParseInt(f[1], 10, 64)
+	if err != nil {
+		return "", 0, false
+	}
+	return f[0], h, true
+}
+
+// Reader reads committed entries from a journal.
+type Reader struct {
+	r    *bufio.Reader
+	line int
+	from int64
+}
+
+// NewReader creates a journal reader that skips entries with horizons less than from.
+func NewReader(r io.Reader, from int64) *Reader {
+	return &Reader{r: bufio.NewReader(r), from: from}
+}
+
+// ReadEntry returns the next committed entry. It returns io.EOF at the end of the journal.
+func (r *Reader) ReadEntry() (*Entry, error) {
+	var cur *Entry
+	for {
+		s, err := r.r.ReadString('\n')
+		if err == io.EOF {
+			// partially written line
+			return nil, io.EOF
+		} else if err != nil {
+			return nil, err
+		}
+		r.line++
+		line := strings.TrimSpace(s)
+		if line == "" {
+			continue
+		}
+		if typ, h, ok := parseRecord(line); ok {
+			switch typ {
+			case recTx:
+				// uncommitted transaction is replaced by the new one
+				cur = &Entry{Horizon: h}
+				if f := strings.Fields(line[1:]); len(f) > 2 {
+					cur.Time, _ = time.Parse(time.RFC3339Nano, f[2])
+					for _, opt := range f[3:] {
+						switch opt {
+						case optIgnoreDup:
+							cur.Opts.IgnoreDup = true
+						case optIgnoreMissing:
+							cur.Opts.IgnoreMissing = true
+						}
+					}
+				}
+			case recCommit:
+				if cur != nil && cur.Horizon == h && h >= r.from {
+					return cur, nil
+				}
+				cur = nil
+			case recRollback:
+				cur = nil
+			}
+			continue
+		} else if strings.HasPrefix(line, "#") || cur == nil {
+			continue
+		}
+		d, err := patch.ParseDelta(line)
+		if err != nil {
+			return nil, fmt.Errorf("journal: line %d: %v", r.line, err)
+		}
+		cur.Deltas = append(cur.Deltas, d)
+	}
+}
+
+// ReadFile calls fnc for each committed entry of a journal file with a horizon of at least from.
+func ReadFile(path string, from int64, fnc func(e *Entry) error) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	r := NewReader(f, from)
+	for {
+		e, err := r.ReadEntry()
+		if err == io.EOF {
+			return nil
+		} else if err != nil {
+			return err
+		}
+		if err = fnc(e); err != nil {
+			return err
+		}
+	}
+}
+
+// Tail calls fnc for each committed entry with a horizon of at least from, and waits for new entries
+// until the context is cancelled or the journal is closed.
+func (j *Journal) Tail(ctx context.Context, from int64, fnc func(e *Entry) error) error {
+	f, err := os.Open(j.path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	r := NewReader(&follower{ctx: ctx, j: j, f: f}, from)
+	for {
+		e, err := r.ReadEntry()
+		if err == io.EOF {
+			return ctx.Err()
+		} else if err != nil {
+			return err
+		}
+		if err = fnc(e); err != nil {
+			return err
+		}
+	}
+}
+
+// follower reads a journal file and waits for new data at the end of the file.
+type follower struct {
+	ctx context.Context
+	j   *Journal
+	f   *os.File
+}
+
+func (r *follower) Read(p []byte) (int, error) {
+	for {
+		// get the channel before reading to not miss a commit
+		changed, closed := r.j.wait()
+		n, err := r.f.Read(p)
+		if n != 0 || err != io.EOF || closed {
+			return n, err
+		}
+		select {
+		case <-changed:
+		case <-r.ctx.Done():
+			return 0, io.EOF
+		}
+	}
+}
+
+// Replay applies committed entries of a journal file to the store, each in a separate transaction.
+// It returns the horizon of the last applied entry, or zero if there were none.
+//
+// Entries that were applied with ignore options are replayed with the same options, which requires
+// the writer to implement graph.IgnoreOptsWriter.
+func Replay(qw graph.QuadWriter, path string, from, to int64) (int64, error) {
+	var last int64
+	err := ReadFile(path, from, func(e *Entry) error {
+		if to > 0 && e.Horizon > to {
+			return io.EOF
+		}
+		var err error
+		if e.Opts != (graph.IgnoreOpts{}) {
+			_, err = graph.ApplyDeltasOpts(qw, e.Deltas, e.Opts)
+		} else {
+			err = qw.ApplyTransaction(&graph.Transaction{Deltas: e.Deltas})
+		}
+		if err != nil {
+			return fmt.Errorf("journal: cannot apply transaction %d: %v", e.Horizon, err)
+		}
+		last = e.Horizon
+		return nil
+	})
+	if err == io.EOF {
+		err = nil
+	}
+	return last, err
+}
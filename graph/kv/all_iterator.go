@@ -110,6 +110,9 @@ func (it *AllIterator) Next(ctx context.Context) bool {
 	if it.err != nil {
 		return false
 	}
+	if !graph.ScanPrimitive(ctx) {
+		return false
+	}
 	for {
 		if len(it.buf) == 0 {
 			if it.id+1 > uint64(it.horizon) {
@@ -160,6 +163,9 @@ func (it *AllIterator) NextPath(ctx context.Context) bool {
 }
 
 func (it *AllIterator) Contains(ctx context.Context, v graph.Value) bool {
+	if !graph.ScanPrimitive(ctx) {
+		return false
+	}
 	if it.nodes {
 		x, ok := v.(Int64Value)
 		if !ok {
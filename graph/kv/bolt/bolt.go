@@ -19,6 +19,7 @@ import (
 	"context"
 	"os"
 	"path/filepath"
+	"sync"
 
 	"github.com/boltdb/bolt"
 
@@ -53,15 +54,25 @@ func Create(path string, _ graph.Options) (kv.BucketKV, error) {
 		clog.Errorf("Error: couldn't create Bolt database: %v", err)
 		return nil, err
 	}
-	return &DB{DB: db}, nil
+	return &DB{DB: db, path: getBoltFile(path)}, nil
 }
 
 func Open(path string, opt graph.Options) (kv.BucketKV, error) {
-	db, err := bolt.Open(getBoltFile(path), 0600, nil)
+	// Read-only mode takes a shared lock on the file, thus
+	// several processes can open the same database.
+	ro, err := opt.BoolKey("read_only", false)
+	if err != nil {
+		return nil, err
+	}
+	db, err := bolt.Open(getBoltFile(path), 0600, &bolt.Options{ReadOnly: ro})
 	if err != nil {
 		clog.Errorf("Error, couldn't open! %v", err)
 		return nil, err
 	}
+	if ro {
+		clog.Infof("Running in read-only mode")
+		return &DB{DB: db, path: getBoltFile(path)}, nil
+	}
 	// BoolKey returns false on non-existence. IE, Sync by default.
 	db.NoSync, err = opt.BoolKey("nosync", false)
 	if err != nil {
@@ -71,11 +82,21 @@ func Open(path string, opt graph.Options) (kv.BucketKV, error) {
 	if db.NoSync {
 		clog.Infof("Running in nosync mode")
 	}
-	return &DB{DB: db}, nil
+	return &DB{DB: db, path: getBoltFile(path)}, nil
 }
 
 type DB struct {
 	DB *bolt.DB
+
+	path string
+	mu   sync.RWMutex // protects DB pointer during compaction
+	wmu  sync.Mutex   // held by write transactions
+}
+
+func (db *DB) db() *bolt.DB {
+	db.mu.RLock()
+	defer db.mu.RUnlock()
+	return db.DB
 }
 
 func (db *DB) Type() string {
@@ -83,20 +104,121 @@ func (db *DB) Type() string {
 }
 
 func (db *DB) Close() error {
-	return db.DB.Close()
+	return db.db().Close()
 }
 
 func (db *DB) Tx(update bool) (kv.BucketTx, error) {
-	tx, err := db.DB.Begin(update)
+	if !update {
+		tx, err := db.db().Begin(false)
+		if err != nil {
+			return nil, err
+		}
+		return &Tx{Tx: tx}, nil
+	}
+	db.wmu.Lock()
+	tx, err := db.db().Begin(true)
+	if err == bolt.ErrDatabaseReadOnly {
+		err = graph.ErrNotWritable
+	}
 	if err != nil {
+		db.wmu.Unlock()
 		return nil, err
 	}
-	return &Tx{Tx: tx}, nil
+	return &Tx{Tx: tx, done: db.wmu.Unlock}, nil
+}
+
+// compactBatch is the number of keys copied in a single transaction during compaction.
+const compactBatch = 10000
+
+// Compact copies all the data to a new database file and replaces the current file with it.
+// Writes are blocked until compaction finishes, while reads can still proceed.
+// Transactions that were started before the file was replaced will still read the old file.
+func (db *DB) Compact(ctx context.Context) error {
+	db.wmu.Lock()
+	defer db.wmu.Unlock()
+	src := db.db()
+	if src.IsReadOnly() {
+		return graph.ErrNotWritable
+	}
+	tmp := db.path + ".compact"
+	dst, err := bolt.Open(tmp, 0600, nil)
+	if err != nil {
+		return err
+	}
+	err = compact(ctx, dst, src)
+	if err == nil {
+		err = dst.Sync()
+	}
+	if err == nil {
+		err = os.Rename(tmp, db.path)
+	}
+	if err != nil {
+		dst.Close()
+		os.Remove(tmp)
+		return err
+	}
+	dst.NoSync = src.NoSync
+	db.mu.Lock()
+	db.DB = dst
+	db.mu.Unlock()
+	// close blocks until all read transactions are finished
+	go func() {
+		if err := src.Close(); err != nil {
+			clog.Errorf("bolt: cannot close database file after compaction: %v", err)
+		}
+	}()
+	return nil
+}
+
+// compact copies all buckets from src to dst.
+func compact(ctx context.Context, dst, src *bolt.DB) error {
+	return src.View(func(stx *bolt.Tx) error {
+		return stx.ForEach(func(name []byte, b *bolt.Bucket) error {
+			err := dst.Update(func(tx *bolt.Tx) error {
+				_, err := tx.CreateBucketIfNotExists(name)
+				return err
+			})
+			if err != nil {
+				return err
+			}
+			c := b.Cursor()
+			k, v := c.First()
+			for k != nil {
+				if err = ctx.Err(); err != nil {
+					return err
+				}
+				err = dst.Update(func(tx *bolt.Tx) error {
+					db := tx.Bucket(name)
+					// keys are inserted in order
+					db.FillPercent = 1.0
+					for n := 0; k != nil && n < compactBatch; n++ {
+						if err := db.Put(k, v); err != nil {
+							return err
+						}
+						k, v = c.Next()
+					}
+					return nil
+				})
+				if err != nil {
+					return err
+				}
+			}
+			return nil
+		})
+	})
 }
 
 type Tx struct {
-	Tx  *bolt.Tx
-	err error
+	Tx   *bolt.Tx
+	err  error
+	done func()
+}
+
+func (tx *Tx) finish() {
+	if tx.done != nil {
+		tx.done()
+		tx.done = nil
+	}
 }
 
 func (tx *Tx) Get(ctx context.Context, keys []kv.BucketKey) ([][]byte, error) {
@@ -110,6 +232,7 @@ func (tx *Tx) Get(ctx context.Context, keys []kv.BucketKey) ([][]byte, error) {
 }
 
 func (tx *Tx) Commit(ctx context.Context) error {
+	defer tx.finish()
 	if tx.err != nil {
 		_ = tx.Tx.Rollback()
 		return tx.err
@@ -117,6 +240,7 @@ func (tx *Tx) Commit(ctx context.Context) error {
 	return tx.Tx.Commit()
 }
 func (tx *Tx) Rollback() error {
+	defer tx.finish()
 	if tx.err != nil {
 		_ = tx.Tx.Rollback()
 		return tx.err
@@ -170,10 +294,14 @@ func (b *Bucket) Del(k []byte) error {
 func (b *Bucket) Scan(pref []byte) kv.KVIterator {
 	return &Iterator{b: b, pref: pref}
 }
+func (b *Bucket) ScanFrom(pref, from []byte) kv.KVIterator {
+	return &Iterator{b: b, pref: pref, from: from}
+}
 
 type Iterator struct {
 	b    *Bucket
 	pref []byte
+	from []byte
 	c    *bolt.Cursor
 	k, v []byte
 }
@@ -186,7 +314,9 @@ func (it *Iterator) Next(ctx context.Context) bool {
 	}
 	if it.c == nil {
 		it.c = it.b.Bucket.Cursor()
-		if len(it.pref) == 0 {
+		if bytes.Compare(it.from, it.pref) > 0 {
+			it.k, it.v = it.c.Seek(it.from)
+		} else if len(it.pref) == 0 {
 			it.k, it.v = it.c.First()
 		} else {
 			it.k, it.v = it.c.Seek(it.pref)
@@ -15,8 +15,13 @@
 package bolt
 
 import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
 	"io/ioutil"
 	"os"
+	"path/filepath"
 	"testing"
 
 	"github.com/cayleygraph/cayley/graph"
@@ -40,6 +45,181 @@ func makeBolt(t testing.TB) (kv.BucketKV, graph.Options, func()) {
 	}
 }
 
+// reopenBolt closes and opens the database again. Bolt holds an exclusive file lock until the database
+// is closed, thus to emulate a crash the file is copied while the database is still open, and the copy
+// replaces the original file after the database is closed.
+func reopenBolt(t testing.TB, db kv.BucketKV, kill bool) (kv.BucketKV, error) {
+	file := db.(*DB).path
+	if kill {
+		if err := copyFile(file+".kill", file); err != nil {
+			t.Fatal("Failed to copy Bolt database.", err)
+		}
+	}
+	if err := db.Close(); err != nil {
+		t.Fatal("Failed to close Bolt database.", err)
+	}
+	if kill {
+		if err := os.Rename(file+".kill", file); err != nil {
+			t.Fatal("Failed to replace Bolt database.", err)
+		}
+	}
+	return Open(filepath.Dir(file), nil)
+}
+
+func copyFile(dst, src string) error {
+	r, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer r.Close()
+	w, err := os.Create(dst)
+	if err != nil {
+		return err
+	}
+	if _, err = io.Copy(w, r); err != nil {
+		w.Close()
+		return err
+	}
+	return w.Close()
+}
+
 func TestBolt(t *testing.T) {
-	kvtest.TestAll(t, makeBolt, nil)
+	kvtest.TestAll(t, makeBolt, &kvtest.Config{
+		Reopen: reopenBolt,
+	})
+}
+
+func TestBoltReadOnly(t *testing.T) {
+	kvtest.TestReadOnly(t, Type)
+}
+
+func TestBoltCompact(t *testing.T) {
+	kdb, _, closer := makeBolt(t)
+	defer closer()
+	db := kdb.(*DB)
+	ctx := context.TODO()
+	bucket := []byte("data")
+	key := func(i int) []byte { return []byte(fmt.Sprintf("key%05d", i)) }
+	write := func(fnc func(b kv.Bucket) error) {
+		tx, err := db.Tx(true)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err = fnc(tx.Bucket(bucket)); err != nil {
+			tx.Rollback()
+			t.Fatal(err)
+		}
+		if err = tx.Commit(ctx); err != nil {
+			t.Fatal(err)
+		}
+	}
+	const n = 20000
+	val := bytes.Repeat([]byte{'v'}, 100)
+	write(func(b kv.Bucket) error {
+		for i := 0; i < n; i++ {
+			if err := b.Put(key(i), val); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	write(func(b kv.Bucket) error {
+		for i := 0; i < n; i += 10 {
+			if err := b.Del(key(i)); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	check := func(kdb kv.BucketKV, i int, exp []byte) {
+		tx, err := kdb.Tx(false)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer tx.Rollback()
+		vals, err := tx.Get(ctx, []kv.BucketKey{{Bucket: bucket, Key: key(i)}})
+		if err != nil {
+			t.Fatal(err)
+		} else if !bytes.Equal(vals[0], exp) {
+			t.Fatalf("unexpected value for %q: %q", key(i), vals[0])
+		}
+	}
+	size := func() int64 {
+		fi, err := os.Stat(db.path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return fi.Size()
+	}
+	before := size()
+
+	// transactions started before compaction keep reading the old file
+	old, err := db.Tx(false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	src := db.db()
+	if err = db.Compact(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if db.db() == src {
+		t.Fatal("database file was not replaced")
+	}
+	if _, err = os.Stat(db.path + ".compact"); !os.IsNotExist(err) {
+		t.Fatalf("temporary file was not removed: %v", err)
+	}
+	if after := size(); after >= before {
+		t.Fatalf("file was not compacted: %d vs %d", after, before)
+	}
+	vals, err := old.Get(ctx, []kv.BucketKey{{Bucket: bucket, Key: key(1)}})
+	if err != nil {
+		t.Fatal(err)
+	} else if !bytes.Equal(vals[0], val) {
+		t.Fatalf("unexpected value in the old transaction: %q", vals[0])
+	}
+	if err = old.Rollback(); err != nil {
+		t.Fatal(err)
+	}
+
+	check(db, 0, nil)
+	check(db, 1, val)
+	check(db, n-1, val)
+	write(func(b kv.Bucket) error {
+		return b.Put(key(0), val)
+	})
+	check(db, 0, val)
+
+	// compacted file must be used after the database is opened again
+	kdb, err = reopenBolt(t, db, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer kdb.Close()
+	check(kdb, 0, val)
+	check(kdb, 10, nil)
+	check(kdb, n-1, val)
+}
+
+func TestBoltCompactReadOnly(t *testing.T) {
+	kdb, _, closer := makeBolt(t)
+	defer closer()
+	dir := filepath.Dir(kdb.(*DB).path)
+	if err := kdb.Close(); err != nil {
+		t.Fatal(err)
+	}
+	kdb, err := Open(dir, graph.Options{"read_only": true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer kdb.Close()
+	if err = kdb.(*DB).Compact(context.TODO()); err != graph.ErrNotWritable {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if _, err = os.Stat(kdb.(*DB).path + ".compact"); !os.IsNotExist(err) {
+		t.Fatalf("temporary file must not be created: %v", err)
+	}
+}
+
+func BenchmarkBolt(b *testing.B) {
+	kvtest.BenchmarkAll(b, makeBolt, nil)
 }
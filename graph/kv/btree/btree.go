@@ -138,10 +138,14 @@ func (b *Bucket) Del(k []byte) error {
 func (b *Bucket) Scan(pref []byte) kv.KVIterator {
 	return &Iterator{b: b, pref: pref}
 }
+func (b *Bucket) ScanFrom(pref, from []byte) kv.KVIterator {
+	return &Iterator{b: b, pref: pref, from: from}
+}
 
 type Iterator struct {
 	b    *Bucket
 	pref []byte
+	from []byte
 	e    *Enumerator
 	k, v []byte
 }
@@ -153,7 +157,11 @@ func (it *Iterator) Next(ctx context.Context) bool {
 		return false
 	}
 	if it.e == nil {
-		it.e, _ = it.b.tree.Seek(it.pref)
+		start := it.pref
+		if bytes.Compare(it.from, start) > 0 {
+			start = it.from
+		}
+		it.e, _ = it.b.tree.Seek(start)
 	}
 	k, v, err := it.e.Next()
 	if err == io.EOF {
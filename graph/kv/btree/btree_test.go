@@ -26,8 +26,21 @@ func makeBtree(t testing.TB) (kv.BucketKV, graph.Options, func()) {
 	return New(), nil, func() {}
 }
 
+// reopenBtree opens the same in-memory tree again. Its contents cannot survive a crash.
+func reopenBtree(t testing.TB, db kv.BucketKV, kill bool) (kv.BucketKV, error) {
+	if kill {
+		return nil, graph.ErrOperationNotSupported
+	}
+	return db, nil
+}
+
 func TestBtree(t *testing.T) {
 	kvtest.TestAll(t, makeBtree, &kvtest.Config{
 		AlwaysRunIntegration: true,
+		Reopen:               reopenBtree,
 	})
 }
+
+func BenchmarkBtree(b *testing.B) {
+	kvtest.BenchmarkAll(b, makeBtree, nil)
+}
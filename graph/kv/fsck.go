@@ -0,0 +1,422 @@
+// Copyright 2017 The Cayley Authors. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package kv
+
+import (
+	"context"
+	"encoding/binary"
+	"fmt"
+	"sort"
+
+	"github.com/cayleygraph/cayley/graph"
+	"github.com/cayleygraph/cayley/graph/proto"
+	"github.com/cayleygraph/cayley/quad"
+	"github.com/cayleygraph/cayley/quad/pquads"
+)
+
+var _ graph.Checker = (*QuadStore)(nil)
+
+// Kinds of problems reported by Check.
+const (
+	ProblemLog      = "log"      // log entry cannot be decoded or is stored under a wrong key
+	ProblemDangling = "dangling" // quad refers to a node that does not exist
+	ProblemRefs     = "refcount" // node reference counter does not match the number of quads
+	ProblemIndex    = "index"    // missing or stale entry in value or quad index
+	ProblemHorizon  = "horizon"  // primitive ID is above the horizon
+	ProblemSize     = "size"     // stored number of quads is wrong
+)
+
+type fixFunc func(ctx context.Context, tx BucketTx) error
+
+type checker struct {
+	qs    *QuadStore
+	probs []graph.Problem
+	fixes []fixFunc
+
+	maxID  uint64
+	links  []proto.Primitive
+	nodes  map[uint64]string   // node ID -> value hash
+	hashes map[string]uint64   // value hash -> node ID
+	valOK  map[uint64]struct{} // nodes with a correct value index entry
+	refs   map[string]int64    // reference counters, as stored
+}
+
+func (c *checker) report(kind string, fix fixFunc, format string, args ...interface{}) {
+	c.probs = append(c.probs, graph.Problem{Kind: kind, Desc: fmt.Sprintf(format, args...)})
+	c.fixes = append(c.fixes, fix)
+}
+
+// eachIn is the same as Each, but treats missing buckets as empty.
+func eachIn(ctx context.Context, tx BucketTx, bucket []byte, fnc func(k, v []byte) error) error {
+	err := Each(ctx, tx.Bucket(bucket), nil, fnc)
+	if err == ErrNoBucket {
+		err = nil
+	}
+	return err
+}
+
+// Check scans the whole database for dangling node references, wrong reference counters,
+// missing or stale index entries and inconsistent metadata.
+//
+// If repair is set, writes are blocked until the check completes and all problems
+// are fixed in a single transaction. Quads that refer to missing nodes are marked
+// as deleted.
+func (qs *QuadStore) Check(ctx context.Context, repair bool) ([]graph.Problem, error) {
+	if repair {
+		// problems must still be valid when we will fix them
+		qs.writer.Lock()
+		defer qs.writer.Unlock()
+	}
+	c := &checker{
+		qs:     qs,
+		nodes:  make(map[uint64]string),
+		hashes: make(map[string]uint64),
+		valOK:  make(map[uint64]struct{}),
+		refs:   make(map[string]int64),
+	}
+	err := View(qs.db, func(tx BucketTx) error {
+		if err := c.checkLog(ctx, tx); err != nil {
+			return err
+		}
+		if err := c.checkValues(ctx, tx); err != nil {
+			return err
+		}
+		if err := c.checkLinks(ctx, tx); err != nil {
+			return err
+		}
+		return c.checkIndexes(ctx, tx)
+	})
+	if err != nil || !repair || len(c.probs) == 0 {
+		return c.probs, err
+	}
+	err = Update(ctx, qs.db, func(tx BucketTx) error {
+		for _, fix := range c.fixes {
+			if fix == nil {
+				continue
+			}
+			if err := fix(ctx, tx); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return c.probs, err
+	}
+	for i, fix := range c.fixes {
+		c.probs[i].Fixed = fix != nil
+	}
+	return c.probs, nil
+}
+
+// checkLog reads all primitives from the log.
+func (c *checker) checkLog(ctx context.Context, tx BucketTx) error {
+	return eachIn(ctx, tx, logIndex, func(k, v []byte) error {
+		key := append([]byte{}, k...)
+		del := func(ctx context.Context, tx BucketTx) error {
+			return tx.Bucket(logIndex).Del(key)
+		}
+		if len(k) != 8 {
+			c.report(ProblemLog, del, "invalid log key: %x", k)
+			return nil
+		}
+		id := quadKeyEnc.Uint64(k)
+		var p proto.Primitive
+		if err := p.Unmarshal(v); err != nil {
+			c.report(ProblemLog, del, "cannot decode primitive %d: %v", id, err)
+			return nil
+		}
+		if p.ID != id {
+			c.report(ProblemLog, func(ctx context.Context, tx BucketTx) error {
+				p.ID = id
+				return c.qs.addToLog(tx, &p)
+			}, "primitive %d is stored with ID %d", p.ID, id)
+			p.ID = id
+		}
+		if id > c.maxID {
+			c.maxID = id
+		}
+		if !p.IsNode() {
+			c.links = append(c.links, p)
+			return nil
+		}
+		val, err := pquads.UnmarshalValue(p.Value)
+		if err != nil {
+			c.report(ProblemLog, del, "cannot decode value of node %d: %v", id, err)
+			return nil
+		}
+		h := string(c.qs.hashOf(val))
+		c.nodes[id] = h
+		c.hashes[h] = id
+		return nil
+	})
+}
+
+// checkValues verifies value index and reference counters buckets against nodes from the log.
+func (c *checker) checkValues(ctx context.Context, tx BucketTx) error {
+	for i := 0; i < 256; i++ {
+		for j := 0; j < 256; j++ {
+			vb := bucketForVal(byte(i), byte(j))
+			err := eachIn(ctx, tx, vb, func(k, v []byte) error {
+				id, _ := binary.Uvarint(v)
+				if h, ok := c.nodes[id]; ok && h == string(k) {
+					c.valOK[id] = struct{}{}
+					return nil
+				}
+				key := append([]byte{}, k...)
+				del := func(ctx context.Context, tx BucketTx) error {
+					return tx.Bucket(vb).Del(key)
+				}
+				if _, ok := c.nodes[id]; !ok {
+					c.report(ProblemIndex, del, "value %x refers to missing node %d", k, id)
+				} else {
+					c.report(ProblemIndex, del, "value %x refers to node %d with a different value", k, id)
+				}
+				return nil
+			})
+			if err != nil {
+				return err
+			}
+			rb := bucketForValRefs(byte(i), byte(j))
+			err = eachIn(ctx, tx, rb, func(k, v []byte) error {
+				if _, ok := c.hashes[string(k)]; ok {
+					n, _ := binary.Uvarint(v)
+					c.refs[string(k)] = int64(n)
+					return nil
+				}
+				key := append([]byte{}, k...)
+				c.report(ProblemRefs, func(ctx context.Context, tx BucketTx) error {
+					return tx.Bucket(rb).Del(key)
+				}, "reference counter for missing value %x", k)
+				return nil
+			})
+			if err != nil {
+				return err
+			}
+		}
+	}
+	for id, h := range c.nodes {
+		if _, ok := c.valOK[id]; ok {
+			continue
+		}
+		id, h := id, h
+		c.report(ProblemIndex, func(ctx context.Context, tx BucketTx) error {
+			k := bucketKeyForHash([]byte(h))
+			return tx.Bucket(k.Bucket).Put(k.Key, uint64toBytes(id))
+		}, "missing value index entry for node %d", id)
+	}
+	return nil
+}
+
+// checkLinks finds dangling quads and verifies reference counters and metadata.
+func (c *checker) checkLinks(ctx context.Context, tx BucketTx) error {
+	var size int64
+	expect := make(map[uint64]int64, len(c.nodes))
+	// removed quads with tombstones still hold references to their nodes
+	tombs := make(map[uint64]struct{})
+	err := eachIn(ctx, tx, tombstoneBucket, func(k, v []byte) error {
+		if len(k) == 16 {
+			tombs[quadKeyEnc.Uint64(k[8:])] = struct{}{}
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	for i := range c.links {
+		p := &c.links[i]
+		if _, ok := tombs[p.ID]; ok && p.Deleted {
+			for _, d := range quad.Directions {
+				if id := p.GetDirection(d); id != 0 {
+					if _, ok := c.nodes[id]; ok {
+						expect[id]++
+					}
+				}
+			}
+			continue
+		} else if p.Deleted {
+			// nodes of deleted quads are allowed to be removed
+			continue
+		}
+		dangling := false
+		for _, d := range quad.Directions {
+			id := p.GetDirection(d)
+			if id == 0 {
+				continue
+			}
+			if _, ok := c.nodes[id]; !ok {
+				dangling = true
+				c.report(ProblemDangling, func(ctx context.Context, tx BucketTx) error {
+					return c.qs.markAsDead(tx, p)
+				}, "quad %d refers to missing node %d in %v direction", p.ID, id, d)
+				break
+			}
+		}
+		if dangling {
+			continue
+		}
+		size++
+		for _, d := range quad.Directions {
+			if id := p.GetDirection(d); id != 0 {
+				expect[id]++
+			}
+		}
+	}
+	ids := make([]uint64, 0, len(c.nodes))
+	for id := range c.nodes {
+		ids = append(ids, id)
+	}
+	sort.Sort(Int64Set(ids))
+	for _, id := range ids {
+		h := c.nodes[id]
+		n, cur := expect[id], c.refs[h]
+		if n == cur {
+			continue
+		}
+		id := id
+		if n == 0 {
+			c.report(ProblemRefs, func(ctx context.Context, tx BucketTx) error {
+				return c.qs.removeNode(ctx, tx, id, []byte(h))
+			}, "node %d is not used by any quad (refs: %d)", id, cur)
+			continue
+		}
+		c.report(ProblemRefs, func(ctx context.Context, tx BucketTx) error {
+			k := bucketKeyForHashRefs([]byte(h))
+			return tx.Bucket(k.Bucket).Put(k.Key, uint64toBytes(uint64(n)))
+		}, "node %d is used by %d quads, but counter is %d", id, n, cur)
+	}
+	horizon, err := c.qs.getMetaIntTx(ctx, tx, "horizon")
+	if err != nil && err != ErrNotFound {
+		return err
+	}
+	if uint64(horizon) < c.maxID {
+		c.report(ProblemHorizon, func(ctx context.Context, tx BucketTx) error {
+			return setMetaInt(tx, "horizon", int64(c.maxID))
+		}, "horizon %d is less than the last ID %d", horizon, c.maxID)
+	}
+	cur, err := c.qs.getMetaIntTx(ctx, tx, "size")
+	if err != nil && err != ErrNotFound {
+		return err
+	}
+	if cur != size {
+		c.report(ProblemSize, func(ctx context.Context, tx BucketTx) error {
+			return setMetaInt(tx, "size", size)
+		}, "store contains %d quads, but size is %d", size, cur)
+	}
+	return nil
+}
+
+// checkIndexes verifies that quad indexes contain all quads from the log and nothing else.
+func (c *checker) checkIndexes(ctx context.Context, tx BucketTx) error {
+	c.qs.indexes.RLock()
+	all := c.qs.indexes.all
+	c.qs.indexes.RUnlock()
+
+	quads := make(map[uint64]struct{}, len(c.links))
+	for _, p := range c.links {
+		quads[p.ID] = struct{}{}
+	}
+	for _, ind := range all {
+		// index still contains deleted quads
+		expect := make(map[string][]uint64)
+		for i := range c.links {
+			p := &c.links[i]
+			k := string(ind.KeyFor(p))
+			expect[k] = append(expect[k], p.ID)
+		}
+		bucket := ind.Bucket()
+		fix := func(key []byte, ids []uint64) fixFunc {
+			return func(ctx context.Context, tx BucketTx) error {
+				sort.Sort(Int64Set(ids))
+				return tx.Bucket(bucket).Put(key, appendIndex(nil, ids))
+			}
+		}
+		err := eachIn(ctx, tx, bucket, func(k, v []byte) error {
+			key := append([]byte{}, k...)
+			cur, err := decodeIndex(v)
+			if err != nil {
+				c.report(ProblemIndex, fix(key, expect[string(k)]), "cannot decode %v index entry %x: %v", ind.Dirs, k, err)
+				delete(expect, string(k))
+				return nil
+			}
+			has := make(map[uint64]struct{}, len(cur))
+			var (
+				ids   []uint64
+				stale int
+			)
+			for _, id := range cur {
+				if _, ok := quads[id]; !ok {
+					stale++
+					continue
+				}
+				has[id] = struct{}{}
+				ids = append(ids, id)
+			}
+			missing := 0
+			for _, id := range expect[string(k)] {
+				if _, ok := has[id]; !ok {
+					missing++
+					ids = append(ids, id)
+				}
+			}
+			delete(expect, string(k))
+			if stale == 0 && missing == 0 {
+				return nil
+			}
+			if len(ids) == 0 {
+				c.report(ProblemIndex, func(ctx context.Context, tx BucketTx) error {
+					return tx.Bucket(bucket).Del(key)
+				}, "%v index entry %x refers to %d missing quads", ind.Dirs, k, stale)
+				return nil
+			}
+			c.report(ProblemIndex, fix(key, ids), "%v index entry %x: %d missing quads, %d stale", ind.Dirs, k, missing, stale)
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+		keys := make([]string, 0, len(expect))
+		for k := range expect {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+		for _, k := range keys {
+			ids := expect[k]
+			c.report(ProblemIndex, fix([]byte(k), ids), "%v index entry %x is missing (%d quads)", ind.Dirs, k, len(ids))
+		}
+	}
+	return nil
+}
+
+// removeNode deletes a node with all associated index entries.
+func (qs *QuadStore) removeNode(ctx context.Context, tx BucketTx, id uint64, h []byte) error {
+	val, _ := qs.getValFromLog(ctx, tx, id)
+	qs.cache.Del(nodeCacheKey(id), val)
+	k := bucketKeyForHashRefs(h)
+	if err := tx.Bucket(k.Bucket).Del(k.Key); err != nil {
+		return err
+	}
+	k = bucketKeyForHash(h)
+	if err := tx.Bucket(k.Bucket).Del(k.Key); err != nil {
+		return err
+	}
+	return qs.delLog(tx, id)
+}
+
+func setMetaInt(tx BucketTx, key string, v int64) error {
+	buf := make([]byte, 8)
+	binary.LittleEndian.PutUint64(buf, uint64(v))
+	return tx.Bucket(metaBucket).Put([]byte(key), buf)
+}
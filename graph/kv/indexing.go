@@ -21,6 +21,7 @@ import (
 	"fmt"
 	"io"
 	"sort"
+	"strings"
 	"time"
 
 	"github.com/cayleygraph/cayley/clog"
@@ -81,6 +82,62 @@ func (ind QuadIndex) Bucket() []byte {
 	return b
 }
 
+// metaQuadIndexes is a meta key that stores a list of quad indexes selected on init.
+const metaQuadIndexes = "indexes"
+
+func (ind QuadIndex) String() string {
+	return graph.FormatQuadIndex(ind.Dirs)
+}
+
+// bestIndex returns an index that can be used to lookup quads with a given set of directions,
+// along with the number of leading index directions that are covered by this set.
+// Zero means that there is no suitable index.
+func (qs *QuadStore) bestIndex(has func(d quad.Direction) bool) (QuadIndex, int) {
+	qs.indexes.RLock()
+	all := qs.indexes.all
+	qs.indexes.RUnlock()
+	var (
+		best QuadIndex
+		bn   int
+	)
+	for _, ind := range all {
+		n := 0
+		for _, d := range ind.Dirs {
+			if !has(d) {
+				break
+			}
+			n++
+		}
+		// prefer indexes that match all directions, so no prefix scan is needed
+		if n > bn || (n == bn && n != 0 && len(ind.Dirs) < len(best.Dirs)) {
+			best, bn = ind, n
+		}
+	}
+	return best, bn
+}
+
+func parseQuadIndexes(s string) ([]QuadIndex, error) {
+	var inds []QuadIndex
+	for _, str := range strings.Split(s, ",") {
+		dirs, err := graph.ParseQuadIndex(str)
+		if err != nil {
+			return nil, err
+		}
+		inds = append(inds, QuadIndex{Dirs: dirs})
+	}
+	return inds, nil
+}
+
+func setQuadIndexes(ctx context.Context, kv BucketKV, inds []QuadIndex) error {
+	strs := make([]string, 0, len(inds))
+	for _, ind := range inds {
+		strs = append(strs, ind.String())
+	}
+	return Update(ctx, kv, func(tx BucketTx) error {
+		return tx.Bucket(metaBucket).Put([]byte(metaQuadIndexes), []byte(strings.Join(strs, ",")))
+	})
+}
+
 type FillBucket interface {
 	SetFillPercent(v float64)
 }
@@ -137,17 +194,15 @@ func (qs *QuadStore) resolveValDeltas(ctx context.Context, tx BucketTx, deltas [
 	inds := make([]int, 0, len(deltas))
 	keys := make([]BucketKey, 0, len(deltas))
 	for i, d := range deltas {
-		if iri, ok := d.Val.(quad.IRI); ok {
-			if x, ok := qs.valueLRU.Get(string(iri)); ok {
-				fnc(i, x.(uint64))
-				continue
-			}
-		} else if d.Val == nil {
+		if d.Val == nil {
 			fnc(i, 0)
 			continue
+		} else if id, ok := qs.cache.ValueOf(d.Val); ok {
+			fnc(i, uint64(id.(Int64Value)))
+			continue
 		}
 		inds = append(inds, i)
-		keys = append(keys, bucketKeyForHash(d.Hash))
+		keys = append(keys, bucketKeyForHash(qs.nodeHash(d)))
 	}
 	if len(keys) == 0 {
 		return nil
@@ -165,8 +220,8 @@ func (qs *QuadStore) resolveValDeltas(ctx context.Context, tx BucketTx, deltas [
 		ind := inds[i]
 		id, _ := binary.Uvarint(b)
 		d := &deltas[ind]
-		if iri, ok := d.Val.(quad.IRI); ok && id != 0 {
-			qs.valueLRU.Put(string(iri), uint64(id))
+		if id != 0 {
+			qs.cache.PutValue(d.Val, Int64Value(id))
 		}
 		fnc(ind, uint64(id))
 	}
@@ -226,7 +281,7 @@ type nodeUpdate struct {
 func (qs *QuadStore) incNodesCnt(ctx context.Context, tx BucketTx, deltas []nodeUpdate) ([]int, error) {
 	keys := make([]BucketKey, 0, len(deltas))
 	for _, d := range deltas {
-		keys = append(keys, bucketKeyForHashRefs(d.Hash))
+		keys = append(keys, bucketKeyForHashRefs(qs.nodeHash(d.NodeUpdate)))
 	}
 	sizes, err := tx.Get(ctx, keys)
 	if err != nil {
@@ -325,12 +380,14 @@ func (qs *QuadStore) decNodes(ctx context.Context, tx BucketTx, deltas []graphlo
 	}
 	for _, i := range del {
 		d := upds[i]
-		bucket := tx.Bucket(bucketForVal(d.Hash[0], d.Hash[1]))
-		if err = bucket.Del(d.Hash[:]); err != nil {
+		h := qs.nodeHash(d.NodeUpdate)
+		bucket := tx.Bucket(bucketForVal(h[0], h[1]))
+		if err = bucket.Del(h); err != nil {
 			return err
 		}
-		if iri, ok := d.Val.(quad.IRI); ok {
-			qs.valueLRU.Del(string(iri))
+		qs.cache.Del(nodeCacheKey(d.ID), d.Val)
+		if err := qs.unindexValue(tx, d.ID, d.Val); err != nil {
+			return err
 		}
 		if err := qs.delLog(tx, d.ID); err != nil {
 			return err
@@ -354,6 +411,9 @@ func (qs *QuadStore) ApplyDeltas(in []graph.Delta, ignoreOpts graph.IgnoreOpts)
 	}
 
 	deltas := graphlog.SplitDeltas(in)
+	if qs.softDelete {
+		keepNodeRefs(deltas)
+	}
 	// first add all new nodes
 	nodes, err := qs.incNodes(ctx, tx, deltas.IncNode)
 	if err != nil {
@@ -362,6 +422,7 @@ func (qs *QuadStore) ApplyDeltas(in []graph.Delta, ignoreOpts graph.IgnoreOpts)
 	deltas.IncNode = nil
 	// resolve and insert all new quads
 	links := make([]proto.Primitive, 0, len(deltas.QuadAdd))
+	var uniqAdd, uniqDel []uniqueUpdate
 	for _, q := range deltas.QuadAdd {
 		var link proto.Primitive
 		mustBeNew := false
@@ -385,6 +446,9 @@ func (qs *QuadStore) ApplyDeltas(in []graph.Delta, ignoreOpts graph.IgnoreOpts)
 				return &graph.DeltaError{Delta: in[q.Ind], Err: graph.ErrQuadExists}
 			}
 		}
+		if qs.isUnique(in[q.Ind].Quad.Predicate) {
+			uniqAdd = append(uniqAdd, uniqueUpdate{link: link, delta: q.Ind})
+		}
 		links = append(links, link)
 	}
 	deltas.QuadAdd = nil
@@ -445,22 +509,32 @@ func (qs *QuadStore) ApplyDeltas(in []graph.Delta, ignoreOpts graph.IgnoreOpts)
 				}
 				continue
 			}
+			if qs.isUnique(in[q.Ind].Quad.Predicate) {
+				uniqDel = append(uniqDel, uniqueUpdate{link: link, delta: q.Ind})
+			}
 			links = append(links, link)
 		}
 		deltas.QuadDel = nil
 		if err := qs.markLinksDead(ctx, tx, links); err != nil {
 			return err
 		}
-		links = nil
-		nodes = nil
-
-		// finally decrement and remove nodes
-		if err := qs.decNodes(ctx, tx, deltas.DecNode, dnodes); err != nil {
+		if qs.softDelete {
+			// nodes are still referenced by tombstones
+			if err := qs.addTombstones(tx, links); err != nil {
+				return err
+			}
+		} else if err := qs.decNodes(ctx, tx, deltas.DecNode, dnodes); err != nil {
+			// finally decrement and remove nodes
 			return err
 		}
+		links = nil
+		nodes = nil
 		deltas = nil
 		dnodes = nil
 	}
+	if err = qs.updateUnique(ctx, tx, in, uniqDel, uniqAdd); err != nil {
+		return err
+	}
 	// flush quad indexes and commit
 	err = qs.flushMapBucket(ctx, tx)
 	if err != nil {
@@ -477,14 +551,15 @@ func (qs *QuadStore) indexNode(tx BucketTx, p *proto.Primitive, val quad.Value)
 			return err
 		}
 	}
-	hash := quad.HashOf(val)
+	hash := qs.hashOf(val)
 	bucket := tx.Bucket(bucketForVal(hash[0], hash[1]))
 	err = bucket.Put(hash, uint64toBytes(p.ID))
 	if err != nil {
 		return err
 	}
-	if iri, ok := val.(quad.IRI); ok {
-		qs.valueLRU.Put(string(iri), p.ID)
+	qs.cache.Put(nodeCacheKey(p.ID), val, Int64Value(p.ID))
+	if err = qs.indexValue(tx, p.ID, val); err != nil {
+		return err
 	}
 	return qs.addToLog(tx, p)
 }
@@ -651,17 +726,23 @@ func (qs *QuadStore) hasPrimitive(ctx context.Context, tx BucketTx, p *proto.Pri
 	if !get && unique {
 		return p, nil
 	}
+	// deleted quads stay in the index, thus prefer a live one
+	var deleted *proto.Primitive
 	for _, x := range options {
 		// TODO: batch
 		prim, err := qs.getPrimitiveFromLog(ctx, tx, x)
 		if err != nil {
 			return nil, err
 		}
-		if prim.IsSameLink(p) {
+		if !prim.IsSameLink(p) {
+			continue
+		} else if !prim.Deleted {
 			return prim, nil
+		} else if deleted == nil {
+			deleted = prim
 		}
 	}
-	return nil, nil
+	return deleted, nil
 }
 
 func intersectSortedUint64(a, b []uint64) []uint64 {
@@ -772,22 +853,49 @@ func (qs *QuadStore) resolveQuadValue(ctx context.Context, tx BucketTx, v quad.V
 	return out[0], nil
 }
 
-func bucketKeyForVal(v quad.Value) BucketKey {
-	hash := graph.HashOf(v)
-	return bucketKeyForHash(hash)
+const (
+	// OptValueHash is an option name that selects a hash function for node values (see quad.Hashers).
+	// It can only be set when the database is created.
+	OptValueHash = "value_hash"
+
+	metaValueHash = "value_hash"
+)
+
+// hashOf returns a hash of the value, as stored in value buckets.
+func (qs *QuadStore) hashOf(v quad.Value) []byte {
+	return qs.hash.HashOf(v)
+}
+
+// nodeHash is the same as hashOf, but reuses the hash calculated for the log, if possible.
+func (qs *QuadStore) nodeHash(d graphlog.NodeUpdate) []byte {
+	if qs.hash.Name() == quad.HashSHA1 {
+		h := d.Hash
+		return h[:]
+	}
+	return qs.hashOf(d.Val)
+}
+
+func setValueHash(ctx context.Context, kv BucketKV, name string) error {
+	return Update(ctx, kv, func(tx BucketTx) error {
+		return tx.Bucket(metaBucket).Put([]byte(metaValueHash), []byte(name))
+	})
 }
 
-func bucketKeyForHash(h graph.ValueHash) BucketKey {
+func (qs *QuadStore) bucketKeyForVal(v quad.Value) BucketKey {
+	return bucketKeyForHash(qs.hashOf(v))
+}
+
+func bucketKeyForHash(h []byte) BucketKey {
 	return BucketKey{
 		Bucket: bucketForVal(h[0], h[1]),
-		Key:    h[:],
+		Key:    h,
 	}
 }
 
-func bucketKeyForHashRefs(h graph.ValueHash) BucketKey {
+func bucketKeyForHashRefs(h []byte) BucketKey {
 	return BucketKey{
 		Bucket: bucketForValRefs(h[0], h[1]),
-		Key:    h[:],
+		Key:    h,
 	}
 }
 
@@ -796,16 +904,14 @@ func (qs *QuadStore) resolveQuadValues(ctx context.Context, tx BucketTx, vals []
 	inds := make([]int, 0, len(vals))
 	keys := make([]BucketKey, 0, len(vals))
 	for i, v := range vals {
-		if iri, ok := v.(quad.IRI); ok {
-			if x, ok := qs.valueLRU.Get(string(iri)); ok {
-				out[i] = x.(uint64)
-				continue
-			}
-		} else if v == nil {
+		if v == nil {
+			continue
+		} else if id, ok := qs.cache.ValueOf(v); ok {
+			out[i] = uint64(id.(Int64Value))
 			continue
 		}
 		inds = append(inds, i)
-		keys = append(keys, bucketKeyForVal(v))
+		keys = append(keys, qs.bucketKeyForVal(v))
 	}
 	if len(keys) == 0 {
 		return out, nil
@@ -820,8 +926,8 @@ func (qs *QuadStore) resolveQuadValues(ctx context.Context, tx BucketTx, vals []
 		}
 		ind := inds[i]
 		out[ind], _ = binary.Uvarint(b)
-		if iri, ok := vals[ind].(quad.IRI); ok && out[ind] != 0 {
-			qs.valueLRU.Put(string(iri), uint64(out[ind]))
+		if out[ind] != 0 {
+			qs.cache.PutValue(vals[ind], Int64Value(out[ind]))
 		}
 	}
 	return out, nil
@@ -837,6 +943,11 @@ func uint64toBytesAt(x uint64, bytes []byte) []byte {
 	return bytes[:n]
 }
 
+// nodeCacheKey returns a key of the node in the value cache.
+func nodeCacheKey(id uint64) string {
+	return string(uint64KeyBytes(id))
+}
+
 func uint64KeyBytes(x uint64) []byte {
 	k := make([]byte, 8)
 	quadKeyEnc.PutUint64(k, x)
@@ -1,13 +1,19 @@
 package kv
 
 import (
+	"context"
+	"encoding/binary"
 	"fmt"
 
 	"github.com/cayleygraph/cayley/graph"
 	"github.com/cayleygraph/cayley/graph/iterator"
+	"github.com/cayleygraph/cayley/graph/stats"
 	"github.com/cayleygraph/cayley/quad"
+	"github.com/cayleygraph/cayley/quad/pquads"
 )
 
+var _ stats.Estimator = (*QuadStore)(nil)
+
 func (qs *QuadStore) NodesAllIterator() graph.Iterator {
 	return NewAllIterator(true, qs, nil)
 }
@@ -25,16 +31,59 @@ func (qs *QuadStore) QuadIterator(dir quad.Direction, v graph.Value) graph.Itera
 		return iterator.NewError(fmt.Errorf("unexpected node type: %T", v))
 	}
 
+	// an index that starts with this direction can be used with a prefix scan
+	if ind, n := qs.bestIndex(func(d quad.Direction) bool { return d == dir }); n != 0 {
+		return NewQuadIterator(qs, ind, []uint64{uint64(vi)})
+	}
+	return NewAllIterator(false, qs, &constraint{
+		dir: dir,
+		val: vi,
+	})
+}
+
+// QuadsWith returns an estimated number of quads with a given value in the specified direction.
+//
+// The result is never exact, but is an upper bound: if there is an index for this direction,
+// the length of the index list is used, which also includes quads that were removed.
+// Otherwise, a reference counter of the node is used, which counts quads in all directions.
+func (qs *QuadStore) QuadsWith(dir quad.Direction, v graph.Value) (int64, bool) {
+	vi, ok := v.(Int64Value)
+	if !ok || vi == 0 {
+		return 0, true
+	}
 	qs.indexes.RLock()
 	all := qs.indexes.all
 	qs.indexes.RUnlock()
 	for _, ind := range all {
 		if len(ind.Dirs) == 1 && ind.Dirs[0] == dir {
-			return NewQuadIterator(qs, ind, []uint64{uint64(vi)})
+			n, _ := NewQuadIterator(qs, ind, []uint64{uint64(vi)}).Size()
+			return n, false
 		}
 	}
-	return NewAllIterator(false, qs, &constraint{
-		dir: dir,
-		val: vi,
+	ctx := context.TODO()
+	var refs int64
+	err := View(qs.db, func(tx BucketTx) error {
+		prim, err := qs.getPrimitivesFromLog(ctx, tx, []uint64{uint64(vi)})
+		if err != nil {
+			return err
+		} else if prim[0] == nil {
+			return nil
+		}
+		val, err := pquads.UnmarshalValue(prim[0].Value)
+		if err != nil {
+			return err
+		}
+		vals, err := tx.Get(ctx, []BucketKey{bucketKeyForHashRefs(qs.hashOf(val))})
+		if err != nil {
+			return err
+		} else if vals[0] != nil {
+			sz, _ := binary.Uvarint(vals[0])
+			refs = int64(sz)
+		}
+		return nil
 	})
+	if err != nil {
+		return qs.Size(), false
+	}
+	return refs, false
 }
@@ -1,3 +1,8 @@
+// Package kv implements a quad store on top of a generic key-value database.
+//
+// Any ordered key-value store can be used as a backend by implementing either BucketKV
+// or FlatKV interfaces and registering it with Register or RegisterFlat.
+// Implementations can be checked for conformance with the kvtest package.
 package kv
 
 import (
@@ -5,6 +10,8 @@ import (
 	"context"
 	"errors"
 	"fmt"
+
+	"github.com/cayleygraph/cayley/graph"
 )
 
 var (
@@ -13,18 +20,64 @@ var (
 	ErrBucketExists = errors.New("kv: bucket already exists")
 )
 
+// Tx is a transaction in a key-value database.
+// Either Commit or Rollback must be called to release resources associated with the transaction.
 type Tx interface {
+	// Commit applies all changes made in the transaction.
 	Commit(ctx context.Context) error
+	// Rollback discards all changes made in the transaction. It can be called after Commit.
 	Rollback() error
 }
 
+// Bucket is a set of keys that can be accessed independently from other buckets.
 type Bucket interface {
+	// Get returns values for a set of keys. Values for missing keys are returned as nil.
+	// Returned slices are valid only until the end of the transaction.
 	Get(ctx context.Context, keys [][]byte) ([][]byte, error)
+	// Put writes a value for the key. It fails in read-only transactions.
 	Put(k, v []byte) error
+	// Del removes the key. It fails in read-only transactions.
 	Del(k []byte) error
+	// Scan returns an iterator over all keys with a given prefix, sorted in ascending byte order.
 	Scan(pref []byte) KVIterator
 }
 
+// RangeScanner is an optional interface for buckets that can start a prefix scan from a given key.
+type RangeScanner interface {
+	// ScanFrom is the same as Scan, but skips all keys that are less than a given one.
+	ScanFrom(pref, from []byte) KVIterator
+}
+
+// ScanFrom returns an iterator over all keys with a given prefix, starting from a given key.
+// If bucket does not implement RangeScanner, all keys that are less than from are skipped one by one.
+func ScanFrom(b Bucket, pref, from []byte) KVIterator {
+	if bytes.Compare(from, pref) <= 0 {
+		return b.Scan(pref)
+	}
+	if rs, ok := b.(RangeScanner); ok {
+		return rs.ScanFrom(pref, from)
+	}
+	return &skipIter{KVIterator: b.Scan(pref), from: from}
+}
+
+type skipIter struct {
+	KVIterator
+	from []byte
+}
+
+func (it *skipIter) Next(ctx context.Context) bool {
+	for it.KVIterator.Next(ctx) {
+		if it.from == nil {
+			return true
+		} else if bytes.Compare(it.Key(), it.from) >= 0 {
+			it.from = nil
+			return true
+		}
+	}
+	return false
+}
+
+// GetOne returns a value for a single key, or ErrNotFound if it does not exist.
 func GetOne(ctx context.Context, b Bucket, key []byte) ([]byte, error) {
 	out, err := b.Get(ctx, [][]byte{key})
 	if err != nil {
@@ -35,6 +88,8 @@ func GetOne(ctx context.Context, b Bucket, key []byte) ([]byte, error) {
 	return out[0], nil
 }
 
+// KVIterator is an iterator over key-value pairs.
+// Keys and values are valid only until the next call to Next.
 type KVIterator interface {
 	Next(ctx context.Context) bool
 	Err() error
@@ -43,36 +98,52 @@ type KVIterator interface {
 	Val() []byte
 }
 
+// BucketKey is a key in a specific bucket.
 type BucketKey struct {
 	Bucket, Key []byte
 }
 
+// BucketTx is a transaction in a database that supports buckets.
 type BucketTx interface {
 	Tx
+	// Bucket returns a bucket with a given name. Writable transactions should create it if it does not exist.
+	// In read-only transactions, operations on a missing bucket may fail with ErrNoBucket.
 	Bucket(name []byte) Bucket
+	// Get returns values for keys in multiple buckets. Values for missing keys are returned as nil.
 	Get(ctx context.Context, keys []BucketKey) ([][]byte, error)
 }
 
+// FlatTx is a transaction in a database with a single key space.
 type FlatTx interface {
 	Tx
 	Bucket
 }
 
+// Base is a common interface for all key-value databases.
 type Base interface {
+	// Type returns a name of the backend.
 	Type() string
+	// Close closes the database.
 	Close() error
 }
 
+// BucketKV is a key-value database that supports buckets.
+//
+// Implementations may also implement graph.Maintainer to support online compaction.
 type BucketKV interface {
 	Base
+	// Tx starts a new transaction. Only one writable transaction is expected to run at a time.
 	Tx(update bool) (BucketTx, error)
 }
 
+// FlatKV is a key-value database with a single sorted key space. It can be converted to BucketKV with FromFlat.
 type FlatKV interface {
 	Base
+	// Tx starts a new transaction. Only one writable transaction is expected to run at a time.
 	Tx(update bool) (FlatTx, error)
 }
 
+// Update runs a function in a writable transaction and commits it, if function returns no error.
 func Update(ctx context.Context, kv BucketKV, update func(tx BucketTx) error) error {
 	tx, err := kv.Tx(true)
 	if err != nil {
@@ -85,6 +156,7 @@ func Update(ctx context.Context, kv BucketKV, update func(tx BucketTx) error) er
 	return tx.Commit(ctx)
 }
 
+// View runs a function in a read-only transaction.
 func View(kv BucketKV, view func(tx BucketTx) error) error {
 	tx, err := kv.Tx(false)
 	if err != nil {
@@ -98,6 +170,7 @@ func View(kv BucketKV, view func(tx BucketTx) error) error {
 	return err
 }
 
+// Each calls a function for each key-value pair with a given prefix in the bucket.
 func Each(ctx context.Context, b Bucket, pref []byte, fnc func(k, v []byte) error) error {
 	it := b.Scan(pref)
 	defer it.Close()
@@ -111,6 +184,7 @@ func Each(ctx context.Context, b Bucket, pref []byte, fnc func(k, v []byte) erro
 
 var _ BucketKV = (*flatKV)(nil)
 
+// FromFlat converts a flat key-value database to one with buckets by prefixing all keys with bucket names.
 func FromFlat(flat FlatKV) BucketKV {
 	return &flatKV{flat: flat}
 }
@@ -121,6 +195,12 @@ type flatKV struct {
 
 func (kv *flatKV) Type() string { return kv.flat.Type() }
 func (kv *flatKV) Close() error { return kv.flat.Close() }
+func (kv *flatKV) Compact(ctx context.Context) error {
+	if m, ok := kv.flat.(graph.Maintainer); ok {
+		return m.Compact(ctx)
+	}
+	return graph.ErrOperationNotSupported
+}
 func (kv *flatKV) Tx(update bool) (BucketTx, error) {
 	tx, err := kv.flat.Tx(update)
 	if err != nil {
@@ -223,3 +303,7 @@ func (b *flatBucket) Scan(pref []byte) KVIterator {
 	pref = b.key(pref)
 	return &prefIter{KVIterator: b.tx.Scan(pref), trim: b.pref}
 }
+func (b *flatBucket) ScanFrom(pref, from []byte) KVIterator {
+	pref, from = b.key(pref), b.key(from)
+	return &prefIter{KVIterator: ScanFrom(b.tx, pref, from), trim: b.pref}
+}
@@ -2,14 +2,22 @@ package kvtest
 
 import (
 	"context"
+	"io/ioutil"
+	"os"
 	"reflect"
+	"sort"
+	"sync"
 	"testing"
+	"time"
 
 	"github.com/cayleygraph/cayley/graph"
 	"github.com/cayleygraph/cayley/graph/graphtest"
 	"github.com/cayleygraph/cayley/graph/graphtest/testutil"
 	"github.com/cayleygraph/cayley/graph/iterator"
 	"github.com/cayleygraph/cayley/graph/kv"
+	"github.com/cayleygraph/cayley/graph/path"
+	"github.com/cayleygraph/cayley/graph/shape"
+	"github.com/cayleygraph/cayley/graph/stats"
 	"github.com/cayleygraph/cayley/quad"
 	"github.com/stretchr/testify/require"
 )
@@ -18,6 +26,10 @@ type DatabaseFunc func(t testing.TB) (kv.BucketKV, graph.Options, func())
 
 type Config struct {
 	AlwaysRunIntegration bool
+
+	// Reopen enables durability tests. It must close the database and open it again from the same location.
+	// See graphtest.Config for details.
+	Reopen func(t testing.TB, db kv.BucketKV, kill bool) (kv.BucketKV, error)
 }
 
 func (c Config) quadStore() *graphtest.Config {
@@ -58,12 +70,150 @@ func TestAll(t *testing.T, gen DatabaseFunc, conf *Config) {
 		conf = &Config{}
 	}
 	qsgen := NewQuadStoreFunc(gen)
+	qconf := conf.quadStore()
+	if conf.Reopen != nil {
+		qsgen, qconf.Reopen = reopenable(gen, conf.Reopen)
+	}
+	t.Run("kv", func(t *testing.T) {
+		TestKV(t, gen)
+	})
 	t.Run("qs", func(t *testing.T) {
-		graphtest.TestAll(t, qsgen, conf.quadStore())
+		graphtest.TestAll(t, qsgen, qconf)
 	})
 	t.Run("optimize", func(t *testing.T) {
 		testOptimize(t, gen, conf)
 	})
+	t.Run("value index", func(t *testing.T) {
+		testValueIndex(t, gen)
+	})
+	t.Run("quad indexes", func(t *testing.T) {
+		testQuadIndexes(t, gen, conf)
+	})
+	t.Run("value hash", func(t *testing.T) {
+		testValueHash(t, gen)
+	})
+	t.Run("estimates", func(t *testing.T) {
+		testEstimates(t, gen)
+	})
+}
+
+// reopenable returns a function that creates quad stores and keeps track of their databases,
+// and a function to reopen these quad stores.
+func reopenable(gen DatabaseFunc, reopen func(t testing.TB, db kv.BucketKV, kill bool) (kv.BucketKV, error)) (
+	testutil.DatabaseFunc, func(t testing.TB, qs graph.QuadStore, kill bool) (graph.QuadStore, error),
+) {
+	type database struct {
+		db  kv.BucketKV
+		opt graph.Options
+	}
+	var (
+		mu  sync.Mutex
+		dbs = make(map[graph.QuadStore]database)
+	)
+	qsgen := func(t testing.TB) (graph.QuadStore, graph.Options, func()) {
+		var db kv.BucketKV
+		qs, opt, closer := NewQuadStore(t, func(t testing.TB) (kv.BucketKV, graph.Options, func()) {
+			var (
+				opt    graph.Options
+				closer func()
+			)
+			db, opt, closer = gen(t)
+			return db, opt, closer
+		})
+		mu.Lock()
+		dbs[qs] = database{db: db, opt: opt}
+		mu.Unlock()
+		return qs, opt, closer
+	}
+	reopenQS := func(t testing.TB, qs graph.QuadStore, kill bool) (graph.QuadStore, error) {
+		mu.Lock()
+		d, ok := dbs[qs]
+		mu.Unlock()
+		require.True(t, ok, "unknown quad store")
+
+		db, err := reopen(t, d.db, kill)
+		if err != nil {
+			return nil, err
+		}
+		d.db = db
+		nqs, err := kv.New(d.db, d.opt)
+		if err != nil {
+			d.db.Close()
+			require.NoError(t, err)
+		}
+		mu.Lock()
+		delete(dbs, qs)
+		dbs[nqs] = d
+		mu.Unlock()
+		return nqs, nil
+	}
+	return qsgen, reopenQS
+}
+
+// TestReadOnly checks that a registered backend opened with the "read_only" option rejects writes,
+// and that the same database can be opened in read-only mode multiple times.
+func TestReadOnly(t *testing.T, name string) {
+	dir, err := ioutil.TempDir("", "cayley_test_"+name)
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	require.NoError(t, graph.InitQuadStore(name, dir, nil))
+	qs, err := graph.NewQuadStore(name, dir, nil)
+	require.NoError(t, err)
+	q := quad.MakeIRI("a", "b", "c", "")
+	testutil.MakeWriter(t, qs, nil, q)
+	require.NoError(t, qs.Close())
+
+	opts := graph.Options{"read_only": true}
+	ro1, err := graph.NewQuadStore(name, dir, opts)
+	require.NoError(t, err)
+	defer ro1.Close()
+	ro2, err := graph.NewQuadStore(name, dir, opts)
+	require.NoError(t, err)
+	defer ro2.Close()
+
+	for _, qs := range []graph.QuadStore{ro1, ro2} {
+		quads, err := quad.ReadAll(graph.NewQuadStoreReader(qs))
+		require.NoError(t, err)
+		require.Equal(t, []quad.Quad{q}, quads)
+
+		err = testutil.MakeWriter(t, qs, nil).AddQuad(quad.MakeIRI("a", "b", "d", ""))
+		require.True(t, graph.IsNotWritable(err), "unexpected error: %v", err)
+	}
+}
+
+func BenchmarkAll(b *testing.B, gen DatabaseFunc, conf *Config) {
+	if conf == nil {
+		conf = &Config{}
+	}
+	graphtest.BenchmarkAll(b, NewQuadStoreFunc(gen), conf.quadStore())
+}
+
+func testEstimates(t *testing.T, gen DatabaseFunc) {
+	ctx := context.TODO()
+	qs, opts, closer := NewQuadStore(t, gen)
+	defer closer()
+
+	w := testutil.MakeWriter(t, qs, opts,
+		quad.MakeIRI("a", "follows", "b", ""),
+		quad.MakeIRI("a", "follows", "c", ""),
+		quad.MakeIRI("a", "follows", "d", ""),
+	)
+	require.NoError(t, w.RemoveQuad(quad.MakeIRI("a", "follows", "c", "")))
+
+	a := qs.ValueOf(quad.IRI("a"))
+	n, _ := qs.(stats.Estimator).QuadsWith(quad.Subject, a)
+	require.True(t, n >= 2, "estimate must be an upper bound: %d", n)
+
+	// sizes that are reported as exact are used instead of counting quads
+	lto := iterator.NewLinksTo(qs, iterator.NewFixed(a), quad.Subject)
+	size, exact := lto.Size()
+	cnt, err := graph.Iterate(ctx, lto).Count()
+	require.NoError(t, err)
+	require.Equal(t, int64(2), cnt)
+	if exact {
+		require.Equal(t, cnt, size)
+	}
 }
 
 func testOptimize(t *testing.T, gen DatabaseFunc, _ *Config) {
@@ -104,3 +254,251 @@ func testOptimize(t *testing.T, gen DatabaseFunc, _ *Config) {
 		t.Errorf("Discordant tag results, new:%v old:%v", newResults, oldResults)
 	}
 }
+
+// TestKV checks that the key-value database follows the contract of kv.BucketKV.
+func TestKV(t *testing.T, gen DatabaseFunc) {
+	ctx := context.TODO()
+	db, _, closer := gen(t)
+	defer closer()
+	defer db.Close()
+
+	var (
+		b1 = []byte("b")
+		b2 = []byte("b2")
+	)
+	err := kv.Update(ctx, db, func(tx kv.BucketTx) error {
+		b := tx.Bucket(b1)
+		for _, k := range []string{"a2", "a1", "b", "a3", "c"} {
+			if err := b.Put([]byte(k), []byte("v"+k)); err != nil {
+				return err
+			}
+		}
+		if err := b.Del([]byte("a3")); err != nil {
+			return err
+		}
+		// same key in a different bucket
+		return tx.Bucket(b2).Put([]byte("a1"), []byte("x"))
+	})
+	require.NoError(t, err)
+
+	scan := func(b kv.Bucket, pref string) []string {
+		var out []string
+		err := kv.Each(ctx, b, []byte(pref), func(k, v []byte) error {
+			require.Equal(t, "v"+string(k), string(v))
+			out = append(out, string(k))
+			return nil
+		})
+		require.NoError(t, err)
+		return out
+	}
+	err = kv.View(db, func(tx kv.BucketTx) error {
+		b := tx.Bucket(b1)
+		vals, err := b.Get(ctx, [][]byte{[]byte("a1"), []byte("a3"), []byte("d")})
+		require.NoError(t, err)
+		require.Equal(t, [][]byte{[]byte("va1"), nil, nil}, vals)
+
+		_, err = kv.GetOne(ctx, b, []byte("a3"))
+		require.Equal(t, kv.ErrNotFound, err)
+
+		require.Equal(t, []string{"a1", "a2", "b", "c"}, scan(b, ""))
+		require.Equal(t, []string{"a1", "a2"}, scan(b, "a"))
+		require.Equal(t, []string(nil), scan(b, "d"))
+
+		scanFrom := func(pref, from string) []string {
+			var out []string
+			it := kv.ScanFrom(b, []byte(pref), []byte(from))
+			defer it.Close()
+			for it.Next(ctx) {
+				out = append(out, string(it.Key()))
+			}
+			require.NoError(t, it.Err())
+			return out
+		}
+		require.Equal(t, []string{"a2"}, scanFrom("a", "a11"))
+		require.Equal(t, []string{"a1", "a2"}, scanFrom("a", ""))
+		require.Equal(t, []string{"b", "c"}, scanFrom("", "az"))
+		require.Equal(t, []string(nil), scanFrom("a", "b"))
+
+		vals, err = tx.Get(ctx, []kv.BucketKey{
+			{Bucket: b1, Key: []byte("a1")},
+			{Bucket: b2, Key: []byte("a1")},
+			{Bucket: b2, Key: []byte("a2")},
+		})
+		require.NoError(t, err)
+		require.Equal(t, [][]byte{[]byte("va1"), []byte("x"), nil}, vals)
+		return nil
+	})
+	require.NoError(t, err)
+}
+
+func testValueIndex(t *testing.T, gen DatabaseFunc) {
+	ctx := context.TODO()
+	qs, opts, closer := NewQuadStore(t, func(t testing.TB) (kv.BucketKV, graph.Options, func()) {
+		db, opt, closer := gen(t)
+		if opt == nil {
+			opt = make(graph.Options)
+		}
+		opt[kv.OptValueIndex] = true
+		return db, opt, closer
+	})
+	defer closer()
+
+	born := time.Date(1990, 1, 2, 3, 4, 5, 0, time.UTC)
+	w := testutil.MakeWriter(t, qs, opts,
+		quad.Make(quad.IRI("a"), quad.IRI("age"), quad.Int(10), nil),
+		quad.Make(quad.IRI("b"), quad.IRI("age"), quad.Int(25), nil),
+		quad.Make(quad.IRI("c"), quad.IRI("age"), quad.Int(40), nil),
+		quad.Make(quad.IRI("a"), quad.IRI("height"), quad.Float(1.5), nil),
+		quad.Make(quad.IRI("a"), quad.IRI("name"), quad.LangString{Value: "alice", Lang: "en"}, nil),
+		quad.Make(quad.IRI("a"), quad.IRI("name"), quad.LangString{Value: "alisa", Lang: "ru"}, nil),
+		quad.Make(quad.IRI("b"), quad.IRI("name"), quad.LangString{Value: "bob", Lang: "EN"}, nil),
+		quad.Make(quad.IRI("b"), quad.IRI("born"), quad.Time(born), nil),
+	)
+
+	check := func(p *path.Path, exp ...quad.Value) {
+		s, _ := shape.Optimize(p.Shape(), qs)
+		shape.Walk(s, func(s shape.Shape) bool {
+			if f, ok := s.(shape.Filter); ok {
+				_, all := f.From.(shape.AllNodes)
+				require.False(t, all, "filter over all nodes was not replaced: %#v", f)
+			}
+			return true
+		})
+		got, err := p.Iterate(ctx).AllValues(qs)
+		require.NoError(t, err)
+		str := func(arr []quad.Value) []string {
+			out := make([]string, 0, len(arr))
+			for _, v := range arr {
+				out = append(out, quad.StringOf(v))
+			}
+			sort.Strings(out)
+			return out
+		}
+		require.Equal(t, str(exp), str(got))
+	}
+
+	check(path.StartPath(qs).Filter(iterator.CompareGT, quad.Int(20)),
+		quad.Int(25), quad.Int(40))
+	check(path.StartPath(qs).Filter(iterator.CompareGTE, quad.Int(10)).Filter(iterator.CompareLT, quad.Int(40)),
+		quad.Int(10), quad.Int(25))
+	check(path.StartPath(qs).Filter(iterator.CompareLT, quad.Float(2)),
+		quad.Float(1.5))
+	check(path.StartPath(qs).Filter(iterator.CompareGT, quad.Time(born.Add(-time.Second))),
+		quad.Time(born))
+	check(path.StartPath(qs).Filter(iterator.CompareGTE, quad.String("")))
+	check(path.StartPath(qs).Lang("en"),
+		quad.LangString{Value: "alice", Lang: "en"}, quad.LangString{Value: "bob", Lang: "EN"})
+	check(path.StartPath(qs).Filter(iterator.CompareGT, quad.Int(20)).In(quad.IRI("age")),
+		quad.IRI("b"), quad.IRI("c"))
+	check(path.StartPath(qs, quad.IRI("b"), quad.IRI("c")).Out(quad.IRI("age")).And(
+		path.StartPath(qs).Filter(iterator.CompareLT, quad.Int(30)),
+	), quad.Int(25))
+
+	err := w.RemoveQuad(quad.Make(quad.IRI("c"), quad.IRI("age"), quad.Int(40), nil))
+	require.NoError(t, err)
+	check(path.StartPath(qs).Filter(iterator.CompareGT, quad.Int(20)),
+		quad.Int(25))
+}
+
+func testQuadIndexes(t *testing.T, gen DatabaseFunc, conf *Config) {
+	ctx := context.TODO()
+	withIndexes := func(t testing.TB) (kv.BucketKV, graph.Options, func()) {
+		db, opt, closer := gen(t)
+		if opt == nil {
+			opt = make(graph.Options)
+		}
+		opt[graph.OptQuadIndexes] = []string{"ps", "o"}
+		return db, opt, closer
+	}
+	t.Run("qs", func(t *testing.T) {
+		graphtest.TestAll(t, NewQuadStoreFunc(withIndexes), conf.quadStore())
+	})
+
+	qs, opts, closer := NewQuadStore(t, withIndexes)
+	defer closer()
+
+	testutil.MakeWriter(t, qs, opts, graphtest.MakeQuadSet()...)
+
+	check := func(p *path.Path, exp ...quad.Value) {
+		s, _ := shape.Optimize(p.Shape(), qs)
+		shape.Walk(s, func(s shape.Shape) bool {
+			_, ok := s.(shape.QuadsAction)
+			require.False(t, ok, "quad filters were not replaced with an index lookup: %#v", s)
+			return true
+		})
+		got, err := p.Iterate(ctx).AllValues(qs)
+		require.NoError(t, err)
+		str := func(arr []quad.Value) []string {
+			out := make([]string, 0, len(arr))
+			for _, v := range arr {
+				out = append(out, quad.StringOf(v))
+			}
+			sort.Strings(out)
+			return out
+		}
+		require.Equal(t, str(exp), str(got))
+	}
+
+	check(path.StartPath(qs, quad.String("A")).Out(quad.String("follows")),
+		quad.String("B"))
+	check(path.StartPath(qs, quad.String("D")).Out(quad.String("follows")),
+		quad.String("B"), quad.String("G"))
+	check(path.StartPath(qs, quad.String("B")).Out(quad.String("status")),
+		quad.String("cool"))
+
+	// there is no subject index, so a full scan is required
+	it := qs.QuadIterator(quad.Subject, qs.ValueOf(quad.String("C")))
+	_, ok := it.(*kv.QuadIterator)
+	require.False(t, ok)
+	it.Close()
+
+	// predicate lookup uses a prefix of the "ps" index
+	it = qs.QuadIterator(quad.Predicate, qs.ValueOf(quad.String("status")))
+	_, ok = it.(*kv.QuadIterator)
+	require.True(t, ok)
+	require.Len(t, graphtest.IteratedQuads(t, qs, it), 3)
+	it.Close()
+}
+
+func testValueHash(t *testing.T, gen DatabaseFunc) {
+	ctx := context.TODO()
+	for _, name := range []string{quad.HashSHA256, quad.HashFNV128} {
+		t.Run(name, func(t *testing.T) {
+			qs, opts, closer := NewQuadStore(t, func(t testing.TB) (kv.BucketKV, graph.Options, func()) {
+				db, opt, closer := gen(t)
+				if opt == nil {
+					opt = make(graph.Options)
+				}
+				opt[kv.OptValueHash] = name
+				return db, opt, closer
+			})
+			defer closer()
+
+			w := testutil.MakeWriter(t, qs, opts, graphtest.MakeQuadSet()...)
+
+			got, err := path.StartPath(qs, quad.String("D")).Out(quad.String("follows")).Iterate(ctx).AllValues(qs)
+			require.NoError(t, err)
+			require.Len(t, got, 2)
+			for _, v := range got {
+				require.Equal(t, v, qs.NameOf(qs.ValueOf(v)))
+			}
+
+			err = w.RemoveQuad(quad.Make("E", "follows", "F", nil))
+			require.NoError(t, err)
+			require.Nil(t, qs.ValueOf(quad.String("E")))
+
+			probs, err := qs.(*kv.QuadStore).Check(ctx, false)
+			require.NoError(t, err)
+			require.Len(t, probs, 0)
+		})
+	}
+
+	db, opts, closer := gen(t)
+	defer closer()
+	if opts == nil {
+		opts = make(graph.Options)
+	}
+	opts[kv.OptValueHash] = "unknown"
+	require.Error(t, kv.Init(db, opts))
+	db.Close()
+}
@@ -15,6 +15,7 @@
 package leveldb
 
 import (
+	"bytes"
 	"context"
 	"fmt"
 	"os"
@@ -67,8 +68,13 @@ func Create(path string, m graph.Options) (kv.BucketKV, error) {
 }
 
 func Open(path string, m graph.Options) (kv.BucketKV, error) {
+	ro, err := m.BoolKey("read_only", false)
+	if err != nil {
+		return nil, err
+	}
 	db, err := leveldb.OpenFile(path, &opt.Options{
 		ErrorIfMissing: true,
+		ReadOnly:       ro,
 	})
 	if err != nil {
 		return nil, err
@@ -88,11 +94,19 @@ func (db *DB) Type() string {
 func (db *DB) Close() error {
 	return db.DB.Close()
 }
+
+// Compact compacts the whole key range, discarding deleted and overwritten values.
+func (db *DB) Compact(ctx context.Context) error {
+	return db.DB.CompactRange(util.Range{})
+}
 func (db *DB) Tx(update bool) (kv.FlatTx, error) {
 	tx := &Tx{db: db}
 	var err error
 	if update {
 		tx.tx, err = db.DB.OpenTransaction()
+		if err == leveldb.ErrReadOnly {
+			err = graph.ErrNotWritable
+		}
 	} else {
 		tx.sn, err = db.DB.GetSnapshot()
 	}
@@ -160,7 +174,17 @@ func (tx *Tx) Del(k []byte) error {
 	return tx.tx.Delete(k, tx.db.wo)
 }
 func (tx *Tx) Scan(pref []byte) kv.KVIterator {
-	r, ro := util.BytesPrefix(pref), tx.db.ro
+	return tx.scan(util.BytesPrefix(pref))
+}
+func (tx *Tx) ScanFrom(pref, from []byte) kv.KVIterator {
+	r := util.BytesPrefix(pref)
+	if bytes.Compare(from, r.Start) > 0 {
+		r.Start = from
+	}
+	return tx.scan(r)
+}
+func (tx *Tx) scan(r *util.Range) kv.KVIterator {
+	ro := tx.db.ro
 	var it iterator.Iterator
 	if tx.tx != nil {
 		it = tx.tx.NewIterator(r, ro)
@@ -17,6 +17,7 @@ package leveldb
 import (
 	"io/ioutil"
 	"os"
+	"sync"
 	"testing"
 
 	"github.com/cayleygraph/cayley/graph"
@@ -24,6 +25,12 @@ import (
 	"github.com/cayleygraph/cayley/graph/kv/kvtest"
 )
 
+// dirs maps open databases to their directories.
+var dirs = struct {
+	sync.Mutex
+	m map[kv.BucketKV]string
+}{m: make(map[kv.BucketKV]string)}
+
 func makeLeveldb(t testing.TB) (kv.BucketKV, graph.Options, func()) {
 	tmpDir, err := ioutil.TempDir(os.TempDir(), "cayley_test_"+Type)
 	if err != nil {
@@ -34,12 +41,48 @@ func makeLeveldb(t testing.TB) (kv.BucketKV, graph.Options, func()) {
 		os.RemoveAll(tmpDir)
 		t.Fatal("Failed to create Bolt database.", err)
 	}
+	dirs.Lock()
+	dirs.m[db] = tmpDir
+	dirs.Unlock()
 	return db, nil, func() {
 		db.Close()
 		os.RemoveAll(tmpDir)
 	}
 }
 
+// reopenLeveldb closes and opens the database again. Background compactions may write files at any time,
+// thus the database directory cannot be copied consistently to emulate a crash.
+func reopenLeveldb(t testing.TB, db kv.BucketKV, kill bool) (kv.BucketKV, error) {
+	if kill {
+		return nil, graph.ErrOperationNotSupported
+	}
+	dirs.Lock()
+	dir := dirs.m[db]
+	delete(dirs.m, db)
+	dirs.Unlock()
+	if err := db.Close(); err != nil {
+		t.Fatal("Failed to close LevelDB database.", err)
+	}
+	db, err := Open(dir, nil)
+	if err != nil {
+		return nil, err
+	}
+	dirs.Lock()
+	dirs.m[db] = dir
+	dirs.Unlock()
+	return db, nil
+}
+
 func TestLeveldb(t *testing.T) {
-	kvtest.TestAll(t, makeLeveldb, nil)
+	kvtest.TestAll(t, makeLeveldb, &kvtest.Config{
+		Reopen: reopenLeveldb,
+	})
+}
+
+func TestLeveldbReadOnly(t *testing.T) {
+	kvtest.TestReadOnly(t, Type)
+}
+
+func BenchmarkLeveldb(b *testing.B) {
+	kvtest.BenchmarkAll(b, makeLeveldb, nil)
 }
@@ -44,7 +44,7 @@ type QuadIterator struct {
 	prim *proto.Primitive
 }
 
-var _ graph.Iterator = &QuadIterator{}
+var _ graph.BatchIterator = &QuadIterator{}
 
 func NewQuadIterator(qs *QuadStore, ind QuadIndex, vals []uint64) *QuadIterator {
 	return &QuadIterator{
@@ -131,6 +131,9 @@ func (it *QuadIterator) Next(ctx context.Context) bool {
 	if it.err != nil || it.done {
 		return false
 	}
+	if !graph.ScanPrimitive(ctx) {
+		return false
+	}
 	if it.it == nil {
 		if !it.ensureTx() {
 			return false
@@ -179,12 +182,24 @@ func (it *QuadIterator) Next(ctx context.Context) bool {
 	}
 }
 
+func (it *QuadIterator) NextBatch(ctx context.Context, dst []graph.Value) int {
+	n := 0
+	for n < len(dst) && it.Next(ctx) {
+		dst[n] = it.prim
+		n++
+	}
+	return n
+}
+
 func (it *QuadIterator) NextPath(ctx context.Context) bool {
 	return false
 }
 
 func (it *QuadIterator) Contains(ctx context.Context, v graph.Value) bool {
 	it.prim = nil
+	if !graph.ScanPrimitive(ctx) {
+		return false
+	}
 	p, ok := v.(*proto.Primitive)
 	if !ok {
 		return false
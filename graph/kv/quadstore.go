@@ -20,25 +20,27 @@ import (
 	"errors"
 	"fmt"
 	"sync"
+	"time"
 
 	"github.com/cayleygraph/cayley/clog"
 	"github.com/cayleygraph/cayley/graph"
 	"github.com/cayleygraph/cayley/graph/proto"
-	"github.com/cayleygraph/cayley/internal/lru"
 	"github.com/cayleygraph/cayley/quad"
 	"github.com/cayleygraph/cayley/quad/pquads"
 	boom "github.com/tylertreat/BoomFilters"
 )
 
+// Registration describes a key-value backend.
 type Registration struct {
-	NewFunc      NewFunc
-	InitFunc     InitFunc
+	NewFunc      NewFunc  // opens an existing database
+	InitFunc     InitFunc // creates a new database; not used for non-persistent backends
 	IsPersistent bool
 }
 
 type InitFunc func(string, graph.Options) (BucketKV, error)
 type NewFunc func(string, graph.Options) (BucketKV, error)
 
+// Register registers a key-value backend as a quad store with a given name.
 func Register(name string, r Registration) {
 	graph.RegisterQuadStore(name, graph.QuadStoreRegistration{
 		InitFunc: func(addr string, opt graph.Options) error {
@@ -72,12 +74,49 @@ func Register(name string, r Registration) {
 	})
 }
 
+// FlatRegistration describes a key-value backend with a single key space.
+type FlatRegistration struct {
+	NewFunc      FlatNewFunc  // opens an existing database
+	InitFunc     FlatInitFunc // creates a new database; not used for non-persistent backends
+	IsPersistent bool
+}
+
+type FlatInitFunc func(string, graph.Options) (FlatKV, error)
+type FlatNewFunc func(string, graph.Options) (FlatKV, error)
+
+// RegisterFlat registers a key-value backend with a single key space as a quad store with a given name.
+// Buckets are emulated with key prefixes, see FromFlat.
+func RegisterFlat(name string, r FlatRegistration) {
+	wrap := func(fnc func(string, graph.Options) (FlatKV, error)) func(string, graph.Options) (BucketKV, error) {
+		if fnc == nil {
+			return nil
+		}
+		return func(addr string, opt graph.Options) (BucketKV, error) {
+			flat, err := fnc(addr, opt)
+			if err != nil {
+				return nil, err
+			}
+			return FromFlat(flat), nil
+		}
+	}
+	Register(name, Registration{
+		NewFunc:      wrap(r.NewFunc),
+		InitFunc:     wrap(r.InitFunc),
+		IsPersistent: r.IsPersistent,
+	})
+}
+
 const (
 	latestDataVersion = 2
 	nilDataVersion    = 1
 )
 
-var _ graph.BatchQuadStore = (*QuadStore)(nil)
+var (
+	_ graph.BatchResolver = (*QuadStore)(nil)
+	_ graph.Maintainer    = (*QuadStore)(nil)
+
+	_ graph.FeatureReporter = (*QuadStore)(nil)
+)
 
 type QuadStore struct {
 	db BucketKV
@@ -89,7 +128,22 @@ type QuadStore struct {
 		exists []QuadIndex
 	}
 
-	valueLRU *lru.Cache
+	// cache holds values of hot nodes for NameOf and ValueOf
+	cache *graph.ValueCache
+	// valueIndex is set if secondary indexes over typed values are maintained
+	valueIndex bool
+	// hash is a hash function for node values
+	hash *quad.Hasher
+	// unique is a set of predicates with unique objects
+	unique map[quad.Value]struct{}
+	// softDelete is set if removed quads are kept until they are purged
+	softDelete bool
+
+	purge struct {
+		once sync.Once
+		stop chan struct{}
+		done chan struct{}
+	}
 
 	writer    sync.Mutex
 	mapBucket map[string]map[string][]uint64
@@ -104,6 +158,7 @@ type QuadStore struct {
 func newQuadStore(kv BucketKV) *QuadStore {
 	qs := &QuadStore{db: kv}
 	qs.indexes.all = DefaultQuadIndexes
+	qs.hash = quad.HasherByName(quad.HashSHA1)
 	return qs
 }
 
@@ -119,16 +174,56 @@ func Init(kv BucketKV, opt graph.Options) error {
 	if err != nil {
 		return err
 	}
+	dirs, err := opt.QuadIndexesKey(graph.OptQuadIndexes, nil)
+	if err != nil {
+		return err
+	}
+	hname, err := opt.StringKey(OptValueHash, "")
+	if err != nil {
+		return err
+	} else if hname != "" && quad.HasherByName(hname) == nil {
+		return fmt.Errorf("kv: unknown value hash function: %q", hname)
+	}
+	if dirs != nil {
+		qs.indexes.all = make([]QuadIndex, 0, len(dirs))
+		for _, d := range dirs {
+			qs.indexes.all = append(qs.indexes.all, QuadIndex{Dirs: d})
+		}
+	}
 	if err := qs.createBuckets(ctx, upfront); err != nil {
 		return err
 	}
 	if err := setVersion(ctx, qs.db, latestDataVersion); err != nil {
 		return err
 	}
+	if dirs != nil {
+		if err := setQuadIndexes(ctx, qs.db, qs.indexes.all); err != nil {
+			return err
+		}
+	}
+	if hname != "" {
+		if err := setValueHash(ctx, qs.db, hname); err != nil {
+			return err
+		}
+	}
+	if vi, err := opt.BoolKey(OptValueIndex, false); err != nil {
+		return err
+	} else if vi {
+		if err := setValueIndexFlag(ctx, qs.db); err != nil {
+			return err
+		}
+	}
+	if preds, err := opt.UniquePredicatesKey(graph.OptUniquePredicates); err != nil {
+		return err
+	} else if len(preds) != 0 {
+		if err := setUniquePredicates(ctx, qs.db, preds); err != nil {
+			return err
+		}
+	}
 	return nil
 }
 
-func New(kv BucketKV, _ graph.Options) (graph.QuadStore, error) {
+func New(kv BucketKV, opt graph.Options) (graph.QuadStore, error) {
 	ctx := context.TODO()
 	qs := newQuadStore(kv)
 	if vers, err := qs.getMetadata(ctx); err == ErrNoBucket {
@@ -138,11 +233,71 @@ func New(kv BucketKV, _ graph.Options) (graph.QuadStore, error) {
 	} else if vers != latestDataVersion {
 		return nil, errors.New("kv: data version is out of date. Run cayleyupgrade for your config to update the data.")
 	}
-	qs.valueLRU = lru.New(2000)
+	if err := qs.loadMeta(ctx); err != nil {
+		return nil, err
+	}
+	var err error
+	if qs.cache, err = graph.ValueCacheFrom(opt, 2000); err != nil {
+		return nil, err
+	}
+	if qs.softDelete, err = opt.BoolKey(OptSoftDelete, false); err != nil {
+		return nil, err
+	}
+	var retention time.Duration
+	if s, err := opt.StringKey(OptTombstoneRetention, ""); err != nil {
+		return nil, err
+	} else if s != "" {
+		if retention, err = time.ParseDuration(s); err != nil {
+			return nil, err
+		}
+	}
 	qs.initBloomFilter(ctx)
+	if retention > 0 {
+		qs.purge.stop = make(chan struct{})
+		qs.purge.done = make(chan struct{})
+		go qs.runPurge(retention)
+	}
 	return qs, nil
 }
 
+// loadMeta reads optional settings that were stored in the database on init.
+func (qs *QuadStore) loadMeta(ctx context.Context) error {
+	return View(qs.db, func(tx BucketTx) error {
+		vals, err := tx.Bucket(metaBucket).Get(ctx, [][]byte{
+			[]byte(metaQuadIndexes),
+			[]byte(metaValueIndex),
+			[]byte(metaValueHash),
+			[]byte(metaUniquePredicates),
+		})
+		if err == ErrNotFound {
+			return nil
+		} else if err != nil {
+			return err
+		}
+		if len(vals[0]) != 0 {
+			inds, err := parseQuadIndexes(string(vals[0]))
+			if err != nil {
+				return err
+			}
+			qs.indexes.all = inds
+		}
+		vi, err := asInt64(vals[1], 0)
+		if err != nil {
+			return err
+		}
+		qs.valueIndex = vi != 0
+		if len(vals[2]) != 0 {
+			h := quad.HasherByName(string(vals[2]))
+			if h == nil {
+				return fmt.Errorf("kv: unknown value hash function: %q", vals[2])
+			}
+			qs.hash = h
+		}
+		qs.unique = parseUniquePredicates(vals[3])
+		return nil
+	})
+}
+
 func setVersion(ctx context.Context, kv BucketKV, version int64) error {
 	return Update(ctx, kv, func(tx BucketTx) error {
 		var buf [8]byte
@@ -182,7 +337,34 @@ func (qs *QuadStore) Size() int64 {
 	return sz
 }
 
+// Features returns capabilities of the store. Some of them depend on the options the database was created with,
+// and on the key-value backend.
+func (qs *QuadStore) Features() graph.Features {
+	_, compact := qs.db.(graph.Maintainer)
+	return graph.Features{
+		NodeGC:       true,
+		Transactions: true,
+		Compaction:   compact,
+		Check:        true,
+		SoftDelete:   qs.softDelete,
+	}
+}
+
+// Compact reclaims disk space of the underlying key-value store, if it's supported by the backend.
+func (qs *QuadStore) Compact(ctx context.Context) error {
+	if m, ok := qs.db.(graph.Maintainer); ok {
+		return m.Compact(ctx)
+	}
+	return graph.ErrOperationNotSupported
+}
+
 func (qs *QuadStore) Close() error {
+	qs.purge.once.Do(func() {
+		if qs.purge.stop != nil {
+			close(qs.purge.stop)
+			<-qs.purge.done
+		}
+	})
 	return qs.db.Close()
 }
 
@@ -225,7 +407,7 @@ func (qs *QuadStore) horizon(ctx context.Context) int64 {
 	return h
 }
 
-func (qs *QuadStore) ValuesOf(ctx context.Context, vals []graph.Value) ([]quad.Value, error) {
+func (qs *QuadStore) NamesOf(ctx context.Context, vals []graph.Value) ([]quad.Value, error) {
 	out := make([]quad.Value, len(vals))
 	var (
 		inds []int
@@ -242,6 +424,9 @@ func (qs *QuadStore) ValuesOf(ctx context.Context, vals []graph.Value) ([]quad.V
 		case Int64Value:
 			if v == 0 {
 				continue
+			} else if qv, ok := qs.cache.NameOf(nodeCacheKey(uint64(v))); ok {
+				out[i] = qv
+				continue
 			}
 			inds = append(inds, i)
 			refs = append(refs, uint64(v))
@@ -266,13 +451,15 @@ func (qs *QuadStore) ValuesOf(ctx context.Context, vals []graph.Value) ([]quad.V
 			last = err
 			continue
 		}
+		qs.cache.PutName(nodeCacheKey(p.ID), qv)
 		out[inds[i]] = qv
 	}
 	return out, last
 }
+
 func (qs *QuadStore) NameOf(v graph.Value) quad.Value {
 	ctx := context.TODO()
-	vals, err := qs.ValuesOf(ctx, []graph.Value{v})
+	vals, err := qs.NamesOf(ctx, []graph.Value{v})
 	if err != nil {
 		clog.Errorf("error getting NameOf %d: %s", v, err)
 		return nil
@@ -323,6 +510,30 @@ func (qs *QuadStore) getValFromLog(ctx context.Context, tx BucketTx, k uint64) (
 	return pquads.UnmarshalValue(p.Value)
 }
 
+// ValuesOf is the same as NamesOf.
+//
+// Deprecated: use NamesOf.
+func (qs *QuadStore) ValuesOf(ctx context.Context, vals []graph.Value) ([]quad.Value, error) {
+	return qs.NamesOf(ctx, vals)
+}
+
+func (qs *QuadStore) RefsOf(ctx context.Context, vals []quad.Value) ([]graph.Value, error) {
+	out := make([]graph.Value, len(vals))
+	err := View(qs.db, func(tx BucketTx) error {
+		ids, err := qs.resolveQuadValues(ctx, tx, vals)
+		if err != nil {
+			return err
+		}
+		for i, id := range ids {
+			if id != 0 {
+				out[i] = Int64Value(id)
+			}
+		}
+		return nil
+	})
+	return out, err
+}
+
 func (qs *QuadStore) ValueOf(s quad.Value) graph.Value {
 	ctx := context.TODO()
 	var out Int64Value
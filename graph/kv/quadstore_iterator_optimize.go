@@ -19,8 +19,80 @@ import (
 
 	"github.com/cayleygraph/cayley/graph"
 	"github.com/cayleygraph/cayley/graph/iterator"
+	"github.com/cayleygraph/cayley/graph/shape"
+	"github.com/cayleygraph/cayley/quad"
 )
 
+var _ shape.Optimizer = (*QuadStore)(nil)
+
+func (qs *QuadStore) OptimizeShape(s shape.Shape) (shape.Shape, bool) {
+	switch s := s.(type) {
+	case shape.Filter:
+		return qs.optimizeFilter(s)
+	case shape.QuadsAction:
+		return qs.optimizeQuadsAction(s)
+	}
+	return s, false
+}
+
+// optimizeQuadsAction replaces an intersection of quad filters with a single scan of a multi-direction index,
+// if there is an index that starts with at least two of the filtered directions.
+func (qs *QuadStore) optimizeQuadsAction(s shape.QuadsAction) (shape.Shape, bool) {
+	if len(s.Filter) < 2 {
+		return s, false
+	}
+	ind, n := qs.bestIndex(func(d quad.Direction) bool {
+		_, ok := s.Filter[d]
+		return ok
+	})
+	if n < 2 {
+		return s, false
+	}
+	vals := make([]uint64, n)
+	for i, d := range ind.Dirs[:n] {
+		v, ok := s.Filter[d].(Int64Value)
+		if !ok {
+			return s, false
+		}
+		vals[i] = uint64(v)
+	}
+	var rest shape.Quads
+	for d, v := range s.Filter {
+		covered := false
+		for _, d2 := range ind.Dirs[:n] {
+			if d == d2 {
+				covered = true
+				break
+			}
+		}
+		if !covered {
+			rest = append(rest, shape.QuadFilter{Dir: d, Values: shape.Fixed{v}})
+		}
+	}
+	for d, tags := range s.Save {
+		rest = append(rest, shape.QuadFilter{Dir: d, Values: shape.Save{From: shape.AllNodes{}, Tags: tags}})
+	}
+	var quads shape.Shape = quadIndexShape{qs: qs, ind: ind, vals: vals}
+	if len(rest) != 0 {
+		quads = shape.Intersect{quads, rest}
+	}
+	return shape.NodesFrom{Dir: s.Result, Quads: quads}, true
+}
+
+// quadIndexShape is a lookup of quads in an index by a prefix of its directions.
+type quadIndexShape struct {
+	qs   *QuadStore
+	ind  QuadIndex
+	vals []uint64
+}
+
+func (s quadIndexShape) BuildIterator(_ graph.QuadStore) graph.Iterator {
+	return NewQuadIterator(s.qs, s.ind, s.vals)
+}
+func (s quadIndexShape) Optimize(r shape.Optimizer) (shape.Shape, bool) {
+	return s, false
+}
+
 func (qs *QuadStore) OptimizeIterator(it graph.Iterator) (graph.Iterator, bool) {
 	switch it.Type() {
 	case graph.LinksTo:
@@ -9,6 +9,7 @@ import (
 	"sort"
 	"sync"
 	"testing"
+	"time"
 
 	"github.com/cayleygraph/cayley/graph"
 	"github.com/cayleygraph/cayley/graph/kv"
@@ -126,6 +127,10 @@ func TestApplyDeltas(t *testing.T) {
 
 	expect(Ops{
 		{opGet, bMeta, kVers, vVers, nil},
+		{opGet, bMeta, []byte("indexes"), nil, nil},
+		{opGet, bMeta, []byte("value_index"), nil, nil},
+		{opGet, bMeta, []byte("value_hash"), nil, nil},
+		{opGet, bMeta, []byte("unique_predicates"), nil, nil},
 	})
 
 	qw, err := writer.NewSingle(qs, graph.IgnoreOpts{})
@@ -216,6 +221,177 @@ func TestApplyDeltas(t *testing.T) {
 	require.NoError(t, err)
 }
 
+func TestCheck(t *testing.T) {
+	ctx := context.TODO()
+	kdb := btree.New()
+	err := kv.Init(kdb, nil)
+	require.NoError(t, err)
+
+	qs, err := kv.New(kdb, nil)
+	require.NoError(t, err)
+	defer qs.Close()
+
+	qw, err := writer.NewSingle(qs, graph.IgnoreOpts{})
+	require.NoError(t, err)
+	err = qw.AddQuadSet([]quad.Quad{
+		quad.MakeIRI("a", "b", "c", ""),
+		quad.MakeIRI("a", "b", "d", ""),
+	})
+	require.NoError(t, err)
+
+	chk := qs.(graph.Checker)
+	probs, err := chk.Check(ctx, false)
+	require.NoError(t, err)
+	require.Empty(t, probs)
+
+	// break reference counter and quad index
+	err = kv.Update(ctx, kdb, func(tx kv.BucketTx) error {
+		if err := tx.Bucket([]byte(iric("a"))).Del(irih("a")); err != nil {
+			return err
+		}
+		return tx.Bucket([]byte{quad.Object.Prefix()}).Del(be(uint64(qs.ValueOf(quad.IRI("c")).(kv.Int64Value))))
+	})
+	require.NoError(t, err)
+
+	probs, err = chk.Check(ctx, false)
+	require.NoError(t, err)
+	require.Len(t, probs, 2)
+	require.Equal(t, kv.ProblemRefs, probs[0].Kind)
+	require.Equal(t, kv.ProblemIndex, probs[1].Kind)
+	require.False(t, probs[0].Fixed)
+
+	probs, err = chk.Check(ctx, true)
+	require.NoError(t, err)
+	require.Len(t, probs, 2)
+	require.True(t, probs[0].Fixed && probs[1].Fixed)
+
+	probs, err = chk.Check(ctx, false)
+	require.NoError(t, err)
+	require.Empty(t, probs)
+}
+
+func TestUniquePredicates(t *testing.T) {
+	kdb := btree.New()
+	err := kv.Init(kdb, graph.Options{graph.OptUniquePredicates: []string{"<email>"}})
+	require.NoError(t, err)
+
+	qs, err := kv.New(kdb, nil)
+	require.NoError(t, err)
+	defer qs.Close()
+
+	qw, err := writer.NewSingle(qs, graph.IgnoreOpts{})
+	require.NoError(t, err)
+
+	email := func(s, o, l string) quad.Quad {
+		q := quad.MakeIRI(s, "email", "", l)
+		q.Object = quad.String(o)
+		return q
+	}
+	err = qw.AddQuadSet([]quad.Quad{
+		email("alice", "a@example.com", ""),
+		email("alice", "a@example.com", "g"),
+		quad.MakeIRI("bob", "follows", "alice", ""),
+	})
+	require.NoError(t, err)
+
+	err = qw.AddQuad(email("bob", "a@example.com", ""))
+	require.True(t, graph.IsConstraintViolation(err), "%v", err)
+
+	// value is still used in the second graph
+	err = qw.RemoveQuad(email("alice", "a@example.com", ""))
+	require.NoError(t, err)
+	err = qw.AddQuad(email("bob", "a@example.com", ""))
+	require.True(t, graph.IsConstraintViolation(err), "%v", err)
+
+	// move the value to another subject in a single transaction
+	tx := graph.NewTransaction()
+	tx.RemoveQuad(email("alice", "a@example.com", "g"))
+	tx.AddQuad(email("bob", "a@example.com", ""))
+	err = qw.ApplyTransaction(tx)
+	require.NoError(t, err)
+
+	err = qw.AddQuad(email("alice", "a@example.com", ""))
+	require.True(t, graph.IsConstraintViolation(err), "%v", err)
+}
+
+func TestSoftDelete(t *testing.T) {
+	ctx := context.TODO()
+	kdb := btree.New()
+	err := kv.Init(kdb, nil)
+	require.NoError(t, err)
+
+	qs, err := kv.New(kdb, graph.Options{kv.OptSoftDelete: true})
+	require.NoError(t, err)
+	defer qs.Close()
+	sd, ok := graph.AsSoftDeleter(qs)
+	require.True(t, ok)
+
+	qw, err := writer.NewSingle(qs, graph.IgnoreOpts{})
+	require.NoError(t, err)
+	err = qw.AddQuadSet([]quad.Quad{
+		quad.MakeIRI("a", "b", "c", ""),
+		quad.MakeIRI("c", "d", "e", ""),
+	})
+	require.NoError(t, err)
+
+	start := time.Now()
+	err = qw.RemoveQuad(quad.MakeIRI("c", "d", "e", ""))
+	require.NoError(t, err)
+	require.Equal(t, int64(1), qs.Size())
+	// nodes are kept until the quad is purged
+	require.NotNil(t, qs.ValueOf(quad.IRI("e")))
+
+	var removed []graph.Tombstone
+	err = sd.Tombstones(ctx, start, time.Time{}, func(t graph.Tombstone) error {
+		removed = append(removed, t)
+		return nil
+	})
+	require.NoError(t, err)
+	require.Len(t, removed, 1)
+	require.Equal(t, quad.MakeIRI("c", "d", "e", ""), removed[0].Quad)
+
+	probs, err := qs.(graph.Checker).Check(ctx, false)
+	require.NoError(t, err)
+	require.Empty(t, probs)
+
+	n, err := graph.Undelete(ctx, sd, qw, start, time.Time{}, nil)
+	require.NoError(t, err)
+	require.Equal(t, 1, n)
+	require.Equal(t, int64(2), qs.Size())
+	err = qw.AddQuad(quad.MakeIRI("c", "d", "e", ""))
+	require.True(t, graph.IsQuadExist(err), "%v", err)
+
+	// quads that were added again are not restored
+	err = qw.RemoveQuad(quad.MakeIRI("c", "d", "e", ""))
+	require.NoError(t, err)
+	err = qw.AddQuad(quad.MakeIRI("c", "d", "e", ""))
+	require.NoError(t, err)
+	n, err = graph.Undelete(ctx, sd, qw, time.Time{}, time.Time{}, nil)
+	require.NoError(t, err)
+	require.Equal(t, 0, n)
+
+	err = qw.RemoveQuad(quad.MakeIRI("c", "d", "e", ""))
+	require.NoError(t, err)
+	n, err = sd.Purge(ctx, time.Now().Add(time.Second))
+	require.NoError(t, err)
+	require.Equal(t, 3, n)
+	require.Nil(t, qs.ValueOf(quad.IRI("e")))
+
+	probs, err = qs.(graph.Checker).Check(ctx, false)
+	require.NoError(t, err)
+	require.Empty(t, probs)
+
+	// soft deletes are disabled by default
+	kdb = btree.New()
+	err = kv.Init(kdb, nil)
+	require.NoError(t, err)
+	qs2, err := kv.New(kdb, nil)
+	require.NoError(t, err)
+	defer qs2.Close()
+	_, ok = graph.AsSoftDeleter(qs2)
+	require.False(t, ok)
+}
+
 func clone(b []byte) []byte {
 	if b == nil {
 		return nil
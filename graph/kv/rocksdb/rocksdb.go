@@ -0,0 +1,607 @@
+// Copyright 2017 The Cayley Authors. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// +build rocksdb
+
+// Package rocksdb implements a key-value backend on top of RocksDB.
+//
+// It requires cgo and the RocksDB library, thus it is only built with "rocksdb" build tag.
+package rocksdb
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/tecbot/gorocksdb"
+
+	"github.com/cayleygraph/cayley/clog"
+	"github.com/cayleygraph/cayley/graph"
+	"github.com/cayleygraph/cayley/graph/kv"
+)
+
+func init() {
+	kv.Register(Type, kv.Registration{
+		NewFunc:      Open,
+		InitFunc:     Create,
+		IsPersistent: true,
+	})
+}
+
+const (
+	Type = "rocksdb"
+)
+
+var (
+	_ kv.BucketKV      = (*DB)(nil)
+	_ graph.Maintainer = (*DB)(nil)
+)
+
+const defaultFamily = "default"
+
+// layoutKey is stored in the default column family and describes how buckets are stored.
+var layoutKey = []byte("cayley_layout")
+
+const (
+	layoutFamilies = "families" // column family per bucket
+	layoutFlat     = "flat"     // all buckets in the default column family
+)
+
+func newOptions(m graph.Options) (*gorocksdb.Options, error) {
+	cacheSize, err := m.IntKey("cache_size_mb", 8)
+	if err != nil {
+		return nil, err
+	}
+	writeBuffer, err := m.IntKey("write_buffer_mb", 64)
+	if err != nil {
+		return nil, err
+	}
+	compactions, err := m.IntKey("max_background_compactions", 0)
+	if err != nil {
+		return nil, err
+	}
+	rate, err := m.IntKey("compaction_rate_mb", 0)
+	if err != nil {
+		return nil, err
+	}
+	opts := gorocksdb.NewDefaultOptions()
+	bbto := gorocksdb.NewDefaultBlockBasedTableOptions()
+	bbto.SetBlockCache(gorocksdb.NewLRUCache(uint64(cacheSize) * 1024 * 1024))
+	opts.SetBlockBasedTableFactory(bbto)
+	opts.SetWriteBufferSize(writeBuffer * 1024 * 1024)
+	if compactions > 0 {
+		opts.SetMaxBackgroundCompactions(compactions)
+	}
+	if rate > 0 {
+		// limits the total write rate of flushes and compactions
+		opts.SetRateLimiter(gorocksdb.NewRateLimiter(int64(rate)*1024*1024, 100*1000, 10))
+	}
+	return opts, nil
+}
+
+func newDB(d *gorocksdb.DB, opts *gorocksdb.Options, m graph.Options) *DB {
+	db := &DB{
+		db:   d,
+		opts: opts,
+		wo:   gorocksdb.NewDefaultWriteOptions(),
+		ro:   gorocksdb.NewDefaultReadOptions(),
+		cfs:  make(map[string]*gorocksdb.ColumnFamilyHandle),
+	}
+	nosync, _ := m.BoolKey("nosync", false)
+	db.wo.SetSync(!nosync)
+	return db
+}
+
+func Create(path string, m graph.Options) (kv.BucketKV, error) {
+	families, err := m.BoolKey("column_families", true)
+	if err != nil {
+		return nil, err
+	}
+	if err = os.MkdirAll(path, 0700); err != nil {
+		return nil, err
+	}
+	opts, err := newOptions(m)
+	if err != nil {
+		return nil, err
+	}
+	opts.SetCreateIfMissing(true)
+	opts.SetErrorIfExists(true)
+	d, err := gorocksdb.OpenDb(opts, path)
+	if err != nil {
+		opts.Destroy()
+		if strings.Contains(err.Error(), "exists") {
+			return nil, graph.ErrDatabaseExists
+		}
+		clog.Errorf("Error: couldn't create RocksDB database: %v", err)
+		return nil, err
+	}
+	db := newDB(d, opts, m)
+	db.families = families
+	layout := layoutFlat
+	if families {
+		layout = layoutFamilies
+	}
+	if err = d.Put(db.wo, layoutKey, []byte(layout)); err != nil {
+		db.Close()
+		return nil, err
+	}
+	return db, nil
+}
+
+func Open(path string, m graph.Options) (kv.BucketKV, error) {
+	ro, err := m.BoolKey("read_only", false)
+	if err != nil {
+		return nil, err
+	}
+	opts, err := newOptions(m)
+	if err != nil {
+		return nil, err
+	}
+	names, err := gorocksdb.ListColumnFamilies(opts, path)
+	if err != nil {
+		opts.Destroy()
+		return nil, err
+	}
+	cfOpts := make([]*gorocksdb.Options, len(names))
+	for i := range cfOpts {
+		cfOpts[i] = opts
+	}
+	var (
+		d       *gorocksdb.DB
+		handles []*gorocksdb.ColumnFamilyHandle
+	)
+	if ro {
+		d, handles, err = gorocksdb.OpenDbForReadOnlyColumnFamilies(opts, path, names, cfOpts, false)
+	} else {
+		d, handles, err = gorocksdb.OpenDbColumnFamilies(opts, path, names, cfOpts)
+	}
+	if err != nil {
+		opts.Destroy()
+		clog.Errorf("Error, couldn't open! %v", err)
+		return nil, err
+	}
+	db := newDB(d, opts, m)
+	db.readOnly = ro
+	for i, name := range names {
+		if name == defaultFamily {
+			handles[i].Destroy()
+			continue
+		}
+		db.cfs[name] = handles[i]
+	}
+	s, err := d.Get(db.ro, layoutKey)
+	if err != nil {
+		db.Close()
+		return nil, err
+	}
+	layout := string(s.Data())
+	s.Free()
+	switch layout {
+	case layoutFamilies:
+		db.families = true
+	case layoutFlat:
+	default:
+		db.Close()
+		return nil, fmt.Errorf("rocksdb: unknown data layout: %q", layout)
+	}
+	if ro {
+		clog.Infof("Running in read-only mode")
+	}
+	return db, nil
+}
+
+type DB struct {
+	db       *gorocksdb.DB
+	opts     *gorocksdb.Options
+	wo       *gorocksdb.WriteOptions
+	ro       *gorocksdb.ReadOptions
+	readOnly bool
+	families bool // store each bucket in a separate column family
+
+	mu     sync.RWMutex // protects column families map
+	cfs    map[string]*gorocksdb.ColumnFamilyHandle
+	closed bool
+	wmu    sync.Mutex // held by write transactions
+}
+
+func (db *DB) Type() string {
+	return Type
+}
+
+// Close releases the database. It is safe to call it more than once.
+func (db *DB) Close() error {
+	db.mu.Lock()
+	if db.closed {
+		db.mu.Unlock()
+		return nil
+	}
+	db.closed = true
+	for name, cf := range db.cfs {
+		cf.Destroy()
+		delete(db.cfs, name)
+	}
+	db.mu.Unlock()
+	db.db.Close()
+	db.wo.Destroy()
+	db.ro.Destroy()
+	db.opts.Destroy()
+	return nil
+}
+
+// Compact compacts all column families. Compaction is rate-limited if compaction_rate_mb is set.
+func (db *DB) Compact(ctx context.Context) error {
+	if db.readOnly {
+		return graph.ErrNotWritable
+	}
+	db.db.CompactRange(gorocksdb.Range{})
+	db.mu.RLock()
+	cfs := make([]*gorocksdb.ColumnFamilyHandle, 0, len(db.cfs))
+	for _, cf := range db.cfs {
+		cfs = append(cfs, cf)
+	}
+	db.mu.RUnlock()
+	for _, cf := range cfs {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		db.db.CompactRangeCF(cf, gorocksdb.Range{})
+	}
+	return nil
+}
+
+// familyFor returns a column family name and a key prefix for the bucket.
+//
+// Node buckets are sharded by a hash prefix ('v' or 'n' followed by two bytes of the hash),
+// thus they share a column family per kind instead of creating thousands of families.
+// Each quad index, the log and metadata get a separate column family.
+func familyFor(bucket []byte) (string, []byte) {
+	if len(bucket) == 3 && (bucket[0] == 'v' || bucket[0] == 'n') {
+		return string(bucket[:1]), bucket[1:]
+	}
+	return string(bucket), nil
+}
+
+// bucket resolves a column family and a key prefix for the bucket.
+// A nil column family means the default one.
+func (db *DB) bucket(name []byte, create bool) (*gorocksdb.ColumnFamilyHandle, []byte, error) {
+	if !db.families {
+		pref := make([]byte, len(name)+1)
+		copy(pref, name)
+		pref[len(name)] = '/'
+		return nil, pref, nil
+	}
+	fam, pref := familyFor(name)
+	db.mu.RLock()
+	cf := db.cfs[fam]
+	db.mu.RUnlock()
+	if cf != nil {
+		return cf, pref, nil
+	} else if !create {
+		return nil, nil, kv.ErrNoBucket
+	}
+	db.mu.Lock()
+	defer db.mu.Unlock()
+	if cf = db.cfs[fam]; cf != nil {
+		return cf, pref, nil
+	}
+	cf, err := db.db.CreateColumnFamily(db.opts, fam)
+	if err != nil {
+		return nil, nil, err
+	}
+	db.cfs[fam] = cf
+	return cf, pref, nil
+}
+
+func (db *DB) get(ro *gorocksdb.ReadOptions, cf *gorocksdb.ColumnFamilyHandle, key []byte) ([]byte, error) {
+	var (
+		s   *gorocksdb.Slice
+		err error
+	)
+	if cf == nil {
+		s, err = db.db.Get(ro, key)
+	} else {
+		s, err = db.db.GetCF(ro, cf, key)
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer s.Free()
+	if !s.Exists() {
+		return nil, nil
+	}
+	return clone(s.Data()), nil
+}
+
+func (db *DB) iterator(ro *gorocksdb.ReadOptions, cf *gorocksdb.ColumnFamilyHandle) *gorocksdb.Iterator {
+	if cf == nil {
+		return db.db.NewIterator(ro)
+	}
+	return db.db.NewIteratorCF(ro, cf)
+}
+
+func clone(p []byte) []byte {
+	b := make([]byte, len(p))
+	copy(b, p)
+	return b
+}
+
+func (db *DB) Tx(update bool) (kv.BucketTx, error) {
+	tx := &Tx{db: db}
+	if update {
+		if db.readOnly {
+			return nil, graph.ErrNotWritable
+		}
+		db.wmu.Lock()
+		tx.wb = gorocksdb.NewWriteBatch()
+		tx.pending = make(map[*gorocksdb.ColumnFamilyHandle]map[string]write)
+	}
+	tx.sn = db.db.NewSnapshot()
+	tx.ro = gorocksdb.NewDefaultReadOptions()
+	tx.ro.SetSnapshot(tx.sn)
+	return tx, nil
+}
+
+// write is a value written in a transaction.
+type write struct {
+	val []byte
+	del bool
+}
+
+// Tx reads from a snapshot of the database. Writes are collected in a batch that is applied on commit;
+// they are also tracked separately, so the transaction can read its own writes.
+type Tx struct {
+	db   *DB
+	sn   *gorocksdb.Snapshot
+	ro   *gorocksdb.ReadOptions
+	wb   *gorocksdb.WriteBatch // nil for read-only transactions
+	done bool
+
+	pending map[*gorocksdb.ColumnFamilyHandle]map[string]write
+}
+
+func (tx *Tx) get(cf *gorocksdb.ColumnFamilyHandle, key []byte) ([]byte, error) {
+	if w, ok := tx.pending[cf][string(key)]; ok {
+		if w.del {
+			return nil, nil
+		}
+		return w.val, nil
+	}
+	return tx.db.get(tx.ro, cf, key)
+}
+
+func (tx *Tx) Get(ctx context.Context, keys []kv.BucketKey) ([][]byte, error) {
+	vals := make([][]byte, len(keys))
+	for i, k := range keys {
+		cf, pref, err := tx.db.bucket(k.Bucket, false)
+		if err == kv.ErrNoBucket {
+			continue
+		} else if err != nil {
+			return nil, err
+		}
+		vals[i], err = tx.get(cf, append(clone(pref), k.Key...))
+		if err != nil {
+			return nil, err
+		}
+	}
+	return vals, nil
+}
+
+func (tx *Tx) Commit(ctx context.Context) error {
+	if tx.done {
+		return errors.New("rocksdb: transaction is already closed")
+	}
+	var err error
+	if tx.wb != nil {
+		err = tx.db.db.Write(tx.db.wo, tx.wb)
+	}
+	tx.release()
+	return err
+}
+
+func (tx *Tx) Rollback() error {
+	tx.release()
+	return nil
+}
+
+func (tx *Tx) release() {
+	if tx.done {
+		return
+	}
+	tx.done = true
+	tx.ro.Destroy()
+	tx.db.db.ReleaseSnapshot(tx.sn)
+	if tx.wb != nil {
+		tx.wb.Destroy()
+		tx.pending = nil
+		tx.db.wmu.Unlock()
+	}
+}
+
+func (tx *Tx) Bucket(name []byte) kv.Bucket {
+	cf, pref, err := tx.db.bucket(name, tx.wb != nil)
+	return &Bucket{tx: tx, cf: cf, pref: pref, err: err}
+}
+
+type Bucket struct {
+	tx   *Tx
+	cf   *gorocksdb.ColumnFamilyHandle
+	pref []byte
+	err  error
+}
+
+func (b *Bucket) key(k []byte) []byte {
+	key := make([]byte, len(b.pref)+len(k))
+	n := copy(key, b.pref)
+	copy(key[n:], k)
+	return key
+}
+
+func (b *Bucket) Get(ctx context.Context, keys [][]byte) ([][]byte, error) {
+	if b.err != nil {
+		return nil, b.err
+	}
+	vals := make([][]byte, len(keys))
+	for i, k := range keys {
+		v, err := b.tx.get(b.cf, b.key(k))
+		if err != nil {
+			return nil, err
+		}
+		vals[i] = v
+	}
+	return vals, nil
+}
+
+func (b *Bucket) write(k []byte, w write) {
+	m := b.tx.pending[b.cf]
+	if m == nil {
+		m = make(map[string]write)
+		b.tx.pending[b.cf] = m
+	}
+	m[string(k)] = w
+}
+
+func (b *Bucket) Put(k, v []byte) error {
+	if b.err != nil {
+		return b.err
+	} else if b.tx.wb == nil {
+		return fmt.Errorf("put in ro tx")
+	}
+	k = b.key(k)
+	if b.cf == nil {
+		b.tx.wb.Put(k, v)
+	} else {
+		b.tx.wb.PutCF(b.cf, k, v)
+	}
+	b.write(k, write{val: clone(v)})
+	return nil
+}
+
+func (b *Bucket) Del(k []byte) error {
+	if b.err != nil {
+		return b.err
+	} else if b.tx.wb == nil {
+		return fmt.Errorf("del in ro tx")
+	}
+	k = b.key(k)
+	if b.cf == nil {
+		b.tx.wb.Delete(k)
+	} else {
+		b.tx.wb.DeleteCF(b.cf, k)
+	}
+	b.write(k, write{del: true})
+	return nil
+}
+
+func (b *Bucket) Scan(pref []byte) kv.KVIterator {
+	return &Iterator{b: b, pref: b.key(pref)}
+}
+
+// Iterator merges keys from the snapshot with keys written in the current transaction.
+type Iterator struct {
+	b    *Bucket
+	pref []byte // full key prefix, including the bucket prefix
+	it   *gorocksdb.Iterator
+	pend []string // sorted keys written in the transaction
+	pi   int      // index of the next written key
+	db   bool     // current key was read from the snapshot
+	done bool
+	k, v []byte
+}
+
+func (it *Iterator) init() {
+	it.it = it.b.tx.db.iterator(it.b.tx.ro, it.b.cf)
+	it.it.Seek(it.pref)
+	for k := range it.b.tx.pending[it.b.cf] {
+		if strings.HasPrefix(k, string(it.pref)) {
+			it.pend = append(it.pend, k)
+		}
+	}
+	sort.Strings(it.pend)
+}
+
+func (it *Iterator) Next(ctx context.Context) bool {
+	if it.b.err != nil || it.done {
+		return false
+	}
+	if it.it == nil {
+		it.init()
+	} else if it.db {
+		it.it.Next()
+	} else {
+		it.pi++
+	}
+	pending := it.b.tx.pending[it.b.cf]
+	for {
+		var dk []byte
+		if it.it.ValidForPrefix(it.pref) {
+			dk = it.it.Key().Data()
+			if _, ok := pending[string(dk)]; ok {
+				// overwritten in this transaction
+				it.it.Next()
+				continue
+			}
+		}
+		var (
+			pk string
+			w  write
+		)
+		hasPending := it.pi < len(it.pend)
+		if hasPending {
+			pk = it.pend[it.pi]
+			if w = pending[pk]; w.del {
+				it.pi++
+				continue
+			}
+		}
+		switch {
+		case dk == nil && !hasPending:
+			it.done = true
+			return false
+		case dk != nil && (!hasPending || bytes.Compare(dk, []byte(pk)) < 0):
+			it.k, it.v = clone(dk), clone(it.it.Value().Data())
+			it.db = true
+		default:
+			it.k, it.v = []byte(pk), w.val
+			it.db = false
+		}
+		return true
+	}
+}
+
+func (it *Iterator) Key() []byte { return it.k[len(it.b.pref):] }
+func (it *Iterator) Val() []byte { return it.v }
+
+func (it *Iterator) Err() error {
+	if it.b.err != nil {
+		return it.b.err
+	} else if it.it != nil {
+		return it.it.Err()
+	}
+	return nil
+}
+
+func (it *Iterator) Close() error {
+	err := it.Err()
+	if it.it != nil {
+		it.it.Close()
+		it.it = nil
+	}
+	it.done = true
+	return err
+}
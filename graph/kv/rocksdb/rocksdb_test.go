@@ -0,0 +1,74 @@
+// Copyright 2017 The Cayley Authors. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// +build rocksdb
+
+package rocksdb
+
+import (
+	"io/ioutil"
+	"os"
+	"testing"
+
+	"github.com/cayleygraph/cayley/graph"
+	"github.com/cayleygraph/cayley/graph/kv"
+	"github.com/cayleygraph/cayley/graph/kv/kvtest"
+)
+
+func makeRocksdb(opts graph.Options) kvtest.DatabaseFunc {
+	return func(t testing.TB) (kv.BucketKV, graph.Options, func()) {
+		tmpDir, err := ioutil.TempDir(os.TempDir(), "cayley_test_"+Type)
+		if err != nil {
+			t.Fatalf("Could not create working directory: %v", err)
+		}
+		db, err := Create(tmpDir, opts)
+		if err != nil {
+			os.RemoveAll(tmpDir)
+			t.Fatal("Failed to create RocksDB database.", err)
+		}
+		return db, nil, func() {
+			db.Close()
+			os.RemoveAll(tmpDir)
+		}
+	}
+}
+
+// reopenRocksdb closes and opens the database again. RocksDB holds a lock on the database directory,
+// thus it cannot be released uncleanly in the same process.
+func reopenRocksdb(t testing.TB, db kv.BucketKV, kill bool) (kv.BucketKV, error) {
+	if kill {
+		return nil, graph.ErrOperationNotSupported
+	}
+	path := db.(*DB).db.Name()
+	if err := db.Close(); err != nil {
+		t.Fatal("Failed to close RocksDB database.", err)
+	}
+	return Open(path, nil)
+}
+
+func TestRocksdb(t *testing.T) {
+	kvtest.TestAll(t, makeRocksdb(nil), &kvtest.Config{
+		Reopen: reopenRocksdb,
+	})
+}
+
+func TestRocksdbFlat(t *testing.T) {
+	kvtest.TestAll(t, makeRocksdb(graph.Options{"column_families": false}), &kvtest.Config{
+		Reopen: reopenRocksdb,
+	})
+}
+
+func BenchmarkRocksdb(b *testing.B) {
+	kvtest.BenchmarkAll(b, makeRocksdb(nil), nil)
+}
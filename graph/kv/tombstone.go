@@ -0,0 +1,265 @@
+// Copyright 2017 The Cayley Authors. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package kv
+
+import (
+	"bytes"
+	"context"
+	"sort"
+	"time"
+
+	"github.com/cayleygraph/cayley/clog"
+	"github.com/cayleygraph/cayley/graph"
+	graphlog "github.com/cayleygraph/cayley/graph/log"
+	"github.com/cayleygraph/cayley/graph/proto"
+	"github.com/cayleygraph/cayley/quad"
+)
+
+const (
+	// OptSoftDelete is an option name that enables soft deletes (see graph.SoftDeleter and graph.AsSoftDeleter).
+	// Removed quads are kept with their nodes until they are purged, and can be restored.
+	OptSoftDelete = "soft_delete"
+	// OptTombstoneRetention is an option name for a duration after which removed quads are purged.
+	// If it is not set, removed quads are only purged by an explicit call to Purge.
+	OptTombstoneRetention = "tombstone_retention"
+)
+
+var _ graph.SoftDeleter = (*QuadStore)(nil)
+
+// tombstoneBucket stores removed quads that still hold references to their nodes.
+//
+// Keys consist of the removal time in nanoseconds and a quad ID, thus tombstones are sorted by time.
+// Values are empty.
+var tombstoneBucket = []byte("tombstones")
+
+func tombstoneKey(t int64, id uint64) []byte {
+	key := make([]byte, 16)
+	quadKeyEnc.PutUint64(key, uint64(t))
+	quadKeyEnc.PutUint64(key[8:], id)
+	return key
+}
+
+type tombstone struct {
+	key  []byte
+	id   uint64
+	time int64
+}
+
+// keepNodeRefs changes node updates in a way that removed quads do not decrement node reference counters.
+// Nodes that are only used by removed quads are still returned in DecNode to resolve their IDs.
+func keepNodeRefs(d *graphlog.Deltas) {
+	if len(d.QuadDel) == 0 {
+		return
+	}
+	dels := make(map[graph.ValueHash]int)
+	for _, q := range d.QuadDel {
+		for _, dir := range quad.Directions {
+			if h := q.Quad.Get(dir); h.Valid() {
+				dels[h]++
+			}
+		}
+	}
+	nodes := append(d.IncNode, d.DecNode...)
+	d.IncNode, d.DecNode = d.IncNode[:0:0], nil
+	for _, n := range nodes {
+		n.RefInc += dels[n.Hash]
+		if n.RefInc > 0 {
+			d.IncNode = append(d.IncNode, n)
+		} else {
+			d.DecNode = append(d.DecNode, n)
+		}
+	}
+	sort.Slice(d.IncNode, func(i, j int) bool {
+		return bytes.Compare(d.IncNode[i].Hash[:], d.IncNode[j].Hash[:]) < 0
+	})
+	sort.Slice(d.DecNode, func(i, j int) bool {
+		return bytes.Compare(d.DecNode[i].Hash[:], d.DecNode[j].Hash[:]) < 0
+	})
+}
+
+func (qs *QuadStore) addTombstones(tx BucketTx, links []proto.Primitive) error {
+	if len(links) == 0 {
+		return nil
+	}
+	b := tx.Bucket(tombstoneBucket)
+	now := time.Now().UnixNano()
+	for _, p := range links {
+		if err := b.Put(tombstoneKey(now, p.ID), []byte{}); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// scanTombstones returns tombstones in a given time range. Zero time means no limit.
+func scanTombstones(ctx context.Context, tx BucketTx, since, until time.Time) ([]tombstone, error) {
+	var from []byte
+	if !since.IsZero() {
+		from = tombstoneKey(since.UnixNano(), 0)
+	}
+	it := ScanFrom(tx.Bucket(tombstoneBucket), nil, from)
+	defer it.Close()
+	var out []tombstone
+	for it.Next(ctx) {
+		k := it.Key()
+		if len(k) != 16 {
+			continue
+		}
+		t := int64(quadKeyEnc.Uint64(k))
+		if !until.IsZero() && t >= until.UnixNano() {
+			break
+		}
+		out = append(out, tombstone{
+			key: append([]byte{}, k...),
+			id:  quadKeyEnc.Uint64(k[8:]), time: t,
+		})
+	}
+	err := it.Err()
+	if err == ErrNoBucket {
+		err = nil
+	}
+	return out, err
+}
+
+func (qs *QuadStore) tombstonePrimitives(ctx context.Context, tx BucketTx, ts []tombstone) ([]*proto.Primitive, error) {
+	if len(ts) == 0 {
+		return nil, nil
+	}
+	ids := make([]uint64, 0, len(ts))
+	for _, t := range ts {
+		ids = append(ids, t.id)
+	}
+	return qs.getPrimitivesFromLog(ctx, tx, ids)
+}
+
+// Tombstones implements graph.SoftDeleter. It returns ErrOperationNotSupported if soft deletes are disabled.
+func (qs *QuadStore) Tombstones(ctx context.Context, since, until time.Time, fnc func(t graph.Tombstone) error) error {
+	if !qs.softDelete {
+		return graph.ErrOperationNotSupported
+	}
+	return View(qs.db, func(tx BucketTx) error {
+		ts, err := scanTombstones(ctx, tx, since, until)
+		if err != nil {
+			return err
+		}
+		prims, err := qs.tombstonePrimitives(ctx, tx, ts)
+		if err != nil {
+			return err
+		}
+		for i, t := range ts {
+			p := prims[i]
+			if p == nil || !p.Deleted {
+				continue
+			}
+			q, err := qs.primitiveToQuad(ctx, tx, p)
+			if err != nil {
+				return err
+			}
+			if err = fnc(graph.Tombstone{Quad: q, Deleted: time.Unix(0, t.time)}); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// Purge implements graph.SoftDeleter. Nodes that are no longer used by any quad are removed.
+// It returns ErrOperationNotSupported if soft deletes are disabled.
+func (qs *QuadStore) Purge(ctx context.Context, before time.Time) (int, error) {
+	if !qs.softDelete {
+		return 0, graph.ErrOperationNotSupported
+	} else if before.IsZero() {
+		return 0, nil
+	}
+	qs.writer.Lock()
+	defer qs.writer.Unlock()
+	tx, err := qs.db.Tx(true)
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+	ts, err := scanTombstones(ctx, tx, time.Time{}, before)
+	if err != nil {
+		return 0, err
+	}
+	prims, err := qs.tombstonePrimitives(ctx, tx, ts)
+	if err != nil {
+		return 0, err
+	}
+	b := tx.Bucket(tombstoneBucket)
+	refs := make(map[uint64]int)
+	n := 0
+	for i, t := range ts {
+		if err = b.Del(t.key); err != nil {
+			return 0, err
+		}
+		p := prims[i]
+		if p == nil || !p.Deleted {
+			continue
+		}
+		n++
+		for _, d := range quad.Directions {
+			if id := p.GetDirection(d); id != 0 {
+				refs[id]++
+			}
+		}
+	}
+	upds := make([]graphlog.NodeUpdate, 0, len(refs))
+	ids := make(map[graph.ValueHash]uint64, len(refs))
+	for id, cnt := range refs {
+		v, err := qs.getValFromLog(ctx, tx, id)
+		if err == ErrNotFound {
+			continue
+		} else if err != nil {
+			return 0, err
+		}
+		h := graph.HashOf(v)
+		upds = append(upds, graphlog.NodeUpdate{Hash: h, Val: v, RefInc: -cnt})
+		ids[h] = id
+	}
+	sort.Slice(upds, func(i, j int) bool {
+		return bytes.Compare(upds[i].Hash[:], upds[j].Hash[:]) < 0
+	})
+	if err = qs.decNodes(ctx, tx, upds, ids); err != nil {
+		return 0, err
+	} else if err = tx.Commit(ctx); err != nil {
+		return 0, err
+	}
+	return n, nil
+}
+
+// runPurge periodically purges quads removed more than retention ago, until the store is closed.
+func (qs *QuadStore) runPurge(retention time.Duration) {
+	defer close(qs.purge.done)
+	interval := retention
+	if interval > time.Hour {
+		interval = time.Hour
+	}
+	t := time.NewTicker(interval)
+	defer t.Stop()
+	for {
+		select {
+		case <-qs.purge.stop:
+			return
+		case <-t.C:
+			n, err := qs.Purge(context.TODO(), time.Now().Add(-retention))
+			if err != nil {
+				clog.Errorf("kv: failed to purge removed quads: %v", err)
+			} else if n != 0 && clog.V(1) {
+				clog.Infof("kv: purged %d removed quads", n)
+			}
+		}
+	}
+}
@@ -0,0 +1,140 @@
+// Copyright 2017 The Cayley Authors. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package kv
+
+import (
+	"context"
+	"strings"
+
+	"github.com/cayleygraph/cayley/graph"
+	"github.com/cayleygraph/cayley/graph/proto"
+	"github.com/cayleygraph/cayley/quad"
+)
+
+const metaUniquePredicates = "unique_predicates"
+
+// uniqueBucket stores an index of objects of unique predicates (see graph.OptUniquePredicates).
+//
+// Keys consist of predicate and object ids. Values consist of a subject id and the number of quads
+// with this subject, predicate and object, since such quads may only differ by labels.
+var uniqueBucket = []byte("unique")
+
+func setUniquePredicates(ctx context.Context, kv BucketKV, preds []quad.Value) error {
+	strs := make([]string, 0, len(preds))
+	for _, p := range preds {
+		strs = append(strs, quad.StringOf(p))
+	}
+	return Update(ctx, kv, func(tx BucketTx) error {
+		return tx.Bucket(metaBucket).Put([]byte(metaUniquePredicates), []byte(strings.Join(strs, "\n")))
+	})
+}
+
+func parseUniquePredicates(b []byte) map[quad.Value]struct{} {
+	if len(b) == 0 {
+		return nil
+	}
+	m := make(map[quad.Value]struct{})
+	for _, s := range strings.Split(string(b), "\n") {
+		m[quad.StringToValue(s)] = struct{}{}
+	}
+	return m
+}
+
+func (qs *QuadStore) isUnique(pred quad.Value) bool {
+	_, ok := qs.unique[pred]
+	return ok
+}
+
+// uniqueUpdate is a change of the unique index caused by a single delta.
+type uniqueUpdate struct {
+	link  proto.Primitive
+	delta int
+}
+
+func uniqueKey(p *proto.Primitive) []byte {
+	key := make([]byte, 16)
+	quadKeyEnc.PutUint64(key, p.Predicate)
+	quadKeyEnc.PutUint64(key[8:], p.Object)
+	return key
+}
+
+type uniqueEntry struct {
+	subject, refs uint64
+}
+
+// updateUnique applies changes to the unique index. Removed quads are processed first, thus a value
+// can be moved to another subject in a single transaction.
+func (qs *QuadStore) updateUnique(ctx context.Context, tx BucketTx, in []graph.Delta, del, add []uniqueUpdate) error {
+	if len(del) == 0 && len(add) == 0 {
+		return nil
+	}
+	b := tx.Bucket(uniqueBucket)
+	// entries are updated in memory, since not all backends can read their own writes in a transaction
+	entries := make(map[string]*uniqueEntry)
+	get := func(key []byte) (*uniqueEntry, error) {
+		if e, ok := entries[string(key)]; ok {
+			return e, nil
+		}
+		e := &uniqueEntry{}
+		v, err := GetOne(ctx, b, key)
+		if err == nil && len(v) == 16 {
+			e.subject, e.refs = quadKeyEnc.Uint64(v), quadKeyEnc.Uint64(v[8:])
+		} else if err != nil && err != ErrNotFound {
+			return nil, err
+		}
+		entries[string(key)] = e
+		return e, nil
+	}
+	for _, u := range del {
+		e, err := get(uniqueKey(&u.link))
+		if err != nil {
+			return err
+		}
+		if e.refs > 0 && e.subject == u.link.Subject {
+			e.refs--
+		}
+	}
+	for _, u := range add {
+		e, err := get(uniqueKey(&u.link))
+		if err != nil {
+			return err
+		}
+		if e.refs == 0 {
+			e.subject = u.link.Subject
+		} else if e.subject != u.link.Subject {
+			d := in[u.delta]
+			return &graph.DeltaError{Delta: d, Err: &graph.ConstraintError{
+				Kind: graph.ConstraintUnique, Subject: d.Quad.Subject,
+				Predicate: d.Quad.Predicate, Object: d.Quad.Object,
+			}}
+		}
+		e.refs++
+	}
+	for k, e := range entries {
+		var err error
+		if e.refs == 0 {
+			err = b.Del([]byte(k))
+		} else {
+			v := make([]byte, 16)
+			quadKeyEnc.PutUint64(v, e.subject)
+			quadKeyEnc.PutUint64(v[8:], e.refs)
+			err = b.Put([]byte(k), v)
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
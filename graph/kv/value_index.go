@@ -0,0 +1,464 @@
+// Copyright 2017 The Cayley Authors. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package kv
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"fmt"
+	"math"
+	"strings"
+	"time"
+
+	"github.com/cayleygraph/cayley/graph"
+	"github.com/cayleygraph/cayley/graph/iterator"
+	"github.com/cayleygraph/cayley/graph/shape"
+	"github.com/cayleygraph/cayley/quad"
+)
+
+const (
+	// OptValueIndex is an option name that enables secondary indexes over typed node values.
+	// It can only be set when the database is created.
+	OptValueIndex = "value_index"
+
+	metaValueIndex = "value_index"
+)
+
+// valueIndexBucket stores an ordered index of typed node values.
+//
+// Keys consist of a value type, an order-preserving encoding of the value and a node id.
+// Values are always empty. Only integers, floats, times, plain and language-tagged strings are indexed.
+var valueIndexBucket = []byte("values")
+
+// Value types in the secondary index.
+const (
+	valIndexInt    = 'i'
+	valIndexFloat  = 'f'
+	valIndexTime   = 't'
+	valIndexString = 's'
+	valIndexLang   = 'l'
+)
+
+// appendEscaped appends an order-preserving encoding of a byte string.
+// Zero bytes are escaped, and the string is terminated with 0x00 0x01, so shorter strings sort first.
+func appendEscaped(b []byte, s string) []byte {
+	for i := 0; i < len(s); i++ {
+		if s[i] == 0 {
+			b = append(b, 0, 0xff)
+		} else {
+			b = append(b, s[i])
+		}
+	}
+	return append(b, 0, 1)
+}
+
+// valueIndexKey returns an order-preserving key for a value, without a node id.
+// It returns nil if values of this type are not indexed.
+func valueIndexKey(v quad.Value) []byte {
+	switch v := v.(type) {
+	case quad.Int:
+		b := make([]byte, 9)
+		b[0] = valIndexInt
+		quadKeyEnc.PutUint64(b[1:], uint64(v)^(1<<63))
+		return b
+	case quad.Float:
+		f := float64(v)
+		if math.IsNaN(f) {
+			return nil
+		}
+		bits := math.Float64bits(f)
+		if bits>>63 != 0 {
+			bits = ^bits
+		} else {
+			bits |= 1 << 63
+		}
+		b := make([]byte, 9)
+		b[0] = valIndexFloat
+		quadKeyEnc.PutUint64(b[1:], bits)
+		return b
+	case quad.Time:
+		t := time.Time(v)
+		b := make([]byte, 13)
+		b[0] = valIndexTime
+		quadKeyEnc.PutUint64(b[1:], uint64(t.Unix())^(1<<63))
+		quadKeyEnc.PutUint32(b[9:], uint32(t.Nanosecond()))
+		return b
+	case quad.String:
+		return appendEscaped([]byte{valIndexString}, string(v))
+	case quad.LangString:
+		b := appendEscaped([]byte{valIndexLang}, strings.ToLower(v.Lang))
+		return appendEscaped(b, string(v.Value))
+	}
+	return nil
+}
+
+// langIndexPrefix returns a prefix of value index keys for all strings in a given language.
+func langIndexPrefix(lang string) []byte {
+	return appendEscaped([]byte{valIndexLang}, strings.ToLower(lang))
+}
+
+func (qs *QuadStore) indexValue(tx BucketTx, id uint64, v quad.Value) error {
+	if !qs.valueIndex {
+		return nil
+	}
+	key := valueIndexKey(v)
+	if key == nil {
+		return nil
+	}
+	key = append(key, uint64KeyBytes(id)...)
+	return tx.Bucket(valueIndexBucket).Put(key, []byte{})
+}
+
+func (qs *QuadStore) unindexValue(tx BucketTx, id uint64, v quad.Value) error {
+	if !qs.valueIndex {
+		return nil
+	}
+	key := valueIndexKey(v)
+	if key == nil {
+		return nil
+	}
+	key = append(key, uint64KeyBytes(id)...)
+	return tx.Bucket(valueIndexBucket).Del(key)
+}
+
+// valueRange is a range of keys in the value index. All keys must start with a given prefix.
+// Nil bounds are not checked.
+type valueRange struct {
+	Prefix         []byte
+	Lo, Hi         []byte
+	LoIncl, HiIncl bool
+}
+
+// contains checks if value part of an index key is in the range.
+func (r valueRange) contains(k []byte) bool {
+	if !bytes.HasPrefix(k, r.Prefix) {
+		return false
+	}
+	return r.aboveLo(k) && r.belowHi(k)
+}
+
+func (r valueRange) aboveLo(k []byte) bool {
+	if r.Lo == nil {
+		return true
+	}
+	c := bytes.Compare(k, r.Lo)
+	return c > 0 || (c == 0 && r.LoIncl)
+}
+
+func (r valueRange) belowHi(k []byte) bool {
+	if r.Hi == nil {
+		return true
+	}
+	c := bytes.Compare(k, r.Hi)
+	return c < 0 || (c == 0 && r.HiIncl)
+}
+
+// rangeForComparisons merges a set of comparisons into a single index range.
+// All compared values must be of the same indexed type.
+func rangeForComparisons(cmps []shape.Comparison) (valueRange, bool) {
+	var r valueRange
+	for _, c := range cmps {
+		if _, ok := c.Val.(quad.LangString); ok {
+			// comparison does not take language into account
+			return r, false
+		}
+		key := valueIndexKey(c.Val)
+		if key == nil {
+			return r, false
+		} else if r.Prefix == nil {
+			r.Prefix = key[:1]
+		} else if r.Prefix[0] != key[0] {
+			return r, false
+		}
+		switch c.Op {
+		case iterator.CompareGT, iterator.CompareGTE:
+			incl := c.Op == iterator.CompareGTE
+			if d := bytes.Compare(key, r.Lo); r.Lo == nil || d > 0 || (d == 0 && !incl) {
+				r.Lo, r.LoIncl = key, incl
+			}
+		case iterator.CompareLT, iterator.CompareLTE:
+			incl := c.Op == iterator.CompareLTE
+			if d := bytes.Compare(key, r.Hi); r.Hi == nil || d < 0 || (d == 0 && !incl) {
+				r.Hi, r.HiIncl = key, incl
+			}
+		default:
+			return r, false
+		}
+	}
+	return r, r.Prefix != nil
+}
+
+// optimizeFilter replaces value filters over all nodes with range scans over the value index.
+func (qs *QuadStore) optimizeFilter(s shape.Filter) (shape.Shape, bool) {
+	if !qs.valueIndex {
+		return s, false
+	} else if _, ok := s.From.(shape.AllNodes); !ok {
+		return s, false
+	}
+	var (
+		cmps  []shape.Comparison
+		langs []string
+		rest  []shape.ValueFilter
+	)
+	for _, f := range s.Filters {
+		switch f := f.(type) {
+		case shape.Comparison:
+			cmps = append(cmps, f)
+		case shape.Language:
+			if langs != nil {
+				// intersection of language sets; leave it as is
+				rest = append(rest, f)
+				continue
+			}
+			langs = f.Langs
+			if langs == nil {
+				langs = []string{}
+			}
+		default:
+			rest = append(rest, f)
+		}
+	}
+	var ranges []valueRange
+	switch {
+	case langs != nil:
+		// comparisons are applied as filters on top of the language scan
+		for _, c := range cmps {
+			rest = append(rest, c)
+		}
+		for _, l := range langs {
+			if l == "" {
+				// plain strings
+				ranges = append(ranges, valueRange{Prefix: []byte{valIndexString}})
+				continue
+			}
+			ranges = append(ranges, valueRange{Prefix: langIndexPrefix(l)})
+		}
+	case len(cmps) != 0:
+		r, ok := rangeForComparisons(cmps)
+		if !ok {
+			return s, false
+		}
+		ranges = append(ranges, r)
+	default:
+		return s, false
+	}
+	var out shape.Shape
+	switch len(ranges) {
+	case 0:
+		return nil, true
+	case 1:
+		out = valueIndexShape{qs: qs, r: ranges[0]}
+	default:
+		u := make(shape.Union, 0, len(ranges))
+		for _, r := range ranges {
+			u = append(u, valueIndexShape{qs: qs, r: r})
+		}
+		out = u
+	}
+	if len(rest) != 0 {
+		out = shape.Filter{From: out, Filters: rest}
+	}
+	return out, true
+}
+
+// valueIndexShape is a range scan over the value index.
+type valueIndexShape struct {
+	qs *QuadStore
+	r  valueRange
+}
+
+func (s valueIndexShape) BuildIterator(_ graph.QuadStore) graph.Iterator {
+	return NewValueIndexIterator(s.qs, s.r)
+}
+func (s valueIndexShape) Optimize(r shape.Optimizer) (shape.Shape, bool) {
+	return s, false
+}
+
+var _ graph.Iterator = &ValueIndexIterator{}
+
+// ValueIndexIterator iterates over nodes with values in a given range of the value index.
+type ValueIndexIterator struct {
+	uid  uint64
+	tags graph.Tagger
+	qs   *QuadStore
+	r    valueRange
+
+	tx   BucketTx
+	it   KVIterator
+	done bool
+
+	result graph.Value
+	err    error
+}
+
+func NewValueIndexIterator(qs *QuadStore, r valueRange) *ValueIndexIterator {
+	return &ValueIndexIterator{
+		uid: iterator.NextUID(),
+		qs:  qs,
+		r:   r,
+	}
+}
+
+func (it *ValueIndexIterator) UID() uint64 {
+	return it.uid
+}
+
+func (it *ValueIndexIterator) Reset() {
+	it.close()
+	it.done = false
+	it.result = nil
+}
+
+func (it *ValueIndexIterator) Tagger() *graph.Tagger {
+	return &it.tags
+}
+
+func (it *ValueIndexIterator) TagResults(dst map[string]graph.Value) {
+	it.tags.TagResult(dst, it.Result())
+}
+
+func (it *ValueIndexIterator) Clone() graph.Iterator {
+	out := NewValueIndexIterator(it.qs, it.r)
+	out.tags.CopyFrom(it)
+	return out
+}
+
+func (it *ValueIndexIterator) close() {
+	if it.it != nil {
+		if err := it.it.Close(); err != nil && it.err == nil {
+			it.err = err
+		}
+		it.it = nil
+	}
+	if it.tx != nil {
+		if err := it.tx.Rollback(); err != nil && it.err == nil {
+			it.err = err
+		}
+		it.tx = nil
+	}
+}
+
+func (it *ValueIndexIterator) Close() error {
+	it.close()
+	return it.err
+}
+
+func (it *ValueIndexIterator) Err() error {
+	return it.err
+}
+
+func (it *ValueIndexIterator) Result() graph.Value {
+	return it.result
+}
+
+func (it *ValueIndexIterator) Next(ctx context.Context) bool {
+	it.result = nil
+	if it.err != nil || it.done {
+		return false
+	}
+	if !graph.ScanPrimitive(ctx) {
+		return false
+	}
+	if it.it == nil {
+		it.tx, it.err = it.qs.db.Tx(false)
+		if it.err != nil {
+			return false
+		}
+		from := it.r.Prefix
+		if it.r.Lo != nil {
+			from = it.r.Lo
+		}
+		it.it = ScanFrom(it.tx.Bucket(valueIndexBucket), it.r.Prefix, from)
+	}
+	for it.it.Next(ctx) {
+		k := it.it.Key()
+		if len(k) < 8 {
+			it.err = fmt.Errorf("kv: invalid value index key: %x", k)
+			return false
+		}
+		v, id := k[:len(k)-8], quadKeyEnc.Uint64(k[len(k)-8:])
+		if !it.r.belowHi(v) {
+			break
+		} else if !it.r.aboveLo(v) {
+			continue
+		}
+		it.result = Int64Value(id)
+		return true
+	}
+	if err := it.it.Err(); err != nil {
+		it.err = err
+	}
+	it.close()
+	it.done = true
+	return false
+}
+
+func (it *ValueIndexIterator) NextPath(ctx context.Context) bool {
+	return false
+}
+
+func (it *ValueIndexIterator) Contains(ctx context.Context, v graph.Value) bool {
+	it.result = nil
+	if !graph.ScanPrimitive(ctx) {
+		return false
+	}
+	if _, ok := v.(Int64Value); !ok {
+		return false
+	}
+	key := valueIndexKey(it.qs.NameOf(v))
+	if key == nil || !it.r.contains(key) {
+		return false
+	}
+	it.result = v
+	return true
+}
+
+func (it *ValueIndexIterator) SubIterators() []graph.Iterator {
+	return nil
+}
+
+func (it *ValueIndexIterator) Size() (int64, bool) {
+	// TODO: keep counters for value types
+	return 1 + it.qs.Size()/2, false
+}
+
+func (it *ValueIndexIterator) String() string {
+	return fmt.Sprintf("KVValueIndex(%q)", it.r.Prefix[:1])
+}
+
+func (it *ValueIndexIterator) Type() graph.Type { return "kv_value_index" }
+
+func (it *ValueIndexIterator) Optimize() (graph.Iterator, bool) {
+	return it, false
+}
+
+func (it *ValueIndexIterator) Stats() graph.IteratorStats {
+	s, exact := it.Size()
+	return graph.IteratorStats{
+		ContainsCost: 2,
+		NextCost:     1,
+		Size:         s,
+		ExactSize:    exact,
+	}
+}
+
+func setValueIndexFlag(ctx context.Context, kv BucketKV) error {
+	return Update(ctx, kv, func(tx BucketTx) error {
+		var buf [8]byte
+		binary.LittleEndian.PutUint64(buf[:], 1)
+		return tx.Bucket(metaBucket).Put([]byte(metaValueIndex), buf[:])
+	})
+}
@@ -0,0 +1,115 @@
+// Copyright 2017 The Cayley Authors. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package graph
+
+import (
+	"context"
+	"sync/atomic"
+)
+
+// Limits is a set of resource limits for a single query.
+// Zero value for any field means no limit.
+type Limits struct {
+	// MaxResults is the maximal number of results a query can return to the client.
+	// It is applied by the code that returns results, not by IterateChain, thus internal
+	// iterations (for example, counting) are not affected by it.
+	MaxResults int
+	// MaxScanned is the maximal number of primitives leaf iterators
+	// are allowed to read from the backend.
+	MaxScanned int64
+}
+
+// Min returns limits that satisfy both l and l2.
+func (l Limits) Min(l2 Limits) Limits {
+	if l.MaxResults <= 0 || (l2.MaxResults > 0 && l2.MaxResults < l.MaxResults) {
+		l.MaxResults = l2.MaxResults
+	}
+	if l.MaxScanned <= 0 || (l2.MaxScanned > 0 && l2.MaxScanned < l.MaxScanned) {
+		l.MaxScanned = l2.MaxScanned
+	}
+	return l
+}
+
+type budgetKey struct{}
+
+// budget tracks resources consumed by a single query.
+type budget struct {
+	limits    Limits
+	scanned   int64
+	truncated int32
+}
+
+func (b *budget) truncate() {
+	atomic.StoreInt32(&b.truncated, 1)
+}
+
+// WithLimits attaches query limits to the context.
+//
+// MaxScanned is enforced by leaf iterators of the backends, while MaxResults is enforced by the code that
+// returns results to the client.
+// When a limit is reached, iteration stops and partial results are returned;
+// Truncated can then be used to check if results are complete.
+func WithLimits(ctx context.Context, l Limits) context.Context {
+	if l.MaxResults <= 0 && l.MaxScanned <= 0 {
+		return ctx
+	}
+	return context.WithValue(ctx, budgetKey{}, &budget{limits: l})
+}
+
+// LimitsFrom returns query limits attached to the context.
+func LimitsFrom(ctx context.Context) Limits {
+	if b, ok := ctx.Value(budgetKey{}).(*budget); ok {
+		return b.limits
+	}
+	return Limits{}
+}
+
+// ScanPrimitive should be called by leaf iterators each time a primitive is read from the backend.
+// It returns false if the query has exhausted its scan budget and iteration must stop.
+func ScanPrimitive(ctx context.Context) bool {
+	if ctx == nil {
+		return true
+	}
+	b, ok := ctx.Value(budgetKey{}).(*budget)
+	if !ok || b.limits.MaxScanned <= 0 {
+		return true
+	}
+	if atomic.AddInt64(&b.scanned, 1) <= b.limits.MaxScanned {
+		return true
+	}
+	b.truncate()
+	return false
+}
+
+// Truncated reports whether a query executed with this context returned partial
+// results because one of the limits was reached.
+func Truncated(ctx context.Context) bool {
+	if b, ok := ctx.Value(budgetKey{}).(*budget); ok {
+		return atomic.LoadInt32(&b.truncated) != 0
+	}
+	return false
+}
+
+// SetTruncated marks a query executed with this context as truncated.
+// Query languages should call it when they stop producing results due
+// to limits set in the context.
+func SetTruncated(ctx context.Context) {
+	if ctx == nil {
+		return
+	}
+	if b, ok := ctx.Value(budgetKey{}).(*budget); ok {
+		b.truncate()
+	}
+}
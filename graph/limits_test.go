@@ -0,0 +1,51 @@
+package graph_test
+
+import (
+	"context"
+	"testing"
+
+	"github.com/cayleygraph/cayley/graph"
+	"github.com/cayleygraph/cayley/graph/iterator"
+)
+
+func TestLimitsMaxResults(t *testing.T) {
+	ctx := graph.WithLimits(context.Background(), graph.Limits{MaxResults: 5})
+	// result limit is applied to results sent to the client, not to internal iteration
+	out, err := graph.Iterate(ctx, iterator.NewInt64(1, 10, true)).All()
+	if err != nil {
+		t.Fatal(err)
+	} else if len(out) != 10 {
+		t.Fatalf("unexpected number of results: %d", len(out))
+	}
+	n, err := graph.Iterate(ctx, iterator.NewInt64(1, 10, true)).Count()
+	if err != nil {
+		t.Fatal(err)
+	} else if n != 10 {
+		t.Fatalf("unexpected count: %d", n)
+	} else if graph.Truncated(ctx) {
+		t.Fatal("results should not be truncated")
+	}
+}
+
+func TestLimitsMaxScanned(t *testing.T) {
+	ctx := graph.WithLimits(context.Background(), graph.Limits{MaxScanned: 3})
+	out, err := graph.Iterate(ctx, iterator.NewInt64(1, 10, true)).All()
+	if err != nil {
+		t.Fatal(err)
+	} else if len(out) != 3 {
+		t.Fatalf("unexpected number of results: %d", len(out))
+	} else if !graph.Truncated(ctx) {
+		t.Fatal("expected results to be truncated")
+	}
+}
+
+func TestLimitsMin(t *testing.T) {
+	l := graph.Limits{MaxResults: 100}.Min(graph.Limits{MaxResults: 10, MaxScanned: 5})
+	if l != (graph.Limits{MaxResults: 10, MaxScanned: 5}) {
+		t.Fatalf("unexpected limits: %+v", l)
+	}
+	l = graph.Limits{MaxResults: 10}.Min(graph.Limits{MaxResults: 0})
+	if l.MaxResults != 10 {
+		t.Fatalf("unexpected limits: %+v", l)
+	}
+}
@@ -29,7 +29,7 @@ type AllIterator struct {
 
 	qs    *QuadStore
 	all   []*primitive
-	maxid int64 // id of last observed insert (prim id)
+	ver   int64 // version of the store
 	nodes bool
 
 	i    int // index into qs.all
@@ -37,16 +37,16 @@ type AllIterator struct {
 	done bool
 }
 
-func newAllIterator(qs *QuadStore, nodes bool, maxid int64) *AllIterator {
+func newAllIterator(qs *QuadStore, nodes bool, ver int64) *AllIterator {
 	return &AllIterator{
 		uid: iterator.NextUID(),
 		qs:  qs, all: qs.cloneAll(), nodes: nodes,
-		i: -1, maxid: maxid,
+		i: -1, ver: ver,
 	}
 }
 
 func (it *AllIterator) Clone() graph.Iterator {
-	it2 := newAllIterator(it.qs, it.nodes, it.maxid)
+	it2 := newAllIterator(it.qs, it.nodes, it.ver)
 	it2.tags.CopyFrom(it)
 	return it2
 }
@@ -58,7 +58,7 @@ func (it *AllIterator) Reset() {
 }
 
 func (it *AllIterator) ok(p *primitive) bool {
-	if p.ID > it.maxid {
+	if !p.visible(it.ver) {
 		return false
 	} else if it.nodes && p.Value != nil {
 		return true
@@ -73,17 +73,19 @@ func (it *AllIterator) Next(ctx context.Context) bool {
 	if it.done {
 		return false
 	}
+	if !graph.ScanPrimitive(ctx) {
+		return false
+	}
 	all := it.all
 	if it.i >= len(all) {
 		it.done = true
 		return false
 	}
 	it.i++
+	it.qs.mu.RLock()
+	defer it.qs.mu.RUnlock()
 	for ; it.i < len(all); it.i++ {
 		p := all[it.i]
-		if p.ID > it.maxid {
-			break
-		}
 		if it.ok(p) {
 			it.cur = p
 			return true
@@ -98,15 +100,17 @@ func (it *AllIterator) Contains(ctx context.Context, v graph.Value) bool {
 	if it.done {
 		return false
 	}
+	if !graph.ScanPrimitive(ctx) {
+		return false
+	}
 	id, ok := asID(v)
 	if !ok {
 		return false
 	}
+	it.qs.mu.RLock()
+	defer it.qs.mu.RUnlock()
 	p := it.qs.prim[id]
-	if p.ID > it.maxid {
-		return false
-	}
-	if !it.ok(p) {
+	if p == nil || !it.ok(p) {
 		return false
 	}
 	it.cur = p
@@ -149,7 +153,7 @@ func (it *AllIterator) String() string {
 func (it *AllIterator) NextPath(ctx context.Context) bool { return false }
 
 func (it *AllIterator) Size() (int64, bool) {
-	// TODO: use maxid?
+	// TODO: count only visible primitives?
 	return int64(len(it.all)), true
 }
 func (it *AllIterator) Stats() graph.IteratorStats {
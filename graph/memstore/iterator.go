@@ -25,7 +25,7 @@ import (
 	"github.com/cayleygraph/cayley/quad"
 )
 
-var _ graph.Iterator = &Iterator{}
+var _ graph.BatchIterator = &Iterator{}
 
 type Iterator struct {
 	nodes bool
@@ -40,9 +40,15 @@ type Iterator struct {
 
 	d     quad.Direction
 	value int64
+	ver   int64 // version of the store
 }
 
+// NewIterator creates an iterator over the index tree for the latest version of the store.
 func NewIterator(tree *Tree, qs *QuadStore, d quad.Direction, value int64) *Iterator {
+	return newIterator(tree, qs, d, value, qs.head().ver)
+}
+
+func newIterator(tree *Tree, qs *QuadStore, d quad.Direction, value int64, ver int64) *Iterator {
 	return &Iterator{
 		nodes: d == 0,
 		uid:   iterator.NextUID(),
@@ -50,6 +56,7 @@ func NewIterator(tree *Tree, qs *QuadStore, d quad.Direction, value int64) *Iter
 		tree:  tree,
 		d:     d,
 		value: value,
+		ver:   ver,
 	}
 }
 
@@ -72,7 +79,7 @@ func (it *Iterator) TagResults(dst map[string]graph.Value) {
 }
 
 func (it *Iterator) Clone() graph.Iterator {
-	m := NewIterator(it.tree, it.qs, it.d, it.value)
+	m := newIterator(it.tree, it.qs, it.d, it.value, it.ver)
 	m.tags.CopyFrom(it)
 	return m
 }
@@ -83,6 +90,11 @@ func (it *Iterator) Close() error {
 
 func (it *Iterator) Next(ctx context.Context) bool {
 	graph.NextLogIn(it)
+	if !graph.ScanPrimitive(ctx) {
+		return graph.NextLogOut(it, false)
+	}
+	it.qs.mu.RLock()
+	defer it.qs.mu.RUnlock()
 	if it.iter == nil {
 		it.iter, it.err = it.tree.SeekFirst()
 		if it.err == io.EOF || it.iter == nil {
@@ -100,11 +112,43 @@ func (it *Iterator) Next(ctx context.Context) bool {
 			}
 			return graph.NextLogOut(it, false)
 		}
+		if !p.visible(it.ver) {
+			continue
+		}
 		it.cur = p
 		return graph.NextLogOut(it, true)
 	}
 }
 
+func (it *Iterator) NextBatch(ctx context.Context, dst []graph.Value) int {
+	n := 0
+	if it.iter == nil && len(dst) != 0 {
+		// seek to the first element
+		if !it.Next(ctx) {
+			return 0
+		}
+		dst[0] = it.Result()
+		n++
+	}
+	it.qs.mu.RLock()
+	defer it.qs.mu.RUnlock()
+	for n < len(dst) && graph.ScanPrimitive(ctx) {
+		_, p, err := it.iter.Next()
+		if err != nil {
+			if err != io.EOF {
+				it.err = err
+			}
+			break
+		} else if !p.visible(it.ver) {
+			continue
+		}
+		it.cur = p
+		dst[n] = qprim{p: p}
+		n++
+	}
+	return n
+}
+
 func (it *Iterator) Err() error {
 	return it.err
 }
@@ -126,22 +170,26 @@ func (it *Iterator) SubIterators() []graph.Iterator {
 }
 
 func (it *Iterator) Size() (int64, bool) {
-	return int64(it.tree.Len()), true
+	it.qs.mu.RLock()
+	defer it.qs.mu.RUnlock()
+	return int64(it.tree.Len()), it.qs.exactAt(it.ver)
 }
 
 func (it *Iterator) Contains(ctx context.Context, v graph.Value) bool {
 	graph.ContainsLogIn(it, v)
-	if v == nil {
+	if v == nil || !graph.ScanPrimitive(ctx) {
 		return graph.ContainsLogOut(it, v, false)
 	}
+	it.qs.mu.RLock()
+	defer it.qs.mu.RUnlock()
 	switch v := v.(type) {
 	case bnode:
-		if p, ok := it.tree.Get(int64(v)); ok {
+		if p, ok := it.tree.Get(int64(v)); ok && p.visible(it.ver) {
 			it.cur = p
 			return graph.ContainsLogOut(it, v, true)
 		}
 	case qprim:
-		if v.p.Quad.Dir(it.d) == it.value {
+		if v.p.Quad.Dir(it.d) == it.value && v.p.visible(it.ver) {
 			it.cur = v.p
 			return graph.ContainsLogOut(it, v, true)
 		}
@@ -162,10 +210,11 @@ func (it *Iterator) Optimize() (graph.Iterator, bool) {
 }
 
 func (it *Iterator) Stats() graph.IteratorStats {
+	size, exact := it.Size()
 	return graph.IteratorStats{
-		ContainsCost: int64(math.Log(float64(it.tree.Len()))) + 1,
+		ContainsCost: int64(math.Log(float64(size))) + 1,
 		NextCost:     1,
-		Size:         int64(it.tree.Len()),
-		ExactSize:    true,
+		Size:         size,
+		ExactSize:    exact,
 	}
 }
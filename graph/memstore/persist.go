@@ -0,0 +1,442 @@
+// Copyright 2017 The Cayley Authors. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package memstore
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/cayleygraph/cayley/clog"
+	"github.com/cayleygraph/cayley/graph"
+	"github.com/cayleygraph/cayley/quad"
+	"github.com/cayleygraph/cayley/quad/nquads"
+)
+
+// DefaultSnapshotInterval is the default interval between snapshots of a persistent store.
+const DefaultSnapshotInterval = 10 * time.Minute
+
+const (
+	snapshotPrefix = "snapshot-"
+	snapshotExt    = ".nq"
+	logPrefix      = "wal-"
+	logExt         = ".log"
+	tmpExt         = ".tmp"
+
+	logAdd    = "+ "
+	logDelete = "- "
+	logCommit = "commit"
+)
+
+// Open opens a persistent in-memory quad store in a given directory, creating it if necessary.
+//
+// The whole graph is still kept in memory, but all changes are appended to
+// a write-ahead log before being applied. The log is periodically replaced with
+// a snapshot of the store in N-Quads format. Both are used to restore the
+// store when it is opened again.
+//
+// Only quads are persisted; values and blank nodes not used in any quad are lost on restart.
+func Open(dir string, opts graph.Options) (*QuadStore, error) {
+	nosync, err := opts.BoolKey("nosync", false)
+	if err != nil {
+		return nil, err
+	}
+	interval := DefaultSnapshotInterval
+	if s, err := opts.StringKey("snapshot_interval", ""); err != nil {
+		return nil, err
+	} else if s != "" {
+		if interval, err = time.ParseDuration(s); err != nil {
+			return nil, err
+		}
+	}
+	if err = os.MkdirAll(dir, 0700); err != nil {
+		return nil, err
+	}
+	snaps, err := listFiles(dir, snapshotPrefix, snapshotExt)
+	if err != nil {
+		return nil, err
+	}
+	logs, err := listFiles(dir, logPrefix, logExt)
+	if err != nil {
+		return nil, err
+	}
+	qs := newQuadStore()
+	var gen int64
+	if n := len(snaps); n != 0 {
+		gen = snaps[n-1]
+		if err = loadSnapshot(qs, snapshotPath(dir, gen)); err != nil {
+			return nil, err
+		}
+	}
+	last := gen
+	for _, g := range logs {
+		if g < gen {
+			continue
+		}
+		if err = replayLog(qs, logPath(dir, g)); err != nil {
+			return nil, err
+		}
+		last = g
+	}
+	d := &persister{dir: dir, nosync: nosync}
+	if err = d.openLog(last); err != nil {
+		return nil, err
+	}
+	if err = d.removeBefore(gen); err != nil {
+		clog.Warningf("memstore: failed to remove old files: %v", err)
+	}
+	qs.disk = d
+	if interval > 0 {
+		d.stop, d.done = make(chan struct{}), make(chan struct{})
+		go d.run(qs, interval)
+	}
+	return qs, nil
+}
+
+// Checkpoint writes a snapshot of the store to disk and starts a new log.
+// It does nothing for in-memory stores.
+//
+// Persistent stores are checkpointed periodically and on Close,
+// thus this method is only useful to force a snapshot.
+func (qs *QuadStore) Checkpoint() error {
+	qs.wmu.Lock()
+	d := qs.disk
+	qs.wmu.Unlock()
+	if d == nil {
+		return nil
+	}
+	return d.checkpoint(qs)
+}
+
+func snapshotPath(dir string, gen int64) string {
+	return filepath.Join(dir, snapshotPrefix+strconv.FormatInt(gen, 10)+snapshotExt)
+}
+
+func logPath(dir string, gen int64) string {
+	return filepath.Join(dir, logPrefix+strconv.FormatInt(gen, 10)+logExt)
+}
+
+// listFiles returns sorted generations of files with a given prefix and extension.
+func listFiles(dir, prefix, ext string) ([]int64, error) {
+	names, err := filepath.Glob(filepath.Join(dir, prefix+"*"+ext))
+	if err != nil {
+		return nil, err
+	}
+	var gens []int64
+	for _, name := range names {
+		name = filepath.Base(name)
+		gen, err := strconv.ParseInt(name[len(prefix):len(name)-len(ext)], 10, 64)
+		if err != nil {
+			continue
+		}
+		gens = append(gens, gen)
+	}
+	sort.Slice(gens, func(i, j int) bool { return gens[i] < gens[j] })
+	return gens, nil
+}
+
+// loadSnapshot loads all quads from the snapshot file into the store.
+func loadSnapshot(qs *QuadStore, path string) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	r := nquads.NewReader(f, false)
+	deltas := make([]graph.Delta, 0, quad.DefaultBatch)
+	flush := func() error {
+		err := qs.ApplyDeltas(deltas, graph.IgnoreOpts{IgnoreDup: true, IgnoreMissing: true})
+		deltas = deltas[:0]
+		return err
+	}
+	for {
+		q, err := r.ReadQuad()
+		if err == io.EOF {
+			break
+		} else if err != nil {
+			return fmt.Errorf("memstore: cannot read snapshot %q: %v", path, err)
+		}
+		deltas = append(deltas, graph.Delta{Action: graph.Add, Quad: q})
+		if len(deltas) == cap(deltas) {
+			if err = flush(); err != nil {
+				return err
+			}
+		}
+	}
+	return flush()
+}
+
+// replayLog applies all committed transactions from the log file to the store.
+// An incomplete transaction at the end of the log is discarded.
+func replayLog(qs *QuadStore, path string) error {
+	f, err := os.OpenFile(path, os.O_RDWR, 0)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	var (
+		r      = bufio.NewReader(f)
+		deltas []graph.Delta
+		off    int64 // offset of the last committed transaction
+		cur    int64
+	)
+	for {
+		line, err := r.ReadString('\n')
+		if err == io.EOF {
+			break // incomplete line is discarded as well
+		} else if err != nil {
+			return err
+		}
+		cur += int64(len(line))
+		line = line[:len(line)-1]
+		var d graph.Delta
+		switch {
+		case line == logCommit:
+			err = qs.ApplyDeltas(deltas, graph.IgnoreOpts{IgnoreDup: true, IgnoreMissing: true})
+			if err != nil {
+				return err
+			}
+			deltas, off = deltas[:0], cur
+			continue
+		case strings.HasPrefix(line, logAdd):
+			d.Action = graph.Add
+		case strings.HasPrefix(line, logDelete):
+			d.Action = graph.Delete
+		default:
+			return fmt.Errorf("memstore: corrupted log %q at offset %d", path, cur-int64(len(line))-1)
+		}
+		if d.Quad, err = nquads.Parse(line[len(logAdd):]); err != nil {
+			return fmt.Errorf("memstore: corrupted log %q: %v", path, err)
+		}
+		deltas = append(deltas, d)
+	}
+	if st, err := f.Stat(); err != nil {
+		return err
+	} else if st.Size() > off {
+		clog.Warningf("memstore: discarding incomplete transaction at the end of %q", path)
+		return f.Truncate(off)
+	}
+	return nil
+}
+
+// persister maintains snapshot and log files of a persistent store.
+type persister struct {
+	dir    string
+	nosync bool
+
+	cmu sync.Mutex // serializes checkpoints
+
+	// fields below are protected by QuadStore.wmu
+	gen  int64    // generation of the current log
+	f    *os.File // current log
+	size int64    // size of the current log
+
+	once sync.Once
+	stop chan struct{}
+	done chan struct{}
+}
+
+func (d *persister) openLog(gen int64) error {
+	f, err := os.OpenFile(logPath(d.dir, gen), os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0600)
+	if err != nil {
+		return err
+	}
+	st, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return err
+	}
+	d.gen, d.f, d.size = gen, f, st.Size()
+	return nil
+}
+
+// append writes deltas to the log as a single transaction.
+// Must be called with writer lock held.
+func (d *persister) append(deltas []graph.Delta) error {
+	if d.f == nil || len(deltas) == 0 {
+		return nil
+	}
+	var buf bytes.Buffer
+	enc := nquads.NewWriter(&buf)
+	for _, delta := range deltas {
+		if delta.Action == graph.Delete {
+			buf.WriteString(logDelete)
+		} else {
+			buf.WriteString(logAdd)
+		}
+		enc.WriteQuad(delta.Quad)
+	}
+	buf.WriteString(logCommit + "\n")
+	n, err := d.f.Write(buf.Bytes())
+	if err == nil && !d.nosync {
+		err = d.f.Sync()
+	}
+	if err != nil {
+		if n != 0 {
+			// do not leave a partial transaction in the log
+			d.f.Truncate(d.size)
+		}
+		return err
+	}
+	d.size += int64(n)
+	return nil
+}
+
+// checkpoint starts a new log and writes a snapshot of the store that
+// corresponds to the beginning of the new log. Old files are removed after it.
+func (d *persister) checkpoint(qs *QuadStore) error {
+	d.cmu.Lock()
+	defer d.cmu.Unlock()
+
+	qs.wmu.Lock()
+	if d.f == nil || d.size == 0 {
+		// closed or no changes since the last snapshot
+		qs.wmu.Unlock()
+		return nil
+	}
+	s := qs.Snapshot()
+	old := d.f
+	err := d.openLog(d.gen + 1)
+	gen := d.gen
+	qs.wmu.Unlock()
+	defer s.Close()
+	if err != nil {
+		return err
+	}
+	if err = old.Close(); err != nil {
+		return err
+	}
+	if err = writeSnapshot(s, snapshotPath(d.dir, gen)); err != nil {
+		return err
+	}
+	return d.removeBefore(gen)
+}
+
+func writeSnapshot(s *Snapshot, path string) error {
+	f, err := os.Create(path + tmpExt)
+	if err != nil {
+		return err
+	}
+	w := bufio.NewWriter(f)
+	enc := nquads.NewWriter(w)
+	it := s.QuadsAllIterator()
+	ctx := context.TODO()
+	for err == nil && it.Next(ctx) {
+		err = enc.WriteQuad(s.Quad(it.Result()))
+	}
+	if err == nil {
+		err = it.Err()
+	}
+	it.Close()
+	if err == nil {
+		err = w.Flush()
+	}
+	if err == nil {
+		err = f.Sync()
+	}
+	if err2 := f.Close(); err == nil {
+		err = err2
+	}
+	if err != nil {
+		os.Remove(f.Name())
+		return err
+	}
+	return os.Rename(f.Name(), path)
+}
+
+// removeBefore removes snapshots and logs of generations prior to a given one,
+// as well as incomplete snapshots.
+func (d *persister) removeBefore(gen int64) error {
+	var last error
+	remove := func(path string) {
+		if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+			last = err
+		}
+	}
+	snaps, err := listFiles(d.dir, snapshotPrefix, snapshotExt)
+	if err != nil {
+		return err
+	}
+	for _, g := range snaps {
+		if g < gen {
+			remove(snapshotPath(d.dir, g))
+		}
+	}
+	logs, err := listFiles(d.dir, logPrefix, logExt)
+	if err != nil {
+		return err
+	}
+	for _, g := range logs {
+		if g < gen {
+			remove(logPath(d.dir, g))
+		}
+	}
+	tmps, err := listFiles(d.dir, snapshotPrefix, snapshotExt+tmpExt)
+	if err != nil {
+		return err
+	}
+	for _, g := range tmps {
+		remove(snapshotPath(d.dir, g) + tmpExt)
+	}
+	return last
+}
+
+// run makes periodic snapshots until the store is closed.
+func (d *persister) run(qs *QuadStore, interval time.Duration) {
+	defer close(d.done)
+	t := time.NewTicker(interval)
+	defer t.Stop()
+	for {
+		select {
+		case <-d.stop:
+			return
+		case <-t.C:
+			if err := d.checkpoint(qs); err != nil {
+				clog.Errorf("memstore: failed to write a snapshot: %v", err)
+			}
+		}
+	}
+}
+
+// close writes a final snapshot and closes the log. Store stays usable,
+// but changes are no longer persisted.
+func (d *persister) close(qs *QuadStore) error {
+	d.once.Do(func() {
+		if d.stop != nil {
+			close(d.stop)
+			<-d.done
+		}
+	})
+	err := d.checkpoint(qs)
+	qs.wmu.Lock()
+	defer qs.wmu.Unlock()
+	if d.f != nil {
+		if err2 := d.f.Close(); err == nil {
+			err = err2
+		}
+		d.f = nil
+	}
+	qs.disk = nil
+	return err
+}
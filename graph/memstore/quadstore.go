@@ -18,9 +18,12 @@ import (
 	"fmt"
 	"strconv"
 	"strings"
+	"sync"
+	"sync/atomic"
 
+	"github.com/cayleygraph/cayley/clog"
 	"github.com/cayleygraph/cayley/graph"
-	"github.com/cayleygraph/cayley/graph/iterator"
+	"github.com/cayleygraph/cayley/graph/stats"
 	"github.com/cayleygraph/cayley/quad"
 )
 
@@ -28,8 +31,11 @@ const QuadStoreType = "memstore"
 
 func init() {
 	graph.RegisterQuadStore(QuadStoreType, graph.QuadStoreRegistration{
-		NewFunc: func(string, graph.Options) (graph.QuadStore, error) {
-			return newQuadStore(), nil
+		NewFunc: func(path string, opts graph.Options) (graph.QuadStore, error) {
+			if path == "" {
+				return newQuadStore(), nil
+			}
+			return Open(path, opts)
 		},
 		UpgradeFunc:  nil,
 		InitFunc:     nil,
@@ -48,6 +54,9 @@ type qprim struct {
 func (n qprim) Key() interface{} { return n.p.ID }
 
 var _ quad.Writer = (*QuadStore)(nil)
+var _ stats.Estimator = (*QuadStore)(nil)
+var _ graph.Versioned = (*QuadStore)(nil)
+var _ graph.FeatureReporter = (*QuadStore)(nil)
 
 func cmp(a, b int64) int {
 	return int(a - b)
@@ -91,6 +100,18 @@ type primitive struct {
 	Quad  internalQuad
 	Value quad.Value
 	refs  int
+
+	// added and removed are versions of the store in which primitive was added
+	// and removed. Removed is zero for primitives that are still in the store.
+	added, removed int64
+	// prev is a removed primitive with the same value or quad.
+	// It is kept for snapshots that still can see it.
+	prev *primitive
+}
+
+// visible checks if primitive is a part of a specified version of the store.
+func (p *primitive) visible(ver int64) bool {
+	return p.added <= ver && (p.removed == 0 || p.removed > ver)
 }
 
 type internalQuad struct {
@@ -130,16 +151,37 @@ func (q internalQuad) Dir(d quad.Direction) int64 {
 	return n
 }
 
+// QuadStore is an in-memory quad store.
+//
+// It is safe for concurrent use. Writes are serialized, and each write
+// creates a new version of the store. Readers never observe partially
+// applied writes; use Snapshot to read a single version across many calls.
 type QuadStore struct {
+	wmu sync.Mutex   // serializes writers
+	mu  sync.RWMutex // protects fields below
+
 	last int64
 	// TODO: string -> quad.Value once Raw -> typed resolution is unnecessary
 	vals    map[string]int64
 	quads   map[internalQuad]int64
 	prim    map[int64]*primitive
 	all     []*primitive // might not be sorted by id
-	reading bool         // someone else might be reading "all" slice - next insert/delete should clone it
+	reading int32        // someone else might be reading "all" slice - next insert/delete should clone it; atomic
 	index   QuadDirectionIndex
 	horizon int64 // used only to assign ids to tx
+
+	// modified stores the last version in which quads with a given subject, predicate and label were changed
+	modified map[string]int64
+	pruned   int64 // entries of modified older than this horizon were removed
+
+	version int64         // last committed version
+	writing bool          // a write of the next version is in progress
+	count   int64         // number of primitives in the store, including a write in progress
+	size    int64         // number of primitives in the last committed version
+	pinned  map[int64]int // versions that are used by open snapshots
+	garbage []*primitive  // removed primitives that might be visible to snapshots; ordered by version
+
+	disk *persister // snapshot and write-ahead log; nil for in-memory store
 	// vip_index map[string]map[int64]map[string]map[int64]*b.Tree
 }
 
@@ -154,15 +196,18 @@ func New(quads ...quad.Quad) *QuadStore {
 
 func newQuadStore() *QuadStore {
 	return &QuadStore{
-		vals:  make(map[string]int64),
-		quads: make(map[internalQuad]int64),
-		prim:  make(map[int64]*primitive),
-		index: NewQuadDirectionIndex(),
+		vals:   make(map[string]int64),
+		quads:  make(map[internalQuad]int64),
+		prim:   make(map[int64]*primitive),
+		index:  NewQuadDirectionIndex(),
+		pinned: make(map[int64]int),
+
+		modified: make(map[string]int64),
 	}
 }
 
 func (qs *QuadStore) cloneAll() []*primitive {
-	qs.reading = true
+	atomic.StoreInt32(&qs.reading, 1)
 	return qs.all
 }
 
@@ -176,19 +221,44 @@ func (qs *QuadStore) addPrimitive(p *primitive) int64 {
 }
 
 func (qs *QuadStore) appendPrimitive(p *primitive) {
+	qs.count++
 	qs.prim[p.ID] = p
-	if !qs.reading {
+	if atomic.LoadInt32(&qs.reading) == 0 {
 		qs.all = append(qs.all, p)
 	} else {
 		n := len(qs.all)
-		qs.all = append(qs.all[:n:n], p) // reallocate slice
-		qs.reading = false               // this is a new slice
+		qs.all = append(qs.all[:n:n], p)  // reallocate slice
+		atomic.StoreInt32(&qs.reading, 0) // this is a new slice
 	}
 }
 
 const internalBNodePrefix = "memnode"
 
-func (qs *QuadStore) resolveVal(v quad.Value, add bool) (int64, bool) {
+// lookupPrim finds a primitive with a given id that is visible in the specified version.
+// Blank nodes that were removed and added again have a chain of primitives with the same id.
+func (qs *QuadStore) lookupPrim(id int64, ver int64) *primitive {
+	for p := qs.prim[id]; p != nil && p.ID == id; p = p.prev {
+		if p.visible(ver) {
+			return p
+		}
+	}
+	return nil
+}
+
+// lookupChain finds a primitive in a chain of removed values or quads that is visible in the specified version.
+func (qs *QuadStore) lookupChain(id int64, ver int64) *primitive {
+	if id == 0 {
+		return nil
+	}
+	for p := qs.prim[id]; p != nil; p = p.prev {
+		if p.visible(ver) {
+			return p
+		}
+	}
+	return nil
+}
+
+func (qs *QuadStore) resolveVal(v quad.Value, add bool, ver int64) (int64, bool) {
 	if v == nil {
 		return 0, false
 	}
@@ -196,36 +266,50 @@ func (qs *QuadStore) resolveVal(v quad.Value, add bool) (int64, bool) {
 		n = n[len(internalBNodePrefix):]
 		id, err := strconv.ParseInt(string(n), 10, 64)
 		if err == nil && id != 0 {
-			if p, ok := qs.prim[id]; ok || !add {
+			p, ok := qs.prim[id]
+			if ok && !p.visible(ver) {
+				if !add {
+					return id, false
+				}
+				// add the node again; it can only be reached by id
+				// removed primitive is kept for snapshots that still can see it
+				qs.appendPrimitive(&primitive{ID: id, refs: 1, added: ver, prev: p})
+				return id, true
+			}
+			if ok || !add {
 				if add {
 					p.refs++
 				}
 				return id, ok
 			}
-			qs.appendPrimitive(&primitive{ID: id, refs: 1})
+			qs.appendPrimitive(&primitive{ID: id, refs: 1, added: ver})
 			return id, true
 		}
 	}
 	vs := v.String()
-	if id, exists := qs.vals[vs]; exists || !add {
-		if exists && add {
-			qs.prim[id].refs++
+	if p := qs.lookupChain(qs.vals[vs], ver); p != nil || !add {
+		if p == nil {
+			return 0, false
 		}
-		return id, exists
+		if add {
+			p.refs++
+		}
+		return p.ID, true
 	}
-	id := qs.addPrimitive(&primitive{Value: v})
+	p := &primitive{Value: v, added: ver, prev: qs.prim[qs.vals[vs]]}
+	id := qs.addPrimitive(p)
 	qs.vals[vs] = id
 	return id, true
 }
 
-func (qs *QuadStore) resolveQuad(q quad.Quad, add bool) (internalQuad, bool) {
+func (qs *QuadStore) resolveQuad(q quad.Quad, add bool, ver int64) (internalQuad, bool) {
 	var p internalQuad
 	for dir := quad.Subject; dir <= quad.Label; dir++ {
 		v := q.Get(dir)
 		if v == nil {
 			continue
 		}
-		if vid, _ := qs.resolveVal(v, add); vid != 0 {
+		if vid, _ := qs.resolveVal(v, add, ver); vid != 0 {
 			p.SetDir(dir, vid)
 		} else if !add {
 			return internalQuad{}, false
@@ -255,15 +339,160 @@ func (qs *QuadStore) lookupQuadDirs(p internalQuad) quad.Quad {
 	return q
 }
 
+// write runs a function that modifies the store and commits a new version.
+//
+// If the store is persistent, changes returned by log are written to the log
+// before modifying the store.
+func (qs *QuadStore) write(log func() []graph.Delta, fnc func(ver int64)) error {
+	qs.wmu.Lock()
+	defer qs.wmu.Unlock()
+	if qs.disk != nil && log != nil {
+		if err := qs.disk.append(log()); err != nil {
+			return err
+		}
+	}
+	qs.mu.Lock()
+	defer qs.mu.Unlock()
+	ver := qs.version + 1
+	fnc(ver)
+	qs.commit(ver)
+	return nil
+}
+
+// commit makes a new version visible to readers. Must be called with write lock held.
+func (qs *QuadStore) commit(ver int64) {
+	qs.version = ver
+	qs.writing = false
+	qs.size = qs.count
+	qs.gc()
+}
+
+// maxModified is the number of tracked modifications above which entries older than the oldest open snapshot
+// are removed.
+var maxModified = 1 << 16
+
+// pruneModified removes modifications that are older than a given version, if there are too many of them.
+// Conflicts cannot be checked for older horizons after that, thus writes based on them fail with ErrConflict.
+// Must be called with write lock held.
+func (qs *QuadStore) pruneModified(min int64) {
+	// a snapshot of the version min was taken at the horizon min+1
+	horizon := min + 1
+	if len(qs.modified) <= maxModified || horizon <= qs.pruned {
+		return
+	}
+	for k, ver := range qs.modified {
+		if ver < horizon {
+			delete(qs.modified, k)
+		}
+	}
+	qs.pruned = horizon
+}
+
+// gc removes primitives that are not visible in the latest version and in any open snapshot.
+// Must be called with write lock held.
+func (qs *QuadStore) gc() {
+	min := qs.version
+	for ver := range qs.pinned {
+		if ver < min {
+			min = ver
+		}
+	}
+	qs.pruneModified(min)
+	purged := make(map[*primitive]struct{})
+	n := 0
+	for ; n < len(qs.garbage); n++ {
+		p := qs.garbage[n]
+		if p.removed > min {
+			break
+		}
+		qs.purge(p)
+		purged[p] = struct{}{}
+	}
+	qs.garbage = qs.garbage[n:]
+	if len(purged) == 0 {
+		return
+	}
+	reading := atomic.LoadInt32(&qs.reading) != 0
+	all := qs.all[:0]
+	if reading {
+		all = make([]*primitive, 0, len(qs.all)-len(purged))
+	}
+	for _, p := range qs.all {
+		if _, ok := purged[p]; !ok {
+			all = append(all, p)
+		}
+	}
+	if reading {
+		atomic.StoreInt32(&qs.reading, 0) // this is a new slice
+	} else {
+		for i := len(all); i < len(qs.all); i++ {
+			qs.all[i] = nil
+		}
+	}
+	qs.all = all
+}
+
+// purge removes all references to a primitive.
+func (qs *QuadStore) purge(p *primitive) {
+	unlink := func(head int64) bool {
+		if head == p.ID {
+			return true
+		}
+		for c := qs.prim[head]; c != nil; c = c.prev {
+			if c.prev == p {
+				c.prev = p.prev
+				break
+			}
+		}
+		return false
+	}
+	if p.Value != nil {
+		vs := p.Value.String()
+		if unlink(qs.vals[vs]) {
+			delete(qs.vals, vs)
+		}
+	}
+	if !p.Quad.Zero() {
+		if unlink(qs.quads[p.Quad]) {
+			delete(qs.quads, p.Quad)
+		}
+		for _, t := range qs.indexesForQuad(p.Quad) {
+			t.Delete(p.ID)
+		}
+	}
+	if c := qs.prim[p.ID]; c == p {
+		delete(qs.prim, p.ID)
+	} else {
+		// a blank node that was added again
+		for ; c != nil; c = c.prev {
+			if c.prev == p {
+				c.prev = p.prev
+				break
+			}
+		}
+	}
+	p.prev = nil
+}
+
 // AddNode adds a blank node (with no value) to quad store. It returns an id of the node.
 func (qs *QuadStore) AddBNode() int64 {
-	return qs.addPrimitive(&primitive{})
+	var id int64
+	qs.write(nil, func(ver int64) {
+		id = qs.addPrimitive(&primitive{added: ver})
+	})
+	return id
 }
 
 // AddNode adds a value to quad store. It returns an id of the value.
 // False is returned as a second parameter if value exists already.
 func (qs *QuadStore) AddValue(v quad.Value) (int64, bool) {
-	id, exists := qs.resolveVal(v, true)
+	var (
+		id     int64
+		exists bool
+	)
+	qs.write(nil, func(ver int64) {
+		id, exists = qs.resolveVal(v, true, ver)
+	})
 	return id, !exists
 }
 
@@ -282,13 +511,31 @@ func (qs *QuadStore) indexesForQuad(q internalQuad) []*Tree {
 // AddQuad adds a quad to quad store. It returns an id of the quad.
 // False is returned as a second parameter if quad exists already.
 func (qs *QuadStore) AddQuad(q quad.Quad) (int64, bool) {
-	p, _ := qs.resolveQuad(q, true)
-	if id := qs.quads[p]; id != 0 {
-		return id, false
+	var (
+		id  int64
+		new bool
+	)
+	err := qs.write(func() []graph.Delta {
+		return []graph.Delta{{Action: graph.Add, Quad: q}}
+	}, func(ver int64) {
+		id, new = qs.addQuad(q, ver)
+	})
+	if err != nil {
+		clog.Errorf("memstore: failed to add quad: %v", err)
+		return 0, false
+	}
+	return id, new
+}
+
+func (qs *QuadStore) addQuad(q quad.Quad, ver int64) (int64, bool) {
+	p, _ := qs.resolveQuad(q, true, ver)
+	if pr := qs.lookupChain(qs.quads[p], ver); pr != nil {
+		return pr.ID, false
 	}
-	pr := &primitive{Quad: p}
+	pr := &primitive{Quad: p, added: ver, prev: qs.prim[qs.quads[p]]}
 	id := qs.addPrimitive(pr)
 	qs.quads[p] = id
+	qs.modified[modKey(qs.lookupQuadDirs(p))] = ver
 	for _, t := range qs.indexesForQuad(p) {
 		t.Set(id, pr)
 	}
@@ -300,110 +547,207 @@ func (qs *QuadStore) AddQuad(q quad.Quad) (int64, bool) {
 //
 // Deprecated: use AddQuad instead.
 func (qs *QuadStore) WriteQuad(q quad.Quad) error {
-	qs.AddQuad(q)
-	return nil
+	return qs.ApplyDeltas([]graph.Delta{{Action: graph.Add, Quad: q}}, graph.IgnoreOpts{IgnoreDup: true})
 }
 
-func (qs *QuadStore) deleteQuadNodes(q internalQuad) {
+func (qs *QuadStore) deleteQuadNodes(q internalQuad, ver int64) {
 	for dir := quad.Subject; dir <= quad.Label; dir++ {
 		id := q.Dir(dir)
 		if id == 0 {
 			continue
 		}
-		if p := qs.prim[id]; p != nil {
+		if p := qs.lookupPrim(id, ver); p != nil {
 			p.refs--
 			if p.refs < 0 {
 				panic("remove of deleted node")
 			} else if p.refs == 0 {
-				qs.Delete(id)
+				qs.delete(id, ver)
 			}
 		}
 	}
 }
+
+// Delete removes a primitive with a given id from the store.
+// Open snapshots will still see it until they are closed.
 func (qs *QuadStore) Delete(id int64) bool {
-	p := qs.prim[id]
-	if p == nil {
+	var ok bool
+	err := qs.write(func() []graph.Delta {
+		qs.mu.RLock()
+		defer qs.mu.RUnlock()
+		p := qs.lookupPrim(id, qs.version)
+		if p == nil || p.Quad.Zero() {
+			return nil
+		}
+		return []graph.Delta{{Action: graph.Delete, Quad: qs.lookupQuadDirs(p.Quad)}}
+	}, func(ver int64) {
+		ok = qs.delete(id, ver)
+	})
+	if err != nil {
+		clog.Errorf("memstore: failed to delete %d: %v", id, err)
 		return false
 	}
-	// remove from value index
-	if p.Value != nil {
-		delete(qs.vals, p.Value.String())
-	}
-	// remove from quad indexes
-	for _, t := range qs.indexesForQuad(p.Quad) {
-		t.Delete(id)
-	}
-	delete(qs.quads, p.Quad)
-	// remove primitive
-	delete(qs.prim, id)
-	di := -1
-	for i, p2 := range qs.all {
-		if p == p2 {
-			di = i
-			break
-		}
+	return ok
+}
+
+func (qs *QuadStore) delete(id int64, ver int64) bool {
+	p := qs.lookupPrim(id, ver)
+	if p == nil {
+		return false
 	}
-	if di >= 0 {
-		if !qs.reading {
-			qs.all = append(qs.all[:di], qs.all[di+1:]...)
-		} else {
-			all := make([]*primitive, 0, len(qs.all)-1)
-			all = append(all, qs.all[:di]...)
-			all = append(all, qs.all[di+1:]...)
-			qs.all = all
-			qs.reading = false // this is a new slice
-		}
+	p.removed = ver
+	qs.count--
+	qs.garbage = append(qs.garbage, p)
+	if !p.Quad.Zero() {
+		qs.modified[modKey(qs.lookupQuadDirs(p.Quad))] = ver
 	}
-	qs.deleteQuadNodes(p.Quad)
+	qs.deleteQuadNodes(p.Quad, ver)
 	return true
 }
 
-func (qs *QuadStore) findQuad(q quad.Quad) (int64, internalQuad, bool) {
-	p, ok := qs.resolveQuad(q, false)
+func (qs *QuadStore) findQuad(q quad.Quad, ver int64) (int64, internalQuad, bool) {
+	p, ok := qs.resolveQuad(q, false, ver)
 	if !ok {
 		return 0, p, false
 	}
-	id := qs.quads[p]
-	return id, p, id != 0
+	pr := qs.lookupChain(qs.quads[p], ver)
+	if pr == nil {
+		return 0, p, false
+	}
+	return pr.ID, p, true
+}
+
+// modKey returns a key that is used to detect conflicting changes of quads.
+func modKey(q quad.Quad) string {
+	key := make([]string, 0, 3)
+	for _, d := range []quad.Direction{quad.Subject, quad.Predicate, quad.Label} {
+		if v := q.Get(d); v != nil {
+			key = append(key, v.String())
+		} else {
+			key = append(key, "")
+		}
+	}
+	return strings.Join(key, "\x00")
+}
+
+// Features returns capabilities of the store.
+func (qs *QuadStore) Features() graph.Features {
+	return graph.Features{
+		NodeGC:       true,
+		Transactions: true,
+		Horizons:     true,
+	}
 }
 
+// Horizon returns a version that will be assigned to the next write.
+func (qs *QuadStore) Horizon() int64 {
+	qs.mu.RLock()
+	defer qs.mu.RUnlock()
+	return qs.version + 1
+}
+
+// ApplyDeltas applies a set of changes as a single new version of the store.
+//
+// Readers are not blocked while deltas are applied, and will only see changes
+// after all of them were applied.
 func (qs *QuadStore) ApplyDeltas(deltas []graph.Delta, ignoreOpts graph.IgnoreOpts) error {
+	return qs.applyDeltas(deltas, ignoreOpts, 0)
+}
+
+// ApplyDeltasSince is the same as ApplyDeltas, but fails with graph.ErrConflict if quads with the same
+// subject, predicate and label as in any of the deltas were changed in a version equal to or after horizon.
+func (qs *QuadStore) ApplyDeltasSince(deltas []graph.Delta, ignoreOpts graph.IgnoreOpts, horizon int64) error {
+	if horizon <= 0 {
+		return fmt.Errorf("memstore: invalid horizon: %d", horizon)
+	}
+	return qs.applyDeltas(deltas, ignoreOpts, horizon)
+}
+
+func (qs *QuadStore) applyDeltas(deltas []graph.Delta, ignoreOpts graph.IgnoreOpts, since int64) error {
+	for _, d := range deltas {
+		if d.Action != graph.Add && d.Action != graph.Delete {
+			return &graph.DeltaError{Delta: d, Err: graph.ErrInvalidAction}
+		}
+	}
+	qs.wmu.Lock()
+	defer qs.wmu.Unlock()
+
+	if since > 0 {
+		qs.mu.RLock()
+		err := qs.checkConflicts(deltas, since)
+		qs.mu.RUnlock()
+		if err != nil {
+			return err
+		}
+	}
+
 	// Precheck the whole transaction (if required)
+	// Writers are serialized, thus a read lock is enough.
 	if !ignoreOpts.IgnoreDup || !ignoreOpts.IgnoreMissing {
-		for _, d := range deltas {
-			switch d.Action {
-			case graph.Add:
-				if !ignoreOpts.IgnoreDup {
-					if _, _, ok := qs.findQuad(d.Quad); ok {
-						return &graph.DeltaError{Delta: d, Err: graph.ErrQuadExists}
-					}
-				}
-			case graph.Delete:
-				if !ignoreOpts.IgnoreMissing {
-					if _, _, ok := qs.findQuad(d.Quad); !ok {
-						return &graph.DeltaError{Delta: d, Err: graph.ErrQuadNotExist}
-					}
-				}
-			default:
-				return &graph.DeltaError{Delta: d, Err: graph.ErrInvalidAction}
-			}
+		qs.mu.RLock()
+		err := qs.checkDeltas(deltas, ignoreOpts, qs.version)
+		qs.mu.RUnlock()
+		if err != nil {
+			return err
+		}
+	}
+
+	if qs.disk != nil {
+		if err := qs.disk.append(deltas); err != nil {
+			return err
 		}
 	}
 
+	qs.mu.Lock()
+	ver := qs.version + 1
+	qs.writing = true
+	qs.mu.Unlock()
 	for _, d := range deltas {
+		// take the lock for each delta to let readers in
+		qs.mu.Lock()
 		switch d.Action {
 		case graph.Add:
-			qs.AddQuad(d.Quad)
+			qs.addQuad(d.Quad, ver)
 		case graph.Delete:
-			if id, _, ok := qs.findQuad(d.Quad); ok {
-				qs.Delete(id)
+			if id, _, ok := qs.findQuad(d.Quad, ver); ok {
+				qs.delete(id, ver)
 			}
-		default:
-			// TODO: ideally we should rollback it
-			return &graph.DeltaError{Delta: d, Err: graph.ErrInvalidAction}
 		}
+		qs.mu.Unlock()
 	}
+	qs.mu.Lock()
 	qs.horizon++
+	qs.commit(ver)
+	qs.mu.Unlock()
+	return nil
+}
+
+func (qs *QuadStore) checkConflicts(deltas []graph.Delta, since int64) error {
+	for _, d := range deltas {
+		// modifications before the horizon might be already pruned
+		if since < qs.pruned || qs.modified[modKey(d.Quad)] >= since {
+			return &graph.DeltaError{Delta: d, Err: graph.ErrConflict}
+		}
+	}
+	return nil
+}
+
+func (qs *QuadStore) checkDeltas(deltas []graph.Delta, ignoreOpts graph.IgnoreOpts, ver int64) error {
+	for _, d := range deltas {
+		switch d.Action {
+		case graph.Add:
+			if !ignoreOpts.IgnoreDup {
+				if _, _, ok := qs.findQuad(d.Quad, ver); ok {
+					return &graph.DeltaError{Delta: d, Err: graph.ErrQuadExists}
+				}
+			}
+		case graph.Delete:
+			if !ignoreOpts.IgnoreMissing {
+				if _, _, ok := qs.findQuad(d.Quad, ver); !ok {
+					return &graph.DeltaError{Delta: d, Err: graph.ErrQuadNotExist}
+				}
+			}
+		}
+	}
 	return nil
 }
 
@@ -418,91 +762,62 @@ func asID(v graph.Value) (int64, bool) {
 	}
 }
 
-func (qs *QuadStore) quad(v graph.Value) (q internalQuad, ok bool) {
-	switch v := v.(type) {
-	case bnode:
-		p := qs.prim[int64(v)]
-		if p == nil {
-			return
-		}
-		q = p.Quad
-	case qprim:
-		q = v.p.Quad
-	default:
-		return internalQuad{}, false
-	}
-	return q, !q.Zero()
+// head returns a view of the latest committed version of the store.
+func (qs *QuadStore) head() *Snapshot {
+	qs.mu.RLock()
+	defer qs.mu.RUnlock()
+	return &Snapshot{qs: qs, ver: qs.version, size: qs.size}
 }
 
 func (qs *QuadStore) Quad(index graph.Value) quad.Quad {
-	q, ok := qs.quad(index)
-	if !ok {
-		return quad.Quad{}
-	}
-	return qs.lookupQuadDirs(q)
+	return qs.head().Quad(index)
 }
 
 func (qs *QuadStore) QuadIterator(d quad.Direction, value graph.Value) graph.Iterator {
-	id, ok := asID(value)
-	if !ok {
-		return iterator.NewNull()
-	}
-	index, ok := qs.index.Get(d, id)
-	if ok && index.Len() != 0 {
-		return NewIterator(index, qs, d, id)
-	}
-	return iterator.NewNull()
+	return qs.head().QuadIterator(d, value)
+}
+
+// QuadsWith returns the number of quads with a given value in the specified direction.
+func (qs *QuadStore) QuadsWith(d quad.Direction, value graph.Value) (int64, bool) {
+	return qs.head().QuadsWith(d, value)
 }
 
 func (qs *QuadStore) Size() int64 {
-	return int64(len(qs.prim))
+	return qs.head().Size()
 }
 
 func (qs *QuadStore) ValueOf(name quad.Value) graph.Value {
-	if name == nil {
-		return nil
-	}
-	id := qs.vals[name.String()]
-	if id == 0 {
-		return nil
-	}
-	return bnode(id)
+	return qs.head().ValueOf(name)
 }
 
 func (qs *QuadStore) NameOf(v graph.Value) quad.Value {
-	if v == nil {
-		return nil
-	} else if v, ok := v.(graph.PreFetchedValue); ok {
-		return v.NameOf()
-	}
-	n, ok := asID(v)
-	if !ok {
-		return nil
-	}
-	if _, ok = qs.prim[n]; !ok {
-		return nil
-	}
-	return qs.lookupVal(n)
+	return qs.head().NameOf(v)
 }
 
 func (qs *QuadStore) QuadsAllIterator() graph.Iterator {
-	return newAllIterator(qs, false, qs.last)
+	return qs.head().QuadsAllIterator()
 }
 
 func (qs *QuadStore) QuadDirection(val graph.Value, d quad.Direction) graph.Value {
-	q, ok := qs.quad(val)
-	if !ok {
-		return nil
-	}
-	id := q.Dir(d)
-	if id == 0 {
-		return nil
-	}
-	return bnode(id)
+	return qs.head().QuadDirection(val, d)
 }
 
 func (qs *QuadStore) NodesAllIterator() graph.Iterator {
-	return newAllIterator(qs, true, qs.last)
+	return qs.head().NodesAllIterator()
 }
 
-func (qs *QuadStore) Close() error { return nil }
+func (qs *QuadStore) OptimizeIterator(it graph.Iterator) (graph.Iterator, bool) {
+	return qs.head().OptimizeIterator(it)
+}
+
+// Close releases resources of the store. For persistent store it writes
+// a final snapshot and closes the log.
+func (qs *QuadStore) Close() error {
+	qs.wmu.Lock()
+	d := qs.disk
+	qs.wmu.Unlock()
+	if d == nil {
+		return nil
+	}
+	return d.close(qs)
+}
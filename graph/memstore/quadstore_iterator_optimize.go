@@ -21,16 +21,16 @@ import (
 	"github.com/cayleygraph/cayley/graph/iterator"
 )
 
-func (qs *QuadStore) OptimizeIterator(it graph.Iterator) (graph.Iterator, bool) {
+func (s *Snapshot) OptimizeIterator(it graph.Iterator) (graph.Iterator, bool) {
 	switch it.Type() {
 	case graph.LinksTo:
-		return qs.optimizeLinksTo(it.(*iterator.LinksTo))
+		return s.optimizeLinksTo(it.(*iterator.LinksTo))
 
 	}
 	return it, false
 }
 
-func (qs *QuadStore) optimizeLinksTo(it *iterator.LinksTo) (graph.Iterator, bool) {
+func (s *Snapshot) optimizeLinksTo(it *iterator.LinksTo) (graph.Iterator, bool) {
 	subs := it.SubIterators()
 	if len(subs) != 1 {
 		return it, false
@@ -44,7 +44,7 @@ func (qs *QuadStore) optimizeLinksTo(it *iterator.LinksTo) (graph.Iterator, bool
 				panic("unexpected size during optimize")
 			}
 			val := primary.Result()
-			newIt := qs.QuadIterator(it.Direction(), val)
+			newIt := s.QuadIterator(it.Direction(), val)
 			nt := newIt.Tagger()
 			nt.CopyFrom(it)
 			for _, tag := range primary.Tagger().Tags() {
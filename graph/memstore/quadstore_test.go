@@ -16,6 +16,9 @@ package memstore
 
 import (
 	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
 	"reflect"
 	"sort"
 	"testing"
@@ -87,6 +90,12 @@ func TestMemstore(t *testing.T) {
 	})
 }
 
+func BenchmarkMemstore(b *testing.B) {
+	graphtest.BenchmarkAll(b, func(t testing.TB) (graph.QuadStore, graph.Options, func()) {
+		return New(), nil, func() {}
+	}, nil)
+}
+
 type pair struct {
 	query string
 	value int64
@@ -245,3 +254,198 @@ func TestTransaction(t *testing.T) {
 		t.Error("Appended a new quad in a failed transaction")
 	}
 }
+
+func TestConditionalTransaction(t *testing.T) {
+	qs, w, _ := makeTestStore(simpleGraph)
+
+	base := qs.Horizon()
+	err := w.AddQuad(quad.MakeRaw("B", "status", "uncool", "status_graph"))
+	require.NoError(t, err)
+
+	// other keys were not modified
+	tx := graph.NewTransaction()
+	tx.Base = base
+	tx.AddQuad(quad.MakeRaw("E", "follows", "G", ""))
+	err = w.ApplyTransaction(tx)
+	require.NoError(t, err)
+
+	tx = graph.NewTransaction()
+	tx.Base = base
+	tx.RemoveQuad(quad.MakeRaw("B", "status", "cool", "status_graph"))
+	tx.AddQuad(quad.MakeRaw("B", "status", "cold", "status_graph"))
+	size := qs.Size()
+	err = w.ApplyTransaction(tx)
+	require.True(t, graph.IsConflict(err), "unexpected error: %v", err)
+	require.Equal(t, size, qs.Size())
+
+	// removal is a modification as well
+	base = qs.Horizon()
+	err = w.RemoveQuad(quad.MakeRaw("A", "follows", "B", ""))
+	require.NoError(t, err)
+	tx = graph.NewTransaction()
+	tx.Base = base
+	tx.AddQuad(quad.MakeRaw("A", "follows", "C", ""))
+	err = w.ApplyTransaction(tx)
+	require.True(t, graph.IsConflict(err), "unexpected error: %v", err)
+
+	tx.Base = qs.Horizon()
+	err = w.ApplyTransaction(tx)
+	require.NoError(t, err)
+}
+
+func TestSnapshot(t *testing.T) {
+	ctx := context.TODO()
+	qs, w, _ := makeTestStore(simpleGraph)
+	size := qs.Size()
+
+	s := qs.Snapshot()
+	q := quad.MakeRaw("E", "follows", "F", "")
+	err := w.RemoveQuad(q)
+	require.NoError(t, err)
+	err = w.AddQuad(quad.MakeRaw("E", "follows", "G", ""))
+	require.NoError(t, err)
+
+	count := func(qs graph.QuadStore) (n int) {
+		it := qs.QuadIterator(quad.Subject, qs.ValueOf(quad.Raw("E")))
+		defer it.Close()
+		for it.Next(ctx) {
+			n++
+		}
+		return
+	}
+	first := func(qs graph.QuadStore) quad.Quad {
+		it := qs.QuadIterator(quad.Subject, qs.ValueOf(quad.Raw("E")))
+		defer it.Close()
+		require.True(t, it.Next(ctx))
+		return qs.Quad(it.Result())
+	}
+	require.Equal(t, size, s.Size())
+	require.Equal(t, 1, count(s))
+	require.Equal(t, 1, count(qs))
+	require.Equal(t, q, first(s))
+	require.Equal(t, quad.MakeRaw("E", "follows", "G", ""), first(qs))
+
+	require.Equal(t, graph.ErrNotWritable, s.ApplyDeltas(nil, graph.IgnoreOpts{}))
+	_, versioned := graph.AsVersioned(s)
+	require.False(t, versioned)
+	require.True(t, graph.FeaturesOf(qs).Horizons)
+
+	require.NoError(t, s.Close())
+	require.Equal(t, size, qs.Size())
+	require.Len(t, qs.garbage, 0)
+}
+
+func TestSnapshotBNode(t *testing.T) {
+	ctx := context.TODO()
+	qs := New()
+	w, _ := writer.NewSingleReplication(qs, nil)
+
+	n := qs.NameOf(bnode(qs.AddBNode()))
+	q := quad.Quad{Subject: n, Predicate: quad.IRI("p"), Object: quad.IRI("a")}
+	require.NoError(t, w.AddQuad(q))
+	size := qs.Size()
+
+	s := qs.Snapshot()
+	defer s.Close()
+	require.NoError(t, w.RemoveQuad(q))
+	for _, o := range []quad.IRI{"b", "c"} {
+		require.NoError(t, w.AddQuad(quad.Quad{Subject: n, Predicate: quad.IRI("p"), Object: o}))
+	}
+	require.Equal(t, size, s.Size())
+	require.Equal(t, size+2, qs.Size())
+
+	it := s.QuadIterator(quad.Predicate, s.ValueOf(quad.IRI("p")))
+	defer it.Close()
+	require.True(t, it.Next(ctx))
+	require.Equal(t, q, s.Quad(it.Result()))
+	require.Equal(t, n, s.NameOf(s.QuadDirection(it.Result(), quad.Subject)))
+	require.False(t, it.Next(ctx))
+}
+
+func TestPruneModified(t *testing.T) {
+	old := maxModified
+	maxModified = 1
+	defer func() {
+		maxModified = old
+	}()
+	qs, w, _ := makeTestStore(simpleGraph)
+
+	s := qs.Snapshot()
+	base := qs.Horizon()
+	require.NoError(t, w.AddQuad(quad.MakeRaw("B", "status", "uncool", "status_graph")))
+	require.NoError(t, w.AddQuad(quad.MakeRaw("C", "status", "uncool", "status_graph")))
+	// modifications after the snapshot are kept
+	require.True(t, len(qs.modified) > 1)
+
+	tx := graph.NewTransaction()
+	tx.Base = base
+	tx.AddQuad(quad.MakeRaw("E", "follows", "G", ""))
+	require.NoError(t, w.ApplyTransaction(tx))
+
+	s.Close()
+	require.Equal(t, 0, len(qs.modified))
+
+	// horizons older than pruned modifications always conflict
+	tx = graph.NewTransaction()
+	tx.Base = base
+	tx.AddQuad(quad.MakeRaw("F", "follows", "G", ""))
+	require.True(t, graph.IsConflict(w.ApplyTransaction(tx)))
+
+	tx = graph.NewTransaction()
+	tx.Base = qs.Horizon()
+	tx.AddQuad(quad.MakeRaw("F", "follows", "G", ""))
+	require.NoError(t, w.ApplyTransaction(tx))
+}
+
+func TestPersistent(t *testing.T) {
+	dir, err := ioutil.TempDir("", "cayley_memstore")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	opts := graph.Options{"snapshot_interval": "0"}
+	qs, err := Open(dir, opts)
+	require.NoError(t, err)
+	w, err := writer.NewSingleReplication(qs, nil)
+	require.NoError(t, err)
+	err = w.AddQuadSet(simpleGraph)
+	require.NoError(t, err)
+	err = w.RemoveQuad(simpleGraph[0])
+	require.NoError(t, err)
+
+	// simulate a crash with a partial transaction in the log
+	f, err := os.OpenFile(logPath(dir, 0), os.O_WRONLY|os.O_APPEND, 0)
+	require.NoError(t, err)
+	_, err = f.WriteString(logAdd + "<a> <b> <c> .\n" + logAdd + "<a> <b>")
+	require.NoError(t, err)
+	f.Close()
+
+	expect := simpleGraph[1:]
+	check := func(qs *QuadStore) {
+		require.Equal(t, New(expect...).Size(), qs.Size())
+		require.Nil(t, qs.ValueOf(quad.IRI("a")))
+		for _, q := range expect {
+			_, _, ok := qs.findQuad(q, qs.version)
+			require.True(t, ok, "missing quad: %v", q)
+		}
+	}
+
+	qs2, err := Open(dir, opts)
+	require.NoError(t, err)
+	check(qs2)
+	require.NoError(t, qs2.Close())
+
+	logs, err := listFiles(dir, logPrefix, logExt)
+	require.NoError(t, err)
+	require.Equal(t, []int64{1}, logs)
+	_, err = os.Stat(snapshotPath(dir, 1))
+	require.NoError(t, err)
+
+	qs3, err := Open(dir, opts)
+	require.NoError(t, err)
+	defer qs3.Close()
+	check(qs3)
+
+	names, err := filepath.Glob(filepath.Join(dir, "*"))
+	require.NoError(t, err)
+	require.Len(t, names, 2)
+}
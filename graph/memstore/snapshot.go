@@ -0,0 +1,199 @@
+// Copyright 2017 The Cayley Authors. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package memstore
+
+import (
+	"github.com/cayleygraph/cayley/graph"
+	"github.com/cayleygraph/cayley/graph/iterator"
+	"github.com/cayleygraph/cayley/graph/stats"
+	"github.com/cayleygraph/cayley/quad"
+)
+
+var (
+	_ graph.QuadStore = (*Snapshot)(nil)
+	_ stats.Estimator = (*Snapshot)(nil)
+
+	_ graph.FeatureReporter = (*Snapshot)(nil)
+)
+
+// Snapshot is a read-only view of a single version of in-memory quad store.
+// It is not affected by writes made after it was created.
+type Snapshot struct {
+	qs     *QuadStore
+	ver    int64
+	size   int64
+	pinned bool
+}
+
+// Snapshot returns a read-only view of the latest version of the store.
+//
+// Removed quads are kept in memory while they are visible to any snapshot,
+// thus snapshot must be closed when it is no longer needed.
+func (qs *QuadStore) Snapshot() *Snapshot {
+	qs.mu.Lock()
+	defer qs.mu.Unlock()
+	qs.pinned[qs.version]++
+	return &Snapshot{qs: qs, ver: qs.version, size: qs.size, pinned: true}
+}
+
+// exactAt checks if index sizes are exact for a specified version.
+// Must be called with read lock held.
+func (qs *QuadStore) exactAt(ver int64) bool {
+	return ver == qs.version && !qs.writing && len(qs.garbage) == 0
+}
+
+// Features returns capabilities of the snapshot. Snapshots cannot be written to.
+func (s *Snapshot) Features() graph.Features {
+	return graph.Features{}
+}
+
+// ApplyDeltas always returns an error, since snapshots are read-only.
+func (s *Snapshot) ApplyDeltas(deltas []graph.Delta, ignoreOpts graph.IgnoreOpts) error {
+	return graph.ErrNotWritable
+}
+
+func (s *Snapshot) quad(v graph.Value) (q internalQuad, ok bool) {
+	switch v := v.(type) {
+	case bnode:
+		p := s.qs.lookupPrim(int64(v), s.ver)
+		if p == nil {
+			return
+		}
+		q = p.Quad
+	case qprim:
+		q = v.p.Quad
+	default:
+		return internalQuad{}, false
+	}
+	return q, !q.Zero()
+}
+
+func (s *Snapshot) Quad(index graph.Value) quad.Quad {
+	s.qs.mu.RLock()
+	defer s.qs.mu.RUnlock()
+	q, ok := s.quad(index)
+	if !ok {
+		return quad.Quad{}
+	}
+	return s.qs.lookupQuadDirs(q)
+}
+
+func (s *Snapshot) QuadIterator(d quad.Direction, value graph.Value) graph.Iterator {
+	id, ok := asID(value)
+	if !ok {
+		return iterator.NewNull()
+	}
+	s.qs.mu.RLock()
+	defer s.qs.mu.RUnlock()
+	index, ok := s.qs.index.Get(d, id)
+	if ok && index.Len() != 0 {
+		return newIterator(index, s.qs, d, id, s.ver)
+	}
+	return iterator.NewNull()
+}
+
+// QuadsWith returns the number of quads with a given value in the specified direction.
+// The number is exact if there are no concurrent writes and no removed quads are kept for other snapshots.
+func (s *Snapshot) QuadsWith(d quad.Direction, value graph.Value) (int64, bool) {
+	id, ok := asID(value)
+	if !ok {
+		return 0, true
+	}
+	s.qs.mu.RLock()
+	defer s.qs.mu.RUnlock()
+	index, ok := s.qs.index.Get(d, id)
+	if !ok {
+		return 0, true
+	}
+	return int64(index.Len()), s.qs.exactAt(s.ver)
+}
+
+// Size returns the number of nodes and quads in the version of the snapshot.
+func (s *Snapshot) Size() int64 {
+	return s.size
+}
+
+func (s *Snapshot) ValueOf(name quad.Value) graph.Value {
+	if name == nil {
+		return nil
+	}
+	s.qs.mu.RLock()
+	defer s.qs.mu.RUnlock()
+	p := s.qs.lookupChain(s.qs.vals[name.String()], s.ver)
+	if p == nil {
+		return nil
+	}
+	return bnode(p.ID)
+}
+
+func (s *Snapshot) NameOf(v graph.Value) quad.Value {
+	if v == nil {
+		return nil
+	} else if v, ok := v.(graph.PreFetchedValue); ok {
+		return v.NameOf()
+	}
+	n, ok := asID(v)
+	if !ok {
+		return nil
+	}
+	s.qs.mu.RLock()
+	defer s.qs.mu.RUnlock()
+	if s.qs.lookupPrim(n, s.ver) == nil {
+		return nil
+	}
+	return s.qs.lookupVal(n)
+}
+
+func (s *Snapshot) QuadsAllIterator() graph.Iterator {
+	s.qs.mu.RLock()
+	defer s.qs.mu.RUnlock()
+	return newAllIterator(s.qs, false, s.ver)
+}
+
+func (s *Snapshot) QuadDirection(val graph.Value, d quad.Direction) graph.Value {
+	s.qs.mu.RLock()
+	defer s.qs.mu.RUnlock()
+	q, ok := s.quad(val)
+	if !ok {
+		return nil
+	}
+	id := q.Dir(d)
+	if id == 0 {
+		return nil
+	}
+	return bnode(id)
+}
+
+func (s *Snapshot) NodesAllIterator() graph.Iterator {
+	s.qs.mu.RLock()
+	defer s.qs.mu.RUnlock()
+	return newAllIterator(s.qs, true, s.ver)
+}
+
+// Close releases the snapshot, allowing the store to reclaim memory of removed quads.
+func (s *Snapshot) Close() error {
+	if !s.pinned {
+		return nil
+	}
+	s.pinned = false
+	qs := s.qs
+	qs.mu.Lock()
+	defer qs.mu.Unlock()
+	if qs.pinned[s.ver]--; qs.pinned[s.ver] <= 0 {
+		delete(qs.pinned, s.ver)
+	}
+	qs.gc()
+	return nil
+}
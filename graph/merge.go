@@ -0,0 +1,168 @@
+// Copyright 2017 The Cayley Authors. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package graph
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/cayleygraph/cayley/quad"
+)
+
+// NodeMerge describes a set of nodes that must be replaced with a single node.
+type NodeMerge struct {
+	Into  quad.Value   // node that will be kept
+	Nodes []quad.Value // nodes that will be replaced; Into is ignored if listed
+}
+
+// Merger rewrites quads according to a set of node merges.
+type Merger struct {
+	into  map[string]quad.Value
+	nodes []quad.Value // all replaced nodes
+}
+
+// NewMerger creates a Merger for a given set of merges. Chained merges (a into b, b into c) are resolved
+// to the last node of the chain. It fails if merges form a cycle.
+func NewMerger(merges ...NodeMerge) (*Merger, error) {
+	m := &Merger{into: make(map[string]quad.Value)}
+	for _, g := range merges {
+		if g.Into == nil {
+			return nil, fmt.Errorf("no target node to merge into")
+		}
+		to := quad.StringOf(g.Into)
+		for _, v := range g.Nodes {
+			if v == nil {
+				continue
+			}
+			k := quad.StringOf(v)
+			if k == to {
+				continue
+			} else if prev, ok := m.into[k]; ok {
+				if quad.StringOf(prev) != to {
+					return nil, fmt.Errorf("node %v is merged into both %v and %v", v, prev, g.Into)
+				}
+				continue
+			}
+			m.into[k] = g.Into
+			m.nodes = append(m.nodes, v)
+		}
+	}
+	// resolve chains
+	for k, v := range m.into {
+		seen := map[string]struct{}{k: {}}
+		for {
+			vk := quad.StringOf(v)
+			if _, ok := seen[vk]; ok {
+				return nil, fmt.Errorf("node %v is merged into itself", v)
+			}
+			seen[vk] = struct{}{}
+			next, ok := m.into[vk]
+			if !ok {
+				break
+			}
+			v = next
+		}
+		m.into[k] = v
+	}
+	return m, nil
+}
+
+// Node returns a node that replaces a given node. Nodes that are not merged are returned as-is.
+func (m *Merger) Node(v quad.Value) quad.Value {
+	if v == nil {
+		return nil
+	}
+	if to, ok := m.into[quad.StringOf(v)]; ok {
+		return to
+	}
+	return v
+}
+
+// Quad returns a quad with all merged nodes replaced.
+func (m *Merger) Quad(q quad.Quad) quad.Quad {
+	for _, d := range quad.Directions {
+		q.Set(d, m.Node(q.Get(d)))
+	}
+	return q
+}
+
+// Len returns the number of nodes that will be replaced.
+func (m *Merger) Len() int {
+	return len(m.nodes)
+}
+
+// Apply adds changes to a transaction that rewrite all quads referencing merged nodes.
+// Quads that already exist in the store after rewriting are only removed in their old form.
+// It returns the number of rewritten quads.
+//
+// Changes must be applied in a single transaction, since quads are looked up in the store
+// and the state of the store must not change until all the changes are applied.
+func (m *Merger) Apply(ctx context.Context, qs QuadStore, tx *Transaction) (int, error) {
+	seen := make(map[quad.Quad]struct{})
+	n := 0
+	for _, v := range m.nodes {
+		if err := ctx.Err(); err != nil {
+			return n, err
+		}
+		ref := qs.ValueOf(v)
+		if ref == nil {
+			continue
+		}
+		for _, d := range quad.Directions {
+			var err error
+			it := qs.QuadIterator(d, ref)
+			for err == nil && it.Next(ctx) {
+				q := qs.Quad(it.Result())
+				if _, ok := seen[q]; ok {
+					continue
+				}
+				seen[q] = struct{}{}
+				nq := m.Quad(q)
+				tx.RemoveQuad(q)
+				n++
+				var ok bool
+				if ok, err = hasQuad(qs, nq); err == nil && !ok {
+					tx.AddQuad(nq)
+				}
+			}
+			if err == nil {
+				err = it.Err()
+			}
+			it.Close()
+			if err != nil {
+				return n, err
+			}
+		}
+	}
+	return n, nil
+}
+
+// MergeNodes replaces nodes with a single node in all quads of the store. All changes are applied in a single transaction.
+// It returns the number of rewritten quads. See Merger for details.
+func MergeNodes(ctx context.Context, qs QuadStore, w QuadWriter, merges ...NodeMerge) (int, error) {
+	m, err := NewMerger(merges...)
+	if err != nil {
+		return 0, err
+	}
+	tx := NewTransaction()
+	n, err := m.Apply(ctx, qs, tx)
+	if err != nil || len(tx.Deltas) == 0 {
+		return n, err
+	}
+	if err = w.ApplyTransaction(tx); err != nil {
+		return 0, err
+	}
+	return n, nil
+}
@@ -0,0 +1,100 @@
+package graph_test
+
+import (
+	"context"
+	"sort"
+	"testing"
+
+	"github.com/cayleygraph/cayley/graph"
+	"github.com/cayleygraph/cayley/graph/memstore"
+	"github.com/cayleygraph/cayley/quad"
+	"github.com/cayleygraph/cayley/writer"
+	"github.com/stretchr/testify/require"
+)
+
+func sortedQuads(t testing.TB, qs graph.QuadStore) []string {
+	var out []string
+	it := qs.QuadsAllIterator()
+	defer it.Close()
+	for it.Next(context.TODO()) {
+		out = append(out, qs.Quad(it.Result()).String())
+	}
+	require.NoError(t, it.Err())
+	sort.Strings(out)
+	return out
+}
+
+func TestMergeNodes(t *testing.T) {
+	qs := memstore.New(
+		quad.MakeIRI("alice", "follows", "bob", ""),
+		quad.MakeIRI("alice", "follows", "Bob", ""),
+		quad.MakeIRI("Bob", "follows", "carol", ""),
+		quad.MakeIRI("bob", "follows", "carol", "Bob"),
+		quad.MakeIRI("dave", "follows", "Carol", ""),
+		quad.MakeIRI("Bob", "follows", "Carol", ""),
+	)
+	qw, err := writer.NewSingleReplication(qs, nil)
+	require.NoError(t, err)
+
+	n, err := graph.MergeNodes(context.TODO(), qs, qw,
+		graph.NodeMerge{Into: quad.IRI("bob"), Nodes: []quad.Value{quad.IRI("Bob"), quad.IRI("bob")}},
+		graph.NodeMerge{Into: quad.IRI("carol"), Nodes: []quad.Value{quad.IRI("Carol")}},
+	)
+	require.NoError(t, err)
+	require.Equal(t, 5, n)
+
+	exp := []string{
+		quad.MakeIRI("alice", "follows", "bob", "").String(),
+		quad.MakeIRI("bob", "follows", "carol", "").String(),
+		quad.MakeIRI("bob", "follows", "carol", "bob").String(),
+		quad.MakeIRI("dave", "follows", "carol", "").String(),
+	}
+	sort.Strings(exp)
+	require.Equal(t, exp, sortedQuads(t, qs))
+	require.Nil(t, qs.ValueOf(quad.IRI("Bob")))
+}
+
+func TestMerger(t *testing.T) {
+	m, err := graph.NewMerger(
+		graph.NodeMerge{Into: quad.IRI("b"), Nodes: []quad.Value{quad.IRI("a")}},
+		graph.NodeMerge{Into: quad.IRI("c"), Nodes: []quad.Value{quad.IRI("b")}},
+	)
+	require.NoError(t, err)
+	require.Equal(t, 2, m.Len())
+	require.Equal(t, quad.IRI("c"), m.Node(quad.IRI("a")))
+	require.Equal(t, quad.IRI("d"), m.Node(quad.IRI("d")))
+	require.Equal(t, quad.MakeIRI("c", "p", "c", ""), m.Quad(quad.MakeIRI("a", "p", "b", "")))
+
+	_, err = graph.NewMerger(
+		graph.NodeMerge{Into: quad.IRI("b"), Nodes: []quad.Value{quad.IRI("a")}},
+		graph.NodeMerge{Into: quad.IRI("a"), Nodes: []quad.Value{quad.IRI("b")}},
+	)
+	require.Error(t, err)
+
+	_, err = graph.NewMerger(
+		graph.NodeMerge{Into: quad.IRI("b"), Nodes: []quad.Value{quad.IRI("a")}},
+		graph.NodeMerge{Into: quad.IRI("c"), Nodes: []quad.Value{quad.IRI("a")}},
+	)
+	require.Error(t, err)
+}
+
+func TestRemoveMatching(t *testing.T) {
+	qs := memstore.New()
+	qw, err := writer.NewSingleReplication(qs, nil)
+	require.NoError(t, err)
+	// more quads than a single batch
+	n := quad.DefaultBatch*2 + quad.DefaultBatch/2
+	var keep []string
+	for i := 0; i < n; i++ {
+		require.NoError(t, qw.AddQuad(quad.Make(quad.IRI("a"), quad.IRI("p"), i, nil)))
+		q := quad.Make(quad.IRI("b"), quad.IRI("p"), i, nil)
+		require.NoError(t, qw.AddQuad(q))
+		keep = append(keep, q.String())
+	}
+	sort.Strings(keep)
+
+	got, err := graph.RemoveMatching(qw, qs, quad.Quad{Subject: quad.IRI("a")})
+	require.NoError(t, err)
+	require.Equal(t, n, got)
+	require.Equal(t, keep, sortedQuads(t, qs))
+}
@@ -0,0 +1,71 @@
+package graph
+
+// ApplyDeltasFunc applies a set of deltas to the graph. It has the same signature as QuadStore.ApplyDeltas.
+type ApplyDeltasFunc func(in []Delta, opts IgnoreOpts) error
+
+// WriterMiddleware wraps a function that applies deltas to the graph.
+//
+// Middleware may observe deltas (audit logging), modify them (denormalization) or veto
+// the whole set by returning an error without calling next (validation).
+type WriterMiddleware func(next ApplyDeltasFunc) ApplyDeltasFunc
+
+// ChainWriterMiddleware combines multiple middlewares into one. The first middleware is called first.
+func ChainWriterMiddleware(mws ...WriterMiddleware) WriterMiddleware {
+	return func(next ApplyDeltasFunc) ApplyDeltasFunc {
+		for i := len(mws) - 1; i >= 0; i-- {
+			next = mws[i](next)
+		}
+		return next
+	}
+}
+
+// WithWriterMiddleware wraps a QuadStore so that all deltas pass through the middlewares before
+// reaching the store. The result can be passed to any QuadWriter, which will do the batching.
+//
+// Optional interfaces implemented by the store are not exposed by the wrapper.
+func WithWriterMiddleware(qs QuadStore, mws ...WriterMiddleware) QuadStore {
+	if len(mws) == 0 {
+		return qs
+	}
+	return &middlewareStore{
+		QuadStore: qs,
+		apply:     ChainWriterMiddleware(mws...)(qs.ApplyDeltas),
+	}
+}
+
+type middlewareStore struct {
+	QuadStore
+	apply ApplyDeltasFunc
+}
+
+func (qs *middlewareStore) ApplyDeltas(in []Delta, opts IgnoreOpts) error {
+	return qs.apply(in, opts)
+}
+
+// ValidateDeltas returns a middleware that checks each delta with a given function.
+// If any delta fails the check, the whole set is rejected with a DeltaError.
+func ValidateDeltas(fnc func(d Delta) error) WriterMiddleware {
+	return func(next ApplyDeltasFunc) ApplyDeltasFunc {
+		return func(in []Delta, opts IgnoreOpts) error {
+			for _, d := range in {
+				if err := fnc(d); err != nil {
+					return &DeltaError{Delta: d, Err: err}
+				}
+			}
+			return next(in, opts)
+		}
+	}
+}
+
+// ObserveDeltas returns a middleware that calls a given function after deltas were successfully applied.
+func ObserveDeltas(fnc func(in []Delta)) WriterMiddleware {
+	return func(next ApplyDeltasFunc) ApplyDeltasFunc {
+		return func(in []Delta, opts IgnoreOpts) error {
+			if err := next(in, opts); err != nil {
+				return err
+			}
+			fnc(in)
+			return nil
+		}
+	}
+}
@@ -0,0 +1,72 @@
+package graph_test
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+
+	"github.com/cayleygraph/cayley/graph"
+	"github.com/cayleygraph/cayley/graph/graphmock"
+	"github.com/cayleygraph/cayley/quad"
+	_ "github.com/cayleygraph/cayley/writer"
+)
+
+type recordStore struct {
+	graphmock.Store
+	deltas []graph.Delta
+}
+
+func (qs *recordStore) ApplyDeltas(in []graph.Delta, _ graph.IgnoreOpts) error {
+	qs.deltas = append(qs.deltas, in...)
+	return nil
+}
+
+func TestWriterMiddleware(t *testing.T) {
+	errDenied := errors.New("denied")
+	var (
+		calls    []string
+		observed []graph.Delta
+	)
+	trace := func(name string) graph.WriterMiddleware {
+		return func(next graph.ApplyDeltasFunc) graph.ApplyDeltasFunc {
+			return func(in []graph.Delta, opts graph.IgnoreOpts) error {
+				calls = append(calls, name)
+				return next(in, opts)
+			}
+		}
+	}
+	st := &recordStore{}
+	qs := graph.WithWriterMiddleware(st,
+		trace("a"), trace("b"),
+		graph.ValidateDeltas(func(d graph.Delta) error {
+			if d.Quad.Predicate == quad.IRI("secret") {
+				return errDenied
+			}
+			return nil
+		}),
+		graph.ObserveDeltas(func(in []graph.Delta) {
+			observed = append(observed, in...)
+		}),
+	)
+	qw, err := graph.NewQuadWriter("single", qs, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	q1 := quad.MakeIRI("a", "follows", "b", "")
+	if err = qw.AddQuadSet([]quad.Quad{q1}); err != nil {
+		t.Fatal(err)
+	}
+	q2 := quad.MakeIRI("a", "secret", "b", "")
+	err = qw.AddQuadSet([]quad.Quad{q1, q2})
+	if de, ok := err.(*graph.DeltaError); !ok || de.Err != errDenied || de.Delta.Quad != q2 {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	exp := []graph.Delta{{Quad: q1, Action: graph.Add}}
+	if !reflect.DeepEqual(st.deltas, exp) {
+		t.Fatalf("unexpected deltas: %v", st.deltas)
+	} else if !reflect.DeepEqual(observed, exp) {
+		t.Fatalf("unexpected observed deltas: %v", observed)
+	} else if !reflect.DeepEqual(calls, []string{"a", "b", "a", "b"}) {
+		t.Fatalf("unexpected call order: %v", calls)
+	}
+}
@@ -19,6 +19,7 @@ const Type = "elastic"
 
 var (
 	_ nosql.BatchInserter = (*DB)(nil)
+	_ nosql.TextSearcher  = (*DB)(nil)
 )
 
 func init() {
@@ -133,6 +134,8 @@ func (db *DB) EnsureIndex(ctx context.Context, typ string, primary nosql.Index,
 			switch ind.Type {
 			case nosql.StringExact:
 				typ = indKeyword
+			case nosql.StringFulltext:
+				// dynamic mapping already indexes strings as text
 			}
 			if typ != "" {
 				props[f] = property{Type: typ}
@@ -409,6 +412,12 @@ func (q elasticQuery) Source() (interface{}, error) {
 				panic("unreachable")
 			}
 			ranges[name] = r
+		case nosql.Prefix:
+			must = append(must, map[string]interface{}{
+				"prefix": map[string]interface{}{
+					name: val,
+				},
+			})
 		default:
 			return nil, fmt.Errorf("unsupported filter: %v", f.Filter)
 		}
@@ -497,7 +506,9 @@ func (q *Query) Iterate() nosql.DocIterator {
 
 type Iterator struct {
 	indexRef
-	qu *elastic.ScrollService
+	qu    *elastic.ScrollService
+	limit int // zero means no limit
+	n     int
 
 	buf  *elastic.SearchResult
 	done bool
@@ -508,6 +519,9 @@ type Iterator struct {
 func (it *Iterator) Next(ctx context.Context) bool {
 	if it.done {
 		return false
+	} else if it.limit > 0 && it.n >= it.limit {
+		it.done = true
+		return false
 	}
 	if it.buf == nil {
 		it.buf, it.err = it.qu.Do(ctx)
@@ -525,6 +539,7 @@ func (it *Iterator) Next(ctx context.Context) bool {
 		it.done = true
 		return false
 	}
+	it.n++
 	return true
 }
 func (it *Iterator) Err() error {
@@ -554,6 +569,17 @@ func (it *Iterator) Doc() nosql.Document {
 	return it.c.convDoc(h)
 }
 
+// SearchText implements nosql.TextSearcher using a match query. Results are sorted by score.
+func (db *DB) SearchText(ctx context.Context, col string, field []string, query string, limit int) nosql.DocIterator {
+	ref := db.indexRef(col)
+	qu := db.cli.Scroll(db.ind).Type(ref.c.typ).
+		Query(elastic.NewMatchQuery(strings.Join(field, "."), query))
+	if limit > 0 {
+		qu = qu.Size(limit)
+	}
+	return &Iterator{indexRef: ref, qu: qu, limit: limit}
+}
+
 type Delete struct {
 	indexRef
 	qu elasticQuery
@@ -37,3 +37,9 @@ func TestElastic(t *testing.T) {
 		FloatToInt: true,
 	})
 }
+
+func BenchmarkElastic(b *testing.B) {
+	nosqltest.BenchmarkAll(b, makeElastic, &nosqltest.Config{
+		FloatToInt: true,
+	})
+}
@@ -39,6 +39,8 @@ type Iterator struct {
 	limit      int64
 	constraint []FieldFilter
 	links      []Linkage // used in Contains
+	pipe       *Pipeline // executed instead of a simple query, if set
+	field      string    // if set, iterator returns nodes referenced by this field
 
 	iter   DocIterator
 	result graph.Value
@@ -47,20 +49,25 @@ type Iterator struct {
 }
 
 func NewLinksToIterator(qs *QuadStore, collection string, links []Linkage) *Iterator {
-	filters := make([]FieldFilter, 0, len(links))
-	for _, l := range links {
-		filters = append(filters, FieldFilter{
-			Path:   []string{l.Dir.String()},
-			Filter: Equal,
-			Value:  String(l.Val),
-		})
-	}
-	it := NewIterator(qs, collection, filters...)
+	it := NewIterator(qs, collection, linkFilters(links)...)
 	it.links = links
 	return it
 }
 
+// NewPipelineIterator creates an iterator over the results of a pipeline. Database must implement Aggregator.
+// If field is set, iterator returns nodes referenced by this field of each document instead of documents.
+func NewPipelineIterator(qs *QuadStore, collection string, p Pipeline, field string) *Iterator {
+	it := NewIterator(qs, collection, p.Filters...)
+	it.pipe = &p
+	it.field = field
+	it.limit = p.Limit
+	return it
+}
+
 func (it *Iterator) makeIterator() DocIterator {
+	if it.pipe != nil {
+		return it.qs.db.(Aggregator).Aggregate(it.collection, *it.pipe)
+	}
 	q := it.qs.db.Query(it.collection)
 	if len(it.constraint) != 0 {
 		q = q.WithFields(it.constraint...)
@@ -111,7 +118,9 @@ func (it *Iterator) TagResults(dst map[string]graph.Value) {
 
 func (it *Iterator) Clone() graph.Iterator {
 	var m *Iterator
-	if len(it.links) == 0 {
+	if it.pipe != nil {
+		m = NewPipelineIterator(it.qs, it.collection, *it.pipe, it.field)
+	} else if len(it.links) == 0 {
 		m = NewIterator(it.qs, it.collection, it.constraint...)
 	} else {
 		m = NewLinksToIterator(it.qs, it.collection, it.links)
@@ -121,6 +130,9 @@ func (it *Iterator) Clone() graph.Iterator {
 }
 
 func (it *Iterator) Next(ctx context.Context) bool {
+	if !graph.ScanPrimitive(ctx) {
+		return false
+	}
 	if it.iter == nil {
 		it.iter = it.makeIterator()
 	}
@@ -137,16 +149,18 @@ func (it *Iterator) Next(ctx context.Context) bool {
 		if it.collection == colQuads && !checkQuadValid(doc) {
 			continue
 		}
+		if it.field != "" {
+			if _, ok := doc[it.field].(String); !ok {
+				continue
+			}
+		}
 		break
 	}
-	if it.collection == colQuads {
-		sh, _ := doc[fldSubject].(String)
-		ph, _ := doc[fldPredicate].(String)
-		oh, _ := doc[fldObject].(String)
-		lh, _ := doc[fldLabel].(String)
-		it.result = QuadHash{
-			string(sh), string(ph), string(oh), string(lh),
-		}
+	if it.field != "" {
+		h, _ := doc[it.field].(String)
+		it.result = NodeHash(h)
+	} else if it.collection == colQuads {
+		it.result = quadHashOf(doc)
 	} else {
 		id, _ := doc[fldHash].(String)
 		it.result = NodeHash(id)
@@ -154,6 +168,16 @@ func (it *Iterator) Next(ctx context.Context) bool {
 	return true
 }
 
+func quadHashOf(doc Document) QuadHash {
+	sh, _ := doc[fldSubject].(String)
+	ph, _ := doc[fldPredicate].(String)
+	oh, _ := doc[fldObject].(String)
+	lh, _ := doc[fldLabel].(String)
+	return QuadHash{
+		string(sh), string(ph), string(oh), string(lh),
+	}
+}
+
 func (it *Iterator) Err() error {
 	return it.err
 }
@@ -171,6 +195,12 @@ func (it *Iterator) SubIterators() []graph.Iterator {
 }
 
 func (it *Iterator) Contains(ctx context.Context, v graph.Value) bool {
+	if !graph.ScanPrimitive(ctx) {
+		return false
+	}
+	if it.pipe != nil {
+		return it.containsPipe(ctx, v)
+	}
 	if len(it.links) != 0 {
 		qh := v.(QuadHash)
 		for _, l := range it.links {
@@ -199,6 +229,62 @@ func (it *Iterator) Contains(ctx context.Context, v graph.Value) bool {
 	return true
 }
 
+// containsPipe checks if the value is in results of the pipeline by running it with additional filters.
+func (it *Iterator) containsPipe(ctx context.Context, v graph.Value) bool {
+	p := *it.pipe
+	p.Filters = append([]FieldFilter{}, p.Filters...)
+	p.Limit = 0
+	var match func(d Document) bool
+	switch {
+	case it.field != "":
+		h, ok := v.(NodeHash)
+		if !ok {
+			return false
+		}
+		p.Filters = append(p.Filters, FieldFilter{
+			Path: []string{it.field}, Filter: Equal, Value: String(h),
+		})
+		p.Limit = 1
+	case it.collection == colQuads:
+		qh, ok := v.(QuadHash)
+		if !ok {
+			return false
+		}
+		for _, d := range quad.Directions {
+			if h := qh.Get(d); h != "" {
+				p.Filters = append(p.Filters, FieldFilter{
+					Path: []string{d.String()}, Filter: Equal, Value: String(h),
+				})
+			}
+		}
+		// quads without a label cannot be selected by a filter
+		match = func(d Document) bool {
+			return checkQuadValid(d) && quadHashOf(d) == qh
+		}
+	default:
+		h, ok := v.(NodeHash)
+		if !ok {
+			return false
+		}
+		p.Filters = append(p.Filters, FieldFilter{
+			Path: []string{fldHash}, Filter: Equal, Value: String(h),
+		})
+		p.Limit = 1
+	}
+	dit := it.qs.db.(Aggregator).Aggregate(it.collection, p)
+	defer dit.Close()
+	for dit.Next(ctx) {
+		if match == nil || match(dit.Doc()) {
+			it.result = v
+			return true
+		}
+	}
+	if err := dit.Err(); err != nil {
+		it.err = err
+	}
+	return false
+}
+
 func (it *Iterator) Size() (int64, bool) {
 	if it.size == -1 {
 		var err error
@@ -210,17 +296,18 @@ func (it *Iterator) Size() (int64, bool) {
 	if it.limit > 0 && it.size > it.limit {
 		it.size = it.limit
 	}
-	return it.size, true
+	// pipeline size is estimated from its first stage only
+	return it.size, it.pipe == nil
 }
 
 func (it *Iterator) Type() graph.Type {
-	if len(it.constraint) == 0 {
+	if len(it.constraint) == 0 && it.pipe == nil {
 		return graph.All
 	}
 	return "nosql"
 }
 
-func (it *Iterator) Sorted() bool                     { return true }
+func (it *Iterator) Sorted() bool                     { return it.pipe == nil }
 func (it *Iterator) Optimize() (graph.Iterator, bool) { return it, false }
 
 func (it *Iterator) String() string {
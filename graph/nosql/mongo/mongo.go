@@ -4,6 +4,7 @@ import (
 	"context"
 	"encoding/base64"
 	"fmt"
+	"regexp"
 	"strings"
 	"time"
 
@@ -18,6 +19,8 @@ const Type = "mongo"
 
 var (
 	_ nosql.BatchInserter = (*DB)(nil)
+	_ nosql.Aggregator    = (*DB)(nil)
+	_ nosql.TextSearcher  = (*DB)(nil)
 )
 
 func init() {
@@ -111,8 +114,15 @@ func (db *DB) EnsureIndex(ctx context.Context, col string, primary nosql.Index,
 		}
 	}
 	for _, ind := range secondary {
+		key := []string(ind.Fields)
+		if ind.Type == nosql.StringFulltext {
+			key = make([]string, 0, len(ind.Fields))
+			for _, f := range ind.Fields {
+				key = append(key, "$text:"+f)
+			}
+		}
 		err := c.EnsureIndex(mgo.Index{
-			Key:        []string(ind.Fields),
+			Key:        key,
 			Unique:     false,
 			Background: true,
 			Sparse:     true,
@@ -313,6 +323,31 @@ func (db *DB) FindByKey(ctx context.Context, col string, key nosql.Key) (nosql.D
 	}
 	return c.convDoc(m), nil
 }
+func (db *DB) FindByKeys(ctx context.Context, col string, keys []nosql.Key) ([]nosql.Document, error) {
+	c := db.colls[col]
+	ids := make([]string, 0, len(keys))
+	for _, k := range keys {
+		ids = append(ids, compKey(k))
+	}
+	var res []bson.M
+	err := c.c.Find(bson.M{idField: bson.M{"$in": ids}}).All(&res)
+	if err != nil {
+		return nil, err
+	}
+	byID := make(map[string]bson.M, len(res))
+	for _, m := range res {
+		if id, ok := m[idField].(string); ok {
+			byID[id] = m
+		}
+	}
+	out := make([]nosql.Document, len(keys))
+	for i, id := range ids {
+		if m, ok := byID[id]; ok {
+			out[i] = c.convDoc(m)
+		}
+	}
+	return out, nil
+}
 func (db *DB) Query(col string) nosql.Query {
 	c := db.colls[col]
 	return &Query{c: &c}
@@ -344,10 +379,26 @@ func buildFilters(filters []nosql.FieldFilter) bson.M {
 			mf = bson.M{"$lt": v}
 		case nosql.LTE:
 			mf = bson.M{"$lte": v}
+		case nosql.Prefix:
+			s, ok := f.Value.(nosql.String)
+			if !ok {
+				panic(fmt.Errorf("prefix filter on non-string value: %T", f.Value))
+			}
+			mf = bson.M{"$regex": "^" + regexp.QuoteMeta(string(s))}
 		default:
 			panic(fmt.Errorf("unsupported filter: %v", f.Filter))
 		}
-		m[strings.Join(f.Path, ".")] = mf
+		name := strings.Join(f.Path, ".")
+		if prev, ok := m[name].(bson.M); ok {
+			// multiple operators on the same field, like a range
+			if cur, ok := mf.(bson.M); ok {
+				for k, v := range cur {
+					prev[k] = v
+				}
+				continue
+			}
+		}
+		m[name] = mf
 	}
 	return m
 }
@@ -408,14 +459,21 @@ func (q *Query) Iterate() nosql.DocIterator {
 }
 
 type Iterator struct {
-	c   *collection
-	it  *mgo.Iter
-	res bson.M
+	c    *collection
+	it   *mgo.Iter
+	res  bson.M
+	drop []string // fields added by the pipeline
 }
 
 func (it *Iterator) Next(ctx context.Context) bool {
 	it.res = make(bson.M)
-	return it.it.Next(&it.res)
+	if !it.it.Next(&it.res) {
+		return false
+	}
+	for _, f := range it.drop {
+		delete(it.res, f)
+	}
+	return true
 }
 func (it *Iterator) Err() error {
 	return it.it.Err()
@@ -430,6 +488,107 @@ func (it *Iterator) Doc() nosql.Document {
 	return it.c.convDoc(it.res)
 }
 
+// fieldName returns the name of the field in the collection, accounting for renamed primary key.
+func (c *collection) fieldName(path []string) string {
+	if !c.compPK && len(path) == 1 && path[0] == c.primary.Fields[0] {
+		return idField
+	}
+	return strings.Join(path, ".")
+}
+
+func (c *collection) buildFilters(filters []nosql.FieldFilter) bson.M {
+	m := buildFilters(filters)
+	if !c.compPK {
+		if v, ok := m[c.primary.Fields[0]]; ok {
+			delete(m, c.primary.Fields[0])
+			m[idField] = v
+		}
+	}
+	return m
+}
+
+func (c *collection) buildCompare(f nosql.FieldCompare) bson.M {
+	var op string
+	switch f.Filter {
+	case nosql.Equal:
+		op = "$eq"
+	case nosql.NotEqual:
+		op = "$ne"
+	case nosql.GT:
+		op = "$gt"
+	case nosql.GTE:
+		op = "$gte"
+	case nosql.LT:
+		op = "$lt"
+	case nosql.LTE:
+		op = "$lte"
+	default:
+		panic(fmt.Errorf("unsupported filter: %v", f.Filter))
+	}
+	// missing fields are treated as zero
+	field := func(path []string) bson.M {
+		return bson.M{"$ifNull": []interface{}{"$" + c.fieldName(path), 0}}
+	}
+	return bson.M{op: []interface{}{field(f.Left), field(f.Right)}}
+}
+
+// Aggregate runs the pipeline as a single aggregation query using $match, $lookup and $limit stages.
+func (db *DB) Aggregate(col string, p nosql.Pipeline) nosql.DocIterator {
+	c := db.colls[col]
+	var (
+		stages []bson.M
+		drop   []string
+	)
+	if len(p.Filters) != 0 {
+		stages = append(stages, bson.M{"$match": c.buildFilters(p.Filters)})
+	}
+	for _, f := range p.Compare {
+		stages = append(stages, bson.M{"$redact": bson.M{"$cond": bson.M{
+			"if": c.buildCompare(f), "then": "$$KEEP", "else": "$$PRUNE",
+		}}})
+	}
+	for i, l := range p.Lookups {
+		jc := db.colls[l.Collection]
+		as := fmt.Sprintf("_lookup%d", i)
+		stages = append(stages, bson.M{"$lookup": bson.M{
+			"from":         l.Collection,
+			"localField":   c.fieldName(l.Local),
+			"foreignField": jc.fieldName(l.Foreign),
+			"as":           as,
+		}})
+		// foreign documents are matched by a key, thus there is at most one of them
+		var match interface{} = bson.M{"$ne": []interface{}{}}
+		if len(l.Filters) != 0 {
+			match = bson.M{"$elemMatch": jc.buildFilters(l.Filters)}
+		}
+		stages = append(stages, bson.M{"$match": bson.M{as: match}})
+		drop = append(drop, as)
+	}
+	if p.Limit > 0 {
+		stages = append(stages, bson.M{"$limit": p.Limit})
+	}
+	if len(stages) == 0 {
+		// empty pipeline is not allowed
+		stages = append(stages, bson.M{"$match": bson.M{}})
+	}
+	it := c.c.Pipe(stages).AllowDiskUse().Iter()
+	return &Iterator{it: it, c: &c, drop: drop}
+}
+
+// SearchText implements nosql.TextSearcher using a $text query. Field is ignored, since MongoDB
+// allows only one text index per collection.
+func (db *DB) SearchText(ctx context.Context, col string, field []string, query string, limit int) nosql.DocIterator {
+	c := db.colls[col]
+	const score = "_score"
+	q := c.c.Find(bson.M{"$text": bson.M{"$search": query}}).
+		Select(bson.M{score: bson.M{"$meta": "textScore"}}).
+		Sort("$textScore:" + score)
+	if limit > 0 {
+		q = q.Limit(limit)
+	}
+	return &Iterator{it: q.Iter(), c: &c, drop: []string{score}}
+}
+
 type Delete struct {
 	col   *collection
 	query bson.M
@@ -37,3 +37,9 @@ func TestMongo(t *testing.T) {
 		TimeInMs: true,
 	})
 }
+
+func BenchmarkMongo(b *testing.B) {
+	nosqltest.BenchmarkAll(b, makeMongo, &nosqltest.Config{
+		TimeInMs: true,
+	})
+}
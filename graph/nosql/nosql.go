@@ -4,6 +4,7 @@ import (
 	"context"
 	"errors"
 	"fmt"
+	"strings"
 
 	"github.com/pborman/uuid"
 )
@@ -57,6 +58,50 @@ type Database interface {
 	Close() error
 }
 
+// BatchFinder is an optional interface for databases that can find multiple documents in a single request.
+type BatchFinder interface {
+	// FindByKeys finds documents by their keys. Documents that do not exist are returned as nil.
+	FindByKeys(ctx context.Context, col string, keys []Key) ([]Document, error)
+}
+
+// TextSearcher is an optional interface for databases with a full-text search.
+type TextSearcher interface {
+	// SearchText finds documents with a field matching a full-text query, most relevant documents first.
+	// The field must be covered by the StringFulltext index. Zero or negative limit means no limit.
+	SearchText(ctx context.Context, col string, field []string, query string, limit int) DocIterator
+}
+
+// Lookup is a pipeline stage that joins documents from another collection.
+// A document passes this stage only if at least one joined document matches all filters.
+type Lookup struct {
+	Collection string        // collection to join with
+	Local      []string      // path to a field of the current document
+	Foreign    []string      // path to a field of the joined document
+	Filters    []FieldFilter // filters for joined documents
+}
+
+// FieldCompare compares two fields of the same document. Missing fields are treated as zero.
+type FieldCompare struct {
+	Left   []string // path to the first field
+	Filter FilterOp // comparison operation
+	Right  []string // path to the second field
+}
+
+// Pipeline is a multi-stage query that is executed on the database side.
+type Pipeline struct {
+	Filters []FieldFilter  // filters to select documents
+	Compare []FieldCompare // comparisons between fields of selected documents
+	Lookups []Lookup       // joins with other collections, applied after filters
+	Limit   int64          // limits a number of documents
+}
+
+// Aggregator is an optional interface for databases that can execute query pipelines.
+type Aggregator interface {
+	// Aggregate runs a pipeline on the collection and returns documents that passed all the stages.
+	// Documents are returned as-is, without joined documents.
+	Aggregate(col string, p Pipeline) DocIterator
+}
+
 // FilterOp is a comparison operation type used for value filters.
 type FilterOp int
 
@@ -75,6 +120,8 @@ func (op FilterOp) String() string {
 		name = "LT"
 	case LTE:
 		name = "LTE"
+	case Prefix:
+		name = "Prefix"
 	default:
 		return fmt.Sprintf("FilterOp(%d)", int(op))
 	}
@@ -91,6 +138,7 @@ const (
 	GTE
 	LT
 	LTE
+	Prefix // string value starts with a given prefix
 )
 
 // FieldFilter represents a single field comparison operation.
@@ -146,6 +194,10 @@ func (f FieldFilter) Matches(d Document) bool {
 		case LTE:
 			return dn <= 0
 		}
+	case Prefix:
+		s, ok := val.(String)
+		p, ok2 := f.Value.(String)
+		return ok && ok2 && strings.HasPrefix(string(s), string(p))
 	}
 	panic(fmt.Errorf("unsupported operation: %v", f.Filter))
 }
@@ -260,10 +312,10 @@ type BatchInserter interface {
 type IndexType int
 
 const (
-	IndexAny    = IndexType(iota)
-	StringExact // exact match for string values (usually a hash index)
+	IndexAny       = IndexType(iota)
+	StringExact    // exact match for string values (usually a hash index)
+	StringFulltext // full-text index for string values
 
-	//StringFulltext
 	//IntIndex
 	//FloatIndex
 	//TimeIndex
@@ -83,6 +83,15 @@ func TestAll(t *testing.T, gen DatabaseFunc, conf *Config) {
 	})
 }
 
+func BenchmarkAll(b *testing.B, gen DatabaseFunc, conf *Config) {
+	if conf == nil {
+		conf = &Config{}
+	}
+	graphtest.BenchmarkAll(b, func(t testing.TB) (graph.QuadStore, graph.Options, func()) {
+		return NewQuadStore(t, gen)
+	}, conf.quadStore())
+}
+
 func randString() string {
 	const n = 60
 	b := bytes.NewBuffer(nil)
@@ -22,6 +22,8 @@ import (
 
 	"github.com/cayleygraph/cayley/clog"
 	"github.com/cayleygraph/cayley/graph"
+	"github.com/cayleygraph/cayley/graph/gc"
+	"github.com/cayleygraph/cayley/graph/stats"
 	"github.com/cayleygraph/cayley/internal/lru"
 	"github.com/cayleygraph/cayley/quad"
 	"github.com/cayleygraph/cayley/quad/pquads"
@@ -76,14 +78,24 @@ func Init(db Database, opt graph.Options) error {
 }
 
 func New(db Database, opt graph.Options) (graph.QuadStore, error) {
+	gcOpt, err := gc.OptionsFrom(opt)
+	if err != nil {
+		return nil, err
+	}
 	if err := ensureIndexes(context.TODO(), db); err != nil {
 		return nil, err
 	}
+	cache, err := graph.ValueCacheFrom(opt, 1<<16)
+	if err != nil {
+		return nil, err
+	}
 	qs := &QuadStore{
 		db:    db,
-		ids:   lru.New(1 << 16),
+		ids:   cache,
 		sizes: lru.New(1 << 16),
 	}
+	qs.stats = stats.NewSampler(qs, 0, 0)
+	qs.gc = gc.New(qs, gcOpt)
 	return qs, nil
 }
 
@@ -143,12 +155,26 @@ const (
 	fldValPb    = "pb"
 )
 
+var _ graph.BatchResolver = (*QuadStore)(nil)
+
+// backendName is used in errors returned by the database. See graph.BackendError.
+const backendName = "nosql"
+
 type QuadStore struct {
 	db    Database
-	ids   *lru.Cache
+	ids   *graph.ValueCache
 	sizes *lru.Cache
+	stats *stats.Sampler
+	gc    *gc.Collector
 }
 
+var (
+	_ gc.Sweeper       = (*QuadStore)(nil)
+	_ graph.Maintainer = (*QuadStore)(nil)
+
+	_ graph.FeatureReporter = (*QuadStore)(nil)
+)
+
 func ensureIndexes(ctx context.Context, db Database) error {
 	err := db.EnsureIndex(ctx, colLog, Index{
 		Fields: []string{fldLogID},
@@ -157,10 +183,16 @@ func ensureIndexes(ctx context.Context, db Database) error {
 	if err != nil {
 		return err
 	}
+	var nodeIndexes []Index
+	if _, ok := db.(TextSearcher); ok {
+		nodeIndexes = append(nodeIndexes, Index{
+			Fields: []string{fldValue + "." + fldValData}, Type: StringFulltext,
+		})
+	}
 	err = db.EnsureIndex(ctx, colNodes, Index{
 		Fields: []string{fldHash},
 		Type:   StringExact,
-	}, nil)
+	}, nodeIndexes)
 	if err != nil {
 		return err
 	}
@@ -302,8 +334,14 @@ func (qs *QuadStore) appendLog(ctx context.Context, deltas []graph.Delta) ([]Key
 	return w.Keys(), err
 }
 
+// ApplyDeltas applies changes to the database. Errors of the database are wrapped into graph.BackendError.
 func (qs *QuadStore) ApplyDeltas(deltas []graph.Delta, ignoreOpts graph.IgnoreOpts) error {
+	return graph.WrapBackend(backendName, qs.applyDeltas(deltas, ignoreOpts))
+}
+
+func (qs *QuadStore) applyDeltas(deltas []graph.Delta, ignoreOpts graph.IgnoreOpts) error {
 	ctx := context.TODO()
+	defer qs.stats.Invalidate()
 	ids := make(map[quad.Value]int)
 	// Pre-check the existence condition.
 	for _, d := range deltas {
@@ -368,15 +406,86 @@ func (qs *QuadStore) ApplyDeltas(deltas []graph.Delta, ignoreOpts graph.IgnoreOp
 	if err := qs.cleanupNodes(ctx, gc); err != nil {
 		return err
 	}
+	deleted := 0
 	for _, d := range deltas {
 		err := qs.updateQuad(ctx, d.Quad, d.Action)
 		if err != nil {
 			return &graph.DeltaError{Delta: d, Err: err}
 		}
+		if d.Action == graph.Delete {
+			deleted++
+		}
 	}
+	// deleted quads are only marked, and nodes might be left
+	// with zero references by concurrent writes; collect them later
+	qs.gc.Deleted(deleted)
 	return nil
 }
 
+// Sweep removes documents of deleted quads and nodes with no references left.
+// It is called periodically in background after quads are deleted.
+func (qs *QuadStore) Sweep(ctx context.Context) (int64, error) {
+	defer qs.stats.Invalidate()
+	var n int64
+	it := qs.db.Query(colQuads).WithFields(FieldFilter{
+		Path:   []string{fldQuadDeleted},
+		Filter: GTE,
+		Value:  Int(1),
+	}).Iterate()
+	defer it.Close()
+	for it.Next(ctx) {
+		doc := it.Doc()
+		added, ok1 := doc[fldQuadAdded].(Int)
+		deleted, ok2 := doc[fldQuadDeleted].(Int)
+		if !ok1 || !ok2 || added > deleted {
+			continue
+		}
+		// quad might be added again concurrently, thus
+		// delete it only if counters are still the same
+		err := qs.db.Delete(colQuads).Keys(it.Key()).WithFields(
+			FieldFilter{Path: []string{fldQuadAdded}, Filter: Equal, Value: added},
+			FieldFilter{Path: []string{fldQuadDeleted}, Filter: Equal, Value: deleted},
+		).Do(ctx)
+		if err != nil {
+			return n, fmt.Errorf("error removing deleted quads: %v", err)
+		}
+		n++
+	}
+	if err := it.Err(); err != nil {
+		return n, err
+	}
+	unused := FieldFilter{
+		Path:   []string{fldSize},
+		Filter: LTE,
+		Value:  Int(0),
+	}
+	nodes, err := qs.db.Query(colNodes).WithFields(unused).Count(ctx)
+	if err != nil {
+		return n, err
+	} else if nodes == 0 {
+		return n, nil
+	}
+	err = qs.db.Delete(colNodes).WithFields(unused).Do(ctx)
+	if err != nil {
+		return n, fmt.Errorf("error cleaning up nodes: %v", err)
+	}
+	return n + nodes, nil
+}
+
+// Features returns capabilities of the store. Deltas are not applied atomically.
+func (qs *QuadStore) Features() graph.Features {
+	return graph.Features{
+		NodeGC:     true,
+		Compaction: true,
+	}
+}
+
+// Compact removes deleted quads and unused nodes immediately.
+func (qs *QuadStore) Compact(ctx context.Context) error {
+	_, err := qs.gc.Sweep(ctx)
+	return err
+}
+
 func toDocumentValue(v quad.Value) Document {
 	if v == nil {
 		return nil
@@ -391,6 +500,8 @@ func toDocumentValue(v quad.Value) Document {
 		doc = Document{fldValData: String(d), fldBNode: Bool(true)}
 	case quad.TypedString:
 		doc = Document{fldValData: String(d.Value), fldType: String(d.Type)}
+	case quad.Vector:
+		return toDocumentValue(d.TypedString())
 	case quad.LangString:
 		doc = Document{fldValData: String(d.Value), fldLang: String(d.Lang)}
 	case quad.Int:
@@ -494,7 +605,11 @@ func toQuadValue(d Document) (quad.Value, error) {
 	} else if ok, _ := d[fldBNode].(Bool); ok {
 		return quad.BNode(vs), nil
 	} else if typ, ok := d[fldType].(String); ok {
-		return quad.TypedString{Value: quad.String(vs), Type: quad.IRI(typ)}, nil
+		ts := quad.TypedString{Value: quad.String(vs), Type: quad.IRI(typ)}
+		if ts.Type == quad.VectorType {
+			return ts.ParseValue()
+		}
+		return ts, nil
 	} else if typ, ok := d[fldLang].(String); ok {
 		return quad.LangString{Value: quad.String(vs), Lang: string(typ)}, nil
 	}
@@ -502,13 +617,29 @@ func toQuadValue(d Document) (quad.Value, error) {
 }
 
 func (qs *QuadStore) Quad(val graph.Value) quad.Quad {
+	q, err := qs.QuadContext(context.TODO(), val)
+	if err != nil {
+		clog.Errorf("couldn't retrieve quad %v: %v", val, err)
+	}
+	return q
+}
+
+// QuadContext loads all values of the quad in a single query.
+func (qs *QuadStore) QuadContext(ctx context.Context, val graph.Value) (quad.Quad, error) {
 	h := val.(QuadHash)
-	return quad.Quad{
-		Subject:   qs.NameOf(NodeHash(h.Get(quad.Subject))),
-		Predicate: qs.NameOf(NodeHash(h.Get(quad.Predicate))),
-		Object:    qs.NameOf(NodeHash(h.Get(quad.Object))),
-		Label:     qs.NameOf(NodeHash(h.Get(quad.Label))),
+	refs := make([]graph.Value, len(quad.Directions))
+	for i, d := range quad.Directions {
+		refs[i] = NodeHash(h.Get(d))
 	}
+	vals, err := qs.NamesOf(ctx, refs)
+	if err != nil {
+		return quad.Quad{}, err
+	}
+	var q quad.Quad
+	for i, d := range quad.Directions {
+		q.Set(d, vals[i])
+	}
+	return q, nil
 }
 
 func (qs *QuadStore) QuadIterator(d quad.Direction, val graph.Value) graph.Iterator {
@@ -534,39 +665,196 @@ func (qs *QuadStore) ValueOf(s quad.Value) graph.Value {
 	return qs.hashOf(s)
 }
 
+var _ graph.ContextQuadStore = (*QuadStore)(nil)
+
+// ValueOfContext is the same as ValueOf. It never queries the database.
+func (qs *QuadStore) ValueOfContext(ctx context.Context, s quad.Value) (graph.Value, error) {
+	return qs.ValueOf(s), nil
+}
+
 func (qs *QuadStore) NameOf(v graph.Value) quad.Value {
+	qv, err := qs.NameOfContext(context.TODO(), v)
+	if err != nil {
+		clog.Errorf("couldn't retrieve node %v: %v", v, err)
+	}
+	return qv
+}
+
+// NameOfContext is the same as NameOf, but it returns errors and stops when the context is cancelled.
+func (qs *QuadStore) NameOfContext(ctx context.Context, v graph.Value) (quad.Value, error) {
 	if v == nil {
-		return nil
+		return nil, nil
 	} else if v, ok := v.(graph.PreFetchedValue); ok {
-		return v.NameOf()
+		return v.NameOf(), nil
 	}
 	hash := v.(NodeHash)
 	if hash == "" {
-		return nil
+		return nil, nil
 	}
-	if val, ok := qs.ids.Get(string(hash)); ok {
-		return val.(quad.Value)
+	if val, ok := qs.ids.NameOf(string(hash)); ok {
+		return val, nil
 	}
-	nd, err := qs.db.FindByKey(context.TODO(), colNodes, hash.key())
+	nd, err := qs.db.FindByKey(ctx, colNodes, hash.key())
+	if err == ErrNotFound {
+		return nil, nil
+	} else if err != nil {
+		return nil, graph.WrapBackend(backendName, err)
+	}
+	qv, err := qs.nodeValue(hash, nd)
 	if err != nil {
-		clog.Errorf("couldn't retrieve node %v: %v", v, err)
-		return nil
+		return nil, fmt.Errorf("couldn't convert node %v: %v", v, err)
 	}
+	return qv, nil
+}
+
+// nodeValue converts a node document to a value and caches it.
+func (qs *QuadStore) nodeValue(hash NodeHash, nd Document) (quad.Value, error) {
 	dv, _ := nd[fldValue].(Document)
 	qv, err := toQuadValue(dv)
 	if err != nil {
-		clog.Errorf("couldn't convert node %v: %v", v, err)
-		return nil
+		return nil, err
 	}
 	if id, _ := nd[fldHash].(String); id == String(hash) && qv != nil {
-		qs.ids.Put(string(hash), qv)
+		qs.ids.PutName(string(hash), qv)
 	}
-	return qv
+	return qv, nil
+}
+
+// RefsOf returns hashes for a set of values. It never queries the database.
+func (qs *QuadStore) RefsOf(ctx context.Context, vals []quad.Value) ([]graph.Value, error) {
+	out := make([]graph.Value, len(vals))
+	for i, v := range vals {
+		out[i] = qs.ValueOf(v)
+	}
+	return out, nil
+}
+
+var _ graph.TextIndexer = (*QuadStore)(nil)
+
+// IndexText implements graph.TextIndexer. It does nothing, since values are indexed by the database.
+// It returns graph.ErrTextSearchNotSupported if database has no full-text search.
+func (qs *QuadStore) IndexText(ctx context.Context, vals []quad.Value) error {
+	if _, ok := qs.db.(TextSearcher); !ok {
+		return graph.ErrTextSearchNotSupported
+	}
+	return nil
+}
+
+// SearchText implements graph.TextIndexer using a full-text search provided by the database.
+func (qs *QuadStore) SearchText(ctx context.Context, query string, offset, limit int) ([]quad.Value, error) {
+	ts, ok := qs.db.(TextSearcher)
+	if !ok {
+		return nil, graph.ErrTextSearchNotSupported
+	}
+	// documents are streamed and filtered here, thus the database cannot apply offset and limit
+	it := ts.SearchText(ctx, colNodes, []string{fldValue, fldValData}, query, 0)
+	defer it.Close()
+	var out []quad.Value
+	for (limit <= 0 || len(out) < limit) && it.Next(ctx) {
+		var hash NodeHash
+		if key := it.Key(); len(key) != 0 {
+			hash = NodeHash(key[0])
+		}
+		qv, err := qs.nodeValue(hash, it.Doc())
+		if err != nil {
+			return out, err
+		}
+		// text index covers IRIs and blank nodes as well
+		if !graph.IsTextValue(qv) {
+			continue
+		} else if offset > 0 {
+			offset--
+			continue
+		}
+		out = append(out, qv)
+	}
+	return out, it.Err()
+}
+
+// maxBatchSize is the maximal number of nodes resolved by a single request.
+const maxBatchSize = 100
+
+// NamesOf resolves values for a set of hashes. If the database implements BatchFinder,
+// up to maxBatchSize nodes are loaded in a single request.
+func (qs *QuadStore) NamesOf(ctx context.Context, refs []graph.Value) ([]quad.Value, error) {
+	out := make([]quad.Value, len(refs))
+	var (
+		hashes []NodeHash
+		inds   = make(map[NodeHash][]int)
+	)
+	for i, v := range refs {
+		var hash NodeHash
+		switch h := v.(type) {
+		case nil:
+			continue
+		case graph.PreFetchedValue:
+			out[i] = h.NameOf()
+			continue
+		case NodeHash:
+			hash = h
+		default:
+			return out, fmt.Errorf("unexpected token: %T", v)
+		}
+		if hash == "" {
+			continue
+		} else if val, ok := qs.ids.NameOf(string(hash)); ok {
+			out[i] = val
+			continue
+		}
+		if _, ok := inds[hash]; !ok {
+			hashes = append(hashes, hash)
+		}
+		inds[hash] = append(inds[hash], i)
+	}
+	bf, batch := qs.db.(BatchFinder)
+	for len(hashes) != 0 {
+		n := 1
+		if batch {
+			n = maxBatchSize
+		}
+		if n > len(hashes) {
+			n = len(hashes)
+		}
+		cur := hashes[:n]
+		hashes = hashes[n:]
+		docs := make([]Document, len(cur))
+		if batch {
+			keys := make([]Key, 0, len(cur))
+			for _, h := range cur {
+				keys = append(keys, h.key())
+			}
+			var err error
+			docs, err = bf.FindByKeys(ctx, colNodes, keys)
+			if err != nil {
+				return out, err
+			}
+		} else {
+			nd, err := qs.db.FindByKey(ctx, colNodes, cur[0].key())
+			if err == ErrNotFound {
+				continue
+			} else if err != nil {
+				return out, err
+			}
+			docs[0] = nd
+		}
+		for i, nd := range docs {
+			if nd == nil {
+				continue
+			}
+			qv, err := qs.nodeValue(cur[i], nd)
+			if err != nil {
+				return out, err
+			}
+			for _, j := range inds[cur[i]] {
+				out[j] = qv
+			}
+		}
+	}
+	return out, nil
 }
 
 func (qs *QuadStore) Size() int64 {
-	// TODO(barakmich): Make size real; store it in the log, and retrieve it.
-	count, err := qs.db.Query(colQuads).Count(context.TODO())
+	count, err := qs.SizeContext(context.TODO())
 	if err != nil {
 		clog.Errorf("%v", err)
 		return 0
@@ -574,7 +862,15 @@ func (qs *QuadStore) Size() int64 {
 	return count
 }
 
+// SizeContext is the same as Size, but it returns errors and stops when the context is cancelled.
+func (qs *QuadStore) SizeContext(ctx context.Context) (int64, error) {
+	// TODO(barakmich): Make size real; store it in the log, and retrieve it.
+	n, err := qs.db.Query(colQuads).Count(ctx)
+	return n, graph.WrapBackend(backendName, err)
+}
+
 func (qs *QuadStore) Close() error {
+	qs.gc.Close()
 	return qs.db.Close()
 }
 
@@ -582,6 +878,12 @@ func (qs *QuadStore) QuadDirection(in graph.Value, d quad.Direction) graph.Value
 	return NodeHash(in.(QuadHash).Get(d))
 }
 
+// QuadsWith returns an estimated number of quads with a given value in the specified direction.
+// Estimates are sampled from the database and cached until the next write.
+func (qs *QuadStore) QuadsWith(d quad.Direction, v graph.Value) (int64, bool) {
+	return qs.stats.QuadsWith(d, v)
+}
+
 func (qs *QuadStore) getSize(col string, constraints []FieldFilter) (int64, error) {
 	cacheKey := ""
 	for _, c := range constraints { // FIXME
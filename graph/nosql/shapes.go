@@ -2,6 +2,7 @@ package nosql
 
 import (
 	"fmt"
+	"reflect"
 
 	"github.com/cayleygraph/cayley/graph"
 	"github.com/cayleygraph/cayley/graph/iterator"
@@ -19,6 +20,10 @@ func (qs *QuadStore) OptimizeShape(s shape.Shape) (shape.Shape, bool) {
 	switch s := s.(type) {
 	case shape.Quads:
 		return qs.optimizeQuads(s)
+	case shape.NodesFrom:
+		return qs.optimizeNodesFrom(s)
+	case shape.Intersect:
+		return qs.optimizeIntersect(s)
 	case shape.Filter:
 		return qs.optimizeFilter(s)
 	case shape.Page:
@@ -68,6 +73,69 @@ func (s Quads) Optimize(r shape.Optimizer) (shape.Shape, bool) {
 	return s, false
 }
 
+// Aggregate is a shape representing a query pipeline that is executed by the database.
+// Database must implement Aggregator.
+type Aggregate struct {
+	Collection string   // name of the collection
+	Pipeline   Pipeline // stages of the query
+	Field      string   // if set, shape returns nodes referenced by this field of each document
+}
+
+func (s Aggregate) BuildIterator(qs graph.QuadStore) graph.Iterator {
+	db, ok := qs.(*QuadStore)
+	if !ok {
+		return iterator.NewError(fmt.Errorf("not a nosql database: %T", qs))
+	}
+	return NewPipelineIterator(db, s.Collection, s.Pipeline, s.Field)
+}
+
+func (s Aggregate) Optimize(r shape.Optimizer) (shape.Shape, bool) {
+	return s, false
+}
+
+// validQuads selects quads that were not deleted.
+var validQuads = []FieldCompare{
+	{Left: []string{fldQuadAdded}, Filter: GT, Right: []string{fldQuadDeleted}},
+}
+
+func linkFilters(links []Linkage) []FieldFilter {
+	filters := make([]FieldFilter, 0, len(links))
+	for _, l := range links {
+		filters = append(filters, FieldFilter{
+			Path:   []string{l.Dir.String()},
+			Filter: Equal,
+			Value:  String(l.Val),
+		})
+	}
+	return filters
+}
+
+// nodeLookup joins nodes referenced by a given field and filters them.
+func nodeLookup(field string, filters []FieldFilter) Lookup {
+	return Lookup{
+		Collection: colNodes,
+		Local:      []string{field},
+		Foreign:    []string{fldHash},
+		Filters:    filters,
+	}
+}
+
+func (s Quads) pipeline() Aggregate {
+	return Aggregate{
+		Collection: colQuads,
+		Pipeline: Pipeline{
+			Filters: linkFilters(s.Links),
+			Compare: validQuads,
+			Limit:   s.Limit,
+		},
+	}
+}
+
+func (qs *QuadStore) canAggregate() bool {
+	_, ok := qs.db.(Aggregator)
+	return ok
+}
+
 func toFieldFilter(c shape.Comparison) ([]FieldFilter, bool) {
 	var op FilterOp
 	switch c.Op {
@@ -123,9 +191,6 @@ func toFieldFilter(c shape.Comparison) ([]FieldFilter, bool) {
 }
 
 func (qs *QuadStore) optimizeFilter(s shape.Filter) (shape.Shape, bool) {
-	if _, ok := s.From.(shape.AllNodes); !ok {
-		return s, false
-	}
 	var (
 		filters []FieldFilter
 		left    []shape.ValueFilter
@@ -137,24 +202,73 @@ func (qs *QuadStore) optimizeFilter(s shape.Filter) (shape.Shape, bool) {
 				filters = append(filters, fld...)
 				continue
 			}
+		case shape.StringMatch:
+			if f.Op == shape.StringPrefix && !f.Fold && f.Val != "" {
+				// the field is shared by all string-like values, so narrow the set down
+				// on the database side, but still check the value type with the filter
+				filters = append(filters, FieldFilter{
+					Path: []string{fldValue, fldValData}, Filter: Prefix, Value: String(f.Val),
+				})
+			}
 		}
 		left = append(left, f)
 	}
 	if len(filters) == 0 {
 		return s, false
 	}
-	var ns shape.Shape = Shape{Collection: colNodes, Filters: filters}
+	var ns shape.Shape
+	switch from := s.From.(type) {
+	case shape.AllNodes:
+		ns = Shape{Collection: colNodes, Filters: filters}
+	case Shape:
+		if from.Collection != colNodes || from.Limit != 0 {
+			return s, false
+		}
+		if filters = newFilters(from.Filters, filters); len(filters) == 0 {
+			// already applied by the previous pass
+			return s, false
+		}
+		from.Filters = append(from.Filters[:len(from.Filters):len(from.Filters)], filters...)
+		ns = from
+	case Aggregate:
+		// filter nodes returned by the pipeline with an additional join
+		if from.Field == "" || from.Pipeline.Limit != 0 {
+			return s, false
+		}
+		lk := from.Pipeline.Lookups
+		from.Pipeline.Lookups = append(lk[:len(lk):len(lk)], nodeLookup(from.Field, filters))
+		ns = from
+	default:
+		return s, false
+	}
 	if len(left) != 0 {
 		ns = shape.Filter{From: ns, Filters: left}
 	}
 	return ns, true
 }
 
+// newFilters returns filters that are not in the list yet.
+func newFilters(list, filters []FieldFilter) []FieldFilter {
+	var out []FieldFilter
+loop:
+	for _, f := range filters {
+		for _, f2 := range list {
+			if reflect.DeepEqual(f, f2) {
+				continue loop
+			}
+		}
+		out = append(out, f)
+	}
+	return out
+}
+
 func (qs *QuadStore) optimizeQuads(s shape.Quads) (shape.Shape, bool) {
 	var (
-		links []Linkage
-		left  []shape.QuadFilter
+		links   []Linkage
+		lookups []Lookup
+		left    []shape.QuadFilter
 	)
+	agg := qs.canAggregate()
 	for _, f := range s {
 		if v, ok := shape.One(f.Values); ok {
 			if h, ok := v.(NodeHash); ok {
@@ -162,16 +276,88 @@ func (qs *QuadStore) optimizeQuads(s shape.Quads) (shape.Shape, bool) {
 				continue
 			}
 		}
+		if ns, ok := f.Values.(Shape); ok && agg && ns.Collection == colNodes && ns.Limit == 0 {
+			// join filtered nodes on the database side instead of running a query per quad
+			lookups = append(lookups, nodeLookup(f.Dir.String(), ns.Filters))
+			continue
+		}
 		left = append(left, f)
 	}
-	if len(links) == 0 {
+	if len(links) == 0 && len(lookups) == 0 {
 		return s, false
 	}
 	var ns shape.Shape = Quads{Links: links}
+	if len(lookups) != 0 {
+		a := Quads{Links: links}.pipeline()
+		a.Pipeline.Lookups = lookups
+		ns = a
+	}
 	if len(left) != 0 {
 		ns = shape.Intersect{ns, shape.Quads(left)}
 	}
-	return s, true
+	return ns, true
+}
+
+func (qs *QuadStore) optimizeNodesFrom(s shape.NodesFrom) (shape.Shape, bool) {
+	if !qs.canAggregate() {
+		return s, false
+	}
+	var a Aggregate
+	switch q := s.Quads.(type) {
+	case Quads:
+		a = q.pipeline()
+	case Aggregate:
+		if q.Collection != colQuads || q.Field != "" {
+			return s, false
+		}
+		a = q
+	default:
+		return s, false
+	}
+	a.Field = s.Dir.String()
+	return a, true
+}
+
+// optimizeIntersect merges all node filters into a single query, or into a join of a pipeline that returns nodes.
+func (qs *QuadStore) optimizeIntersect(s shape.Intersect) (shape.Shape, bool) {
+	isNodes := func(c shape.Shape) bool {
+		ns, ok := c.(Shape)
+		return ok && ns.Collection == colNodes && ns.Limit == 0
+	}
+	var (
+		filters []FieldFilter
+		nodes   int
+		pipe    = -1 // index of the pipeline that returns nodes
+	)
+	for i, c := range s {
+		if isNodes(c) {
+			filters = append(filters, c.(Shape).Filters...)
+			nodes++
+		} else if a, ok := c.(Aggregate); ok && pipe < 0 && a.Field != "" && a.Pipeline.Limit == 0 {
+			pipe = i
+		}
+	}
+	if nodes == 0 || (nodes == 1 && pipe < 0) {
+		return s, false
+	}
+	out := make(shape.Intersect, 0, len(s))
+	if pipe >= 0 {
+		a := s[pipe].(Aggregate)
+		lk := a.Pipeline.Lookups
+		a.Pipeline.Lookups = append(lk[:len(lk):len(lk)], nodeLookup(a.Field, filters))
+		out = append(out, a)
+	} else {
+		out = append(out, Shape{Collection: colNodes, Filters: filters})
+	}
+	for i, c := range s {
+		if i != pipe && !isNodes(c) {
+			out = append(out, c)
+		}
+	}
+	if len(out) == 1 {
+		return out[0], true
+	}
+	return out, true
 }
 
 func (qs *QuadStore) optimizePage(s shape.Page) (shape.Shape, bool) {
@@ -189,6 +375,11 @@ func (qs *QuadStore) optimizePage(s shape.Page) (shape.Shape, bool) {
 		s.ApplyPage(shape.Page{Limit: f.Limit})
 		f.Limit = s.Limit
 		return f, true
+	case Aggregate:
+		if p := s.ApplyPage(shape.Page{Limit: f.Pipeline.Limit}); p != nil {
+			f.Pipeline.Limit = p.Limit
+		}
+		return f, true
 	}
 	return s, false
 }
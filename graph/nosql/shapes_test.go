@@ -0,0 +1,93 @@
+package nosql
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/cayleygraph/cayley/graph/iterator"
+	"github.com/cayleygraph/cayley/graph/shape"
+	"github.com/cayleygraph/cayley/quad"
+)
+
+type aggDB struct {
+	Database
+}
+
+func (aggDB) Aggregate(col string, p Pipeline) DocIterator {
+	return nil
+}
+
+func TestOptimizePipeline(t *testing.T) {
+	gt5 := []FieldFilter{
+		{Path: []string{fldValue, fldValInt}, Filter: GT, Value: Int(5)},
+	}
+	byPred := []FieldFilter{
+		{Path: []string{fldPredicate}, Filter: Equal, Value: String("p")},
+	}
+	// nodes with a value > 5 that are subjects of quads with a predicate "p"
+	s := shape.Page{Limit: 10, From: shape.Intersect{
+		shape.Filter{
+			From:    shape.AllNodes{},
+			Filters: []shape.ValueFilter{shape.Comparison{Op: iterator.CompareGT, Val: quad.Int(5)}},
+		},
+		shape.NodesFrom{Dir: quad.Subject, Quads: shape.Quads{
+			{Dir: quad.Predicate, Values: shape.Fixed{NodeHash("p")}},
+		}},
+	}}
+
+	qs := &QuadStore{db: aggDB{}}
+	out, opt := s.Optimize(qs)
+	require.True(t, opt)
+	require.Equal(t, Aggregate{
+		Collection: colQuads,
+		Pipeline: Pipeline{
+			Filters: byPred,
+			Compare: validQuads,
+			Lookups: []Lookup{nodeLookup(fldSubject, gt5)},
+			Limit:   10,
+		},
+		Field: fldSubject,
+	}, out)
+
+	// database without pipelines support should still use separate queries
+	qs = &QuadStore{db: nil}
+	out, _ = s.Optimize(qs)
+	require.Equal(t, shape.Page{Limit: 10, From: shape.Intersect{
+		Shape{Collection: colNodes, Filters: gt5},
+		shape.NodesFrom{Dir: quad.Subject, Quads: Quads{
+			Links: []Linkage{{Dir: quad.Predicate, Val: NodeHash("p")}},
+		}},
+	}}, out)
+}
+
+func TestOptimizePrefix(t *testing.T) {
+	prefix := shape.StringMatch{Op: shape.StringPrefix, Val: "bo"}
+	s := shape.Filter{
+		From: shape.AllNodes{},
+		Filters: []shape.ValueFilter{
+			prefix,
+			shape.StringMatch{Op: shape.StringSuffix, Val: "b"},
+		},
+	}
+	qs := &QuadStore{db: nil}
+	out, opt := s.Optimize(qs)
+	require.True(t, opt)
+	exp := shape.Filter{
+		From: Shape{Collection: colNodes, Filters: []FieldFilter{
+			{Path: []string{fldValue, fldValData}, Filter: Prefix, Value: String("bo")},
+		}},
+		Filters: s.Filters,
+	}
+	require.Equal(t, exp, out)
+
+	// should not add the same filter twice
+	out, opt = out.Optimize(qs)
+	require.False(t, opt)
+	require.Equal(t, exp, out)
+
+	// case-insensitive match cannot be pushed down
+	s.Filters = []shape.ValueFilter{shape.StringMatch{Op: shape.StringPrefix, Val: "bo", Fold: true}}
+	_, opt = s.Optimize(qs)
+	require.False(t, opt)
+}
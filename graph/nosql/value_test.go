@@ -31,6 +31,16 @@ var filterMatch = []struct {
 		d:   Document{"value1": Document{"str": String("bob")}},
 		exp: true,
 	},
+	{
+		f:   FieldFilter{Path: []string{"value", "str"}, Filter: Prefix, Value: String("bo")},
+		d:   Document{"value": Document{"str": String("bob")}},
+		exp: true,
+	},
+	{
+		f:   FieldFilter{Path: []string{"value", "str"}, Filter: Prefix, Value: String("ob")},
+		d:   Document{"value": Document{"str": String("bob")}},
+		exp: false,
+	},
 }
 
 func TestFilterMatch(t *testing.T) {
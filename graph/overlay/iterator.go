@@ -0,0 +1,193 @@
+// Copyright 2017 The Cayley Authors. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package overlay
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/cayleygraph/cayley/graph"
+	"github.com/cayleygraph/cayley/graph/iterator"
+)
+
+var _ graph.Iterator = &Iterator{}
+
+// Iterator converts values of an iterator of one of the underlying stores to values of the union.
+// Quads hidden by the mask of the store are skipped.
+type Iterator struct {
+	uid    uint64
+	tags   graph.Tagger
+	l      layer
+	sub    graph.Iterator
+	quads  bool
+	result graph.Value
+	err    error
+}
+
+func newIterator(l layer, sub graph.Iterator, quads bool) *Iterator {
+	if !quads {
+		l.mask = nil
+	}
+	return &Iterator{
+		uid:   iterator.NextUID(),
+		l:     l,
+		sub:   sub,
+		quads: quads,
+	}
+}
+
+// toUnion converts a value of the underlying store to a value of the union.
+func (it *Iterator) toUnion(v graph.Value) graph.Value {
+	if it.quads {
+		return quadValue{it.l.qs.Quad(v)}
+	}
+	return nodeValue(it.l.qs.NameOf(v))
+}
+
+// fromUnion converts a value of the union to a value of the underlying store.
+// It returns nil if the value is not in the store or is masked.
+func (it *Iterator) fromUnion(ctx context.Context, v graph.Value) graph.Value {
+	switch v := v.(type) {
+	case quadValue:
+		if it.quads && !it.l.masked(ctx, v.q) {
+			return findQuad(ctx, it.l.qs, v.q)
+		}
+	case graph.PreFetchedValue:
+		if !it.quads {
+			return it.l.qs.ValueOf(v.NameOf())
+		}
+	}
+	return nil
+}
+
+// visible checks if the current result of the subiterator is not masked.
+func (it *Iterator) visible(ctx context.Context) bool {
+	it.result = it.toUnion(it.sub.Result())
+	return !it.quads || !it.l.masked(ctx, it.result.(quadValue).q)
+}
+
+func (it *Iterator) UID() uint64 {
+	return it.uid
+}
+
+func (it *Iterator) SubIterators() []graph.Iterator {
+	return []graph.Iterator{it.sub}
+}
+
+func (it *Iterator) Reset() {
+	it.sub.Reset()
+	it.result = nil
+	it.err = nil
+}
+
+func (it *Iterator) Tagger() *graph.Tagger {
+	return &it.tags
+}
+
+func (it *Iterator) Clone() graph.Iterator {
+	out := newIterator(it.l, it.sub.Clone(), it.quads)
+	out.tags.CopyFrom(it)
+	return out
+}
+
+func (it *Iterator) Optimize() (graph.Iterator, bool) {
+	sub, changed := it.sub.Optimize()
+	if changed {
+		it.sub = sub
+		if sub.Type() == graph.Null {
+			return sub, true
+		}
+	}
+	return it, false
+}
+
+// TagResults only fills tags of this iterator, since values of the subiterator belong to a different store.
+func (it *Iterator) TagResults(dst map[string]graph.Value) {
+	it.tags.TagResult(dst, it.Result())
+}
+
+func (it *Iterator) String() string {
+	return fmt.Sprintf("Overlay(quads=%v, masked=%v)", it.quads, it.l.mask != nil)
+}
+
+func (it *Iterator) Next(ctx context.Context) bool {
+	graph.NextLogIn(it)
+	for it.sub.Next(ctx) {
+		if it.visible(ctx) {
+			return graph.NextLogOut(it, true)
+		}
+	}
+	it.result = nil
+	it.err = it.sub.Err()
+	return graph.NextLogOut(it, false)
+}
+
+func (it *Iterator) Contains(ctx context.Context, v graph.Value) bool {
+	graph.ContainsLogIn(it, v)
+	ref := it.fromUnion(ctx, v)
+	if ref == nil || !it.sub.Contains(ctx, ref) {
+		it.err = it.sub.Err()
+		return graph.ContainsLogOut(it, v, false)
+	}
+	it.result = v
+	return graph.ContainsLogOut(it, v, true)
+}
+
+func (it *Iterator) NextPath(ctx context.Context) bool {
+	for it.sub.NextPath(ctx) {
+		if it.visible(ctx) {
+			return true
+		}
+	}
+	it.err = it.sub.Err()
+	return false
+}
+
+func (it *Iterator) Err() error {
+	return it.err
+}
+
+func (it *Iterator) Result() graph.Value {
+	return it.result
+}
+
+func (it *Iterator) Stats() graph.IteratorStats {
+	return it.sub.Stats()
+}
+
+func (it *Iterator) Size() (int64, bool) {
+	return it.sub.Size()
+}
+
+func (it *Iterator) Type() graph.Type { return graph.Overlay }
+
+func (it *Iterator) Close() error {
+	return it.sub.Close()
+}
+
+// allIterator marks a union of all nodes or quads of the underlying stores, so optimizers can treat it as such.
+type allIterator struct {
+	graph.Iterator
+}
+
+func (it allIterator) Type() graph.Type { return graph.All }
+
+func (it allIterator) Clone() graph.Iterator {
+	return allIterator{it.Iterator.Clone()}
+}
+
+func (it allIterator) Optimize() (graph.Iterator, bool) {
+	return it, false
+}
@@ -0,0 +1,158 @@
+// Copyright 2017 The Cayley Authors. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package overlay implements quad stores that combine multiple stores: a read-only union
+// of stores, and an overlay that layers a writable store on top of a read-only one.
+//
+// Overlays allow to run queries over hypothetical changes, or to keep changes of a
+// single user separately from a shared dataset, without modifying the underlying graph.
+package overlay
+
+import (
+	"context"
+	"sync"
+
+	"github.com/cayleygraph/cayley/graph"
+	"github.com/cayleygraph/cayley/graph/memstore"
+)
+
+var _ graph.QuadStore = (*QuadStore)(nil)
+
+// QuadStore reads quads from both stores, and writes them only to the top one.
+//
+// Quads of the base store that are removed through the overlay are recorded in a mask store
+// and are hidden from all reads. Adding such a quad again removes it from the mask.
+//
+// Values returned by the store are not related to values of the underlying stores,
+// thus only the values returned by the overlay can be passed to it.
+type QuadStore struct {
+	*UnionStore
+	base, top, mask graph.QuadStore
+
+	mu sync.Mutex // serializes writes
+}
+
+// New creates an overlay of two quad stores with an in-memory mask.
+// The base store is never modified or closed by the overlay.
+func New(base, top graph.QuadStore) *QuadStore {
+	return NewWithMask(base, top, memstore.New())
+}
+
+// NewWithMask creates an overlay of two quad stores, recording removed quads of the base store in a given mask store.
+// Both top and mask stores should be persistent for the changes to survive a restart.
+// The base store is never modified or closed by the overlay.
+func NewWithMask(base, top, mask graph.QuadStore) *QuadStore {
+	return &QuadStore{
+		UnionStore: &UnionStore{layers: []layer{
+			{qs: top},
+			{qs: base, mask: mask},
+		}},
+		base: base, top: top, mask: mask,
+	}
+}
+
+// Base returns the read-only store of the overlay.
+func (qs *QuadStore) Base() graph.QuadStore { return qs.base }
+
+// Top returns the store that receives all quads added to the overlay.
+func (qs *QuadStore) Top() graph.QuadStore { return qs.top }
+
+// Mask returns the store with quads of the base store that were removed from the overlay.
+func (qs *QuadStore) Mask() graph.QuadStore { return qs.mask }
+
+// quadState tracks where the quad is stored while deltas are applied.
+type quadState struct {
+	top, base, masked bool
+}
+
+func (s *quadState) visible() bool {
+	return s.top || (s.base && !s.masked)
+}
+
+// ApplyDeltas adds quads to the top store and hides removed quads of the base store.
+//
+// All deltas are checked before any changes are made, but changes of the top store and
+// of the mask are applied separately, thus the write is not atomic if it affects both.
+func (qs *QuadStore) ApplyDeltas(in []graph.Delta, opts graph.IgnoreOpts) error {
+	qs.mu.Lock()
+	defer qs.mu.Unlock()
+	ctx := context.TODO()
+	states := make(map[string]*quadState)
+	var top, mask []graph.Delta
+	for _, d := range in {
+		key := d.Quad.String()
+		st := states[key]
+		if st == nil {
+			st = &quadState{
+				top:  findQuad(ctx, qs.top, d.Quad) != nil,
+				base: findQuad(ctx, qs.base, d.Quad) != nil,
+			}
+			st.masked = st.base && findQuad(ctx, qs.mask, d.Quad) != nil
+			states[key] = st
+		}
+		switch d.Action {
+		case graph.Add:
+			if st.visible() {
+				if opts.IgnoreDup {
+					continue
+				}
+				return &graph.DeltaError{Delta: d, Err: graph.ErrQuadExists}
+			}
+			if st.base {
+				mask = append(mask, graph.Delta{Action: graph.Delete, Quad: d.Quad})
+				st.masked = false
+			} else {
+				top = append(top, d)
+				st.top = true
+			}
+		case graph.Delete:
+			if !st.visible() {
+				if opts.IgnoreMissing {
+					continue
+				}
+				return &graph.DeltaError{Delta: d, Err: graph.ErrQuadNotExist}
+			}
+			if st.top {
+				top = append(top, d)
+				st.top = false
+			}
+			if st.base {
+				mask = append(mask, graph.Delta{Action: graph.Add, Quad: d.Quad})
+				st.masked = true
+			}
+		default:
+			return &graph.DeltaError{Delta: d, Err: graph.ErrInvalidAction}
+		}
+	}
+	if len(top) != 0 {
+		if err := qs.top.ApplyDeltas(top, graph.IgnoreOpts{}); err != nil {
+			return err
+		}
+	}
+	if len(mask) != 0 {
+		if err := qs.mask.ApplyDeltas(mask, graph.IgnoreOpts{}); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Close closes the top and the mask stores.
+func (qs *QuadStore) Close() error {
+	err := qs.top.Close()
+	if err2 := qs.mask.Close(); err == nil {
+		err = err2
+	}
+	return err
+}
@@ -0,0 +1,146 @@
+// Copyright 2017 The Cayley Authors. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package overlay_test
+
+import (
+	"context"
+	"sort"
+	"testing"
+
+	"github.com/cayleygraph/cayley/graph"
+	"github.com/cayleygraph/cayley/graph/graphtest"
+	"github.com/cayleygraph/cayley/graph/graphtest/testutil"
+	"github.com/cayleygraph/cayley/graph/memstore"
+	"github.com/cayleygraph/cayley/graph/overlay"
+	"github.com/cayleygraph/cayley/graph/path"
+	"github.com/cayleygraph/cayley/quad"
+	"github.com/stretchr/testify/require"
+)
+
+func TestOverlayGraph(t *testing.T) {
+	graphtest.TestAll(t, func(t testing.TB) (graph.QuadStore, graph.Options, func()) {
+		return overlay.New(memstore.New(), memstore.New()), nil, func() {}
+	}, &graphtest.Config{
+		AlwaysRunIntegration: true,
+	})
+}
+
+func TestOverlay(t *testing.T) {
+	base := memstore.New(
+		quad.MakeIRI("alice", "follows", "bob", ""),
+		quad.MakeIRI("bob", "follows", "carol", ""),
+	)
+	size := base.Size()
+	top := memstore.New()
+	qs := overlay.New(base, top)
+
+	err := qs.ApplyDeltas([]graph.Delta{
+		{Action: graph.Add, Quad: quad.MakeIRI("bob", "follows", "dan", "")},
+		{Action: graph.Add, Quad: quad.MakeIRI("alice", "follows", "bob", "")},
+	}, graph.IgnoreOpts{IgnoreDup: true})
+	require.NoError(t, err)
+	require.Equal(t, size, base.Size(), "base store must not be modified")
+
+	follows := quad.IRI("follows")
+	got := testutil.Collect(t, path.StartPath(qs, quad.IRI("alice")).Out(follows).Out(follows))
+	require.Equal(t, []string{"<carol>", "<dan>"}, got)
+
+	got = testutil.Collect(t, path.StartPath(qs, quad.IRI("alice")).Out(follows))
+	require.Equal(t, []string{"<bob>"}, got)
+	n, err := path.StartPath(qs, quad.IRI("alice")).Out(follows).Iterate(context.TODO()).Count()
+	require.NoError(t, err)
+	require.Equal(t, int64(1), n, "quads in both stores must be returned once")
+
+	got = testutil.Collect(t, path.StartPath(qs, quad.IRI("dan")).In(follows).In(follows))
+	require.Equal(t, []string{"<alice>"}, got)
+
+	require.Nil(t, qs.ValueOf(quad.IRI("eve")))
+	require.NotNil(t, qs.ValueOf(quad.IRI("dan")))
+	require.Nil(t, base.ValueOf(quad.IRI("dan")))
+}
+
+func TestOverlayMask(t *testing.T) {
+	q1, q2 := quad.MakeIRI("alice", "follows", "bob", ""), quad.MakeIRI("alice", "follows", "carol", "")
+	base := memstore.New(q1, q2)
+	qs := overlay.New(base, memstore.New())
+	follows := quad.IRI("follows")
+
+	err := qs.ApplyDeltas([]graph.Delta{{Action: graph.Delete, Quad: q1}}, graph.IgnoreOpts{})
+	require.NoError(t, err)
+	got := testutil.Collect(t, path.StartPath(qs, quad.IRI("alice")).Out(follows))
+	require.Equal(t, []string{"<carol>"}, got, "removed quads of the base store must be hidden")
+	got = testutil.Collect(t, path.StartPath(qs, quad.IRI("bob")).In(follows))
+	require.Equal(t, []string(nil), got)
+	require.NotNil(t, findQuadIn(base, q1), "base store must not be modified")
+
+	err = qs.ApplyDeltas([]graph.Delta{{Action: graph.Delete, Quad: q1}}, graph.IgnoreOpts{})
+	require.True(t, graph.IsQuadNotExist(err), "%v", err)
+	err = qs.ApplyDeltas([]graph.Delta{{Action: graph.Add, Quad: q2}}, graph.IgnoreOpts{})
+	require.True(t, graph.IsQuadExist(err), "%v", err)
+
+	err = qs.ApplyDeltas([]graph.Delta{{Action: graph.Add, Quad: q1}}, graph.IgnoreOpts{})
+	require.NoError(t, err)
+	got = testutil.Collect(t, path.StartPath(qs, quad.IRI("alice")).Out(follows))
+	require.Equal(t, []string{"<bob>", "<carol>"}, got)
+	require.Equal(t, int64(0), qs.Top().Size(), "restored quad must not be copied to the top store")
+}
+
+func findQuadIn(qs graph.QuadStore, q quad.Quad) graph.Value {
+	it := qs.QuadsAllIterator()
+	defer it.Close()
+	for it.Next(context.TODO()) {
+		if qs.Quad(it.Result()) == q {
+			return it.Result()
+		}
+	}
+	return nil
+}
+
+func TestUnion(t *testing.T) {
+	a := memstore.New(
+		quad.MakeIRI("alice", "follows", "bob", ""),
+		quad.MakeIRI("bob", "follows", "carol", ""),
+	)
+	b := memstore.New(
+		quad.MakeIRI("alice", "follows", "bob", ""),
+		quad.MakeIRI("carol", "follows", "dan", ""),
+	)
+	qs := overlay.Union(a, b)
+	follows := quad.IRI("follows")
+
+	got := testutil.Collect(t, path.StartPath(qs, quad.IRI("alice")).Out(follows).Out(follows).Out(follows))
+	require.Equal(t, []string{"<dan>"}, got, "paths must cross the stores")
+
+	got = testutil.Collect(t, path.StartPath(qs, quad.IRI("alice")).Out(follows))
+	require.Equal(t, []string{"<bob>"}, got)
+	n, err := path.StartPath(qs, quad.IRI("alice")).Out(follows).Iterate(context.TODO()).Count()
+	require.NoError(t, err)
+	require.Equal(t, int64(1), n, "quads in both stores must be returned once")
+
+	n, err = path.StartPath(qs).Iterate(context.TODO()).Count()
+	require.NoError(t, err)
+	require.Equal(t, int64(5), n, "nodes must be de-duplicated")
+
+	it := qs.QuadsAllIterator()
+	var quads int
+	for it.Next(context.TODO()) {
+		quads++
+	}
+	require.NoError(t, it.Close())
+	require.Equal(t, 3, quads, "quads must be de-duplicated")
+
+	err = qs.ApplyDeltas([]graph.Delta{{Action: graph.Add, Quad: quad.MakeIRI("a", "b", "c", "")}}, graph.IgnoreOpts{})
+	require.Equal(t, graph.ErrOperationNotSupported, err)
+}
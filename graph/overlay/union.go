@@ -0,0 +1,191 @@
+// Copyright 2017 The Cayley Authors. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package overlay
+
+import (
+	"context"
+
+	"github.com/cayleygraph/cayley/graph"
+	"github.com/cayleygraph/cayley/graph/iterator"
+	"github.com/cayleygraph/cayley/quad"
+)
+
+var _ graph.QuadStore = (*UnionStore)(nil)
+
+// layer is one of the stores combined by the union.
+type layer struct {
+	qs graph.QuadStore
+	// mask contains quads of the store that must be hidden. It can be nil.
+	mask graph.QuadStore
+}
+
+// masked checks if the quad is hidden in this layer.
+func (l layer) masked(ctx context.Context, q quad.Quad) bool {
+	return l.mask != nil && findQuad(ctx, l.mask, q) != nil
+}
+
+// UnionStore is a read-only quad store that combines quads of multiple stores.
+//
+// Quads and nodes present in more than one store are returned once. Values returned
+// by the store are not related to values of the underlying stores, thus only the values
+// returned by the union can be passed to it.
+type UnionStore struct {
+	layers []layer
+}
+
+// Union creates a read-only store that combines quads of all given stores.
+// Underlying stores are not closed by the union.
+func Union(stores ...graph.QuadStore) *UnionStore {
+	u := &UnionStore{layers: make([]layer, 0, len(stores))}
+	for _, qs := range stores {
+		u.layers = append(u.layers, layer{qs: qs})
+	}
+	return u
+}
+
+// Stores returns the underlying stores of the union.
+func (qs *UnionStore) Stores() []graph.QuadStore {
+	out := make([]graph.QuadStore, 0, len(qs.layers))
+	for _, l := range qs.layers {
+		out = append(out, l.qs)
+	}
+	return out
+}
+
+// quadValue is a reference to a quad in the union.
+type quadValue struct {
+	q quad.Quad
+}
+
+func (v quadValue) Key() interface{} { return v.q.String() }
+
+func nodeValue(v quad.Value) graph.Value {
+	if v == nil {
+		return nil
+	}
+	return graph.PreFetched(v)
+}
+
+// ApplyDeltas always fails, since the union is read-only.
+func (qs *UnionStore) ApplyDeltas(in []graph.Delta, opts graph.IgnoreOpts) error {
+	return graph.ErrOperationNotSupported
+}
+
+func (qs *UnionStore) Quad(v graph.Value) quad.Quad {
+	if q, ok := v.(quadValue); ok {
+		return q.q
+	}
+	return quad.Quad{}
+}
+
+func (qs *UnionStore) QuadDirection(v graph.Value, d quad.Direction) graph.Value {
+	return nodeValue(qs.Quad(v).Get(d))
+}
+
+// ValueOf returns a value if the node is present in any of the stores.
+// Nodes that are only used by masked quads are still reported as present.
+func (qs *UnionStore) ValueOf(v quad.Value) graph.Value {
+	if v == nil {
+		return nil
+	}
+	for _, l := range qs.layers {
+		if l.qs.ValueOf(v) != nil {
+			return nodeValue(v)
+		}
+	}
+	return nil
+}
+
+func (qs *UnionStore) NameOf(v graph.Value) quad.Value {
+	if v, ok := v.(graph.PreFetchedValue); ok {
+		return v.NameOf()
+	}
+	return nil
+}
+
+func (qs *UnionStore) QuadIterator(d quad.Direction, v graph.Value) graph.Iterator {
+	name := qs.NameOf(v)
+	if name == nil {
+		return iterator.NewNull()
+	}
+	var its []graph.Iterator
+	for _, l := range qs.layers {
+		if ref := l.qs.ValueOf(name); ref != nil {
+			its = append(its, newIterator(l, l.qs.QuadIterator(d, ref), true))
+		}
+	}
+	return union(its)
+}
+
+func (qs *UnionStore) NodesAllIterator() graph.Iterator {
+	var its []graph.Iterator
+	for _, l := range qs.layers {
+		its = append(its, newIterator(layer{qs: l.qs}, l.qs.NodesAllIterator(), false))
+	}
+	return allIterator{union(its)}
+}
+
+func (qs *UnionStore) QuadsAllIterator() graph.Iterator {
+	var its []graph.Iterator
+	for _, l := range qs.layers {
+		its = append(its, newIterator(l, l.qs.QuadsAllIterator(), true))
+	}
+	return allIterator{union(its)}
+}
+
+// union merges results of iterators, removing duplicates.
+func union(its []graph.Iterator) graph.Iterator {
+	switch len(its) {
+	case 0:
+		return iterator.NewNull()
+	case 1:
+		return its[0]
+	}
+	return iterator.NewUnique(iterator.NewOr(its...))
+}
+
+// Size returns the total size of all stores. Quads present in multiple stores are counted multiple times.
+func (qs *UnionStore) Size() int64 {
+	var n int64
+	for _, l := range qs.layers {
+		n += l.qs.Size()
+	}
+	return n
+}
+
+func (qs *UnionStore) OptimizeIterator(it graph.Iterator) (graph.Iterator, bool) {
+	return it, false
+}
+
+// Close does nothing, since underlying stores are owned by the caller.
+func (qs *UnionStore) Close() error {
+	return nil
+}
+
+// findQuad returns a reference to a quad in a given store, or nil if it does not exist.
+func findQuad(ctx context.Context, qs graph.QuadStore, q quad.Quad) graph.Value {
+	s := qs.ValueOf(q.Subject)
+	if s == nil {
+		return nil
+	}
+	it := qs.QuadIterator(quad.Subject, s)
+	defer it.Close()
+	for it.Next(ctx) {
+		if qs.Quad(it.Result()) == q {
+			return it.Result()
+		}
+	}
+	return nil
+}
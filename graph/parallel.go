@@ -0,0 +1,80 @@
+// Copyright 2017 The Cayley Authors. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package graph
+
+import "context"
+
+type workersKey struct{}
+
+// workers is a pool of goroutines available to a single query.
+type workers struct {
+	sem chan struct{}
+}
+
+// WithParallelism allows iterators to evaluate independent branches of a query concurrently,
+// using up to n goroutines in total, including the one that iterates the query.
+//
+// Parallel execution does not preserve the order of results. Values of n less than 2 disable it.
+func WithParallelism(ctx context.Context, n int) context.Context {
+	if n < 2 {
+		return ctx
+	}
+	return context.WithValue(ctx, workersKey{}, &workers{sem: make(chan struct{}, n-1)})
+}
+
+// Parallelism returns the maximal number of goroutines a query can use, as set by WithParallelism.
+func Parallelism(ctx context.Context) int {
+	if ctx == nil {
+		return 1
+	}
+	w, ok := ctx.Value(workersKey{}).(*workers)
+	if !ok {
+		return 1
+	}
+	return cap(w.sem) + 1
+}
+
+// AcquireWorkers reserves up to n additional goroutines from the query pool. It never blocks.
+//
+// It returns the number of reserved goroutines, which must be returned with ReleaseWorkers.
+// Zero means that the work should be done by the calling goroutine.
+func AcquireWorkers(ctx context.Context, n int) int {
+	if ctx == nil || n <= 0 {
+		return 0
+	}
+	w, ok := ctx.Value(workersKey{}).(*workers)
+	if !ok {
+		return 0
+	}
+	for i := 0; i < n; i++ {
+		select {
+		case w.sem <- struct{}{}:
+		default:
+			return i
+		}
+	}
+	return n
+}
+
+// ReleaseWorkers returns goroutines reserved by AcquireWorkers to the query pool.
+func ReleaseWorkers(ctx context.Context, n int) {
+	if n <= 0 {
+		return
+	}
+	w := ctx.Value(workersKey{}).(*workers)
+	for i := 0; i < n; i++ {
+		<-w.sem
+	}
+}
@@ -0,0 +1,185 @@
+// Copyright 2017 The Cayley Authors. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package patch implements a text format for changes of a graph.
+//
+// Each line of a patch is a quad in N-Quads format, prefixed with "+ " if the quad is added
+// or with "- " if it is removed. Empty lines and lines starting with "#" are ignored:
+//
+//	# remove a quad and add another one
+//	- <alice> <follows> <bob> .
+//	+ <alice> <follows> <carol> .
+package patch
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/cayleygraph/cayley/graph"
+	"github.com/cayleygraph/cayley/quad/nquads"
+)
+
+const (
+	prefixAdd    = "+ "
+	prefixDelete = "- "
+	prefixCmt    = "#"
+)
+
+// Writer encodes deltas to a patch.
+type Writer struct {
+	w   *bufio.Writer
+	enc *nquads.Writer
+}
+
+// NewWriter creates a patch writer. Flush must be called after all deltas are written.
+func NewWriter(w io.Writer) *Writer {
+	bw := bufio.NewWriter(w)
+	return &Writer{w: bw, enc: nquads.NewWriter(bw)}
+}
+
+// WriteDelta writes a single change.
+func (w *Writer) WriteDelta(d graph.Delta) error {
+	switch d.Action {
+	case graph.Add:
+		w.w.WriteString(prefixAdd)
+	case graph.Delete:
+		w.w.WriteString(prefixDelete)
+	default:
+		return &graph.DeltaError{Delta: d, Err: graph.ErrInvalidAction}
+	}
+	return w.enc.WriteQuad(d.Quad)
+}
+
+// WriteComment writes a comment line. Line breaks in the text are replaced with spaces.
+func (w *Writer) WriteComment(text string) error {
+	text = strings.Replace(text, "\n", " ", -1)
+	_, err := w.w.WriteString(prefixCmt + " " + text + "\n")
+	return err
+}
+
+// Flush writes any buffered data to the underlying writer.
+func (w *Writer) Flush() error {
+	return w.w.Flush()
+}
+
+// Reader decodes deltas from a patch.
+type Reader struct {
+	sc   *bufio.Scanner
+	line int
+}
+
+// NewReader creates a patch reader.
+func NewReader(r io.Reader) *Reader {
+	sc := bufio.NewScanner(r)
+	sc.Buffer(nil, 16*1024*1024)
+	return &Reader{sc: sc}
+}
+
+// ReadDelta reads the next change from the patch. It returns io.EOF at the end of the patch.
+func (r *Reader) ReadDelta() (graph.Delta, error) {
+	for r.sc.Scan() {
+		r.line++
+		line := strings.TrimSpace(r.sc.Text())
+		if line == "" || strings.HasPrefix(line, prefixCmt) {
+			continue
+		}
+		d, err := ParseDelta(line)
+		if err != nil {
+			return graph.Delta{}, fmt.Errorf("patch: line %d: %v", r.line, err)
+		}
+		return d, nil
+	}
+	if err := r.sc.Err(); err != nil {
+		return graph.Delta{}, err
+	}
+	return graph.Delta{}, io.EOF
+}
+
+// ParseDelta parses a single line of a patch that contains a change.
+func ParseDelta(line string) (graph.Delta, error) {
+	var d graph.Delta
+	switch {
+	case strings.HasPrefix(line, prefixAdd):
+		d.Action = graph.Add
+	case strings.HasPrefix(line, prefixDelete):
+		d.Action = graph.Delete
+	default:
+		return graph.Delta{}, fmt.Errorf("expected %q or %q", prefixAdd, prefixDelete)
+	}
+	q, err := nquads.Parse(line[len(prefixAdd):])
+	if err != nil {
+		return graph.Delta{}, err
+	} else if !q.IsValid() {
+		return graph.Delta{}, errors.New("invalid quad")
+	}
+	d.Quad = q
+	return d, nil
+}
+
+// Apply reads all deltas from a patch and applies them to the store, batch deltas per transaction.
+// If batch is zero or negative, the whole patch is applied in a single transaction.
+// It returns the number of applied deltas.
+func Apply(qw graph.QuadWriter, r *Reader, batch int) (int, error) {
+	var (
+		n  int
+		tx = graph.NewTransaction()
+	)
+	flush := func() error {
+		if len(tx.Deltas) == 0 {
+			return nil
+		}
+		if err := qw.ApplyTransaction(tx); err != nil {
+			return err
+		}
+		n += len(tx.Deltas)
+		tx = graph.NewTransaction()
+		return nil
+	}
+	for {
+		d, err := r.ReadDelta()
+		if err == io.EOF {
+			break
+		} else if err != nil {
+			return n, err
+		}
+		if d.Action == graph.Add {
+			tx.AddQuad(d.Quad)
+		} else {
+			tx.RemoveQuad(d.Quad)
+		}
+		if batch > 0 && len(tx.Deltas) >= batch {
+			if err = flush(); err != nil {
+				return n, err
+			}
+		}
+	}
+	return n, flush()
+}
+
+// Copy writes all deltas from a channel, as returned by graph.Diff, to a patch and flushes it.
+// It returns the number of written deltas. On error, the channel is not drained, thus the caller
+// should cancel the context of the diff.
+func Copy(w *Writer, deltas <-chan graph.Delta) (int, error) {
+	n := 0
+	for d := range deltas {
+		if err := w.WriteDelta(d); err != nil {
+			return n, err
+		}
+		n++
+	}
+	return n, w.Flush()
+}
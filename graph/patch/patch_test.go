@@ -0,0 +1,90 @@
+// Copyright 2017 The Cayley Authors. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package patch_test
+
+import (
+	"bytes"
+	"context"
+	"sort"
+	"strings"
+	"testing"
+
+	"github.com/cayleygraph/cayley/graph"
+	"github.com/cayleygraph/cayley/graph/memstore"
+	"github.com/cayleygraph/cayley/graph/patch"
+	"github.com/cayleygraph/cayley/quad"
+	"github.com/cayleygraph/cayley/writer"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDiffPatch(t *testing.T) {
+	shared := []quad.Quad{
+		quad.MakeIRI("alice", "follows", "bob", ""),
+		quad.MakeIRI("bob", "follows", "carol", ""),
+	}
+	removed := quad.MakeIRI("alice", "follows", "carol", "")
+	added := []quad.Quad{
+		quad.MakeIRI("carol", "follows", "alice", ""),
+		// differs from the removed quad only by the label
+		quad.MakeIRI("alice", "follows", "carol", "g"),
+	}
+	a := memstore.New(append([]quad.Quad{removed}, shared...)...)
+	b := memstore.New(append(added, shared...)...)
+
+	var buf bytes.Buffer
+	w := patch.NewWriter(&buf)
+	require.NoError(t, w.WriteComment("test"))
+	deltas, errc := graph.Diff(context.TODO(), a, b)
+	n, err := patch.Copy(w, deltas)
+	require.NoError(t, err)
+	require.NoError(t, <-errc)
+	require.Equal(t, 3, n)
+
+	lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+	require.Equal(t, "# test", lines[0])
+	require.Equal(t, "- <alice> <follows> <carol> .", lines[1])
+
+	qw, err := writer.NewSingleReplication(a, nil)
+	require.NoError(t, err)
+	n, err = patch.Apply(qw, patch.NewReader(&buf), 1)
+	require.NoError(t, err)
+	require.Equal(t, 3, n)
+	got, err := quad.ReadAll(graph.NewQuadStoreReader(a))
+	require.NoError(t, err)
+	expect := append(added, shared...)
+	sort.Sort(quad.ByQuadString(expect))
+	sort.Sort(quad.ByQuadString(got))
+	require.Equal(t, expect, got)
+
+	deltas, errc = graph.Diff(context.TODO(), a, b)
+	for d := range deltas {
+		t.Errorf("unexpected change after applying the patch: %v", d)
+	}
+	require.NoError(t, <-errc)
+}
+
+func TestReadPatch(t *testing.T) {
+	r := patch.NewReader(strings.NewReader("+ <a> <b> <c> .\n\n- <a> <b> \"d\" <g> .\n"))
+	d, err := r.ReadDelta()
+	require.NoError(t, err)
+	require.Equal(t, graph.Delta{Action: graph.Add, Quad: quad.MakeIRI("a", "b", "c", "")}, d)
+	d, err = r.ReadDelta()
+	require.NoError(t, err)
+	require.Equal(t, graph.Delete, d.Action)
+	require.Equal(t, quad.String("d"), d.Quad.Object)
+
+	_, err = patch.NewReader(strings.NewReader("<a> <b> <c> .\n")).ReadDelta()
+	require.Error(t, err)
+}
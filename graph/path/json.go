@@ -0,0 +1,609 @@
+// Copyright 2017 The Cayley Authors. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package path
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"regexp"
+
+	"github.com/cayleygraph/cayley/graph/iterator"
+	"github.com/cayleygraph/cayley/graph/shape"
+	"github.com/cayleygraph/cayley/quad"
+	"github.com/cayleygraph/cayley/quad/nquads"
+)
+
+// Limits for paths decoded from JSON. Paths may come from untrusted clients, thus the size of the path
+// is checked before any of the steps are built.
+var (
+	// MaxJSONSteps is the maximal number of steps in a path, including steps of all nested paths.
+	MaxJSONSteps = 1000
+	// MaxJSONDepth is the maximal nesting depth of paths.
+	MaxJSONDepth = 32
+)
+
+// Names of path steps in JSON representation.
+const (
+	opIs                  = "is"
+	opFilter              = "filter"
+	opSearch              = "search"
+	opNearest             = "nearest"
+	opTag                 = "tag"
+	opOut                 = "out"
+	opIn                  = "in"
+	opBoth                = "both"
+	opOutLang             = "out_lang"
+	opOutProvenance       = "out_provenance"
+	opInProvenance        = "in_provenance"
+	opLabels              = "labels"
+	opInPredicates        = "in_predicates"
+	opOutPredicates       = "out_predicates"
+	opSavePredicates      = "save_predicates"
+	opAnd                 = "and"
+	opOr                  = "or"
+	opExcept              = "except"
+	opOptional            = "optional"
+	opUnique              = "unique"
+	opFollow              = "follow"
+	opFollowReverse       = "follow_reverse"
+	opFollowRecursive     = "follow_recursive"
+	opSave                = "save"
+	opSaveReverse         = "save_reverse"
+	opSaveOptional        = "save_optional"
+	opSaveOptionalReverse = "save_optional_reverse"
+	opSaveLang            = "save_lang"
+	opSaveOptionalLang    = "save_optional_lang"
+	opHas                 = "has"
+	opHasFilter           = "has_filter"
+	opLabelContext        = "label_context"
+	opBack                = "back"
+	opReverse             = "reverse"
+	opSkip                = "skip"
+	opLimit               = "limit"
+	opCount               = "count"
+	opCountDistinct       = "count_distinct"
+)
+
+// step records a call of one of the Path methods with its arguments.
+// Steps are only used to serialize the path; the path itself is built from morphisms.
+type step struct {
+	op      string
+	nodes   []quad.Value
+	via     []interface{}
+	path    *Path
+	tags    []string
+	tag     string
+	langs   []string
+	filters []shape.ValueFilter
+	rev     bool
+	n       int64
+	query   string
+	vector  quad.Vector
+	author  string
+	time    string
+	opt     iterator.RecursiveOptions
+	err     error // set if the step cannot be serialized
+}
+
+// stepsWith returns a copy of path steps with a given step added.
+func (p *Path) stepsWith(s step) []step {
+	steps := p.steps[:len(p.steps):len(p.steps)]
+	return append(steps, s)
+}
+
+// jsonStep is a JSON representation of a single path step.
+type jsonStep struct {
+	Op         string       `json:"op"`
+	Nodes      []string     `json:"nodes,omitempty"`
+	Via        []string     `json:"via,omitempty"`
+	ViaPath    *Path        `json:"via_path,omitempty"`
+	Path       *Path        `json:"path,omitempty"`
+	Tags       []string     `json:"tags,omitempty"`
+	Tag        string       `json:"tag,omitempty"`
+	Langs      []string     `json:"langs,omitempty"`
+	Filters    []jsonFilter `json:"filters,omitempty"`
+	Rev        bool         `json:"rev,omitempty"`
+	N          int64        `json:"n,omitempty"`
+	Query      string       `json:"query,omitempty"`
+	Vector     []float32    `json:"vector,omitempty"`
+	Author     string       `json:"author,omitempty"`
+	Time       string       `json:"time,omitempty"`
+	MaxDepth   int          `json:"max_depth,omitempty"`
+	Strategy   string       `json:"strategy,omitempty"`
+	MaxResults int          `json:"max_results,omitempty"`
+	CycleTags  []string     `json:"cycle_tags,omitempty"`
+}
+
+// jsonFilter is a JSON representation of a value filter.
+// Type is one of "compare", "regexp", "lang", "string", "length" or "modulo".
+type jsonFilter struct {
+	Type  string   `json:"type"`
+	Op    string   `json:"op,omitempty"`
+	Value string   `json:"value,omitempty"`
+	Refs  bool     `json:"refs,omitempty"`
+	Fold  bool     `json:"fold,omitempty"`
+	Langs []string `json:"langs,omitempty"`
+	Min   int      `json:"min,omitempty"`
+	Max   int      `json:"max,omitempty"`
+	Div   int64    `json:"div,omitempty"`
+	Rem   int64    `json:"rem,omitempty"`
+}
+
+var (
+	compareOps = map[iterator.Operator]string{
+		iterator.CompareLT:  "lt",
+		iterator.CompareLTE: "lte",
+		iterator.CompareGT:  "gt",
+		iterator.CompareGTE: "gte",
+	}
+	stringOps = map[shape.StringOp]string{
+		shape.StringEqual:    "equal",
+		shape.StringPrefix:   "prefix",
+		shape.StringSuffix:   "suffix",
+		shape.StringContains: "contains",
+	}
+	strategies = map[iterator.RecursiveStrategy]string{
+		iterator.BreadthFirst: "breadth_first",
+		iterator.DepthFirst:   "depth_first",
+	}
+)
+
+// MarshalJSON encodes the path as a list of steps that were used to build it.
+//
+// The format is a stable representation of the path that can be sent to another process and executed there.
+// Each step is an object with an "op" field naming the Path method, and fields for its arguments.
+// Values are encoded in N-Quads syntax.
+//
+// Paths that were built from quad store references or iterators (see StartPathNodes and PathFromIterator)
+// cannot be encoded.
+func (p *Path) MarshalJSON() ([]byte, error) {
+	steps := make([]jsonStep, 0, len(p.steps))
+	for _, s := range p.steps {
+		js, err := s.toJSON()
+		if err != nil {
+			return nil, err
+		}
+		steps = append(steps, js)
+	}
+	return json.Marshal(steps)
+}
+
+// UnmarshalJSON decodes the path from the list of steps (see MarshalJSON). The quad store of the path is preserved,
+// thus it can be set before decoding:
+//
+//	p := path.NewPath(qs)
+//	err := json.Unmarshal(data, p)
+//
+// All steps are validated, and an error is returned for unknown steps or invalid arguments,
+// or if the path exceeds MaxJSONSteps or MaxJSONDepth.
+func (p *Path) UnmarshalJSON(data []byte) error {
+	if err := checkJSONSize(data); err != nil {
+		return err
+	}
+	var steps []jsonStep
+	if err := json.Unmarshal(data, &steps); err != nil {
+		return err
+	}
+	np := NewPath(p.qs)
+	for i, s := range steps {
+		var err error
+		np, err = s.apply(np)
+		if err != nil {
+			return fmt.Errorf("path step %d (%q): %v", i, s.Op, err)
+		}
+	}
+	*p = *np
+	return nil
+}
+
+// checkJSONSize counts steps and the nesting depth of paths in JSON without decoding them.
+// Arrays of steps are the top-level array and arrays in "path" and "via_path" fields.
+func checkJSONSize(data []byte) error {
+	type frame struct {
+		obj   bool   // object or array
+		steps bool   // array of path steps
+		key   string // last key of the object
+		value bool   // object expects a value for the key
+	}
+	var (
+		stack        []frame
+		steps, depth int
+	)
+	dec := json.NewDecoder(bytes.NewReader(data))
+	for {
+		tok, err := dec.Token()
+		if err == io.EOF {
+			return nil
+		} else if err != nil {
+			return err
+		}
+		var top *frame
+		if len(stack) != 0 {
+			top = &stack[len(stack)-1]
+		}
+		if key, ok := tok.(string); ok && top != nil && top.obj && !top.value {
+			top.key, top.value = key, true
+			continue
+		}
+		switch tok {
+		case json.Delim('['):
+			f := frame{steps: top == nil || (top.obj && (top.key == "path" || top.key == "via_path"))}
+			if f.steps {
+				if depth++; depth > MaxJSONDepth {
+					return fmt.Errorf("path: nesting depth exceeds %d", MaxJSONDepth)
+				}
+			}
+			stack = append(stack, f)
+			continue
+		case json.Delim('{'):
+			if top != nil && top.steps {
+				if steps++; steps > MaxJSONSteps {
+					return fmt.Errorf("path: number of steps exceeds %d", MaxJSONSteps)
+				}
+			}
+			stack = append(stack, frame{obj: true})
+			continue
+		case json.Delim(']'), json.Delim('}'):
+			if top.steps {
+				depth--
+			}
+			stack = stack[:len(stack)-1]
+			if len(stack) == 0 {
+				continue
+			}
+			top = &stack[len(stack)-1]
+		}
+		if top != nil && top.obj {
+			// value of the object field is complete
+			top.value = false
+		}
+	}
+}
+
+func (s step) toJSON() (jsonStep, error) {
+	if s.err != nil {
+		return jsonStep{}, s.err
+	}
+	js := jsonStep{
+		Op:     s.op,
+		Path:   s.path,
+		Tags:   s.tags,
+		Tag:    s.tag,
+		Langs:  s.langs,
+		Rev:    s.rev,
+		N:      s.n,
+		Query:  s.query,
+		Vector: s.vector.Floats(),
+		Author: s.author,
+		Time:   s.time,
+	}
+	js.Nodes = marshalValues(s.nodes)
+	var err error
+	if js.Via, js.ViaPath, err = marshalVia(s.via); err != nil {
+		return js, err
+	}
+	for _, f := range s.filters {
+		jf, err := marshalFilter(f)
+		if err != nil {
+			return js, err
+		}
+		js.Filters = append(js.Filters, jf)
+	}
+	if s.op == opFollowRecursive {
+		if s.opt.Spill != (iterator.SpillOptions{}) {
+			return js, errors.New("path: spill options cannot be serialized")
+		}
+		js.MaxDepth = s.opt.MaxDepth
+		js.MaxResults = s.opt.MaxResults
+		js.CycleTags = s.opt.CycleTags
+		if s.opt.Strategy != iterator.BreadthFirst {
+			name, ok := strategies[s.opt.Strategy]
+			if !ok {
+				return js, fmt.Errorf("path: unsupported recursion strategy: %v", s.opt.Strategy)
+			}
+			js.Strategy = name
+		}
+	}
+	return js, nil
+}
+
+func (s jsonStep) apply(p *Path) (*Path, error) {
+	nodes, err := unmarshalValues(s.Nodes)
+	if err != nil {
+		return nil, err
+	}
+	via, err := s.via()
+	if err != nil {
+		return nil, err
+	}
+	var filters []shape.ValueFilter
+	for _, jf := range s.Filters {
+		f, err := unmarshalFilter(jf)
+		if err != nil {
+			return nil, err
+		}
+		filters = append(filters, f)
+	}
+	switch s.Op {
+	case opIs:
+		return p.Is(nodes...), nil
+	case opFilter:
+		return p.Filters(filters...), nil
+	case opSearch:
+		return p.Search(s.Query, int(s.N)), nil
+	case opNearest:
+		return p.NearestTo(quad.NewVector(s.Vector...), int(s.N)), nil
+	case opTag:
+		return p.Tag(s.Tags...), nil
+	case opOut:
+		return p.OutWithTags(s.Tags, via), nil
+	case opIn:
+		return p.InWithTags(s.Tags, via), nil
+	case opBoth:
+		return p.BothWithTags(s.Tags, via), nil
+	case opOutLang:
+		return p.OutLang(via, s.Langs...), nil
+	case opOutProvenance:
+		return p.OutWithProvenance(s.Author, s.Time, via), nil
+	case opInProvenance:
+		return p.InWithProvenance(s.Author, s.Time, via), nil
+	case opLabels:
+		return p.Labels(), nil
+	case opInPredicates:
+		return p.InPredicates(), nil
+	case opOutPredicates:
+		return p.OutPredicates(), nil
+	case opSavePredicates:
+		return p.SavePredicates(s.Rev, s.Tag), nil
+	case opSave:
+		return p.Save(via, s.Tag), nil
+	case opSaveReverse:
+		return p.SaveReverse(via, s.Tag), nil
+	case opSaveOptional:
+		return p.SaveOptional(via, s.Tag), nil
+	case opSaveOptionalReverse:
+		return p.SaveOptionalReverse(via, s.Tag), nil
+	case opSaveLang:
+		return p.SaveLang(via, s.Tag, s.Langs...), nil
+	case opSaveOptionalLang:
+		return p.SaveOptionalLang(via, s.Tag, s.Langs...), nil
+	case opHas:
+		if s.Rev {
+			return p.HasReverse(via, nodes...), nil
+		}
+		return p.Has(via, nodes...), nil
+	case opHasFilter:
+		return p.HasFilter(via, s.Rev, filters...), nil
+	case opLabelContext:
+		return p.LabelContextWithTags(s.Tags, via), nil
+	case opUnique:
+		return p.Unique(), nil
+	case opBack:
+		if s.Tag == "" {
+			return nil, errors.New("tag is not set")
+		}
+		return p.Back(s.Tag), nil
+	case opSkip:
+		return p.Skip(s.N), nil
+	case opLimit:
+		return p.Limit(s.N), nil
+	case opCount:
+		return p.Count(), nil
+	case opCountDistinct:
+		return p.CountDistinct(), nil
+	}
+	switch s.Op {
+	case opAnd, opOr, opExcept, opOptional, opFollow, opFollowReverse, opReverse:
+		if s.Path == nil {
+			return nil, errors.New("path is not set")
+		}
+	}
+	switch s.Op {
+	case opAnd:
+		return p.And(s.Path), nil
+	case opOr:
+		return p.Or(s.Path), nil
+	case opExcept:
+		return p.Except(s.Path), nil
+	case opOptional:
+		return p.Optional(s.Path), nil
+	case opFollow:
+		return p.Follow(s.Path), nil
+	case opFollowReverse:
+		return p.FollowReverse(s.Path), nil
+	case opReverse:
+		if len(p.steps) != 0 {
+			return nil, errors.New("reverse must be the first step")
+		}
+		np := NewPath(p.qs)
+		np.stack, np.steps = s.Path.stack, s.Path.steps
+		return np.Reverse(), nil
+	case opFollowRecursive:
+		if via == nil {
+			return nil, errors.New("via is not set")
+		} else if s.MaxDepth < 0 || s.MaxResults < 0 {
+			return nil, errors.New("max_depth and max_results must not be negative")
+		}
+		opt := iterator.RecursiveOptions{
+			MaxDepth:   s.MaxDepth,
+			MaxResults: s.MaxResults,
+			CycleTags:  s.CycleTags,
+		}
+		if s.Strategy != "" {
+			found := false
+			for st, name := range strategies {
+				if name == s.Strategy {
+					opt.Strategy, found = st, true
+					break
+				}
+			}
+			if !found {
+				return nil, fmt.Errorf("unsupported recursion strategy: %q", s.Strategy)
+			}
+		}
+		if vals, ok := via.([]quad.Value); ok {
+			if len(vals) != 1 {
+				return nil, errors.New("recursion requires a single predicate or a path")
+			}
+			via = vals[0]
+		}
+		return p.FollowRecursiveWith(via, s.Tags, opt), nil
+	}
+	return nil, errors.New("unknown step")
+}
+
+// via returns a path, a list of values or nil for a via argument of the step.
+func (s jsonStep) via() (interface{}, error) {
+	if s.ViaPath != nil {
+		if len(s.Via) != 0 {
+			return nil, errors.New("both via and via_path are set")
+		}
+		return s.ViaPath, nil
+	} else if len(s.Via) == 0 {
+		return nil, nil
+	}
+	return unmarshalValues(s.Via)
+}
+
+// marshalVia encodes a via argument accepted by buildVia.
+func marshalVia(via []interface{}) ([]string, *Path, error) {
+	if len(via) == 1 {
+		switch v := via[0].(type) {
+		case nil:
+			return nil, nil, nil
+		case *Path:
+			return nil, v, nil
+		case []quad.Value:
+			return marshalValues(v), nil, nil
+		}
+	}
+	var out []string
+	for _, v := range via {
+		qv, ok := quad.AsValue(v)
+		if !ok {
+			return nil, nil, fmt.Errorf("path: unsupported via value: %v (%T)", v, v)
+		}
+		out = append(out, quad.StringOf(qv))
+	}
+	return out, nil, nil
+}
+
+func marshalValues(vals []quad.Value) []string {
+	if len(vals) == 0 {
+		return nil
+	}
+	out := make([]string, 0, len(vals))
+	for _, v := range vals {
+		out = append(out, quad.StringOf(v))
+	}
+	return out
+}
+
+// unmarshalValue parses a value in N-Quads syntax.
+func unmarshalValue(s string) (quad.Value, error) {
+	q, err := nquads.Parse("<s> <p> " + s + " .")
+	if err != nil || q.Object == nil || q.Label != nil {
+		return nil, fmt.Errorf("invalid value: %q", s)
+	}
+	if ts, ok := q.Object.(quad.TypedString); ok {
+		if v, err := ts.ParseValue(); err == nil {
+			return v, nil
+		}
+	}
+	return q.Object, nil
+}
+
+func unmarshalValues(arr []string) ([]quad.Value, error) {
+	if len(arr) == 0 {
+		return nil, nil
+	}
+	out := make([]quad.Value, 0, len(arr))
+	for _, s := range arr {
+		v, err := unmarshalValue(s)
+		if err != nil {
+			return nil, err
+		}
+		out = append(out, v)
+	}
+	return out, nil
+}
+
+func marshalFilter(f shape.ValueFilter) (jsonFilter, error) {
+	switch f := f.(type) {
+	case shape.Comparison:
+		op, ok := compareOps[f.Op]
+		if !ok {
+			return jsonFilter{}, fmt.Errorf("path: unsupported comparison: %v", f.Op)
+		}
+		return jsonFilter{Type: "compare", Op: op, Value: quad.StringOf(f.Val)}, nil
+	case shape.Regexp:
+		return jsonFilter{Type: "regexp", Value: f.Re.String(), Refs: f.Refs}, nil
+	case shape.Language:
+		return jsonFilter{Type: "lang", Langs: f.Langs}, nil
+	case shape.StringMatch:
+		op, ok := stringOps[f.Op]
+		if !ok {
+			return jsonFilter{}, fmt.Errorf("path: unsupported string operation: %v", f.Op)
+		}
+		return jsonFilter{Type: "string", Op: op, Value: f.Val, Fold: f.Fold, Refs: f.Refs}, nil
+	case shape.Length:
+		return jsonFilter{Type: "length", Min: f.Min, Max: f.Max, Refs: f.Refs}, nil
+	case shape.Modulo:
+		return jsonFilter{Type: "modulo", Div: f.Div, Rem: f.Rem}, nil
+	}
+	return jsonFilter{}, fmt.Errorf("path: unsupported filter: %T", f)
+}
+
+func unmarshalFilter(f jsonFilter) (shape.ValueFilter, error) {
+	switch f.Type {
+	case "compare":
+		v, err := unmarshalValue(f.Value)
+		if err != nil {
+			return nil, err
+		}
+		for op, name := range compareOps {
+			if name == f.Op {
+				return shape.Comparison{Op: op, Val: v}, nil
+			}
+		}
+		return nil, fmt.Errorf("unsupported comparison: %q", f.Op)
+	case "regexp":
+		re, err := regexp.Compile(f.Value)
+		if err != nil {
+			return nil, err
+		}
+		return shape.Regexp{Re: re, Refs: f.Refs}, nil
+	case "lang":
+		return shape.Language{Langs: f.Langs}, nil
+	case "string":
+		for op, name := range stringOps {
+			if name == f.Op {
+				return shape.StringMatch{Op: op, Val: f.Value, Fold: f.Fold, Refs: f.Refs}, nil
+			}
+		}
+		return nil, fmt.Errorf("unsupported string operation: %q", f.Op)
+	case "length":
+		return shape.Length{Min: f.Min, Max: f.Max, Refs: f.Refs}, nil
+	case "modulo":
+		if f.Div == 0 {
+			return nil, errors.New("modulo by zero")
+		}
+		return shape.Modulo{Div: f.Div, Rem: f.Rem}, nil
+	}
+	return nil, fmt.Errorf("unsupported filter: %q", f.Type)
+}
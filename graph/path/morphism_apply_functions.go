@@ -87,6 +87,26 @@ func filterMorphism(filt []shape.ValueFilter) morphism {
 	}
 }
 
+// searchMorphism is the set of nodes that matches a full-text query.
+func searchMorphism(query string, limit int) morphism {
+	return morphism{
+		Reversal: func(ctx *pathContext) (morphism, *pathContext) { return searchMorphism(query, limit), ctx },
+		Apply: func(in shape.Shape, ctx *pathContext) (shape.Shape, *pathContext) {
+			return shape.IntersectShapes(in, shape.TextSearch{Query: query, Limit: limit}), ctx
+		},
+	}
+}
+
+// nearestMorphism is the set of k vector values that are the closest to a given vector.
+func nearestMorphism(vec quad.Vector, k int) morphism {
+	return morphism{
+		Reversal: func(ctx *pathContext) (morphism, *pathContext) { return nearestMorphism(vec, k), ctx },
+		Apply: func(in shape.Shape, ctx *pathContext) (shape.Shape, *pathContext) {
+			return shape.IntersectShapes(in, shape.NearestVectors{Vector: vec, K: k}), ctx
+		},
+	}
+}
+
 // hasMorphism is the set of nodes that is reachable via either a *Path, a
 // single node.(string) or a list of nodes.([]string).
 func hasMorphism(via interface{}, rev bool, nodes ...quad.Value) morphism {
@@ -141,6 +161,42 @@ func outMorphism(tags []string, via ...interface{}) morphism {
 	}
 }
 
+// outLangMorphism is the same as outMorphism, but only returns values in the most preferred language.
+func outLangMorphism(via interface{}, langs []string) morphism {
+	return morphism{
+		Reversal: func(ctx *pathContext) (morphism, *pathContext) { return inMorphism(nil, via), ctx },
+		Apply: func(in shape.Shape, ctx *pathContext) (shape.Shape, *pathContext) {
+			return shape.OutLang(in, buildVia(via), ctx.labelSet, langs...), ctx
+		},
+	}
+}
+
+// outProvenanceMorphism is the same as outMorphism, but tags results with provenance of followed quads.
+func outProvenanceMorphism(author, time string, via ...interface{}) morphism {
+	return morphism{
+		Reversal: func(ctx *pathContext) (morphism, *pathContext) {
+			return inProvenanceMorphism(author, time, via...), ctx
+		},
+		Apply: func(in shape.Shape, ctx *pathContext) (shape.Shape, *pathContext) {
+			return shape.OutWithProvenance(in, buildVia(via...), ctx.labelSet, author, time), ctx
+		},
+		tags: []string{author, time},
+	}
+}
+
+// inProvenanceMorphism is the same as inMorphism, but tags results with provenance of followed quads.
+func inProvenanceMorphism(author, time string, via ...interface{}) morphism {
+	return morphism{
+		Reversal: func(ctx *pathContext) (morphism, *pathContext) {
+			return outProvenanceMorphism(author, time, via...), ctx
+		},
+		Apply: func(in shape.Shape, ctx *pathContext) (shape.Shape, *pathContext) {
+			return shape.InWithProvenance(in, buildVia(via...), ctx.labelSet, author, time), ctx
+		},
+		tags: []string{author, time},
+	}
+}
+
 // inMorphism iterates backwards one RDF triple or via an entire path.
 func inMorphism(tags []string, via ...interface{}) morphism {
 	return morphism{
@@ -286,15 +342,19 @@ func (s iteratorBuilder) Optimize(r shape.Optimizer) (shape.Shape, bool) {
 	return s, false
 }
 
-func followRecursiveMorphism(p *Path, maxDepth int, depthTags []string) morphism {
+func followRecursiveMorphism(p *Path, opt iterator.RecursiveOptions, depthTags []string) morphism {
 	return morphism{
 		Reversal: func(ctx *pathContext) (morphism, *pathContext) {
-			return followRecursiveMorphism(p.Reverse(), maxDepth, depthTags), ctx
+			return followRecursiveMorphism(p.Reverse(), opt, depthTags), ctx
 		},
 		Apply: func(in shape.Shape, ctx *pathContext) (shape.Shape, *pathContext) {
 			return iteratorBuilder(func(qs graph.QuadStore) graph.Iterator {
 				in := in.BuildIterator(qs)
-				it := iterator.NewRecursive(qs, in, p.Morphism(), maxDepth)
+				opt := opt
+				if opt.Spill == (iterator.SpillOptions{}) {
+					opt.Spill = iterator.Spill
+				}
+				it := iterator.NewRecursiveWithOptions(qs, in, p.Morphism(), opt)
 				for _, s := range depthTags {
 					it.AddDepthTag(s)
 				}
@@ -304,6 +364,18 @@ func followRecursiveMorphism(p *Path, maxDepth int, depthTags []string) morphism
 	}
 }
 
+// optionalMorphism keeps all nodes of the current path, and tags those that match p.(*Path) with tags of p.
+func optionalMorphism(p *Path) morphism {
+	return morphism{
+		Reversal: func(ctx *pathContext) (morphism, *pathContext) { return optionalMorphism(p), ctx },
+		Apply: func(in shape.Shape, ctx *pathContext) (shape.Shape, *pathContext) {
+			// nodes from which p can be followed, with all tags set by it
+			matched := p.Reverse().ShapeFrom(shape.AllNodes{})
+			return shape.Intersect{in, shape.Optional{From: matched}}, ctx
+		},
+	}
+}
+
 // exceptMorphism removes all results on p.(*Path) from the current iterators.
 func exceptMorphism(p *Path) morphism {
 	return morphism{
@@ -364,6 +436,16 @@ func saveOptionalReverseMorphism(via interface{}, tag string) morphism {
 	}
 }
 
+func saveLangMorphism(via interface{}, tag string, opt bool, langs []string) morphism {
+	return morphism{
+		Reversal: func(ctx *pathContext) (morphism, *pathContext) { return saveLangMorphism(via, tag, opt, langs), ctx },
+		Apply: func(in shape.Shape, ctx *pathContext) (shape.Shape, *pathContext) {
+			return shape.SaveViaLang(in, buildVia(via), ctx.labelSet, langs, tag, false, opt), ctx
+		},
+		tags: []string{tag},
+	}
+}
+
 func buildVia(via ...interface{}) shape.Shape {
 	if len(via) == 0 {
 		return shape.AllNodes{}
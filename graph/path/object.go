@@ -0,0 +1,224 @@
+// Copyright 2017 The Cayley Authors. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package path
+
+import (
+	"context"
+	"strings"
+
+	"github.com/cayleygraph/cayley/graph"
+	"github.com/cayleygraph/cayley/graph/shape"
+)
+
+// FieldSep separates names of nested fields in tags. See Object.
+const FieldSep = "."
+
+// Object collects tags of all paths to a single result into a nested object.
+//
+// Tag names are split by FieldSep into the names of nested fields, thus a value saved with
+// a "friend.name" tag is stored in the "name" field of the object in the "friend" field.
+// If the parent field is tagged as well ("friend" in the example), a separate object is created
+// for each distinct value of it, and this value is stored in the "id" field of that object.
+// Otherwise, all values are collected into a single nested object.
+//
+// Fields with a single value are returned as is, and fields with multiple values are returned as lists.
+type Object struct {
+	id     graph.Value
+	fields map[string]*objectField
+}
+
+type objectField struct {
+	vals []graph.Value
+	seen map[interface{}]struct{}
+
+	objs  []*Object
+	byKey map[interface{}]*Object
+	anon  *Object // object for values with an untagged parent
+}
+
+// NewObject creates an empty object.
+func NewObject() *Object {
+	return &Object{fields: make(map[string]*objectField)}
+}
+
+func (o *Object) field(name string) *objectField {
+	f := o.fields[name]
+	if f == nil {
+		f = &objectField{}
+		o.fields[name] = f
+	}
+	return f
+}
+
+func (f *objectField) addValue(v graph.Value) {
+	key := graph.ToKey(v)
+	if _, ok := f.seen[key]; ok {
+		return
+	}
+	if f.seen == nil {
+		f.seen = make(map[interface{}]struct{})
+	}
+	f.seen[key] = struct{}{}
+	f.vals = append(f.vals, v)
+}
+
+func (f *objectField) object(id graph.Value) *Object {
+	if id == nil {
+		if f.anon == nil {
+			f.anon = NewObject()
+			f.objs = append(f.objs, f.anon)
+		}
+		return f.anon
+	}
+	key := graph.ToKey(id)
+	if o, ok := f.byKey[key]; ok {
+		return o
+	}
+	if f.byKey == nil {
+		f.byKey = make(map[interface{}]*Object)
+	}
+	o := NewObject()
+	o.id = id
+	f.byKey[key] = o
+	f.objs = append(f.objs, o)
+	return o
+}
+
+// AddTags adds tags of a single path to the object.
+func (o *Object) AddTags(tags map[string]graph.Value) {
+	var nested map[string]map[string]graph.Value
+	for k, v := range tags {
+		i := strings.Index(k, FieldSep)
+		if i < 0 {
+			continue
+		}
+		name := k[:i]
+		if nested == nil {
+			nested = make(map[string]map[string]graph.Value)
+		}
+		sub := nested[name]
+		if sub == nil {
+			sub = make(map[string]graph.Value)
+			nested[name] = sub
+		}
+		sub[k[i+len(FieldSep):]] = v
+	}
+	for k, v := range tags {
+		if strings.Contains(k, FieldSep) {
+			continue
+		} else if _, ok := nested[k]; ok || v == nil {
+			// values of parent fields are ids of nested objects
+			continue
+		}
+		o.field(k).addValue(v)
+	}
+	for name, sub := range nested {
+		o.field(name).object(tags[name]).AddTags(sub)
+	}
+}
+
+// Values returns the object with names of all values loaded from the quad store.
+// Leaf values are quad.Value, and nested objects are map[string]interface{}.
+func (o *Object) Values(ctx context.Context, qs graph.QuadStore) (map[string]interface{}, error) {
+	out := make(map[string]interface{}, len(o.fields)+1)
+	if o.id != nil {
+		id, err := graph.NameOf(ctx, qs, o.id)
+		if err != nil {
+			return nil, err
+		}
+		out["id"] = id
+	}
+	for name, f := range o.fields {
+		var arr []interface{}
+		if len(f.objs) != 0 {
+			for _, v := range f.vals {
+				if _, ok := f.byKey[graph.ToKey(v)]; !ok {
+					// the same field is an object in other paths
+					f.object(v)
+				}
+			}
+			for _, obj := range f.objs {
+				sub, err := obj.Values(ctx, qs)
+				if err != nil {
+					return nil, err
+				}
+				arr = append(arr, sub)
+			}
+		} else {
+			for _, v := range f.vals {
+				name, err := graph.NameOf(ctx, qs, v)
+				if err != nil {
+					return nil, err
+				}
+				arr = append(arr, name)
+			}
+		}
+		switch len(arr) {
+		case 0:
+		case 1:
+			out[name] = arr[0]
+		default:
+			out[name] = arr
+		}
+	}
+	return out, nil
+}
+
+// ObjectEach executes the path and calls a provided callback for each result with a nested object
+// built from tags of all paths to that result. See Object for details. Limit applies to the number of results.
+func (p *Path) ObjectEach(ctx context.Context, limit int, fnc func(map[string]interface{})) error {
+	return ObjectEach(ctx, shape.BuildIterator(p.qs, p.Shape()), p.qs, limit, fnc)
+}
+
+// ObjectEach is the same as Path.ObjectEach, but runs a given iterator.
+//
+// The iterator may return paths to the same result in any order, thus results are collected
+// before the first object is returned. When the limit is reached, new results are skipped,
+// but paths to collected results are still added to them until the iterator is exhausted.
+func ObjectEach(ctx context.Context, it graph.Iterator, qs graph.QuadStore, limit int, fnc func(map[string]interface{})) error {
+	if limit == 0 {
+		return it.Close()
+	}
+	var (
+		objs []*Object
+		keys = make(map[interface{}]*Object)
+	)
+	err := graph.Iterate(ctx, it).On(qs).TagPathsEach(func(res graph.Value, paths []map[string]graph.Value) {
+		key := graph.ToKey(res)
+		o := keys[key]
+		if o == nil {
+			if limit >= 0 && len(objs) >= limit {
+				return
+			}
+			o = NewObject()
+			keys[key] = o
+			objs = append(objs, o)
+		}
+		for _, tags := range paths {
+			o.AddTags(tags)
+		}
+	})
+	if err != nil {
+		return err
+	}
+	for _, o := range objs {
+		v, err := o.Values(ctx, qs)
+		if err != nil {
+			return err
+		}
+		fnc(v)
+	}
+	return nil
+}
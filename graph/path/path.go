@@ -16,12 +16,15 @@ package path
 
 import (
 	"context"
+	"errors"
 	"regexp"
 
 	"github.com/cayleygraph/cayley/graph"
 	"github.com/cayleygraph/cayley/graph/iterator"
 	"github.com/cayleygraph/cayley/graph/shape"
 	"github.com/cayleygraph/cayley/quad"
+	"github.com/cayleygraph/cayley/voc/rdf"
+	"github.com/cayleygraph/cayley/voc/rdfs"
 )
 
 type applyMorphism func(shape.Shape, *pathContext) (shape.Shape, *pathContext)
@@ -72,6 +75,7 @@ type Path struct {
 	stack       []morphism
 	qs          graph.QuadStore // Optionally. A nil qs is equivalent to a morphism.
 	baseContext pathContext
+	steps       []step // calls of path methods; see MarshalJSON
 }
 
 // IsMorphism returns whether this Path is a morphism.
@@ -88,7 +92,8 @@ func StartPath(qs graph.QuadStore, nodes ...quad.Value) *Path {
 		stack: []morphism{
 			isMorphism(nodes...),
 		},
-		qs: qs,
+		qs:    qs,
+		steps: []step{{op: opIs, nodes: nodes}},
 	}
 }
 
@@ -98,16 +103,36 @@ func StartPathNodes(qs graph.QuadStore, nodes ...graph.Value) *Path {
 		stack: []morphism{
 			isNodeMorphism(nodes...),
 		},
-		qs: qs,
+		qs:    qs,
+		steps: []step{{err: errors.New("path: paths built from node references cannot be serialized")}},
 	}
 }
 
+// OnEdge creates a new Path from statement nodes that reify a given quad (edge),
+// thus properties of an edge can be traversed with Out. Nil values match any node.
+//
+// Statements are expected to follow RDF reification vocabulary, see graph.ReifyQuads.
+func OnEdge(qs graph.QuadStore, s, p, o quad.Value) *Path {
+	np := StartPath(qs)
+	if s != nil {
+		np = np.Has(quad.IRI(rdf.Subject), s)
+	}
+	if p != nil {
+		np = np.Has(quad.IRI(rdf.Predicate), p)
+	}
+	if o != nil {
+		np = np.Has(quad.IRI(rdf.Object), o)
+	}
+	return np.Has(quad.IRI(rdf.Type), quad.IRI(rdf.Statement))
+}
+
 func PathFromIterator(qs graph.QuadStore, it graph.Iterator) *Path {
 	return &Path{
 		stack: []morphism{
 			iteratorMorphism(it),
 		},
-		qs: qs,
+		qs:    qs,
+		steps: []step{{err: errors.New("path: paths built from iterators cannot be serialized")}},
 	}
 }
 
@@ -120,23 +145,26 @@ func NewPath(qs graph.QuadStore) *Path {
 
 // Clone returns a clone of the current path.
 func (p *Path) Clone() *Path {
-	stack := p.stack
+	stack, steps := p.stack, p.steps
 	return &Path{
 		stack:       stack[:len(stack):len(stack)],
 		qs:          p.qs,
 		baseContext: p.baseContext,
+		steps:       steps[:len(steps):len(steps)],
 	}
 }
 
 // Unexported clone method returns a *Path with a copy of the original stack,
 // with assumption that the new stack will be appended to.
 func (p *Path) clone() *Path {
-	stack := p.stack
+	stack, steps := p.stack, p.steps
 	p.stack = stack[:len(stack):len(stack)]
+	p.steps = steps[:len(steps):len(steps)]
 	return &Path{
 		stack:       stack,
 		qs:          p.qs,
 		baseContext: p.baseContext,
+		steps:       steps,
 	}
 }
 
@@ -149,6 +177,7 @@ func (p *Path) Reverse() *Path {
 		revMorphism, ctx = p.stack[i].Reversal(ctx)
 		newPath.stack = append(newPath.stack, revMorphism)
 	}
+	newPath.steps = []step{{op: opReverse, path: p.Clone()}}
 	return newPath
 }
 
@@ -157,6 +186,7 @@ func (p *Path) Reverse() *Path {
 func (p *Path) Is(nodes ...quad.Value) *Path {
 	np := p.clone()
 	np.stack = append(np.stack, isMorphism(nodes...))
+	np.steps = append(np.steps, step{op: opIs, nodes: nodes})
 	return np
 }
 
@@ -188,10 +218,74 @@ func (p *Path) Filter(op iterator.Operator, node quad.Value) *Path {
 	return p.Filters(shape.Comparison{Op: op, Val: node})
 }
 
+// Lang represents the nodes that are language-tagged strings with one of the provided languages.
+func (p *Path) Lang(langs ...string) *Path {
+	return p.Filters(shape.Language{Langs: langs})
+}
+
+// Prefix represents the nodes that are strings starting with a given prefix.
+func (p *Path) Prefix(prefix string) *Path {
+	return p.Filters(shape.StringMatch{Op: shape.StringPrefix, Val: prefix})
+}
+
+// Suffix represents the nodes that are strings ending with a given suffix.
+func (p *Path) Suffix(suffix string) *Path {
+	return p.Filters(shape.StringMatch{Op: shape.StringSuffix, Val: suffix})
+}
+
+// Substring represents the nodes that are strings containing a given substring.
+func (p *Path) Substring(sub string) *Path {
+	return p.Filters(shape.StringMatch{Op: shape.StringContains, Val: sub})
+}
+
+// EqualFold represents the nodes that are strings equal to a given one, ignoring the case.
+func (p *Path) EqualFold(s string) *Path {
+	return p.Filters(shape.StringMatch{Op: shape.StringEqual, Val: s, Fold: true})
+}
+
+// Length represents the nodes that are strings with a number of characters in a given range.
+// Negative max value means no upper limit.
+func (p *Path) Length(min, max int) *Path {
+	return p.Filters(shape.Length{Min: min, Max: max})
+}
+
+// Modulo represents the nodes that are integers giving a specified remainder when divided by div.
+func (p *Path) Modulo(div, rem int64) *Path {
+	return p.Filters(shape.Modulo{Div: div, Rem: rem})
+}
+
+// Search represents the nodes with string values that match a full-text query.
+// Quad store must support full-text search, see graph.TextIndexer.
+//
+// Limit is applied to search results before they are combined with the path.
+// Zero or negative value means no limit.
+func (p *Path) Search(query string, limit int) *Path {
+	np := p.clone()
+	np.stack = append(np.stack, searchMorphism(query, limit))
+	np.steps = append(np.steps, step{op: opSearch, query: query, n: int64(limit)})
+	return np
+}
+
+// NearestTo represents up to k vector values that are the closest to a given vector.
+// Quad store must support vector search, see graph.VectorIndexer.
+//
+// Nodes with embeddings can be found by following the embedding predicate in reverse:
+//
+//	path.StartPath(qs).NearestTo(vec, 10).In(quad.IRI("embedding"))
+//
+// Nearest vectors are selected before they are combined with the path.
+func (p *Path) NearestTo(vec quad.Vector, k int) *Path {
+	np := p.clone()
+	np.stack = append(np.stack, nearestMorphism(vec, k))
+	np.steps = append(np.steps, step{op: opNearest, vector: vec, n: int64(k)})
+	return np
+}
+
 // Filters represents the nodes that are passing provided filters.
 func (p *Path) Filters(filters ...shape.ValueFilter) *Path {
 	np := p.clone()
 	np.stack = append(np.stack, filterMorphism(filters))
+	np.steps = append(np.steps, step{op: opFilter, filters: filters})
 	return np
 }
 
@@ -200,6 +294,7 @@ func (p *Path) Filters(filters ...shape.ValueFilter) *Path {
 func (p *Path) Tag(tags ...string) *Path {
 	np := p.clone()
 	np.stack = append(np.stack, tagMorphism(tags...))
+	np.steps = append(np.steps, step{op: opTag, tags: tags})
 	return np
 }
 
@@ -215,6 +310,41 @@ func (p *Path) Tag(tags ...string) *Path {
 func (p *Path) Out(via ...interface{}) *Path {
 	np := p.clone()
 	np.stack = append(np.stack, outMorphism(nil, via...))
+	np.steps = append(np.steps, step{op: opOut, via: via})
+	return np
+}
+
+// OutLang is the same as Out, but only returns values in the most preferred language available for each node.
+// Languages are listed in the order of preference, and an empty string stands for strings without a language tag.
+// For example, OutLang(via, "en", "") returns English values, or untagged strings if there are no English ones.
+func (p *Path) OutLang(via interface{}, langs ...string) *Path {
+	np := p.clone()
+	np.stack = append(np.stack, outLangMorphism(via, langs))
+	np.steps = append(np.steps, step{op: opOutLang, via: []interface{}{via}, langs: langs})
+	return np
+}
+
+// LabelsIn returns human-readable labels (rdfs:label) of current nodes in the most preferred language available.
+// See OutLang for details.
+func (p *Path) LabelsIn(langs ...string) *Path {
+	return p.OutLang(quad.IRI(rdfs.Label), langs...)
+}
+
+// OutWithProvenance is the same as Out, but also tags results with an author and time of
+// the followed quads, as recorded by the "provenance" quad writer. Empty tag names are not tagged.
+func (p *Path) OutWithProvenance(author, time string, via ...interface{}) *Path {
+	np := p.clone()
+	np.stack = append(np.stack, outProvenanceMorphism(author, time, via...))
+	np.steps = append(np.steps, step{op: opOutProvenance, via: via, author: author, time: time})
+	return np
+}
+
+// InWithProvenance is the same as In, but also tags results with an author and time of
+// the followed quads, as recorded by the "provenance" quad writer. Empty tag names are not tagged.
+func (p *Path) InWithProvenance(author, time string, via ...interface{}) *Path {
+	np := p.clone()
+	np.stack = append(np.stack, inProvenanceMorphism(author, time, via...))
+	np.steps = append(np.steps, step{op: opInProvenance, via: via, author: author, time: time})
 	return np
 }
 
@@ -230,6 +360,7 @@ func (p *Path) Out(via ...interface{}) *Path {
 func (p *Path) In(via ...interface{}) *Path {
 	np := p.clone()
 	np.stack = append(np.stack, inMorphism(nil, via...))
+	np.steps = append(np.steps, step{op: opIn, via: via})
 	return np
 }
 
@@ -238,6 +369,7 @@ func (p *Path) In(via ...interface{}) *Path {
 func (p *Path) InWithTags(tags []string, via ...interface{}) *Path {
 	np := p.clone()
 	np.stack = append(np.stack, inMorphism(tags, via...))
+	np.steps = append(np.steps, step{op: opIn, via: via, tags: tags})
 	return np
 }
 
@@ -246,6 +378,7 @@ func (p *Path) InWithTags(tags []string, via ...interface{}) *Path {
 func (p *Path) OutWithTags(tags []string, via ...interface{}) *Path {
 	np := p.clone()
 	np.stack = append(np.stack, outMorphism(tags, via...))
+	np.steps = append(np.steps, step{op: opOut, via: via, tags: tags})
 	return np
 }
 
@@ -260,6 +393,7 @@ func (p *Path) OutWithTags(tags []string, via ...interface{}) *Path {
 func (p *Path) Both(via ...interface{}) *Path {
 	np := p.clone()
 	np.stack = append(np.stack, bothMorphism(nil, via...))
+	np.steps = append(np.steps, step{op: opBoth, via: via})
 	return np
 }
 
@@ -268,6 +402,7 @@ func (p *Path) Both(via ...interface{}) *Path {
 func (p *Path) BothWithTags(tags []string, via ...interface{}) *Path {
 	np := p.clone()
 	np.stack = append(np.stack, bothMorphism(tags, via...))
+	np.steps = append(np.steps, step{op: opBoth, via: via, tags: tags})
 	return np
 }
 
@@ -276,6 +411,7 @@ func (p *Path) BothWithTags(tags []string, via ...interface{}) *Path {
 func (p *Path) Labels() *Path {
 	np := p.clone()
 	np.stack = append(np.stack, labelsMorphism())
+	np.steps = append(np.steps, step{op: opLabels})
 	return np
 }
 
@@ -290,6 +426,7 @@ func (p *Path) Labels() *Path {
 func (p *Path) InPredicates() *Path {
 	np := p.clone()
 	np.stack = append(np.stack, predicatesMorphism(true))
+	np.steps = append(np.steps, step{op: opInPredicates})
 	return np
 }
 
@@ -305,6 +442,7 @@ func (p *Path) InPredicates() *Path {
 func (p *Path) OutPredicates() *Path {
 	np := p.clone()
 	np.stack = append(np.stack, predicatesMorphism(false))
+	np.steps = append(np.steps, step{op: opOutPredicates})
 	return np
 }
 
@@ -313,6 +451,7 @@ func (p *Path) OutPredicates() *Path {
 func (p *Path) SavePredicates(rev bool, tag string) *Path {
 	np := p.clone()
 	np.stack = append(np.stack, savePredicatesMorphism(rev, tag))
+	np.steps = append(np.steps, step{op: opSavePredicates, rev: rev, tag: tag})
 	return np
 }
 
@@ -321,6 +460,7 @@ func (p *Path) SavePredicates(rev bool, tag string) *Path {
 func (p *Path) And(path *Path) *Path {
 	np := p.clone()
 	np.stack = append(np.stack, andMorphism(path))
+	np.steps = append(np.steps, step{op: opAnd, path: path})
 	return np
 }
 
@@ -329,6 +469,7 @@ func (p *Path) And(path *Path) *Path {
 func (p *Path) Or(path *Path) *Path {
 	np := p.clone()
 	np.stack = append(np.stack, orMorphism(path))
+	np.steps = append(np.steps, step{op: opOr, path: path})
 	return np
 }
 
@@ -341,13 +482,33 @@ func (p *Path) Or(path *Path) *Path {
 func (p *Path) Except(path *Path) *Path {
 	np := p.clone()
 	np.stack = append(np.stack, exceptMorphism(path))
+	np.steps = append(np.steps, step{op: opExcept, path: path})
+	return np
+}
+
+// Optional follows a given morphism from the current nodes, but keeps the nodes even if the morphism matches nothing.
+// Tags set by the morphism are only present in results of the nodes it matches. The morphism does not change
+// the current nodes, traversal continues from them.
+//
+// For example:
+//  // Will return all followers of "bob", and tag statuses of those that have one
+//  StartPath(qs, "bob").In("follows").Optional(StartMorphism().Out("status").Tag("status"))
+func (p *Path) Optional(path *Path) *Path {
+	np := p.clone()
+	np.stack = append(np.stack, optionalMorphism(path))
+	np.steps = append(np.steps, step{op: opOptional, path: path})
 	return np
 }
 
 // Unique updates the current Path to contain only unique nodes.
+//
+// It can be placed at any point of the path. Placing it before steps that multiply the number of results
+// (like Out or In) allows to remove duplicates early instead of processing all of them.
+// Note that only the first path to each node is kept, thus tags of other paths are lost.
 func (p *Path) Unique() *Path {
 	np := p.clone()
 	np.stack = append(np.stack, uniqueMorphism())
+	np.steps = append(np.steps, step{op: opUnique})
 	return np
 }
 
@@ -356,6 +517,7 @@ func (p *Path) Unique() *Path {
 func (p *Path) Follow(path *Path) *Path {
 	np := p.clone()
 	np.stack = append(np.stack, followMorphism(path))
+	np.steps = append(np.steps, step{op: opFollow, path: path})
 	return np
 }
 
@@ -364,6 +526,7 @@ func (p *Path) Follow(path *Path) *Path {
 func (p *Path) FollowReverse(path *Path) *Path {
 	np := p.clone()
 	np.stack = append(np.stack, followMorphism(path.Reverse()))
+	np.steps = append(np.steps, step{op: opFollowReverse, path: path})
 	return np
 }
 
@@ -385,7 +548,18 @@ func (p *Path) FollowReverse(path *Path) *Path {
 //
 // This is a very expensive operation in practice. Be sure to use it wisely.
 func (p *Path) FollowRecursive(via interface{}, maxDepth int, depthTags []string) *Path {
-	var path *Path
+	return p.FollowRecursiveWith(via, depthTags, iterator.RecursiveOptions{MaxDepth: maxDepth})
+}
+
+// FollowRecursiveWith is the same as FollowRecursive, but allows to set the traversal strategy,
+// limit the number of results and report cycles. See iterator.RecursiveOptions for details.
+//
+// If spilling is not configured in options, the global iterator.Spill settings are used.
+func (p *Path) FollowRecursiveWith(via interface{}, depthTags []string, opt iterator.RecursiveOptions) *Path {
+	var (
+		path *Path
+		st   = step{op: opFollowRecursive, via: []interface{}{via}, tags: depthTags, opt: opt}
+	)
 	switch v := via.(type) {
 	case string:
 		path = StartMorphism().Out(v)
@@ -397,7 +571,8 @@ func (p *Path) FollowRecursive(via interface{}, maxDepth int, depthTags []string
 		panic("did not pass a string predicate or a Path to FollowRecursive")
 	}
 	np := p.clone()
-	np.stack = append(p.stack, followRecursiveMorphism(path, maxDepth, depthTags))
+	np.stack = append(p.stack, followRecursiveMorphism(path, opt, depthTags))
+	np.steps = append(np.steps, st)
 	return np
 }
 
@@ -411,6 +586,24 @@ func (p *Path) FollowRecursive(via interface{}, maxDepth int, depthTags []string
 func (p *Path) Save(via interface{}, tag string) *Path {
 	np := p.clone()
 	np.stack = append(np.stack, saveMorphism(via, tag))
+	np.steps = append(np.steps, step{op: opSave, via: []interface{}{via}, tag: tag})
+	return np
+}
+
+// SaveLang is the same as Save, but only saves values in the most preferred language available for each node.
+// See OutLang for details.
+func (p *Path) SaveLang(via interface{}, tag string, langs ...string) *Path {
+	np := p.clone()
+	np.stack = append(np.stack, saveLangMorphism(via, tag, false, langs))
+	np.steps = append(np.steps, step{op: opSaveLang, via: []interface{}{via}, tag: tag, langs: langs})
+	return np
+}
+
+// SaveOptionalLang is the same as SaveLang, but does not require linkage to exist.
+func (p *Path) SaveOptionalLang(via interface{}, tag string, langs ...string) *Path {
+	np := p.clone()
+	np.stack = append(np.stack, saveLangMorphism(via, tag, true, langs))
+	np.steps = append(np.steps, step{op: opSaveOptionalLang, via: []interface{}{via}, tag: tag, langs: langs})
 	return np
 }
 
@@ -419,6 +612,7 @@ func (p *Path) Save(via interface{}, tag string) *Path {
 func (p *Path) SaveReverse(via interface{}, tag string) *Path {
 	np := p.clone()
 	np.stack = append(np.stack, saveReverseMorphism(via, tag))
+	np.steps = append(np.steps, step{op: opSaveReverse, via: []interface{}{via}, tag: tag})
 	return np
 }
 
@@ -426,6 +620,7 @@ func (p *Path) SaveReverse(via interface{}, tag string) *Path {
 func (p *Path) SaveOptional(via interface{}, tag string) *Path {
 	np := p.clone()
 	np.stack = append(np.stack, saveOptionalMorphism(via, tag))
+	np.steps = append(np.steps, step{op: opSaveOptional, via: []interface{}{via}, tag: tag})
 	return np
 }
 
@@ -433,6 +628,7 @@ func (p *Path) SaveOptional(via interface{}, tag string) *Path {
 func (p *Path) SaveOptionalReverse(via interface{}, tag string) *Path {
 	np := p.clone()
 	np.stack = append(np.stack, saveOptionalReverseMorphism(via, tag))
+	np.steps = append(np.steps, step{op: opSaveOptionalReverse, via: []interface{}{via}, tag: tag})
 	return np
 }
 
@@ -441,6 +637,7 @@ func (p *Path) SaveOptionalReverse(via interface{}, tag string) *Path {
 func (p *Path) Has(via interface{}, nodes ...quad.Value) *Path {
 	np := p.clone()
 	np.stack = append(np.stack, hasMorphism(via, false, nodes...))
+	np.steps = append(np.steps, step{op: opHas, via: []interface{}{via}, nodes: nodes})
 	return np
 }
 
@@ -449,6 +646,7 @@ func (p *Path) Has(via interface{}, nodes ...quad.Value) *Path {
 func (p *Path) HasReverse(via interface{}, nodes ...quad.Value) *Path {
 	np := p.clone()
 	np.stack = append(np.stack, hasMorphism(via, true, nodes...))
+	np.steps = append(np.steps, step{op: opHas, via: []interface{}{via}, rev: true, nodes: nodes})
 	return np
 }
 
@@ -457,6 +655,7 @@ func (p *Path) HasReverse(via interface{}, nodes ...quad.Value) *Path {
 func (p *Path) HasFilter(via interface{}, rev bool, filt ...shape.ValueFilter) *Path {
 	np := p.clone()
 	np.stack = append(np.stack, hasFilterMorphism(via, rev, filt))
+	np.steps = append(np.steps, step{op: opHasFilter, via: []interface{}{via}, rev: rev, filters: filt})
 	return np
 }
 
@@ -465,6 +664,7 @@ func (p *Path) HasFilter(via interface{}, rev bool, filt ...shape.ValueFilter) *
 func (p *Path) LabelContext(via ...interface{}) *Path {
 	np := p.clone()
 	np.stack = append(np.stack, labelContextMorphism(nil, via...))
+	np.steps = append(np.steps, step{op: opLabelContext, via: via})
 	return np
 }
 
@@ -473,6 +673,7 @@ func (p *Path) LabelContext(via ...interface{}) *Path {
 func (p *Path) LabelContextWithTags(tags []string, via ...interface{}) *Path {
 	np := p.clone()
 	np.stack = append(np.stack, labelContextMorphism(tags, via...))
+	np.steps = append(np.steps, step{op: opLabelContext, via: via, tags: tags})
 	return np
 }
 
@@ -487,14 +688,19 @@ func (p *Path) Back(tag string) *Path {
 	ctx := &newPath.baseContext
 	for {
 		if i < 0 {
-			return p.Reverse()
+			np := p.Reverse()
+			np.steps = p.stepsWith(step{op: opBack, tag: tag})
+			return np
 		}
 		if p.stack[i].IsTag {
 			for _, x := range p.stack[i].tags {
 				if x == tag {
 					// Found what we're looking for.
+					steps := p.stepsWith(step{op: opBack, tag: tag})
 					p.stack = p.stack[:i+1]
-					return p.And(newPath)
+					np := p.And(newPath)
+					np.steps = steps
+					return np
 				}
 			}
 		}
@@ -534,18 +740,28 @@ func (p *Path) Morphism() graph.ApplyMorphism {
 // Skip will omit a number of values from result set.
 func (p *Path) Skip(v int64) *Path {
 	p.stack = append(p.stack, skipMorphism(v))
+	p.steps = append(p.steps, step{op: opSkip, n: v})
 	return p
 }
 
 // Limit will limit a number of values in result set.
 func (p *Path) Limit(v int64) *Path {
 	p.stack = append(p.stack, limitMorphism(v))
+	p.steps = append(p.steps, step{op: opLimit, n: v})
 	return p
 }
 
 // Count will count a number of results as it's own result set.
 func (p *Path) Count() *Path {
 	p.stack = append(p.stack, countMorphism())
+	p.steps = append(p.steps, step{op: opCount})
+	return p
+}
+
+// CountDistinct will count a number of unique results as it's own result set.
+func (p *Path) CountDistinct() *Path {
+	p.stack = append(p.stack, uniqueMorphism(), countMorphism())
+	p.steps = append(p.steps, step{op: opCountDistinct})
 	return p
 }
 
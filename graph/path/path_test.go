@@ -15,12 +15,218 @@
 package path_test
 
 import (
+	"context"
+	"encoding/json"
+	"reflect"
+	"strings"
 	"testing"
 
-	_ "github.com/cayleygraph/cayley/graph/memstore"
+	"github.com/cayleygraph/cayley/graph"
+	"github.com/cayleygraph/cayley/graph/iterator"
+	"github.com/cayleygraph/cayley/graph/memstore"
+	"github.com/cayleygraph/cayley/graph/path"
 	"github.com/cayleygraph/cayley/graph/path/pathtest"
+	"github.com/cayleygraph/cayley/quad"
+	_ "github.com/cayleygraph/cayley/writer"
 )
 
 func TestMorphisms(t *testing.T) {
 	pathtest.RunTestMorphisms(t, nil)
 }
+
+func TestOnEdge(t *testing.T) {
+	qs := memstore.New()
+	qw, err := graph.NewQuadWriter("single", qs, graph.Options{"ignore_duplicate": true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	weight := quad.IRI("weight")
+	e1 := quad.MakeIRI("alice", "follows", "bob", "")
+	e2 := quad.MakeIRI("alice", "follows", "charlie", "")
+	if _, err = graph.AddEdge(qw, e1, map[quad.IRI]quad.Value{weight: quad.Int(3)}); err != nil {
+		t.Fatal(err)
+	} else if _, err = graph.AddEdge(qw, e2, map[quad.IRI]quad.Value{weight: quad.Int(5)}); err != nil {
+		t.Fatal(err)
+	}
+	got, err := path.OnEdge(qs, e1.Subject, e1.Predicate, e1.Object).Out(weight).Iterate(context.TODO()).AllValues(qs)
+	if err != nil {
+		t.Fatal(err)
+	} else if !reflect.DeepEqual(got, []quad.Value{quad.Int(3)}) {
+		t.Fatalf("unexpected edge properties: %v", got)
+	}
+	got, err = path.OnEdge(qs, quad.IRI("alice"), nil, nil).Out(weight).Iterate(context.TODO()).AllValues(qs)
+	if err != nil {
+		t.Fatal(err)
+	} else if len(got) != 2 {
+		t.Fatalf("unexpected edge properties: %v", got)
+	}
+	got, err = path.StartPath(qs, quad.IRI("alice")).Out(quad.IRI("follows")).Iterate(context.TODO()).AllValues(qs)
+	if err != nil {
+		t.Fatal(err)
+	} else if len(got) != 2 {
+		t.Fatalf("expected edges to be added: %v", got)
+	}
+}
+
+func TestObjectEach(t *testing.T) {
+	qs := memstore.New()
+	qw, err := graph.NewQuadWriter("single", qs, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = qw.AddQuadSet([]quad.Quad{
+		quad.MakeIRI("alice", "follows", "bob", ""),
+		quad.MakeIRI("alice", "follows", "charlie", ""),
+		quad.Make(quad.IRI("alice"), quad.IRI("name"), "Alice", nil),
+		quad.Make(quad.IRI("bob"), quad.IRI("name"), "Bob", nil),
+		quad.Make(quad.IRI("charlie"), quad.IRI("name"), "Charlie", nil),
+		quad.Make(quad.IRI("charlie"), quad.IRI("name"), "Chuck", nil),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	p := path.StartPath(qs, quad.IRI("alice")).Tag("id").
+		Save(quad.IRI("name"), "name").
+		Out(quad.IRI("follows")).Tag("friend").
+		Save(quad.IRI("name"), "friend.name").
+		Back("id")
+	var got []map[string]interface{}
+	err = p.ObjectEach(context.TODO(), -1, func(o map[string]interface{}) {
+		got = append(got, o)
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	expect := []map[string]interface{}{{
+		"id":   quad.IRI("alice"),
+		"name": quad.String("Alice"),
+		"friend": []interface{}{
+			map[string]interface{}{"id": quad.IRI("bob"), "name": quad.String("Bob")},
+			map[string]interface{}{"id": quad.IRI("charlie"), "name": []interface{}{quad.String("Charlie"), quad.String("Chuck")}},
+		},
+	}}
+	if len(got) == 1 {
+		// order of paths is not defined
+		if friends, ok := got[0]["friend"].([]interface{}); ok && len(friends) == 2 {
+			if friends[0].(map[string]interface{})["id"] != quad.IRI("bob") {
+				friends[0], friends[1] = friends[1], friends[0]
+			}
+			if names, ok := friends[1].(map[string]interface{})["name"].([]interface{}); ok && len(names) == 2 && names[0] != quad.String("Charlie") {
+				names[0], names[1] = names[1], names[0]
+			}
+		}
+	}
+	if !reflect.DeepEqual(got, expect) {
+		t.Fatalf("unexpected objects: %v", got)
+	}
+
+	got = nil
+	err = path.StartPath(qs, quad.IRI("alice"), quad.IRI("bob"), quad.IRI("charlie")).Tag("id").
+		Save(quad.IRI("name"), "name").
+		ObjectEach(context.TODO(), 2, func(o map[string]interface{}) {
+			got = append(got, o)
+		})
+	if err != nil {
+		t.Fatal(err)
+	} else if len(got) != 2 {
+		t.Fatalf("expected 2 objects, got: %v", got)
+	}
+}
+
+func TestObjectEachLimit(t *testing.T) {
+	qs := memstore.New(
+		quad.MakeIRI("a", "name", "x", ""),
+		quad.MakeIRI("b", "name", "y", ""),
+	)
+	a, b := qs.ValueOf(quad.IRI("a")), qs.ValueOf(quad.IRI("b"))
+	x, y := qs.ValueOf(quad.IRI("x")), qs.ValueOf(quad.IRI("y"))
+	tagged := func(v, tag graph.Value) graph.Iterator {
+		it := iterator.NewFixed(v)
+		it.Tagger().AddFixed("tag", tag)
+		return it
+	}
+	// a path to the first result follows a result that is above the limit
+	it := iterator.NewOr(tagged(a, x), tagged(b, x), tagged(a, y))
+	var got []map[string]interface{}
+	err := path.ObjectEach(context.TODO(), it, qs, 1, func(o map[string]interface{}) {
+		got = append(got, o)
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	expect := []map[string]interface{}{{
+		"tag": []interface{}{quad.IRI("x"), quad.IRI("y")},
+	}}
+	if !reflect.DeepEqual(got, expect) {
+		t.Fatalf("unexpected objects: %v", got)
+	}
+}
+
+func TestPathJSON(t *testing.T) {
+	p := path.StartMorphism(quad.IRI("alice"), quad.String("say \"hi\"")).
+		Out(quad.IRI("follows")).Tag("x").
+		Filter(iterator.CompareGT, quad.Int(3)).
+		Has(quad.IRI("status"), quad.LangString{Value: "cool", Lang: "en"}).
+		Limit(5)
+	data, err := json.Marshal(p)
+	if err != nil {
+		t.Fatal(err)
+	}
+	const expect = `[{"op":"is","nodes":["<alice>","\"say \\\"hi\\\"\""]},` +
+		`{"op":"out","via":["<follows>"]},{"op":"tag","tags":["x"]},` +
+		`{"op":"filter","filters":[{"type":"compare","op":"gt","value":"\"3\"^^<schema:Integer>"}]},` +
+		`{"op":"has","via":["<status>"],"nodes":["\"cool\"@en"]},{"op":"limit","n":5}]`
+	var got, exp interface{}
+	if err = json.Unmarshal(data, &got); err != nil {
+		t.Fatal(err)
+	} else if err = json.Unmarshal([]byte(expect), &exp); err != nil {
+		t.Fatal(err)
+	} else if !reflect.DeepEqual(got, exp) {
+		t.Fatalf("unexpected encoding:\n%s\nvs\n%s", data, expect)
+	}
+	p2 := path.StartMorphism()
+	if err = json.Unmarshal(data, p2); err != nil {
+		t.Fatal(err)
+	}
+	if s1, s2 := p.Shape(), p2.Shape(); !reflect.DeepEqual(s1, s2) {
+		t.Fatalf("paths are different:\n%#v\nvs\n%#v", s1, s2)
+	}
+
+	if _, err = json.Marshal(path.StartPathNodes(nil)); err == nil {
+		t.Fatal("expected an error for node references")
+	}
+	for _, s := range []string{
+		`[{"op":"exec"}]`,
+		`[{"op":"and"}]`,
+		`[{"op":"is","nodes":["bad value"]}]`,
+		`[{"op":"filter","filters":[{"type":"regexp","value":"("}]}]`,
+		`[{"op":"follow_recursive","via":["<follows>"],"max_depth":-1}]`,
+		`[{"op":"follow_recursive","via":["<follows>"],"max_results":-1}]`,
+	} {
+		if err = json.Unmarshal([]byte(s), path.StartMorphism()); err == nil {
+			t.Fatalf("expected an error for %s", s)
+		}
+	}
+}
+
+func TestPathJSONLimits(t *testing.T) {
+	nested := func(n int) string {
+		s := `[{"op":"out"}]`
+		for i := 0; i < n; i++ {
+			s = `[{"op":"and","path":` + s + `}]`
+		}
+		return s
+	}
+	if err := json.Unmarshal([]byte(nested(path.MaxJSONDepth-1)), path.StartMorphism()); err != nil {
+		t.Fatal(err)
+	} else if err = json.Unmarshal([]byte(nested(path.MaxJSONDepth)), path.StartMorphism()); err == nil {
+		t.Fatal("expected an error for deeply nested paths")
+	}
+
+	steps := strings.Repeat(`{"op":"out","via":["<follows>"]},`, path.MaxJSONSteps)
+	if err := json.Unmarshal([]byte("["+steps[:len(steps)-1]+"]"), path.StartMorphism()); err != nil {
+		t.Fatal(err)
+	} else if err = json.Unmarshal([]byte("["+steps+`{"op":"out"}]`), path.StartMorphism()); err == nil {
+		t.Fatal("expected an error for too many steps")
+	}
+}
@@ -16,6 +16,7 @@ package pathtest
 
 import (
 	"context"
+	"encoding/json"
 	"reflect"
 	"regexp"
 	"sort"
@@ -29,6 +30,7 @@ import (
 	"github.com/cayleygraph/cayley/graph/iterator"
 	"github.com/cayleygraph/cayley/graph/shape"
 	"github.com/cayleygraph/cayley/quad"
+	"github.com/cayleygraph/cayley/voc/rdfs"
 	_ "github.com/cayleygraph/cayley/writer"
 )
 
@@ -166,6 +168,36 @@ func testSet(qs graph.QuadStore) []test {
 			path:    StartPath(qs, vBob).In(vFollows).RegexWithRefs(regexp.MustCompile("ar?li.*e")),
 			expect:  []quad.Value{vAlice, vCharlie},
 		},
+		{
+			message: "out with prefix",
+			path:    StartPath(qs, vGreg).Out(vStatus).Prefix("cool"),
+			expect:  []quad.Value{vCool},
+		},
+		{
+			message: "in with prefix (ignore IRIs)",
+			path:    StartPath(qs, vBob).In(vFollows).Prefix("al"),
+			expect:  nil,
+		},
+		{
+			message: "out with suffix",
+			path:    StartPath(qs, vGreg).Out(vStatus).Suffix("_person"),
+			expect:  []quad.Value{vCool, vSmart},
+		},
+		{
+			message: "out with substring",
+			path:    StartPath(qs, vGreg).Out(vStatus).Substring("art"),
+			expect:  []quad.Value{vSmart},
+		},
+		{
+			message: "out with case-insensitive equality",
+			path:    StartPath(qs, vGreg).Out(vStatus).EqualFold("COOL_Person"),
+			expect:  []quad.Value{vCool},
+		},
+		{
+			message: "out with length",
+			path:    StartPath(qs, vGreg).Out(vStatus).Length(0, 11),
+			expect:  []quad.Value{vCool},
+		},
 		{
 			message: "path Out",
 			path:    StartPath(qs, vBob).Out(StartPath(qs, vPredicate).Out(vAre)),
@@ -276,6 +308,16 @@ func testSet(qs graph.QuadStore) []test {
 				{vGreg},
 			},
 		},
+		{
+			message: "Unique in the middle",
+			path:    StartPath(qs, vAlice, vCharlie, vDani).Out(vFollows).Unique().Out(vStatus),
+			expect:  []quad.Value{vCool, vCool, vCool, vSmart},
+		},
+		{
+			message: "CountDistinct",
+			path:    StartPath(qs, vAlice, vCharlie, vDani).Out(vFollows).CountDistinct(),
+			expect:  []quad.Value{quad.Int(3)},
+		},
 		{
 			message: "Count",
 			path:    StartPath(qs).Has(vStatus).Count(),
@@ -373,6 +415,23 @@ func testSet(qs graph.QuadStore) []test {
 			tag:     "statustag",
 			expect:  []quad.Value{vCool, vCool},
 		},
+		{
+			message: "optional path still returns top level",
+			path:    StartPath(qs, vAlice, vGreg).Optional(StartMorphism().Out(vFollows).Tag("followtag")),
+			expect:  []quad.Value{vAlice, vGreg},
+		},
+		{
+			message: "optional path has the appropriate tags",
+			path:    StartPath(qs, vAlice, vGreg).Optional(StartMorphism().Out(vFollows).Tag("followtag")),
+			tag:     "followtag",
+			expect:  []quad.Value{vBob},
+		},
+		{
+			message: "optional path on all nodes",
+			path:    StartPath(qs).Optional(StartMorphism().Out(vStatus).Tag("statustag")),
+			tag:     "statustag",
+			expect:  []quad.Value{vCool, vCool, vCool, vSmart, vSmart},
+		},
 		{
 			message: "composite paths (clone paths)",
 			path: func() *Path {
@@ -399,6 +458,7 @@ func testSet(qs graph.QuadStore) []test {
 func RunTestMorphisms(t *testing.T, fnc testutil.DatabaseFunc) {
 	for _, ftest := range []func(*testing.T, testutil.DatabaseFunc){
 		testFollowRecursive,
+		testLangPreference,
 	} {
 		ftest(t, fnc)
 	}
@@ -406,24 +466,41 @@ func RunTestMorphisms(t *testing.T, fnc testutil.DatabaseFunc) {
 	defer closer()
 
 	for _, test := range testSet(qs) {
-		for _, opt := range []bool{true, false} {
-			name := test.message
-			if !opt {
-				name += " (unoptimized)"
-			}
+		for _, mode := range []struct {
+			suffix string
+			opt    bool
+			json   bool
+		}{
+			{opt: true},
+			{suffix: " (unoptimized)"},
+			{suffix: " (json)", opt: true, json: true},
+		} {
+			name, opt := test.message+mode.suffix, mode.opt
 			t.Run(name, func(t *testing.T) {
 				if test.skip {
 					t.SkipNow()
 				}
+				p := test.path
+				if mode.json {
+					// path must work the same way after a roundtrip through JSON
+					data, err := json.Marshal(p)
+					if err != nil {
+						t.Fatal(err)
+					}
+					p = NewPath(qs)
+					if err = json.Unmarshal(data, p); err != nil {
+						t.Fatalf("%v\n%s", err, data)
+					}
+				}
 				var (
 					got []quad.Value
 					err error
 				)
 				start := time.Now()
 				if test.tag == "" {
-					got, err = runTopLevel(qs, test.path, opt)
+					got, err = runTopLevel(qs, p, opt)
 				} else {
-					got, err = runTag(qs, test.path, test.tag, opt)
+					got, err = runTag(qs, p, test.tag, opt)
 				}
 				dt := time.Since(start)
 				if err != nil {
@@ -494,3 +571,81 @@ func testFollowRecursive(t *testing.T, fnc testutil.DatabaseFunc) {
 		})
 	}
 }
+
+func testLangPreference(t *testing.T, fnc testutil.DatabaseFunc) {
+	label := quad.IRI(rdfs.Label)
+	lang := func(s, l string) quad.Value {
+		return quad.LangString{Value: quad.String(s), Lang: l}
+	}
+	qs, closer := makeTestStore(t, fnc, []quad.Quad{
+		quad.Make(quad.IRI("a"), label, lang("A", "en"), nil),
+		quad.Make(quad.IRI("a"), label, lang("A", "de"), nil),
+		quad.Make(quad.IRI("a"), label, quad.String("a"), nil),
+		quad.Make(quad.IRI("b"), label, lang("B", "de"), nil),
+		quad.Make(quad.IRI("b"), label, quad.String("b"), nil),
+		quad.Make(quad.IRI("c"), label, quad.String("c"), nil),
+		quad.Make(quad.IRI("d"), label, lang("D", "EN"), nil),
+		quad.Make(quad.IRI("e"), quad.IRI("parent"), quad.IRI("a"), nil),
+	}...)
+	defer closer()
+
+	nodes := []quad.Value{quad.IRI("a"), quad.IRI("b"), quad.IRI("c"), quad.IRI("d"), quad.IRI("e")}
+	for _, c := range []struct {
+		msg    string
+		path   *Path
+		tag    string
+		expect []quad.Value
+	}{
+		{
+			msg:    "labels with fallback",
+			path:   StartPath(qs, nodes...).LabelsIn("en", "de"),
+			expect: []quad.Value{lang("A", "en"), lang("B", "de"), lang("D", "EN")},
+		},
+		{
+			msg:    "labels with fallback to plain strings",
+			path:   StartPath(qs, nodes...).LabelsIn("de", ""),
+			expect: []quad.Value{lang("A", "de"), lang("B", "de"), quad.String("c")},
+		},
+		{
+			msg:    "save with fallback",
+			path:   StartPath(qs).SaveLang(label, "name", "en", ""),
+			tag:    "name",
+			expect: []quad.Value{lang("A", "en"), quad.String("b"), quad.String("c"), lang("D", "EN")},
+		},
+		{
+			msg:  "save optional with fallback",
+			path: StartPath(qs, nodes...).SaveOptionalLang(label, "name", "de").Tag("id"),
+			tag:  "id",
+			// all nodes are returned
+			expect: nodes,
+		},
+	} {
+		for _, opt := range []bool{true, false} {
+			unopt := ""
+			if !opt {
+				unopt = " (unoptimized)"
+			}
+			t.Run(c.msg+unopt, func(t *testing.T) {
+				var (
+					got []quad.Value
+					err error
+				)
+				if c.tag == "" {
+					got, err = runTopLevel(qs, c.path, opt)
+				} else {
+					got, err = runTag(qs, c.path, c.tag, opt)
+				}
+				if err != nil {
+					t.Errorf("Failed to check %s%s: %v", c.msg, unopt, err)
+					return
+				}
+				expect := append([]quad.Value{}, c.expect...)
+				sort.Sort(quad.ByValueString(got))
+				sort.Sort(quad.ByValueString(expect))
+				if !reflect.DeepEqual(got, expect) {
+					t.Errorf("Failed to %s%s, got: %v(%d) expected: %v(%d)", c.msg, unopt, got, len(got), expect, len(expect))
+				}
+			})
+		}
+	}
+}
@@ -0,0 +1,100 @@
+package graph
+
+import (
+	"context"
+	"crypto/sha1"
+	"encoding/hex"
+	"time"
+
+	"github.com/cayleygraph/cayley/quad"
+)
+
+// Vocabulary of provenance records. Records are stored as quads with ProvenanceGraph label:
+//
+//	_:stmt<hash> <cayley:tx> _:tx<id> <cayley:provenance> .
+//	_:tx<id> <cayley:author> "author" <cayley:provenance> .
+//	_:tx<id> <cayley:time> "time"^^<xsd:dateTime> <cayley:provenance> .
+//
+// Each added quad is linked to a node of the transaction that added it, thus the overhead is one quad per added quad.
+const (
+	ProvenanceGraph  = quad.IRI("cayley:provenance")
+	ProvenanceTx     = quad.IRI("cayley:tx")
+	ProvenanceAuthor = quad.IRI("cayley:author")
+	ProvenanceTime   = quad.IRI("cayley:time")
+)
+
+// StatementNode returns a node that identifies a given quad in provenance records and reified statements.
+func StatementNode(q quad.Quad) quad.BNode {
+	h := sha1.Sum([]byte(q.NQuad()))
+	return quad.BNode("stmt" + hex.EncodeToString(h[:]))
+}
+
+// ProvenanceRecord describes who and when added a quad.
+type ProvenanceRecord struct {
+	Tx     quad.BNode // node of the transaction that added the quad
+	Author string
+	Time   time.Time
+}
+
+// Quads returns quads that describe a transaction of the record.
+func (r ProvenanceRecord) Quads() []quad.Quad {
+	out := make([]quad.Quad, 0, 2)
+	if r.Author != "" {
+		out = append(out, quad.Quad{Subject: r.Tx, Predicate: ProvenanceAuthor, Object: quad.String(r.Author), Label: ProvenanceGraph})
+	}
+	if !r.Time.IsZero() {
+		out = append(out, quad.Quad{Subject: r.Tx, Predicate: ProvenanceTime, Object: quad.Time(r.Time), Label: ProvenanceGraph})
+	}
+	return out
+}
+
+// provenanceObjects returns refs to objects of quads with a given subject and predicate in provenance graph.
+func provenanceObjects(qs QuadStore, s quad.Value, pred quad.IRI) ([]Value, error) {
+	gs, gp, gl := qs.ValueOf(s), qs.ValueOf(pred), qs.ValueOf(ProvenanceGraph)
+	if gs == nil || gp == nil || gl == nil {
+		return nil, nil
+	}
+	pk, lk := ToKey(gp), ToKey(gl)
+	it := qs.QuadIterator(quad.Subject, gs)
+	defer it.Close()
+	var out []Value
+	ctx := context.TODO()
+	for it.Next(ctx) {
+		ref := it.Result()
+		if ToKey(qs.QuadDirection(ref, quad.Predicate)) != pk || ToKey(qs.QuadDirection(ref, quad.Label)) != lk {
+			continue
+		}
+		out = append(out, qs.QuadDirection(ref, quad.Object))
+	}
+	return out, it.Err()
+}
+
+// Provenance returns a record of who and when added a given quad. It returns nil if there is no record for the quad.
+//
+// Records are written by the "provenance" quad writer.
+func Provenance(qs QuadStore, q quad.Quad) (*ProvenanceRecord, error) {
+	txs, err := provenanceObjects(qs, StatementNode(q), ProvenanceTx)
+	if err != nil || len(txs) == 0 {
+		return nil, err
+	}
+	tx, ok := qs.NameOf(txs[0]).(quad.BNode)
+	if !ok {
+		return nil, nil
+	}
+	rec := &ProvenanceRecord{Tx: tx}
+	authors, err := provenanceObjects(qs, tx, ProvenanceAuthor)
+	if err != nil {
+		return nil, err
+	} else if len(authors) != 0 {
+		rec.Author = quad.ToString(qs.NameOf(authors[0]))
+	}
+	times, err := provenanceObjects(qs, tx, ProvenanceTime)
+	if err != nil {
+		return nil, err
+	} else if len(times) != 0 {
+		if t, ok := qs.NameOf(times[0]).(quad.Time); ok {
+			rec.Time = time.Time(t)
+		}
+	}
+	return rec, nil
+}
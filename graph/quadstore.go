@@ -26,25 +26,142 @@ import (
 	"errors"
 	"fmt"
 	"reflect"
+	"strings"
+	"time"
 
 	"github.com/cayleygraph/cayley/quad"
 )
 
+// BatchResolver is an optional interface for quad stores that can resolve
+// multiple values in a single round-trip to the backend.
+type BatchResolver interface {
+	// RefsOf is a batch version of QuadStore.ValueOf.
+	// Values that are not present in the store may be returned as nil.
+	RefsOf(ctx context.Context, vals []quad.Value) ([]Value, error)
+	// NamesOf is a batch version of QuadStore.NameOf.
+	NamesOf(ctx context.Context, refs []Value) ([]quad.Value, error)
+}
+
+// BatchQuadStore is an optional interface for quad stores that can load multiple values at once.
+//
+// Deprecated: implement BatchResolver instead. NamesOf still uses this interface if BatchResolver
+// is not implemented.
 type BatchQuadStore interface {
 	ValuesOf(ctx context.Context, vals []Value) ([]quad.Value, error)
 }
 
+// ValuesOf returns values for a set of references.
+//
+// Deprecated: use NamesOf.
 func ValuesOf(ctx context.Context, qs QuadStore, vals []Value) ([]quad.Value, error) {
-	if bq, ok := qs.(BatchQuadStore); ok {
-		return bq.ValuesOf(ctx, vals)
+	return NamesOf(ctx, qs, vals)
+}
+
+// RefsOf returns references for a set of values.
+// It will use BatchResolver if the quad store implements it.
+func RefsOf(ctx context.Context, qs QuadStore, vals []quad.Value) ([]Value, error) {
+	if br, ok := qs.(BatchResolver); ok {
+		return br.RefsOf(ctx, vals)
 	}
-	out := make([]quad.Value, len(vals))
+	out := make([]Value, len(vals))
 	for i, v := range vals {
+		out[i] = qs.ValueOf(v)
+	}
+	return out, nil
+}
+
+// NamesOf returns values for a set of references.
+// It will use BatchResolver or BatchQuadStore if the quad store implements it.
+func NamesOf(ctx context.Context, qs QuadStore, refs []Value) ([]quad.Value, error) {
+	switch qs := qs.(type) {
+	case BatchResolver:
+		return qs.NamesOf(ctx, refs)
+	case BatchQuadStore:
+		return qs.ValuesOf(ctx, refs)
+	}
+	out := make([]quad.Value, len(refs))
+	for i, v := range refs {
 		out[i] = qs.NameOf(v)
 	}
 	return out, nil
 }
 
+// ContextQuadStore is an optional interface for quad stores that make round-trips to the backend
+// to resolve values, quads or the size of the store. Methods are the same as in QuadStore, but they
+// stop when the context is cancelled and return errors instead of logging them.
+type ContextQuadStore interface {
+	// ValueOfContext is the same as QuadStore.ValueOf.
+	ValueOfContext(ctx context.Context, v quad.Value) (Value, error)
+	// NameOfContext is the same as QuadStore.NameOf.
+	NameOfContext(ctx context.Context, v Value) (quad.Value, error)
+	// QuadContext is the same as QuadStore.Quad.
+	QuadContext(ctx context.Context, v Value) (quad.Quad, error)
+	// SizeContext is the same as QuadStore.Size.
+	SizeContext(ctx context.Context) (int64, error)
+}
+
+// ValueOf returns a reference for a value. It will use ContextQuadStore or BatchResolver
+// if the quad store implements it, thus the request can be cancelled.
+func ValueOf(ctx context.Context, qs QuadStore, v quad.Value) (Value, error) {
+	switch qs := qs.(type) {
+	case ContextQuadStore:
+		return qs.ValueOfContext(ctx, v)
+	case BatchResolver:
+		out, err := qs.RefsOf(ctx, []quad.Value{v})
+		if err != nil {
+			return nil, err
+		}
+		return out[0], nil
+	}
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	return qs.ValueOf(v), nil
+}
+
+// NameOf returns a value for a reference. It will use ContextQuadStore or BatchResolver
+// if the quad store implements it, thus the request can be cancelled.
+func NameOf(ctx context.Context, qs QuadStore, v Value) (quad.Value, error) {
+	switch qs := qs.(type) {
+	case ContextQuadStore:
+		return qs.NameOfContext(ctx, v)
+	case BatchResolver:
+		out, err := qs.NamesOf(ctx, []Value{v})
+		if err != nil {
+			return nil, err
+		}
+		return out[0], nil
+	}
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	return qs.NameOf(v), nil
+}
+
+// QuadOf returns a quad for a reference. It will use ContextQuadStore if the quad store implements it,
+// thus the request can be cancelled.
+func QuadOf(ctx context.Context, qs QuadStore, v Value) (quad.Quad, error) {
+	if cqs, ok := qs.(ContextQuadStore); ok {
+		return cqs.QuadContext(ctx, v)
+	}
+	if err := ctx.Err(); err != nil {
+		return quad.Quad{}, err
+	}
+	return qs.Quad(v), nil
+}
+
+// SizeOf returns the number of quads in the store. It will use ContextQuadStore if the quad store implements it,
+// thus the request can be cancelled.
+func SizeOf(ctx context.Context, qs QuadStore) (int64, error) {
+	if cqs, ok := qs.(ContextQuadStore); ok {
+		return cqs.SizeContext(ctx)
+	}
+	if err := ctx.Err(); err != nil {
+		return 0, err
+	}
+	return qs.Size(), nil
+}
+
 type QuadStore interface {
 	// The only way in is through building a transaction, which
 	// is done by a replication strategy.
@@ -137,11 +254,222 @@ func (d Options) BoolKey(key string, def bool) (bool, error) {
 	return def, nil
 }
 
+// StringsKey returns a list of strings for a given key. Both a list and a comma-separated string are accepted.
+func (d Options) StringsKey(key string, def []string) ([]string, error) {
+	val, ok := d[key]
+	if !ok {
+		return def, nil
+	}
+	switch val := val.(type) {
+	case []string:
+		return val, nil
+	case string:
+		if val == "" {
+			return nil, nil
+		}
+		out := strings.Split(val, ",")
+		for i := range out {
+			out[i] = strings.TrimSpace(out[i])
+		}
+		return out, nil
+	case []interface{}:
+		out := make([]string, 0, len(val))
+		for _, v := range val {
+			s, ok := v.(string)
+			if !ok {
+				return def, fmt.Errorf("Invalid %s parameter type from config: %T", key, v)
+			}
+			out = append(out, s)
+		}
+		return out, nil
+	}
+	return def, fmt.Errorf("Invalid %s parameter type from config: %T", key, val)
+}
+
+// OptQuadIndexes is a common option name for quad stores that allow to choose the set of quad indexes on init.
+//
+// The value is a list of indexes, each written as a sequence of direction prefixes, e.g. ["ps", "o"].
+const OptQuadIndexes = "indexes"
+
+// QuadIndexesKey returns a list of quad indexes for a given key. See OptQuadIndexes for the format.
+func (d Options) QuadIndexesKey(key string, def [][]quad.Direction) ([][]quad.Direction, error) {
+	strs, err := d.StringsKey(key, nil)
+	if err != nil {
+		return def, err
+	} else if strs == nil {
+		return def, nil
+	}
+	out := make([][]quad.Direction, 0, len(strs))
+	for _, s := range strs {
+		dirs, err := ParseQuadIndex(s)
+		if err != nil {
+			return def, err
+		}
+		out = append(out, dirs)
+	}
+	if len(out) == 0 {
+		return def, fmt.Errorf("at least one quad index must be set in %s", key)
+	}
+	return out, nil
+}
+
+// OptUniquePredicates is a common option name for quad stores that can enforce unique objects of predicates.
+// It can only be set when the database is created.
+//
+// The value is a list of predicate IRIs, e.g. ["<ex:email>"]; angle brackets are optional. Each object of these
+// predicates can only be used by a single subject, and writes that violate it fail with ConstraintError
+// of the ConstraintUnique kind. Unlike Constraints, the check is done in the same transaction as the write.
+const OptUniquePredicates = "unique_predicates"
+
+// UniquePredicatesKey returns a list of predicates for a given key. See OptUniquePredicates for the format.
+func (d Options) UniquePredicatesKey(key string) ([]quad.Value, error) {
+	strs, err := d.StringsKey(key, nil)
+	if err != nil {
+		return nil, err
+	}
+	var out []quad.Value
+	for _, s := range strs {
+		if s == "" {
+			continue
+		}
+		v := quad.StringToValue(s)
+		if _, ok := v.(quad.String); ok {
+			v = quad.IRI(s)
+		} else if _, ok := v.(quad.IRI); !ok {
+			return nil, fmt.Errorf("predicate in %s must be an IRI: %q", key, s)
+		}
+		out = append(out, v)
+	}
+	return out, nil
+}
+
+// ParseQuadIndex parses a quad index written as a sequence of direction prefixes, e.g. "pso".
+func ParseQuadIndex(s string) ([]quad.Direction, error) {
+	if s == "" {
+		return nil, errors.New("empty quad index")
+	}
+	dirs := make([]quad.Direction, 0, len(s))
+	for i := 0; i < len(s); i++ {
+		var d quad.Direction
+		switch s[i] {
+		case 's', 'S':
+			d = quad.Subject
+		case 'p', 'P':
+			d = quad.Predicate
+		case 'o', 'O':
+			d = quad.Object
+		case 'c', 'C', 'l', 'L':
+			d = quad.Label
+		default:
+			return nil, fmt.Errorf("unknown direction in quad index %q: %q", s, s[i])
+		}
+		for _, d2 := range dirs {
+			if d2 == d {
+				return nil, fmt.Errorf("duplicate direction in quad index %q: %v", s, d)
+			}
+		}
+		dirs = append(dirs, d)
+	}
+	return dirs, nil
+}
+
+// FormatQuadIndex is the reverse of ParseQuadIndex.
+func FormatQuadIndex(dirs []quad.Direction) string {
+	b := make([]byte, len(dirs))
+	for i, d := range dirs {
+		b[i] = d.Prefix()
+	}
+	return string(b)
+}
+
 var (
 	ErrDatabaseExists = errors.New("quadstore: cannot init; database already exists")
 	ErrNotInitialized = errors.New("quadstore: not initialized")
 )
 
+// Maintainer is an optional interface for quad stores that support online maintenance.
+type Maintainer interface {
+	// Compact reclaims disk space left after removed data.
+	// It can be called while the store is in use.
+	Compact(ctx context.Context) error
+}
+
+// Pinger is an optional interface for quad stores that connect to a remote backend.
+type Pinger interface {
+	// Ping checks that the backend is reachable.
+	Ping(ctx context.Context) error
+}
+
+// Ping checks that the quad store is able to serve requests. It calls Ping if the store or a store wrapped
+// by it (see Unwrapper) implements Pinger, or tries to read a single quad otherwise.
+func Ping(ctx context.Context, qs QuadStore) error {
+	var p Pinger
+	if unwrap(qs, func(qs QuadStore) (ok bool) {
+		p, ok = qs.(Pinger)
+		return
+	}) {
+		return p.Ping(ctx)
+	}
+	it := qs.QuadsAllIterator()
+	defer it.Close()
+	it.Next(ctx)
+	if err := it.Err(); err != nil {
+		return err
+	}
+	return ctx.Err()
+}
+
+// Problem describes an inconsistency found in the internal structures of a quad store.
+type Problem struct {
+	Kind  string // short category of the problem, like "refcount" or "index"
+	Desc  string // human-readable description
+	Fixed bool   // problem was repaired
+}
+
+func (p Problem) String() string {
+	s := p.Kind + ": " + p.Desc
+	if p.Fixed {
+		s += " (fixed)"
+	}
+	return s
+}
+
+// Checker is an optional interface for quad stores that can verify consistency of their data.
+type Checker interface {
+	// Check scans the store and returns all inconsistencies found.
+	// If repair is set, it also tries to fix them.
+	Check(ctx context.Context, repair bool) ([]Problem, error)
+}
+
+// Versioned is an optional interface for quad stores that support optimistic concurrency control.
+type Versioned interface {
+	// Horizon returns a version that will be assigned to the next write to the store.
+	// All changes made after the call will have a version equal to or greater than this value.
+	// It is always positive.
+	Horizon() int64
+
+	// ApplyDeltasSince is the same as ApplyDeltas, but fails with ErrConflict if quads with the same
+	// subject, predicate and label as in any of the deltas were added or removed at or after a given horizon.
+	ApplyDeltasSince(in []Delta, opts IgnoreOpts, horizon int64) error
+}
+
+// Tombstone is a quad removed from a store with soft deletes enabled.
+type Tombstone struct {
+	Quad    quad.Quad
+	Deleted time.Time
+}
+
+// SoftDeleter is an optional interface for quad stores that keep removed quads until they are purged.
+// Removed quads can be restored with Undelete. Use AsSoftDeleter to check if soft deletes are enabled.
+//
+// Time ranges include the start and exclude the end. Zero time means no limit.
+type SoftDeleter interface {
+	// Tombstones calls a function for each quad removed in a given time range, in the order of removal.
+	Tombstones(ctx context.Context, since, until time.Time, fnc func(t Tombstone) error) error
+	// Purge permanently removes quads deleted before a given time. They can no longer be restored.
+	Purge(ctx context.Context, before time.Time) (int, error)
+}
+
 type BulkLoader interface {
 	// BulkLoad loads Quads from a quad.Unmarshaler in bulk to the QuadStore.
 	// It returns ErrCannotBulkLoad if bulk loading is not possible. For example if
@@ -0,0 +1,113 @@
+package graph_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/cayleygraph/cayley/graph"
+	"github.com/cayleygraph/cayley/graph/graphmock"
+	"github.com/cayleygraph/cayley/graph/iterator"
+	"github.com/cayleygraph/cayley/quad"
+)
+
+var errLookup = errors.New("lookup failed")
+
+// ctxStore fails to load values named "fail".
+type ctxStore struct {
+	graphmock.Store
+}
+
+func (qs *ctxStore) ValueOfContext(ctx context.Context, v quad.Value) (graph.Value, error) {
+	return qs.ValueOf(v), ctx.Err()
+}
+
+func (qs *ctxStore) NameOfContext(ctx context.Context, v graph.Value) (quad.Value, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	nv := qs.NameOf(v)
+	if nv == quad.String("fail") {
+		return nil, errLookup
+	}
+	return nv, nil
+}
+
+func (qs *ctxStore) QuadContext(ctx context.Context, v graph.Value) (quad.Quad, error) {
+	return qs.Quad(v), ctx.Err()
+}
+
+func (qs *ctxStore) SizeContext(ctx context.Context) (int64, error) {
+	return qs.Size(), ctx.Err()
+}
+
+func TestContextLookups(t *testing.T) {
+	var qs graph.QuadStore = &graphmock.Store{Data: []quad.Quad{quad.MakeIRI("a", "b", "c", "")}}
+	ctx, cancel := context.WithCancel(context.Background())
+
+	v, err := graph.NameOf(ctx, qs, graph.PreFetched(quad.IRI("a")))
+	if err != nil || v != quad.IRI("a") {
+		t.Fatalf("unexpected value: %v, %v", v, err)
+	}
+	if n, err := graph.SizeOf(ctx, qs); err != nil || n != 1 {
+		t.Fatalf("unexpected size: %v, %v", n, err)
+	}
+	cancel()
+	if _, err = graph.NameOf(ctx, qs, graph.PreFetched(quad.IRI("a"))); err != context.Canceled {
+		t.Fatalf("expected an error, got: %v", err)
+	} else if _, err = graph.ValueOf(ctx, qs, quad.IRI("a")); err != context.Canceled {
+		t.Fatalf("expected an error, got: %v", err)
+	} else if _, err = graph.SizeOf(ctx, qs); err != context.Canceled {
+		t.Fatalf("expected an error, got: %v", err)
+	}
+
+	qs = &ctxStore{}
+	if _, err = graph.SizeOf(ctx, qs); err != context.Canceled {
+		t.Fatalf("expected an error, got: %v", err)
+	}
+	it := iterator.NewFixed(
+		graph.PreFetched(quad.String("a")),
+		graph.PreFetched(quad.String("fail")),
+		graph.PreFetched(quad.String("b")),
+	)
+	var got []quad.Value
+	err = graph.Iterate(context.Background(), it).UnOptimized().EachValue(qs, func(v quad.Value) {
+		got = append(got, v)
+	})
+	if err != errLookup {
+		t.Fatalf("expected an error, got: %v", err)
+	} else if len(got) != 1 {
+		t.Fatalf("iteration should stop on error: %v", got)
+	}
+}
+
+// oldBatchStore implements the deprecated graph.BatchQuadStore interface.
+type oldBatchStore struct {
+	graphmock.Store
+	calls int
+}
+
+func (qs *oldBatchStore) ValuesOf(ctx context.Context, vals []graph.Value) ([]quad.Value, error) {
+	qs.calls++
+	out := make([]quad.Value, len(vals))
+	for i, v := range vals {
+		out[i] = qs.NameOf(v)
+	}
+	return out, nil
+}
+
+func TestBatchQuadStore(t *testing.T) {
+	qs := &oldBatchStore{}
+	refs := []graph.Value{graph.PreFetched(quad.IRI("a")), graph.PreFetched(quad.IRI("b"))}
+	got, err := graph.NamesOf(context.Background(), qs, refs)
+	if err != nil {
+		t.Fatal(err)
+	} else if len(got) != 2 || got[0] != quad.IRI("a") || got[1] != quad.IRI("b") {
+		t.Fatalf("unexpected values: %v", got)
+	} else if qs.calls != 1 {
+		t.Fatalf("expected a single batch call, got: %d", qs.calls)
+	}
+	if got, err = graph.ValuesOf(context.Background(), qs, refs); err != nil || len(got) != 2 {
+		t.Fatalf("unexpected values: %v, %v", got, err)
+	}
+}
@@ -25,6 +25,7 @@ import (
 	"context"
 	"errors"
 	"io"
+	"time"
 
 	"github.com/cayleygraph/cayley/quad"
 )
@@ -73,6 +74,7 @@ var (
 	ErrQuadNotExist  = errors.New("quad does not exist")
 	ErrInvalidAction = errors.New("invalid action")
 	ErrNodeNotExists = errors.New("node does not exist")
+	ErrConflict      = errors.New("quad was modified concurrently")
 )
 
 // DeltaError records an error and the delta that caused it.
@@ -85,34 +87,33 @@ func (e *DeltaError) Error() string {
 	return e.Delta.Action.String() + " " + e.Delta.Quad.String() + ": " + e.Err.Error()
 }
 
-// IsQuadExist returns whether an error is a DeltaError
-// with the Err field equal to ErrQuadExists.
+// Unwrap returns the error that caused the delta to fail.
+func (e *DeltaError) Unwrap() error {
+	return e.Err
+}
+
+// IsQuadExist returns whether an error is ErrQuadExists,
+// or a DeltaError or BackendError that wraps it.
 func IsQuadExist(err error) bool {
-	if err == ErrQuadExists {
-		return true
-	}
-	de, ok := err.(*DeltaError)
-	return ok && de.Err == ErrQuadExists
+	return isErr(err, ErrQuadExists)
 }
 
-// IsQuadNotExist returns whether an error is a DeltaError
-// with the Err field equal to ErrQuadNotExist.
+// IsQuadNotExist returns whether an error is ErrQuadNotExist,
+// or a DeltaError or BackendError that wraps it.
 func IsQuadNotExist(err error) bool {
-	if err == ErrQuadNotExist {
-		return true
-	}
-	de, ok := err.(*DeltaError)
-	return ok && de.Err == ErrQuadNotExist
+	return isErr(err, ErrQuadNotExist)
 }
 
-// IsInvalidAction returns whether an error is a DeltaError
-// with the Err field equal to ErrInvalidAction.
+// IsInvalidAction returns whether an error is ErrInvalidAction,
+// or a DeltaError or BackendError that wraps it.
 func IsInvalidAction(err error) bool {
-	if err == ErrInvalidAction {
-		return true
-	}
-	de, ok := err.(*DeltaError)
-	return ok && de.Err == ErrInvalidAction
+	return isErr(err, ErrInvalidAction)
+}
+
+// IsConflict returns whether an error is ErrConflict,
+// or a DeltaError or BackendError that wraps it.
+func IsConflict(err error) bool {
+	return isErr(err, ErrConflict)
 }
 
 var (
@@ -137,7 +138,16 @@ type QuadWriter interface {
 	// if it exists. Does nothing otherwise.
 	RemoveQuad(quad.Quad) error
 
+	// ReplaceQuad atomically removes the old quad and adds the new one.
+	ReplaceQuad(old, new quad.Quad) error
+
+	// SetQuad atomically removes all quads with a given subject, predicate and label,
+	// and adds a new quad with a given object. It can be used to store single-valued properties.
+	// Writers might only guarantee atomicity for stores that support conditional writes (see Versioned).
+	SetQuad(s, p, o, l quad.Value) error
+
 	// ApplyTransaction applies a set of quad changes.
+	// If the base of transaction is set, the store must implement Versioned.
 	ApplyTransaction(*Transaction) error
 
 	// RemoveNode removes all quads which have the given node as subject, predicate, object, or label.
@@ -149,6 +159,133 @@ type QuadWriter interface {
 	Close() error
 }
 
+// WriteReport lists changes that were skipped by a quad writer because of ignore options.
+type WriteReport struct {
+	// Duplicates are added quads that already existed in the store.
+	Duplicates []quad.Quad
+	// Missing are removed quads that did not exist in the store.
+	Missing []quad.Quad
+}
+
+// Skipped returns the number of skipped changes.
+func (r *WriteReport) Skipped() int {
+	if r == nil {
+		return 0
+	}
+	return len(r.Duplicates) + len(r.Missing)
+}
+
+// IgnoreOptsWriter is an optional interface for quad writers that accept ignore options for each call,
+// instead of options set when the writer was created. Changes skipped because of the options are returned
+// in the report.
+type IgnoreOptsWriter interface {
+	// AddQuadSetOpts adds a set of quads to the store with given ignore options.
+	AddQuadSetOpts(set []quad.Quad, opts IgnoreOpts) (*WriteReport, error)
+
+	// ApplyDeltasOpts applies a set of quad changes with given ignore options.
+	ApplyDeltasOpts(in []Delta, opts IgnoreOpts) (*WriteReport, error)
+}
+
+// AddQuadSetOpts adds a set of quads with given ignore options.
+//
+// It returns ErrOperationNotSupported if the writer does not implement IgnoreOptsWriter.
+func AddQuadSetOpts(qw QuadWriter, set []quad.Quad, opts IgnoreOpts) (*WriteReport, error) {
+	w, ok := qw.(IgnoreOptsWriter)
+	if !ok {
+		return nil, ErrOperationNotSupported
+	}
+	return w.AddQuadSetOpts(set, opts)
+}
+
+// ApplyDeltasOpts applies a set of quad changes with given ignore options.
+//
+// It returns ErrOperationNotSupported if the writer does not implement IgnoreOptsWriter.
+func ApplyDeltasOpts(qw QuadWriter, in []Delta, opts IgnoreOpts) (*WriteReport, error) {
+	w, ok := qw.(IgnoreOptsWriter)
+	if !ok {
+		return nil, ErrOperationNotSupported
+	}
+	return w.ApplyDeltasOpts(in, opts)
+}
+
+// Undelete restores quads removed in a given time range by adding them again with a given writer, thus the changes
+// pass through the writer middlewares and are recorded like any other write. If filter is set, only quads accepted
+// by it are restored. Quads that exist in the store are skipped. It returns the number of restored quads.
+//
+// It returns ErrOperationNotSupported if the writer does not implement IgnoreOptsWriter.
+func Undelete(ctx context.Context, sd SoftDeleter, qw QuadWriter, since, until time.Time, filter func(q quad.Quad) bool) (int, error) {
+	// the same quad may be removed multiple times
+	seen := make(map[quad.Quad]struct{})
+	var in []Delta
+	err := sd.Tombstones(ctx, since, until, func(t Tombstone) error {
+		if _, ok := seen[t.Quad]; ok {
+			return nil
+		} else if filter != nil && !filter(t.Quad) {
+			return nil
+		}
+		seen[t.Quad] = struct{}{}
+		in = append(in, Delta{Action: Add, Quad: t.Quad})
+		return nil
+	})
+	if err != nil || len(in) == 0 {
+		return 0, err
+	}
+	rep, err := ApplyDeltasOpts(qw, in, IgnoreOpts{IgnoreDup: true})
+	if err != nil {
+		return 0, err
+	}
+	return len(in) - rep.Skipped(), nil
+}
+
+// SkipIgnored removes changes that are ignored because of the options and returns them in a report.
+// Quads added or removed by preceding changes in the same set are taken into account.
+//
+// Quads are looked up in the store before the changes are applied, thus remaining changes should still be
+// applied with the same options to ignore concurrent modifications. Those are not listed in the report.
+func SkipIgnored(qs QuadStore, in []Delta, opts IgnoreOpts) ([]Delta, *WriteReport, error) {
+	rep := &WriteReport{}
+	if !opts.IgnoreDup && !opts.IgnoreMissing {
+		return in, rep, nil
+	}
+	// changed tracks quads added or removed by preceding changes
+	changed := make(map[quad.Quad]bool)
+	exists := func(q quad.Quad) (bool, error) {
+		if ok, seen := changed[q]; seen {
+			return ok, nil
+		}
+		return hasQuad(qs, q)
+	}
+	out := make([]Delta, 0, len(in))
+	for _, d := range in {
+		switch d.Action {
+		case Add:
+			if opts.IgnoreDup {
+				ok, err := exists(d.Quad)
+				if err != nil {
+					return nil, nil, err
+				} else if ok {
+					rep.Duplicates = append(rep.Duplicates, d.Quad)
+					continue
+				}
+			}
+			changed[d.Quad] = true
+		case Delete:
+			if opts.IgnoreMissing {
+				ok, err := exists(d.Quad)
+				if err != nil {
+					return nil, nil, err
+				} else if !ok {
+					rep.Missing = append(rep.Missing, d.Quad)
+					continue
+				}
+			}
+			changed[d.Quad] = false
+		}
+		out = append(out, d)
+	}
+	return out, rep, nil
+}
+
 type NewQuadWriterFunc func(QuadStore, Options) (QuadWriter, error)
 
 var writerRegistry = make(map[string]NewQuadWriterFunc)
@@ -276,6 +413,112 @@ func (w *removeWriter) Flush() error {
 }
 func (w *removeWriter) Close() error { return nil }
 
+// RemoveMatching removes all quads matching a given pattern. Nil values in the pattern match any value.
+// Quads are removed in batches; the store is not modified while the iterator is open, thus the store is
+// scanned again for each batch. It returns the number of removed quads.
+//
+// A pattern with all values set to nil removes all quads from the store.
+func RemoveMatching(w QuadWriter, qs QuadStore, pattern quad.Quad) (int, error) {
+	del := &removeWriter{qs: w}
+	total := 0
+	// quads of the previous batch, in case the store does not hide removed quads immediately
+	prev := make(map[quad.Quad]struct{})
+	for {
+		buf, err := matchingBatch(qs, pattern, prev, quad.DefaultBatch)
+		if err != nil || len(buf) == 0 {
+			return total, err
+		}
+		n, err := del.WriteQuads(buf)
+		total += n
+		if err != nil {
+			return total, err
+		}
+		prev = make(map[quad.Quad]struct{}, len(buf))
+		for _, q := range buf {
+			prev[q] = struct{}{}
+		}
+	}
+}
+
+// matchingBatch returns up to n quads matching the pattern, except the ones in the skip set.
+// The iterator is closed before the function returns.
+func matchingBatch(qs QuadStore, pattern quad.Quad, skip map[quad.Quad]struct{}, n int) ([]quad.Quad, error) {
+	it, keys := matchingIterator(qs, pattern)
+	if it == nil {
+		return nil, nil
+	}
+	defer it.Close()
+	var buf []quad.Quad
+	ctx := context.TODO()
+	for len(buf) < n && it.Next(ctx) {
+		ref := it.Result()
+		if !matchKeys(qs, ref, keys) {
+			continue
+		}
+		q := qs.Quad(ref)
+		if _, ok := skip[q]; ok {
+			continue
+		}
+		buf = append(buf, q)
+	}
+	return buf, it.Err()
+}
+
+// matchingIterator returns an iterator over the smallest index that contains all quads matching the pattern,
+// and keys of pattern values that results must be filtered by. It returns nil if no quads can match.
+func matchingIterator(qs QuadStore, pattern quad.Quad) (Iterator, map[quad.Direction]interface{}) {
+	var (
+		it   Iterator
+		size int64
+		keys = make(map[quad.Direction]interface{})
+	)
+	for _, d := range quad.Directions {
+		v := pattern.Get(d)
+		if v == nil {
+			continue
+		}
+		ref := qs.ValueOf(v)
+		if ref == nil {
+			if it != nil {
+				it.Close()
+			}
+			return nil, nil
+		}
+		keys[d] = ToKey(ref)
+		// iterate over the smallest index and filter by other values
+		dit := qs.QuadIterator(d, ref)
+		if sz, _ := dit.Size(); it == nil || sz < size {
+			if it != nil {
+				it.Close()
+			}
+			it, size = dit, sz
+		} else {
+			dit.Close()
+		}
+	}
+	if it == nil {
+		it = qs.QuadsAllIterator()
+	}
+	return it, keys
+}
+
+// matchKeys checks if a quad has all values with given keys.
+func matchKeys(qs QuadStore, ref Value, keys map[quad.Direction]interface{}) bool {
+	for d, k := range keys {
+		if ToKey(qs.QuadDirection(ref, d)) != k {
+			return false
+		}
+	}
+	return true
+}
+
+// NewMatchingReader creates a quad reader that returns all quads of the QuadStore matching a given pattern.
+// Nil values in the pattern match any value.
+func NewMatchingReader(qs QuadStore, pattern quad.Quad) quad.ReadSkipCloser {
+	it, keys := matchingIterator(qs, pattern)
+	return &quadReader{qs: qs, it: it, keys: keys}
+}
+
 // NewResultReader creates a quad reader for a given QuadStore.
 func NewQuadStoreReader(qs QuadStore) quad.ReadSkipCloser {
 	return NewResultReader(qs, nil)
@@ -295,27 +538,38 @@ func NewResultReader(qs QuadStore, it Iterator) quad.ReadSkipCloser {
 }
 
 type quadReader struct {
-	qs QuadStore
-	it Iterator
+	qs   QuadStore
+	it   Iterator
+	keys map[quad.Direction]interface{} // optional filter
 }
 
-func (r *quadReader) ReadQuad() (quad.Quad, error) {
-	if r.it.Next(context.TODO()) {
-		return r.qs.Quad(r.it.Result()), nil
+func (r *quadReader) next() error {
+	if r.it == nil {
+		return io.EOF
 	}
-	err := r.it.Err()
-	if err == nil {
-		err = io.EOF
-	}
-	return quad.Quad{}, err
-}
-func (r *quadReader) SkipQuad() error {
-	if r.it.Next(context.TODO()) {
-		return nil
+	ctx := context.TODO()
+	for r.it.Next(ctx) {
+		if len(r.keys) == 0 || matchKeys(r.qs, r.it.Result(), r.keys) {
+			return nil
+		}
 	}
 	if err := r.it.Err(); err != nil {
 		return err
 	}
 	return io.EOF
 }
-func (r *quadReader) Close() error { return r.it.Close() }
+func (r *quadReader) ReadQuad() (quad.Quad, error) {
+	if err := r.next(); err != nil {
+		return quad.Quad{}, err
+	}
+	return r.qs.Quad(r.it.Result()), nil
+}
+func (r *quadReader) SkipQuad() error {
+	return r.next()
+}
+func (r *quadReader) Close() error {
+	if r.it == nil {
+		return nil
+	}
+	return r.it.Close()
+}
@@ -1,8 +1,13 @@
 package graph
 
 import (
+	"context"
 	"errors"
+	"reflect"
 	"testing"
+	"time"
+
+	"github.com/cayleygraph/cayley/quad"
 )
 
 func TestIsQuadExist(t *testing.T) {
@@ -61,3 +66,98 @@ func TestIsInvalidAction(t *testing.T) {
 		}
 	}
 }
+
+func TestIsConflict(t *testing.T) {
+	tests := []struct {
+		Err     error
+		Matches bool
+	}{
+		{Err: nil, Matches: false},
+		{Err: errors.New("foo"), Matches: false},
+		{Err: ErrConflict, Matches: true},
+		{Err: &DeltaError{Err: errors.New("foo")}, Matches: false},
+		{Err: &DeltaError{Err: ErrConflict}, Matches: true},
+	}
+
+	for i, test := range tests {
+		if match := IsConflict(test.Err); test.Matches != match {
+			t.Errorf("%d> unexpected match: %t", i, match)
+		}
+	}
+}
+
+type tombstones []Tombstone
+
+func (ts tombstones) Tombstones(ctx context.Context, since, until time.Time, fnc func(t Tombstone) error) error {
+	for _, t := range ts {
+		if err := fnc(t); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (ts tombstones) Purge(ctx context.Context, before time.Time) (int, error) {
+	return 0, ErrOperationNotSupported
+}
+
+// deltaWriter records applied changes and reports quads from the existing set as duplicates.
+type deltaWriter struct {
+	QuadWriter
+	existing map[quad.Quad]bool
+	applied  []Delta
+}
+
+func (w *deltaWriter) AddQuadSetOpts(set []quad.Quad, opts IgnoreOpts) (*WriteReport, error) {
+	in := make([]Delta, 0, len(set))
+	for _, q := range set {
+		in = append(in, Delta{Action: Add, Quad: q})
+	}
+	return w.ApplyDeltasOpts(in, opts)
+}
+
+func (w *deltaWriter) ApplyDeltasOpts(in []Delta, opts IgnoreOpts) (*WriteReport, error) {
+	rep := &WriteReport{}
+	for _, d := range in {
+		if w.existing[d.Quad] && opts.IgnoreDup {
+			rep.Duplicates = append(rep.Duplicates, d.Quad)
+			continue
+		}
+		w.applied = append(w.applied, d)
+	}
+	return rep, nil
+}
+
+func TestUndelete(t *testing.T) {
+	a, b, c := quad.MakeIRI("a", "p", "b", ""), quad.MakeIRI("b", "p", "c", ""), quad.MakeIRI("c", "p", "a", "")
+	sd := tombstones{{Quad: a}, {Quad: b}, {Quad: a}, {Quad: c}}
+	qw := &deltaWriter{existing: map[quad.Quad]bool{b: true}}
+	n, err := Undelete(context.TODO(), sd, qw, time.Time{}, time.Time{}, func(q quad.Quad) bool {
+		return q != c
+	})
+	if err != nil {
+		t.Fatal(err)
+	} else if n != 1 {
+		t.Fatalf("unexpected number of restored quads: %d", n)
+	}
+	if exp := []Delta{{Action: Add, Quad: a}}; !reflect.DeepEqual(qw.applied, exp) {
+		t.Fatalf("unexpected changes: %v", qw.applied)
+	}
+}
+
+func TestAddQuadSetOpts(t *testing.T) {
+	a, b := quad.MakeIRI("a", "p", "b", ""), quad.MakeIRI("b", "p", "c", "")
+	qw := &deltaWriter{existing: map[quad.Quad]bool{b: true}}
+	rep, err := AddQuadSetOpts(qw, []quad.Quad{a, b}, IgnoreOpts{IgnoreDup: true})
+	if err != nil {
+		t.Fatal(err)
+	} else if !reflect.DeepEqual(rep.Duplicates, []quad.Quad{b}) {
+		t.Fatalf("unexpected duplicates: %v", rep.Duplicates)
+	}
+	if exp := []Delta{{Action: Add, Quad: a}}; !reflect.DeepEqual(qw.applied, exp) {
+		t.Fatalf("unexpected changes: %v", qw.applied)
+	}
+	if _, err = AddQuadSetOpts(struct{ QuadWriter }{}, []quad.Quad{a}, IgnoreOpts{}); err != ErrOperationNotSupported {
+		t.Fatalf("unexpected error: %v", err)
+	}
+}
@@ -0,0 +1,44 @@
+package graph
+
+import (
+	"github.com/cayleygraph/cayley/quad"
+	"github.com/cayleygraph/cayley/voc/rdf"
+)
+
+// ReifyQuads returns quads that describe a given quad as a statement node st, using RDF reification vocabulary:
+//
+//	st <rdf:type> <rdf:Statement> .
+//	st <rdf:subject> q.Subject .
+//	st <rdf:predicate> q.Predicate .
+//	st <rdf:object> q.Object .
+//
+// All quads are written to the same graph (label) as the original quad.
+func ReifyQuads(st quad.Value, q quad.Quad) []quad.Quad {
+	return []quad.Quad{
+		{Subject: st, Predicate: quad.IRI(rdf.Type), Object: quad.IRI(rdf.Statement), Label: q.Label},
+		{Subject: st, Predicate: quad.IRI(rdf.Subject), Object: q.Subject, Label: q.Label},
+		{Subject: st, Predicate: quad.IRI(rdf.Predicate), Object: q.Predicate, Label: q.Label},
+		{Subject: st, Predicate: quad.IRI(rdf.Object), Object: q.Object, Label: q.Label},
+	}
+}
+
+// AddEdge atomically adds a quad, its reified statement and a set of properties of this statement (edge).
+// It returns a statement node that can be used to add more properties to the edge.
+//
+// Statement node is derived from the quad (see StatementNode), thus adding properties to an existing edge
+// requires the writer to ignore duplicate quads. Use path.OnEdge to query edge properties.
+func AddEdge(w QuadWriter, q quad.Quad, props map[quad.IRI]quad.Value) (quad.BNode, error) {
+	st := StatementNode(q)
+	tx := NewTransaction()
+	tx.AddQuad(q)
+	for _, rq := range ReifyQuads(st, q) {
+		tx.AddQuad(rq)
+	}
+	for p, v := range props {
+		tx.AddQuad(quad.Quad{Subject: st, Predicate: p, Object: v, Label: q.Label})
+	}
+	if err := w.ApplyTransaction(tx); err != nil {
+		return "", err
+	}
+	return st, nil
+}
@@ -0,0 +1,248 @@
+// Copyright 2017 The Cayley Authors. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package remote
+
+import (
+	"context"
+	"fmt"
+	"io"
+
+	"github.com/cayleygraph/cayley/client"
+	"github.com/cayleygraph/cayley/graph"
+	"github.com/cayleygraph/cayley/graph/iterator"
+	"github.com/cayleygraph/cayley/quad"
+)
+
+var _ graph.Iterator = &Iterator{}
+
+// Iterator streams quads matching a pattern from the server, or all nodes of the server.
+// The request is sent on the first call to Next, and it is bound to the context of that call.
+type Iterator struct {
+	uid     uint64
+	tags    graph.Tagger
+	qs      *QuadStore
+	pattern quad.Quad
+	nodes   bool
+
+	r  quad.ReadCloser
+	nr *client.NodeReader
+
+	result graph.Value
+	err    error
+}
+
+func newIterator(qs *QuadStore, pattern quad.Quad, nodes bool) *Iterator {
+	return &Iterator{
+		uid:     iterator.NextUID(),
+		qs:      qs,
+		pattern: pattern,
+		nodes:   nodes,
+	}
+}
+
+// isAll checks if the iterator returns all quads or nodes of the store.
+func (it *Iterator) isAll() bool {
+	return it.pattern == quad.Quad{}
+}
+
+// matches checks if the quad matches the pattern of the iterator.
+func (it *Iterator) matches(q quad.Quad) bool {
+	for _, d := range quad.Directions {
+		if v := it.pattern.Get(d); v != nil && v != q.Get(d) {
+			return false
+		}
+	}
+	return true
+}
+
+func (it *Iterator) UID() uint64 {
+	return it.uid
+}
+
+func (it *Iterator) SubIterators() []graph.Iterator {
+	return nil
+}
+
+func (it *Iterator) Reset() {
+	it.Close()
+	it.result = nil
+	it.err = nil
+}
+
+func (it *Iterator) Tagger() *graph.Tagger {
+	return &it.tags
+}
+
+func (it *Iterator) Clone() graph.Iterator {
+	out := newIterator(it.qs, it.pattern, it.nodes)
+	out.tags.CopyFrom(it)
+	return out
+}
+
+func (it *Iterator) Optimize() (graph.Iterator, bool) {
+	return it, false
+}
+
+func (it *Iterator) TagResults(dst map[string]graph.Value) {
+	it.tags.TagResult(dst, it.Result())
+}
+
+func (it *Iterator) String() string {
+	if it.nodes {
+		return "RemoteNodes()"
+	}
+	return fmt.Sprintf("Remote(%v)", it.pattern)
+}
+
+// nextQuad reads the next quad that matches the pattern.
+func (it *Iterator) nextQuad(ctx context.Context) (quad.Quad, bool) {
+	if it.r == nil {
+		r, err := it.qs.c.QuadReaderContext(ctx, it.pattern, 0)
+		if err != nil {
+			it.err = err
+			return quad.Quad{}, false
+		}
+		it.r = r
+	}
+	for {
+		q, err := it.r.ReadQuad()
+		if err == io.EOF {
+			return quad.Quad{}, false
+		} else if err != nil {
+			it.err = err
+			return quad.Quad{}, false
+		}
+		// values may be converted by the server, thus check the pattern again
+		if it.matches(q) {
+			return q, true
+		}
+	}
+}
+
+// nextNode reads the next node of the store.
+func (it *Iterator) nextNode(ctx context.Context) (quad.Value, bool) {
+	if it.nr == nil {
+		nr, err := it.qs.c.NodeReader(ctx, 0)
+		if err != nil {
+			it.err = err
+			return nil, false
+		}
+		it.nr = nr
+	}
+	v, err := it.nr.ReadNode()
+	if err == io.EOF {
+		return nil, false
+	} else if err != nil {
+		it.err = err
+		return nil, false
+	}
+	return v, true
+}
+
+func (it *Iterator) Next(ctx context.Context) bool {
+	graph.NextLogIn(it)
+	it.result = nil
+	if it.err != nil {
+		return graph.NextLogOut(it, false)
+	} else if err := ctx.Err(); err != nil {
+		it.err = err
+		return graph.NextLogOut(it, false)
+	}
+	if it.nodes {
+		v, ok := it.nextNode(ctx)
+		if ok {
+			it.result = nodeValue(v)
+		}
+		return graph.NextLogOut(it, ok)
+	}
+	q, ok := it.nextQuad(ctx)
+	if ok {
+		it.result = quadValue{q}
+	}
+	return graph.NextLogOut(it, ok)
+}
+
+// Contains checks the value on the server, thus it makes at least one request per call.
+func (it *Iterator) Contains(ctx context.Context, v graph.Value) bool {
+	graph.ContainsLogIn(it, v)
+	if it.err != nil {
+		return graph.ContainsLogOut(it, v, false)
+	}
+	ok := false
+	switch v := v.(type) {
+	case quadValue:
+		if !it.nodes && it.matches(v.q) {
+			ok, it.err = it.qs.hasQuad(ctx, v.q)
+		}
+	case graph.PreFetchedValue:
+		if it.nodes {
+			ok, it.err = it.qs.hasNode(ctx, v.NameOf())
+		}
+	}
+	if ok {
+		it.result = v
+	}
+	return graph.ContainsLogOut(it, v, ok)
+}
+
+func (it *Iterator) NextPath(ctx context.Context) bool {
+	return false
+}
+
+func (it *Iterator) Err() error {
+	return it.err
+}
+
+func (it *Iterator) Result() graph.Value {
+	return it.result
+}
+
+// Stats estimates the size of all iterators as the size of the remote database.
+func (it *Iterator) Stats() graph.IteratorStats {
+	return graph.IteratorStats{
+		NextCost:     10,
+		ContainsCost: 100,
+		Size:         it.qs.Size(),
+		ExactSize:    false,
+	}
+}
+
+func (it *Iterator) Size() (int64, bool) {
+	st := it.Stats()
+	return st.Size, st.ExactSize
+}
+
+// Type returns graph.All for iterators over all quads or nodes, so optimizers can treat them as such.
+func (it *Iterator) Type() graph.Type {
+	if it.isAll() {
+		return graph.All
+	}
+	return graph.Remote
+}
+
+func (it *Iterator) Close() error {
+	var err error
+	if it.r != nil {
+		err = it.r.Close()
+		it.r = nil
+	}
+	if it.nr != nil {
+		if err2 := it.nr.Close(); err == nil {
+			err = err2
+		}
+		it.nr = nil
+	}
+	return err
+}
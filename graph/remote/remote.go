@@ -0,0 +1,279 @@
+// Copyright 2017 The Cayley Authors. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package remote implements a quad store that reads and writes quads of a remote Cayley server over HTTP.
+//
+// Paths and shapes are executed locally by fetching matching quads from the server, thus the store
+// can be combined with local stores, for example with overlay.Union to federate queries across servers.
+package remote
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/cayleygraph/cayley/client"
+	"github.com/cayleygraph/cayley/clog"
+	"github.com/cayleygraph/cayley/graph"
+	"github.com/cayleygraph/cayley/graph/iterator"
+	"github.com/cayleygraph/cayley/quad"
+)
+
+const QuadStoreType = "remote"
+
+func init() {
+	graph.RegisterQuadStore(QuadStoreType, graph.QuadStoreRegistration{
+		NewFunc: func(addr string, opts graph.Options) (graph.QuadStore, error) {
+			if addr == "" {
+				return nil, errors.New("remote: server address is not set")
+			}
+			return New(addr), nil
+		},
+		IsPersistent: true,
+	})
+}
+
+var _ graph.QuadStore = (*QuadStore)(nil)
+
+// sizeTTL is the time after which the size of the remote database is requested again.
+const sizeTTL = time.Minute
+
+// QuadStore is a client of a remote Cayley server.
+//
+// Each iterator issues a separate request to the server, and no data is cached locally,
+// except for the size of the database.
+type QuadStore struct {
+	c *client.Client
+
+	mu     sync.Mutex
+	size   int64
+	sizeAt time.Time // zero if the size must be requested again
+}
+
+// New creates a store for a Cayley server with a given address, for example "http://localhost:64210".
+func New(addr string) *QuadStore {
+	return NewWithClient(client.New(addr))
+}
+
+// NewWithClient creates a store that uses a given client to access the server.
+func NewWithClient(c *client.Client) *QuadStore {
+	return &QuadStore{c: c}
+}
+
+// Client returns the client used by the store.
+func (qs *QuadStore) Client() *client.Client { return qs.c }
+
+// quadValue is a reference to a quad on the server.
+type quadValue struct {
+	q quad.Quad
+}
+
+func (v quadValue) Key() interface{} { return v.q.String() }
+
+func nodeValue(v quad.Value) graph.Value {
+	if v == nil {
+		return nil
+	}
+	return graph.PreFetched(v)
+}
+
+// read returns up to limit quads matching the pattern. Zero limit means no limit.
+func (qs *QuadStore) read(ctx context.Context, pattern quad.Quad, limit int) ([]quad.Quad, error) {
+	r, err := qs.c.QuadReaderContext(ctx, pattern, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer r.Close()
+	return quad.ReadAll(r)
+}
+
+// exists checks if the server has a quad matching the pattern.
+func (qs *QuadStore) exists(ctx context.Context, pattern quad.Quad) (bool, error) {
+	quads, err := qs.read(ctx, pattern, 1)
+	if err != nil {
+		return false, err
+	}
+	return len(quads) != 0, nil
+}
+
+// hasQuad checks if the server has exactly the same quad.
+func (qs *QuadStore) hasQuad(ctx context.Context, q quad.Quad) (bool, error) {
+	quads, err := qs.read(ctx, q, 0)
+	if err != nil {
+		return false, err
+	}
+	for _, q2 := range quads {
+		if q2 == q {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+// hasNode checks if the node is used by any quad on the server. It makes up to one request per direction.
+func (qs *QuadStore) hasNode(ctx context.Context, v quad.Value) (bool, error) {
+	for _, d := range quad.Directions {
+		var pattern quad.Quad
+		pattern.Set(d, v)
+		if ok, err := qs.exists(ctx, pattern); err != nil || ok {
+			return ok, err
+		}
+	}
+	return false, nil
+}
+
+// ApplyDeltas sends changes to the server. Consecutive deltas with the same action are sent
+// in a single request, thus the write is not atomic if it both adds and removes quads.
+//
+// Ignore options are checked before sending each delta, which requires an additional request per delta.
+func (qs *QuadStore) ApplyDeltas(in []graph.Delta, opts graph.IgnoreOpts) error {
+	defer qs.resetSize()
+	var (
+		act graph.Procedure
+		buf []quad.Quad
+	)
+	flush := func() error {
+		if len(buf) == 0 {
+			return nil
+		}
+		open := qs.c.QuadWriter
+		if act == graph.Delete {
+			open = qs.c.QuadDeleter
+		}
+		w, err := open()
+		if err != nil {
+			return err
+		}
+		for _, q := range buf {
+			if err = w.WriteQuad(q); err != nil {
+				break
+			}
+		}
+		if err2 := w.Close(); err == nil {
+			err = err2
+		}
+		buf = buf[:0]
+		return err
+	}
+	for _, d := range in {
+		if d.Action != graph.Add && d.Action != graph.Delete {
+			return &graph.DeltaError{Delta: d, Err: graph.ErrInvalidAction}
+		}
+		if (d.Action == graph.Add && opts.IgnoreDup) || (d.Action == graph.Delete && opts.IgnoreMissing) {
+			ok, err := qs.hasQuad(context.Background(), d.Quad)
+			if err != nil {
+				return err
+			} else if ok == (d.Action == graph.Add) {
+				continue
+			}
+		}
+		if d.Action != act {
+			if err := flush(); err != nil {
+				return err
+			}
+			act = d.Action
+		}
+		buf = append(buf, d.Quad)
+	}
+	return flush()
+}
+
+func (qs *QuadStore) Quad(v graph.Value) quad.Quad {
+	if q, ok := v.(quadValue); ok {
+		return q.q
+	}
+	return quad.Quad{}
+}
+
+func (qs *QuadStore) QuadDirection(v graph.Value, d quad.Direction) graph.Value {
+	return nodeValue(qs.Quad(v).Get(d))
+}
+
+// ValueOf checks if the node is used by any quad on the server. It makes up to one request per direction.
+// Since the interface cannot return errors, they are logged and the node is reported as missing;
+// iterators report such errors with Err.
+func (qs *QuadStore) ValueOf(v quad.Value) graph.Value {
+	if v == nil {
+		return nil
+	}
+	ok, err := qs.hasNode(context.Background(), v)
+	if err != nil {
+		clog.Errorf("remote: cannot check node %v: %v", v, err)
+		return nil
+	} else if !ok {
+		return nil
+	}
+	return nodeValue(v)
+}
+
+func (qs *QuadStore) NameOf(v graph.Value) quad.Value {
+	if v, ok := v.(graph.PreFetchedValue); ok {
+		return v.NameOf()
+	}
+	return nil
+}
+
+func (qs *QuadStore) QuadIterator(d quad.Direction, v graph.Value) graph.Iterator {
+	name := qs.NameOf(v)
+	if name == nil {
+		return iterator.NewNull()
+	}
+	var pattern quad.Quad
+	pattern.Set(d, name)
+	return newIterator(qs, pattern, false)
+}
+
+func (qs *QuadStore) NodesAllIterator() graph.Iterator {
+	return newIterator(qs, quad.Quad{}, true)
+}
+
+func (qs *QuadStore) QuadsAllIterator() graph.Iterator {
+	return newIterator(qs, quad.Quad{}, false)
+}
+
+// Size returns the size of the remote database. The size is requested at most once per minute,
+// and the last known size (or zero) is returned if the server cannot be reached.
+func (qs *QuadStore) Size() int64 {
+	qs.mu.Lock()
+	defer qs.mu.Unlock()
+	if !qs.sizeAt.IsZero() && time.Since(qs.sizeAt) < sizeTTL {
+		return qs.size
+	}
+	// don't retry on each call if the server is not available
+	qs.sizeAt = time.Now()
+	info, err := qs.c.Info()
+	if err != nil {
+		clog.Errorf("remote: cannot get database size: %v", err)
+		return qs.size
+	}
+	qs.size = info.Size
+	return qs.size
+}
+
+// resetSize forces the size to be requested again on the next call to Size.
+func (qs *QuadStore) resetSize() {
+	qs.mu.Lock()
+	qs.sizeAt = time.Time{}
+	qs.mu.Unlock()
+}
+
+func (qs *QuadStore) OptimizeIterator(it graph.Iterator) (graph.Iterator, bool) {
+	return it, false
+}
+
+// Close does nothing, since the store holds no connections of its own.
+func (qs *QuadStore) Close() error {
+	return nil
+}
@@ -0,0 +1,98 @@
+package remote
+
+import (
+	"context"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/cayleygraph/cayley/graph"
+	"github.com/cayleygraph/cayley/graph/graphtest"
+	"github.com/cayleygraph/cayley/graph/memstore"
+	"github.com/cayleygraph/cayley/graph/overlay"
+	"github.com/cayleygraph/cayley/graph/path"
+	"github.com/cayleygraph/cayley/quad"
+	cayleyhttp "github.com/cayleygraph/cayley/server/http"
+	"github.com/cayleygraph/cayley/writer"
+	"github.com/stretchr/testify/require"
+)
+
+func makeServer(t testing.TB, quads ...quad.Quad) (*QuadStore, graph.QuadStore, func()) {
+	qs := memstore.New(quads...)
+	wr, err := writer.NewSingleReplication(qs, nil)
+	require.NoError(t, err)
+	srv := httptest.NewServer(cayleyhttp.NewAPIv2(&graph.Handle{QuadStore: qs, QuadWriter: wr}))
+	return New(srv.URL), qs, func() {
+		srv.Close()
+		qs.Close()
+	}
+}
+
+func TestRemote(t *testing.T) {
+	quads := graphtest.MakeQuadSet()
+	qs, _, closer := makeServer(t, quads...)
+	defer closer()
+
+	graphtest.ExpectIteratedQuads(t, qs, qs.QuadsAllIterator(), quads, true)
+
+	b := qs.ValueOf(quad.String("B"))
+	require.NotNil(t, b)
+	require.Nil(t, qs.ValueOf(quad.String("X")))
+	graphtest.ExpectIteratedQuads(t, qs, qs.QuadIterator(quad.Object, b), []quad.Quad{
+		quad.Make("A", "follows", "B", nil),
+		quad.Make("C", "follows", "B", nil),
+		quad.Make("D", "follows", "B", nil),
+	}, true)
+
+	ctx := context.TODO()
+	got, err := path.StartPath(qs, quad.String("A")).Out(quad.String("follows")).Has(quad.String("status"), quad.String("cool")).Iterate(ctx).AllValues(qs)
+	require.NoError(t, err)
+	require.Equal(t, []quad.Value{quad.String("B")}, got)
+}
+
+func TestRemoteWrite(t *testing.T) {
+	qs, local, closer := makeServer(t)
+	defer closer()
+
+	q := quad.Make("a", "b", "c", nil)
+	err := qs.ApplyDeltas([]graph.Delta{{Action: graph.Add, Quad: q}}, graph.IgnoreOpts{})
+	require.NoError(t, err)
+	graphtest.ExpectIteratedQuads(t, local, local.QuadsAllIterator(), []quad.Quad{q}, false)
+
+	err = qs.ApplyDeltas([]graph.Delta{{Action: graph.Add, Quad: q}}, graph.IgnoreOpts{IgnoreDup: true})
+	require.NoError(t, err)
+	err = qs.ApplyDeltas([]graph.Delta{{Action: graph.Delete, Quad: q}}, graph.IgnoreOpts{})
+	require.NoError(t, err)
+	graphtest.ExpectIteratedQuads(t, qs, qs.QuadsAllIterator(), nil, false)
+}
+
+func TestRemoteUnion(t *testing.T) {
+	qs, _, closer := makeServer(t, quad.Make("a", "follows", "b", nil))
+	defer closer()
+	local := memstore.New(quad.Make("b", "follows", "c", nil))
+
+	u := overlay.Union(local, qs)
+	ctx := context.TODO()
+	got, err := path.StartPath(u, quad.String("a")).Out(quad.String("follows")).Out(quad.String("follows")).Iterate(ctx).AllValues(u)
+	require.NoError(t, err)
+	require.Equal(t, []quad.Value{quad.String("c")}, got)
+}
+
+func TestRemoteNodes(t *testing.T) {
+	esc := quad.String("a \"quoted\"\nvalue")
+	qs, local, closer := makeServer(t, quad.Make("a", "b", esc, nil))
+
+	require.Equal(t, esc, qs.NameOf(qs.ValueOf(esc)))
+	require.Equal(t, []string{"a", string(esc), "b"}, graphtest.IteratedStrings(t, qs, qs.NodesAllIterator()))
+	size := qs.Size()
+	require.Equal(t, local.Size(), size)
+
+	closer()
+	it := qs.NodesAllIterator()
+	defer it.Close()
+	require.False(t, it.Next(context.TODO()))
+	require.Error(t, it.Err())
+	it = qs.QuadsAllIterator()
+	require.False(t, it.Contains(context.TODO(), quadValue{quad.Make("a", "b", esc, nil)}))
+	require.Error(t, it.Err())
+	require.Equal(t, size, qs.Size())
+}
@@ -0,0 +1,519 @@
+// Copyright 2017 The Cayley Authors. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package sameas implements a quad store wrapper that treats nodes connected with owl:sameAs links
+// as a single node, thus linked data can be queried as if equivalent nodes were merged,
+// without rewriting quads in the store.
+//
+//	qs, err := sameas.New(ctx, base, nil)
+//
+// Each set of nodes connected by links (in any direction, transitively) is represented by a canonical node:
+// an IRI with the smallest value, or the smallest value if there are no IRIs in the set.
+// References to any node of the set are resolved to the canonical node, iterators for the canonical node
+// return quads of all nodes in the set, and quad directions that refer to any node of the set
+// return the canonical node. Thus, HasA and LinksTo follow the equivalence closure transparently.
+package sameas
+
+import (
+	"context"
+	"sort"
+	"sync"
+
+	"github.com/cayleygraph/cayley/graph"
+	"github.com/cayleygraph/cayley/graph/iterator"
+	"github.com/cayleygraph/cayley/quad"
+	"github.com/cayleygraph/cayley/voc/owl"
+)
+
+var _ graph.QuadStore = (*QuadStore)(nil)
+
+// DefaultPredicate is a predicate used to link equivalent nodes if no other predicate is set.
+var DefaultPredicate = quad.IRI(owl.SameAs).Full()
+
+// QuadStore wraps a quad store and treats nodes connected with links as a single node. See package description.
+//
+// Links are loaded when the store is created, and are updated for nodes of deltas with the link predicate
+// that are applied through the wrapper. Changes applied to the underlying store directly require calling Reload.
+//
+// Iterating all quads may return multiple quads that are equal after resolving equivalent nodes.
+// Optional interfaces of the underlying store are available through graph.Unwrapper.
+type QuadStore struct {
+	graph.QuadStore
+	pred quad.Value
+
+	upd sync.Mutex // serializes updates of links
+
+	mu    sync.RWMutex
+	nodes map[interface{}]*class // all nodes that are linked to other nodes
+	alias []graph.Value          // all non-canonical nodes
+}
+
+var (
+	_ graph.Unwrapper        = (*QuadStore)(nil)
+	_ graph.Versioned        = (*QuadStore)(nil)
+	_ graph.BulkLoader       = (*QuadStore)(nil)
+	_ graph.ContextQuadStore = (*QuadStore)(nil)
+)
+
+// class is a set of equivalent nodes.
+type class struct {
+	canon   graph.Value
+	name    quad.Value
+	members []graph.Value
+	names   []quad.Value
+}
+
+// New wraps a quad store and loads links with a given predicate. If the predicate is nil, DefaultPredicate is used.
+func New(ctx context.Context, qs graph.QuadStore, pred quad.Value) (*QuadStore, error) {
+	if pred == nil {
+		pred = DefaultPredicate
+	}
+	s := &QuadStore{QuadStore: qs, pred: pred}
+	if err := s.Reload(ctx); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+// Unwrap implements graph.Unwrapper.
+func (qs *QuadStore) Unwrap() graph.QuadStore {
+	return qs.QuadStore
+}
+
+// Predicate returns the predicate that links equivalent nodes.
+func (qs *QuadStore) Predicate() quad.Value {
+	return qs.pred
+}
+
+// predValues returns all forms of the link predicate. Prefixed and full forms of IRIs are both used.
+func (qs *QuadStore) predValues() []quad.Value {
+	vals := []quad.Value{qs.pred}
+	if iri, ok := qs.pred.(quad.IRI); ok {
+		if full := iri.Full(); full != iri {
+			vals = append(vals, full)
+		} else if short := iri.Short(); short != iri {
+			vals = append(vals, short)
+		}
+	}
+	return vals
+}
+
+// predRefs returns references of the link predicate in the underlying store.
+func (qs *QuadStore) predRefs() []graph.Value {
+	var out []graph.Value
+	for _, v := range qs.predValues() {
+		if ref := qs.QuadStore.ValueOf(v); ref != nil {
+			out = append(out, ref)
+		}
+	}
+	return out
+}
+
+// isLink checks if the quad has the link predicate.
+func (qs *QuadStore) isLink(q quad.Quad) bool {
+	for _, p := range qs.predValues() {
+		if q.Predicate == p {
+			return true
+		}
+	}
+	return false
+}
+
+// unionFind tracks sets of linked nodes.
+type unionFind struct {
+	parent map[interface{}]interface{}
+	refs   map[interface{}]graph.Value
+}
+
+func newUnionFind() *unionFind {
+	return &unionFind{
+		parent: make(map[interface{}]interface{}),
+		refs:   make(map[interface{}]graph.Value),
+	}
+}
+
+func (u *unionFind) add(v graph.Value) interface{} {
+	k := graph.ToKey(v)
+	if _, ok := u.refs[k]; !ok {
+		u.refs[k] = v
+		u.parent[k] = k
+	}
+	return k
+}
+
+func (u *unionFind) root(k interface{}) interface{} {
+	p := u.parent[k]
+	if p == k {
+		return k
+	}
+	r := u.root(p)
+	u.parent[k] = r
+	return r
+}
+
+func (u *unionFind) union(a, b graph.Value) {
+	if ra, rb := u.root(u.add(a)), u.root(u.add(b)); ra != rb {
+		u.parent[ra] = rb
+	}
+}
+
+// classes returns all sets with more than one node.
+func (qs *QuadStore) classes(u *unionFind) []*class {
+	byRoot := make(map[interface{}]*class)
+	var out []*class
+	for k, ref := range u.refs {
+		r := u.root(k)
+		c := byRoot[r]
+		if c == nil {
+			c = &class{}
+			byRoot[r] = c
+			out = append(out, c)
+		}
+		c.members = append(c.members, ref)
+	}
+	n := 0
+	for _, c := range out {
+		if len(c.members) < 2 {
+			continue
+		}
+		c.names = make([]quad.Value, len(c.members))
+		for i, m := range c.members {
+			c.names[i] = qs.QuadStore.NameOf(m)
+		}
+		best := 0
+		for i := range c.names {
+			if less(c.names[i], c.names[best]) {
+				best = i
+			}
+		}
+		c.canon, c.name = c.members[best], c.names[best]
+		out[n] = c
+		n++
+	}
+	return out[:n]
+}
+
+// Reload loads all links from the underlying store.
+func (qs *QuadStore) Reload(ctx context.Context) error {
+	qs.upd.Lock()
+	defer qs.upd.Unlock()
+	u := newUnionFind()
+	for _, p := range qs.predRefs() {
+		it := qs.QuadStore.QuadIterator(quad.Predicate, p)
+		for it.Next(ctx) {
+			q := it.Result()
+			u.union(qs.QuadStore.QuadDirection(q, quad.Subject), qs.QuadStore.QuadDirection(q, quad.Object))
+		}
+		err := it.Err()
+		it.Close()
+		if err != nil {
+			return err
+		}
+	}
+	nodes := make(map[interface{}]*class, len(u.refs))
+	for _, c := range qs.classes(u) {
+		for _, m := range c.members {
+			nodes[graph.ToKey(m)] = c
+		}
+	}
+	qs.mu.Lock()
+	qs.nodes, qs.alias = nodes, aliases(nodes)
+	qs.mu.Unlock()
+	return nil
+}
+
+// update reloads links of all nodes that are reachable by links from a given set of nodes,
+// including nodes that were equivalent to them before.
+func (qs *QuadStore) update(ctx context.Context, vals []quad.Value) error {
+	qs.upd.Lock()
+	defer qs.upd.Unlock()
+	preds := make(map[interface{}]struct{})
+	for _, p := range qs.predRefs() {
+		preds[graph.ToKey(p)] = struct{}{}
+	}
+	u := newUnionFind()
+	var queue []graph.Value
+	add := func(v graph.Value) {
+		if _, ok := u.refs[graph.ToKey(v)]; !ok {
+			u.add(v)
+			queue = append(queue, v)
+		}
+	}
+	// nodes that were equivalent before may no longer be linked
+	visit := func(v graph.Value) {
+		add(v)
+		if c := qs.class(v); c != nil {
+			for _, m := range c.members {
+				add(m)
+			}
+		}
+	}
+	for _, v := range vals {
+		if ref := qs.QuadStore.ValueOf(v); ref != nil {
+			visit(ref)
+		}
+	}
+	for len(queue) != 0 {
+		v := queue[0]
+		queue = queue[1:]
+		for _, d := range []quad.Direction{quad.Subject, quad.Object} {
+			it := qs.QuadStore.QuadIterator(d, v)
+			for it.Next(ctx) {
+				q := it.Result()
+				if _, ok := preds[graph.ToKey(qs.QuadStore.QuadDirection(q, quad.Predicate))]; !ok {
+					continue
+				}
+				s, o := qs.QuadStore.QuadDirection(q, quad.Subject), qs.QuadStore.QuadDirection(q, quad.Object)
+				visit(s)
+				visit(o)
+				u.union(s, o)
+			}
+			err := it.Err()
+			it.Close()
+			if err != nil {
+				return err
+			}
+		}
+	}
+	classes := qs.classes(u)
+	qs.mu.Lock()
+	defer qs.mu.Unlock()
+	nodes := make(map[interface{}]*class, len(qs.nodes))
+	for k, c := range qs.nodes {
+		if _, ok := u.refs[k]; !ok {
+			nodes[k] = c
+		}
+	}
+	for _, c := range classes {
+		for _, m := range c.members {
+			nodes[graph.ToKey(m)] = c
+		}
+	}
+	qs.nodes, qs.alias = nodes, aliases(nodes)
+	return nil
+}
+
+// aliases returns all non-canonical nodes, sorted by their values.
+func aliases(nodes map[interface{}]*class) []graph.Value {
+	type alias struct {
+		ref  graph.Value
+		name string
+	}
+	var (
+		list []alias
+		seen = make(map[*class]struct{})
+	)
+	for _, c := range nodes {
+		if _, ok := seen[c]; ok {
+			continue
+		}
+		seen[c] = struct{}{}
+		canon := graph.ToKey(c.canon)
+		for i, m := range c.members {
+			if graph.ToKey(m) != canon {
+				list = append(list, alias{ref: m, name: quad.StringOf(c.names[i])})
+			}
+		}
+	}
+	sort.Slice(list, func(i, j int) bool {
+		return list[i].name < list[j].name
+	})
+	out := make([]graph.Value, 0, len(list))
+	for _, a := range list {
+		out = append(out, a.ref)
+	}
+	return out
+}
+
+// less orders values of equivalent nodes. IRIs are preferred over other values.
+func less(a, b quad.Value) bool {
+	_, ia := a.(quad.IRI)
+	_, ib := b.(quad.IRI)
+	if ia != ib {
+		return ia
+	}
+	return quad.StringOf(a) < quad.StringOf(b)
+}
+
+// class returns a set of nodes equivalent to a given node, or nil if the node is not linked to other nodes.
+func (qs *QuadStore) class(v graph.Value) *class {
+	if v == nil {
+		return nil
+	}
+	qs.mu.RLock()
+	c := qs.nodes[graph.ToKey(v)]
+	qs.mu.RUnlock()
+	return c
+}
+
+// canonical returns the canonical node for a given node.
+func (qs *QuadStore) canonical(v graph.Value) graph.Value {
+	if c := qs.class(v); c != nil {
+		return c.canon
+	}
+	return v
+}
+
+// Equivalent returns all nodes equivalent to a given one, including the node itself.
+func (qs *QuadStore) Equivalent(v quad.Value) []quad.Value {
+	ref := qs.QuadStore.ValueOf(v)
+	c := qs.class(ref)
+	if c == nil {
+		if ref == nil {
+			return nil
+		}
+		return []quad.Value{v}
+	}
+	out := make([]quad.Value, 0, len(c.members))
+	for _, m := range c.members {
+		out = append(out, qs.QuadStore.NameOf(m))
+	}
+	sort.Slice(out, func(i, j int) bool { return less(out[i], out[j]) })
+	return out
+}
+
+// ApplyDeltas writes deltas to the underlying store. Links of nodes are updated if any delta has the link predicate.
+func (qs *QuadStore) ApplyDeltas(in []graph.Delta, opts graph.IgnoreOpts) error {
+	if err := qs.QuadStore.ApplyDeltas(in, opts); err != nil {
+		return err
+	}
+	return qs.updateDeltas(in)
+}
+
+// updateDeltas updates links of nodes of deltas with the link predicate.
+func (qs *QuadStore) updateDeltas(in []graph.Delta) error {
+	var vals []quad.Value
+	for _, d := range in {
+		if qs.isLink(d.Quad) {
+			vals = append(vals, d.Quad.Subject, d.Quad.Object)
+		}
+	}
+	if len(vals) == 0 {
+		return nil
+	}
+	return qs.update(context.TODO(), vals)
+}
+
+// Horizon implements graph.Versioned, if it is supported by the underlying store.
+func (qs *QuadStore) Horizon() int64 {
+	if vs, ok := graph.AsVersioned(qs.QuadStore); ok {
+		return vs.Horizon()
+	}
+	return 1
+}
+
+// ApplyDeltasSince implements graph.Versioned, if it is supported by the underlying store.
+func (qs *QuadStore) ApplyDeltasSince(in []graph.Delta, opts graph.IgnoreOpts, horizon int64) error {
+	vs, ok := graph.AsVersioned(qs.QuadStore)
+	if !ok {
+		return graph.ErrOperationNotSupported
+	}
+	if err := vs.ApplyDeltasSince(in, opts, horizon); err != nil {
+		return err
+	}
+	return qs.updateDeltas(in)
+}
+
+// BulkLoad implements graph.BulkLoader, if it is supported by the underlying store.
+// All links are reloaded after the load.
+func (qs *QuadStore) BulkLoad(r quad.Reader) error {
+	bl, ok := graph.AsBulkLoader(qs.QuadStore)
+	if !ok {
+		return graph.ErrOperationNotSupported
+	}
+	if err := bl.BulkLoad(r); err != nil {
+		return err
+	}
+	return qs.Reload(context.TODO())
+}
+
+// ValueOf returns a reference to the canonical node for a given value.
+func (qs *QuadStore) ValueOf(v quad.Value) graph.Value {
+	return qs.canonical(qs.QuadStore.ValueOf(v))
+}
+
+// ValueOfContext is the same as ValueOf, but uses the context when resolving the value in the underlying store.
+func (qs *QuadStore) ValueOfContext(ctx context.Context, v quad.Value) (graph.Value, error) {
+	ref, err := graph.ValueOf(ctx, qs.QuadStore, v)
+	if err != nil {
+		return nil, err
+	}
+	return qs.canonical(ref), nil
+}
+
+func (qs *QuadStore) NameOfContext(ctx context.Context, v graph.Value) (quad.Value, error) {
+	return graph.NameOf(ctx, qs.QuadStore, v)
+}
+
+// Quad returns a quad with all equivalent nodes replaced with canonical ones.
+func (qs *QuadStore) Quad(v graph.Value) quad.Quad {
+	return qs.canonicalQuad(v, qs.QuadStore.Quad(v))
+}
+
+// QuadContext is the same as Quad, but uses the context when loading the quad from the underlying store.
+func (qs *QuadStore) QuadContext(ctx context.Context, v graph.Value) (quad.Quad, error) {
+	q, err := graph.QuadOf(ctx, qs.QuadStore, v)
+	if err != nil {
+		return quad.Quad{}, err
+	}
+	return qs.canonicalQuad(v, q), nil
+}
+
+// canonicalQuad replaces all equivalent nodes of a quad with canonical ones.
+func (qs *QuadStore) canonicalQuad(v graph.Value, q quad.Quad) quad.Quad {
+	for _, d := range quad.Directions {
+		if c := qs.class(qs.QuadStore.QuadDirection(v, d)); c != nil {
+			q.Set(d, c.name)
+		}
+	}
+	return q
+}
+
+func (qs *QuadStore) SizeContext(ctx context.Context) (int64, error) {
+	return graph.SizeOf(ctx, qs.QuadStore)
+}
+
+// QuadDirection returns the canonical node for a given direction of the quad.
+func (qs *QuadStore) QuadDirection(v graph.Value, d quad.Direction) graph.Value {
+	return qs.canonical(qs.QuadStore.QuadDirection(v, d))
+}
+
+// QuadIterator returns quads of all nodes that are equivalent to a given node.
+func (qs *QuadStore) QuadIterator(d quad.Direction, v graph.Value) graph.Iterator {
+	c := qs.class(v)
+	if c == nil {
+		return qs.QuadStore.QuadIterator(d, v)
+	}
+	its := make([]graph.Iterator, 0, len(c.members))
+	for _, m := range c.members {
+		its = append(its, qs.QuadStore.QuadIterator(d, m))
+	}
+	return iterator.NewOr(its...)
+}
+
+// NodesAllIterator returns all nodes of the underlying store, except nodes that are not canonical.
+func (qs *QuadStore) NodesAllIterator() graph.Iterator {
+	qs.mu.RLock()
+	alias := qs.alias
+	qs.mu.RUnlock()
+	if len(alias) == 0 {
+		return qs.QuadStore.NodesAllIterator()
+	}
+	return iterator.NewNot(iterator.NewFixed(alias...), qs.QuadStore.NodesAllIterator())
+}
+
+// OptimizeIterator does nothing, since iterators of the underlying store cannot see equivalent nodes.
+func (qs *QuadStore) OptimizeIterator(it graph.Iterator) (graph.Iterator, bool) {
+	return it, false
+}
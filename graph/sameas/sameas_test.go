@@ -0,0 +1,152 @@
+// Copyright 2017 The Cayley Authors. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package sameas_test
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/cayleygraph/cayley/graph"
+	"github.com/cayleygraph/cayley/graph/graphtest/testutil"
+	"github.com/cayleygraph/cayley/graph/journal"
+	"github.com/cayleygraph/cayley/graph/memstore"
+	"github.com/cayleygraph/cayley/graph/path"
+	"github.com/cayleygraph/cayley/graph/sameas"
+	"github.com/cayleygraph/cayley/quad"
+	"github.com/cayleygraph/cayley/voc/owl"
+	"github.com/cayleygraph/cayley/writer"
+	"github.com/stretchr/testify/require"
+)
+
+var (
+	follows = quad.IRI("follows")
+	name    = quad.IRI("name")
+	sameAs  = quad.IRI(owl.SameAs)
+)
+
+func TestSameAs(t *testing.T) {
+	ctx := context.TODO()
+	base := memstore.New(
+		quad.Make(quad.IRI("alice"), follows, quad.IRI("bob"), nil),
+		quad.Make(quad.IRI("ext:bob"), name, quad.String("Bob"), nil),
+		quad.Make(quad.IRI("charlie"), follows, quad.IRI("ext:bob"), nil),
+		quad.Make(quad.IRI("ext:bob"), sameAs, quad.IRI("bob"), nil),
+		quad.Make(quad.BNode("b1"), sameAs, quad.IRI("ext:bob"), nil),
+		quad.Make(quad.BNode("b1"), follows, quad.IRI("alice"), nil),
+	)
+	qs, err := sameas.New(ctx, base, sameAs)
+	require.NoError(t, err)
+
+	bob := qs.ValueOf(quad.IRI("bob"))
+	require.Equal(t, bob, qs.ValueOf(quad.IRI("ext:bob")))
+	require.Equal(t, bob, qs.ValueOf(quad.BNode("b1")))
+	require.Equal(t, quad.Value(quad.IRI("bob")), qs.NameOf(bob))
+	require.Equal(t, []quad.Value{quad.IRI("bob"), quad.IRI("ext:bob"), quad.BNode("b1")}, qs.Equivalent(quad.IRI("ext:bob")))
+
+	require.Equal(t, []string{"Bob"}, testutil.Collect(t, path.StartPath(qs, quad.IRI("alice")).Out(follows).Out(name)))
+	require.Equal(t, []string{"<alice>", "<charlie>"}, testutil.Collect(t, path.StartPath(qs, quad.IRI("ext:bob")).In(follows)))
+	require.Equal(t, []string{"<alice>"}, testutil.Collect(t, path.StartPath(qs, quad.IRI("bob")).Out(follows)))
+	require.Equal(t, []string{"<bob>"}, testutil.Collect(t, path.StartPath(qs).Has(name, quad.String("Bob"))))
+	require.Equal(t, []string{"<alice>", "<charlie>"}, testutil.Collect(t, path.StartPath(qs).Has(follows, quad.BNode("b1"))))
+
+	// aliases are hidden from all nodes
+	require.Equal(t, []string{"<alice>", "<bob>", "<charlie>", "<follows>", "<name>", "<owl:sameAs>", "Bob"}, testutil.Collect(t, path.StartPath(qs)))
+
+	// store without links behaves as the underlying one
+	plain, err := sameas.New(ctx, memstore.New(quad.Make(quad.IRI("a"), follows, quad.IRI("b"), nil)), nil)
+	require.NoError(t, err)
+	require.Equal(t, []string{"<b>"}, testutil.Collect(t, path.StartPath(plain, quad.IRI("a")).Out(follows)))
+}
+
+func TestSameAsReload(t *testing.T) {
+	ctx := context.TODO()
+	base := memstore.New(
+		quad.Make(quad.IRI("alice"), follows, quad.IRI("bob"), nil),
+		quad.Make(quad.IRI("robert"), name, quad.String("Bob"), nil),
+	)
+	qs, err := sameas.New(ctx, base, nil)
+	require.NoError(t, err)
+	require.Equal(t, []string(nil), testutil.Collect(t, path.StartPath(qs, quad.IRI("alice")).Out(follows).Out(name)))
+
+	w, err := writer.NewSingleReplication(qs, nil)
+	require.NoError(t, err)
+	require.NoError(t, w.AddQuad(quad.Make(quad.IRI("robert"), quad.IRI(owl.SameAs).Full(), quad.IRI("bob"), nil)))
+	require.Equal(t, []string{"Bob"}, testutil.Collect(t, path.StartPath(qs, quad.IRI("alice")).Out(follows).Out(name)))
+	require.Equal(t, []string{"<bob>"}, testutil.Collect(t, path.StartPath(qs, quad.IRI("alice")).Out(follows)))
+
+	// changes applied to the underlying store are visible after reload
+	tx := graph.NewTransaction()
+	tx.RemoveQuad(quad.Make(quad.IRI("robert"), quad.IRI(owl.SameAs).Full(), quad.IRI("bob"), nil))
+	require.NoError(t, base.ApplyDeltas(tx.Deltas, graph.IgnoreOpts{}))
+	require.NoError(t, qs.Reload(ctx))
+	require.Equal(t, []string(nil), testutil.Collect(t, path.StartPath(qs, quad.IRI("alice")).Out(follows).Out(name)))
+}
+
+func TestSameAsUpdate(t *testing.T) {
+	ctx := context.TODO()
+	link := func(a, b string) quad.Quad {
+		return quad.Make(quad.IRI(a), sameAs, quad.IRI(b), nil)
+	}
+	base := memstore.New(
+		link("a", "b"),
+		link("x", "y"),
+		quad.Make(quad.IRI("c"), follows, quad.IRI("d"), nil),
+	)
+	qs, err := sameas.New(ctx, base, sameAs)
+	require.NoError(t, err)
+	w, err := writer.NewSingleReplication(qs, nil)
+	require.NoError(t, err)
+
+	equiv := func(v string) []quad.Value {
+		return qs.Equivalent(quad.IRI(v))
+	}
+	// classes are merged
+	require.NoError(t, w.AddQuadSet([]quad.Quad{link("b", "c"), link("d", "c")}))
+	require.Equal(t, []quad.Value{quad.IRI("a"), quad.IRI("b"), quad.IRI("c"), quad.IRI("d")}, equiv("d"))
+	require.Equal(t, []quad.Value{quad.IRI("x"), quad.IRI("y")}, equiv("x"))
+
+	// and split again
+	require.NoError(t, w.RemoveQuad(link("b", "c")))
+	require.Equal(t, []quad.Value{quad.IRI("a"), quad.IRI("b")}, equiv("a"))
+	require.Equal(t, []quad.Value{quad.IRI("c"), quad.IRI("d")}, equiv("d"))
+	require.Equal(t, []string{"<c>"}, testutil.Collect(t, path.StartPath(qs, quad.IRI("d")).Out(follows)))
+
+	require.NoError(t, w.RemoveQuad(link("d", "c")))
+	require.Equal(t, []quad.Value{quad.IRI("d")}, equiv("d"))
+	require.Equal(t, []string{"<d>"}, testutil.Collect(t, path.StartPath(qs, quad.IRI("c")).Out(follows)))
+
+	// the same result as a full reload
+	all := testutil.Collect(t, path.StartPath(qs))
+	require.NoError(t, qs.Reload(ctx))
+	require.Equal(t, all, testutil.Collect(t, path.StartPath(qs)))
+}
+
+func TestSameAsUnwrap(t *testing.T) {
+	dir, err := ioutil.TempDir("", "cayley_sameas")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	j, err := journal.Open(filepath.Join(dir, "journal.nq"), true)
+	require.NoError(t, err)
+	qs, err := sameas.New(context.TODO(), journal.Wrap(memstore.New(), j), nil)
+	require.NoError(t, err)
+	defer qs.Close()
+	require.True(t, journal.From(qs) == j)
+	_, ok := graph.AsVersioned(qs)
+	require.True(t, ok)
+}
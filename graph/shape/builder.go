@@ -0,0 +1,211 @@
+package shape
+
+import (
+	"context"
+	"regexp"
+
+	"github.com/cayleygraph/cayley/graph"
+	"github.com/cayleygraph/cayley/graph/iterator"
+	"github.com/cayleygraph/cayley/quad"
+)
+
+// Nodes is a builder for a query that returns a set of nodes. It is intended for implementing
+// query languages and other tools that construct queries programmatically.
+//
+// Builder values are immutable: each method returns a new builder and never modifies the receiver,
+// thus a builder can be reused as a prefix of multiple queries. Zero value is a query for all nodes.
+//
+// Compatibility: constructors and methods of Nodes are a stable API and follow the semantics
+// documented here. The exact shape tree returned by Shape is not a part of this guarantee
+// and may change between releases, since shapes and optimizations evolve over time.
+// Treat the result of Shape as opaque and only pass it to functions of this package, or to Walk.
+type Nodes struct {
+	s Shape
+}
+
+// StartNodes starts a query from a set of nodes. If no values are given, the query starts from all nodes.
+func StartNodes(vals ...quad.Value) Nodes {
+	if len(vals) == 0 {
+		return Nodes{s: AllNodes{}}
+	}
+	return Nodes{s: Lookup(vals)}
+}
+
+// NewNodes wraps an existing shape into a builder.
+func NewNodes(s Shape) Nodes {
+	if s == nil {
+		s = Null{}
+	}
+	return Nodes{s: s}
+}
+
+// Shape returns a shape tree for the query.
+func (n Nodes) Shape() Shape {
+	if n.s == nil {
+		return AllNodes{}
+	}
+	return n.s
+}
+
+// BuildIterator optimizes the query and builds an iterator for it.
+func (n Nodes) BuildIterator(qs graph.QuadStore) graph.Iterator {
+	return BuildIterator(qs, n.Shape())
+}
+
+// Iterate optimizes and runs the query.
+func (n Nodes) Iterate(ctx context.Context, qs graph.QuadStore) *graph.IterateChain {
+	return Iterate(ctx, qs, n.Shape())
+}
+
+func viaShape(via []quad.Value) Shape {
+	if len(via) == 0 {
+		return AllNodes{}
+	}
+	return Lookup(via)
+}
+
+// Out follows outgoing links with one of the given predicates. All predicates are followed if none are given.
+func (n Nodes) Out(via ...quad.Value) Nodes {
+	return n.OutVia(StartNodes(via...))
+}
+
+// In follows incoming links with one of the given predicates. All predicates are followed if none are given.
+func (n Nodes) In(via ...quad.Value) Nodes {
+	return n.InVia(StartNodes(via...))
+}
+
+// OutVia follows outgoing links with predicates returned by a given query.
+// Tags are set to the predicate of the followed link.
+func (n Nodes) OutVia(via Nodes, tags ...string) Nodes {
+	return Nodes{s: Out(n.Shape(), via.Shape(), nil, tags...)}
+}
+
+// InVia follows incoming links with predicates returned by a given query.
+// Tags are set to the predicate of the followed link.
+func (n Nodes) InVia(via Nodes, tags ...string) Nodes {
+	return Nodes{s: In(n.Shape(), via.Shape(), nil, tags...)}
+}
+
+// Both follows links with one of the given predicates in both directions.
+func (n Nodes) Both(via ...quad.Value) Nodes {
+	return n.Out(via...).Or(n.In(via...))
+}
+
+// Has keeps only nodes that have an outgoing link with a predicate to one of the given values.
+// If no values are given, any link with this predicate is accepted.
+func (n Nodes) Has(via quad.Value, vals ...quad.Value) Nodes {
+	return Nodes{s: Has(n.Shape(), viaShape([]quad.Value{via}), viaShape(vals), false)}
+}
+
+// HasReverse is the same as Has, but checks incoming links.
+func (n Nodes) HasReverse(via quad.Value, vals ...quad.Value) Nodes {
+	return Nodes{s: Has(n.Shape(), viaShape([]quad.Value{via}), viaShape(vals), true)}
+}
+
+// Tag saves current nodes into given tags.
+func (n Nodes) Tag(tags ...string) Nodes {
+	if len(tags) == 0 {
+		return n
+	}
+	return Nodes{s: Save{From: n.Shape(), Tags: tags}}
+}
+
+// Save saves nodes linked to the current ones with a given predicate into a tag.
+// Nodes that have no such link are dropped.
+func (n Nodes) Save(via quad.Value, tag string) Nodes {
+	return Nodes{s: SaveVia(n.Shape(), Lookup{via}, tag, false, false)}
+}
+
+// SaveReverse is the same as Save, but follows incoming links.
+func (n Nodes) SaveReverse(via quad.Value, tag string) Nodes {
+	return Nodes{s: SaveVia(n.Shape(), Lookup{via}, tag, true, false)}
+}
+
+// SaveOptional is the same as Save, but keeps nodes that have no such link.
+func (n Nodes) SaveOptional(via quad.Value, tag string) Nodes {
+	return Nodes{s: SaveVia(n.Shape(), Lookup{via}, tag, false, true)}
+}
+
+// Filter keeps only nodes that pass all given filters.
+func (n Nodes) Filter(filters ...ValueFilter) Nodes {
+	return Nodes{s: AddFilters(n.Shape(), filters...)}
+}
+
+// Compare keeps only nodes that satisfy a comparison with a given value.
+func (n Nodes) Compare(op iterator.Operator, v quad.Value) Nodes {
+	return n.Filter(Comparison{Op: op, Val: v})
+}
+
+// Regex keeps only string nodes that match a regular expression. If refs is set, IRIs and blank nodes are matched as well.
+func (n Nodes) Regex(re *regexp.Regexp, refs bool) Nodes {
+	return n.Filter(Regexp{Re: re, Refs: refs})
+}
+
+// Lang keeps only language-tagged strings with one of the given languages.
+func (n Nodes) Lang(langs ...string) Nodes {
+	return n.Filter(Language{Langs: langs})
+}
+
+// And keeps only nodes that are returned by all given queries as well.
+func (n Nodes) And(qs ...Nodes) Nodes {
+	s := n.Shape()
+	for _, q := range qs {
+		s = IntersectShapes(s, q.Shape())
+	}
+	return Nodes{s: s}
+}
+
+// Or adds nodes returned by given queries.
+func (n Nodes) Or(qs ...Nodes) Nodes {
+	s := n.Shape()
+	for _, q := range qs {
+		s = UnionShapes(s, q.Shape())
+	}
+	return Nodes{s: s}
+}
+
+// Except removes nodes returned by a given query.
+func (n Nodes) Except(q Nodes) Nodes {
+	return Nodes{s: Except{From: n.Shape(), Exclude: q.Shape()}}
+}
+
+// Unique removes duplicate nodes.
+func (n Nodes) Unique() Nodes {
+	return Nodes{s: Unique{From: n.Shape()}}
+}
+
+// Skip skips a given number of results. Zero or negative value is ignored.
+func (n Nodes) Skip(v int64) Nodes {
+	if v <= 0 {
+		return n
+	}
+	return Nodes{s: Page{From: n.Shape(), Skip: v}}
+}
+
+// Limit limits the number of results. Zero or negative value is ignored.
+func (n Nodes) Limit(v int64) Nodes {
+	if v <= 0 {
+		return n
+	}
+	return Nodes{s: Page{From: n.Shape(), Limit: v}}
+}
+
+// Count returns a single value - the number of results.
+func (n Nodes) Count() Nodes {
+	return Nodes{s: Count{Values: n.Shape()}}
+}
+
+// OutPredicates returns predicates of all outgoing links of current nodes.
+func (n Nodes) OutPredicates() Nodes {
+	return Nodes{s: Predicates(n.Shape(), false)}
+}
+
+// InPredicates returns predicates of all incoming links of current nodes.
+func (n Nodes) InPredicates() Nodes {
+	return Nodes{s: Predicates(n.Shape(), true)}
+}
+
+// Labels returns labels of all links of current nodes.
+func (n Nodes) Labels() Nodes {
+	return Nodes{s: Labels(n.Shape())}
+}
@@ -0,0 +1,205 @@
+package shape
+
+import (
+	"reflect"
+	"sync"
+
+	"github.com/cayleygraph/cayley/graph"
+	"github.com/cayleygraph/cayley/graph/iterator"
+)
+
+// Memo evaluates a sub-query once and shares the results between all references to it.
+//
+// Optimize replaces identical sub-shapes of the query with a single Memo. This is common for
+// queries that are built in a loop, where each branch repeats the same traversal.
+type Memo struct {
+	Shape Shape
+	c     *memoCache
+}
+
+// NewMemo wraps a shape into a Memo. All copies of the returned value will share the results.
+func NewMemo(s Shape) Memo {
+	return Memo{Shape: s, c: &memoCache{}}
+}
+
+type memoCache struct {
+	mu sync.Mutex
+	it *iterator.Materialize
+}
+
+func (s Memo) BuildIterator(qs graph.QuadStore) graph.Iterator {
+	if IsNull(s.Shape) {
+		return iterator.NewNull()
+	}
+	if s.c == nil {
+		return s.Shape.BuildIterator(qs)
+	}
+	s.c.mu.Lock()
+	defer s.c.mu.Unlock()
+	if s.c.it == nil {
+		s.c.it = iterator.NewMaterialize(s.Shape.BuildIterator(qs))
+	}
+	// the original is never returned, so tags of one reference won't leak to the others;
+	// clones share materialized results, thus the sub-query runs only once
+	return s.c.it.Clone()
+}
+func (s Memo) Optimize(r Optimizer) (Shape, bool) {
+	if IsNull(s.Shape) {
+		return nil, true
+	}
+	if r != nil {
+		return r.OptimizeShape(s)
+	}
+	return s, false
+}
+
+// memoizable checks if it's worth to share results of the shape.
+// Leaf shapes are cheap to evaluate, and some shapes rely on a specific iterator semantic.
+func memoizable(s Shape) bool {
+	switch s.(type) {
+	case NodesFrom, QuadsAction, Intersect, Union, Except, Filter, Count, Page, Unique, Save:
+		return true
+	}
+	return false
+}
+
+// memoize replaces identical sub-shapes of the tree with a shared Memo, so they are evaluated only once.
+func memoize(s Shape) (Shape, bool) {
+	var groups [][]Shape
+	find := func(s Shape) int {
+		for i, g := range groups {
+			if reflect.TypeOf(g[0]) == reflect.TypeOf(s) && reflect.DeepEqual(g[0], s) {
+				return i
+			}
+		}
+		return -1
+	}
+	Walk(s, func(s Shape) bool {
+		if !memoizable(s) {
+			return true
+		}
+		if i := find(s); i >= 0 {
+			// all sub-shapes of this one were already counted
+			groups[i] = append(groups[i], s)
+			return false
+		}
+		groups = append(groups, []Shape{s})
+		return true
+	})
+	memos := make(map[int]Shape)
+	for i, g := range groups {
+		if len(g) > 1 {
+			memos[i] = nil
+		}
+	}
+	if len(memos) == 0 {
+		return s, false
+	}
+	var replace func(s Shape) (Shape, bool)
+	replace = func(s Shape) (Shape, bool) {
+		if memoizable(s) {
+			if i := find(s); i >= 0 {
+				if m, ok := memos[i]; ok {
+					if m == nil {
+						sub, _ := replaceShapes(s, replace)
+						m = NewMemo(sub)
+						memos[i] = m
+					}
+					return m, true
+				}
+			}
+		}
+		return replaceShapes(s, replace)
+	}
+	return replace(s)
+}
+
+// replaceShapes calls a function for each direct sub-shape and returns a copy of the shape with
+// results substituted. Only sub-shapes that are stored in fields of the Shape interface type can be replaced.
+func replaceShapes(s Shape, fnc func(Shape) (Shape, bool)) (Shape, bool) {
+	nv, ok := replaceReflect(reflect.ValueOf(s), fnc)
+	if !ok {
+		return s, false
+	}
+	return nv.Interface().(Shape), true
+}
+
+func replaceValue(rv reflect.Value, fnc func(Shape) (Shape, bool)) (reflect.Value, bool) {
+	if rv.Kind() == reflect.Interface && rv.Type() == rtShape {
+		if rv.IsNil() {
+			return rv, false
+		}
+		ns, ok := fnc(rv.Interface().(Shape))
+		if !ok {
+			return rv, false
+		}
+		nv := reflect.New(rtShape).Elem()
+		if ns != nil {
+			nv.Set(reflect.ValueOf(ns))
+		}
+		return nv, true
+	}
+	return replaceReflect(rv, fnc)
+}
+
+func replaceReflect(rv reflect.Value, fnc func(Shape) (Shape, bool)) (reflect.Value, bool) {
+	rt := rv.Type()
+	switch rv.Kind() {
+	case reflect.Slice:
+		var out reflect.Value
+		for i := 0; i < rv.Len(); i++ {
+			v, ok := replaceValue(rv.Index(i), fnc)
+			if !ok {
+				continue
+			}
+			if !out.IsValid() {
+				out = reflect.MakeSlice(rt, rv.Len(), rv.Len())
+				reflect.Copy(out, rv)
+			}
+			out.Index(i).Set(v)
+		}
+		if out.IsValid() {
+			return out, true
+		}
+	case reflect.Map:
+		var out reflect.Value
+		for _, k := range rv.MapKeys() {
+			v, ok := replaceValue(rv.MapIndex(k), fnc)
+			if !ok {
+				continue
+			}
+			if !out.IsValid() {
+				out = reflect.MakeMap(rt)
+				for _, k2 := range rv.MapKeys() {
+					out.SetMapIndex(k2, rv.MapIndex(k2))
+				}
+			}
+			out.SetMapIndex(k, v)
+		}
+		if out.IsValid() {
+			return out, true
+		}
+	case reflect.Struct:
+		var out reflect.Value
+		for i := 0; i < rt.NumField(); i++ {
+			f := rt.Field(i)
+			if f.PkgPath != "" {
+				// unexported
+				continue
+			}
+			v, ok := replaceValue(rv.Field(i), fnc)
+			if !ok {
+				continue
+			}
+			if !out.IsValid() {
+				out = reflect.New(rt).Elem()
+				out.Set(rv)
+			}
+			out.Field(i).Set(v)
+		}
+		if out.IsValid() {
+			return out, true
+		}
+	}
+	return rv, false
+}
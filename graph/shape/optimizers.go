@@ -0,0 +1,113 @@
+package shape
+
+import (
+	"fmt"
+
+	"github.com/cayleygraph/cayley/graph"
+)
+
+// OptimizerFunc is an optimization rule that replaces a shape with a more efficient one for a given quad store.
+// It should return false if the shape or the quad store is not supported by the rule.
+//
+// Rules allow packages to define new shapes and rewrite them into shapes native to a specific backend.
+type OptimizerFunc func(qs graph.QuadStore, s Shape) (Shape, bool)
+
+type optimizerRule struct {
+	name string
+	fnc  OptimizerFunc
+}
+
+var optimizerRules []optimizerRule
+
+// RegisterOptimizer registers an optimization rule with a unique name.
+//
+// Rules are applied to each shape of the tree bottom-up in order of registration, right before the
+// optimizer of a quad store. Thus, a shape replaced by the rule can be merged with its parents by the backend.
+// Rules must check the type of the quad store they are called for.
+func RegisterOptimizer(name string, fnc OptimizerFunc) {
+	if fnc == nil {
+		panic("optimizer function must not be nil")
+	}
+	for _, r := range optimizerRules {
+		if r.name == name {
+			panic(fmt.Sprintf("already registered optimizer %q", name))
+		}
+	}
+	optimizerRules = append(optimizerRules, optimizerRule{name: name, fnc: fnc})
+}
+
+// UnregisterOptimizer removes an optimization rule registered with a given name.
+func UnregisterOptimizer(name string) {
+	for i, r := range optimizerRules {
+		if r.name == name {
+			optimizerRules = append(optimizerRules[:i:i], optimizerRules[i+1:]...)
+			return
+		}
+	}
+}
+
+// Optimizers returns names of all registered optimization rules.
+func Optimizers() []string {
+	names := make([]string, 0, len(optimizerRules))
+	for _, r := range optimizerRules {
+		names = append(names, r.name)
+	}
+	return names
+}
+
+// storeOptimizer applies registered rules and an optimizer of the quad store, if any.
+type storeOptimizer struct {
+	qs    graph.QuadStore
+	rules []optimizerRule
+	opt   Optimizer
+}
+
+// newStoreOptimizer does not unwrap the store: wrappers that keep the data of the underlying store as-is
+// should implement Optimizer and Rewriter with OptimizeWith and RewriteWith.
+func newStoreOptimizer(qs graph.QuadStore) Optimizer {
+	so, _ := qs.(Optimizer)
+	if qs == nil || len(optimizerRules) == 0 {
+		return so
+	}
+	return storeOptimizer{qs: qs, rules: optimizerRules, opt: so}
+}
+
+// OptimizeWith applies registered rules and an optimizer of a given quad store to a single shape.
+//
+// Wrappers that do not change the data of the underlying store use it to keep backend-specific optimizations.
+// Wrappers that filter or change the data must not pass shapes to the underlying store.
+func OptimizeWith(qs graph.QuadStore, s Shape) (Shape, bool) {
+	if so := newStoreOptimizer(qs); so != nil {
+		return so.OptimizeShape(s)
+	}
+	return s, false
+}
+
+// RewriteWith applies rewrites of a given quad store to a single shape, if the store implements Rewriter.
+// See OptimizeWith.
+func RewriteWith(qs graph.QuadStore, s Shape) (Shape, bool) {
+	if rw, ok := qs.(Rewriter); ok {
+		return rw.RewriteShape(s)
+	}
+	return s, false
+}
+
+func (o storeOptimizer) OptimizeShape(s Shape) (Shape, bool) {
+	var opt bool
+	for _, r := range o.rules {
+		ns, ok := r.fnc(o.qs, s)
+		if !ok {
+			continue
+		}
+		opt = true
+		if ns == nil {
+			ns = Null{}
+		}
+		s = ns
+	}
+	if o.opt == nil {
+		return s, opt
+	}
+	ns, ok := o.opt.OptimizeShape(s)
+	return ns, opt || ok
+}
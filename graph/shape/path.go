@@ -31,6 +31,22 @@ func UnionShapes(s1, s2 Shape) Union {
 	return Union{s1, s2}
 }
 
+// OutWithProvenance is the same as Out, but also tags results with an author and time of the followed quads.
+func OutWithProvenance(from, via, labels Shape, author, time string) Shape {
+	return buildOutWithProvenance(from, via, labels, author, time, false)
+}
+
+// InWithProvenance is the same as In, but also tags results with an author and time of the followed quads.
+func InWithProvenance(from, via, labels Shape, author, time string) Shape {
+	return buildOutWithProvenance(from, via, labels, author, time, true)
+}
+
+func buildOutWithProvenance(from, via, labels Shape, author, time string, in bool) Shape {
+	ns := buildOut(from, via, labels, nil, in).(NodesFrom)
+	ns.Quads = ProvenanceTags{Quads: ns.Quads, Author: author, Time: time}
+	return ns
+}
+
 func buildOut(from, via, labels Shape, tags []string, in bool) Shape {
 	start, goal := quad.Subject, quad.Object
 	if in {
@@ -153,8 +169,90 @@ func SaveViaLabels(from, via, labels Shape, tag string, rev, opt bool) Shape {
 	return IntersectShapes(from, save)
 }
 
+// langNodes returns all values in a given language. See Language for details.
+func langNodes(lang string) Shape {
+	return Filter{From: AllNodes{}, Filters: []ValueFilter{Language{Langs: []string{lang}}}}
+}
+
+// withoutLangs returns nodes that have no links via a given predicate to values in any of the given languages.
+func withoutLangs(via, labels Shape, langs []string, rev bool) Shape {
+	start, goal := quad.Subject, quad.Object
+	if rev {
+		start, goal = goal, start
+	}
+	quads := Quads{
+		{Dir: goal, Values: Filter{From: AllNodes{}, Filters: []ValueFilter{Language{Langs: langs}}}},
+		{Dir: quad.Predicate, Values: via},
+	}
+	if labels != nil {
+		if _, ok := labels.(AllNodes); !ok {
+			quads = append(quads, QuadFilter{Dir: quad.Label, Values: labels})
+		}
+	}
+	return Except{Exclude: NodesFrom{Quads: quads, Dir: start}}
+}
+
+// OutLang follows outgoing links via a given predicate, but only returns values in the most preferred
+// language available for each node. Languages are listed in the order of preference; an empty string
+// stands for strings without a language tag. If no languages are given, it is the same as Out.
+func OutLang(from, via, labels Shape, langs ...string) Shape {
+	if len(langs) == 0 {
+		return Out(from, via, labels)
+	}
+	var out Union
+	for i, l := range langs {
+		nodes := from
+		if i > 0 {
+			// only nodes that have no values in more preferred languages
+			nodes = IntersectShapes(from, withoutLangs(via, labels, langs[:i], false))
+		}
+		out = append(out, AddFilters(Out(nodes, via, labels), Language{Langs: []string{l}}))
+	}
+	if len(out) == 1 {
+		return out[0]
+	}
+	return out
+}
+
+// SaveViaLang is the same as SaveViaLabels, but only saves values in the most preferred language available
+// for each node. See OutLang for details.
+func SaveViaLang(from, via, labels Shape, langs []string, tag string, rev, opt bool) Shape {
+	if len(langs) == 0 {
+		return SaveViaLabels(from, via, labels, tag, rev, opt)
+	}
+	start, goal := quad.Subject, quad.Object
+	if rev {
+		start, goal = goal, start
+	}
+	var saves Union
+	for i, l := range langs {
+		quads := Quads{
+			{Dir: goal, Values: Save{From: langNodes(l), Tags: []string{tag}}},
+			{Dir: quad.Predicate, Values: via},
+		}
+		if labels != nil {
+			if _, ok := labels.(AllNodes); !ok {
+				quads = append(quads, QuadFilter{Dir: quad.Label, Values: labels})
+			}
+		}
+		var save Shape = NodesFrom{Quads: quads, Dir: start}
+		if i > 0 {
+			save = IntersectShapes(withoutLangs(via, labels, langs[:i], rev), save)
+		}
+		saves = append(saves, save)
+	}
+	var save Shape = saves
+	if len(saves) == 1 {
+		save = saves[0]
+	}
+	if opt {
+		save = Optional{save}
+	}
+	return IntersectShapes(from, save)
+}
+
 func Has(from, via, nodes Shape, rev bool) Shape {
-	return HasLabels(from, via, AllNodes{}, nodes, rev)
+	return HasLabels(from, via, nodes, AllNodes{}, rev)
 }
 
 func HasLabels(from, via, nodes, labels Shape, rev bool) Shape {
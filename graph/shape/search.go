@@ -0,0 +1,70 @@
+package shape
+
+import (
+	"context"
+
+	"github.com/cayleygraph/cayley/graph"
+	"github.com/cayleygraph/cayley/graph/iterator"
+	"github.com/cayleygraph/cayley/quad"
+)
+
+var _ Shape = TextSearch{}
+
+// TextSearch is a shape that returns nodes with string values that match a full-text query.
+// Quad store must implement graph.TextIndexer, see graph.WithTextIndex.
+//
+// Results are ordered by relevance, if they are not merged with other shapes.
+type TextSearch struct {
+	Query string
+	Limit int // zero or negative value means no limit
+}
+
+func (s TextSearch) BuildIterator(qs graph.QuadStore) graph.Iterator {
+	idx, ok := graph.AsTextIndexer(qs)
+	if !ok {
+		return iterator.NewError(graph.ErrTextSearchNotSupported)
+	}
+	return iterator.NewTextSearch(qs, idx, s.Query, s.Limit)
+}
+func (s TextSearch) Optimize(r Optimizer) (Shape, bool) {
+	if r != nil {
+		return r.OptimizeShape(s)
+	}
+	return s, false
+}
+
+var _ Shape = NearestVectors{}
+
+// NearestVectors is a shape that returns up to K vector values that are the closest to a given vector.
+// Quad store must implement graph.VectorIndexer, see graph.WithVectorIndex.
+//
+// Results are ordered by distance, if they are not merged with other shapes.
+type NearestVectors struct {
+	Vector quad.Vector
+	K      int
+}
+
+func (s NearestVectors) BuildIterator(qs graph.QuadStore) graph.Iterator {
+	idx, ok := graph.AsVectorIndexer(qs)
+	if !ok {
+		return iterator.NewError(graph.ErrVectorSearchNotSupported)
+	}
+	vecs, err := idx.NearestVectors(context.TODO(), s.Vector, s.K)
+	if err != nil {
+		return iterator.NewError(err)
+	}
+	vals := make([]quad.Value, 0, len(vecs))
+	for _, v := range vecs {
+		vals = append(vals, v)
+	}
+	return Lookup(vals).BuildIterator(qs)
+}
+func (s NearestVectors) Optimize(r Optimizer) (Shape, bool) {
+	if s.K <= 0 {
+		return Null{}, true
+	}
+	if r != nil {
+		return r.OptimizeShape(s)
+	}
+	return s, false
+}
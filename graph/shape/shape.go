@@ -1,8 +1,12 @@
 package shape
 
 import (
+	"context"
+	"fmt"
 	"reflect"
 	"regexp"
+	"strings"
+	"unicode/utf8"
 
 	"github.com/cayleygraph/cayley/clog"
 	"github.com/cayleygraph/cayley/graph"
@@ -27,6 +31,22 @@ type Optimizer interface {
 	OptimizeShape(s Shape) (Shape, bool)
 }
 
+// Rewriter is an optional interface for QuadStores that can replace parts of the query tree
+// before values are resolved and any other optimizations are applied. Shapes are passed bottom-up.
+//
+// It is used to substitute precomputed results, like materialized views.
+type Rewriter interface {
+	RewriteShape(s Shape) (Shape, bool)
+}
+
+type rewriteShapes struct {
+	r Rewriter
+}
+
+func (r rewriteShapes) OptimizeShape(s Shape) (Shape, bool) {
+	return r.r.RewriteShape(s)
+}
+
 // Composite shape can be simplified to a tree of more basic shapes.
 type Composite interface {
 	Simplify() Shape
@@ -55,9 +75,18 @@ func Optimize(s Shape, qs graph.QuadStore) (Shape, bool) {
 		return nil, false
 	}
 	var opt bool
+	if rw, ok := qs.(Rewriter); ok {
+		// substitute parts of the tree while it still matches the original query
+		s, opt = s.Optimize(rewriteShapes{r: rw})
+		if s == nil {
+			return Null{}, true
+		}
+	}
 	if qs != nil {
+		var opt1 bool
 		// resolve all lookups earlier
-		s, opt = s.Optimize(resolveValues{qs: qs})
+		s, opt1 = s.Optimize(resolveValues{qs: qs})
+		opt = opt || opt1
 	}
 	if s == nil {
 		return Null{}, true
@@ -69,8 +98,8 @@ func Optimize(s Shape, qs graph.QuadStore) (Shape, bool) {
 		return Null{}, true
 	}
 	opt = opt || opt1
-	// apply quadstore-specific optimizations
-	if so, ok := qs.(Optimizer); ok && s != nil {
+	// apply registered rules and quadstore-specific optimizations
+	if so := newStoreOptimizer(qs); so != nil && s != nil {
 		var opt2 bool
 		s, opt2 = s.Optimize(so)
 		opt = opt || opt2
@@ -78,7 +107,10 @@ func Optimize(s Shape, qs graph.QuadStore) (Shape, bool) {
 	if s == nil {
 		return Null{}, true
 	}
-	return s, opt
+	// evaluate identical sub-queries only once
+	var opt3 bool
+	s, opt3 = memoize(s)
+	return s, opt || opt3
 }
 
 var rtShape = reflect.TypeOf((*Shape)(nil)).Elem()
@@ -101,7 +133,8 @@ func walkReflect(rv reflect.Value, fnc WalkFunc) {
 		if rt.Elem().ConvertibleTo(rtShape) {
 			// all element are shapes - call function on each of them
 			for i := 0; i < rv.Len(); i++ {
-				Walk(rv.Index(i).Interface().(Shape), fnc)
+				sh, _ := rv.Index(i).Interface().(Shape)
+				Walk(sh, fnc)
 			}
 		} else {
 			// elements are not shapes, but might contain them
@@ -114,7 +147,8 @@ func walkReflect(rv reflect.Value, fnc WalkFunc) {
 		if rt.Elem().ConvertibleTo(rtShape) {
 			// all element are shapes - call function on each of them
 			for _, k := range keys {
-				Walk(rv.MapIndex(k).Interface().(Shape), fnc)
+				sh, _ := rv.MapIndex(k).Interface().(Shape)
+				Walk(sh, fnc)
 			}
 		} else {
 			// elements are not shapes, but might contain them
@@ -129,7 +163,9 @@ func walkReflect(rv reflect.Value, fnc WalkFunc) {
 			// if field is of shape type - call function on it
 			// we skip anonymous fields because they were already visited as part of the parent
 			if !f.Anonymous && f.Type.ConvertibleTo(rtShape) {
-				Walk(rv.Field(i).Interface().(Shape), fnc)
+				// nil shapes are skipped, like Except.From
+				sh, _ := rv.Field(i).Interface().(Shape)
+				Walk(sh, fnc)
 				continue
 			}
 			// it might be a struct/map/slice field, so we need to go deeper
@@ -341,6 +377,144 @@ func (f Regexp) BuildIterator(qs graph.QuadStore, it graph.Iterator) graph.Itera
 	return rit
 }
 
+var _ ValueFilter = Language{}
+
+// Language filters language-tagged strings by their language.
+// An empty language matches plain strings without a language tag.
+type Language struct {
+	Langs []string
+}
+
+func (f Language) BuildIterator(qs graph.QuadStore, it graph.Iterator) graph.Iterator {
+	return iterator.NewLanguage(it, qs, f.Langs...)
+}
+
+// StringOp is an operation used by the StringMatch filter.
+type StringOp int
+
+const (
+	StringEqual    = StringOp(iota) // value is equal to the string
+	StringPrefix                    // value starts with the string
+	StringSuffix                    // value ends with the string
+	StringContains                  // value contains the string
+)
+
+func (op StringOp) String() string {
+	switch op {
+	case StringEqual:
+		return "equal"
+	case StringPrefix:
+		return "prefix"
+	case StringSuffix:
+		return "suffix"
+	case StringContains:
+		return "contains"
+	}
+	return fmt.Sprintf("StringOp(%d)", int(op))
+}
+
+var _ ValueFilter = StringMatch{}
+
+// StringMatch filters string values with a simple string operation.
+// Unlike Regexp, it can be executed by some backends natively.
+type StringMatch struct {
+	Op   StringOp
+	Val  string
+	Fold bool // compare strings case-insensitively
+	Refs bool // allow to match IRIs and BNodes
+}
+
+// Matches checks if a value passes the filter.
+func (f StringMatch) Matches(v quad.Value) bool {
+	s, ok := filterString(v, f.Refs)
+	if !ok {
+		return false
+	}
+	pat := f.Val
+	if f.Fold {
+		if f.Op == StringEqual {
+			return strings.EqualFold(s, pat)
+		}
+		s, pat = strings.ToLower(s), strings.ToLower(pat)
+	}
+	switch f.Op {
+	case StringEqual:
+		return s == pat
+	case StringPrefix:
+		return strings.HasPrefix(s, pat)
+	case StringSuffix:
+		return strings.HasSuffix(s, pat)
+	case StringContains:
+		return strings.Contains(s, pat)
+	}
+	return false
+}
+
+func (f StringMatch) BuildIterator(qs graph.QuadStore, it graph.Iterator) graph.Iterator {
+	return iterator.NewValueFilter(it, qs, f.Op.String(), f.Matches)
+}
+
+var _ ValueFilter = Length{}
+
+// Length filters strings by the number of characters in them.
+type Length struct {
+	Min  int  // inclusive
+	Max  int  // inclusive; negative value means no upper limit
+	Refs bool // allow to match IRIs and BNodes
+}
+
+// Matches checks if a value passes the filter.
+func (f Length) Matches(v quad.Value) bool {
+	s, ok := filterString(v, f.Refs)
+	if !ok {
+		return false
+	}
+	n := utf8.RuneCountInString(s)
+	return n >= f.Min && (f.Max < 0 || n <= f.Max)
+}
+
+func (f Length) BuildIterator(qs graph.QuadStore, it graph.Iterator) graph.Iterator {
+	return iterator.NewValueFilter(it, qs, "length", f.Matches)
+}
+
+var _ ValueFilter = Modulo{}
+
+// Modulo filters integer values that give a specific remainder when divided by a given number.
+type Modulo struct {
+	Div int64
+	Rem int64
+}
+
+// Matches checks if a value passes the filter.
+func (f Modulo) Matches(v quad.Value) bool {
+	i, ok := v.(quad.Int)
+	if !ok || f.Div == 0 {
+		return false
+	}
+	return int64(i)%f.Div == f.Rem
+}
+
+func (f Modulo) BuildIterator(qs graph.QuadStore, it graph.Iterator) graph.Iterator {
+	return iterator.NewValueFilter(it, qs, "modulo", f.Matches)
+}
+
+// filterString returns a string that can be matched by string filters. See Regexp for the list of value types.
+func filterString(v quad.Value, refs bool) (string, bool) {
+	switch v := v.(type) {
+	case quad.String:
+		return string(v), true
+	case quad.TypedString:
+		return string(v.Value), true
+	case quad.LangString:
+		return string(v.Value), true
+	case quad.IRI:
+		return string(v), refs
+	case quad.BNode:
+		return string(v), refs
+	}
+	return "", false
+}
+
 // Count returns a count of objects in source as a single value. It always returns exactly one value.
 type Count struct {
 	Values Shape
@@ -750,11 +924,88 @@ type valueResolver interface {
 	ValueOf(v quad.Value) graph.Value
 }
 
+// ExpandIRIs wraps a quad store to enable a fallback for IRI lookups: if an IRI is not found in the store,
+// it is expanded using the global namespace registry (see voc) and looked up again. It allows to use prefixed
+// names in queries.
+//
+// Shape rewrites and optimizations of the underlying store are applied to queries on the wrapper.
+func ExpandIRIs(qs graph.QuadStore) graph.QuadStore {
+	return &expandIRIs{QuadStore: qs}
+}
+
+var (
+	_ Optimizer              = (*expandIRIs)(nil)
+	_ Rewriter               = (*expandIRIs)(nil)
+	_ graph.Unwrapper        = (*expandIRIs)(nil)
+	_ graph.ContextQuadStore = (*expandIRIs)(nil)
+)
+
+type expandIRIs struct {
+	graph.QuadStore
+}
+
+func (qs *expandIRIs) Unwrap() graph.QuadStore {
+	return qs.QuadStore
+}
+
+func (qs *expandIRIs) ValueOf(v quad.Value) graph.Value {
+	gv := qs.QuadStore.ValueOf(v)
+	if iri, ok := v.(quad.IRI); ok && gv == nil {
+		if full := iri.Full(); full != iri {
+			gv = qs.QuadStore.ValueOf(full)
+		}
+	}
+	return gv
+}
+
+func (qs *expandIRIs) ValueOfContext(ctx context.Context, v quad.Value) (graph.Value, error) {
+	gv, err := graph.ValueOf(ctx, qs.QuadStore, v)
+	if err != nil {
+		return nil, err
+	}
+	if iri, ok := v.(quad.IRI); ok && gv == nil {
+		if full := iri.Full(); full != iri {
+			return graph.ValueOf(ctx, qs.QuadStore, full)
+		}
+	}
+	return gv, nil
+}
+
+func (qs *expandIRIs) NameOfContext(ctx context.Context, v graph.Value) (quad.Value, error) {
+	return graph.NameOf(ctx, qs.QuadStore, v)
+}
+
+func (qs *expandIRIs) QuadContext(ctx context.Context, v graph.Value) (quad.Quad, error) {
+	return graph.QuadOf(ctx, qs.QuadStore, v)
+}
+
+func (qs *expandIRIs) SizeContext(ctx context.Context) (int64, error) {
+	return graph.SizeOf(ctx, qs.QuadStore)
+}
+
+// OptimizeShape resolves lookups, so IRIs are expanded before the query is executed.
+// Other shapes are passed to the optimizer of the underlying store.
+func (qs *expandIRIs) OptimizeShape(s Shape) (Shape, bool) {
+	if l, ok := s.(Lookup); ok {
+		if ns := l.resolve(qs); ns != nil {
+			return ns, true
+		}
+		return Null{}, true
+	}
+	return OptimizeWith(qs.QuadStore, s)
+}
+
+// RewriteShape implements Rewriter by passing the shape to the underlying store.
+func (qs *expandIRIs) RewriteShape(s Shape) (Shape, bool) {
+	return RewriteWith(qs.QuadStore, s)
+}
+
 func (s Lookup) resolve(qs valueResolver) Shape {
 	// TODO: check if QS supports batch lookup
 	vals := make([]graph.Value, 0, len(s))
 	for _, v := range s {
-		if gv := qs.ValueOf(v); gv != nil {
+		gv := qs.ValueOf(v)
+		if gv != nil {
 			vals = append(vals, gv)
 		}
 	}
@@ -886,6 +1137,7 @@ func (s Intersect) Optimize(r Optimizer) (sout Shape, opt bool) {
 	}
 	var (
 		onlyAll = true   // contains only AllNodes shapes
+		hasAll  = false  // AllNodes was removed
 		fixed   []Fixed  // we will collect all Fixed, and will place it as a first iterator
 		tags    []string // if we find a Save inside, we will push it outside of Intersect
 		quads   Quads    // also, collect all quad filters into a single set
@@ -906,6 +1158,7 @@ func (s Intersect) Optimize(r Optimizer) (sout Shape, opt bool) {
 		switch c := c.(type) {
 		case AllNodes: // remove AllNodes - it's useless
 			remove(&i, true)
+			hasAll = true
 			// prevent resetting of onlyAll
 			continue
 		case Optional:
@@ -1026,6 +1279,10 @@ func (s Intersect) Optimize(r Optimizer) (sout Shape, opt bool) {
 		copy(ns[len(fixed):], s)
 		s = ns
 	}
+	if hasAll && onlyOptional(s) {
+		// optional shapes cannot produce results on their own
+		s = append(Intersect{AllNodes{}}, s...)
+	}
 	if len(s) == 0 {
 		return nil, true
 	} else if len(s) == 1 {
@@ -1035,6 +1292,16 @@ func (s Intersect) Optimize(r Optimizer) (sout Shape, opt bool) {
 	return s, opt
 }
 
+// onlyOptional checks if all shapes in the intersection are Optional.
+func onlyOptional(s Intersect) bool {
+	for _, c := range s {
+		if _, ok := c.(Optional); !ok {
+			return false
+		}
+	}
+	return len(s) != 0
+}
+
 // Union joins results of multiple queries together. It does not make results unique.
 type Union []Shape
 
@@ -1180,6 +1447,11 @@ func (s Unique) Optimize(r Optimizer) (Shape, bool) {
 	if IsNull(s.From) {
 		return nil, true
 	}
+	switch s.From.(type) {
+	case Unique, AllNodes:
+		// already unique
+		return s.From, true
+	}
 	if r != nil {
 		ns, nopt := r.OptimizeShape(s)
 		return ns, opt || nopt
@@ -1220,6 +1492,35 @@ func (s Save) Optimize(r Optimizer) (Shape, bool) {
 	return s, opt
 }
 
+// ProvenanceTags tags quads with an author and time of their provenance records. See graph.Provenance.
+type ProvenanceTags struct {
+	Quads  Shape
+	Author string // tag for an author of the quad
+	Time   string // tag for a time when the quad was added
+}
+
+func (s ProvenanceTags) BuildIterator(qs graph.QuadStore) graph.Iterator {
+	if IsNull(s.Quads) {
+		return iterator.NewNull()
+	}
+	return iterator.NewProvenance(qs, s.Quads.BuildIterator(qs), s.Author, s.Time)
+}
+func (s ProvenanceTags) Optimize(r Optimizer) (Shape, bool) {
+	if IsNull(s.Quads) {
+		return nil, true
+	}
+	var opt bool
+	s.Quads, opt = s.Quads.Optimize(r)
+	if s.Author == "" && s.Time == "" {
+		return s.Quads, true
+	}
+	if r != nil {
+		ns, nopt := r.OptimizeShape(s)
+		return ns, opt || nopt
+	}
+	return s, opt
+}
+
 // Optional makes a query execution optional. The query can only produce tagged results,
 // since it's value is not used to compute intersection.
 type Optional struct {
@@ -15,13 +15,19 @@
 package shape_test
 
 import (
+	"context"
 	"reflect"
+	"regexp"
+	"sort"
 	"testing"
 
 	"github.com/cayleygraph/cayley/graph"
 	"github.com/cayleygraph/cayley/graph/graphmock"
+	"github.com/cayleygraph/cayley/graph/iterator"
+	"github.com/cayleygraph/cayley/graph/memstore"
 	. "github.com/cayleygraph/cayley/graph/shape"
 	"github.com/cayleygraph/cayley/quad"
+	"github.com/cayleygraph/cayley/voc/rdf"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 )
@@ -271,6 +277,24 @@ var optimizeCases = []struct {
 			Tags: []string{"all"},
 		},
 	},
+	{ // keep all nodes if the intersect only has optional shapes
+		name: "keep all nodes for optional",
+		from: Intersect{
+			AllNodes{},
+			Optional{Save{From: Fixed{intVal(1)}, Tags: []string{"name"}}},
+		},
+		opt: true,
+		expect: Intersect{
+			AllNodes{},
+			Optional{Save{From: Fixed{intVal(1)}, Tags: []string{"name"}}},
+		},
+	},
+	{ // remove nested unique
+		name:   "remove nested unique",
+		from:   Unique{Unique{Fixed{intVal(1)}}},
+		opt:    true,
+		expect: Unique{Fixed{intVal(1)}},
+	},
 	{ // push fixed node from intersect into nodes.quads
 		name: "push fixed into nodes.quads",
 		from: Intersect{
@@ -322,6 +346,51 @@ func TestOptimize(t *testing.T) {
 	}
 }
 
+func TestExpandIRIs(t *testing.T) {
+	qs := ValLookup{quad.IRI(rdf.Type).Full(): intVal(1)}
+	s := Lookup{quad.IRI(rdf.Type)}
+
+	got, _ := Optimize(s, qs)
+	require.NotEqual(t, Fixed{intVal(1)}, got)
+
+	got, _ = Optimize(s, ExpandIRIs(qs))
+	require.Equal(t, Fixed{intVal(1)}, got)
+
+	// setting is local to the wrapper
+	got, _ = Optimize(s, qs)
+	require.NotEqual(t, Fixed{intVal(1)}, got)
+}
+
+var valueFilterCases = []struct {
+	f   interface{ Matches(quad.Value) bool }
+	v   quad.Value
+	exp bool
+}{
+	{f: StringMatch{Op: StringPrefix, Val: "ab"}, v: quad.String("abc"), exp: true},
+	{f: StringMatch{Op: StringPrefix, Val: "ab"}, v: quad.IRI("abc"), exp: false},
+	{f: StringMatch{Op: StringPrefix, Val: "ab", Refs: true}, v: quad.IRI("abc"), exp: true},
+	{f: StringMatch{Op: StringPrefix, Val: "AB"}, v: quad.String("abc"), exp: false},
+	{f: StringMatch{Op: StringPrefix, Val: "AB", Fold: true}, v: quad.String("abc"), exp: true},
+	{f: StringMatch{Op: StringSuffix, Val: "bc"}, v: quad.LangString{Value: "abc", Lang: "en"}, exp: true},
+	{f: StringMatch{Op: StringContains, Val: "B", Fold: true}, v: quad.TypedString{Value: "abc", Type: "t"}, exp: true},
+	{f: StringMatch{Op: StringEqual, Val: "ABC", Fold: true}, v: quad.String("abc"), exp: true},
+	{f: StringMatch{Op: StringEqual, Val: "1"}, v: quad.Int(1), exp: false},
+	{f: Length{Min: 1, Max: 3}, v: quad.String("абв"), exp: true},
+	{f: Length{Min: 1, Max: 2}, v: quad.String("abc"), exp: false},
+	{f: Length{Min: 3, Max: -1}, v: quad.String("abcd"), exp: true},
+	{f: Length{Min: 0, Max: -1}, v: quad.BNode("a"), exp: false},
+	{f: Modulo{Div: 3, Rem: 1}, v: quad.Int(7), exp: true},
+	{f: Modulo{Div: 3, Rem: 1}, v: quad.Int(6), exp: false},
+	{f: Modulo{Div: 0, Rem: 0}, v: quad.Int(6), exp: false},
+	{f: Modulo{Div: 2, Rem: 0}, v: quad.Float(4), exp: false},
+}
+
+func TestValueFilters(t *testing.T) {
+	for _, c := range valueFilterCases {
+		require.Equal(t, c.exp, c.f.Matches(c.v), "%#v on %#v", c.f, c.v)
+	}
+}
+
 func TestWalk(t *testing.T) {
 	var s Shape = NodesFrom{
 		Dir: quad.Subject,
@@ -352,3 +421,162 @@ func TestWalk(t *testing.T) {
 		"shape.QuadsAction",
 	}, types)
 }
+
+func TestMemoize(t *testing.T) {
+	out := NodesFrom{
+		Dir: quad.Object,
+		Quads: Quads{
+			{Dir: quad.Subject, Values: Fixed{intVal(1)}},
+			{Dir: quad.Predicate, Values: Fixed{intVal(2)}},
+		},
+	}
+	var s Shape = Union{
+		Save{Tags: []string{"a"}, From: out},
+		Save{Tags: []string{"b"}, From: out},
+		Save{Tags: []string{"c"}, From: Fixed{intVal(3)}},
+	}
+	got, opt := Optimize(s, ValLookup{})
+	require.True(t, opt)
+	u, ok := got.(Union)
+	require.True(t, ok, "%#v", got)
+	require.Len(t, u, 3)
+	m1, ok := u[0].(Save).From.(Memo)
+	require.True(t, ok, "%#v", u[0])
+	m2, ok := u[1].(Save).From.(Memo)
+	require.True(t, ok, "%#v", u[1])
+	require.Equal(t, m1, m2)
+	exp, _ := Optimize(out, ValLookup{})
+	require.Equal(t, exp, m1.Shape)
+	require.Equal(t, Fixed{intVal(3)}, u[2].(Save).From)
+
+	// nothing to share
+	got, _ = Optimize(Union{out, Fixed{intVal(3)}}, ValLookup{})
+	Walk(got, func(s Shape) bool {
+		_, ok := s.(Memo)
+		require.False(t, ok)
+		return true
+	})
+}
+
+// nodeIDs is a custom shape that can only be evaluated with a help of a registered optimizer.
+type nodeIDs []int
+
+func (s nodeIDs) BuildIterator(qs graph.QuadStore) graph.Iterator {
+	panic("not optimized")
+}
+func (s nodeIDs) Optimize(r Optimizer) (Shape, bool) {
+	if r != nil {
+		return r.OptimizeShape(s)
+	}
+	return s, false
+}
+
+func TestRegisterOptimizer(t *testing.T) {
+	const name = "test-node-ids"
+	RegisterOptimizer(name, func(qs graph.QuadStore, s Shape) (Shape, bool) {
+		ids, ok := s.(nodeIDs)
+		if _, ok2 := qs.(ValLookup); !ok || !ok2 {
+			return s, false
+		}
+		var out Fixed
+		for _, id := range ids {
+			out = append(out, intVal(id))
+		}
+		return out, true
+	})
+	defer UnregisterOptimizer(name)
+	require.Contains(t, Optimizers(), name)
+	func() {
+		defer func() {
+			require.NotNil(t, recover(), "expected a panic on duplicate name")
+		}()
+		RegisterOptimizer(name, func(qs graph.QuadStore, s Shape) (Shape, bool) {
+			return s, false
+		})
+	}()
+
+	s := Intersect{
+		nodeIDs{1, 2},
+		AllNodes{},
+	}
+	got, opt := Optimize(s, ValLookup{})
+	require.True(t, opt)
+	require.Equal(t, Fixed{intVal(1), intVal(2)}, got)
+
+	// rules see the underlying store of the wrapper
+	got, opt = Optimize(s, ExpandIRIs(ValLookup{}))
+	require.True(t, opt)
+	require.Equal(t, Fixed{intVal(1), intVal(2)}, got)
+
+	UnregisterOptimizer(name)
+	require.Len(t, Optimizers(), 0)
+	got, _ = Optimize(s, ValLookup{})
+	require.Equal(t, nodeIDs{1, 2}, got)
+}
+
+// viewStore replaces nodeIDs with a fixed set of nodes, like a materialized view.
+type viewStore struct {
+	ValLookup
+}
+
+func (qs viewStore) RewriteShape(s Shape) (Shape, bool) {
+	if _, ok := s.(nodeIDs); ok {
+		return Fixed{intVal(3)}, true
+	}
+	return s, false
+}
+
+func TestExpandIRIsRewrite(t *testing.T) {
+	got, opt := Optimize(nodeIDs{1}, ExpandIRIs(viewStore{}))
+	require.True(t, opt)
+	require.Equal(t, Fixed{intVal(3)}, got)
+}
+
+func TestNodesBuilder(t *testing.T) {
+	qs := memstore.New(
+		quad.MakeIRI("alice", "follows", "bob", ""),
+		quad.MakeIRI("alice", "follows", "charlie", ""),
+		quad.MakeIRI("bob", "follows", "charlie", ""),
+		quad.MakeIRI("charlie", "follows", "dani", ""),
+		quad.Make(quad.IRI("bob"), quad.IRI("age"), quad.Int(30), nil),
+		quad.Make(quad.IRI("charlie"), quad.IRI("age"), quad.Int(20), nil),
+	)
+	follows, age := quad.IRI("follows"), quad.IRI("age")
+
+	run := func(n Nodes) []string {
+		var out []string
+		err := n.Iterate(context.TODO(), qs).EachValue(qs, func(v quad.Value) {
+			out = append(out, quad.StringOf(v))
+		})
+		require.NoError(t, err)
+		sort.Strings(out)
+		return out
+	}
+
+	base := StartNodes(quad.IRI("alice")).Out(follows)
+	require.Equal(t, []string{"<bob>", "<charlie>"}, run(base))
+	// builder must not be modified by other calls
+	_ = base.Out(follows).Tag("x")
+	require.Equal(t, []string{"<bob>", "<charlie>"}, run(base))
+
+	require.Equal(t, []string{"<charlie>", "<dani>"}, run(base.Out(follows).Unique()))
+	require.Equal(t, []string{"<bob>"}, run(base.Has(age, quad.Int(30))))
+	require.Equal(t, []string{"<bob>"}, run(base.Except(StartNodes(quad.IRI("charlie")))))
+	require.Equal(t, []string{"<charlie>"}, run(base.And(StartNodes().Out(follows).Out(follows))))
+	require.Equal(t, []string{"<alice>", "<bob>", "<charlie>"}, run(StartNodes(quad.IRI("alice")).Or(base)))
+	require.Equal(t, []string{"<charlie>"}, run(base.Regex(regexp.MustCompile("^char"), true)))
+	require.Equal(t, []string{`"20"^^<schema:Integer>`}, run(base.Out(age).Compare(iterator.CompareLT, quad.Int(25))))
+	require.Len(t, run(StartNodes().Out(follows).Unique().Skip(1).Limit(2)), 2)
+	require.Equal(t, []string{`"2"^^<schema:Integer>`}, run(base.Count()))
+
+	var tags []map[string]graph.Value
+	err := base.Save(age, "age").Tag("person").Iterate(context.TODO(), qs).TagEach(func(m map[string]graph.Value) {
+		tags = append(tags, m)
+	})
+	require.NoError(t, err)
+	require.Len(t, tags, 2)
+	for _, m := range tags {
+		require.NotNil(t, m["age"])
+		require.NotNil(t, m["person"])
+	}
+}
@@ -0,0 +1,119 @@
+// Copyright 2017 The Cayley Authors. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package graph
+
+import (
+	"context"
+	"encoding/json"
+	"math/rand"
+	"sync"
+	"time"
+
+	"github.com/cayleygraph/cayley/clog"
+)
+
+// SlowLogOptions configures logging of slow query executions.
+type SlowLogOptions struct {
+	// Threshold is the minimal duration of an iteration to be reported.
+	// Zero value disables the slow query log.
+	Threshold time.Duration
+	// PlanRate is a fraction of slow queries (0 to 1) that will include
+	// a full optimized iterator tree with its stats in the log.
+	PlanRate float64
+}
+
+// SlowLog is a global configuration of the slow query log.
+//
+// Use SetSlowLog to change it while queries are running.
+var SlowLog SlowLogOptions
+
+var slowLogMu sync.RWMutex
+
+// SetSlowLog changes the configuration of the slow query log. It is safe to call it concurrently with queries.
+func SetSlowLog(opt SlowLogOptions) {
+	slowLogMu.Lock()
+	SlowLog = opt
+	slowLogMu.Unlock()
+}
+
+// CurrentSlowLog returns the current configuration of the slow query log.
+func CurrentSlowLog() SlowLogOptions {
+	slowLogMu.RLock()
+	defer slowLogMu.RUnlock()
+	return SlowLog
+}
+
+type queryInfoKey struct{}
+
+// QueryInfo describes a query that is being executed. It is attached to the
+// context to make query text available to the slow query log.
+type QueryInfo struct {
+	Lang  string
+	Query string
+}
+
+// WithQueryInfo attaches query information to the context.
+func WithQueryInfo(ctx context.Context, lang, qu string) context.Context {
+	return context.WithValue(ctx, queryInfoKey{}, QueryInfo{Lang: lang, Query: qu})
+}
+
+// QueryInfoFrom returns query information attached to the context, if any.
+func QueryInfoFrom(ctx context.Context) (QueryInfo, bool) {
+	qi, ok := ctx.Value(queryInfoKey{}).(QueryInfo)
+	return qi, ok
+}
+
+// ScannedPrimitives returns an estimate of how many primitives were touched
+// by the iterator tree. Only leaf iterators are counted.
+func ScannedPrimitives(st StatsContainer) int64 {
+	if len(st.SubIts) == 0 {
+		return st.Next + st.Contains
+	}
+	var n int64
+	for _, sub := range st.SubIts {
+		n += ScannedPrimitives(sub)
+	}
+	return n
+}
+
+// logSlowQuery writes an entry to the slow query log if iteration took longer than configured threshold.
+func logSlowQuery(ctx context.Context, it Iterator, dt time.Duration) {
+	opt := CurrentSlowLog()
+	if opt.Threshold <= 0 || dt < opt.Threshold {
+		return
+	}
+	st := DumpStats(it)
+	scanned := ScannedPrimitives(st)
+	qi, _ := QueryInfoFrom(ctx)
+	clog.Warning(ctx, "slow query",
+		clog.F("duration", dt), clog.F("scanned", scanned),
+		clog.F("lang", qi.Lang), clog.F("query", qi.Query),
+	)
+	if opt.PlanRate <= 0 || (opt.PlanRate < 1 && rand.Float64() >= opt.PlanRate) {
+		return
+	}
+	plan := struct {
+		Iterator Description
+		Stats    StatsContainer
+	}{
+		Iterator: DescribeIterator(it),
+		Stats:    st,
+	}
+	if b, err := json.Marshal(plan); err != nil {
+		clog.Error(ctx, "failed to format query plan", clog.F("error", err))
+	} else {
+		clog.Warning(ctx, "slow query plan", clog.F("plan", string(b)))
+	}
+}
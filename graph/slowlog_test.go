@@ -0,0 +1,19 @@
+package graph
+
+import "testing"
+
+func TestScannedPrimitives(t *testing.T) {
+	st := StatsContainer{
+		Type:          And,
+		IteratorStats: IteratorStats{Next: 100, Contains: 5},
+		SubIts: []StatsContainer{
+			{Type: All, IteratorStats: IteratorStats{Next: 10}},
+			{Type: HasA, SubIts: []StatsContainer{
+				{Type: Fixed, IteratorStats: IteratorStats{Next: 2, Contains: 3}},
+			}},
+		},
+	}
+	if n := ScannedPrimitives(st); n != 15 {
+		t.Errorf("unexpected number of scanned primitives: %d", n)
+	}
+}
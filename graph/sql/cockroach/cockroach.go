@@ -2,11 +2,15 @@ package cockroach
 
 import (
 	"database/sql"
+	"strconv"
+	"strings"
 
+	"github.com/cayleygraph/cayley/clog"
 	"github.com/cayleygraph/cayley/graph"
 	"github.com/cayleygraph/cayley/graph/log"
 	csql "github.com/cayleygraph/cayley/graph/sql"
 	"github.com/cayleygraph/cayley/graph/sql/postgres"
+	"github.com/cayleygraph/cayley/quad"
 	"github.com/lib/pq"
 )
 
@@ -30,18 +34,174 @@ func init() {
 		QueryDialect:  postgres.QueryDialect,
 		NoForeignKeys: true,
 		Error:         postgres.ConvError,
-		//Estimated: func(table string) string{
-		//	return "SELECT reltuples::BIGINT AS estimate FROM pg_class WHERE relname='"+table+"';"
-		//},
-		RunTx:               runTxCockroach,
+		Estimated: func(table string) string {
+			// historical reads do not conflict with concurrent writes
+			return "SELECT COUNT(*) FROM " + table + " AS OF SYSTEM TIME '" + estimateStaleness + "';"
+		},
+		RunTx:               RunTx,
 		TxRetry:             retryTxCockroach,
 		NoSchemaChangesInTx: true,
 	})
 }
 
-func runTxCockroach(tx *sql.Tx, nodes []graphlog.NodeUpdate, quads []graphlog.QuadUpdate, opts graph.IgnoreOpts) error {
-	// FIXME: on conflict for SPOL; blocked by CockroachDB not supporting empty ON CONFLICT statements
-	return postgres.RunTx(tx, nodes, quads, opts, `(subject_hash, predicate_hash, object_hash)`)
+const (
+	// estimateStaleness is how old the data used for size estimates can be.
+	estimateStaleness = "-10s"
+	// maxRetries is the number of times a transaction is restarted after a serialization failure.
+	maxRetries = 10
+	// upsertBatch is the maximal number of rows written by a single statement.
+	upsertBatch = 100
+)
+
+func convInsertError(err error) error {
+	if pe, ok := err.(*pq.Error); ok && pe.Code == "23505" {
+		return graph.ErrQuadExists
+	}
+	return err
+}
+
+// RunTx adds nodes and quads in a way that suits CockroachDB transaction model.
+//
+// Since there are no foreign keys, quads are inserted first, and only quads that were actually
+// inserted are accounted in node reference counters. Nodes are then written with a multi-row
+// UPSERT based on counters read in the same transaction. A concurrent update of the same nodes
+// causes a serialization failure, which is resolved by retrying the transaction.
+func RunTx(tx *sql.Tx, nodes []graphlog.NodeUpdate, quads []graphlog.QuadUpdate, opts graph.IgnoreOpts) error {
+	refs := make(map[graph.ValueHash]int, len(nodes))
+	for _, n := range nodes {
+		if n.RefInc < 0 {
+			panic("unexpected node update")
+		}
+		refs[n.Hash] = n.RefInc
+	}
+	if len(quads) != 0 {
+		query := `INSERT INTO quads(subject_hash, predicate_hash, object_hash, label_hash, ts) VALUES ($1, $2, $3, $4, now())`
+		if opts.IgnoreDup {
+			query += ` ON CONFLICT DO NOTHING`
+		}
+		insertQuad, err := tx.Prepare(query + `;`)
+		if err != nil {
+			return err
+		}
+		defer insertQuad.Close()
+		for _, d := range quads {
+			if d.Del {
+				panic("unexpected quad delete")
+			}
+			dirs := make([]interface{}, 0, len(quad.Directions))
+			for _, h := range d.Quad.Dirs() {
+				dirs = append(dirs, csql.NodeHash{h}.SQLValue())
+			}
+			res, err := insertQuad.Exec(dirs...)
+			if err = convInsertError(err); err != nil {
+				clog.Errorf("couldn't exec INSERT statement: %v", err)
+				return err
+			}
+			if n, err := res.RowsAffected(); err != nil {
+				return err
+			} else if n == 0 {
+				// duplicate quad was skipped - it adds no references
+				for _, h := range d.Quad.Dirs() {
+					if h.Valid() {
+						refs[h]--
+					}
+				}
+			}
+		}
+	}
+	cur, err := nodeRefs(tx, nodes)
+	if err != nil {
+		return err
+	}
+	// group nodes by value type, since each type sets a different set of columns
+	var (
+		types []csql.ValueType
+		rows  = make(map[csql.ValueType][][]interface{})
+	)
+	for _, n := range nodes {
+		old, exists := cur[n.Hash]
+		inc := refs[n.Hash]
+		if inc == 0 || (!exists && inc < 0) {
+			continue
+		}
+		nodeKey, values, err := csql.NodeValues(csql.NodeHash{n.Hash}, n.Val)
+		if err != nil {
+			return err
+		}
+		if _, ok := rows[nodeKey]; !ok {
+			types = append(types, nodeKey)
+		}
+		rows[nodeKey] = append(rows[nodeKey], append([]interface{}{old + int64(inc)}, values...))
+	}
+	for _, typ := range types {
+		cols := append([]string{"refs", "hash"}, typ.Columns()...)
+		for vals := rows[typ]; len(vals) != 0; {
+			batch := vals
+			if len(batch) > upsertBatch {
+				batch = batch[:upsertBatch]
+			}
+			vals = vals[len(batch):]
+			if err := upsertNodes(tx, cols, batch); err != nil {
+				clog.Errorf("couldn't exec UPSERT statement: %v", err)
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// nodeRefs returns current reference counters for existing nodes.
+func nodeRefs(tx *sql.Tx, nodes []graphlog.NodeUpdate) (map[graph.ValueHash]int64, error) {
+	out := make(map[graph.ValueHash]int64, len(nodes))
+	for len(nodes) != 0 {
+		batch := nodes
+		if len(batch) > upsertBatch {
+			batch = batch[:upsertBatch]
+		}
+		nodes = nodes[len(batch):]
+		ph := make([]string, len(batch))
+		args := make([]interface{}, len(batch))
+		for i, n := range batch {
+			ph[i] = "$" + strconv.Itoa(i+1)
+			args[i] = csql.NodeHash{n.Hash}.SQLValue()
+		}
+		rows, err := tx.Query(`SELECT hash, refs FROM nodes WHERE hash IN (`+strings.Join(ph, ", ")+`);`, args...)
+		if err != nil {
+			return nil, err
+		}
+		for rows.Next() {
+			var (
+				h    csql.NodeHash
+				refs int64
+			)
+			if err = rows.Scan(&h, &refs); err != nil {
+				rows.Close()
+				return nil, err
+			}
+			out[h.ValueHash] = refs
+		}
+		err = rows.Err()
+		rows.Close()
+		if err != nil {
+			return nil, err
+		}
+	}
+	return out, nil
+}
+
+func upsertNodes(tx *sql.Tx, cols []string, rows [][]interface{}) error {
+	args := make([]interface{}, 0, len(rows)*len(cols))
+	tuples := make([]string, 0, len(rows))
+	ph := make([]string, len(cols))
+	for _, r := range rows {
+		for i := range ph {
+			ph[i] = "$" + strconv.Itoa(len(args)+i+1)
+		}
+		tuples = append(tuples, "("+strings.Join(ph, ", ")+")")
+		args = append(args, r...)
+	}
+	_, err := tx.Exec(`UPSERT INTO nodes(`+strings.Join(cols, ", ")+`) VALUES `+strings.Join(tuples, ", ")+`;`, args...)
+	return err
 }
 
 // AmbiguousCommitError represents an error that left a transaction in an
@@ -50,6 +210,15 @@ type AmbiguousCommitError struct {
 	error
 }
 
+// isRetryable checks if the transaction can be restarted after an error.
+// We look for either the standard PG errcode SerializationFailureError:40001 or the Cockroach extension
+// errcode RetriableError:CR000. The Cockroach extension has been removed server-side, but support
+// for it has been left here for now to maintain backwards compatibility.
+func isRetryable(err error) bool {
+	pqErr, ok := err.(*pq.Error)
+	return ok && (pqErr.Code == "CR000" || pqErr.Code == "40001")
+}
+
 // retryTxCockroach runs the transaction and will retry in case of a retryable error.
 // https://www.cockroachlabs.com/docs/transactions.html#client-side-transaction-retries
 func retryTxCockroach(tx *sql.Tx, stmts func() error) error {
@@ -59,7 +228,7 @@ func retryTxCockroach(tx *sql.Tx, stmts func() error) error {
 		return err
 	}
 
-	for {
+	for i := 0; ; i++ {
 		released := false
 
 		err := stmts()
@@ -72,17 +241,14 @@ func retryTxCockroach(tx *sql.Tx, stmts func() error) error {
 				return nil
 			}
 		}
-		// We got an error; let's see if it's a retryable one and, if so, restart. We look
-		// for either the standard PG errcode SerializationFailureError:40001 or the Cockroach extension
-		// errcode RetriableError:CR000. The Cockroach extension has been removed server-side, but support
-		// for it has been left here for now to maintain backwards compatibility.
-		pqErr, ok := err.(*pq.Error)
-		if retryable := ok && (pqErr.Code == "CR000" || pqErr.Code == "40001"); !retryable {
+		// We got an error; let's see if it's a retryable one and, if so, restart.
+		if !isRetryable(err) || i >= maxRetries {
 			if released {
 				err = &AmbiguousCommitError{err}
 			}
 			return err
 		}
+		clog.Warningf("cockroach: restarting transaction (attempt %d of %d): %v", i+1, maxRetries, err)
 		if _, err = tx.Exec("ROLLBACK TO SAVEPOINT cockroach_restart"); err != nil {
 			return err
 		}
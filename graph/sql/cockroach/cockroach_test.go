@@ -15,7 +15,7 @@ import (
 func makeCockroach(t testing.TB) (string, graph.Options, func()) {
 	var conf dock.Config
 
-	conf.Image = "cockroachdb/cockroach:v1.1.2"
+	conf.Image = "cockroachdb/cockroach:v2.1.6"
 	conf.Cmd = []string{"start", "--insecure"}
 
 	addr, closer := dock.RunAndWait(t, conf, func(addr string) bool {
@@ -50,3 +50,10 @@ func TestCockroach(t *testing.T) {
 		SkipIntHorizon: true,
 	})
 }
+
+func BenchmarkCockroach(b *testing.B) {
+	sqltest.BenchmarkAll(b, Type, makeCockroach, &sqltest.Config{
+		TimeRound:      true,
+		SkipIntHorizon: true,
+	})
+}
@@ -3,6 +3,7 @@ package sql
 import (
 	"database/sql"
 	"fmt"
+	"strings"
 
 	"github.com/cayleygraph/cayley/graph"
 	"github.com/cayleygraph/cayley/graph/log"
@@ -24,6 +25,9 @@ type Registration struct {
 	HashType           string // type for hash fields
 	BytesType          string // type for binary fields
 	TimeType           string // type for datetime fields
+	TimestampType      string // type for quad timestamps
+	TextType           string // type for text fields
+	BoolType           string // type for boolean fields
 	HorizonType        string // type for horizon counter
 	NodesTableExtra    string // extra SQL to append to nodes table definition
 	ConditionalIndexes bool   // database supports conditional indexes
@@ -36,8 +40,18 @@ type Registration struct {
 	Error               func(error) error         // error conversion function
 	Estimated           func(table string) string // query that string that returns an estimated number of rows in table
 	RunTx               func(tx *sql.Tx, nodes []graphlog.NodeUpdate, quads []graphlog.QuadUpdate, opts graph.IgnoreOpts) error
+	BulkTx              func(tx *sql.Tx, nodes []graphlog.NodeUpdate, quads []graphlog.QuadUpdate, opts graph.IgnoreOpts) error // optional, faster version of RunTx for bulk loads; only adds nodes and quads
 	TxRetry             func(tx *sql.Tx, stmts func() error) error
 	NoSchemaChangesInTx bool
+
+	// TextSearch returns a condition on nodes table that matches a full-text query, and an optional expression
+	// to order results by relevance (descending). Every placeholder is bound to the query. Optional.
+	TextSearch func(b *Builder) (cond, order string)
+	TextIndex  string // statement that creates a full-text index on nodes table; optional
+
+	// VectorDistance returns an expression for a distance between a vector stored in value_string
+	// and a vector passed as a placeholder. Optional.
+	VectorDistance func(placeholder string) string
 }
 
 func (r Registration) nodesTable() string {
@@ -53,6 +67,14 @@ func (r Registration) nodesTable() string {
 	if ttyp == "" {
 		ttyp = "timestamp with time zone"
 	}
+	styp := r.TextType
+	if styp == "" {
+		styp = "TEXT"
+	}
+	bltyp := r.BoolType
+	if bltyp == "" {
+		bltyp = "BOOLEAN"
+	}
 	end := "\n);"
 	if r.NodesTableExtra != "" {
 		end = ",\n" + r.NodesTableExtra + end
@@ -61,13 +83,13 @@ func (r Registration) nodesTable() string {
 	hash ` + htyp + ` PRIMARY KEY,
 	refs INT NOT NULL,
 	value ` + btyp + `,
-	value_string TEXT,
-	datatype TEXT,
-	language TEXT,
-	iri BOOLEAN,
-	bnode BOOLEAN,
+	value_string ` + styp + `,
+	datatype ` + styp + `,
+	language ` + styp + `,
+	iri ` + bltyp + `,
+	bnode ` + bltyp + `,
 	value_int BIGINT,
-	value_bool BOOLEAN,
+	value_bool ` + bltyp + `,
 	value_float double precision,
 	value_time ` + ttyp +
 		end
@@ -82,17 +104,42 @@ func (r Registration) quadsTable() string {
 	if hztyp == "" {
 		hztyp = "SERIAL"
 	}
+	tstyp := r.TimestampType
+	if tstyp == "" {
+		tstyp = "timestamp"
+	}
 	return `CREATE TABLE quads (
 	horizon ` + hztyp + ` PRIMARY KEY,
 	subject_hash ` + htyp + ` NOT NULL,
 	predicate_hash ` + htyp + ` NOT NULL,
 	object_hash ` + htyp + ` NOT NULL,
 	label_hash ` + htyp + `,
-	ts timestamp
+	ts ` + tstyp + `
 );`
 }
 
-func (r Registration) quadIndexes(options graph.Options) []string {
+// uniqueTables returns statements that create tables for unique predicates (see graph.OptUniquePredicates).
+func (r Registration) uniqueTables() []string {
+	htyp := r.HashType
+	if htyp == "" {
+		htyp = "BYTEA"
+	}
+	return []string{
+		`CREATE TABLE unique_predicates (
+	predicate_hash ` + htyp + ` PRIMARY KEY
+);`,
+		`CREATE TABLE unique_values (
+	predicate_hash ` + htyp + ` NOT NULL,
+	object_hash ` + htyp + ` NOT NULL,
+	subject_hash ` + htyp + ` NOT NULL,
+	PRIMARY KEY (predicate_hash, object_hash)
+);`,
+	}
+}
+
+// quadIndexes returns statements that create quad indexes.
+// Unique indexes are always created, while the set of lookup indexes can be changed with graph.OptQuadIndexes.
+func (r Registration) quadIndexes(options graph.Options) ([]string, error) {
 	indexes := make([]string, 0, 10)
 	if r.ConditionalIndexes {
 		indexes = append(indexes,
@@ -113,19 +160,30 @@ func (r Registration) quadIndexes(options graph.Options) []string {
 			`ALTER TABLE quads ADD CONSTRAINT label_hash_fk FOREIGN KEY (label_hash) REFERENCES nodes (hash);`,
 		)
 	}
+	dirs, err := options.QuadIndexesKey(graph.OptQuadIndexes, nil)
+	if err != nil {
+		return nil, err
+	}
+	with := ""
 	if r.FillFactor {
 		factor, _ := options.IntKey("db_fill_factor", 50)
+		with = fmt.Sprintf(` WITH (FILLFACTOR = %d)`, factor)
+	}
+	if dirs == nil {
 		indexes = append(indexes,
-			fmt.Sprintf(`CREATE INDEX spo_index ON quads (subject_hash) WITH (FILLFACTOR = %d);`, factor),
-			fmt.Sprintf(`CREATE INDEX pos_index ON quads (predicate_hash) WITH (FILLFACTOR = %d);`, factor),
-			fmt.Sprintf(`CREATE INDEX osp_index ON quads (object_hash) WITH (FILLFACTOR = %d);`, factor),
-		)
-	} else {
-		indexes = append(indexes,
-			`CREATE INDEX spo_index ON quads (subject_hash);`,
-			`CREATE INDEX pos_index ON quads (predicate_hash);`,
-			`CREATE INDEX osp_index ON quads (object_hash);`,
+			`CREATE INDEX spo_index ON quads (subject_hash)`+with+`;`,
+			`CREATE INDEX pos_index ON quads (predicate_hash)`+with+`;`,
+			`CREATE INDEX osp_index ON quads (object_hash)`+with+`;`,
 		)
+		return indexes, nil
+	}
+	for _, d := range dirs {
+		cols := make([]string, 0, len(d))
+		for _, dir := range d {
+			cols = append(cols, dirField(dir))
+		}
+		indexes = append(indexes, fmt.Sprintf(`CREATE INDEX idx_%s ON quads (%s)%s;`,
+			graph.FormatQuadIndex(d), strings.Join(cols, ", "), with))
 	}
-	return indexes
+	return indexes, nil
 }
@@ -0,0 +1,41 @@
+package sql
+
+import (
+	"testing"
+
+	"github.com/cayleygraph/cayley/graph"
+	"github.com/stretchr/testify/require"
+)
+
+func TestQuadIndexes(t *testing.T) {
+	r := Registration{NoForeignKeys: true}
+
+	indexes, err := r.quadIndexes(nil)
+	require.NoError(t, err)
+	require.Equal(t, []string{
+		`CREATE UNIQUE INDEX spo_unique ON quads (subject_hash, predicate_hash, object_hash);`,
+		`CREATE UNIQUE INDEX spol_unique ON quads (subject_hash, predicate_hash, object_hash, label_hash);`,
+		`CREATE INDEX spo_index ON quads (subject_hash);`,
+		`CREATE INDEX pos_index ON quads (predicate_hash);`,
+		`CREATE INDEX osp_index ON quads (object_hash);`,
+	}, indexes)
+
+	indexes, err = r.quadIndexes(graph.Options{graph.OptQuadIndexes: []interface{}{"s", "pso"}})
+	require.NoError(t, err)
+	require.Equal(t, []string{
+		`CREATE UNIQUE INDEX spo_unique ON quads (subject_hash, predicate_hash, object_hash);`,
+		`CREATE UNIQUE INDEX spol_unique ON quads (subject_hash, predicate_hash, object_hash, label_hash);`,
+		`CREATE INDEX idx_s ON quads (subject_hash);`,
+		`CREATE INDEX idx_pso ON quads (predicate_hash, subject_hash, object_hash);`,
+	}, indexes)
+
+	r.FillFactor = true
+	indexes, err = r.quadIndexes(graph.Options{graph.OptQuadIndexes: "c", "db_fill_factor": 70})
+	require.NoError(t, err)
+	require.Equal(t, `CREATE INDEX idx_c ON quads (label_hash) WITH (FILLFACTOR = 70);`, indexes[len(indexes)-1])
+
+	_, err = r.quadIndexes(graph.Options{graph.OptQuadIndexes: []string{"ss"}})
+	require.Error(t, err)
+	_, err = r.quadIndexes(graph.Options{graph.OptQuadIndexes: []string{"x"}})
+	require.Error(t, err)
+}
@@ -52,7 +52,7 @@ func (qs *QuadStore) Query(ctx context.Context, s Shape) (*sql.Rows, error) {
 	return rows, nil
 }
 
-var _ graph.Iterator = (*Iterator)(nil)
+var _ graph.BatchIterator = (*Iterator)(nil)
 
 func (qs *QuadStore) NewIterator(s Select) *Iterator {
 	return &Iterator{
@@ -163,6 +163,9 @@ func (it *Iterator) Next(ctx context.Context) bool {
 	if it.err != nil {
 		return false
 	}
+	if !graph.ScanPrimitive(ctx) {
+		return false
+	}
 	if it.cursor == nil {
 		it.cursor, it.err = it.qs.Query(ctx, it.query)
 	}
@@ -177,11 +180,23 @@ func (it *Iterator) Next(ctx context.Context) bool {
 	return it.scanValue(it.cursor)
 }
 
+func (it *Iterator) NextBatch(ctx context.Context, dst []graph.Value) int {
+	n := 0
+	for n < len(dst) && it.Next(ctx) {
+		dst[n] = it.res
+		n++
+	}
+	return n
+}
+
 func (it *Iterator) NextPath(ctx context.Context) bool {
 	return false
 }
 
 func (it *Iterator) Contains(ctx context.Context, v graph.Value) bool {
+	if !graph.ScanPrimitive(ctx) {
+		return false
+	}
 	it.ensureColumns()
 	sel := it.query
 	sel.Where = append([]Where{}, sel.Where...)
@@ -0,0 +1,172 @@
+package mssql
+
+import (
+	"database/sql"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/cayleygraph/cayley/clog"
+	"github.com/cayleygraph/cayley/graph"
+	"github.com/cayleygraph/cayley/graph/log"
+	csql "github.com/cayleygraph/cayley/graph/sql"
+	"github.com/cayleygraph/cayley/quad"
+	mssql "github.com/denisenkom/go-mssqldb"
+)
+
+const Type = "mssql"
+
+var QueryDialect = csql.QueryDialect{
+	FieldQuote: func(name string) string {
+		return "[" + strings.Replace(name, "]", "]]", -1) + "]"
+	},
+	Placeholder: func(n int) string {
+		return "@p" + strconv.Itoa(n)
+	},
+	Paging: func(limit, offset int64) string {
+		// OFFSET ... FETCH requires ORDER BY; order is not important for us
+		s := fmt.Sprintf("ORDER BY (SELECT NULL) OFFSET %d ROWS", offset)
+		if limit > 0 {
+			s += fmt.Sprintf(" FETCH NEXT %d ROWS ONLY", limit)
+		}
+		return s
+	},
+	TrueValue: "1",
+}
+
+func init() {
+	csql.Register(Type, csql.Registration{
+		Driver:             "sqlserver",
+		HashType:           fmt.Sprintf(`BINARY(%d)`, quad.HashSize),
+		BytesType:          `VARBINARY(MAX)`,
+		HorizonType:        `BIGINT IDENTITY(1,1)`,
+		TimeType:           `DATETIMEOFFSET`,
+		TimestampType:      `DATETIME2`,
+		TextType:           `NVARCHAR(MAX)`,
+		BoolType:           `BIT`,
+		QueryDialect:       QueryDialect,
+		ConditionalIndexes: true,
+		FillFactor:         true,
+		Error:              ConvError,
+		Estimated: func(table string) string {
+			return "SELECT SUM(row_count) FROM sys.dm_db_partition_stats WHERE object_id = OBJECT_ID('" + table + "') AND index_id < 2;"
+		},
+		RunTx: RunTx,
+	})
+}
+
+func ConvError(err error) error {
+	e, ok := err.(mssql.Error)
+	if !ok {
+		return err
+	}
+	switch e.Number {
+	case 2714: // there is already an object with this name
+		return graph.ErrDatabaseExists
+	}
+	return err
+}
+
+func convInsertError(err error) error {
+	if e, ok := err.(mssql.Error); ok {
+		switch e.Number {
+		case 2601, 2627: // duplicate key in unique index or constraint
+			return graph.ErrQuadExists
+		}
+	}
+	return err
+}
+
+func placeholders(n int) []string {
+	ph := make([]string, n)
+	for i := range ph {
+		ph[i] = QueryDialect.Placeholder(i + 1)
+	}
+	return ph
+}
+
+// hashValue converts hashes to SQL values. Unlike NodeHash.SQLValue, it returns typed NULL,
+// since SQL Server does not allow implicit conversion of untyped NULL parameters to binary.
+func hashValue(h graph.ValueHash) interface{} {
+	if v := (csql.NodeHash{h}).SQLValue(); v != nil {
+		return v
+	}
+	return []byte(nil)
+}
+
+func RunTx(tx *sql.Tx, nodes []graphlog.NodeUpdate, quads []graphlog.QuadUpdate, opts graph.IgnoreOpts) error {
+	// update node ref counts and insert nodes
+	insertValue := make(map[csql.ValueType]*sql.Stmt)
+	defer func() {
+		for _, s := range insertValue {
+			s.Close()
+		}
+	}()
+	for _, n := range nodes {
+		if n.RefInc < 0 {
+			panic("unexpected node update")
+		}
+		nodeKey, values, err := csql.NodeValues(csql.NodeHash{n.Hash}, n.Val)
+		if err != nil {
+			return err
+		}
+		values = append([]interface{}{n.RefInc}, values...)
+		stmt, ok := insertValue[nodeKey]
+		if !ok {
+			cols := append([]string{"refs", "hash"}, nodeKey.Columns()...)
+			src := make([]string, len(cols))
+			for i, c := range cols {
+				src[i] = "s." + c
+			}
+			stmt, err = tx.Prepare(`MERGE INTO nodes WITH (HOLDLOCK) AS t
+USING (VALUES (` + strings.Join(placeholders(len(values)), ", ") + `)) AS s (` + strings.Join(cols, ", ") + `)
+ON t.hash = s.hash
+WHEN MATCHED THEN UPDATE SET refs = t.refs + s.refs
+WHEN NOT MATCHED THEN INSERT (` + strings.Join(cols, ", ") + `) VALUES (` + strings.Join(src, ", ") + `);`)
+			if err != nil {
+				return err
+			}
+			insertValue[nodeKey] = stmt
+		}
+		_, err = stmt.Exec(values...)
+		if err != nil {
+			clog.Errorf("couldn't exec MERGE statement: %v", err)
+			return err
+		}
+	}
+
+	// now we can deal with quads
+	query := `INSERT INTO quads(subject_hash, predicate_hash, object_hash, label_hash, ts) VALUES (@p1, @p2, @p3, @p4, SYSDATETIME());`
+	if opts.IgnoreDup {
+		query = `INSERT INTO quads(subject_hash, predicate_hash, object_hash, label_hash, ts)
+SELECT @p1, @p2, @p3, @p4, SYSDATETIME()
+WHERE NOT EXISTS (SELECT 1 FROM quads WITH (UPDLOCK, HOLDLOCK)
+	WHERE subject_hash = @p1 AND predicate_hash = @p2 AND object_hash = @p3
+	AND (label_hash = @p4 OR (label_hash IS NULL AND @p4 IS NULL)));`
+	}
+	var insertQuad *sql.Stmt
+	for _, d := range quads {
+		if d.Del {
+			panic("unexpected quad delete")
+		}
+		dirs := make([]interface{}, 0, len(quad.Directions))
+		for _, h := range d.Quad.Dirs() {
+			dirs = append(dirs, hashValue(h))
+		}
+		if insertQuad == nil {
+			var err error
+			insertQuad, err = tx.Prepare(query)
+			if err != nil {
+				return err
+			}
+			defer insertQuad.Close()
+		}
+		_, err := insertQuad.Exec(dirs...)
+		err = convInsertError(err)
+		if err != nil {
+			clog.Errorf("couldn't exec INSERT statement: %v", err)
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,48 @@
+// +build docker
+
+package mssql
+
+import (
+	"database/sql"
+	"testing"
+
+	"github.com/cayleygraph/cayley/graph"
+	"github.com/cayleygraph/cayley/graph/sql/sqltest"
+	"github.com/cayleygraph/cayley/internal/dock"
+)
+
+func makeMssql(t testing.TB) (string, graph.Options, func()) {
+	var conf dock.Config
+
+	conf.Image = "microsoft/mssql-server-linux:2017-latest"
+	conf.Tty = true
+	conf.Env = []string{
+		`ACCEPT_EULA=Y`,
+		`SA_PASSWORD=Cayley-Passw0rd`,
+	}
+
+	addr, closer := dock.RunAndWait(t, conf, func(addr string) bool {
+		conn, err := sql.Open("sqlserver", `sqlserver://sa:Cayley-Passw0rd@`+addr+`:1433`)
+		if err != nil {
+			return false
+		}
+		defer conn.Close()
+		return conn.Ping() == nil
+	})
+	addr = `sqlserver://sa:Cayley-Passw0rd@` + addr + `:1433`
+	return addr, nil, func() {
+		closer()
+	}
+}
+
+func TestMssql(t *testing.T) {
+	sqltest.TestAll(t, Type, makeMssql, &sqltest.Config{
+		TimeRound: true,
+	})
+}
+
+func BenchmarkMssql(b *testing.B) {
+	sqltest.BenchmarkAll(b, Type, makeMssql, &sqltest.Config{
+		TimeRound: true,
+	})
+}
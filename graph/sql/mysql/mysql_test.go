@@ -36,3 +36,7 @@ func TestMysql(t *testing.T) {
 func TestMariaDB(t *testing.T) {
 	sqltest.TestAll(t, Type, makeMysqlVersion("mariadb:10"), nil)
 }
+
+func BenchmarkMysql(b *testing.B) {
+	sqltest.BenchmarkAll(b, Type, makeMysqlVersion("mysql:5.7"), nil)
+}
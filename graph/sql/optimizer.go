@@ -240,11 +240,43 @@ func (opt *Optimizer) optimizeFilters(s shape.Filter) (shape.Shape, bool) {
 			return s, false
 		}
 		return *sel, true
+	case shape.StringMatch:
+		sel := selectLike(f)
+		if sel == nil {
+			return s, false
+		}
+		// LIKE may be case-insensitive in some databases, thus keep the filter to check exact matches
+		return shape.Filter{From: *sel, Filters: s.Filters}, true
 	default:
 		return s, false
 	}
 }
 
+// selectLike returns a query for all nodes with a value that may match the string filter.
+// It returns nil if the filter cannot be expressed as LIKE pattern.
+func selectLike(f shape.StringMatch) *Select {
+	if f.Fold || f.Val == "" || strings.ContainsAny(f.Val, `%_\`) {
+		return nil
+	}
+	var pattern string
+	switch f.Op {
+	case shape.StringPrefix:
+		pattern = f.Val + "%"
+	case shape.StringSuffix:
+		pattern = "%" + f.Val
+	case shape.StringContains:
+		pattern = "%" + f.Val + "%"
+	default:
+		return nil
+	}
+	sel := Nodes([]Where{
+		{Field: "value_string", Op: OpLike, Value: Placeholder{}},
+	}, []Value{
+		StringVal(pattern),
+	})
+	return &sel
+}
+
 func (opt *Optimizer) optimizeQuads(s shape.Quads) (shape.Shape, bool) {
 	t1 := opt.nextTable()
 	sel := AllQuads(t1)
@@ -263,8 +295,16 @@ func (opt *Optimizer) optimizeQuads(s shape.Quads) (shape.Shape, bool) {
 			wr.Value = sel.AppendParam(fv[0].(Value))
 			sel.Where = append(sel.Where, wr)
 		case Select:
-			if len(fv.Fields) == 1 {
-				// simple case - just add subquery to FROM
+			if opt.inlineNodes(&sel, t1, f.Dir, fv) {
+				// no need to join nodes table
+				continue
+			}
+			if fv.onlyAsSubquery() {
+				if len(fv.Fields) != 1 {
+					// TODO: generic subquery: pass all tags to main query, set WHERE on specific direction, drop __* tags
+					return s, false
+				}
+				// add subquery to FROM, it cannot be merged with the main query
 				tbl := opt.nextTable()
 				sel.From = append(sel.From, Subquery{
 					Query: fv,
@@ -276,10 +316,8 @@ func (opt *Optimizer) optimizeQuads(s shape.Quads) (shape.Shape, bool) {
 				}
 				sel.Where = append(sel.Where, wr)
 				continue
-			} else if fv.onlyAsSubquery() {
-				// TODO: generic subquery: pass all tags to main query, set WHERE on specific direction, drop __* tags
-				return s, false
 			}
+			fv = fv.Clone()
 			opt.ensureAliases(&fv)
 			// add all tables from subquery to the main one, but skip __node field - we should add it to WHERE
 			var head Field
@@ -316,6 +354,57 @@ func (opt *Optimizer) optimizeQuads(s shape.Quads) (shape.Shape, bool) {
 	return sel, true
 }
 
+// inlineNodes checks if a subquery only selects node hashes without filtering them by value,
+// and adds its tags and conditions directly to the quads table of the main query.
+func (opt *Optimizer) inlineNodes(sel *Select, tbl string, dir quad.Direction, sub Select) bool {
+	if len(sub.From) != 1 || sub.onlyAsSubquery() {
+		return false
+	}
+	if t, ok := sub.From[0].(Table); !ok || t.Name != "nodes" {
+		return false
+	}
+	for _, f := range sub.Fields {
+		if f.Name != "hash" || f.Raw {
+			return false
+		}
+	}
+	for _, w := range sub.Where {
+		if _, ok := w.Value.(Placeholder); w.Field != "hash" || w.Op != OpEqual || !ok {
+			return false
+		}
+	}
+	if len(sub.Params) != len(sub.Where) {
+		return false
+	}
+	for _, f := range sub.Fields {
+		if f.Alias == tagNode {
+			continue
+		}
+		sel.Fields = append(sel.Fields, Field{
+			Table: tbl,
+			Name:  dirField(dir),
+			Alias: f.Alias,
+		})
+	}
+	for i := range sub.Where {
+		sel.Where = append(sel.Where, Where{
+			Table: tbl,
+			Field: dirField(dir),
+			Op:    OpEqual,
+			Value: sel.AppendParam(sub.Params[i]),
+		})
+	}
+	if len(sub.Where) == 0 && dir == quad.Label {
+		// join with nodes table excludes quads without a label
+		sel.Where = append(sel.Where, Where{
+			Table: tbl,
+			Field: dirField(dir),
+			Op:    OpIsNotNull,
+		})
+	}
+	return true
+}
+
 func (opt *Optimizer) optimizeNodesFrom(s shape.NodesFrom) (shape.Shape, bool) {
 	sel, ok := s.Quads.(Select)
 	if !ok {
@@ -37,7 +37,18 @@ func init() {
 		Estimated: func(table string) string {
 			return "SELECT reltuples::BIGINT AS estimate FROM pg_class WHERE relname='" + table + "';"
 		},
-		RunTx: RunTxPostgres,
+		RunTx:  RunTxPostgres,
+		BulkTx: CopyTx,
+		TextSearch: func(b *csql.Builder) (string, string) {
+			p := b.Placeholder()
+			return `to_tsvector('simple', value_string) @@ plainto_tsquery('simple', ` + p + `)`,
+				`ts_rank(to_tsvector('simple', value_string), plainto_tsquery('simple', ` + p + `))`
+		},
+		TextIndex: `CREATE INDEX nodes_text_index ON nodes USING GIN (to_tsvector('simple', value_string));`,
+		// requires pgvector extension; cosine distance is used
+		VectorDistance: func(p string) string {
+			return `value_string::vector <=> ` + p + `::vector`
+		},
 	})
 }
 
@@ -65,45 +76,114 @@ func convInsertErrorPG(err error) error {
 	return err
 }
 
-//func copyFromPG(tx *sql.Tx, in []graph.Delta, opts graph.IgnoreOpts) error {
-//	panic("broken")
-//	stmt, err := tx.Prepare(pq.CopyIn("quads", "subject", "predicate", "object", "label", "id", "ts", "subject_hash", "predicate_hash", "object_hash", "label_hash"))
-//	if err != nil {
-//		clog.Errorf("couldn't prepare COPY statement: %v", err)
-//		return err
-//	}
-//	for _, d := range in {
-//		s, p, o, l, err := marshalQuadDirections(d.Quad)
-//		if err != nil {
-//			clog.Errorf("couldn't marshal quads: %v", err)
-//			return err
-//		}
-//		_, err = stmt.Exec(
-//			s,
-//			p,
-//			o,
-//			l,
-//			d.ID.Int(),
-//			d.Timestamp,
-//			hashOf(d.Quad.Subject),
-//			hashOf(d.Quad.Predicate),
-//			hashOf(d.Quad.Object),
-//			hashOf(d.Quad.Label),
-//		)
-//		if err != nil {
-//			err = convInsertErrorPG(err)
-//			clog.Errorf("couldn't execute COPY statement: %v", err)
-//			return err
-//		}
-//	}
-//	_, err = stmt.Exec()
-//	if err != nil {
-//		err = convInsertErrorPG(err)
-//		return err
-//	}
-//	_ = stmt.Close() // COPY will be closed on last Exec, this will return non-nil error in all cases
-//	return nil
-//}
+// copyColumns is a list of all columns of the nodes table, in the order used by COPY.
+var copyColumns = []string{
+	"refs", "hash", "value", "value_string", "datatype", "language",
+	"iri", "bnode", "value_int", "value_bool", "value_float", "value_time",
+}
+
+// CopyTx is a bulk version of RunTx. It uploads nodes and quads with COPY FROM to temporary
+// tables and merges them into main tables. Reference counters are calculated only for quads
+// that were actually inserted, thus duplicates are accounted correctly.
+func CopyTx(tx *sql.Tx, nodes []graphlog.NodeUpdate, quads []graphlog.QuadUpdate, opts graph.IgnoreOpts) error {
+	if _, err := tx.Exec(`CREATE TEMP TABLE nodes_load (LIKE nodes) ON COMMIT DROP;`); err != nil {
+		return err
+	}
+	if _, err := tx.Exec(`CREATE TEMP TABLE quads_load (
+	subject_hash BYTEA NOT NULL,
+	predicate_hash BYTEA NOT NULL,
+	object_hash BYTEA NOT NULL,
+	label_hash BYTEA
+) ON COMMIT DROP;`); err != nil {
+		return err
+	}
+	col := make(map[string]int, len(copyColumns))
+	for i, c := range copyColumns {
+		col[c] = i
+	}
+	err := copyIn(tx, "nodes_load", copyColumns, len(nodes), func(i int) ([]interface{}, error) {
+		n := nodes[i]
+		if n.RefInc < 0 {
+			panic("unexpected node update")
+		}
+		nodeKey, values, err := csql.NodeValues(csql.NodeHash{n.Hash}, n.Val)
+		if err != nil {
+			return nil, err
+		}
+		row := make([]interface{}, len(copyColumns))
+		row[0], row[1] = 0, values[0]
+		for j, c := range nodeKey.Columns() {
+			row[col[c]] = values[j+1]
+		}
+		return row, nil
+	})
+	if err != nil {
+		return err
+	}
+	err = copyIn(tx, "quads_load", []string{"subject_hash", "predicate_hash", "object_hash", "label_hash"}, len(quads), func(i int) ([]interface{}, error) {
+		d := quads[i]
+		if d.Del {
+			panic("unexpected quad delete")
+		}
+		row := make([]interface{}, 0, len(quad.Directions))
+		for _, h := range d.Quad.Dirs() {
+			row = append(row, csql.NodeHash{h}.SQLValue())
+		}
+		return row, nil
+	})
+	if err != nil {
+		return err
+	}
+	if _, err = tx.Exec(`INSERT INTO nodes SELECT * FROM nodes_load ON CONFLICT (hash) DO NOTHING;`); err != nil {
+		clog.Errorf("couldn't insert nodes: %v", err)
+		return err
+	}
+	conflict := ""
+	if opts.IgnoreDup {
+		conflict = ` ON CONFLICT DO NOTHING`
+	}
+	_, err = tx.Exec(`WITH ins AS (
+	INSERT INTO quads (subject_hash, predicate_hash, object_hash, label_hash, ts)
+	SELECT subject_hash, predicate_hash, object_hash, label_hash, now() FROM quads_load` + conflict + `
+	RETURNING subject_hash, predicate_hash, object_hash, label_hash
+), refs AS (
+	SELECT h, count(*) AS n FROM (
+		SELECT subject_hash AS h FROM ins
+		UNION ALL SELECT predicate_hash FROM ins
+		UNION ALL SELECT object_hash FROM ins
+		UNION ALL SELECT label_hash FROM ins
+	) AS dirs WHERE h IS NOT NULL GROUP BY h
+)
+UPDATE nodes SET refs = nodes.refs + refs.n FROM refs WHERE nodes.hash = refs.h;`)
+	if err = convInsertErrorPG(err); err != nil {
+		clog.Errorf("couldn't insert quads: %v", err)
+		return err
+	}
+	return nil
+}
+
+// copyIn writes n rows to the table with a single COPY FROM statement.
+func copyIn(tx *sql.Tx, table string, columns []string, n int, row func(i int) ([]interface{}, error)) error {
+	stmt, err := tx.Prepare(pq.CopyIn(table, columns...))
+	if err != nil {
+		clog.Errorf("couldn't prepare COPY statement: %v", err)
+		return err
+	}
+	defer stmt.Close()
+	for i := 0; i < n; i++ {
+		vals, err := row(i)
+		if err != nil {
+			return err
+		}
+		if _, err = stmt.Exec(vals...); err != nil {
+			clog.Errorf("couldn't execute COPY statement: %v", err)
+			return err
+		}
+	}
+	// flush the data
+	_, err = stmt.Exec()
+	return err
+}
 
 func RunTxPostgres(tx *sql.Tx, nodes []graphlog.NodeUpdate, quads []graphlog.QuadUpdate, opts graph.IgnoreOpts) error {
 	return RunTx(tx, nodes, quads, opts, "")
@@ -159,11 +239,6 @@ func RunTx(tx *sql.Tx, nodes []graphlog.NodeUpdate, quads []graphlog.QuadUpdate,
 
 	// now we can deal with quads
 
-	// TODO: copy
-	//if allAdds && !opts.IgnoreDup {
-	//	return qs.copyFrom(tx, in, opts)
-	//}
-
 	end := ";"
 	if opts.IgnoreDup {
 		end = ` ON CONFLICT ` + onConflict + ` DO NOTHING;`
@@ -38,3 +38,9 @@ func TestPostgres(t *testing.T) {
 		TimeRound: true,
 	})
 }
+
+func BenchmarkPostgres(b *testing.B) {
+	sqltest.BenchmarkAll(b, Type, makePostgres, &sqltest.Config{
+		TimeRound: true,
+	})
+}
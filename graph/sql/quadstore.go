@@ -1,16 +1,20 @@
 package sql
 
 import (
+	"context"
 	"database/sql"
 	"database/sql/driver"
 	"fmt"
+	"io"
 	"strings"
 	"sync"
 	"time"
 
 	"github.com/cayleygraph/cayley/clog"
 	"github.com/cayleygraph/cayley/graph"
+	"github.com/cayleygraph/cayley/graph/gc"
 	"github.com/cayleygraph/cayley/graph/log"
+	"github.com/cayleygraph/cayley/graph/stats"
 	"github.com/cayleygraph/cayley/internal/lru"
 	"github.com/cayleygraph/cayley/quad"
 	"github.com/cayleygraph/cayley/quad/pquads"
@@ -108,14 +112,28 @@ type QuadHashes struct {
 	graph.QuadHash
 }
 
+var (
+	_ graph.BatchResolver = (*QuadStore)(nil)
+	_ graph.BulkLoader    = (*QuadStore)(nil)
+	_ graph.Maintainer    = (*QuadStore)(nil)
+	_ gc.Sweeper          = (*QuadStore)(nil)
+
+	_ graph.FeatureReporter = (*QuadStore)(nil)
+)
+
 type QuadStore struct {
 	db           *sql.DB
 	opt          *Optimizer
 	flavor       Registration
-	ids          *lru.Cache
+	ids          *graph.ValueCache
 	sizes        *lru.Cache
 	noSizes      bool
 	useEstimates bool
+	stats        *stats.Sampler
+	gc           *gc.Collector
+
+	// unique is a set of hashes of predicates with unique objects
+	unique map[graph.ValueHash]struct{}
 
 	mu   sync.RWMutex
 	size int64
@@ -178,6 +196,18 @@ func Init(typ string, addr string, options graph.Options) error {
 	if !ok {
 		return fmt.Errorf("unsupported sql database: %s", typ)
 	}
+	indexes, err := fl.quadIndexes(options)
+	if err != nil {
+		return err
+	}
+	uniq, err := options.UniquePredicatesKey(graph.OptUniquePredicates)
+	if err != nil {
+		return err
+	}
+	indexes = append(indexes, fl.uniqueTables()...)
+	if fl.TextIndex != "" {
+		indexes = append(indexes, fl.TextIndex)
+	}
 	conn, err := connect(addr, fl.Driver, options)
 	if err != nil {
 		return err
@@ -186,7 +216,6 @@ func Init(typ string, addr string, options graph.Options) error {
 
 	nodesSql := fl.nodesTable()
 	quadsSql := fl.quadsTable()
-	indexes := fl.quadIndexes(options)
 
 	if fl.NoSchemaChangesInTx {
 		_, err = conn.Exec(nodesSql)
@@ -237,6 +266,14 @@ func Init(typ string, addr string, options graph.Options) error {
 		}
 		tx.Commit()
 	}
+	for _, p := range uniq {
+		_, err = conn.Exec(`INSERT INTO unique_predicates (predicate_hash) VALUES (`+fl.Placeholder(1)+`);`,
+			HashOf(p).SQLValue())
+		if err != nil {
+			clog.Errorf("Cannot set unique predicates: %v", err)
+			return err
+		}
+	}
 	return nil
 }
 
@@ -248,6 +285,10 @@ func New(typ string, addr string, options graph.Options) (graph.QuadStore, error
 	if !ok {
 		return nil, fmt.Errorf("unsupported sql database: %s", typ)
 	}
+	cache, err := graph.ValueCacheFrom(options, 1024)
+	if err != nil {
+		return nil, err
+	}
 	conn, err := connect(addr, fl.Driver, options)
 	if err != nil {
 		return nil, err
@@ -258,9 +299,10 @@ func New(typ string, addr string, options graph.Options) (graph.QuadStore, error
 		flavor:  fl,
 		size:    -1,
 		sizes:   lru.New(1024),
-		ids:     lru.New(1024),
+		ids:     cache,
 		noSizes: true, // Skip size checking by default.
 	}
+	qs.stats = stats.NewSampler(qs, 0, 0)
 	if qs.flavor.NoOffsetWithoutLimit {
 		qs.opt.NoOffsetWithoutLimit()
 	}
@@ -273,6 +315,15 @@ func New(typ string, addr string, options graph.Options) (graph.QuadStore, error
 	if qs.useEstimates, err = options.BoolKey("use_estimates", false); err != nil {
 		return nil, err
 	}
+	gcOpt, err := gc.OptionsFrom(options)
+	if err != nil {
+		return nil, err
+	}
+	qs.gc = gc.New(qs, gcOpt)
+	if err = qs.loadUnique(); err != nil {
+		conn.Close()
+		return nil, err
+	}
 	return qs, nil
 }
 
@@ -322,6 +373,9 @@ func NodeValues(h NodeHash, v quad.Value) (ValueType, []interface{}, error) {
 	case quad.Time:
 		nodeKey = 9
 		values = append(values, time.Time(v))
+	case quad.Vector:
+		// stored as a typed string to allow database-side vector search
+		return NodeValues(h, v.TypedString())
 	default:
 		nodeKey = 0
 		p, err := pquads.MarshalValue(v)
@@ -334,9 +388,16 @@ func NodeValues(h NodeHash, v quad.Value) (ValueType, []interface{}, error) {
 	return nodeKey, values, nil
 }
 
+// ApplyDeltas applies changes to the database in a single transaction.
+// Errors of the database are wrapped into graph.BackendError.
 func (qs *QuadStore) ApplyDeltas(in []graph.Delta, opts graph.IgnoreOpts) error {
+	return graph.WrapBackend(qs.flavor.Driver, qs.applyDeltas(in, opts))
+}
+
+func (qs *QuadStore) applyDeltas(in []graph.Delta, opts graph.IgnoreOpts) error {
 	// first calculate values ref deltas
 	deltas := graphlog.SplitDeltas(in)
+	defer qs.stats.Invalidate()
 
 	tx, err := qs.db.Begin()
 	if err != nil {
@@ -411,15 +472,25 @@ func (qs *QuadStore) ApplyDeltas(in []graph.Delta, opts graph.IgnoreOpts) error
 				return graph.ErrQuadNotExist
 			}
 		}
+		if err = qs.updateUnique(tx, in, deltas.QuadDel, deltas.QuadAdd); err != nil {
+			return err
+		}
 		if len(deltas.DecNode) == 0 {
 			return nil
 		}
-		// and remove unused nodes at last
-		_, err = tx.Exec(`DELETE FROM nodes WHERE refs <= 0;`)
+		// and remove unused nodes at last; only check nodes that were
+		// updated, the rest is collected in background
+		deleteNode, err := tx.Prepare(`DELETE FROM nodes WHERE refs <= 0 AND hash = ` + p[0] + `;`)
 		if err != nil {
-			clog.Errorf("couldn't exec DELETE nodes statement: %v", err)
 			return err
 		}
+		for _, n := range deltas.DecNode {
+			_, err = deleteNode.Exec(NodeHash{n.Hash}.SQLValue())
+			if err != nil {
+				clog.Errorf("couldn't exec DELETE nodes statement: %v", err)
+				return err
+			}
+		}
 		return nil
 	})
 	if err != nil {
@@ -430,17 +501,103 @@ func (qs *QuadStore) ApplyDeltas(in []graph.Delta, opts graph.IgnoreOpts) error
 	qs.mu.Lock()
 	qs.size = -1 // TODO(barakmich): Sync size with writes.
 	qs.mu.Unlock()
+	if err = tx.Commit(); err != nil {
+		return err
+	}
+	qs.gc.Deleted(len(deltas.DecNode))
+	return nil
+}
+
+// bulkBatch is the number of quads written in a single transaction by BulkLoad.
+const bulkBatch = 10 * 10000
+
+// BulkLoad writes all quads from the reader in large batches. Flavors that define
+// BulkTx use a faster load path, others fall back to ApplyDeltas.
+func (qs *QuadStore) BulkLoad(r quad.Reader) error {
+	opts := graph.IgnoreOpts{
+		IgnoreDup:     graph.IgnoreDuplicates,
+		IgnoreMissing: graph.IgnoreMissing,
+	}
+	buf := make([]quad.Quad, bulkBatch)
+	for {
+		var (
+			n   int
+			err error
+		)
+		for ; n < len(buf); n++ {
+			buf[n], err = r.ReadQuad()
+			if err != nil {
+				break
+			}
+		}
+		if err != nil && err != io.EOF {
+			return err
+		}
+		if n != 0 {
+			if err := qs.bulkLoad(buf[:n], opts); err != nil {
+				return err
+			}
+		}
+		if err == io.EOF {
+			return nil
+		}
+	}
+}
+
+func (qs *QuadStore) bulkLoad(quads []quad.Quad, opts graph.IgnoreOpts) error {
+	in := make([]graph.Delta, len(quads))
+	for i, q := range quads {
+		in[i] = graph.Delta{Quad: q, Action: graph.Add}
+	}
+	if qs.flavor.BulkTx == nil {
+		return qs.ApplyDeltas(in, opts)
+	}
+	deltas := graphlog.SplitDeltas(in)
+	defer qs.stats.Invalidate()
+
+	tx, err := qs.db.Begin()
+	if err != nil {
+		clog.Errorf("couldn't begin write transaction: %v", err)
+		return err
+	}
+	if err = qs.flavor.BulkTx(tx, deltas.IncNode, deltas.QuadAdd, opts); err != nil {
+		tx.Rollback()
+		return err
+	}
+	if err = qs.updateUnique(tx, in, nil, deltas.QuadAdd); err != nil {
+		tx.Rollback()
+		return err
+	}
+	qs.mu.Lock()
+	qs.size = -1
+	qs.mu.Unlock()
 	return tx.Commit()
 }
 
 func (qs *QuadStore) Quad(val graph.Value) quad.Quad {
+	q, err := qs.QuadContext(context.TODO(), val)
+	if err != nil {
+		clog.Errorf("Couldn't load quad: %v", err)
+	}
+	return q
+}
+
+// QuadContext loads all values of the quad in a single query.
+func (qs *QuadStore) QuadContext(ctx context.Context, val graph.Value) (quad.Quad, error) {
 	h := val.(QuadHashes)
-	return quad.Quad{
-		Subject:   qs.NameOf(h.Get(quad.Subject)),
-		Predicate: qs.NameOf(h.Get(quad.Predicate)),
-		Object:    qs.NameOf(h.Get(quad.Object)),
-		Label:     qs.NameOf(h.Get(quad.Label)),
+	refs := make([]graph.Value, len(quad.Directions))
+	for i, d := range quad.Directions {
+		refs[i] = h.Get(d)
 	}
+	vals, err := qs.NamesOf(ctx, refs)
+	if err != nil {
+		return quad.Quad{}, err
+	}
+	var q quad.Quad
+	for i, d := range quad.Directions {
+		q.Set(d, vals[i])
+	}
+	return q, nil
 }
 
 func (qs *QuadStore) QuadIterator(d quad.Direction, val graph.Value) graph.Iterator {
@@ -462,6 +619,13 @@ func (qs *QuadStore) ValueOf(s quad.Value) graph.Value {
 	return NodeHash(HashOf(s))
 }
 
+var _ graph.ContextQuadStore = (*QuadStore)(nil)
+
+// ValueOfContext is the same as ValueOf. It never queries the database.
+func (qs *QuadStore) ValueOfContext(ctx context.Context, s quad.Value) (graph.Value, error) {
+	return qs.ValueOf(s), nil
+}
+
 // NullTime represents a time.Time that may be null. NullTime implements the
 // sql.Scanner interface so it can be used as a scan destination, similar to
 // sql.NullString.
@@ -499,19 +663,105 @@ func (nt NullTime) Value() (driver.Value, error) {
 	return nt.Time, nil
 }
 
+// nodeColumns is a list of columns of nodes table that store the value of the node.
+const nodeColumns = `value,
+		value_string,
+		datatype,
+		language,
+		iri,
+		bnode,
+		value_int,
+		value_bool,
+		value_float,
+		value_time`
+
+// maxBatchSize is the maximal number of nodes resolved by a single query.
+const maxBatchSize = 100
+
+// nodeValue is a set of columns of nodes table that store the value of the node.
+type nodeValue struct {
+	data   []byte
+	str    sql.NullString
+	typ    sql.NullString
+	lang   sql.NullString
+	iri    sql.NullBool
+	bnode  sql.NullBool
+	vint   sql.NullInt64
+	vbool  sql.NullBool
+	vfloat sql.NullFloat64
+	vtime  NullTime
+}
+
+// fields returns scan destinations for nodeColumns.
+func (nv *nodeValue) fields() []interface{} {
+	return []interface{}{
+		&nv.data,
+		&nv.str,
+		&nv.typ,
+		&nv.lang,
+		&nv.iri,
+		&nv.bnode,
+		&nv.vint,
+		&nv.vbool,
+		&nv.vfloat,
+		&nv.vtime,
+	}
+}
+
+func (nv *nodeValue) quadValue() (quad.Value, error) {
+	if nv.str.Valid {
+		if nv.iri.Bool {
+			return quad.IRI(nv.str.String), nil
+		} else if nv.bnode.Bool {
+			return quad.BNode(nv.str.String), nil
+		} else if nv.lang.Valid {
+			return quad.LangString{
+				Value: quad.String(unescapeNullByte(nv.str.String)),
+				Lang:  nv.lang.String,
+			}, nil
+		} else if nv.typ.Valid {
+			ts := quad.TypedString{
+				Value: quad.String(unescapeNullByte(nv.str.String)),
+				Type:  quad.IRI(nv.typ.String),
+			}
+			if ts.Type == quad.VectorType {
+				return ts.ParseValue()
+			}
+			return ts, nil
+		}
+		return quad.String(unescapeNullByte(nv.str.String)), nil
+	} else if nv.vint.Valid {
+		return quad.Int(nv.vint.Int64), nil
+	} else if nv.vbool.Valid {
+		return quad.Bool(nv.vbool.Bool), nil
+	} else if nv.vfloat.Valid {
+		return quad.Float(nv.vfloat.Float64), nil
+	} else if nv.vtime.Valid {
+		return quad.Time(nv.vtime.Time), nil
+	}
+	return pquads.UnmarshalValue(nv.data)
+}
+
 func (qs *QuadStore) NameOf(v graph.Value) quad.Value {
+	val, err := qs.NameOfContext(context.TODO(), v)
+	if err != nil {
+		clog.Errorf("Couldn't execute value lookup: %v", err)
+	}
+	return val
+}
+
+// NameOfContext is the same as NameOf, but it returns errors and stops when the context is cancelled.
+func (qs *QuadStore) NameOfContext(ctx context.Context, v graph.Value) (quad.Value, error) {
 	if v == nil {
 		if clog.V(2) {
 			clog.Infof("NameOf was nil")
 		}
-		return nil
+		return nil, nil
 	} else if v, ok := v.(graph.PreFetchedValue); ok {
-		return v.NameOf()
+		return v.NameOf(), nil
 	}
 	var hash NodeHash
 	switch h := v.(type) {
-	case graph.PreFetchedValue:
-		return h.NameOf()
 	case NodeHash:
 		hash = h
 	case graph.ValueHash:
@@ -523,100 +773,267 @@ func (qs *QuadStore) NameOf(v graph.Value) quad.Value {
 		if clog.V(2) {
 			clog.Infof("NameOf was nil")
 		}
-		return nil
+		return nil, nil
 	}
-	if val, ok := qs.ids.Get(hash.String()); ok {
-		return val.(quad.Value)
+	if val, ok := qs.ids.NameOf(hash.String()); ok {
+		return val, nil
 	}
 	query := `SELECT
-		value,
-		value_string,
-		datatype,
-		language,
-		iri,
-		bnode,
-		value_int,
-		value_bool,
-		value_float,
-		value_time
-	FROM nodes WHERE hash = ` + qs.flavor.Placeholder(1) + ` LIMIT 1;`
-	c := qs.db.QueryRow(query, hash.SQLValue())
+		` + nodeColumns + `
+	FROM nodes WHERE hash = ` + qs.flavor.Placeholder(1) + `;`
+	c := qs.db.QueryRowContext(ctx, query, hash.SQLValue())
+	var nv nodeValue
+	if err := c.Scan(nv.fields()...); err == sql.ErrNoRows {
+		return nil, nil
+	} else if err != nil {
+		return nil, graph.WrapBackend(qs.flavor.Driver, err)
+	}
+	val, err := nv.quadValue()
+	if err != nil {
+		return nil, fmt.Errorf("couldn't unmarshal value: %v", err)
+	}
+	if val != nil {
+		qs.ids.PutName(hash.String(), val)
+	}
+	return val, nil
+}
+
+// RefsOf returns hashes for a set of values. It never queries the database.
+func (qs *QuadStore) RefsOf(ctx context.Context, vals []quad.Value) ([]graph.Value, error) {
+	out := make([]graph.Value, len(vals))
+	for i, v := range vals {
+		out[i] = qs.ValueOf(v)
+	}
+	return out, nil
+}
+
+// NamesOf resolves values for a set of hashes, loading up to maxBatchSize nodes in a single query.
+func (qs *QuadStore) NamesOf(ctx context.Context, refs []graph.Value) ([]quad.Value, error) {
+	out := make([]quad.Value, len(refs))
 	var (
-		data   []byte
-		str    sql.NullString
-		typ    sql.NullString
-		lang   sql.NullString
-		iri    sql.NullBool
-		bnode  sql.NullBool
-		vint   sql.NullInt64
-		vbool  sql.NullBool
-		vfloat sql.NullFloat64
-		vtime  NullTime
+		hashes []NodeHash
+		inds   = make(map[NodeHash][]int)
 	)
-	if err := c.Scan(
-		&data,
-		&str,
-		&typ,
-		&lang,
-		&iri,
-		&bnode,
-		&vint,
-		&vbool,
-		&vfloat,
-		&vtime,
-	); err != nil {
-		if err != sql.ErrNoRows {
-			clog.Errorf("Couldn't execute value lookup: %v", err)
+	for i, v := range refs {
+		var hash NodeHash
+		switch h := v.(type) {
+		case nil:
+			continue
+		case graph.PreFetchedValue:
+			out[i] = h.NameOf()
+			continue
+		case NodeHash:
+			hash = h
+		case graph.ValueHash:
+			hash = NodeHash{h}
+		default:
+			return out, fmt.Errorf("unexpected token: %T", v)
 		}
-		return nil
+		if !hash.Valid() {
+			continue
+		} else if val, ok := qs.ids.NameOf(hash.String()); ok {
+			out[i] = val
+			continue
+		}
+		if _, ok := inds[hash]; !ok {
+			hashes = append(hashes, hash)
+		}
+		inds[hash] = append(inds[hash], i)
 	}
-	var val quad.Value
-	if str.Valid {
-		if iri.Bool {
-			val = quad.IRI(str.String)
-		} else if bnode.Bool {
-			val = quad.BNode(str.String)
-		} else if lang.Valid {
-			val = quad.LangString{
-				Value: quad.String(unescapeNullByte(str.String)),
-				Lang:  lang.String,
-			}
-		} else if typ.Valid {
-			val = quad.TypedString{
-				Value: quad.String(unescapeNullByte(str.String)),
-				Type:  quad.IRI(typ.String),
+	for len(hashes) != 0 {
+		batch := hashes
+		if len(batch) > maxBatchSize {
+			batch = batch[:maxBatchSize]
+		}
+		hashes = hashes[len(batch):]
+		err := qs.namesOf(ctx, batch, func(h NodeHash, val quad.Value) {
+			for _, i := range inds[h] {
+				out[i] = val
 			}
-		} else {
-			val = quad.String(unescapeNullByte(str.String))
-		}
-	} else if vint.Valid {
-		val = quad.Int(vint.Int64)
-	} else if vbool.Valid {
-		val = quad.Bool(vbool.Bool)
-	} else if vfloat.Valid {
-		val = quad.Float(vfloat.Float64)
-	} else if vtime.Valid {
-		val = quad.Time(vtime.Time)
+		})
+		if err != nil {
+			return out, err
+		}
+	}
+	return out, nil
+}
+
+func (qs *QuadStore) namesOf(ctx context.Context, hashes []NodeHash, fnc func(h NodeHash, val quad.Value)) error {
+	args := make([]interface{}, len(hashes))
+	p := make([]string, len(hashes))
+	for i, h := range hashes {
+		args[i] = h.SQLValue()
+		p[i] = qs.flavor.Placeholder(i + 1)
+	}
+	query := `SELECT
+		hash,
+		` + nodeColumns + `
+	FROM nodes WHERE hash IN (` + strings.Join(p, ", ") + `);`
+	rows, err := qs.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var (
+			hash NodeHash
+			nv   nodeValue
+		)
+		if err = rows.Scan(append([]interface{}{&hash}, nv.fields()...)...); err != nil {
+			return err
+		}
+		val, err := nv.quadValue()
+		if err != nil {
+			return err
+		} else if val != nil {
+			qs.ids.PutName(hash.String(), val)
+		}
+		fnc(hash, val)
+	}
+	return rows.Err()
+}
+
+var _ graph.TextIndexer = (*QuadStore)(nil)
+
+// IndexText implements graph.TextIndexer. It does nothing, since values are indexed by the database.
+// It returns graph.ErrTextSearchNotSupported if database has no full-text search.
+func (qs *QuadStore) IndexText(ctx context.Context, vals []quad.Value) error {
+	if qs.flavor.TextSearch == nil {
+		return graph.ErrTextSearchNotSupported
+	}
+	return nil
+}
+
+// SearchText implements graph.TextIndexer using a full-text search provided by the database.
+func (qs *QuadStore) SearchText(ctx context.Context, query string, offset, limit int) ([]quad.Value, error) {
+	if qs.flavor.TextSearch == nil {
+		return nil, graph.ErrTextSearchNotSupported
+	}
+	b := NewBuilder(qs.flavor.QueryDialect)
+	cond, order := qs.flavor.TextSearch(b)
+	// text index covers IRIs, blank nodes and vectors as well
+	q := `SELECT
+		hash,
+		` + nodeColumns + `
+	FROM nodes WHERE (` + cond + `) AND iri IS NULL AND bnode IS NULL AND
+		(datatype IS NULL OR datatype <> '` + string(quad.VectorType) + `')`
+	if order != "" {
+		q += ` ORDER BY ` + order + ` DESC`
+	}
+	if qs.flavor.Paging != nil {
+		if limit > 0 || offset > 0 {
+			q += ` ` + qs.flavor.Paging(int64(limit), int64(offset))
+		}
 	} else {
-		qv, err := pquads.UnmarshalValue(data)
+		if limit > 0 {
+			q += fmt.Sprintf(` LIMIT %d`, limit)
+		}
+		if offset > 0 {
+			q += fmt.Sprintf(` OFFSET %d`, offset)
+		}
+	}
+	args := make([]interface{}, b.pi)
+	for i := range args {
+		args[i] = query
+	}
+	rows, err := qs.db.QueryContext(ctx, q+`;`, args...)
+	if err != nil {
+		return nil, qs.flavor.Error(err)
+	}
+	defer rows.Close()
+	var out []quad.Value
+	for rows.Next() {
+		var (
+			hash NodeHash
+			nv   nodeValue
+		)
+		if err = rows.Scan(append([]interface{}{&hash}, nv.fields()...)...); err != nil {
+			return out, err
+		}
+		val, err := nv.quadValue()
 		if err != nil {
-			clog.Errorf("Couldn't unmarshal value: %v", err)
-			return nil
+			return out, err
+		} else if val == nil {
+			continue
 		}
-		val = qv
+		qs.ids.PutName(hash.String(), val)
+		out = append(out, val)
 	}
-	if val != nil {
-		qs.ids.Put(hash.String(), val)
+	return out, rows.Err()
+}
+
+var _ graph.VectorIndexer = (*QuadStore)(nil)
+
+// IndexVectors implements graph.VectorIndexer. It does nothing, since values are indexed by the database.
+// It returns graph.ErrVectorSearchNotSupported if database has no vector search.
+func (qs *QuadStore) IndexVectors(ctx context.Context, vecs []quad.Vector) error {
+	if qs.flavor.VectorDistance == nil {
+		return graph.ErrVectorSearchNotSupported
 	}
-	return val
+	return nil
+}
+
+// NearestVectors implements graph.VectorIndexer using a vector distance function provided by the database.
+func (qs *QuadStore) NearestVectors(ctx context.Context, vec quad.Vector, k int) ([]quad.Vector, error) {
+	if qs.flavor.VectorDistance == nil {
+		return nil, graph.ErrVectorSearchNotSupported
+	} else if k <= 0 {
+		return nil, nil
+	}
+	q := `SELECT
+		hash,
+		` + nodeColumns + `
+	FROM nodes WHERE datatype = ` + qs.flavor.Placeholder(1) + `
+	ORDER BY ` + qs.flavor.VectorDistance(qs.flavor.Placeholder(2))
+	if qs.flavor.Paging != nil {
+		q += ` ` + qs.flavor.Paging(int64(k), 0)
+	} else {
+		q += fmt.Sprintf(` LIMIT %d`, k)
+	}
+	rows, err := qs.db.QueryContext(ctx, q+`;`, string(quad.VectorType), string(vec.TypedString().Value))
+	if err != nil {
+		return nil, qs.flavor.Error(err)
+	}
+	defer rows.Close()
+	var out []quad.Vector
+	for rows.Next() {
+		var (
+			hash NodeHash
+			nv   nodeValue
+		)
+		if err = rows.Scan(append([]interface{}{&hash}, nv.fields()...)...); err != nil {
+			return out, err
+		}
+		val, err := nv.quadValue()
+		if err != nil {
+			return out, err
+		}
+		v, ok := val.(quad.Vector)
+		if !ok {
+			continue
+		}
+		qs.ids.PutName(hash.String(), v)
+		out = append(out, v)
+	}
+	return out, rows.Err()
 }
 
 func (qs *QuadStore) Size() int64 {
+	sz, err := qs.SizeContext(context.TODO())
+	if err != nil {
+		clog.Errorf("Couldn't execute COUNT: %v", err)
+		return 0
+	}
+	return sz
+}
+
+// SizeContext is the same as Size, but it returns errors and stops when the context is cancelled.
+func (qs *QuadStore) SizeContext(ctx context.Context) (int64, error) {
 	qs.mu.RLock()
 	sz := qs.size
 	qs.mu.RUnlock()
 	if sz >= 0 {
-		return sz
+		return sz, nil
 	}
 
 	query := "SELECT COUNT(*) FROM quads;"
@@ -624,18 +1041,50 @@ func (qs *QuadStore) Size() int64 {
 		query = qs.flavor.Estimated("quads")
 	}
 
-	err := qs.db.QueryRow(query).Scan(&sz)
+	err := qs.db.QueryRowContext(ctx, query).Scan(&sz)
 	if err != nil {
-		clog.Errorf("Couldn't execute COUNT: %v", err)
-		return 0
+		return 0, graph.WrapBackend(qs.flavor.Driver, err)
 	}
 	qs.mu.Lock()
 	qs.size = sz
 	qs.mu.Unlock()
-	return sz
+	return sz, nil
+}
+
+// Sweep removes nodes with no references left.
+// It is called periodically in background after quads are deleted.
+func (qs *QuadStore) Sweep(ctx context.Context) (int64, error) {
+	defer qs.stats.Invalidate()
+	res, err := qs.db.ExecContext(ctx, `DELETE FROM nodes WHERE refs <= 0;`)
+	if err != nil {
+		return 0, err
+	}
+	return res.RowsAffected()
+}
+
+// Features returns capabilities of the store.
+func (qs *QuadStore) Features() graph.Features {
+	return graph.Features{
+		NodeGC:       true,
+		Transactions: true,
+		Compaction:   true,
+		BulkLoad:     true,
+	}
+}
+
+// Compact removes unused nodes immediately.
+func (qs *QuadStore) Compact(ctx context.Context) error {
+	_, err := qs.gc.Sweep(ctx)
+	return err
+}
+
+// Ping checks the connection to the database.
+func (qs *QuadStore) Ping(ctx context.Context) error {
+	return graph.WrapBackend(qs.flavor.Driver, qs.db.PingContext(ctx))
 }
 
 func (qs *QuadStore) Close() error {
+	qs.gc.Close()
 	return qs.db.Close()
 }
 
@@ -643,6 +1092,12 @@ func (qs *QuadStore) QuadDirection(in graph.Value, d quad.Direction) graph.Value
 	return NodeHash{in.(QuadHashes).Get(d)}
 }
 
+// QuadsWith returns an estimated number of quads with a given value in the specified direction.
+// Estimates are sampled from the database and cached until the next write.
+func (qs *QuadStore) QuadsWith(d quad.Direction, v graph.Value) (int64, bool) {
+	return qs.stats.QuadsWith(d, v)
+}
+
 func (qs *QuadStore) sizeForIterator(isAll bool, dir quad.Direction, hash NodeHash) int64 {
 	var err error
 	if isAll {
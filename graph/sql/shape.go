@@ -37,6 +37,10 @@ var DefaultDialect = QueryDialect{
 type QueryDialect struct {
 	FieldQuote  func(string) string
 	Placeholder func(int) string
+	// Paging returns a clause that limits query results. LIMIT and OFFSET are used if not set.
+	Paging func(limit, offset int64) string
+	// TrueValue is a literal used to compare boolean fields with true. "IS true" is used if not set.
+	TrueValue string
 }
 
 func NewBuilder(d QueryDialect) *Builder {
@@ -214,13 +218,15 @@ func (f Table) NameSQL() string {
 type CmpOp string
 
 const (
-	OpEqual  = CmpOp("=")
-	OpGT     = CmpOp(">")
-	OpGTE    = CmpOp(">=")
-	OpLT     = CmpOp("<")
-	OpLTE    = CmpOp("<=")
-	OpIsNull = CmpOp("IS NULL")
-	OpIsTrue = CmpOp("IS true")
+	OpEqual     = CmpOp("=")
+	OpGT        = CmpOp(">")
+	OpGTE       = CmpOp(">=")
+	OpLT        = CmpOp("<")
+	OpLTE       = CmpOp("<=")
+	OpIsNull    = CmpOp("IS NULL")
+	OpIsNotNull = CmpOp("IS NOT NULL")
+	OpIsTrue    = CmpOp("IS true")
+	OpLike      = CmpOp("LIKE")
 )
 
 type Expr interface {
@@ -248,6 +254,9 @@ func (w Where) SQL(b *Builder) string {
 	if w.Table != "" {
 		name = w.Table + "." + b.EscapeField(name)
 	}
+	if w.Op == OpIsTrue && b.d.TrueValue != "" {
+		return name + " = " + b.d.TrueValue
+	}
 	parts := []string{name, string(w.Op)}
 	if w.Value != nil {
 		parts = append(parts, w.Value.SQL(b))
@@ -346,11 +355,17 @@ func (s Select) SQL(b *Builder) string {
 		}
 		parts = append(parts, "WHERE "+strings.Join(wheres, " AND "))
 	}
-	if s.Limit > 0 {
-		parts = append(parts, "LIMIT "+strconv.FormatInt(s.Limit, 10))
-	}
-	if s.Offset > 0 {
-		parts = append(parts, "OFFSET "+strconv.FormatInt(s.Offset, 10))
+	if b.d.Paging != nil {
+		if s.Limit > 0 || s.Offset > 0 {
+			parts = append(parts, b.d.Paging(s.Limit, s.Offset))
+		}
+	} else {
+		if s.Limit > 0 {
+			parts = append(parts, "LIMIT "+strconv.FormatInt(s.Limit, 10))
+		}
+		if s.Offset > 0 {
+			parts = append(parts, "OFFSET "+strconv.FormatInt(s.Offset, 10))
+		}
 	}
 	sep := " "
 	if len(fields) > 1 {
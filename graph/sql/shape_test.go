@@ -172,9 +172,9 @@ var shapeCases = []struct {
 			},
 		},
 		qu: `SELECT t_1.subject_hash AS __subject, t_1.predicate_hash AS __predicate, t_1.object_hash AS __object, t_1.label_hash AS __label
-	FROM quads AS t_1, (SELECT subject_hash AS ` + tagNode + ` FROM quads WHERE predicate_hash = $1) AS t_2
-	WHERE t_1.subject_hash = $2 AND t_1.predicate_hash = t_2.` + tagNode,
-		args: sVals("p", "s"),
+	FROM quads AS t_1, quads AS t_2
+	WHERE t_1.subject_hash = $1 AND t_2.predicate_hash = $2 AND t_1.predicate_hash = t_2.subject_hash`,
+		args: sVals("s", "p"),
 	},
 	{
 		name: "quads with subquery (inner tags)",
@@ -351,8 +351,41 @@ var shapeCases = []struct {
 				},
 			},
 		},
-		qu:   `SELECT t_5.object_hash AS __node FROM quads AS t_5, (SELECT t_3.subject_hash AS __node FROM quads AS t_3, (SELECT t_1.subject_hash AS __node FROM quads AS t_1, (SELECT subject_hash AS __node FROM quads WHERE predicate_hash = $1 AND object_hash = $2) AS t_2 WHERE t_1.predicate_hash = $3 AND t_1.object_hash = t_2.__node) AS t_4 WHERE t_3.predicate_hash = $4 AND t_3.object_hash = t_4.__node) AS t_6 WHERE t_5.predicate_hash = $5 AND t_5.subject_hash = t_6.__node`,
-		args: sVals("n", "k", "a", "s", "s"),
+		qu:   `SELECT t_4.object_hash AS __node FROM quads AS t_4, quads AS t_3, quads AS t_1, quads AS t_2 WHERE t_4.predicate_hash = $1 AND t_3.predicate_hash = $2 AND t_1.predicate_hash = $3 AND t_2.predicate_hash = $4 AND t_2.object_hash = $5 AND t_1.object_hash = t_2.subject_hash AND t_3.object_hash = t_1.subject_hash AND t_4.subject_hash = t_3.subject_hash`,
+		args: sVals("s", "s", "a", "n", "k"),
+	},
+	{
+		name: "has lookup",
+		s: shape.NodesFrom{
+			Dir: quad.Subject,
+			Quads: shape.Quads{
+				{Dir: quad.Object, Values: shape.Lookup{quad.IRI("o")}},
+				{Dir: quad.Predicate, Values: shape.Lookup{quad.IRI("p")}},
+			},
+		},
+		qu:   `SELECT t_1.subject_hash AS __node FROM quads AS t_1 WHERE t_1.object_hash = $1 AND t_1.predicate_hash = $2`,
+		args: []Value{HashOf(quad.IRI("o")), HashOf(quad.IRI("p"))},
+	},
+	{
+		name: "save via and out",
+		s: shape.NodesFrom{
+			Dir: quad.Object,
+			Quads: shape.Quads{
+				{Dir: quad.Predicate, Values: shape.Lookup{quad.IRI("p2")}},
+				{Dir: quad.Subject, Values: shape.NodesFrom{
+					Dir: quad.Subject,
+					Quads: shape.Quads{
+						{Dir: quad.Object, Values: shape.Save{From: shape.AllNodes{}, Tags: []string{"name"}}},
+						{Dir: quad.Predicate, Values: shape.Lookup{quad.IRI("p1")}},
+						{Dir: quad.Label, Values: shape.Save{From: shape.AllNodes{}, Tags: []string{"graph"}}},
+					},
+				}},
+			},
+		},
+		qu: `SELECT t_2.object_hash AS __node, t_1.object_hash AS name, t_1.label_hash AS graph
+	FROM quads AS t_2, quads AS t_1
+	WHERE t_2.predicate_hash = $1 AND t_1.predicate_hash = $2 AND t_1.label_hash IS NOT NULL AND t_2.subject_hash = t_1.subject_hash`,
+		args: []Value{HashOf(quad.IRI("p2")), HashOf(quad.IRI("p1"))},
 	},
 }
 
@@ -377,3 +410,38 @@ func TestSQLShapes(t *testing.T) {
 		})
 	}
 }
+
+func TestSQLStringFilters(t *testing.T) {
+	dialect := DefaultDialect
+	dialect.Placeholder = func(i int) string {
+		return fmt.Sprintf("$%d", i)
+	}
+	for _, c := range []struct {
+		f   shape.StringMatch
+		arg string
+	}{
+		{f: shape.StringMatch{Op: shape.StringPrefix, Val: "ab"}, arg: "ab%"},
+		{f: shape.StringMatch{Op: shape.StringSuffix, Val: "ab"}, arg: "%ab"},
+		{f: shape.StringMatch{Op: shape.StringContains, Val: "ab"}, arg: "%ab%"},
+		{f: shape.StringMatch{Op: shape.StringPrefix, Val: "a_b"}},
+		{f: shape.StringMatch{Op: shape.StringPrefix, Val: "ab", Fold: true}},
+		{f: shape.StringMatch{Op: shape.StringEqual, Val: "ab"}},
+	} {
+		s, ok := shape.Filter{
+			From:    shape.AllNodes{},
+			Filters: []shape.ValueFilter{c.f},
+		}.Optimize(NewOptimizer())
+		if c.arg == "" {
+			require.False(t, ok, "%#v", s)
+			continue
+		}
+		require.True(t, ok, "%#v", s)
+		f, ok := s.(shape.Filter)
+		require.True(t, ok, "%#v", s)
+		require.Equal(t, []shape.ValueFilter{c.f}, f.Filters)
+		sq, ok := f.From.(Shape)
+		require.True(t, ok, "%#v", f.From)
+		require.Equal(t, `SELECT hash AS `+tagNode+` FROM nodes WHERE value_string LIKE $1`, sq.SQL(NewBuilder(dialect)))
+		require.Equal(t, []Value{StringVal(c.arg)}, sq.Args())
+	}
+}
@@ -1,6 +1,7 @@
 package sqltest
 
 import (
+	"context"
 	"testing"
 	"unicode/utf8"
 
@@ -36,10 +37,34 @@ func TestAll(t *testing.T, typ string, fnc DatabaseFunc, c *Config) {
 		t.Parallel()
 		testZeroRune(t, create)
 	})
+	t.Run("bulk load", func(t *testing.T) {
+		t.Parallel()
+		testBulkLoad(t, create)
+	})
+	t.Run("text search", func(t *testing.T) {
+		t.Parallel()
+		testTextSearch(t, create)
+	})
+	t.Run("unique predicates", func(t *testing.T) {
+		t.Parallel()
+		testUniquePredicates(t, typ, fnc)
+	})
 }
 
 type DatabaseFunc func(t testing.TB) (string, graph.Options, func())
 
+func BenchmarkAll(b *testing.B, typ string, fnc DatabaseFunc, c *Config) {
+	if c == nil {
+		c = &Config{}
+	}
+	graphtest.BenchmarkAll(b, makeDatabaseFunc(typ, fnc), &graphtest.Config{
+		NoPrimitives:        true,
+		TimeInMcs:           true,
+		TimeRound:           c.TimeRound,
+		OptimizesComparison: true,
+	})
+}
+
 func makeDatabaseFunc(typ string, create DatabaseFunc) testutil.DatabaseFunc {
 	return func(t testing.TB) (graph.QuadStore, graph.Options, func()) {
 		addr, opts, closer := create(t)
@@ -78,3 +103,107 @@ func testZeroRune(t testing.TB, create testutil.DatabaseFunc) {
 	require.NoError(t, err)
 	require.Equal(t, obj, qs.NameOf(qs.ValueOf(quad.Raw(obj.String()))))
 }
+
+func testBulkLoad(t testing.TB, create testutil.DatabaseFunc) {
+	qs, opts, closer := create(t)
+	defer closer()
+
+	quads := graphtest.MakeQuadSet()
+	bl, ok := graph.AsBulkLoader(qs)
+	require.True(t, ok)
+	err := bl.BulkLoad(quad.NewReader(quads))
+	require.NoError(t, err)
+	graphtest.ExpectIteratedQuads(t, qs, qs.QuadsAllIterator(), quads, true)
+
+	// all nodes must be removed with the last quad referencing them
+	w := testutil.MakeWriter(t, qs, opts)
+	for _, q := range quads {
+		require.NoError(t, w.RemoveQuad(q))
+	}
+	graphtest.ExpectIteratedValues(t, qs, qs.NodesAllIterator(), nil)
+}
+
+func testTextSearch(t testing.TB, create testutil.DatabaseFunc) {
+	qs, opts, closer := create(t)
+	defer closer()
+
+	ctx := context.TODO()
+	idx, ok := graph.AsTextIndexer(qs)
+	if !ok {
+		t.SkipNow()
+	}
+	if _, err := idx.SearchText(ctx, "fox", 0, 0); err == graph.ErrTextSearchNotSupported {
+		t.SkipNow()
+	}
+
+	w := testutil.MakeWriter(t, qs, opts)
+	err := w.AddQuadSet([]quad.Quad{
+		{Subject: quad.IRI("a"), Predicate: quad.IRI("text"), Object: quad.String("the quick brown fox")},
+		{Subject: quad.IRI("b"), Predicate: quad.IRI("text"), Object: quad.LangString{Value: "lazy fox", Lang: "en"}},
+		{Subject: quad.IRI("c"), Predicate: quad.IRI("text"), Object: quad.String("lazy dog")},
+		{Subject: quad.IRI("fox"), Predicate: quad.IRI("text"), Object: quad.IRI("fox")},
+	})
+	require.NoError(t, err)
+
+	// IRIs are not text values
+	vals, err := idx.SearchText(ctx, "fox", 0, 0)
+	require.NoError(t, err)
+	require.Equal(t, 2, len(vals))
+
+	vals, err = idx.SearchText(ctx, "lazy fox", 0, 0)
+	require.NoError(t, err)
+	require.Equal(t, []quad.Value{quad.LangString{Value: "lazy fox", Lang: "en"}}, vals)
+
+	vals, err = idx.SearchText(ctx, "lazy", 0, 1)
+	require.NoError(t, err)
+	require.Equal(t, 1, len(vals))
+
+	vals2, err := idx.SearchText(ctx, "lazy", 1, 0)
+	require.NoError(t, err)
+	require.Equal(t, 1, len(vals2))
+	require.NotEqual(t, vals, vals2)
+}
+
+func testUniquePredicates(t testing.TB, typ string, create DatabaseFunc) {
+	addr, opts, closer := create(t)
+	defer closer()
+
+	uopts := graph.Options{graph.OptUniquePredicates: []string{"<email>"}}
+	for k, v := range opts {
+		uopts[k] = v
+	}
+	err := sql.Init(typ, addr, uopts)
+	require.NoError(t, err)
+	qs, err := sql.New(typ, addr, uopts)
+	require.NoError(t, err)
+	defer qs.Close()
+
+	w := testutil.MakeWriter(t, qs, nil)
+	email := func(s, o string, l quad.Value) quad.Quad {
+		return quad.Quad{Subject: quad.IRI(s), Predicate: quad.IRI("email"), Object: quad.String(o), Label: l}
+	}
+	err = w.AddQuadSet([]quad.Quad{
+		email("alice", "a@example.com", nil),
+		email("alice", "a@example.com", quad.IRI("g")),
+	})
+	require.NoError(t, err)
+
+	err = w.AddQuad(email("bob", "a@example.com", nil))
+	require.True(t, graph.IsConstraintViolation(err), "%v", err)
+
+	// value is still used in the second graph
+	err = w.RemoveQuad(email("alice", "a@example.com", nil))
+	require.NoError(t, err)
+	err = w.AddQuad(email("bob", "a@example.com", nil))
+	require.True(t, graph.IsConstraintViolation(err), "%v", err)
+
+	// move the value to another subject in a single transaction
+	tx := graph.NewTransaction()
+	tx.RemoveQuad(email("alice", "a@example.com", quad.IRI("g")))
+	tx.AddQuad(email("bob", "a@example.com", nil))
+	err = w.ApplyTransaction(tx)
+	require.NoError(t, err)
+
+	err = w.AddQuad(email("alice", "a@example.com", nil))
+	require.True(t, graph.IsConstraintViolation(err), "%v", err)
+}
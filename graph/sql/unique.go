@@ -0,0 +1,123 @@
+package sql
+
+import (
+	"database/sql"
+
+	"github.com/cayleygraph/cayley/clog"
+	"github.com/cayleygraph/cayley/graph"
+	"github.com/cayleygraph/cayley/graph/log"
+)
+
+// loadUnique reads a set of unique predicates (see graph.OptUniquePredicates).
+// Databases created before unique predicates were supported have no such table and no unique predicates.
+func (qs *QuadStore) loadUnique() error {
+	rows, err := qs.db.Query(`SELECT predicate_hash FROM unique_predicates;`)
+	if err != nil {
+		if clog.V(1) {
+			clog.Infof("unique predicates are not supported by the database: %v", err)
+		}
+		return nil
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var h NodeHash
+		if err = rows.Scan(&h); err != nil {
+			return err
+		}
+		if qs.unique == nil {
+			qs.unique = make(map[graph.ValueHash]struct{})
+		}
+		qs.unique[h.ValueHash] = struct{}{}
+	}
+	return rows.Err()
+}
+
+func (qs *QuadStore) isUnique(pred graph.ValueHash) bool {
+	_, ok := qs.unique[pred]
+	return ok
+}
+
+// updateUnique maintains the index of unique values after quads were added and removed in the transaction.
+// Removed quads are processed first, thus a value can be moved to another subject in a single transaction.
+//
+// The index has a primary key on the predicate and the object, thus concurrent transactions that add
+// the same value cannot both succeed.
+func (qs *QuadStore) updateUnique(tx *sql.Tx, in []graph.Delta, del, add []graphlog.QuadUpdate) error {
+	if len(qs.unique) == 0 {
+		return nil
+	}
+	p := make([]string, 3)
+	for i := range p {
+		p[i] = qs.flavor.Placeholder(i + 1)
+	}
+	var countQuads, deleteValue, getValue, insertValue *sql.Stmt
+	prepare := func(stmt **sql.Stmt, query string) error {
+		if *stmt != nil {
+			return nil
+		}
+		var err error
+		*stmt, err = tx.Prepare(query)
+		return err
+	}
+	for _, d := range del {
+		if !qs.isUnique(d.Quad.Predicate) {
+			continue
+		}
+		s, pr, o := NodeHash{d.Quad.Subject}.SQLValue(), NodeHash{d.Quad.Predicate}.SQLValue(), NodeHash{d.Quad.Object}.SQLValue()
+		// the same value may still be used in other graphs
+		err := prepare(&countQuads, `SELECT COUNT(*) FROM quads WHERE subject_hash=`+p[0]+` AND predicate_hash=`+p[1]+` AND object_hash=`+p[2]+`;`)
+		if err != nil {
+			return err
+		}
+		var n int64
+		if err = countQuads.QueryRow(s, pr, o).Scan(&n); err != nil {
+			return err
+		} else if n != 0 {
+			continue
+		}
+		err = prepare(&deleteValue, `DELETE FROM unique_values WHERE predicate_hash=`+p[0]+` AND object_hash=`+p[1]+` AND subject_hash=`+p[2]+`;`)
+		if err != nil {
+			return err
+		}
+		if _, err = deleteValue.Exec(pr, o, s); err != nil {
+			return err
+		}
+	}
+	for _, d := range add {
+		if !qs.isUnique(d.Quad.Predicate) {
+			continue
+		}
+		s, pr, o := NodeHash{d.Quad.Subject}.SQLValue(), NodeHash{d.Quad.Predicate}.SQLValue(), NodeHash{d.Quad.Object}.SQLValue()
+		err := prepare(&getValue, `SELECT subject_hash FROM unique_values WHERE predicate_hash=`+p[0]+` AND object_hash=`+p[1]+`;`)
+		if err != nil {
+			return err
+		}
+		var cur NodeHash
+		err = getValue.QueryRow(pr, o).Scan(&cur)
+		if err == sql.ErrNoRows {
+			err = prepare(&insertValue, `INSERT INTO unique_values (predicate_hash, object_hash, subject_hash) VALUES (`+p[0]+`, `+p[1]+`, `+p[2]+`);`)
+			if err != nil {
+				return err
+			}
+			if _, err = insertValue.Exec(pr, o, s); err != nil {
+				// the value was added by a concurrent transaction
+				clog.Errorf("couldn't insert unique value: %v", err)
+				return uniqueError(in[d.Ind])
+			}
+			continue
+		} else if err != nil {
+			return err
+		}
+		if cur.ValueHash != d.Quad.Subject {
+			return uniqueError(in[d.Ind])
+		}
+	}
+	return nil
+}
+
+func uniqueError(d graph.Delta) error {
+	return &graph.DeltaError{Delta: d, Err: &graph.ConstraintError{
+		Kind: graph.ConstraintUnique, Subject: d.Quad.Subject,
+		Predicate: d.Quad.Predicate, Object: d.Quad.Object,
+	}}
+}
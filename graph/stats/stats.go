@@ -0,0 +1,133 @@
+// Copyright 2017 The Cayley Authors. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package stats provides cardinality estimates for quad stores.
+//
+// Estimates are used by the query optimizer to pick the order of
+// sub-iterators in joins, so they should be cheap to compute and
+// should not depend on the size of the whole store.
+package stats
+
+import (
+	"context"
+	"fmt"
+	"sync"
+
+	"github.com/cayleygraph/cayley/graph"
+	"github.com/cayleygraph/cayley/internal/lru"
+	"github.com/cayleygraph/cayley/quad"
+)
+
+// Estimator is an optional interface for quad stores that can estimate
+// the number of quads matching a single constraint.
+type Estimator interface {
+	// QuadsWith returns an estimated number of quads that has a given value in the specified direction.
+	// The second return value indicates if the estimate is exact. Exact estimates might be used instead
+	// of counting quads, thus they must account for removed quads and concurrent writes.
+	QuadsWith(d quad.Direction, v graph.Value) (int64, bool)
+}
+
+// QuadsWithAny returns an estimated number of quads that has any of the values in the specified direction.
+func QuadsWithAny(e Estimator, d quad.Direction, vals []graph.Value) (int64, bool) {
+	var (
+		total int64
+		exact = true
+	)
+	for _, v := range vals {
+		n, ex := e.QuadsWith(d, v)
+		total += n
+		exact = exact && ex
+	}
+	return total, exact
+}
+
+const (
+	// DefaultSampleLimit is a default number of quads counted by Sampler for a single estimate.
+	DefaultSampleLimit = 1000
+	// DefaultCacheSize is a default number of estimates cached by Sampler.
+	DefaultCacheSize = 10000
+)
+
+// NewSampler creates an estimator that counts up to limit quads using QuadIterator of the store.
+// Estimates above the limit are not exact and are reported as limit, which is enough to
+// separate selective constraints from non-selective ones.
+//
+// Sampler caches estimates, thus the store should call Invalidate after applying deltas.
+func NewSampler(qs graph.QuadStore, limit, cacheSize int) *Sampler {
+	if limit <= 0 {
+		limit = DefaultSampleLimit
+	}
+	if cacheSize <= 0 {
+		cacheSize = DefaultCacheSize
+	}
+	return &Sampler{qs: qs, limit: limit, size: cacheSize, cache: lru.New(cacheSize)}
+}
+
+var _ Estimator = (*Sampler)(nil)
+
+// Sampler is an Estimator that samples quads from the store.
+type Sampler struct {
+	qs    graph.QuadStore
+	limit int
+	size  int
+
+	mu    sync.Mutex
+	cache *lru.Cache
+}
+
+type estimate struct {
+	size  int64
+	exact bool
+}
+
+func (s *Sampler) QuadsWith(d quad.Direction, v graph.Value) (int64, bool) {
+	if v == nil {
+		return 0, true
+	}
+	key := fmt.Sprintf("%v:%v", d, graph.ToKey(v))
+	s.mu.Lock()
+	e, ok := s.cache.Get(key)
+	s.mu.Unlock()
+	if ok {
+		est := e.(estimate)
+		return est.size, est.exact
+	}
+	est := s.sample(d, v)
+	s.mu.Lock()
+	s.cache.Put(key, est)
+	s.mu.Unlock()
+	return est.size, est.exact
+}
+
+func (s *Sampler) sample(d quad.Direction, v graph.Value) estimate {
+	ctx := context.TODO()
+	it := s.qs.QuadIterator(d, v)
+	defer it.Close()
+	var n int64
+	for n < int64(s.limit) && it.Next(ctx) {
+		n++
+	}
+	if it.Err() != nil {
+		// we cannot say anything about the size - assume the worst
+		return estimate{size: s.qs.Size()}
+	}
+	return estimate{size: n, exact: n < int64(s.limit)}
+}
+
+// Invalidate drops all cached estimates.
+func (s *Sampler) Invalidate() {
+	s.mu.Lock()
+	s.cache = lru.New(s.size)
+	s.mu.Unlock()
+}
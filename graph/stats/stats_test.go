@@ -0,0 +1,43 @@
+package stats_test
+
+import (
+	"testing"
+
+	"github.com/cayleygraph/cayley/graph"
+	"github.com/cayleygraph/cayley/graph/memstore"
+	"github.com/cayleygraph/cayley/graph/stats"
+	"github.com/cayleygraph/cayley/quad"
+)
+
+func TestSampler(t *testing.T) {
+	qs := memstore.New(
+		quad.MakeIRI("a", "follows", "b", ""),
+		quad.MakeIRI("a", "follows", "c", ""),
+		quad.MakeIRI("a", "follows", "d", ""),
+		quad.MakeIRI("b", "follows", "c", ""),
+	)
+	s := stats.NewSampler(qs, 2, 0)
+	a := qs.ValueOf(quad.IRI("a"))
+	b := qs.ValueOf(quad.IRI("b"))
+
+	if n, exact := s.QuadsWith(quad.Subject, a); n != 2 || exact {
+		t.Errorf("unexpected estimate for a: %d (exact: %v)", n, exact)
+	}
+	if n, exact := s.QuadsWith(quad.Subject, b); n != 1 || !exact {
+		t.Errorf("unexpected estimate for b: %d (exact: %v)", n, exact)
+	}
+
+	qs.AddQuad(quad.MakeIRI("b", "follows", "d", ""))
+	if n, _ := s.QuadsWith(quad.Subject, b); n != 1 {
+		t.Errorf("expected cached estimate, got: %d", n)
+	}
+	s.Invalidate()
+	if n, exact := s.QuadsWith(quad.Subject, b); n != 2 || exact {
+		t.Errorf("unexpected estimate after invalidation: %d (exact: %v)", n, exact)
+	}
+
+	n, exact := stats.QuadsWithAny(qs, quad.Subject, []graph.Value{a, b})
+	if n != 5 || !exact {
+		t.Errorf("unexpected exact estimate: %d (exact: %v)", n, exact)
+	}
+}
@@ -0,0 +1,90 @@
+package graph
+
+import (
+	"context"
+	"errors"
+
+	"github.com/cayleygraph/cayley/quad"
+)
+
+// ErrTextSearchNotSupported is returned when full-text search is requested on a quad store without a text index.
+var ErrTextSearchNotSupported = errors.New("full-text search is not supported by this quad store")
+
+// TextIndexer is a full-text index over string values of nodes.
+//
+// Quad stores with a native full-text search implement this interface directly and index values on their own.
+// Other quad stores can be paired with an external index with WithTextIndex.
+type TextIndexer interface {
+	// IndexText adds string values to the index. Values of other types are ignored.
+	// Indexing the same value multiple times should not result in duplicates.
+	IndexText(ctx context.Context, vals []quad.Value) error
+	// SearchText returns string values that match the query, most relevant first.
+	// Query syntax depends on the implementation, but a list of words must always be accepted.
+	// First offset results are skipped. Zero or negative limit means no limit.
+	// Only values accepted by IsTextValue are returned, and fewer than limit results means
+	// that there are no more results.
+	//
+	// Values returned by the search may already be removed from the graph.
+	SearchText(ctx context.Context, query string, offset, limit int) ([]quad.Value, error)
+}
+
+// IsTextValue checks if a value should be added to a full-text index.
+func IsTextValue(v quad.Value) bool {
+	switch v.(type) {
+	case quad.String, quad.LangString, quad.TypedString:
+		return true
+	}
+	return false
+}
+
+// textIndex returns a shared value index for a text index.
+func textIndex(idx TextIndexer) valueIndex {
+	return valueIndex{accept: IsTextValue, add: idx.IndexText}
+}
+
+// IndexTextDeltas returns a middleware that adds string values of all inserted quads to a text index.
+//
+// Values are indexed after the deltas were applied, thus a failure to update the index is reported
+// to the writer, but the quads remain in the store.
+func IndexTextDeltas(idx TextIndexer) WriterMiddleware {
+	return textIndex(idx).middleware(nil)
+}
+
+// WithTextIndex wraps a quad store so that all string values written to it are added to a text index.
+// The result implements TextIndexer by searching the index.
+//
+// Values that are already in the store are not indexed; see IndexAllText.
+// Optional interfaces that write to the store, such as Versioned or BulkLoader, are not exposed by the wrapper.
+// Closing the store closes the index as well, if it implements io.Closer.
+func WithTextIndex(qs QuadStore, idx TextIndexer) QuadStore {
+	return &textIndexStore{
+		QuadStore:   WithWriterMiddleware(qs, IndexTextDeltas(idx)),
+		TextIndexer: idx,
+		base:        qs,
+	}
+}
+
+type textIndexStore struct {
+	QuadStore // base with the index middleware
+	TextIndexer
+	base QuadStore
+}
+
+// Unwrap implements Unwrapper.
+func (qs *textIndexStore) Unwrap() QuadStore {
+	return qs.base
+}
+
+// Features implements FeatureReporter.
+func (qs *textIndexStore) Features() Features {
+	return indexFeatures(qs.base)
+}
+
+func (qs *textIndexStore) Close() error {
+	return closeWithIndex(qs.QuadStore, qs.TextIndexer)
+}
+
+// IndexAllText adds string values of all nodes of the quad store to a text index.
+func IndexAllText(ctx context.Context, qs QuadStore, idx TextIndexer) error {
+	return textIndex(idx).indexAll(ctx, qs)
+}
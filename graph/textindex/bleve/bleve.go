@@ -0,0 +1,162 @@
+// Package bleve implements a full-text index for node values using Bleve.
+//
+// It is intended for quad stores that have no full-text search on their own:
+//
+//	idx, err := bleve.New(path)
+//	...
+//	qs = graph.WithTextIndex(qs, idx)
+package bleve
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/blevesearch/bleve"
+
+	"github.com/cayleygraph/cayley/graph"
+	"github.com/cayleygraph/cayley/quad"
+)
+
+var _ graph.TextIndexer = (*Index)(nil)
+
+// pageSize is the number of results loaded by a single search request when no limit is set.
+const pageSize = 1000
+
+// Index is a full-text index of string values backed by Bleve.
+type Index struct {
+	ind bleve.Index
+}
+
+// New creates a new index at a given path. In-memory index is created if the path is empty.
+func New(path string) (*Index, error) {
+	m := bleve.NewIndexMapping()
+	var (
+		ind bleve.Index
+		err error
+	)
+	if path == "" {
+		ind, err = bleve.NewMemOnly(m)
+	} else {
+		ind, err = bleve.New(path, m)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &Index{ind: ind}, nil
+}
+
+// Open opens an existing index at a given path.
+func Open(path string) (*Index, error) {
+	ind, err := bleve.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	return &Index{ind: ind}, nil
+}
+
+// OpenOrNew opens an existing index at a given path, or creates a new one if the path does not exist.
+// It returns true if the index was created, thus values already in the store must be indexed (see graph.IndexAllText).
+func OpenOrNew(path string) (*Index, bool, error) {
+	if _, err := os.Stat(path); os.IsNotExist(err) {
+		idx, err := New(path)
+		return idx, err == nil, err
+	} else if err != nil {
+		return nil, false, err
+	}
+	idx, err := Open(path)
+	return idx, false, err
+}
+
+// Close closes the index.
+func (idx *Index) Close() error {
+	return idx.ind.Close()
+}
+
+type document struct {
+	Text string `json:"text"`
+}
+
+// docID encodes a value as a document ID. It returns false if the value should not be indexed.
+func docID(v quad.Value) (id, text string, ok bool) {
+	switch v := v.(type) {
+	case quad.String:
+		return "s" + string(v), string(v), true
+	case quad.LangString:
+		return "l" + v.Lang + "\x00" + string(v.Value), string(v.Value), true
+	case quad.TypedString:
+		return "t" + string(v.Type) + "\x00" + string(v.Value), string(v.Value), true
+	}
+	return "", "", false
+}
+
+// valueFromID decodes a value from a document ID.
+func valueFromID(id string) (quad.Value, error) {
+	if id == "" {
+		return nil, fmt.Errorf("empty document id")
+	}
+	typ, s := id[0], id[1:]
+	if typ == 's' {
+		return quad.String(s), nil
+	}
+	i := strings.IndexByte(s, 0)
+	if i < 0 {
+		return nil, fmt.Errorf("invalid document id: %q", id)
+	}
+	switch typ {
+	case 'l':
+		return quad.LangString{Value: quad.String(s[i+1:]), Lang: s[:i]}, nil
+	case 't':
+		return quad.TypedString{Value: quad.String(s[i+1:]), Type: quad.IRI(s[:i])}, nil
+	}
+	return nil, fmt.Errorf("invalid document id: %q", id)
+}
+
+// IndexText implements graph.TextIndexer.
+func (idx *Index) IndexText(ctx context.Context, vals []quad.Value) error {
+	b := idx.ind.NewBatch()
+	for _, v := range vals {
+		id, text, ok := docID(v)
+		if !ok {
+			continue
+		}
+		if err := b.Index(id, document{Text: text}); err != nil {
+			return err
+		}
+	}
+	if b.Size() == 0 {
+		return nil
+	}
+	return idx.ind.Batch(b)
+}
+
+// SearchText implements graph.TextIndexer. Query uses Bleve query string syntax.
+func (idx *Index) SearchText(ctx context.Context, query string, offset, limit int) ([]quad.Value, error) {
+	q := bleve.NewQueryStringQuery(query)
+	if offset < 0 {
+		offset = 0
+	}
+	size := limit
+	if size <= 0 {
+		size = pageSize
+	}
+	var out []quad.Value
+	for {
+		req := bleve.NewSearchRequestOptions(q, size, offset+len(out), false)
+		res, err := idx.ind.SearchInContext(ctx, req)
+		if err != nil {
+			return out, err
+		}
+		for _, h := range res.Hits {
+			v, err := valueFromID(h.ID)
+			if err != nil {
+				return out, err
+			}
+			out = append(out, v)
+		}
+		if limit > 0 || len(res.Hits) < size {
+			return out, nil
+		}
+	}
+}
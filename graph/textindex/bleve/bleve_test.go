@@ -0,0 +1,80 @@
+package bleve
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/cayleygraph/cayley/graph"
+	"github.com/cayleygraph/cayley/graph/memstore"
+	"github.com/cayleygraph/cayley/graph/path"
+	"github.com/cayleygraph/cayley/quad"
+	_ "github.com/cayleygraph/cayley/writer"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDocID(t *testing.T) {
+	for _, v := range []quad.Value{
+		quad.String("some text"),
+		quad.String(""),
+		quad.LangString{Value: "some text", Lang: "en"},
+		quad.TypedString{Value: "some text", Type: "some:type"},
+	} {
+		id, _, ok := docID(v)
+		require.True(t, ok, "%v", v)
+		got, err := valueFromID(id)
+		require.NoError(t, err)
+		require.Equal(t, v, got)
+	}
+	_, _, ok := docID(quad.IRI("iri"))
+	require.False(t, ok)
+}
+
+func TestSearch(t *testing.T) {
+	idx, err := New("")
+	require.NoError(t, err)
+	defer idx.Close()
+
+	qs := graph.WithTextIndex(memstore.New(), idx)
+	w, err := graph.NewQuadWriter("single", qs, nil)
+	require.NoError(t, err)
+	err = w.AddQuadSet([]quad.Quad{
+		{Subject: quad.IRI("a"), Predicate: quad.IRI("text"), Object: quad.String("the quick brown fox")},
+		{Subject: quad.IRI("b"), Predicate: quad.IRI("text"), Object: quad.LangString{Value: "lazy fox", Lang: "en"}},
+		{Subject: quad.IRI("c"), Predicate: quad.IRI("text"), Object: quad.String("lazy dog")},
+	})
+	require.NoError(t, err)
+
+	vals, err := idx.SearchText(context.TODO(), "+lazy +fox", 0, 0)
+	require.NoError(t, err)
+	require.Equal(t, []quad.Value{quad.LangString{Value: "lazy fox", Lang: "en"}}, vals)
+
+	nodes, err := path.StartPath(qs).Search("dog", 0).In(quad.IRI("text")).
+		Iterate(context.TODO()).AllValues(qs)
+	require.NoError(t, err)
+	require.Equal(t, []quad.Value{quad.IRI("c")}, nodes)
+}
+
+func TestOpenOrNew(t *testing.T) {
+	dir, err := ioutil.TempDir("", "cayley_bleve")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+	file := filepath.Join(dir, "index")
+
+	idx, created, err := OpenOrNew(file)
+	require.NoError(t, err)
+	require.True(t, created)
+	err = idx.IndexText(context.TODO(), []quad.Value{quad.String("lazy dog")})
+	require.NoError(t, err)
+	require.NoError(t, idx.Close())
+
+	idx, created, err = OpenOrNew(file)
+	require.NoError(t, err)
+	require.False(t, created)
+	defer idx.Close()
+	vals, err := idx.SearchText(context.TODO(), "dog", 0, 0)
+	require.NoError(t, err)
+	require.Equal(t, []quad.Value{quad.String("lazy dog")}, vals)
+}
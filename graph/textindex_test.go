@@ -0,0 +1,150 @@
+package graph_test
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+	"testing"
+
+	"github.com/cayleygraph/cayley/graph"
+	"github.com/cayleygraph/cayley/graph/memstore"
+	"github.com/cayleygraph/cayley/graph/path"
+	"github.com/cayleygraph/cayley/graph/vectorindex/hnsw"
+	"github.com/cayleygraph/cayley/quad"
+	"github.com/stretchr/testify/require"
+)
+
+// wordIndex is a naive text index that matches values containing all words of the query.
+type wordIndex struct {
+	vals     []quad.Value
+	searches int
+	closed   bool
+}
+
+func (idx *wordIndex) Close() error {
+	idx.closed = true
+	return nil
+}
+
+func (idx *wordIndex) IndexText(ctx context.Context, vals []quad.Value) error {
+	idx.vals = append(idx.vals, vals...)
+	return nil
+}
+
+func (idx *wordIndex) SearchText(ctx context.Context, query string, offset, limit int) ([]quad.Value, error) {
+	idx.searches++
+	var out []quad.Value
+next:
+	for _, v := range idx.vals {
+		for _, w := range strings.Fields(query) {
+			if !strings.Contains(quad.StringOf(v), w) {
+				continue next
+			}
+		}
+		if offset > 0 {
+			offset--
+			continue
+		}
+		out = append(out, v)
+		if limit > 0 && len(out) >= limit {
+			break
+		}
+	}
+	return out, nil
+}
+
+func TestTextIndex(t *testing.T) {
+	idx := &wordIndex{}
+	qs := graph.WithTextIndex(memstore.New(), idx)
+	qw, err := graph.NewQuadWriter("single", qs, nil)
+	require.NoError(t, err)
+	err = qw.AddQuadSet([]quad.Quad{
+		{Subject: quad.IRI("a"), Predicate: quad.IRI("text"), Object: quad.String("quick brown fox")},
+		{Subject: quad.IRI("b"), Predicate: quad.IRI("text"), Object: quad.LangString{Value: "lazy fox", Lang: "en"}},
+		{Subject: quad.IRI("c"), Predicate: quad.IRI("text"), Object: quad.String("lazy dog")},
+		{Subject: quad.IRI("d"), Predicate: quad.IRI("text"), Object: quad.String("lazy dog")},
+		{Subject: quad.IRI("d"), Predicate: quad.IRI("num"), Object: quad.Int(1)},
+	})
+	require.NoError(t, err)
+	// only unique string values are indexed
+	require.Equal(t, []quad.Value{
+		quad.String("quick brown fox"),
+		quad.LangString{Value: "lazy fox", Lang: "en"},
+		quad.String("lazy dog"),
+	}, idx.vals)
+
+	ctx := context.TODO()
+	nodes, err := path.StartPath(qs).Search("lazy", 0).In(quad.IRI("text")).
+		Iterate(ctx).AllValues(qs)
+	require.NoError(t, err)
+	sort.Sort(quad.ByValueString(nodes))
+	require.Equal(t, []quad.Value{quad.IRI("b"), quad.IRI("c"), quad.IRI("d")}, nodes)
+
+	nodes, err = path.StartPath(qs, quad.IRI("d")).Out(quad.IRI("text")).Search("dog", 1).
+		Iterate(ctx).AllValues(qs)
+	require.NoError(t, err)
+	require.Equal(t, []quad.Value{quad.String("lazy dog")}, nodes)
+
+	other := &wordIndex{}
+	err = graph.IndexAllText(ctx, qs, other)
+	require.NoError(t, err)
+	sort.Sort(quad.ByValueString(other.vals))
+	sort.Sort(quad.ByValueString(idx.vals))
+	require.Equal(t, idx.vals, other.vals)
+
+	_, err = path.StartPath(memstore.New()).Search("lazy", 0).Iterate(ctx).AllValues(nil)
+	require.Equal(t, graph.ErrTextSearchNotSupported, err)
+
+	require.NoError(t, qs.Close())
+	require.True(t, idx.closed, "index must be closed with the store")
+}
+
+func TestTextIndexPaging(t *testing.T) {
+	idx := &wordIndex{}
+	qs := graph.WithTextIndex(memstore.New(), idx)
+	qw, err := graph.NewQuadWriter("single", qs, nil)
+	require.NoError(t, err)
+	var quads []quad.Quad
+	for i := 0; i < 250; i++ {
+		quads = append(quads, quad.Quad{
+			Subject: quad.IRI(fmt.Sprintf("n%d", i)), Predicate: quad.IRI("text"), Object: quad.String(fmt.Sprintf("word %d", i)),
+		})
+	}
+	err = qw.AddQuadSet(quads)
+	require.NoError(t, err)
+
+	ctx := context.TODO()
+	vals, err := path.StartPath(qs).Search("word", 0).Iterate(ctx).AllValues(qs)
+	require.NoError(t, err)
+	require.Len(t, vals, 250)
+	require.Equal(t, quad.String("word 0"), vals[0])
+	require.Equal(t, quad.String("word 249"), vals[249])
+	require.Equal(t, 3, idx.searches)
+
+	idx.searches = 0
+	vals, err = path.StartPath(qs).Search("word", 0).Iterate(ctx).Limit(10).AllValues(qs)
+	require.NoError(t, err)
+	require.Len(t, vals, 10)
+	require.Equal(t, 1, idx.searches)
+}
+
+func TestIndexWrappers(t *testing.T) {
+	mem := memstore.New()
+	_, ok := graph.AsVersioned(mem)
+	require.True(t, ok)
+
+	idx := &wordIndex{}
+	qs := graph.WithVectorIndex(graph.WithTextIndex(mem, idx), hnsw.New(nil))
+	_, ok = graph.AsTextIndexer(qs)
+	require.True(t, ok)
+	_, ok = graph.AsVectorIndexer(qs)
+	require.True(t, ok)
+
+	// writes must not bypass the indexes
+	_, ok = graph.AsVersioned(qs)
+	require.False(t, ok)
+	_, ok = graph.AsBulkLoader(qs)
+	require.False(t, ok)
+	require.Equal(t, graph.FeaturesOf(mem).NodeGC, graph.FeaturesOf(qs).NodeGC)
+}
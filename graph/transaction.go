@@ -20,6 +20,10 @@ import "github.com/cayleygraph/cayley/quad"
 type Transaction struct {
 	// Deltas stores the deltas in the right order
 	Deltas []Delta
+	// Base is a horizon of the store that the transaction is based on, as returned by Versioned.Horizon.
+	// If set, the transaction fails with ErrConflict if quads it changes were modified after that horizon.
+	// Zero value makes the transaction unconditional.
+	Base int64
 	// deltas stores the deltas in a map to avoid duplications
 	deltas map[Delta]struct{}
 }
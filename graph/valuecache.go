@@ -0,0 +1,115 @@
+// Copyright 2017 The Cayley Authors. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package graph
+
+import (
+	"github.com/cayleygraph/cayley/internal/lru"
+	"github.com/cayleygraph/cayley/quad"
+)
+
+// OptValueCacheSize is a common option name for the number of node values that a quad store
+// keeps in memory for NameOf and ValueOf lookups. Zero or a negative value disables the cache.
+const OptValueCacheSize = "value_cache_size"
+
+// ValueCache is an LRU cache for NameOf and ValueOf lookups that can be used by quad store implementations.
+//
+// Values returned from the cache are shared, thus hot values (predicates, for example) are only allocated once.
+// A nil cache is valid and caches nothing.
+type ValueCache struct {
+	names  *lru.Cache // node key -> quad.Value
+	values *lru.Cache // quad.Value -> node
+}
+
+// NewValueCache creates a cache that holds up to size values and the same number of node references.
+// It returns nil if the size is not positive.
+func NewValueCache(size int) *ValueCache {
+	if size <= 0 {
+		return nil
+	}
+	return &ValueCache{
+		names:  lru.New(size),
+		values: lru.New(size),
+	}
+}
+
+// ValueCacheFrom creates a cache with a size set by OptValueCacheSize, or with a default size if it's not set.
+func ValueCacheFrom(opt Options, def int) (*ValueCache, error) {
+	size, err := opt.IntKey(OptValueCacheSize, def)
+	if err != nil {
+		return nil, err
+	}
+	return NewValueCache(size), nil
+}
+
+func valueCacheKey(v quad.Value) string {
+	return v.String()
+}
+
+// NameOf returns a cached value for a node key. Node keys are defined by the quad store.
+func (c *ValueCache) NameOf(key string) (quad.Value, bool) {
+	if c == nil {
+		return nil, false
+	}
+	v, ok := c.names.Get(key)
+	if !ok {
+		return nil, false
+	}
+	return v.(quad.Value), true
+}
+
+// ValueOf returns a cached node for a value.
+func (c *ValueCache) ValueOf(v quad.Value) (Value, bool) {
+	if c == nil || v == nil {
+		return nil, false
+	}
+	ref, ok := c.values.Get(valueCacheKey(v))
+	if !ok {
+		return nil, false
+	}
+	return ref.(Value), true
+}
+
+// PutName caches a value for a node key.
+func (c *ValueCache) PutName(key string, v quad.Value) {
+	if c == nil || v == nil {
+		return
+	}
+	c.names.Put(key, v)
+}
+
+// PutValue caches a node for a value.
+func (c *ValueCache) PutValue(v quad.Value, ref Value) {
+	if c == nil || v == nil || ref == nil {
+		return
+	}
+	c.values.Put(valueCacheKey(v), ref)
+}
+
+// Put caches both directions of a mapping between a node and its value.
+func (c *ValueCache) Put(key string, v quad.Value, ref Value) {
+	c.PutName(key, v)
+	c.PutValue(v, ref)
+}
+
+// Del removes a node with a given key and value from the cache. It must be called when the node is deleted.
+func (c *ValueCache) Del(key string, v quad.Value) {
+	if c == nil {
+		return
+	}
+	c.names.Del(key)
+	if v != nil {
+		c.values.Del(valueCacheKey(v))
+	}
+}
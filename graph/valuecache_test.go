@@ -0,0 +1,61 @@
+// Copyright 2017 The Cayley Authors. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package graph_test
+
+import (
+	"testing"
+
+	"github.com/cayleygraph/cayley/graph"
+	"github.com/cayleygraph/cayley/quad"
+	"github.com/stretchr/testify/require"
+)
+
+type intValue int
+
+func (v intValue) Key() interface{} { return v }
+
+func TestValueCache(t *testing.T) {
+	c, err := graph.ValueCacheFrom(graph.Options{graph.OptValueCacheSize: 2}, 100)
+	require.NoError(t, err)
+
+	c.Put("1", quad.IRI("a"), intValue(1))
+	c.Put("2", quad.String("a"), intValue(2))
+
+	v, ok := c.NameOf("1")
+	require.True(t, ok)
+	require.Equal(t, quad.IRI("a"), v)
+	ref, ok := c.ValueOf(quad.String("a"))
+	require.True(t, ok)
+	require.Equal(t, intValue(2), ref)
+
+	// least recently used entries are evicted
+	c.Put("3", quad.IRI("c"), intValue(3))
+	_, ok = c.NameOf("2")
+	require.False(t, ok)
+	_, ok = c.ValueOf(quad.IRI("a"))
+	require.False(t, ok)
+
+	c.Del("1", quad.IRI("a"))
+	_, ok = c.NameOf("1")
+	require.False(t, ok)
+
+	// disabled cache
+	c, err = graph.ValueCacheFrom(graph.Options{graph.OptValueCacheSize: 0}, 100)
+	require.NoError(t, err)
+	require.Nil(t, c)
+	c.Put("1", quad.IRI("a"), intValue(1))
+	_, ok = c.NameOf("1")
+	require.False(t, ok)
+}
@@ -0,0 +1,152 @@
+package graph
+
+import (
+	"context"
+	"io"
+
+	"github.com/cayleygraph/cayley/quad"
+)
+
+// valueIndex is an external index of node values of a single kind. It is shared by text and vector indexes.
+type valueIndex struct {
+	// accept checks if a value should be indexed.
+	accept func(v quad.Value) bool
+	// add adds values to the index.
+	add func(ctx context.Context, vals []quad.Value) error
+	// remove removes values from the index. Optional.
+	remove func(ctx context.Context, vals []quad.Value) error
+}
+
+// values returns unique values of quads accepted by the index, for deltas with a given action.
+func (vi valueIndex) values(in []Delta, act Procedure) []quad.Value {
+	var (
+		vals []quad.Value
+		seen = make(map[quad.Value]struct{})
+	)
+	for _, d := range in {
+		if d.Action != act {
+			continue
+		}
+		for _, dir := range quad.Directions {
+			v := d.Quad.Get(dir)
+			if v == nil || !vi.accept(v) {
+				continue
+			}
+			if _, ok := seen[v]; ok {
+				continue
+			}
+			seen[v] = struct{}{}
+			vals = append(vals, v)
+		}
+	}
+	return vals
+}
+
+// middleware returns a writer middleware that updates the index after deltas were applied.
+//
+// Values of inserted quads are added to the index. If the index supports removal and qs is not nil,
+// values of deleted quads that are no longer used by any quad of qs are removed from the index.
+func (vi valueIndex) middleware(qs QuadStore) WriterMiddleware {
+	return func(next ApplyDeltasFunc) ApplyDeltasFunc {
+		return func(in []Delta, opts IgnoreOpts) error {
+			if err := next(in, opts); err != nil {
+				return err
+			}
+			ctx := context.TODO()
+			if vals := vi.values(in, Add); len(vals) != 0 {
+				if err := vi.add(ctx, vals); err != nil {
+					return err
+				}
+			}
+			if vi.remove == nil || qs == nil {
+				return nil
+			}
+			var unused []quad.Value
+			for _, v := range vi.values(in, Delete) {
+				used, err := valueUsed(ctx, qs, v)
+				if err != nil {
+					return err
+				} else if !used {
+					unused = append(unused, v)
+				}
+			}
+			if len(unused) == 0 {
+				return nil
+			}
+			return vi.remove(ctx, unused)
+		}
+	}
+}
+
+// valueUsed checks if a value is used by at least one quad of the store.
+func valueUsed(ctx context.Context, qs QuadStore, v quad.Value) (bool, error) {
+	ref, err := ValueOf(ctx, qs, v)
+	if err != nil || ref == nil {
+		return false, err
+	}
+	for _, d := range quad.Directions {
+		it := qs.QuadIterator(d, ref)
+		ok := it.Next(ctx)
+		err = it.Err()
+		it.Close()
+		if ok || err != nil {
+			return ok, err
+		}
+	}
+	return false, nil
+}
+
+// indexAll adds values of all nodes of the quad store to the index.
+func (vi valueIndex) indexAll(ctx context.Context, qs QuadStore) error {
+	const batch = 1000
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	vals := make([]quad.Value, 0, batch)
+	var ierr error
+	it := qs.NodesAllIterator()
+	defer it.Close()
+	err := Iterate(ctx, it).EachValue(qs, func(v quad.Value) {
+		if ierr != nil || !vi.accept(v) {
+			return
+		}
+		vals = append(vals, v)
+		if len(vals) >= batch {
+			if ierr = vi.add(ctx, vals); ierr != nil {
+				cancel()
+			}
+			vals = vals[:0]
+		}
+	})
+	if ierr != nil {
+		return ierr
+	} else if err != nil {
+		return err
+	}
+	if len(vals) != 0 {
+		return vi.add(ctx, vals)
+	}
+	return nil
+}
+
+// indexFeatures returns features of a store wrapped with an index. Features that allow writing to the
+// store directly, bypassing the index, are not reported.
+func indexFeatures(qs QuadStore) Features {
+	f := FeaturesOf(qs)
+	return Features{
+		NodeGC:       f.NodeGC,
+		Transactions: f.Transactions,
+		Compaction:   f.Compaction,
+		Check:        f.Check,
+	}
+}
+
+// closeWithIndex closes the store and the index, if it implements io.Closer.
+func closeWithIndex(qs QuadStore, idx interface{}) error {
+	err := qs.Close()
+	if c, ok := idx.(io.Closer); ok {
+		if err2 := c.Close(); err == nil {
+			err = err2
+		}
+	}
+	return err
+}
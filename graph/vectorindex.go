@@ -0,0 +1,110 @@
+package graph
+
+import (
+	"context"
+	"errors"
+
+	"github.com/cayleygraph/cayley/quad"
+)
+
+// ErrVectorSearchNotSupported is returned when nearest-neighbor search is requested on a quad store without a vector index.
+var ErrVectorSearchNotSupported = errors.New("vector search is not supported by this quad store")
+
+// VectorIndexer is a nearest-neighbor index over vector values of nodes.
+//
+// Quad stores with a native vector search implement this interface directly and index values on their own.
+// Other quad stores can be paired with an external index with WithVectorIndex.
+type VectorIndexer interface {
+	// IndexVectors adds vectors to the index.
+	// Indexing the same vector multiple times should not result in duplicates.
+	IndexVectors(ctx context.Context, vecs []quad.Vector) error
+	// NearestVectors returns up to k indexed vectors that are the closest to vec, closest first.
+	// The search might be approximate. Distance metric depends on the implementation.
+	//
+	// Vectors returned by the search may already be removed from the graph.
+	NearestVectors(ctx context.Context, vec quad.Vector, k int) ([]quad.Vector, error)
+}
+
+// VectorRemover is an optional interface for vector indexes that support removal of vectors.
+//
+// Stores wrapped with WithVectorIndex remove vectors from such indexes once no quads use them.
+type VectorRemover interface {
+	// RemoveVectors removes vectors from the index. Vectors that are not indexed are ignored.
+	RemoveVectors(ctx context.Context, vecs []quad.Vector) error
+}
+
+// vectorIndex returns a shared value index for a vector index.
+func vectorIndex(idx VectorIndexer) valueIndex {
+	vi := valueIndex{
+		accept: func(v quad.Value) bool {
+			_, ok := v.(quad.Vector)
+			return ok
+		},
+		add: func(ctx context.Context, vals []quad.Value) error {
+			return idx.IndexVectors(ctx, toVectors(vals))
+		},
+	}
+	if r, ok := idx.(VectorRemover); ok {
+		vi.remove = func(ctx context.Context, vals []quad.Value) error {
+			return r.RemoveVectors(ctx, toVectors(vals))
+		}
+	}
+	return vi
+}
+
+func toVectors(vals []quad.Value) []quad.Vector {
+	vecs := make([]quad.Vector, 0, len(vals))
+	for _, v := range vals {
+		vecs = append(vecs, v.(quad.Vector))
+	}
+	return vecs
+}
+
+// IndexVectorDeltas returns a middleware that adds vector values of all inserted quads to a vector index.
+//
+// Values are indexed after the deltas were applied, thus a failure to update the index is reported
+// to the writer, but the quads remain in the store.
+func IndexVectorDeltas(idx VectorIndexer) WriterMiddleware {
+	return vectorIndex(idx).middleware(nil)
+}
+
+// WithVectorIndex wraps a quad store so that all vector values written to it are added to a vector index.
+// The result implements VectorIndexer by searching the index.
+//
+// If the index implements VectorRemover, vectors are removed from it once the last quad using them is deleted.
+//
+// Values that are already in the store are not indexed; see IndexAllVectors.
+// Optional interfaces that write to the store, such as Versioned or BulkLoader, are not exposed by the wrapper.
+// Closing the store closes the index as well, if it implements io.Closer.
+func WithVectorIndex(qs QuadStore, idx VectorIndexer) QuadStore {
+	return &vectorIndexStore{
+		QuadStore:     WithWriterMiddleware(qs, vectorIndex(idx).middleware(qs)),
+		VectorIndexer: idx,
+		base:          qs,
+	}
+}
+
+type vectorIndexStore struct {
+	QuadStore // base with the index middleware
+	VectorIndexer
+	base QuadStore
+}
+
+// Unwrap implements Unwrapper.
+func (qs *vectorIndexStore) Unwrap() QuadStore {
+	return qs.base
+}
+
+// Features implements FeatureReporter.
+func (qs *vectorIndexStore) Features() Features {
+	return indexFeatures(qs.base)
+}
+
+func (qs *vectorIndexStore) Close() error {
+	return closeWithIndex(qs.QuadStore, qs.VectorIndexer)
+}
+
+// IndexAllVectors adds vector values of all nodes of the quad store to a vector index.
+func IndexAllVectors(ctx context.Context, qs QuadStore, idx VectorIndexer) error {
+	return vectorIndex(idx).indexAll(ctx, qs)
+}
@@ -0,0 +1,351 @@
+// Package hnsw implements an in-memory approximate nearest-neighbor index for vector values
+// using Hierarchical Navigable Small World graphs.
+//
+// It is intended for quad stores that have no vector search on their own:
+//
+//	qs = graph.WithVectorIndex(qs, hnsw.New(nil))
+//
+// The index is not persisted; use graph.IndexAllVectors to rebuild it when the quad store is opened.
+package hnsw
+
+import (
+	"container/heap"
+	"context"
+	"fmt"
+	"math"
+	"math/rand"
+	"sync"
+
+	"github.com/cayleygraph/cayley/graph"
+	"github.com/cayleygraph/cayley/quad"
+)
+
+var (
+	_ graph.VectorIndexer = (*Index)(nil)
+	_ graph.VectorRemover = (*Index)(nil)
+)
+
+// Distance is a function that returns a distance between two vectors of the same length.
+type Distance func(a, b []float32) float32
+
+// Euclidean is a squared Euclidean distance between vectors.
+func Euclidean(a, b []float32) float32 {
+	var d float32
+	for i := range a {
+		x := a[i] - b[i]
+		d += x * x
+	}
+	return d
+}
+
+// Cosine is a cosine distance between vectors. It is equal to 1 minus cosine similarity.
+func Cosine(a, b []float32) float32 {
+	var dot, na, nb float32
+	for i := range a {
+		dot += a[i] * b[i]
+		na += a[i] * a[i]
+		nb += b[i] * b[i]
+	}
+	if na == 0 || nb == 0 {
+		return 1
+	}
+	return 1 - dot/float32(math.Sqrt(float64(na))*math.Sqrt(float64(nb)))
+}
+
+// Config is a set of parameters for the index. Zero values are replaced with defaults.
+type Config struct {
+	M              int      // max number of neighbors per node on upper layers (twice as much on the lowest one); 16 by default
+	EfConstruction int      // size of candidate list during insertion; 200 by default
+	EfSearch       int      // minimal size of candidate list during search; 50 by default
+	Distance       Distance // distance function; Cosine by default
+}
+
+type node struct {
+	val   quad.Vector
+	vec   []float32 // components of val, decoded once for distance computations
+	links [][]int   // neighbors per layer
+	// deleted marks removed vectors. They are kept in the graph to preserve its connectivity,
+	// but are never returned by the search.
+	deleted bool
+}
+
+// Index is an in-memory HNSW index of vector values. All vectors must have the same length.
+// It is safe for concurrent use.
+type Index struct {
+	conf Config
+	ml   float64 // level generation factor
+
+	mu    sync.RWMutex
+	rnd   *rand.Rand
+	nodes []node
+	ids   map[quad.Vector]int
+	dels  int // number of deleted nodes
+	entry int // entry point; -1 if index is empty
+	top   int // top layer of the entry point
+}
+
+// New creates a new empty index. Config can be nil to use default parameters.
+func New(c *Config) *Index {
+	var conf Config
+	if c != nil {
+		conf = *c
+	}
+	if conf.M <= 0 {
+		conf.M = 16
+	}
+	if conf.EfConstruction <= 0 {
+		conf.EfConstruction = 200
+	}
+	if conf.EfSearch <= 0 {
+		conf.EfSearch = 50
+	}
+	if conf.Distance == nil {
+		conf.Distance = Cosine
+	}
+	ml := 1 / math.Log(float64(conf.M))
+	if conf.M == 1 {
+		ml = 1
+	}
+	return &Index{
+		conf:  conf,
+		ml:    ml,
+		rnd:   rand.New(rand.NewSource(1)),
+		ids:   make(map[quad.Vector]int),
+		entry: -1,
+	}
+}
+
+// Len returns the number of vectors in the index, not including removed ones.
+func (idx *Index) Len() int {
+	idx.mu.RLock()
+	defer idx.mu.RUnlock()
+	return len(idx.nodes) - idx.dels
+}
+
+// IndexVectors implements graph.VectorIndexer.
+func (idx *Index) IndexVectors(ctx context.Context, vecs []quad.Vector) error {
+	idx.mu.Lock()
+	defer idx.mu.Unlock()
+	for _, v := range vecs {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		if err := idx.insert(v); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// RemoveVectors implements graph.VectorRemover.
+//
+// Removed vectors are only marked as deleted and still take memory. Indexing them again restores them.
+func (idx *Index) RemoveVectors(ctx context.Context, vecs []quad.Vector) error {
+	idx.mu.Lock()
+	defer idx.mu.Unlock()
+	for _, v := range vecs {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		if id, ok := idx.ids[v]; ok && !idx.nodes[id].deleted {
+			idx.nodes[id].deleted = true
+			idx.dels++
+		}
+	}
+	return nil
+}
+
+// NearestVectors implements graph.VectorIndexer.
+func (idx *Index) NearestVectors(ctx context.Context, vec quad.Vector, k int) ([]quad.Vector, error) {
+	idx.mu.RLock()
+	defer idx.mu.RUnlock()
+	if k <= 0 || idx.entry < 0 {
+		return nil, nil
+	}
+	if n := len(idx.nodes[idx.entry].vec); vec.Len() != n {
+		return nil, fmt.Errorf("hnsw: unexpected vector length: %d vs %d", vec.Len(), n)
+	}
+	v := vec.Floats()
+	ep := idx.entry
+	for l := idx.top; l > 0; l-- {
+		ep = idx.greedy(v, ep, l)
+	}
+	ef := idx.conf.EfSearch
+	if ef < k {
+		ef = k
+	}
+	// deleted nodes are skipped, so widen the search until enough results are found
+	var out []quad.Vector
+	for {
+		res := idx.searchLayer(v, ep, ef, 0)
+		out = out[:0]
+		for _, c := range res {
+			if len(out) >= k {
+				break
+			}
+			if !idx.nodes[c.id].deleted {
+				out = append(out, idx.nodes[c.id].val)
+			}
+		}
+		if len(out) >= k || len(res) < ef || ef >= len(idx.nodes) {
+			return out, nil
+		}
+		ef *= 2
+	}
+}
+
+func (idx *Index) maxLinks(layer int) int {
+	if layer == 0 {
+		return 2 * idx.conf.M
+	}
+	return idx.conf.M
+}
+
+func (idx *Index) insert(val quad.Vector) error {
+	if id, ok := idx.ids[val]; ok {
+		if idx.nodes[id].deleted {
+			idx.nodes[id].deleted = false
+			idx.dels--
+		}
+		return nil
+	}
+	if idx.entry >= 0 {
+		if n := len(idx.nodes[idx.entry].vec); val.Len() != n {
+			return fmt.Errorf("hnsw: unexpected vector length: %d vs %d", val.Len(), n)
+		}
+	}
+	v := val.Floats()
+	level := int(-math.Log(1-idx.rnd.Float64()) * idx.ml)
+	id := len(idx.nodes)
+	idx.nodes = append(idx.nodes, node{val: val, vec: v, links: make([][]int, level+1)})
+	idx.ids[val] = id
+	if idx.entry < 0 {
+		idx.entry, idx.top = id, level
+		return nil
+	}
+	ep := idx.entry
+	for l := idx.top; l > level; l-- {
+		ep = idx.greedy(v, ep, l)
+	}
+	for l := min(level, idx.top); l >= 0; l-- {
+		cands := idx.searchLayer(v, ep, idx.conf.EfConstruction, l)
+		ep = cands[0].id
+		links := make([]int, 0, idx.conf.M)
+		for _, c := range idx.selectNeighbors(cands, idx.conf.M) {
+			links = append(links, c.id)
+		}
+		idx.nodes[id].links[l] = links
+		for _, nb := range links {
+			idx.link(nb, id, l)
+		}
+	}
+	if level > idx.top {
+		idx.entry, idx.top = id, level
+	}
+	return nil
+}
+
+// link adds a connection from node a to node b on a given layer, pruning the most distant connections if necessary.
+func (idx *Index) link(a, b, layer int) {
+	n := &idx.nodes[a]
+	n.links[layer] = append(n.links[layer], b)
+	max := idx.maxLinks(layer)
+	if len(n.links[layer]) <= max {
+		return
+	}
+	cands := make([]candidate, 0, len(n.links[layer]))
+	for _, id := range n.links[layer] {
+		cands = append(cands, candidate{id: id, dist: idx.conf.Distance(n.vec, idx.nodes[id].vec)})
+	}
+	sortCandidates(cands)
+	links := n.links[layer][:0]
+	for _, c := range idx.selectNeighbors(cands, max) {
+		links = append(links, c.id)
+	}
+	n.links[layer] = links
+}
+
+// selectNeighbors picks up to m neighbors from candidates sorted by distance.
+// It prefers candidates that are closer to the base node than to already selected neighbors,
+// and fills the rest with the closest remaining candidates.
+func (idx *Index) selectNeighbors(cands []candidate, m int) []candidate {
+	if len(cands) <= m {
+		return cands
+	}
+	out := make([]candidate, 0, m)
+	var skipped []candidate
+	for _, c := range cands {
+		if len(out) >= m {
+			break
+		}
+		good := true
+		for _, s := range out {
+			if idx.conf.Distance(idx.nodes[c.id].vec, idx.nodes[s.id].vec) < c.dist {
+				good = false
+				break
+			}
+		}
+		if good {
+			out = append(out, c)
+		} else {
+			skipped = append(skipped, c)
+		}
+	}
+	for i := 0; len(out) < m && i < len(skipped); i++ {
+		out = append(out, skipped[i])
+	}
+	return out
+}
+
+// greedy walks the layer from the entry point towards the closest node to v.
+func (idx *Index) greedy(v []float32, ep, layer int) int {
+	cur := ep
+	dist := idx.conf.Distance(v, idx.nodes[cur].vec)
+	for changed := true; changed; {
+		changed = false
+		for _, nb := range idx.nodes[cur].links[layer] {
+			if d := idx.conf.Distance(v, idx.nodes[nb].vec); d < dist {
+				cur, dist, changed = nb, d, true
+			}
+		}
+	}
+	return cur
+}
+
+// searchLayer returns up to ef nodes of the layer that are the closest to v, sorted by distance.
+func (idx *Index) searchLayer(v []float32, ep, ef, layer int) []candidate {
+	start := candidate{id: ep, dist: idx.conf.Distance(v, idx.nodes[ep].vec)}
+	visited := map[int]struct{}{ep: {}}
+	cands := &minHeap{start}
+	res := &maxHeap{start}
+	for cands.Len() != 0 {
+		c := heap.Pop(cands).(candidate)
+		if c.dist > (*res)[0].dist && res.Len() >= ef {
+			break
+		}
+		for _, nb := range idx.nodes[c.id].links[layer] {
+			if _, ok := visited[nb]; ok {
+				continue
+			}
+			visited[nb] = struct{}{}
+			d := idx.conf.Distance(v, idx.nodes[nb].vec)
+			if res.Len() < ef || d < (*res)[0].dist {
+				heap.Push(cands, candidate{id: nb, dist: d})
+				heap.Push(res, candidate{id: nb, dist: d})
+				if res.Len() > ef {
+					heap.Pop(res)
+				}
+			}
+		}
+	}
+	out := []candidate(*res)
+	sortCandidates(out)
+	return out
+}
+
+func min(a, b int) int {
+	if a < b {
+		return a
+	}
+	return b
+}
@@ -0,0 +1,153 @@
+package hnsw
+
+import (
+	"context"
+	"math/rand"
+	"sort"
+	"testing"
+
+	"github.com/cayleygraph/cayley/graph"
+	"github.com/cayleygraph/cayley/graph/memstore"
+	"github.com/cayleygraph/cayley/graph/path"
+	"github.com/cayleygraph/cayley/quad"
+	_ "github.com/cayleygraph/cayley/writer"
+	"github.com/stretchr/testify/require"
+)
+
+func randVector(r *rand.Rand, n int) quad.Vector {
+	v := make([]float32, n)
+	for i := range v {
+		v[i] = r.Float32()*2 - 1
+	}
+	return quad.NewVector(v...)
+}
+
+func TestRecall(t *testing.T) {
+	const (
+		n   = 1000
+		dim = 16
+		k   = 10
+	)
+	r := rand.New(rand.NewSource(42))
+	vecs := make([]quad.Vector, n)
+	for i := range vecs {
+		vecs[i] = randVector(r, dim)
+	}
+	ctx := context.TODO()
+	for _, dist := range []Distance{Cosine, Euclidean} {
+		idx := New(&Config{Distance: dist})
+		require.NoError(t, idx.IndexVectors(ctx, vecs))
+		require.NoError(t, idx.IndexVectors(ctx, vecs[:10]))
+		require.Equal(t, n, idx.Len())
+
+		found, total := 0, 0
+		for i := 0; i < 50; i++ {
+			q := randVector(r, dim)
+			exp := make([]quad.Vector, n)
+			copy(exp, vecs)
+			sort.Slice(exp, func(i, j int) bool {
+				return dist(q.Floats(), exp[i].Floats()) < dist(q.Floats(), exp[j].Floats())
+			})
+			exp = exp[:k]
+			got, err := idx.NearestVectors(ctx, q, k)
+			require.NoError(t, err)
+			require.Equal(t, k, len(got))
+			for _, e := range exp {
+				for _, g := range got {
+					if e.Equal(g) {
+						found++
+						break
+					}
+				}
+			}
+			total += k
+		}
+		recall := float64(found) / float64(total)
+		require.True(t, recall >= 0.95, "recall: %v", recall)
+	}
+}
+
+func TestLength(t *testing.T) {
+	ctx := context.TODO()
+	idx := New(nil)
+	got, err := idx.NearestVectors(ctx, quad.NewVector(1, 0), 1)
+	require.NoError(t, err)
+	require.Equal(t, 0, len(got))
+
+	require.NoError(t, idx.IndexVectors(ctx, []quad.Vector{quad.NewVector(1, 0)}))
+	require.Error(t, idx.IndexVectors(ctx, []quad.Vector{quad.NewVector(1, 0, 0)}))
+	_, err = idx.NearestVectors(ctx, quad.NewVector(1, 0, 0), 1)
+	require.Error(t, err)
+}
+
+func TestRemove(t *testing.T) {
+	const n = 100
+	ctx := context.TODO()
+	r := rand.New(rand.NewSource(42))
+	vecs := make([]quad.Vector, n)
+	for i := range vecs {
+		vecs[i] = randVector(r, 8)
+	}
+	idx := New(nil)
+	require.NoError(t, idx.IndexVectors(ctx, vecs))
+	require.NoError(t, idx.RemoveVectors(ctx, vecs[:n-5]))
+	require.NoError(t, idx.RemoveVectors(ctx, vecs[:10]))
+	require.Equal(t, 5, idx.Len())
+
+	got, err := idx.NearestVectors(ctx, vecs[0], 10)
+	require.NoError(t, err)
+	require.Equal(t, 5, len(got))
+	for _, g := range got {
+		live := false
+		for _, v := range vecs[n-5:] {
+			live = live || v.Equal(g)
+		}
+		require.True(t, live, "removed vector returned: %v", g)
+	}
+
+	require.NoError(t, idx.IndexVectors(ctx, vecs[:1]))
+	require.Equal(t, 6, idx.Len())
+	got, err = idx.NearestVectors(ctx, vecs[0], 1)
+	require.NoError(t, err)
+	require.Equal(t, []quad.Vector{vecs[0]}, got)
+}
+
+func TestNearestTo(t *testing.T) {
+	qs := graph.WithVectorIndex(memstore.New(), New(&Config{Distance: Euclidean}))
+	w, err := graph.NewQuadWriter("single", qs, nil)
+	require.NoError(t, err)
+	emb := quad.IRI("embedding")
+	err = w.AddQuadSet([]quad.Quad{
+		{Subject: quad.IRI("a"), Predicate: emb, Object: quad.NewVector(0, 0)},
+		{Subject: quad.IRI("b"), Predicate: emb, Object: quad.NewVector(1, 1)},
+		{Subject: quad.IRI("c"), Predicate: emb, Object: quad.NewVector(5, 5)},
+		{Subject: quad.IRI("a"), Predicate: quad.IRI("type"), Object: quad.IRI("A")},
+		{Subject: quad.IRI("c"), Predicate: quad.IRI("type"), Object: quad.IRI("A")},
+	})
+	require.NoError(t, err)
+
+	ctx := context.TODO()
+	nodes, err := path.StartPath(qs).NearestTo(quad.NewVector(0.9, 0.8), 2).In(emb).
+		Iterate(ctx).AllValues(qs)
+	require.NoError(t, err)
+	sort.Sort(quad.ByValueString(nodes))
+	require.Equal(t, []quad.Value{quad.IRI("a"), quad.IRI("b")}, nodes)
+
+	// nearest vectors are selected before filtering
+	nodes, err = path.StartPath(qs).NearestTo(quad.NewVector(0.9, 0.8), 1).In(emb).
+		Has(quad.IRI("type"), quad.IRI("A")).Iterate(ctx).AllValues(qs)
+	require.NoError(t, err)
+	require.Equal(t, 0, len(nodes))
+
+	// vectors are removed from the index with the last quad using them
+	err = w.RemoveQuad(quad.Quad{Subject: quad.IRI("b"), Predicate: emb, Object: quad.NewVector(1, 1)})
+	require.NoError(t, err)
+	nodes, err = path.StartPath(qs).NearestTo(quad.NewVector(0.9, 0.8), 2).In(emb).
+		Iterate(ctx).AllValues(qs)
+	require.NoError(t, err)
+	sort.Sort(quad.ByValueString(nodes))
+	require.Equal(t, []quad.Value{quad.IRI("a"), quad.IRI("c")}, nodes)
+
+	_, err = path.StartPath(memstore.New()).NearestTo(quad.NewVector(0, 0), 1).Iterate(ctx).AllValues(nil)
+	require.Equal(t, graph.ErrVectorSearchNotSupported, err)
+}
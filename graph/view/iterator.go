@@ -0,0 +1,201 @@
+// Copyright 2017 The Cayley Authors. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package view
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/cayleygraph/cayley/graph"
+	"github.com/cayleygraph/cayley/graph/iterator"
+	"github.com/cayleygraph/cayley/graph/shape"
+)
+
+var _ shape.Shape = Shape{}
+
+// Shape reads results of a materialized view for a set of source nodes.
+type Shape struct {
+	View *View
+	From shape.Shape // source nodes; AllNodes means all sources of the view
+}
+
+func (s Shape) BuildIterator(qs graph.QuadStore) graph.Iterator {
+	if shape.IsNull(s.From) {
+		return iterator.NewNull()
+	}
+	var from graph.Iterator
+	if _, ok := s.From.(shape.AllNodes); ok {
+		from = iterator.NewFixed(s.View.allSources()...)
+	} else {
+		from = s.From.BuildIterator(qs)
+	}
+	return NewIterator(s.View, from)
+}
+func (s Shape) Optimize(r shape.Optimizer) (shape.Shape, bool) {
+	if shape.IsNull(s.From) {
+		return nil, true
+	}
+	var opt bool
+	s.From, opt = s.From.Optimize(r)
+	if r != nil {
+		ns, nopt := r.OptimizeShape(s)
+		return ns, opt || nopt
+	}
+	if shape.IsNull(s.From) {
+		return nil, true
+	}
+	return s, opt
+}
+
+var _ graph.Iterator = &Iterator{}
+
+// Iterator returns results of a materialized view for each node of the subiterator.
+// It is an equivalent of the HasA-LinksTo chain that the view replaces.
+type Iterator struct {
+	uid      uint64
+	tags     graph.Tagger
+	view     *View
+	primary  graph.Iterator
+	buf      []graph.Value
+	result   graph.Value
+	runstats graph.IteratorStats
+	err      error
+}
+
+// NewIterator creates an iterator that returns view results for source nodes of a given iterator.
+func NewIterator(v *View, from graph.Iterator) *Iterator {
+	return &Iterator{
+		uid:     iterator.NextUID(),
+		view:    v,
+		primary: from,
+	}
+}
+
+func (it *Iterator) UID() uint64 {
+	return it.uid
+}
+
+func (it *Iterator) SubIterators() []graph.Iterator {
+	return []graph.Iterator{it.primary}
+}
+
+func (it *Iterator) Reset() {
+	it.primary.Reset()
+	it.buf = nil
+	it.result = nil
+	it.err = nil
+}
+
+func (it *Iterator) Tagger() *graph.Tagger {
+	return &it.tags
+}
+
+func (it *Iterator) Clone() graph.Iterator {
+	out := NewIterator(it.view, it.primary.Clone())
+	out.tags.CopyFrom(it)
+	return out
+}
+
+func (it *Iterator) Optimize() (graph.Iterator, bool) {
+	newPrimary, changed := it.primary.Optimize()
+	if changed {
+		it.primary = newPrimary
+		if it.primary.Type() == graph.Null {
+			return it.primary, true
+		}
+	}
+	return it, false
+}
+
+func (it *Iterator) TagResults(dst map[string]graph.Value) {
+	it.tags.TagResult(dst, it.Result())
+	it.primary.TagResults(dst)
+}
+
+func (it *Iterator) String() string {
+	return fmt.Sprintf("View(%q)", it.view.Name())
+}
+
+func (it *Iterator) Next(ctx context.Context) bool {
+	graph.NextLogIn(it)
+	it.runstats.Next += 1
+	for len(it.buf) == 0 {
+		if !it.primary.Next(ctx) {
+			it.err = it.primary.Err()
+			return graph.NextLogOut(it, false)
+		}
+		it.buf = it.view.results(it.primary.Result())
+	}
+	it.result, it.buf = it.buf[0], it.buf[1:]
+	return graph.NextLogOut(it, true)
+}
+
+func (it *Iterator) Contains(ctx context.Context, val graph.Value) bool {
+	graph.ContainsLogIn(it, val)
+	it.runstats.Contains += 1
+	it.buf = nil
+	for _, src := range it.view.sources(val) {
+		if it.primary.Contains(ctx, src) {
+			it.result = val
+			return graph.ContainsLogOut(it, val, true)
+		}
+	}
+	it.err = it.primary.Err()
+	return graph.ContainsLogOut(it, val, false)
+}
+
+func (it *Iterator) NextPath(ctx context.Context) bool {
+	if it.primary.NextPath(ctx) {
+		return true
+	}
+	it.err = it.primary.Err()
+	return false
+}
+
+func (it *Iterator) Err() error {
+	return it.err
+}
+
+func (it *Iterator) Result() graph.Value {
+	return it.result
+}
+
+// Stats estimates the size of results using an average number of results per source node in the view.
+func (it *Iterator) Stats() graph.IteratorStats {
+	st := it.primary.Stats()
+	fanout := int64(1)
+	if n := int64(it.view.Sources()); n != 0 {
+		fanout = (it.view.Size() + n - 1) / n
+	}
+	return graph.IteratorStats{
+		NextCost:     st.NextCost + 1,
+		ContainsCost: fanout * st.ContainsCost,
+		Size:         fanout * st.Size,
+		ExactSize:    false,
+		Next:         it.runstats.Next,
+		Contains:     it.runstats.Contains,
+	}
+}
+
+func (it *Iterator) Size() (int64, bool) {
+	st := it.Stats()
+	return st.Size, st.ExactSize
+}
+
+func (it *Iterator) Type() graph.Type { return graph.View }
+
+func (it *Iterator) Close() error {
+	return it.primary.Close()
+}
@@ -0,0 +1,126 @@
+// Copyright 2017 The Cayley Authors. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package view
+
+import (
+	"github.com/cayleygraph/cayley/graph"
+	"github.com/cayleygraph/cayley/graph/iterator"
+	"github.com/cayleygraph/cayley/graph/shape"
+	"github.com/cayleygraph/cayley/quad"
+)
+
+// placeholder marks the start of the view path when it's converted to a shape.
+type placeholder struct{}
+
+func (placeholder) BuildIterator(qs graph.QuadStore) graph.Iterator {
+	return iterator.NewNull()
+}
+func (s placeholder) Optimize(r shape.Optimizer) (shape.Shape, bool) {
+	return s, false
+}
+
+// decodeStep checks if the shape is a single Out or In step, as built by the path package.
+// It returns the step and the shape it starts from.
+func decodeStep(s shape.Shape) (step, shape.Shape, bool) {
+	nf, ok := s.(shape.NodesFrom)
+	if !ok {
+		return step{}, nil, false
+	}
+	q, ok := nf.Quads.(shape.Quads)
+	if !ok {
+		return step{}, nil, false
+	}
+	var st step
+	start := quad.Subject
+	switch nf.Dir {
+	case quad.Object:
+	case quad.Subject:
+		st.reverse = true
+		start = quad.Object
+	default:
+		return step{}, nil, false
+	}
+	var from shape.Shape = shape.AllNodes{}
+	for i, f := range q {
+		switch {
+		case i == 0 && f.Dir == start:
+			from = f.Values
+		case f.Dir == quad.Predicate && st.via == nil:
+			l, ok := f.Values.(shape.Lookup)
+			if !ok || len(l) == 0 {
+				return step{}, nil, false
+			}
+			st.via = []quad.Value(l)
+		default:
+			return step{}, nil, false
+		}
+	}
+	return st, from, true
+}
+
+// decodeSteps decodes up to n steps from the shape, starting from the last one. Negative n means no limit.
+// Steps are returned in the path order along with the shape the path starts from.
+func decodeSteps(s shape.Shape, n int) ([]step, shape.Shape, bool) {
+	var steps []step
+	for n < 0 || len(steps) < n {
+		st, from, ok := decodeStep(s)
+		if !ok {
+			break
+		}
+		steps = append(steps, st)
+		s = from
+		if _, ok = s.(shape.AllNodes); ok {
+			break
+		}
+	}
+	if len(steps) == 0 {
+		return nil, nil, false
+	}
+	for i, j := 0, len(steps)-1; i < j; i, j = i+1, j-1 {
+		steps[i], steps[j] = steps[j], steps[i]
+	}
+	return steps, s, true
+}
+
+func sameValues(a, b []quad.Value) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	set := make(map[string]struct{}, len(a))
+	for _, v := range a {
+		set[quad.StringOf(v)] = struct{}{}
+	}
+	for _, v := range b {
+		if _, ok := set[quad.StringOf(v)]; !ok {
+			return false
+		}
+	}
+	return true
+}
+
+// match checks if the shape ends with the same steps as the view. It returns the shape the steps start from.
+func (v *View) match(s shape.Shape) (shape.Shape, bool) {
+	steps, from, ok := decodeSteps(s, len(v.steps))
+	if !ok || len(steps) != len(v.steps) {
+		return nil, false
+	}
+	for i, st := range steps {
+		vs := v.steps[i]
+		if st.reverse != vs.reverse || !sameValues(st.via, vs.via) {
+			return nil, false
+		}
+	}
+	return from, true
+}
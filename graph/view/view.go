@@ -0,0 +1,399 @@
+// Copyright 2017 The Cayley Authors. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package view implements materialized views: named path expressions with precomputed results.
+//
+// Views are kept up to date on each write and are substituted into matching queries by the shape optimizer.
+package view
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"sync"
+
+	"github.com/cayleygraph/cayley/clog"
+	"github.com/cayleygraph/cayley/graph"
+	"github.com/cayleygraph/cayley/graph/path"
+	"github.com/cayleygraph/cayley/graph/shape"
+	"github.com/cayleygraph/cayley/quad"
+)
+
+var (
+	_ graph.QuadStore = (*QuadStore)(nil)
+	_ shape.Rewriter  = (*QuadStore)(nil)
+	_ shape.Optimizer = (*QuadStore)(nil)
+)
+
+// QuadStore wraps a quad store and maintains a set of materialized views on top of it.
+//
+// All writes must go through the wrapper, otherwise views will become stale.
+// Optional interfaces implemented by the underlying store are not exposed by the wrapper,
+// except for shape.Optimizer.
+type QuadStore struct {
+	graph.QuadStore
+
+	mu    sync.RWMutex
+	views map[string]*View
+}
+
+// New wraps a quad store to support materialized views.
+func New(qs graph.QuadStore) *QuadStore {
+	return &QuadStore{QuadStore: qs, views: make(map[string]*View)}
+}
+
+// Register adds a named view for a given path morphism and materializes its results.
+//
+// Only paths that consist of Out and In steps are supported, for example:
+//
+//	path.StartMorphism().Out(quad.IRI("follows")).Out(quad.IRI("follows")).In(quad.IRI("likes"))
+//
+// Queries that contain the same sequence of steps will read results from the view instead.
+// Registering a view with an existing name replaces it.
+func (qs *QuadStore) Register(name string, p *path.Path) error {
+	if !p.IsMorphism() {
+		return fmt.Errorf("view %q: expected a path morphism", name)
+	}
+	steps, from, ok := decodeSteps(p.ShapeFrom(placeholder{}), -1)
+	if !ok || len(steps) == 0 {
+		return fmt.Errorf("view %q: only Out and In steps are supported", name)
+	} else if _, ok = from.(placeholder); !ok {
+		return fmt.Errorf("view %q: path must not start from specific nodes", name)
+	}
+	v := newView(name, steps)
+	qs.mu.Lock()
+	defer qs.mu.Unlock()
+	if err := v.build(qs.QuadStore); err != nil {
+		return fmt.Errorf("view %q: %v", name, err)
+	}
+	qs.views[name] = v
+	clog.Info(context.TODO(), "materialized view", clog.F("view", name), clog.F("sources", v.Sources()))
+	return nil
+}
+
+// Unregister removes a named view. Queries will no longer use it.
+func (qs *QuadStore) Unregister(name string) {
+	qs.mu.Lock()
+	delete(qs.views, name)
+	qs.mu.Unlock()
+}
+
+// View returns a registered view by name, or nil if it does not exist.
+func (qs *QuadStore) View(name string) *View {
+	qs.mu.RLock()
+	defer qs.mu.RUnlock()
+	return qs.views[name]
+}
+
+// Views returns names of all registered views.
+func (qs *QuadStore) Views() []string {
+	qs.mu.RLock()
+	names := make([]string, 0, len(qs.views))
+	for name := range qs.views {
+		names = append(names, name)
+	}
+	qs.mu.RUnlock()
+	sort.Strings(names)
+	return names
+}
+
+// listViews returns registered views, longest first, so that the most specific view is tried first.
+func (qs *QuadStore) listViews() []*View {
+	qs.mu.RLock()
+	list := make([]*View, 0, len(qs.views))
+	for _, v := range qs.views {
+		list = append(list, v)
+	}
+	qs.mu.RUnlock()
+	sort.Slice(list, func(i, j int) bool {
+		if li, lj := len(list[i].steps), len(list[j].steps); li != lj {
+			return li > lj
+		}
+		return list[i].name < list[j].name
+	})
+	return list
+}
+
+// ApplyDeltas applies deltas to the underlying store and updates results of affected sources in all views.
+func (qs *QuadStore) ApplyDeltas(in []graph.Delta, opts graph.IgnoreOpts) error {
+	qs.mu.Lock()
+	defer qs.mu.Unlock()
+	if len(qs.views) == 0 {
+		return qs.QuadStore.ApplyDeltas(in, opts)
+	}
+	// removed quads are only reachable before the write, added ones - after it
+	affected := make(map[*View]map[interface{}]graph.Value, len(qs.views))
+	for _, v := range qs.views {
+		affected[v] = make(map[interface{}]graph.Value)
+		if err := v.affected(qs.QuadStore, in, graph.Delete, affected[v]); err != nil {
+			return err
+		}
+	}
+	err := qs.QuadStore.ApplyDeltas(in, opts)
+	// the write might be partially applied, so refresh sources in any case
+	for v, srcs := range affected {
+		if err2 := v.affected(qs.QuadStore, in, graph.Add, srcs); err2 != nil && err == nil {
+			err = err2
+		}
+		if err2 := v.refresh(qs.QuadStore, srcs); err2 != nil && err == nil {
+			err = err2
+		}
+	}
+	return err
+}
+
+// RewriteShape implements shape.Rewriter. It replaces sequences of steps that match registered views.
+func (qs *QuadStore) RewriteShape(s shape.Shape) (shape.Shape, bool) {
+	if _, ok := s.(shape.NodesFrom); !ok {
+		return s, false
+	}
+	for _, v := range qs.listViews() {
+		if from, ok := v.match(s); ok {
+			return Shape{View: v, From: from}, true
+		}
+	}
+	return s, false
+}
+
+// OptimizeShape implements shape.Optimizer by passing shapes to the underlying store.
+func (qs *QuadStore) OptimizeShape(s shape.Shape) (shape.Shape, bool) {
+	if o, ok := qs.QuadStore.(shape.Optimizer); ok {
+		return o.OptimizeShape(s)
+	}
+	return s, false
+}
+
+// step is a single Out or In hop of the view path.
+type step struct {
+	via     []quad.Value // empty means any predicate
+	reverse bool
+}
+
+func (s step) hasPredicate(p quad.Value) bool {
+	if len(s.via) == 0 {
+		return true
+	}
+	for _, v := range s.via {
+		if quad.StringOf(v) == quad.StringOf(p) {
+			return true
+		}
+	}
+	return false
+}
+
+func (s step) viaArg() interface{} {
+	if len(s.via) == 0 {
+		return nil
+	}
+	return s.via
+}
+
+func (s step) apply(p *path.Path, rev bool) *path.Path {
+	if s.reverse != rev {
+		return p.In(s.viaArg())
+	}
+	return p.Out(s.viaArg())
+}
+
+// View is a materialized path expression. It stores a set of result nodes for each source node.
+type View struct {
+	name  string
+	steps []step
+
+	mu  sync.RWMutex
+	src map[interface{}]graph.Value
+	fwd map[interface{}][]graph.Value // source -> results
+	rev map[interface{}][]graph.Value // result -> sources
+}
+
+func newView(name string, steps []step) *View {
+	return &View{
+		name: name, steps: steps,
+		src: make(map[interface{}]graph.Value),
+		fwd: make(map[interface{}][]graph.Value),
+		rev: make(map[interface{}][]graph.Value),
+	}
+}
+
+// Name returns the name of the view.
+func (v *View) Name() string { return v.name }
+
+// Sources returns the number of source nodes with non-empty results.
+func (v *View) Sources() int {
+	v.mu.RLock()
+	defer v.mu.RUnlock()
+	return len(v.fwd)
+}
+
+// Size returns the total number of source-result pairs in the view.
+func (v *View) Size() int64 {
+	v.mu.RLock()
+	defer v.mu.RUnlock()
+	var n int64
+	for _, dst := range v.fwd {
+		n += int64(len(dst))
+	}
+	return n
+}
+
+// results returns a copy of results for a given source node.
+func (v *View) results(src graph.Value) []graph.Value {
+	v.mu.RLock()
+	defer v.mu.RUnlock()
+	return append([]graph.Value(nil), v.fwd[graph.ToKey(src)]...)
+}
+
+// sources returns a copy of source nodes that have a given node in their results.
+func (v *View) sources(dst graph.Value) []graph.Value {
+	v.mu.RLock()
+	defer v.mu.RUnlock()
+	return append([]graph.Value(nil), v.rev[graph.ToKey(dst)]...)
+}
+
+// allSources returns a copy of all source nodes.
+func (v *View) allSources() []graph.Value {
+	v.mu.RLock()
+	defer v.mu.RUnlock()
+	out := make([]graph.Value, 0, len(v.src))
+	for _, s := range v.src {
+		out = append(out, s)
+	}
+	return out
+}
+
+const (
+	tagSource = "src"
+	tagResult = "dst"
+)
+
+// path returns a path that follows all steps of the view.
+func (v *View) path(p *path.Path) *path.Path {
+	for _, s := range v.steps {
+		p = s.apply(p, false)
+	}
+	return p
+}
+
+// build materializes the view from scratch.
+func (v *View) build(qs graph.QuadStore) error {
+	p := v.path(path.StartPath(qs).Tag(tagSource)).Tag(tagResult)
+	seen := make(map[[2]interface{}]struct{})
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	return p.Iterate(context.TODO()).TagEach(func(m map[string]graph.Value) {
+		src, dst := m[tagSource], m[tagResult]
+		if src == nil || dst == nil {
+			return
+		}
+		k := [2]interface{}{graph.ToKey(src), graph.ToKey(dst)}
+		if _, ok := seen[k]; ok {
+			return
+		}
+		seen[k] = struct{}{}
+		v.add(src, dst)
+	})
+}
+
+func (v *View) add(src, dst graph.Value) {
+	sk, dk := graph.ToKey(src), graph.ToKey(dst)
+	v.src[sk] = src
+	v.fwd[sk] = append(v.fwd[sk], dst)
+	v.rev[dk] = append(v.rev[dk], src)
+}
+
+// remove drops all results of a given source.
+func (v *View) remove(sk interface{}) {
+	for _, dst := range v.fwd[sk] {
+		dk := graph.ToKey(dst)
+		arr := v.rev[dk]
+		for i, s := range arr {
+			if graph.ToKey(s) == sk {
+				arr = append(arr[:i], arr[i+1:]...)
+				break
+			}
+		}
+		if len(arr) == 0 {
+			delete(v.rev, dk)
+		} else {
+			v.rev[dk] = arr
+		}
+	}
+	delete(v.fwd, sk)
+	delete(v.src, sk)
+}
+
+// affected collects source nodes with results that may be changed by deltas with a given action.
+//
+// A quad that matches n-th step of the view can only affect sources that reach its node by following first n steps,
+// thus sources are found by following these steps in reverse.
+func (v *View) affected(qs graph.QuadStore, in []graph.Delta, act graph.Procedure, dst map[interface{}]graph.Value) error {
+	for _, d := range in {
+		if d.Action != act {
+			continue
+		}
+		for i, s := range v.steps {
+			if !s.hasPredicate(d.Quad.Predicate) {
+				continue
+			}
+			node := d.Quad.Subject
+			if s.reverse {
+				node = d.Quad.Object
+			}
+			p := path.StartPath(qs, node)
+			for j := i - 1; j >= 0; j-- {
+				p = v.steps[j].apply(p, true)
+			}
+			err := p.Iterate(context.TODO()).Each(func(src graph.Value) {
+				dst[graph.ToKey(src)] = src
+			})
+			if err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// refresh recomputes results for a given set of source nodes.
+func (v *View) refresh(qs graph.QuadStore, srcs map[interface{}]graph.Value) error {
+	if len(srcs) == 0 {
+		return nil
+	}
+	res := make(map[interface{}][]graph.Value, len(srcs))
+	for sk, src := range srcs {
+		seen := make(map[interface{}]struct{})
+		var list []graph.Value
+		err := v.path(path.StartPathNodes(qs, src)).Iterate(context.TODO()).Each(func(dst graph.Value) {
+			dk := graph.ToKey(dst)
+			if _, ok := seen[dk]; ok {
+				return
+			}
+			seen[dk] = struct{}{}
+			list = append(list, dst)
+		})
+		if err != nil {
+			return err
+		}
+		res[sk] = list
+	}
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	for sk, list := range res {
+		v.remove(sk)
+		for _, dst := range list {
+			v.add(srcs[sk], dst)
+		}
+	}
+	return nil
+}
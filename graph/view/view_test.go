@@ -0,0 +1,116 @@
+// Copyright 2017 The Cayley Authors. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package view_test
+
+import (
+	"testing"
+
+	"github.com/cayleygraph/cayley/graph"
+	"github.com/cayleygraph/cayley/graph/graphtest/testutil"
+	"github.com/cayleygraph/cayley/graph/memstore"
+	"github.com/cayleygraph/cayley/graph/path"
+	"github.com/cayleygraph/cayley/graph/shape"
+	"github.com/cayleygraph/cayley/graph/view"
+	"github.com/cayleygraph/cayley/quad"
+	"github.com/stretchr/testify/require"
+)
+
+var (
+	follows = quad.IRI("follows")
+	likes   = quad.IRI("likes")
+)
+
+func edge(s, p, o string) quad.Quad {
+	return quad.MakeIRI(s, p, o, "")
+}
+
+func usesView(qs graph.QuadStore, p *path.Path) bool {
+	s, _ := shape.Optimize(p.Shape(), qs)
+	found := false
+	shape.Walk(s, func(s shape.Shape) bool {
+		if _, ok := s.(view.Shape); ok {
+			found = true
+		}
+		return !found
+	})
+	return found
+}
+
+func TestViews(t *testing.T) {
+	mem := memstore.New(
+		edge("alice", "follows", "bob"),
+		edge("bob", "follows", "carol"),
+		edge("bob", "follows", "dave"),
+		edge("carol", "likes", "cats"),
+		edge("dave", "likes", "dogs"),
+		edge("erin", "likes", "cats"),
+	)
+	qs := view.New(mem)
+
+	err := qs.Register("bad", path.StartMorphism().Out(follows).Tag("x"))
+	require.NotNil(t, err)
+
+	fof := path.StartMorphism().Out(follows).Out(follows).Out(likes)
+	require.NoError(t, qs.Register("fof-likes", fof))
+	require.Equal(t, []string{"fof-likes"}, qs.Views())
+	require.Equal(t, 1, qs.View("fof-likes").Sources())
+
+	check := func(p func(qs graph.QuadStore) *path.Path, exp []string) {
+		vp := p(qs)
+		require.True(t, usesView(qs, vp), "view is not used")
+		require.Equal(t, exp, testutil.Collect(t, vp))
+		require.Equal(t, exp, testutil.Collect(t, p(mem)), "results differ from the underlying store")
+	}
+	fromAlice := func(qs graph.QuadStore) *path.Path {
+		return path.StartPath(qs, quad.IRI("alice")).Follow(fof)
+	}
+	check(fromAlice, []string{"<cats>", "<dogs>"})
+	check(func(qs graph.QuadStore) *path.Path {
+		return path.StartPath(qs).Out(follows).Out(follows).Out(likes)
+	}, []string{"<cats>", "<dogs>"})
+	check(func(qs graph.QuadStore) *path.Path {
+		return path.StartPath(qs, quad.IRI("alice")).Out(follows).Out(follows).Out(likes).Is(quad.IRI("dogs"))
+	}, []string{"<dogs>"})
+	check(func(qs graph.QuadStore) *path.Path {
+		return path.StartPath(qs, quad.IRI("alice")).Out(follows).Out(follows).Out(likes).In(likes)
+	}, []string{"<carol>", "<dave>", "<erin>"})
+
+	p := path.StartPath(qs, quad.IRI("alice")).Out(follows).Out(likes)
+	require.False(t, usesView(qs, p))
+
+	// write through the wrapper: views must be updated incrementally
+	err = qs.ApplyDeltas([]graph.Delta{
+		{Quad: edge("bob", "follows", "dave"), Action: graph.Delete},
+		{Quad: edge("alice", "follows", "frank"), Action: graph.Add},
+		{Quad: edge("frank", "follows", "erin"), Action: graph.Add},
+		{Quad: edge("zoe", "follows", "frank"), Action: graph.Add},
+	}, graph.IgnoreOpts{})
+	require.NoError(t, err)
+	check(fromAlice, []string{"<cats>"})
+	check(func(qs graph.QuadStore) *path.Path {
+		return path.StartPath(qs, quad.IRI("zoe")).Follow(fof)
+	}, []string{"<cats>"})
+	require.Equal(t, 2, qs.View("fof-likes").Sources())
+
+	err = qs.ApplyDeltas([]graph.Delta{
+		{Quad: edge("erin", "likes", "cats"), Action: graph.Delete},
+		{Quad: edge("erin", "likes", "birds"), Action: graph.Add},
+	}, graph.IgnoreOpts{})
+	require.NoError(t, err)
+	check(fromAlice, []string{"<birds>", "<cats>"})
+
+	qs.Unregister("fof-likes")
+	require.False(t, usesView(qs, fromAlice(qs)))
+}
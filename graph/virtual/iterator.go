@@ -0,0 +1,279 @@
+// Copyright 2017 The Cayley Authors. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package virtual
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/cayleygraph/cayley/graph"
+	"github.com/cayleygraph/cayley/graph/iterator"
+	"github.com/cayleygraph/cayley/quad"
+)
+
+var _ graph.Iterator = &Iterator{}
+
+// Iterator returns virtual quads with a given value in a given direction, or all virtual quads
+// if the direction is quad.Any. Quads are computed on the first call to Next.
+//
+// If nodes is set, the iterator returns all nodes of virtual quads that are not in the underlying store.
+type Iterator struct {
+	uid   uint64
+	tags  graph.Tagger
+	qs    *QuadStore
+	preds map[quad.Value]Predicate
+	dir   quad.Direction
+	val   quad.Value
+	nodes bool
+
+	done    bool
+	results []graph.Value
+	index   int
+
+	result graph.Value
+	err    error
+}
+
+func newIterator(qs *QuadStore, preds map[quad.Value]Predicate, d quad.Direction, v quad.Value, nodes bool) *Iterator {
+	return &Iterator{
+		uid:   iterator.NextUID(),
+		qs:    qs,
+		preds: preds,
+		dir:   d,
+		val:   v,
+		nodes: nodes,
+	}
+}
+
+// compute runs functions of virtual predicates for all subjects that can produce matching quads.
+func (it *Iterator) compute(ctx context.Context) error {
+	base := it.qs.QuadStore
+	var quads []quad.Quad
+	add := func(name quad.Value, p Predicate, s quad.Value) error {
+		objs, err := p.Func(ctx, base, s)
+		if err != nil {
+			return fmt.Errorf("virtual predicate %v: %v", name, err)
+		}
+		for _, o := range objs {
+			q := quad.Quad{Subject: s, Predicate: name, Object: o}
+			if it.dir != quad.Object || o == it.val {
+				quads = append(quads, q)
+			}
+		}
+		return nil
+	}
+	for name, p := range it.preds {
+		if it.dir == quad.Predicate && name != it.val {
+			continue
+		}
+		if it.dir == quad.Subject {
+			if err := add(name, p, it.val); err != nil {
+				return err
+			}
+			continue
+		}
+		subs, err := subjects(ctx, base, p.Sources)
+		if err != nil {
+			return err
+		}
+		for _, s := range subs {
+			if err = ctx.Err(); err != nil {
+				return err
+			}
+			if err = add(name, p, s); err != nil {
+				return err
+			}
+		}
+	}
+	if !it.nodes {
+		for _, q := range quads {
+			it.results = append(it.results, quadValue{q})
+		}
+		return nil
+	}
+	seen := make(map[quad.Value]struct{})
+	for _, q := range quads {
+		for _, v := range []quad.Value{q.Predicate, q.Object} {
+			if _, ok := seen[v]; ok {
+				continue
+			}
+			seen[v] = struct{}{}
+			if base.ValueOf(v) == nil {
+				it.results = append(it.results, graph.PreFetched(v))
+			}
+		}
+	}
+	return nil
+}
+
+func (it *Iterator) UID() uint64 {
+	return it.uid
+}
+
+func (it *Iterator) SubIterators() []graph.Iterator {
+	return nil
+}
+
+func (it *Iterator) Reset() {
+	it.index = 0
+	it.result = nil
+	if it.err != nil {
+		it.done, it.results, it.err = false, nil, nil
+	}
+}
+
+func (it *Iterator) Tagger() *graph.Tagger {
+	return &it.tags
+}
+
+func (it *Iterator) Clone() graph.Iterator {
+	out := newIterator(it.qs, it.preds, it.dir, it.val, it.nodes)
+	out.tags.CopyFrom(it)
+	return out
+}
+
+func (it *Iterator) Optimize() (graph.Iterator, bool) {
+	return it, false
+}
+
+func (it *Iterator) TagResults(dst map[string]graph.Value) {
+	it.tags.TagResult(dst, it.Result())
+}
+
+func (it *Iterator) String() string {
+	if it.nodes {
+		return "VirtualNodes()"
+	}
+	return fmt.Sprintf("Virtual(%v, %v)", it.dir, it.val)
+}
+
+func (it *Iterator) Next(ctx context.Context) bool {
+	graph.NextLogIn(it)
+	if !it.done {
+		it.done = true
+		it.err = it.compute(ctx)
+	}
+	if it.err != nil || it.index >= len(it.results) {
+		it.result = nil
+		return graph.NextLogOut(it, false)
+	}
+	it.result = it.results[it.index]
+	it.index++
+	return graph.NextLogOut(it, true)
+}
+
+// Contains checks a virtual quad by calling the function of its predicate for the subject of the quad.
+func (it *Iterator) Contains(ctx context.Context, v graph.Value) bool {
+	graph.ContainsLogIn(it, v)
+	ok := false
+	if it.nodes {
+		if fv, isNode := v.(graph.PreFetchedValue); isNode {
+			ok = it.containsNode(ctx, fv)
+		}
+	} else if qv, isQuad := v.(quadValue); isQuad {
+		ok = it.containsQuad(ctx, qv.q)
+	}
+	if ok {
+		it.result = v
+	}
+	return graph.ContainsLogOut(it, v, ok)
+}
+
+func (it *Iterator) containsQuad(ctx context.Context, q quad.Quad) bool {
+	if q.Label != nil || (it.dir != quad.Any && q.Get(it.dir) != it.val) {
+		return false
+	}
+	p, ok := it.preds[q.Predicate]
+	if !ok {
+		return false
+	}
+	objs, err := p.Func(ctx, it.qs.QuadStore, q.Subject)
+	if err != nil {
+		it.err = fmt.Errorf("virtual predicate %v: %v", q.Predicate, err)
+		return false
+	}
+	for _, o := range objs {
+		if o == q.Object {
+			return true
+		}
+	}
+	return false
+}
+
+func (it *Iterator) containsNode(ctx context.Context, v graph.PreFetchedValue) bool {
+	if !it.done {
+		it.done = true
+		it.err = it.compute(ctx)
+	}
+	k := graph.ToKey(v)
+	for _, r := range it.results {
+		if graph.ToKey(r) == k {
+			return true
+		}
+	}
+	return false
+}
+
+func (it *Iterator) NextPath(ctx context.Context) bool {
+	return false
+}
+
+func (it *Iterator) Err() error {
+	return it.err
+}
+
+func (it *Iterator) Result() graph.Value {
+	return it.result
+}
+
+// Stats estimates the number of virtual quads as the number of virtual predicates, until quads are computed.
+func (it *Iterator) Stats() graph.IteratorStats {
+	size, exact := int64(len(it.preds)), false
+	if it.done {
+		size, exact = int64(len(it.results)), true
+	}
+	return graph.IteratorStats{
+		NextCost:     1,
+		ContainsCost: 10,
+		Size:         size,
+		ExactSize:    exact,
+	}
+}
+
+func (it *Iterator) Size() (int64, bool) {
+	st := it.Stats()
+	return st.Size, st.ExactSize
+}
+
+func (it *Iterator) Type() graph.Type { return graph.Virtual }
+
+func (it *Iterator) Close() error {
+	return nil
+}
+
+// allIterator marks a union of all nodes or quads of the store, so optimizers can treat it as such.
+type allIterator struct {
+	graph.Iterator
+}
+
+func (it allIterator) Type() graph.Type { return graph.All }
+
+func (it allIterator) Clone() graph.Iterator {
+	return allIterator{it.Iterator.Clone()}
+}
+
+func (it allIterator) Optimize() (graph.Iterator, bool) {
+	return it, false
+}
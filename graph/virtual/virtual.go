@@ -0,0 +1,322 @@
+// Copyright 2017 The Cayley Authors. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package virtual implements virtual predicates: quads that are not stored, but computed on demand
+// from other quads of the graph by a Go callback.
+//
+// For example, an age of a person can be computed from a birth date:
+//
+//	qs := virtual.New(base)
+//	qs.Register(quad.IRI("ex:age"), virtual.Predicate{
+//		Sources: []quad.Value{quad.IRI("ex:birthDate")},
+//		Func:    computeAge,
+//	})
+//
+// Virtual quads are merged into results of all iterators of the store, thus they can be used
+// in paths and shapes as any other quad.
+package virtual
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"sync"
+
+	"github.com/cayleygraph/cayley/graph"
+	"github.com/cayleygraph/cayley/graph/iterator"
+	"github.com/cayleygraph/cayley/quad"
+)
+
+var (
+	_ graph.QuadStore        = (*QuadStore)(nil)
+	_ graph.ContextQuadStore = (*QuadStore)(nil)
+)
+
+// ErrVirtualQuad is returned when writing a quad with a virtual predicate.
+var ErrVirtualQuad = errors.New("quads with virtual predicates cannot be written")
+
+// Func computes objects of a virtual predicate for a given subject.
+// The store passed to the function is the underlying store, thus it cannot see virtual quads.
+//
+// Func should return no values for subjects that have no quads with source predicates.
+type Func func(ctx context.Context, qs graph.QuadStore, subject quad.Value) ([]quad.Value, error)
+
+// Predicate describes how quads of a virtual predicate are computed.
+type Predicate struct {
+	// Sources are predicates the virtual predicate is computed from.
+	// Func is only called for subjects of quads with these predicates when the store is scanned.
+	Sources []quad.Value
+	// Func computes objects of the virtual predicate.
+	Func Func
+}
+
+// QuadStore wraps a quad store and adds quads of registered virtual predicates to it.
+//
+// Virtual quads have no label and are never stored. Values of the underlying store can be passed
+// to the wrapper, but values of virtual quads and of nodes that exist only in virtual quads can not be
+// passed to the underlying store. Optional interfaces implemented by the underlying store are not exposed.
+type QuadStore struct {
+	graph.QuadStore
+
+	mu    sync.RWMutex
+	preds map[quad.Value]Predicate
+}
+
+// New wraps a quad store to support virtual predicates.
+func New(qs graph.QuadStore) *QuadStore {
+	return &QuadStore{QuadStore: qs, preds: make(map[quad.Value]Predicate)}
+}
+
+// Register adds a virtual predicate with a given name. Registering an existing name replaces it.
+func (qs *QuadStore) Register(name quad.Value, p Predicate) error {
+	if name == nil {
+		return errors.New("virtual predicate: name is not set")
+	} else if p.Func == nil {
+		return fmt.Errorf("virtual predicate %v: function is not set", name)
+	} else if len(p.Sources) == 0 {
+		return fmt.Errorf("virtual predicate %v: at least one source predicate is required", name)
+	}
+	qs.mu.Lock()
+	qs.preds[name] = p
+	qs.mu.Unlock()
+	return nil
+}
+
+// Unregister removes a virtual predicate.
+func (qs *QuadStore) Unregister(name quad.Value) {
+	qs.mu.Lock()
+	delete(qs.preds, name)
+	qs.mu.Unlock()
+}
+
+// Predicates returns names of all virtual predicates.
+func (qs *QuadStore) Predicates() []quad.Value {
+	qs.mu.RLock()
+	names := make([]quad.Value, 0, len(qs.preds))
+	for name := range qs.preds {
+		names = append(names, name)
+	}
+	qs.mu.RUnlock()
+	sort.Slice(names, func(i, j int) bool {
+		return quad.StringOf(names[i]) < quad.StringOf(names[j])
+	})
+	return names
+}
+
+// predicates returns a snapshot of registered virtual predicates.
+func (qs *QuadStore) predicates() map[quad.Value]Predicate {
+	qs.mu.RLock()
+	defer qs.mu.RUnlock()
+	if len(qs.preds) == 0 {
+		return nil
+	}
+	out := make(map[quad.Value]Predicate, len(qs.preds))
+	for name, p := range qs.preds {
+		out[name] = p
+	}
+	return out
+}
+
+// quadValue is a reference to a virtual quad.
+type quadValue struct {
+	q quad.Quad
+}
+
+// quadKey distinguishes keys of virtual quads from keys of the underlying store.
+type quadKey string
+
+func (v quadValue) Key() interface{} { return quadKey(v.q.String()) }
+
+// node returns a reference to a node of the underlying store, or a virtual node if it does not exist there.
+func (qs *QuadStore) node(v quad.Value) graph.Value {
+	if v == nil {
+		return nil
+	}
+	if ref := qs.QuadStore.ValueOf(v); ref != nil {
+		return ref
+	}
+	return graph.PreFetched(v)
+}
+
+// ApplyDeltas writes deltas to the underlying store. It fails if any delta has a virtual predicate.
+func (qs *QuadStore) ApplyDeltas(in []graph.Delta, opts graph.IgnoreOpts) error {
+	preds := qs.predicates()
+	for _, d := range in {
+		if _, ok := preds[d.Quad.Predicate]; ok {
+			return &graph.DeltaError{Delta: d, Err: ErrVirtualQuad}
+		}
+	}
+	return qs.QuadStore.ApplyDeltas(in, opts)
+}
+
+func (qs *QuadStore) Quad(v graph.Value) quad.Quad {
+	if v, ok := v.(quadValue); ok {
+		return v.q
+	}
+	return qs.QuadStore.Quad(v)
+}
+
+func (qs *QuadStore) QuadContext(ctx context.Context, v graph.Value) (quad.Quad, error) {
+	if v, ok := v.(quadValue); ok {
+		return v.q, nil
+	}
+	return graph.QuadOf(ctx, qs.QuadStore, v)
+}
+
+func (qs *QuadStore) QuadDirection(v graph.Value, d quad.Direction) graph.Value {
+	if v, ok := v.(quadValue); ok {
+		return qs.node(v.q.Get(d))
+	}
+	return qs.QuadStore.QuadDirection(v, d)
+}
+
+// ValueOf returns a reference to a node of the underlying store. If the node does not exist there and
+// at least one virtual predicate is registered, it returns a virtual node, since virtual quads can
+// refer to any value. Iterators for such nodes are empty if no virtual quads refer to them.
+func (qs *QuadStore) ValueOf(v quad.Value) graph.Value {
+	if v == nil {
+		return nil
+	}
+	return qs.orVirtual(v, qs.QuadStore.ValueOf(v))
+}
+
+func (qs *QuadStore) ValueOfContext(ctx context.Context, v quad.Value) (graph.Value, error) {
+	if v == nil {
+		return nil, nil
+	}
+	ref, err := graph.ValueOf(ctx, qs.QuadStore, v)
+	if err != nil {
+		return nil, err
+	}
+	return qs.orVirtual(v, ref), nil
+}
+
+// orVirtual returns a reference of the underlying store, if it is set, or a virtual node for a given value.
+func (qs *QuadStore) orVirtual(v quad.Value, ref graph.Value) graph.Value {
+	if ref != nil {
+		return ref
+	}
+	qs.mu.RLock()
+	n := len(qs.preds)
+	qs.mu.RUnlock()
+	if n == 0 {
+		return nil
+	}
+	return graph.PreFetched(v)
+}
+
+func (qs *QuadStore) NameOf(v graph.Value) quad.Value {
+	switch v := v.(type) {
+	case nil, quadValue:
+		return nil
+	case graph.PreFetchedValue:
+		return v.NameOf()
+	}
+	return qs.QuadStore.NameOf(v)
+}
+
+func (qs *QuadStore) NameOfContext(ctx context.Context, v graph.Value) (quad.Value, error) {
+	switch v := v.(type) {
+	case nil, quadValue:
+		return nil, nil
+	case graph.PreFetchedValue:
+		return v.NameOf(), nil
+	}
+	return graph.NameOf(ctx, qs.QuadStore, v)
+}
+
+func (qs *QuadStore) QuadIterator(d quad.Direction, v graph.Value) graph.Iterator {
+	preds := qs.predicates()
+	ref := v
+	if fv, ok := v.(graph.PreFetchedValue); ok {
+		ref = qs.QuadStore.ValueOf(fv.NameOf())
+	}
+	var base graph.Iterator
+	if ref != nil {
+		base = qs.QuadStore.QuadIterator(d, ref)
+	}
+	if len(preds) == 0 || d == quad.Label {
+		if base == nil {
+			return iterator.NewNull()
+		}
+		return base
+	}
+	it := newIterator(qs, preds, d, qs.NameOf(v), false)
+	if base == nil {
+		return it
+	}
+	return iterator.NewOr(base, it)
+}
+
+func (qs *QuadStore) NodesAllIterator() graph.Iterator {
+	preds := qs.predicates()
+	if len(preds) == 0 {
+		return qs.QuadStore.NodesAllIterator()
+	}
+	return allIterator{iterator.NewOr(
+		qs.QuadStore.NodesAllIterator(),
+		newIterator(qs, preds, quad.Any, nil, true),
+	)}
+}
+
+func (qs *QuadStore) QuadsAllIterator() graph.Iterator {
+	preds := qs.predicates()
+	if len(preds) == 0 {
+		return qs.QuadStore.QuadsAllIterator()
+	}
+	return allIterator{iterator.NewOr(
+		qs.QuadStore.QuadsAllIterator(),
+		newIterator(qs, preds, quad.Any, nil, false),
+	)}
+}
+
+// Size returns the size of the underlying store. Virtual quads are not counted.
+func (qs *QuadStore) Size() int64 {
+	return qs.QuadStore.Size()
+}
+
+func (qs *QuadStore) SizeContext(ctx context.Context) (int64, error) {
+	return graph.SizeOf(ctx, qs.QuadStore)
+}
+
+// subjects returns all subjects of quads with given predicates in the underlying store.
+func subjects(ctx context.Context, qs graph.QuadStore, preds []quad.Value) ([]quad.Value, error) {
+	var (
+		out  []quad.Value
+		seen = make(map[interface{}]struct{})
+	)
+	for _, p := range preds {
+		ref := qs.ValueOf(p)
+		if ref == nil {
+			continue
+		}
+		it := qs.QuadIterator(quad.Predicate, ref)
+		for it.Next(ctx) {
+			s := qs.QuadDirection(it.Result(), quad.Subject)
+			k := graph.ToKey(s)
+			if _, ok := seen[k]; ok {
+				continue
+			}
+			seen[k] = struct{}{}
+			out = append(out, qs.NameOf(s))
+		}
+		err := it.Err()
+		it.Close()
+		if err != nil {
+			return nil, err
+		}
+	}
+	return out, nil
+}
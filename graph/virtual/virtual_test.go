@@ -0,0 +1,84 @@
+// Copyright 2017 The Cayley Authors. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package virtual_test
+
+import (
+	"context"
+	"testing"
+
+	"github.com/cayleygraph/cayley/graph"
+	"github.com/cayleygraph/cayley/graph/graphtest/testutil"
+	"github.com/cayleygraph/cayley/graph/memstore"
+	"github.com/cayleygraph/cayley/graph/path"
+	"github.com/cayleygraph/cayley/graph/virtual"
+	"github.com/cayleygraph/cayley/quad"
+	"github.com/stretchr/testify/require"
+)
+
+var (
+	follows   = quad.IRI("follows")
+	birthYear = quad.IRI("birthYear")
+	age       = quad.IRI("age")
+)
+
+// ageOf computes an age from a birth year, as of 2017.
+func ageOf(ctx context.Context, qs graph.QuadStore, s quad.Value) ([]quad.Value, error) {
+	years, err := path.StartPath(qs, s).Out(birthYear).Iterate(ctx).AllValues(qs)
+	if err != nil {
+		return nil, err
+	}
+	var out []quad.Value
+	for _, y := range years {
+		if y, ok := y.(quad.Int); ok {
+			out = append(out, quad.Int(2017-y))
+		}
+	}
+	return out, nil
+}
+
+func TestVirtual(t *testing.T) {
+	base := memstore.New(
+		quad.Make(quad.IRI("alice"), birthYear, quad.Int(1990), nil),
+		quad.Make(quad.IRI("bob"), birthYear, quad.Int(2000), nil),
+		quad.Make(quad.IRI("alice"), follows, quad.IRI("bob"), nil),
+	)
+	qs := virtual.New(base)
+	err := qs.Register(age, virtual.Predicate{Sources: []quad.Value{birthYear}, Func: ageOf})
+	require.NoError(t, err)
+	require.Equal(t, []quad.Value{age}, qs.Predicates())
+
+	require.Equal(t, []string{`"27"^^<schema:Integer>`}, testutil.Collect(t, path.StartPath(qs, quad.IRI("alice")).Out(age)))
+	require.Equal(t, []string{`"17"^^<schema:Integer>`}, testutil.Collect(t, path.StartPath(qs, quad.IRI("alice")).Out(follows).Out(age)))
+	require.Equal(t, []string{"<bob>"}, testutil.Collect(t, path.StartPath(qs).Has(age, quad.Int(17))))
+	require.Equal(t, []string{"<alice>"}, testutil.Collect(t, path.StartPath(qs, quad.IRI("alice"), quad.IRI("bob")).Has(age, quad.Int(27))))
+	require.Equal(t, []string{"<alice>", "<bob>"}, testutil.Collect(t, path.StartPath(qs, quad.Int(17), quad.Int(27)).In(age)))
+
+	n := 0
+	ctx := context.TODO()
+	it := qs.QuadsAllIterator()
+	for it.Next(ctx) {
+		n++
+	}
+	require.NoError(t, it.Err())
+	require.Equal(t, 5, n)
+
+	err = qs.ApplyDeltas([]graph.Delta{
+		{Action: graph.Add, Quad: quad.Make(quad.IRI("carol"), age, quad.Int(5), nil)},
+	}, graph.IgnoreOpts{})
+	require.Equal(t, virtual.ErrVirtualQuad, err.(*graph.DeltaError).Err)
+
+	qs.Unregister(age)
+	require.Equal(t, []string(nil), testutil.Collect(t, path.StartPath(qs, quad.IRI("alice")).Out(age)))
+}
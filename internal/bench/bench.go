@@ -0,0 +1,218 @@
+// Copyright 2017 The Cayley Authors. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package bench implements a benchmarking harness that runs a standard query mix against a quad store.
+package bench
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"math/rand"
+	"sort"
+	"time"
+
+	"github.com/cayleygraph/cayley/graph"
+	"github.com/cayleygraph/cayley/graph/iterator"
+	"github.com/cayleygraph/cayley/graph/path"
+	"github.com/cayleygraph/cayley/quad"
+)
+
+const (
+	// Follows is a predicate that links nodes in the synthetic dataset.
+	Follows = quad.IRI("follows")
+	// Age is a predicate with integer values in the synthetic dataset.
+	Age = quad.IRI("age")
+
+	maxAge = 100
+)
+
+// Dataset describes values used by benchmark queries.
+type Dataset struct {
+	// Nodes is a set of nodes that queries start from.
+	Nodes []quad.Value
+	// Link is a predicate used for traversals.
+	Link quad.Value
+	// Numeric is a predicate with numeric values used for comparisons. Comparisons are skipped if it's not set.
+	Numeric quad.Value
+	// Threshold is a value used for comparisons.
+	Threshold quad.Value
+}
+
+// Synthetic returns a reader for a synthetic social graph with n nodes, where each node follows
+// a given number of random nodes and has a random age. Same seed always produces the same graph.
+func Synthetic(n, degree int, seed int64) (quad.Reader, *Dataset) {
+	r := &synthReader{n: n, degree: degree, rnd: rand.New(rand.NewSource(seed))}
+	d := &Dataset{
+		Link: Follows, Numeric: Age, Threshold: quad.Int(maxAge / 2),
+	}
+	for i := 0; i < n; i++ {
+		d.Nodes = append(d.Nodes, synthNode(i))
+	}
+	return r, d
+}
+
+func synthNode(i int) quad.Value {
+	return quad.IRI(fmt.Sprintf("n%d", i))
+}
+
+type synthReader struct {
+	n, degree int
+	rnd       *rand.Rand
+	i, j      int // current node and link
+}
+
+func (r *synthReader) ReadQuad() (quad.Quad, error) {
+	if r.i >= r.n {
+		return quad.Quad{}, io.EOF
+	}
+	s := synthNode(r.i)
+	if r.j < r.degree {
+		r.j++
+		return quad.Quad{Subject: s, Predicate: Follows, Object: synthNode(r.rnd.Intn(r.n))}, nil
+	}
+	r.i, r.j = r.i+1, 0
+	return quad.Quad{Subject: s, Predicate: Age, Object: quad.Int(r.rnd.Intn(maxAge))}, nil
+}
+
+// Sample reads up to n quads from the store and picks values for benchmark queries.
+// The most frequent predicate with non-literal objects is used for traversals.
+func Sample(ctx context.Context, qs graph.QuadStore, n int) (*Dataset, error) {
+	var (
+		d     Dataset
+		seen  = make(map[quad.Value]struct{})
+		links = make(map[quad.Value]int)
+	)
+	it := qs.QuadsAllIterator()
+	defer it.Close()
+	err := graph.Iterate(ctx, it).Limit(n).Each(func(v graph.Value) {
+		q := qs.Quad(v)
+		if _, ok := seen[q.Subject]; !ok {
+			seen[q.Subject] = struct{}{}
+			d.Nodes = append(d.Nodes, q.Subject)
+		}
+		switch o := q.Object.(type) {
+		case quad.IRI, quad.BNode:
+			links[q.Predicate]++
+		case quad.Int, quad.Float:
+			if d.Numeric == nil {
+				d.Numeric, d.Threshold = q.Predicate, o
+			}
+		}
+	})
+	if err != nil {
+		return nil, err
+	} else if len(d.Nodes) == 0 {
+		return nil, fmt.Errorf("database is empty")
+	}
+	max := 0
+	for p, cnt := range links {
+		if cnt > max {
+			d.Link, max = p, cnt
+		}
+	}
+	if d.Link == nil {
+		return nil, fmt.Errorf("no links between nodes found in the first %d quads", n)
+	}
+	return &d, nil
+}
+
+// Query is a single query type in a benchmark.
+type Query struct {
+	Name string
+	Desc string
+	// Path returns a query path for a given start node.
+	Path func(qs graph.QuadStore, d *Dataset, node quad.Value) *path.Path
+}
+
+// Queries is a standard query mix.
+var Queries = []Query{
+	{
+		Name: "lookup", Desc: "out links of a node",
+		Path: func(qs graph.QuadStore, d *Dataset, node quad.Value) *path.Path {
+			return path.StartPath(qs, node).Out(d.Link)
+		},
+	},
+	{
+		Name: "2-hop", Desc: "nodes two links away",
+		Path: func(qs graph.QuadStore, d *Dataset, node quad.Value) *path.Path {
+			return path.StartPath(qs, node).Out(d.Link).Out(d.Link)
+		},
+	},
+	{
+		Name: "compare", Desc: "linked nodes with a value greater than threshold",
+		Path: func(qs graph.QuadStore, d *Dataset, node quad.Value) *path.Path {
+			if d.Numeric == nil {
+				return nil
+			}
+			return path.StartPath(qs, node).Out(d.Link).Tag("node").
+				Out(d.Numeric).Filter(iterator.CompareGT, d.Threshold).Back("node")
+		},
+	},
+}
+
+// Result contains statistics for a single query type.
+type Result struct {
+	Name    string
+	Ops     int   // number of executed queries
+	Results int64 // total number of results
+	Elapsed time.Duration
+	// Latency percentiles
+	P50, P90, P99, Max time.Duration
+}
+
+// Throughput returns the number of queries executed per second.
+func (r Result) Throughput() float64 {
+	if r.Elapsed <= 0 {
+		return 0
+	}
+	return float64(r.Ops) / r.Elapsed.Seconds()
+}
+
+// Run executes a query for random nodes from the dataset until a given duration elapses,
+// or n queries are executed. Zero values disable corresponding limit, but at least one must be set.
+// Queries that cannot run on the dataset are skipped and return a zero result.
+func Run(ctx context.Context, qs graph.QuadStore, d *Dataset, q Query, dur time.Duration, n int, seed int64) (Result, error) {
+	res := Result{Name: q.Name}
+	if dur <= 0 && n <= 0 {
+		return res, fmt.Errorf("either duration or number of queries must be set")
+	} else if len(d.Nodes) == 0 || q.Path(qs, d, d.Nodes[0]) == nil {
+		return res, nil
+	}
+	rnd := rand.New(rand.NewSource(seed))
+	var lat []time.Duration
+	start := time.Now()
+	for (n <= 0 || res.Ops < n) && (dur <= 0 || time.Since(start) < dur) {
+		node := d.Nodes[rnd.Intn(len(d.Nodes))]
+		qstart := time.Now()
+		cnt, err := q.Path(qs, d, node).Iterate(ctx).Count()
+		if err != nil {
+			return res, err
+		}
+		lat = append(lat, time.Since(qstart))
+		res.Ops++
+		res.Results += cnt
+	}
+	res.Elapsed = time.Since(start)
+	if len(lat) == 0 {
+		return res, nil
+	}
+	sort.Slice(lat, func(i, j int) bool { return lat[i] < lat[j] })
+	perc := func(p float64) time.Duration {
+		return lat[int(p*float64(len(lat)-1))]
+	}
+	res.P50, res.P90, res.P99 = perc(0.5), perc(0.9), perc(0.99)
+	res.Max = lat[len(lat)-1]
+	return res, nil
+}
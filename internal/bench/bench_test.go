@@ -0,0 +1,31 @@
+package bench
+
+import (
+	"context"
+	"testing"
+
+	"github.com/cayleygraph/cayley/graph/memstore"
+	"github.com/cayleygraph/cayley/quad"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRun(t *testing.T) {
+	qr, d := Synthetic(100, 3, 1)
+	quads, err := quad.ReadAll(qr)
+	require.NoError(t, err)
+	require.Len(t, quads, 100*4)
+	qs := memstore.New(quads...)
+
+	sd, err := Sample(context.TODO(), qs, 1000)
+	require.NoError(t, err)
+	require.Equal(t, Follows, sd.Link)
+	require.Equal(t, Age, sd.Numeric)
+
+	for _, q := range Queries {
+		res, err := Run(context.TODO(), qs, d, q, 0, 10, 1)
+		require.NoError(t, err, q.Name)
+		require.Equal(t, 10, res.Ops, q.Name)
+		require.True(t, res.Results > 0, q.Name)
+		require.True(t, res.P50 <= res.P99 && res.P99 <= res.Max, q.Name)
+	}
+}
@@ -3,6 +3,8 @@ package gephi
 import (
 	"bytes"
 	"context"
+	"crypto/sha1"
+	"encoding/hex"
 	"encoding/json"
 	"fmt"
 	"io"
@@ -15,9 +17,12 @@ import (
 
 	"github.com/cayleygraph/cayley/clog"
 	"github.com/cayleygraph/cayley/graph"
+	"github.com/cayleygraph/cayley/graph/audit"
 	"github.com/cayleygraph/cayley/graph/iterator"
+	"github.com/cayleygraph/cayley/graph/journal"
 	"github.com/cayleygraph/cayley/graph/path"
 	"github.com/cayleygraph/cayley/quad"
+	"github.com/cayleygraph/cayley/query"
 	"github.com/cayleygraph/cayley/voc/rdf"
 	"github.com/cayleygraph/cayley/voc/rdfs"
 	"github.com/cayleygraph/cayley/voc/schema"
@@ -25,6 +30,7 @@ import (
 
 const (
 	defaultLimit = 10000
+	defaultLang  = "gizmo"
 	defaultSize  = 20
 	limitCoord   = 500
 )
@@ -46,6 +52,13 @@ var defaultInline = []quad.IRI{
 
 type GraphStreamHandler struct {
 	QS graph.QuadStore
+	// Journal is used to stream changes applied to the store in follow mode.
+	// Follow mode is not supported if it is nil.
+	Journal *journal.Journal
+	// Filter removes changes that must not be streamed in follow mode. Optional.
+	Filter func([]graph.Delta) []graph.Delta
+	// QueryContext returns a context with limits for queries passed in the qu parameter. Optional.
+	QueryContext func(r *http.Request) (context.Context, func(), error)
 }
 
 type valHash [quad.HashSize]byte
@@ -174,7 +187,16 @@ func (gs *GraphStream) ChangeNode(v quad.Value, sid string, props map[quad.Value
 	gs.encode(graphStreamEvent{ChangeNodes: m})
 }
 func (gs *GraphStream) AddEdge(i int, s, o string, p quad.Value) {
-	id := "q" + strconv.FormatInt(int64(i), 16)
+	gs.addEdge("q"+strconv.FormatInt(int64(i), 16), s, o, p)
+}
+
+// quadID returns an edge id for a quad. It is derived from the quad, thus an edge can be removed
+// by the same quad later.
+func quadID(q quad.Quad) string {
+	h := sha1.Sum([]byte(q.NQuad()))
+	return "q" + hex.EncodeToString(h[:8])
+}
+func (gs *GraphStream) addEdge(id string, s, o string, p quad.Value) {
 	ps := toNodeLabel(p)
 	gs.encode(graphStreamEvent{
 		AddEdges: map[string]streamEdge{id: {
@@ -184,6 +206,77 @@ func (gs *GraphStream) AddEdge(i int, s, o string, p quad.Value) {
 		}},
 	})
 }
+
+// AddQuad adds subject and object of the quad as nodes (if they were not added yet), and an edge between them.
+// It returns false if the quad has no subject or object.
+func (gs *GraphStream) AddQuad(q quad.Quad) bool {
+	var sh, oh valHash
+	quad.HashTo(q.Subject, sh[:])
+	quad.HashTo(q.Object, oh[:])
+	s, o := gs.addNode(q.Subject, sh, nil), gs.addNode(q.Object, oh, nil)
+	if s == "" || o == "" {
+		return false
+	}
+	gs.addEdge(quadID(q), s, o, q.Predicate)
+	return true
+}
+
+// RemoveQuad removes an edge that was added by AddQuad.
+func (gs *GraphStream) RemoveQuad(q quad.Quad) {
+	gs.encode(graphStreamEvent{DelEdges: map[string]streamEdge{quadID(q): {}}})
+}
+
+// RemoveNode removes a node, if it was added to the stream.
+func (gs *GraphStream) RemoveNode(v quad.Value) {
+	var h valHash
+	quad.HashTo(v, h[:])
+	id, ok := gs.seen[h]
+	if !ok {
+		return
+	}
+	delete(gs.seen, h)
+	gs.encode(graphStreamEvent{DelNodes: map[string]streamNode{printNodeID(id): {}}})
+}
+
+// SetNodeProp changes a single property of the node. Nil value removes the property.
+// The node is added if it was not added to the stream yet.
+func (gs *GraphStream) SetNodeProp(v, p, o quad.Value) {
+	var h valHash
+	quad.HashTo(v, h[:])
+	id, ok := gs.seen[h]
+	if !ok {
+		if o != nil {
+			gs.addNode(v, h, map[quad.Value]quad.Value{p: o})
+		}
+		return
+	}
+	key := toNodeLabel(p)
+	var val interface{}
+	if o != nil {
+		val = toNodeLabel(o)
+	}
+	switch p {
+	case iriPosX, iriPosY:
+		switch o := o.(type) {
+		case quad.Int:
+			val = float64(o)
+		case quad.Float:
+			val = float64(o)
+		default:
+			val = nil
+		}
+		if val == nil {
+			// do not move the node
+			return
+		}
+		key = "x"
+		if p == iriPosY {
+			key = "y"
+		}
+	}
+	gs.encode(graphStreamEvent{ChangeNodes: map[string]streamNode{printNodeID(id): {key: val}}})
+}
+
 func (gs *GraphStream) Flush() error {
 	if gs.buf.Len() == 0 {
 		return nil
@@ -197,10 +290,10 @@ func (gs *GraphStream) Flush() error {
 
 type streamNode map[string]interface{}
 type streamEdge struct {
-	Subject   string `json:"source"`
-	Label     string `json:"label"`
-	Predicate string `json:"pred"`
-	Object    string `json:"target"`
+	Subject   string `json:"source,omitempty"`
+	Label     string `json:"label,omitempty"`
+	Predicate string `json:"pred,omitempty"`
+	Object    string `json:"target,omitempty"`
 }
 type graphStreamEvent struct {
 	AddNodes    map[string]streamNode `json:"an,omitempty"`
@@ -212,9 +305,126 @@ type graphStreamEvent struct {
 	DelEdges    map[string]streamEdge `json:"de,omitempty"`
 }
 
-func (s *GraphStreamHandler) serveRawQuads(ctx context.Context, gs *GraphStream, sub, pred, obj, label []quad.Value, limit int) {
+// streamFilter selects quads that are streamed.
+type streamFilter struct {
+	dirs  map[quad.Direction]map[valHash]struct{} // allowed values for each direction; all if not set
+	nodes map[valHash]struct{}                    // subjects selected by a query; all if nil
+	refs  []graph.Value                           // references of selected subjects
+}
+
+func hashSet(vals []quad.Value) map[valHash]struct{} {
+	m := make(map[valHash]struct{}, len(vals))
+	var h valHash
+	for _, v := range vals {
+		quad.HashTo(v, h[:])
+		m[h] = struct{}{}
+	}
+	return m
+}
+
+// SetValues restricts values of a given quad direction.
+func (f *streamFilter) SetValues(d quad.Direction, vals []quad.Value) {
+	if len(vals) == 0 {
+		return
+	}
+	if f.dirs == nil {
+		f.dirs = make(map[quad.Direction]map[valHash]struct{})
+	}
+	f.dirs[d] = hashSet(vals)
+}
+
+// SetNodes restricts subjects of quads to a given set of nodes.
+func (f *streamFilter) SetNodes(qs graph.QuadStore, refs []graph.Value) {
+	f.refs = refs
+	f.nodes = make(map[valHash]struct{}, len(refs))
+	var h valHash
+	for _, ref := range refs {
+		quad.HashTo(qs.NameOf(ref), h[:])
+		f.nodes[h] = struct{}{}
+	}
+}
+
+// Match checks if a quad should be streamed.
+func (f *streamFilter) Match(q quad.Quad) bool {
+	var h valHash
+	for d, vals := range f.dirs {
+		quad.HashTo(q.Get(d), h[:])
+		if _, ok := vals[h]; !ok {
+			return false
+		}
+	}
+	if f.nodes != nil {
+		quad.HashTo(q.Subject, h[:])
+		if _, ok := f.nodes[h]; !ok {
+			return false
+		}
+	}
+	return true
+}
+
+// queryNodes runs a query and returns all nodes bound in its results.
+func (s *GraphStreamHandler) queryNodes(ctx context.Context, lang, qu string) ([]graph.Value, error) {
+	ses := query.NewSession(s.QS, lang)
+	if ses == nil {
+		l := query.GetLanguage(lang)
+		if l == nil || l.HTTP == nil {
+			return nil, fmt.Errorf("unsupported query language: %q", lang)
+		}
+		ses = l.HTTP(s.QS)
+	}
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	ctx = graph.WithQueryInfo(ctx, lang, qu)
+	if rec := audit.RecordFrom(ctx); rec != nil {
+		rec.SetQuery(lang, qu)
+	}
+	limit := graph.LimitsFrom(ctx).MaxResults
+	if limit <= 0 {
+		limit = -1
+	}
+	c := make(chan query.Result, 5)
+	go ses.Execute(ctx, qu, c, limit)
+	var (
+		out  []graph.Value
+		seen = make(map[interface{}]struct{})
+		err  error
+	)
+	add := func(v graph.Value) {
+		if v == nil {
+			return
+		}
+		k := graph.ToKey(v)
+		if _, ok := seen[k]; !ok {
+			seen[k] = struct{}{}
+			out = append(out, v)
+		}
+	}
+	for res := range c {
+		if err = res.Err(); err != nil {
+			cancel()
+			break
+		}
+		switch r := res.Result().(type) {
+		case map[string]graph.Value:
+			for _, v := range r {
+				add(v)
+			}
+		case graph.Value:
+			add(r)
+		}
+	}
+	// wait for the query to exit
+	for range c {
+	}
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (s *GraphStreamHandler) serveRawQuads(ctx context.Context, gs *GraphStream, f *streamFilter, sub, pred, obj, label []quad.Value, limit int) {
 	var it graph.Iterator
-	if len(sub)+len(pred)+len(obj)+len(label) == 0 {
+	if len(sub)+len(pred)+len(obj)+len(label) == 0 && f.nodes == nil {
 		it = s.QS.QuadsAllIterator()
 	} else {
 		var subIt []graph.Iterator
@@ -232,24 +442,21 @@ func (s *GraphStreamHandler) serveRawQuads(ctx context.Context, gs *GraphStream,
 		linksTo(quad.Predicate, pred)
 		linksTo(quad.Object, obj)
 		linksTo(quad.Label, label)
+		if f.nodes != nil {
+			subIt = append(subIt, iterator.NewLinksTo(s.QS, iterator.NewFixed(f.refs...), quad.Subject))
+		}
 		it = iterator.NewAnd(s.QS, subIt...)
 	}
 	defer it.Close()
 
-	var sh, oh valHash
 	for i := 0; (limit < 0 || i < limit) && it.Next(ctx); i++ {
 		qv := it.Result()
 		if qv == nil {
 			continue
 		}
-		q := s.QS.Quad(qv)
-		quad.HashTo(q.Subject, sh[:])
-		quad.HashTo(q.Object, oh[:])
-		s, o := gs.addNode(q.Subject, sh, nil), gs.addNode(q.Object, oh, nil)
-		if s == "" || o == "" {
+		if !gs.AddQuad(s.QS.Quad(qv)) {
 			continue
 		}
-		gs.AddEdge(i, s, o, q.Predicate)
 		if err := gs.Flush(); err != nil {
 			return
 		}
@@ -264,7 +471,8 @@ func shouldInline(v quad.Value) bool {
 	return false
 }
 
-func (s *GraphStreamHandler) serveNodesWithProps(ctx context.Context, gs *GraphStream, limit int) {
+// inlinePredicates returns a set of predicates that are streamed as node properties in nodes mode.
+func (s *GraphStreamHandler) inlinePredicates(ctx context.Context) (map[quad.Value]struct{}, error) {
 	propsPath := path.NewPath(s.QS).Has(iriInlinePred, quad.Bool(true))
 
 	// list of predicates marked as inline properties for gephi
@@ -273,18 +481,26 @@ func (s *GraphStreamHandler) serveNodesWithProps(ctx context.Context, gs *GraphS
 		inline[v] = struct{}{}
 	})
 	if err != nil {
-		clog.Errorf("cannot iterate over properties: %v", err)
-		return
+		return nil, err
 	}
 	// inline some well-known predicates
 	for _, iri := range defaultInline {
 		inline[iri] = struct{}{}
 		inline[iri.Full()] = struct{}{}
 	}
+	return inline, nil
+}
 
+func (s *GraphStreamHandler) serveNodesWithProps(ctx context.Context, gs *GraphStream, f *streamFilter, inline map[quad.Value]struct{}, limit int) {
 	ignore := make(map[quad.Value]struct{})
 
-	nodes := iterator.NewNot(propsPath.BuildIterator(), s.QS.NodesAllIterator())
+	var nodes graph.Iterator
+	if f.nodes != nil {
+		nodes = iterator.NewFixed(f.refs...)
+	} else {
+		propsPath := path.NewPath(s.QS).Has(iriInlinePred, quad.Bool(true))
+		nodes = iterator.NewNot(propsPath.BuildIterator(), s.QS.NodesAllIterator())
+	}
 	defer nodes.Close()
 
 	ictx, cancel := context.WithCancel(ctx)
@@ -292,7 +508,6 @@ func (s *GraphStreamHandler) serveNodesWithProps(ctx context.Context, gs *GraphS
 
 	itc := graph.Iterate(ictx, nodes).On(s.QS).Limit(limit)
 
-	qi := 0
 	_ = itc.EachValuePair(s.QS, func(v graph.Value, nv quad.Value) {
 		if _, skip := ignore[nv]; skip {
 			return
@@ -306,14 +521,17 @@ func (s *GraphStreamHandler) serveNodesWithProps(ctx context.Context, gs *GraphS
 		)
 		quad.HashTo(nv, h[:])
 
-		predIt := s.QS.QuadIterator(quad.Subject, nodes.Result())
+		predIt := s.QS.QuadIterator(quad.Subject, v)
 		defer predIt.Close()
 		for predIt.Next(ictx) {
+			q := s.QS.Quad(predIt.Result())
+			if !f.Match(q) {
+				continue
+			}
 			// this check helps us ignore nodes with no links
 			if sid == "" {
 				sid = gs.addNode(nv, h, props)
 			}
-			q := s.QS.Quad(predIt.Result())
 			if _, ok := inline[q.Predicate]; ok {
 				props[q.Predicate] = q.Object
 				ignore[q.Object] = struct{}{}
@@ -325,8 +543,7 @@ func (s *GraphStreamHandler) serveNodesWithProps(ctx context.Context, gs *GraphS
 				if o == "" {
 					continue
 				}
-				gs.AddEdge(qi, sid, o, q.Predicate)
-				qi++
+				gs.addEdge(quadID(q), sid, o, q.Predicate)
 				if err := gs.Flush(); err != nil {
 					cancel()
 					return
@@ -349,6 +566,63 @@ func (s *GraphStreamHandler) serveNodesWithProps(ctx context.Context, gs *GraphS
 	})
 }
 
+// hasQuads checks if a node is still used by any quad.
+func (s *GraphStreamHandler) hasQuads(ctx context.Context, v quad.Value) bool {
+	ref := s.QS.ValueOf(v)
+	if ref == nil {
+		return false
+	}
+	for _, d := range []quad.Direction{quad.Subject, quad.Object} {
+		it := s.QS.QuadIterator(d, ref)
+		ok := it.Next(ctx)
+		it.Close()
+		if ok {
+			return true
+		}
+	}
+	return false
+}
+
+// follow streams changes committed to the journal, starting from a given horizon, until the context is cancelled.
+// If inline is set, changes of inline properties are streamed as changes of node properties, as in nodes mode.
+func (s *GraphStreamHandler) follow(ctx context.Context, gs *GraphStream, from int64, f *streamFilter, inline map[quad.Value]struct{}, flush func() error) error {
+	return s.Journal.Tail(ctx, from, func(e *journal.Entry) error {
+		deltas := e.Deltas
+		if s.Filter != nil {
+			deltas = s.Filter(deltas)
+		}
+		for _, d := range deltas {
+			q := d.Quad
+			if !f.Match(q) {
+				continue
+			}
+			if inline != nil {
+				if _, ok := inline[q.Predicate]; ok || shouldInline(q.Object) {
+					var o quad.Value
+					if d.Action == graph.Add {
+						o = q.Object
+					}
+					gs.SetNodeProp(q.Subject, q.Predicate, o)
+					continue
+				}
+			}
+			switch d.Action {
+			case graph.Add:
+				gs.AddQuad(q)
+			case graph.Delete:
+				gs.RemoveQuad(q)
+				// remove nodes that are no longer used
+				for _, v := range []quad.Value{q.Subject, q.Object} {
+					if !s.hasQuads(ctx, v) {
+						gs.RemoveNode(v)
+					}
+				}
+			}
+		}
+		return flush()
+	})
+}
+
 func valuesFromString(s string) []quad.Value {
 	if s == "" {
 		return nil
@@ -362,7 +636,7 @@ func valuesFromString(s string) []quad.Value {
 }
 
 func (s *GraphStreamHandler) ServeHTTP(w http.ResponseWriter, r *http.Request, params httprouter.Params) {
-	ctx := context.TODO()
+	ctx := r.Context()
 	var limit int
 	if s := r.FormValue("limit"); s != "" {
 		limit, _ = strconv.Atoi(s)
@@ -374,20 +648,82 @@ func (s *GraphStreamHandler) ServeHTTP(w http.ResponseWriter, r *http.Request, p
 	if s := r.FormValue("mode"); s != "" {
 		mode = s
 	}
+	if mode != "raw" && mode != "nodes" {
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+	follow, _ := strconv.ParseBool(r.FormValue("follow"))
+	if follow && s.Journal == nil {
+		http.Error(w, "follow mode requires the journal to be enabled", http.StatusNotImplemented)
+		return
+	}
+	var from int64
+	if follow {
+		// changes applied while the graph is streamed are sent again after it
+		from = s.Journal.Horizon()
+	}
+
+	sub := valuesFromString(r.FormValue("sub"))
+	pred := valuesFromString(r.FormValue("pred"))
+	obj := valuesFromString(r.FormValue("obj"))
+	label := valuesFromString(r.FormValue("label"))
+	f := &streamFilter{}
+	f.SetValues(quad.Subject, sub)
+	f.SetValues(quad.Predicate, pred)
+	f.SetValues(quad.Object, obj)
+	f.SetValues(quad.Label, label)
+	if qu := r.FormValue("qu"); qu != "" {
+		lang := r.FormValue("lang")
+		if lang == "" {
+			lang = defaultLang
+		}
+		qctx, cancel := ctx, func() {}
+		if s.QueryContext != nil {
+			var err error
+			qctx, cancel, err = s.QueryContext(r)
+			if err != nil {
+				http.Error(w, err.Error(), http.StatusBadRequest)
+				return
+			}
+		}
+		refs, err := s.queryNodes(qctx, lang, qu)
+		cancel()
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		f.SetNodes(s.QS, refs)
+	}
 
 	w.Header().Set("Content-Type", "application/stream+json")
 	gs := NewGraphStream(w)
+	flusher, _ := w.(http.Flusher)
+	flush := func() error {
+		if err := gs.Flush(); err != nil {
+			return err
+		}
+		if flusher != nil {
+			flusher.Flush()
+		}
+		return nil
+	}
+	var inline map[quad.Value]struct{}
 	switch mode {
 	case "nodes":
-		s.serveNodesWithProps(ctx, gs, limit)
+		var err error
+		inline, err = s.inlinePredicates(ctx)
+		if err != nil {
+			clog.Errorf("cannot iterate over properties: %v", err)
+			return
+		}
+		s.serveNodesWithProps(ctx, gs, f, inline, limit)
 	case "raw":
-		sub := valuesFromString(r.FormValue("sub"))
-		pred := valuesFromString(r.FormValue("pred"))
-		obj := valuesFromString(r.FormValue("obj"))
-		label := valuesFromString(r.FormValue("label"))
-		s.serveRawQuads(ctx, gs, sub, pred, obj, label, limit)
-	default:
-		w.WriteHeader(http.StatusBadRequest)
+		s.serveRawQuads(ctx, gs, f, sub, pred, obj, label, limit)
+	}
+	if !follow || flush() != nil {
 		return
 	}
+	if err := s.follow(ctx, gs, from, f, inline, flush); err != nil && ctx.Err() == nil {
+		clog.Errorf("cannot stream changes: %v", err)
+	}
 }
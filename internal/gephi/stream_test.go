@@ -1,10 +1,25 @@
 package gephi
 
 import (
+	"bufio"
 	"bytes"
+	"context"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
 	"testing"
 
+	"github.com/cayleygraph/cayley/graph/journal"
+	"github.com/cayleygraph/cayley/graph/memstore"
 	"github.com/cayleygraph/cayley/quad"
+	_ "github.com/cayleygraph/cayley/query/mql"
+	"github.com/cayleygraph/cayley/writer"
 	"github.com/stretchr/testify/require"
 )
 
@@ -18,3 +33,115 @@ func TestStreamEncoder(t *testing.T) {
 	const expect = "{\"an\":{\"0\":{\"label\":\"aaa\",\"size\":20,\"x\":0,\"y\":0}}}\r\n{\"an\":{\"1\":{\"label\":\"bbb\",\"size\":20,\"x\":0,\"y\":0}}}\r\n"
 	require.Equal(t, expect, buf.String())
 }
+
+func readEvents(t testing.TB, r *bufio.Reader, n int) []graphStreamEvent {
+	var out []graphStreamEvent
+	for i := 0; i < n; i++ {
+		line, err := r.ReadString('\n')
+		require.NoError(t, err)
+		var ev graphStreamEvent
+		err = json.Unmarshal([]byte(line), &ev)
+		require.NoError(t, err, "%q", line)
+		out = append(out, ev)
+	}
+	return out
+}
+
+func TestStreamFiltered(t *testing.T) {
+	qs := memstore.New(
+		quad.MakeIRI("alice", "follows", "bob", ""),
+		quad.MakeIRI("bob", "follows", "carol", ""),
+		quad.MakeIRI("alice", "likes", "carol", "g"),
+	)
+	h := &GraphStreamHandler{QS: qs}
+	stream := func(params string) []graphStreamEvent {
+		req := httptest.NewRequest("GET", "/gephi/gs?"+params, nil)
+		rec := httptest.NewRecorder()
+		h.ServeHTTP(rec, req, nil)
+		require.Equal(t, http.StatusOK, rec.Code, rec.Body.String())
+		var out []graphStreamEvent
+		for _, line := range strings.Split(strings.TrimSpace(rec.Body.String()), "\n") {
+			var ev graphStreamEvent
+			err := json.Unmarshal([]byte(line), &ev)
+			require.NoError(t, err)
+			out = append(out, ev)
+		}
+		return out
+	}
+	edges := func(evs []graphStreamEvent) []string {
+		var out []string
+		for _, ev := range evs {
+			for _, e := range ev.AddEdges {
+				out = append(out, e.Predicate)
+			}
+		}
+		sort.Strings(out)
+		return out
+	}
+
+	require.Equal(t, []string{"<follows>", "<follows>", "<likes>"}, edges(stream("")))
+	require.Equal(t, []string{"<likes>"}, edges(stream("label=<g>")))
+	require.Equal(t, []string{"<follows>", "<likes>"}, edges(stream("lang=mql&qu="+url.QueryEscape(`[{"id": "<alice>"}]`))))
+	require.Equal(t, []string{"<follows>"}, edges(stream("mode=nodes&pred=<follows>&lang=mql&qu="+url.QueryEscape(`[{"id": "<alice>"}]`))))
+
+	req := httptest.NewRequest("GET", "/gephi/gs?follow=true", nil)
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, req, nil)
+	require.Equal(t, http.StatusNotImplemented, rec.Code)
+}
+
+func TestStreamFollow(t *testing.T) {
+	dir, err := ioutil.TempDir("", "cayley_gephi")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	j, err := journal.Open(filepath.Join(dir, "journal"), true)
+	require.NoError(t, err)
+	qs := journal.Wrap(memstore.New(quad.MakeIRI("alice", "follows", "bob", "")), j)
+	defer qs.Close()
+	qw, err := writer.NewSingleReplication(qs, nil)
+	require.NoError(t, err)
+
+	h := &GraphStreamHandler{QS: qs, Journal: j}
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		h.ServeHTTP(w, r, nil)
+	}))
+	defer srv.Close()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	req, err := http.NewRequest("GET", srv.URL+"?follow=true&pred=<follows>", nil)
+	require.NoError(t, err)
+	resp, err := http.DefaultClient.Do(req.WithContext(ctx))
+	require.NoError(t, err)
+	defer resp.Body.Close()
+	r := bufio.NewReader(resp.Body)
+
+	// initial graph: two nodes and an edge
+	evs := readEvents(t, r, 3)
+	require.Len(t, evs[2].AddEdges, 1)
+	first := quadID(quad.MakeIRI("alice", "follows", "bob", ""))
+	_, ok := evs[2].AddEdges[first]
+	require.True(t, ok)
+
+	// changes that do not match the filter are skipped
+	err = qw.AddQuad(quad.MakeIRI("alice", "likes", "bob", ""))
+	require.NoError(t, err)
+	err = qw.AddQuad(quad.MakeIRI("bob", "follows", "carol", ""))
+	require.NoError(t, err)
+	evs = readEvents(t, r, 2)
+	require.Len(t, evs[0].AddNodes, 1)
+	require.Equal(t, map[string]streamEdge{
+		quadID(quad.MakeIRI("bob", "follows", "carol", "")): {Subject: "1", Predicate: "<follows>", Label: "<follows>", Object: "2"},
+	}, evs[1].AddEdges)
+
+	// edge is removed, as well as the node that is no longer used
+	err = qw.RemoveQuad(quad.MakeIRI("alice", "likes", "bob", ""))
+	require.NoError(t, err)
+	err = qw.RemoveQuad(quad.MakeIRI("alice", "follows", "bob", ""))
+	require.NoError(t, err)
+	evs = readEvents(t, r, 2)
+	_, ok = evs[0].DelEdges[first]
+	require.True(t, ok)
+	require.Equal(t, map[string]streamNode{"0": {}}, evs[1].DelNodes)
+}
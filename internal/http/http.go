@@ -26,6 +26,8 @@ import (
 	"github.com/julienschmidt/httprouter"
 
 	"github.com/cayleygraph/cayley/graph"
+	"github.com/cayleygraph/cayley/graph/acl"
+	"github.com/cayleygraph/cayley/graph/audit"
 	"github.com/cayleygraph/cayley/internal/gephi"
 	"github.com/cayleygraph/cayley/server/http"
 )
@@ -70,10 +72,18 @@ type statusWriter struct {
 
 func (w *statusWriter) WriteHeader(code int) {
 	*(w.code) = code
+	w.ResponseWriter.WriteHeader(code)
 }
 
+func (w *statusWriter) Flush() {
+	if f, ok := w.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+// LogRequest logs start and completion of each request. Messages contain request id, see cayleyhttp.RequestID.
 func LogRequest(handler httprouter.Handle) httprouter.Handle {
-	return func(w http.ResponseWriter, req *http.Request, params httprouter.Params) {
+	return cayleyhttp.RequestID(func(w http.ResponseWriter, req *http.Request, params httprouter.Params) {
 		start := time.Now()
 		addr := req.Header.Get("X-Real-IP")
 		if addr == "" {
@@ -84,10 +94,15 @@ func LogRequest(handler httprouter.Handle) httprouter.Handle {
 		}
 		code := 200
 		rw := &statusWriter{ResponseWriter: w, code: &code}
-		clog.Infof("started %s %s for %s", req.Method, req.URL.Path, addr)
+		ctx := req.Context()
+		clog.Info(ctx, "started request",
+			clog.F("method", req.Method), clog.F("path", req.URL.Path), clog.F("addr", addr),
+		)
 		handler(rw, req, params)
-		clog.Infof("completed %v %s %s in %v", code, http.StatusText(code), req.URL.Path, time.Since(start))
-	}
+		clog.Info(ctx, "completed request",
+			clog.F("status", code), clog.F("path", req.URL.Path), clog.F("duration", time.Since(start)),
+		)
+	})
 }
 
 func jsonResponse(w http.ResponseWriter, code int, err interface{}) {
@@ -117,9 +132,14 @@ func (h *TemplateRequestHandler) ServeHTTP(w http.ResponseWriter, r *http.Reques
 type API struct {
 	config *Config
 	handle *graph.Handle
+	// api2 is set to apply the same access policies as in API v2
+	api2 *cayleyhttp.APIv2
 }
 
 func (api *API) GetHandleForRequest(r *http.Request) (*graph.Handle, error) {
+	if api.api2 != nil {
+		return api.api2.HandleFor(r)
+	}
 	return cayleyhttp.HandleForRequest(api.handle, "single", nil, r)
 }
 
@@ -149,37 +169,116 @@ func CORS(h httprouter.Handle) httprouter.Handle {
 }
 
 func (api *API) APIv1(r *httprouter.Router) {
-	r.POST("/api/v1/query/:query_lang", CORS(LogRequest(api.ServeV1Query)))
+	auditQuery, auditWrite := api.api2.Audit(audit.OpQuery), api.api2.Audit(audit.OpWrite)
+	r.POST("/api/v1/query/:query_lang", CORS(LogRequest(auditQuery(api.ServeV1Query))))
 	r.POST("/api/v1/shape/:query_lang", CORS(LogRequest(api.ServeV1Shape)))
-	r.POST("/api/v1/write", CORS(api.RWOnly(LogRequest(api.ServeV1Write))))
-	r.POST("/api/v1/write/file/nquad", CORS(api.RWOnly(LogRequest(api.ServeV1WriteNQuad))))
-	r.POST("/api/v1/delete", CORS(api.RWOnly(LogRequest(api.ServeV1Delete))))
+	r.POST("/api/v1/write", CORS(api.RWOnly(LogRequest(auditWrite(api.ServeV1Write)))))
+	r.POST("/api/v1/write/file/nquad", CORS(api.RWOnly(LogRequest(auditWrite(api.ServeV1WriteNQuad)))))
+	r.POST("/api/v1/delete", CORS(api.RWOnly(LogRequest(auditWrite(api.ServeV1Delete)))))
 }
 
 type Config struct {
-	ReadOnly bool
-	Timeout  time.Duration
-	Batch    int
+	ReadOnly   bool
+	Timeout    time.Duration
+	Batch      int
+	MaxScanned int64
+	// CompactIRIs enables compaction of IRIs in query results by default.
+	CompactIRIs bool
+	// TypedValues enables encoding of values in query results with explicit type information by default.
+	TypedValues bool
+	// Backend is a name of the backend reported by the info endpoint.
+	Backend string
+	// CacheSize is a maximal number of cached query results. Zero disables the cache.
+	CacheSize int
+	// CacheTTL is a maximal age of cached query results.
+	CacheTTL time.Duration
+	// Parallelism is a maximal number of goroutines a single query can use. Values less than 2 disable parallel execution.
+	Parallelism int
+	// IdempotencySize is a maximal number of stored results of write requests with an Idempotency-Key header.
+	// Zero disables the support for idempotency keys.
+	IdempotencySize int
+	// IdempotencyTTL is the time after which an idempotency key can be reused.
+	IdempotencyTTL time.Duration
+	// Roles maps roles of users to access policies. Policies are disabled if it is empty.
+	Roles map[string]*acl.Policy
+	// RoleHeader is a request header with the role of the user. It must be set by a trusted proxy.
+	RoleHeader string
+	// DefaultRole is used for requests without a role header.
+	DefaultRole string
+	// AdminToken grants access to administrative endpoints. If neither the token nor Roles are set,
+	// administrative endpoints are disabled.
+	AdminToken string
+	// Audit is a sink for the audit log of queries and writes. Audit log is disabled if it is nil.
+	// The sink is not closed by the server.
+	Audit audit.Sink
+	// PrincipalHeader is a request header with the name of the user. It must be set by a trusted proxy.
+	PrincipalHeader string
+	// Reload returns a new configuration of the server. ReadOnly and Backend settings are ignored.
+	// If not set, the server cannot be reloaded.
+	Reload func() (*Config, error)
+}
+
+// ApplyConfig applies settings that can be changed while the server is running.
+func ApplyConfig(api2 *cayleyhttp.APIv2, cfg *Config) {
+	api2.SetBatchSize(cfg.Batch)
+	api2.SetQueryTimeout(cfg.Timeout)
+	api2.SetScanLimit(cfg.MaxScanned)
+	api2.SetCompactIRIs(cfg.CompactIRIs)
+	api2.SetTypedValues(cfg.TypedValues)
+	api2.SetQueryCache(cfg.CacheSize, cfg.CacheTTL)
+	api2.SetParallelism(cfg.Parallelism)
+	api2.SetIdempotency(cfg.IdempotencySize, cfg.IdempotencyTTL)
+	api2.SetAccessPolicies(cfg.RoleHeader, cfg.Roles, cfg.DefaultRole)
+	api2.SetAdminToken(cfg.AdminToken)
+	api2.SetAuditLog(cfg.Audit, cfg.PrincipalHeader)
 }
 
 func SetupRoutes(handle *graph.Handle, cfg *Config) error {
+	_, err := Setup(handle, cfg)
+	return err
+}
+
+// Setup registers all HTTP handlers and returns the API that can be used to change the settings of the server.
+func Setup(handle *graph.Handle, cfg *Config) (*cayleyhttp.APIv2, error) {
 	r := httprouter.New()
-	api := &API{config: cfg, handle: handle}
+	api2 := cayleyhttp.NewAPIv2(handle)
+	api := &API{config: cfg, handle: handle, api2: api2}
 	r.OPTIONS("/*path", CORSFunc)
 	api.APIv1(r)
 
-	api2 := cayleyhttp.NewAPIv2(handle)
 	api2.SetReadOnly(cfg.ReadOnly)
-	api2.SetBatchSize(cfg.Batch)
-	api2.SetQueryTimeout(cfg.Timeout)
+	api2.SetBackend(cfg.Backend)
+	ApplyConfig(api2, cfg)
+	if cfg.Reload != nil {
+		api2.SetReloadFunc(func() error {
+			nc, err := cfg.Reload()
+			if err != nil {
+				return err
+			}
+			ApplyConfig(api2, nc)
+			return nil
+		})
+	}
 	api2.RegisterOn(r, CORS, LogRequest)
 
-	gs := &gephi.GraphStreamHandler{QS: handle.QuadStore}
 	const gephiPath = "/gephi/gs"
-	r.GET(gephiPath, CORS(gs.ServeHTTP))
+	r.GET(gephiPath, CORS(api.api2.Audit(audit.OpQuery)(func(w http.ResponseWriter, r *http.Request, params httprouter.Params) {
+		h, err := api.GetHandleForRequest(r)
+		if err != nil {
+			jsonResponse(w, http.StatusBadRequest, err)
+			return
+		}
+		gs := &gephi.GraphStreamHandler{QS: h.QuadStore, QueryContext: api.api2.QueryContext}
+		gs.Journal, gs.Filter, err = api.api2.JournalFor(r)
+		if err != nil {
+			jsonResponse(w, http.StatusForbidden, err)
+			return
+		}
+		gs.ServeHTTP(w, r, params)
+	})))
 
 	if assets, err := findAssetsPath(); err != nil {
-		return err
+		return nil, err
 	} else if assets != "" {
 		clog.Infof("using assets from %q", assets)
 		docs := &DocRequestHandler{assets: assets}
@@ -194,5 +293,5 @@ func SetupRoutes(handle *graph.Handle, cfg *Config) error {
 	}
 
 	http.Handle("/", r)
-	return nil
+	return api2, nil
 }
@@ -26,6 +26,8 @@ import (
 
 	"github.com/julienschmidt/httprouter"
 
+	"github.com/cayleygraph/cayley/graph"
+	"github.com/cayleygraph/cayley/graph/audit"
 	"github.com/cayleygraph/cayley/query"
 )
 
@@ -115,12 +117,20 @@ func (api *API) ServeV1Query(w http.ResponseWriter, r *http.Request, params http
 	}
 
 	ses := l.HTTP(h.QuadStore)
+	if sw, ok := ses.(query.Writer); ok && !api.config.ReadOnly && r.Method == "POST" {
+		sw.SetWriter(h.QuadWriter)
+	}
 	bodyBytes, err := ioutil.ReadAll(r.Body)
 	if err != nil {
 		errFunc(w, err)
 		return
 	}
 	code := string(bodyBytes)
+	ctx = graph.WithQueryInfo(ctx, l.Name, code)
+	rec := audit.RecordFrom(r.Context())
+	if rec != nil {
+		rec.SetQuery(l.Name, code)
+	}
 
 	c := make(chan query.Result, 5)
 	go ses.Execute(ctx, code, c, limit)
@@ -133,6 +143,9 @@ func (api *API) ServeV1Query(w http.ResponseWriter, r *http.Request, params http
 			errFunc(w, err)
 			return
 		}
+		if rec != nil {
+			rec.AddResults(1)
+		}
 		ses.Collate(res)
 	}
 	output, err := ses.Results()
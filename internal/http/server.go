@@ -0,0 +1,112 @@
+// Copyright 2017 The Cayley Authors. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package http
+
+import (
+	"context"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/cayleygraph/cayley/clog"
+)
+
+// Server is an HTTP server that can be stopped without interrupting requests in the middle of a write.
+type Server struct {
+	srv *http.Server
+	h   http.Handler
+
+	// ctx is a parent context for all requests; it is cancelled when the grace period expires.
+	ctx    context.Context
+	cancel func()
+
+	mu      sync.Mutex
+	closing bool
+	wg      sync.WaitGroup
+}
+
+// NewServer creates a server that listens on a given address and serves requests with h.
+func NewServer(addr string, h http.Handler) *Server {
+	s := &Server{h: h}
+	s.ctx, s.cancel = context.WithCancel(context.Background())
+	s.srv = &http.Server{Addr: addr, Handler: s}
+	return s
+}
+
+func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	if s.closing {
+		s.mu.Unlock()
+		w.Header().Set("Connection", "close")
+		jsonResponse(w, http.StatusServiceUnavailable, "Server is shutting down.")
+		return
+	}
+	s.wg.Add(1)
+	s.mu.Unlock()
+	defer s.wg.Done()
+
+	ctx, cancel := context.WithCancel(r.Context())
+	defer cancel()
+	go func() {
+		select {
+		case <-s.ctx.Done():
+			cancel()
+		case <-ctx.Done():
+		}
+	}()
+	s.h.ServeHTTP(w, r.WithContext(ctx))
+}
+
+// ListenAndServe accepts connections until the server is shut down.
+// It returns nil if the server was stopped by Shutdown.
+func (s *Server) ListenAndServe() error {
+	err := s.srv.ListenAndServe()
+	if err == http.ErrServerClosed {
+		err = nil
+	}
+	return err
+}
+
+// Shutdown stops accepting new connections and requests, and waits for in-flight requests to finish.
+//
+// Requests that are still running when the grace period expires are cancelled, which stops queries
+// and closes their iterators. Writes that were already started are not interrupted, thus Shutdown
+// always waits for all handlers to return, and it is safe to close the database after it.
+// Zero grace period means that requests are never cancelled.
+func (s *Server) Shutdown(grace time.Duration) error {
+	s.mu.Lock()
+	s.closing = true
+	s.mu.Unlock()
+
+	ctx := context.Background()
+	if grace > 0 {
+		var cancel func()
+		ctx, cancel = context.WithTimeout(ctx, grace)
+		defer cancel()
+	}
+	err := s.srv.Shutdown(ctx)
+	if err == context.DeadlineExceeded {
+		clog.Warningf("shutdown grace period of %v expired, cancelling requests", grace)
+		err = nil
+	} else if err != nil {
+		clog.Errorf("shutdown failed: %v", err)
+	}
+	s.cancel()
+	s.wg.Wait()
+	if cerr := s.srv.Close(); err == nil && cerr != nil {
+		err = cerr
+	}
+	return err
+}
@@ -105,7 +105,7 @@ func (api *API) ServeV1WriteNQuad(w http.ResponseWriter, r *http.Request, params
 
 	formFile, _, err := r.FormFile("NQuadFile")
 	if err != nil {
-		clog.Errorf("%v", err)
+		clog.Error(r.Context(), "failed to read uploaded file", clog.F("error", err))
 		jsonResponse(w, 500, "Couldn't read file: "+err.Error())
 		return
 	}
@@ -1,6 +1,7 @@
 package internal
 
 import (
+	"context"
 	"fmt"
 	"io"
 	"net/http"
@@ -16,12 +17,48 @@ import (
 	"github.com/cayleygraph/cayley/quad/nquads"
 )
 
+// Modes of handling blank nodes in loaded files, see LoadBlankNodes.
+const (
+	BlankNodesKeep   = "keep"
+	BlankNodesRename = "rename"
+	BlankNodesSkolem = "skolem"
+)
+
+// LoadBlankNodes selects how blank nodes of loaded files are handled. BlankNodesKeep loads them as-is,
+// BlankNodesRename gives them labels unique to each loaded file, and BlankNodesSkolem replaces them with
+// IRIs derived from their quads, thus loading the same file again does not create new nodes.
+// Skolemization reads the whole file into memory.
+var LoadBlankNodes = BlankNodesKeep
+
 // Load loads a graph from the given path and write it to qw.  See
 // DecompressAndLoad for more information.
 func Load(qw graph.QuadWriter, batch int, path, typ string) error {
 	return DecompressAndLoad(qw, batch, path, typ, nil)
 }
 
+// LoadContext is the same as Load, but stops between batches when the context is cancelled.
+// Batches written before the cancellation are kept.
+func LoadContext(ctx context.Context, qw graph.QuadWriter, batch int, path, typ string) error {
+	return decompressAndLoad(ctx, qw, batch, path, typ, nil)
+}
+
+// BulkLoad loads a graph from the given path and writes it to a quad store
+// using its bulk load path.
+func BulkLoad(bl graph.BulkLoader, path, typ string) error {
+	if path == "" {
+		return nil
+	}
+	qr, err := QuadReaderFor(path, typ)
+	if err != nil {
+		return err
+	}
+	defer qr.Close()
+	if err = bl.BulkLoad(qr); err != nil {
+		return fmt.Errorf("db: failed to load data: %v", err)
+	}
+	return nil
+}
+
 type readCloser struct {
 	quad.ReadCloser
 	close func() error
@@ -69,7 +106,16 @@ func QuadReaderFor(path, typ string) (quad.ReadCloser, error) {
 		// TODO(dennwc): save content type for format auto-detection
 		r, c = res.Body, res.Body
 	}
+	return quadReaderFrom(r, c, path, typ)
+}
+
+// QuadReaderFrom creates a quad reader for an opened file. The name of the file is used to detect its format
+// if typ is not set. Closing the quad reader closes the file.
+func QuadReaderFrom(f io.ReadCloser, name, typ string) (quad.ReadCloser, error) {
+	return quadReaderFrom(f, f, name, typ)
+}
 
+func quadReaderFrom(r io.Reader, c io.Closer, path, typ string) (quad.ReadCloser, error) {
 	r, err := decompressor.New(r)
 	if err != nil {
 		if c != nil {
@@ -113,15 +159,38 @@ func QuadReaderFor(path, typ string) (quad.ReadCloser, error) {
 		qr = format.Reader(r)
 	}
 	if c != nil {
-		return readCloser{ReadCloser: qr, close: c.Close}, nil
+		qr = readCloser{ReadCloser: qr, close: c.Close}
+	}
+	return wrapBlankNodes(qr)
+}
+
+// bnodeReader replaces blank nodes of quads read from the underlying reader.
+type bnodeReader struct {
+	quad.Reader
+	io.Closer
+}
+
+func wrapBlankNodes(qr quad.ReadCloser) (quad.ReadCloser, error) {
+	switch LoadBlankNodes {
+	case "", BlankNodesKeep:
+		return qr, nil
+	case BlankNodesRename:
+		return bnodeReader{Reader: quad.NewBlankNodeRenamer().Reader(qr), Closer: qr}, nil
+	case BlankNodesSkolem:
+		return bnodeReader{Reader: quad.NewSkolemReader(qr, ""), Closer: qr}, nil
 	}
-	return qr, nil
+	qr.Close()
+	return nil, fmt.Errorf("unknown blank nodes mode %q", LoadBlankNodes)
 }
 
 // DecompressAndLoad will load or fetch a graph from the given path, decompress
 // it, and then call the given load function to process the decompressed graph.
 // If no loadFn is provided, db.Load is called.
 func DecompressAndLoad(qw graph.QuadWriter, batch int, path, typ string, writerFunc func(graph.QuadWriter) graph.BatchWriter) error {
+	return decompressAndLoad(nil, qw, batch, path, typ, writerFunc)
+}
+
+func decompressAndLoad(ctx context.Context, qw graph.QuadWriter, batch int, path, typ string, writerFunc func(graph.QuadWriter) graph.BatchWriter) error {
 	if path == "" {
 		return nil
 	}
@@ -130,19 +199,43 @@ func DecompressAndLoad(qw graph.QuadWriter, batch int, path, typ string, writerF
 		return err
 	}
 	defer qr.Close()
+	if ctx != nil {
+		qr = ctxReader{ctx: ctx, ReadCloser: qr}
+	}
+	return loadReader(qw, batch, qr, writerFunc)
+}
+
+// LoadReader writes all quads from the reader to qw in batches.
+func LoadReader(qw graph.QuadWriter, batch int, qr quad.Reader) error {
+	return loadReader(qw, batch, qr, nil)
+}
 
+func loadReader(qw graph.QuadWriter, batch int, qr quad.Reader, writerFunc func(graph.QuadWriter) graph.BatchWriter) error {
 	if writerFunc == nil {
 		writerFunc = graph.NewWriter
 	}
 	dest := writerFunc(qw)
 
-	_, err = quad.CopyBatch(&batchLogger{BatchWriter: dest}, qr, batch)
+	_, err := quad.CopyBatch(&batchLogger{BatchWriter: dest}, qr, batch)
 	if err != nil {
 		return fmt.Errorf("db: failed to load data: %v", err)
 	}
 	return dest.Close()
 }
 
+// ctxReader stops reading quads when the context is cancelled.
+type ctxReader struct {
+	ctx context.Context
+	quad.ReadCloser
+}
+
+func (r ctxReader) ReadQuad() (quad.Quad, error) {
+	if err := r.ctx.Err(); err != nil {
+		return quad.Quad{}, err
+	}
+	return r.ReadCloser.ReadQuad()
+}
+
 type batchLogger struct {
 	cnt int
 	quad.BatchWriter
@@ -22,6 +22,7 @@ import (
 	"io"
 	"os"
 	"os/signal"
+	"path/filepath"
 	"strconv"
 	"strings"
 	"time"
@@ -34,24 +35,8 @@ import (
 	"github.com/cayleygraph/cayley/query"
 )
 
-func trace(s string) (string, time.Time) {
-	return s, time.Now()
-}
-
-func un(s string, startTime time.Time) {
-	endTime := time.Now()
-
-	fmt.Printf(s, float64(endTime.UnixNano()-startTime.UnixNano())/float64(1E6))
-}
-
 func Run(ctx context.Context, qu string, ses query.REPLSession) error {
 	nResults := 0
-	startTrace, startTime := trace("Elapsed time: %g ms\n\n")
-	defer func() {
-		if nResults > 0 {
-			un(startTrace, startTime)
-		}
-	}()
 	fmt.Printf("\n")
 	c := make(chan query.Result, 5)
 	go ses.Execute(ctx, qu, c, 100)
@@ -81,24 +66,85 @@ const (
 	history = ".cayley_history"
 )
 
+const help = `Help
+	exit            // exit
+	help            // this help
+	:a <quad>       // add quad
+	:d <quad>       // delete quad
+	:lang [name]    // show or switch query language
+	:timing [t|f]   // show elapsed time of queries
+	:debug [t|f]    // enable debug output
+`
+
+// historyPath returns a path of the history file in user's home directory,
+// or in the current directory, if home directory is not known.
+func historyPath() string {
+	if home := os.Getenv("HOME"); home != "" {
+		return filepath.Join(home, history)
+	}
+	return history
+}
+
+// parseBool parses a boolean argument of REPL commands.
+func parseBool(args string) (bool, error) {
+	switch args = strings.TrimSpace(args); args {
+	case "t":
+		return true, nil
+	case "f":
+		return false, nil
+	}
+	v, err := strconv.ParseBool(args)
+	if err != nil {
+		return false, fmt.Errorf("cannot parse %q as a valid boolean - acceptable values: 't'|'true' or 'f'|'false'", args)
+	}
+	return v, nil
+}
+
 func Repl(ctx context.Context, h *graph.Handle, queryLanguage string, timeout time.Duration) error {
 	if queryLanguage == "" {
 		queryLanguage = defaultLanguage
 	}
-	l := query.GetLanguage(queryLanguage)
-	if l == nil || l.REPL == nil {
-		return fmt.Errorf("unsupported query language: %q", queryLanguage)
+	// sessions are preserved when switching languages
+	sessions := make(map[string]query.REPLSession)
+	session := func(name string) (query.REPLSession, error) {
+		if ses, ok := sessions[name]; ok {
+			return ses, nil
+		}
+		l := query.GetLanguage(name)
+		if l == nil || l.REPL == nil {
+			return nil, fmt.Errorf("unsupported query language: %q", name)
+		}
+		ses := l.REPL(h.QuadStore)
+		if sw, ok := ses.(query.Writer); ok && h.QuadWriter != nil {
+			sw.SetWriter(h.QuadWriter)
+		}
+		sessions[name] = ses
+		return ses, nil
+	}
+	ses, err := session(queryLanguage)
+	if err != nil {
+		return err
 	}
-	ses := l.REPL(h.QuadStore)
 
-	term, err := terminal(history)
+	hist := historyPath()
+	term, err := terminal(hist)
 	if os.IsNotExist(err) {
-		fmt.Printf("creating new history file: %q\n", history)
+		fmt.Printf("creating new history file: %q\n", hist)
 	}
-	defer persist(term, history)
+	defer persist(term, hist)
+	term.SetCtrlCAborts(true)
+	term.SetWordCompleter(func(line string, pos int) (string, []string, string) {
+		c, ok := ses.(query.REPLCompleter)
+		if !ok {
+			return line[:pos], nil, line[pos:]
+		}
+		head, word := splitWord(line[:pos])
+		return head, c.Complete(word), line[pos:]
+	})
 
 	var (
 		prompt = ps1
+		timing = true
 
 		code string
 	)
@@ -120,7 +166,11 @@ func Repl(ctx context.Context, h *graph.Handle, queryLanguage string, timeout ti
 			prompt = ps2
 		}
 		line, err := term.Prompt(prompt)
-		if err != nil {
+		if err == liner.ErrPromptAborted {
+			// Ctrl+C discards current input
+			code = ""
+			continue
+		} else if err != nil {
 			if err == io.EOF {
 				fmt.Println()
 				return nil
@@ -140,19 +190,10 @@ func Repl(ctx context.Context, h *graph.Handle, queryLanguage string, timeout ti
 
 			switch cmd {
 			case ":debug":
-				args = strings.TrimSpace(args)
-				var debug bool
-				switch args {
-				case "t":
-					debug = true
-				case "f":
-					// Do nothing.
-				default:
-					debug, err = strconv.ParseBool(args)
-					if err != nil {
-						fmt.Printf("Error: cannot parse %q as a valid boolean - acceptable values: 't'|'true' or 'f'|'false'\n", args)
-						continue
-					}
+				debug, err := parseBool(args)
+				if err != nil {
+					fmt.Printf("Error: %v\n", err)
+					continue
 				}
 				if debug {
 					clog.SetV(2)
@@ -162,6 +203,30 @@ func Repl(ctx context.Context, h *graph.Handle, queryLanguage string, timeout ti
 				fmt.Printf("Debug set to %t\n", debug)
 				continue
 
+			case ":timing":
+				timing, err = parseBool(args)
+				if err != nil {
+					fmt.Printf("Error: %v\n", err)
+					continue
+				}
+				fmt.Printf("Timing set to %t\n", timing)
+				continue
+
+			case ":lang":
+				name := strings.TrimSpace(args)
+				if name == "" {
+					fmt.Printf("Current language: %s\n", queryLanguage)
+					continue
+				}
+				nses, err := session(name)
+				if err != nil {
+					fmt.Printf("Error: %v\n", err)
+					continue
+				}
+				ses, queryLanguage = nses, name
+				fmt.Printf("Language set to %s\n", queryLanguage)
+				continue
+
 			case ":a":
 				quad, err := nquads.Parse(args)
 				if err == nil {
@@ -186,7 +251,7 @@ func Repl(ctx context.Context, h *graph.Handle, queryLanguage string, timeout ti
 				continue
 
 			case "help":
-				fmt.Printf("Help\n\texit // Exit\n\thelp // this help\n\td: <quad> // delete quad\n\ta: <quad> // add quad\n\t:debug [t|f]\n")
+				fmt.Print(help)
 				continue
 
 			case "exit":
@@ -201,9 +266,17 @@ func Repl(ctx context.Context, h *graph.Handle, queryLanguage string, timeout ti
 			}
 		}
 
+		if code != "" {
+			code += "\n"
+		}
 		code += line
+		if openBrackets(code) > 0 {
+			// collect more input
+			continue
+		}
 
 		nctx, cancel := newCtx()
+		start := time.Now()
 		err = Run(nctx, code, ses)
 		cancel()
 		if err == query.ErrParseMore {
@@ -212,11 +285,65 @@ func Repl(ctx context.Context, h *graph.Handle, queryLanguage string, timeout ti
 			fmt.Println("Error: ", err)
 			code = ""
 		} else {
+			if timing {
+				fmt.Printf("Elapsed time: %v\n\n", time.Since(start))
+			}
 			code = ""
 		}
 	}
 }
 
+// openBrackets returns the number of brackets that are opened, but not yet closed in the code.
+// Brackets in string literals and comments are ignored.
+func openBrackets(code string) int {
+	n := 0
+	for i := 0; i < len(code); i++ {
+		switch c := code[i]; c {
+		case '(', '[', '{':
+			n++
+		case ')', ']', '}':
+			n--
+		case '"', '\'', '`':
+			// skip string literal
+			for i++; i < len(code) && code[i] != c; i++ {
+				if code[i] == '\\' {
+					i++
+				}
+			}
+		case '/':
+			if i+1 < len(code) && code[i+1] == '/' {
+				// skip line comment
+				for i < len(code) && code[i] != '\n' {
+					i++
+				}
+			}
+		case '#':
+			// comments in GraphQL
+			if i == 0 || code[i-1] == '\n' || code[i-1] == ' ' || code[i-1] == '\t' {
+				for i < len(code) && code[i] != '\n' {
+					i++
+				}
+			}
+		}
+	}
+	return n
+}
+
+// splitWord splits a line into a head and a word that should be completed.
+// Word consists of identifier characters and dots, e.g. "g.V().Ou" is split into "g.V()" and ".Ou".
+func splitWord(line string) (string, string) {
+	i := len(line)
+	for i > 0 {
+		c := line[i-1]
+		if c != '.' && c != '_' && c != '$' &&
+			(c < 'a' || c > 'z') && (c < 'A' || c > 'Z') && (c < '0' || c > '9') {
+			break
+		}
+		i--
+	}
+	return line[:i], line[i:]
+}
+
 // Splits a line into a command and its arguments
 // e.g. ":a b c d ." will be split into ":a" and " b c d ."
 func splitLine(line string) (string, string) {
@@ -245,7 +372,7 @@ func terminal(path string) (*liner.State, error) {
 		signal.Notify(c, os.Interrupt, os.Kill)
 		<-c
 
-		err := persist(term, history)
+		err := persist(term, path)
 		if err != nil {
 			fmt.Fprintf(os.Stderr, "failed to properly clean up terminal: %v\n", err)
 			os.Exit(1)
@@ -264,7 +391,8 @@ func terminal(path string) (*liner.State, error) {
 }
 
 func persist(term *liner.State, path string) error {
-	f, err := os.OpenFile(path, os.O_RDWR|os.O_APPEND|os.O_CREATE, 0666)
+	// liner keeps all the history loaded from the file, thus the file is rewritten
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_TRUNC|os.O_CREATE, 0666)
 	if err != nil {
 		return fmt.Errorf("could not open %q to append history: %v", path, err)
 	}
@@ -64,3 +64,44 @@ func TestSplitLines(t *testing.T) {
 		}
 	}
 }
+
+var testOpenBrackets = []struct {
+	code   string
+	expect int
+}{
+	{code: `g.V().All()`, expect: 0},
+	{code: `g.V("<alice>")`, expect: 0},
+	{code: `g.V().ForEach(function(d){`, expect: 2},
+	{code: "g.V().ForEach(function(d){\n  g.Emit(d)\n})", expect: 0},
+	{code: `g.V("(")`, expect: 0},
+	{code: `g.V('<a\'s>', "}")`, expect: 0},
+	{code: "var x = [ // ]", expect: 1},
+	{code: "{\n  nodes(first: 10){ # }\n", expect: 2},
+}
+
+func TestOpenBrackets(t *testing.T) {
+	for _, c := range testOpenBrackets {
+		if n := openBrackets(c.code); n != c.expect {
+			t.Errorf("unexpected number of brackets in %q: got: %d expected: %d", c.code, n, c.expect)
+		}
+	}
+}
+
+var testSplitWords = []struct {
+	line, head, word string
+}{
+	{line: "", head: "", word: ""},
+	{line: "g", head: "", word: "g"},
+	{line: "g.V", head: "", word: "g.V"},
+	{line: `g.V("<alice>").Ou`, head: `g.V("<alice>")`, word: ".Ou"},
+	{line: "x = p.", head: "x = ", word: "p."},
+}
+
+func TestSplitWord(t *testing.T) {
+	for _, c := range testSplitWords {
+		head, word := splitWord(c.line)
+		if head != c.head || word != c.word {
+			t.Errorf("Error splitting %q: got: %q, %q expected: %q, %q", c.line, head, word, c.head, c.word)
+		}
+	}
+}
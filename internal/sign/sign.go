@@ -0,0 +1,160 @@
+// Copyright 2017 The Cayley Authors. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package sign implements detached ed25519 signatures of quad dumps.
+//
+// Signatures are calculated over the SHA-256 of the file content, thus any change to the file,
+// including conversion to another format or compression, invalidates them. Keys and signatures
+// are stored in PEM files.
+package sign
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+
+	"golang.org/x/crypto/ed25519"
+)
+
+// Ext is an extension of a signature file. It is appended to the name of a signed file.
+const Ext = ".sig"
+
+const (
+	pemPrivateKey = "ED25519 PRIVATE KEY"
+	pemPublicKey  = "ED25519 PUBLIC KEY"
+	pemSignature  = "CAYLEY SIGNATURE"
+	hdrDigest     = "Digest"
+)
+
+// prefix separates signatures of files from any other data signed with the same key.
+const prefix = "cayley file sha256:"
+
+// ErrInvalidSignature is returned when the signature does not match the digest or the key.
+var ErrInvalidSignature = errors.New("sign: invalid signature")
+
+// GenerateKeys generates a new key pair and writes it to the name+".key" and name+".pub" files.
+// The private key file is only readable by the owner.
+func GenerateKeys(name string) error {
+	pub, priv, err := ed25519.GenerateKey(nil)
+	if err != nil {
+		return err
+	}
+	err = writePEM(name+".key", 0600, &pem.Block{Type: pemPrivateKey, Bytes: priv})
+	if err != nil {
+		return err
+	}
+	return writePEM(name+".pub", 0644, &pem.Block{Type: pemPublicKey, Bytes: pub})
+}
+
+// ReadPrivateKey reads the private key from a file written by GenerateKeys.
+func ReadPrivateKey(path string) (ed25519.PrivateKey, error) {
+	b, err := readPEM(path, pemPrivateKey)
+	if err != nil {
+		return nil, err
+	} else if len(b.Bytes) != ed25519.PrivateKeySize {
+		return nil, fmt.Errorf("sign: %s: invalid private key size", path)
+	}
+	return ed25519.PrivateKey(b.Bytes), nil
+}
+
+// ReadPublicKey reads the public key from a file written by GenerateKeys.
+func ReadPublicKey(path string) (ed25519.PublicKey, error) {
+	b, err := readPEM(path, pemPublicKey)
+	if err != nil {
+		return nil, err
+	} else if len(b.Bytes) != ed25519.PublicKeySize {
+		return nil, fmt.Errorf("sign: %s: invalid public key size", path)
+	}
+	return ed25519.PublicKey(b.Bytes), nil
+}
+
+// Digest calculates the digest of the file content that is signed by Sign.
+func Digest(r io.Reader) ([]byte, error) {
+	h := sha256.New()
+	if _, err := io.Copy(h, r); err != nil {
+		return nil, err
+	}
+	return h.Sum(nil), nil
+}
+
+// SignFile calculates the digest of the file and writes its signature to path+Ext.
+func SignFile(key ed25519.PrivateKey, path string) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	digest, err := Digest(f)
+	if err != nil {
+		return err
+	}
+	return Sign(key, path, digest)
+}
+
+func message(digest []byte) []byte {
+	return append([]byte(prefix), digest...)
+}
+
+// Sign signs the digest and writes the signature to path+Ext.
+func Sign(key ed25519.PrivateKey, path string, digest []byte) error {
+	sig := ed25519.Sign(key, message(digest))
+	return writePEM(path+Ext, 0644, &pem.Block{
+		Type:    pemSignature,
+		Headers: map[string]string{hdrDigest: hex.EncodeToString(digest)},
+		Bytes:   sig,
+	})
+}
+
+// Verify reads the signature from path+Ext and checks that it was made with the key over the digest.
+// It returns ErrInvalidSignature if the signature does not match.
+func Verify(key ed25519.PublicKey, path string, digest []byte) error {
+	b, err := readPEM(path+Ext, pemSignature)
+	if err != nil {
+		return err
+	}
+	if !ed25519.Verify(key, message(digest), b.Bytes) {
+		return ErrInvalidSignature
+	}
+	return nil
+}
+
+func writePEM(path string, mode os.FileMode, b *pem.Block) error {
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, mode)
+	if err != nil {
+		return err
+	}
+	if err = pem.Encode(f, b); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+func readPEM(path, typ string) (*pem.Block, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	b, _ := pem.Decode(bytes.TrimSpace(data))
+	if b == nil || b.Type != typ {
+		return nil, fmt.Errorf("sign: %s: expected %s", path, typ)
+	}
+	return b, nil
+}
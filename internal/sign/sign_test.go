@@ -0,0 +1,78 @@
+// Copyright 2017 The Cayley Authors. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package sign
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestSignVerify(t *testing.T) {
+	dir, err := ioutil.TempDir("", "cayley-sign")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	name := filepath.Join(dir, "test")
+	if err = GenerateKeys(name); err != nil {
+		t.Fatal(err)
+	}
+	priv, err := ReadPrivateKey(name + ".key")
+	if err != nil {
+		t.Fatal(err)
+	}
+	pub, err := ReadPublicKey(name + ".pub")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err = ReadPublicKey(name + ".key"); err == nil {
+		t.Fatal("private key was accepted as a public one")
+	}
+
+	dump := filepath.Join(dir, "data.nq")
+	if err = ioutil.WriteFile(dump, []byte("<a> <b> <c> .\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err = SignFile(priv, dump); err != nil {
+		t.Fatal(err)
+	}
+	digest, err := Digest(strings.NewReader("<a> <b> <c> .\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = Verify(pub, dump, digest); err != nil {
+		t.Fatal(err)
+	}
+	tampered := append([]byte{}, digest...)
+	tampered[0]++
+	if err = Verify(pub, dump, tampered); err != ErrInvalidSignature {
+		t.Fatalf("expected invalid signature, got: %v", err)
+	}
+
+	if err = GenerateKeys(name + "2"); err != nil {
+		t.Fatal(err)
+	}
+	other, err := ReadPublicKey(name + "2.pub")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = Verify(other, dump, digest); err != ErrInvalidSignature {
+		t.Fatalf("expected invalid signature, got: %v", err)
+	}
+}
@@ -0,0 +1,404 @@
+package quad
+
+import (
+	"crypto/sha1"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// DefaultSkolemPrefix is a default prefix of IRIs generated for blank nodes by Skolemize.
+const DefaultSkolemPrefix = "urn:genid:"
+
+// BlankNodeRenamer assigns new unique labels to blank nodes.
+//
+// The same label is always replaced with the same new label, thus the structure of the graph is preserved,
+// while blank nodes are not merged with blank nodes of other files that happen to use the same labels.
+// A single renamer can be shared by multiple readers to keep labels consistent across files.
+type BlankNodeRenamer struct {
+	prefix string
+
+	mu    sync.Mutex
+	names map[BNode]BNode
+}
+
+// NewBlankNodeRenamer creates a renamer with a random prefix for new labels.
+func NewBlankNodeRenamer() *BlankNodeRenamer {
+	return &BlankNodeRenamer{
+		prefix: string(RandomBlankNode()) + "_",
+		names:  make(map[BNode]BNode),
+	}
+}
+
+// Rename returns a new label for blank nodes. Other values are returned as-is.
+func (r *BlankNodeRenamer) Rename(v Value) Value {
+	b, ok := v.(BNode)
+	if !ok {
+		return v
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	nb, ok := r.names[b]
+	if !ok {
+		nb = BNode(fmt.Sprintf("%s%d", r.prefix, len(r.names)+1))
+		r.names[b] = nb
+	}
+	return nb
+}
+
+// RenameQuad renames all blank nodes of the quad.
+func (r *BlankNodeRenamer) RenameQuad(q Quad) Quad {
+	for _, d := range Directions {
+		if v := q.Get(d); v != nil {
+			q.Set(d, r.Rename(v))
+		}
+	}
+	return q
+}
+
+// Reader returns a reader that renames blank nodes of all quads read from rd.
+func (r *BlankNodeRenamer) Reader(rd Reader) Reader {
+	return &renameReader{r: rd, rn: r}
+}
+
+type renameReader struct {
+	r  Reader
+	rn *BlankNodeRenamer
+}
+
+func (r *renameReader) ReadQuad() (Quad, error) {
+	q, err := r.r.ReadQuad()
+	if err != nil {
+		return q, err
+	}
+	return r.rn.RenameQuad(q), nil
+}
+
+// Skolemize replaces all blank nodes with IRIs that consist of a given prefix and a hash of the node.
+// If prefix is empty, DefaultSkolemPrefix is used.
+//
+// Hashes only depend on the set of quads, but not on their order or original labels of blank nodes,
+// thus loading the same document twice produces the same IRIs instead of new anonymous nodes.
+func Skolemize(quads []Quad, prefix string) []Quad {
+	if prefix == "" {
+		prefix = DefaultSkolemPrefix
+	}
+	return replaceBlankNodes(quads, func(label string) Value {
+		return IRI(prefix + label)
+	})
+}
+
+// CanonicalBlankNodes replaces labels of blank nodes with labels that only depend on the set of quads,
+// the same way Skolemize does, but keeps them as blank nodes. It allows to compare sets of quads with blank nodes.
+func CanonicalBlankNodes(quads []Quad) []Quad {
+	return replaceBlankNodes(quads, func(label string) Value {
+		return BNode("c" + label)
+	})
+}
+
+// replaceBlankNodes replaces all blank nodes with values created from their canonical labels.
+func replaceBlankNodes(quads []Quad, conv func(label string) Value) []Quad {
+	labels := canonicalLabels(quads)
+	out := make([]Quad, len(quads))
+	for i, q := range quads {
+		for _, d := range Directions {
+			if b, ok := q.Get(d).(BNode); ok {
+				q.Set(d, conv(labels[b]))
+			}
+		}
+		out[i] = q
+	}
+	return out
+}
+
+// canonicalLabels calculates labels for blank nodes that only depend on the set of quads, but not on
+// original labels of blank nodes or the order of quads.
+//
+// Blank nodes are split into connected components that are labeled independently. In each component
+// the hash of every node is refined with hashes of its neighbours until the number of distinct hashes
+// stops growing. If some nodes still have the same hash, each of them is distinguished in turn and
+// the labeling that produces the smallest serialization of the component is chosen. Nodes that can be
+// swapped without changing the graph are only tried once.
+func canonicalLabels(quads []Quad) map[BNode]string {
+	set := make(map[Quad]struct{}, len(quads))
+	for _, q := range quads {
+		set[q] = struct{}{}
+	}
+	type result struct {
+		labels map[BNode]string
+		key    string
+	}
+	var res []result
+	for _, c := range bnodeComponents(quads) {
+		c.set = set
+		labels, key := c.search(nil)
+		res = append(res, result{labels: labels, key: key})
+	}
+	// identical components are interchangeable, thus the order of equal keys does not matter
+	sort.Slice(res, func(i, j int) bool {
+		return res[i].key < res[j].key
+	})
+	out := make(map[BNode]string)
+	copies := make(map[string]int)
+	for _, r := range res {
+		n := copies[r.key]
+		copies[r.key] = n + 1
+		ch := hashString(r.key)
+		for b, l := range r.labels {
+			l = hashString(ch + l)
+			if n != 0 {
+				l += fmt.Sprintf("_%d", n)
+			}
+			out[b] = l
+		}
+	}
+	return out
+}
+
+// bnodeComponent is a set of blank nodes connected by quads.
+type bnodeComponent struct {
+	quads []Quad
+	set   map[Quad]struct{}
+	nodes []BNode
+	uses  map[BNode][]int
+}
+
+// bnodeComponents splits blank nodes into connected components.
+func bnodeComponents(quads []Quad) []*bnodeComponent {
+	parent := make(map[BNode]BNode)
+	var find func(b BNode) BNode
+	find = func(b BNode) BNode {
+		p, ok := parent[b]
+		if !ok || p == b {
+			return b
+		}
+		p = find(p)
+		parent[b] = p
+		return p
+	}
+	var order []BNode
+	uses := make(map[BNode][]int)
+	for i, q := range quads {
+		var first BNode
+		for _, d := range Directions {
+			b, ok := q.Get(d).(BNode)
+			if !ok {
+				continue
+			}
+			if _, ok = uses[b]; !ok {
+				order = append(order, b)
+				parent[b] = b
+			}
+			if n := len(uses[b]); n == 0 || uses[b][n-1] != i {
+				uses[b] = append(uses[b], i)
+			}
+			if first == "" {
+				first = b
+			} else if r1, r2 := find(first), find(b); r1 != r2 {
+				parent[r2] = r1
+			}
+		}
+	}
+	byRoot := make(map[BNode]*bnodeComponent)
+	var out []*bnodeComponent
+	for _, b := range order {
+		r := find(b)
+		c := byRoot[r]
+		if c == nil {
+			c = &bnodeComponent{quads: quads, uses: make(map[BNode][]int)}
+			byRoot[r] = c
+			out = append(out, c)
+		}
+		c.nodes = append(c.nodes, b)
+		c.uses[b] = uses[b]
+	}
+	return out
+}
+
+// search finds labels of the component that produce the smallest serialization.
+// It returns the labels and the serialization.
+func (c *bnodeComponent) search(hashes map[BNode]string) (map[BNode]string, string) {
+	hashes = c.refine(hashes)
+	classes := make(map[string][]BNode)
+	tie, found := "", false
+	for _, b := range c.nodes {
+		h := hashes[b]
+		classes[h] = append(classes[h], b)
+		if len(classes[h]) > 1 && (!found || h < tie) {
+			tie, found = h, true
+		}
+	}
+	if !found {
+		return hashes, c.serialize(hashes)
+	}
+	var (
+		best    map[BNode]string
+		bestKey string
+		tried   []BNode
+	)
+next:
+	for _, b := range classes[tie] {
+		for _, t := range tried {
+			if c.swappable(b, t) {
+				continue next
+			}
+		}
+		tried = append(tried, b)
+		start := make(map[BNode]string, len(hashes))
+		for k, v := range hashes {
+			start[k] = v
+		}
+		start[b] = hashString(hashes[b] + "*")
+		labels, key := c.search(start)
+		if best == nil || key < bestKey {
+			best, bestKey = labels, key
+		}
+	}
+	return best, bestKey
+}
+
+// refine refines hashes of nodes with hashes of their neighbours until the number of distinct hashes stops growing.
+func (c *bnodeComponent) refine(hashes map[BNode]string) map[BNode]string {
+	distinct := countDistinct(hashes)
+	for round := 0; round <= len(c.nodes); round++ {
+		next := make(map[BNode]string, len(c.nodes))
+		for _, b := range c.nodes {
+			next[b] = hashNode(c.quads, c.uses[b], b, hashes)
+		}
+		hashes = next
+		n := countDistinct(hashes)
+		if n <= distinct || n == len(c.nodes) {
+			break
+		}
+		distinct = n
+	}
+	return hashes
+}
+
+// swappable checks if swapping two nodes maps the set of quads to itself.
+func (c *bnodeComponent) swappable(a, b BNode) bool {
+	swap := func(v Value) Value {
+		switch v {
+		case a:
+			return b
+		case b:
+			return a
+		}
+		return v
+	}
+	for _, uses := range [][]int{c.uses[a], c.uses[b]} {
+		for _, i := range uses {
+			q := c.quads[i]
+			for _, d := range Directions {
+				if v := q.Get(d); v != nil {
+					q.Set(d, swap(v))
+				}
+			}
+			if _, ok := c.set[q]; !ok {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+// serialize returns sorted quads of the component with blank nodes replaced by their labels.
+func (c *bnodeComponent) serialize(labels map[BNode]string) string {
+	seen := make(map[int]struct{})
+	var lines []string
+	for _, b := range c.nodes {
+		for _, i := range c.uses[b] {
+			if _, ok := seen[i]; ok {
+				continue
+			}
+			seen[i] = struct{}{}
+			q := c.quads[i]
+			for _, d := range Directions {
+				if b, ok := q.Get(d).(BNode); ok {
+					q.Set(d, BNode(labels[b]))
+				}
+			}
+			lines = append(lines, q.NQuad())
+		}
+	}
+	sort.Strings(lines)
+	return strings.Join(lines, "\n")
+}
+
+// hashNode hashes quads of a blank node, replacing the node itself with a fixed label and other
+// blank nodes with their hashes from the previous round.
+func hashNode(quads []Quad, uses []int, self BNode, prev map[BNode]string) string {
+	lines := make([]string, 0, len(uses))
+	for _, i := range uses {
+		q := quads[i]
+		for _, d := range Directions {
+			b, ok := q.Get(d).(BNode)
+			if !ok {
+				continue
+			}
+			if b == self {
+				q.Set(d, BNode("self"))
+			} else {
+				q.Set(d, BNode("h"+prev[b]))
+			}
+		}
+		lines = append(lines, q.NQuad())
+	}
+	sort.Strings(lines)
+	h := sha1.New()
+	io.WriteString(h, prev[self])
+	io.WriteString(h, strings.Join(lines, "\n"))
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+func hashString(s string) string {
+	h := sha1.Sum([]byte(s))
+	return hex.EncodeToString(h[:])
+}
+
+func countDistinct(hashes map[BNode]string) int {
+	seen := make(map[string]struct{}, len(hashes))
+	for _, h := range hashes {
+		seen[h] = struct{}{}
+	}
+	return len(seen)
+}
+
+// NewSkolemReader returns a reader that skolemizes blank nodes of all quads read from r, as Skolemize does.
+//
+// All quads are read into memory on the first call to ReadQuad.
+func NewSkolemReader(r Reader, prefix string) Reader {
+	return &skolemReader{r: r, prefix: prefix}
+}
+
+type skolemReader struct {
+	r      Reader
+	prefix string
+	quads  []Quad
+	err    error
+	done   bool
+}
+
+func (r *skolemReader) ReadQuad() (Quad, error) {
+	if !r.done {
+		r.done = true
+		quads, err := ReadAll(r.r)
+		if err != nil {
+			// labels of a partial document are not stable
+			r.err = err
+		} else {
+			r.quads = Skolemize(quads, r.prefix)
+		}
+	}
+	if r.err != nil {
+		return Quad{}, r.err
+	} else if len(r.quads) == 0 {
+		return Quad{}, io.EOF
+	}
+	q := r.quads[0]
+	r.quads = r.quads[1:]
+	return q, nil
+}
@@ -0,0 +1,171 @@
+package quad
+
+import (
+	"fmt"
+	"math/rand"
+	"sort"
+	"strings"
+	"testing"
+)
+
+func sortedStrings(quads []Quad) []string {
+	var out []string
+	for _, q := range quads {
+		out = append(out, q.NQuad())
+	}
+	sort.Strings(out)
+	return out
+}
+
+func TestSkolemize(t *testing.T) {
+	doc := func(a, b string) []Quad {
+		return []Quad{
+			{Subject: IRI("alice"), Predicate: IRI("address"), Object: BNode(a)},
+			{Subject: BNode(a), Predicate: IRI("city"), Object: String("Paris")},
+			{Subject: BNode(a), Predicate: IRI("geo"), Object: BNode(b)},
+			{Subject: BNode(b), Predicate: IRI("lat"), Object: Float(48.85)},
+		}
+	}
+	q1 := Skolemize(doc("b0", "b1"), "")
+	q2 := Skolemize(doc("x", "y"), "")
+	s1, s2 := sortedStrings(q1), sortedStrings(q2)
+	if strings.Join(s1, "\n") != strings.Join(s2, "\n") {
+		t.Fatalf("different results for the same document:\n%v\nvs\n%v", s1, s2)
+	}
+	for _, q := range q1 {
+		for _, d := range Directions {
+			if _, ok := q.Get(d).(BNode); ok {
+				t.Fatalf("blank node was not replaced: %v", q)
+			}
+		}
+	}
+	if q1[1].Subject != q1[0].Object || q1[2].Object != q1[3].Subject || q1[0].Object == q1[3].Subject {
+		t.Fatalf("graph structure is not preserved: %v", q1)
+	}
+	if iri, ok := q1[0].Object.(IRI); !ok || !strings.HasPrefix(string(iri), DefaultSkolemPrefix) {
+		t.Fatalf("unexpected value: %v", q1[0].Object)
+	}
+
+	// nodes with the same quads must not be merged
+	q3 := Skolemize([]Quad{
+		{Subject: IRI("alice"), Predicate: IRI("knows"), Object: BNode("a")},
+		{Subject: IRI("alice"), Predicate: IRI("knows"), Object: BNode("b")},
+	}, "genid:")
+	if q3[0].Object == q3[1].Object {
+		t.Fatalf("indistinguishable nodes were merged: %v", q3)
+	}
+}
+
+// symmetricDoc returns a document with blank nodes that can only be distinguished by their position in the graph.
+func symmetricDoc() []Quad {
+	var doc []Quad
+	add := func(s Value, p string, o Value) {
+		doc = append(doc, Quad{Subject: s, Predicate: IRI(p), Object: o})
+	}
+	// a star of indistinguishable nodes
+	add(IRI("alice"), "knows", BNode("c"))
+	for i := 0; i < 5; i++ {
+		add(BNode("c"), "knows", BNode(fmt.Sprint("l", i)))
+	}
+	// two identical cycles
+	for _, p := range []string{"x", "y"} {
+		for i := 0; i < 4; i++ {
+			add(BNode(fmt.Sprint(p, i)), "next", BNode(fmt.Sprint(p, (i+1)%4)))
+		}
+	}
+	// isolated nodes with the same quads
+	for i := 0; i < 3; i++ {
+		add(BNode(fmt.Sprint("i", i)), "name", String("bob"))
+	}
+	add(BNode("l0"), "name", String("carol"))
+	return doc
+}
+
+// shuffleDoc changes the order of quads and labels of blank nodes.
+func shuffleDoc(rnd *rand.Rand, doc []Quad) []Quad {
+	rn := NewBlankNodeRenamer()
+	out := make([]Quad, len(doc))
+	for i, j := range rnd.Perm(len(doc)) {
+		out[i] = rn.RenameQuad(doc[j])
+	}
+	return out
+}
+
+func countValues(quads []Quad, fnc func(v Value) bool) int {
+	seen := make(map[Value]struct{})
+	for _, q := range quads {
+		for _, d := range Directions {
+			if v := q.Get(d); v != nil && fnc(v) {
+				seen[v] = struct{}{}
+			}
+		}
+	}
+	return len(seen)
+}
+
+func TestSkolemizeShuffle(t *testing.T) {
+	doc := symmetricDoc()
+	exp := sortedStrings(Skolemize(doc, ""))
+	rnd := rand.New(rand.NewSource(1))
+	for i := 0; i < 20; i++ {
+		out := Skolemize(shuffleDoc(rnd, doc), "")
+		if n := countValues(out, func(v Value) bool {
+			iri, ok := v.(IRI)
+			return ok && strings.HasPrefix(string(iri), DefaultSkolemPrefix)
+		}); n != 17 {
+			t.Fatalf("expected %d distinct nodes, got %d", 17, n)
+		}
+		if got := sortedStrings(out); strings.Join(got, "\n") != strings.Join(exp, "\n") {
+			t.Fatalf("IRIs depend on the order of quads:\n%v\nvs\n%v", got, exp)
+		}
+	}
+}
+
+func TestCanonicalBlankNodesShuffle(t *testing.T) {
+	doc := symmetricDoc()
+	exp := sortedStrings(CanonicalBlankNodes(doc))
+	rnd := rand.New(rand.NewSource(2))
+	for i := 0; i < 20; i++ {
+		out := CanonicalBlankNodes(shuffleDoc(rnd, doc))
+		if n := countValues(out, func(v Value) bool {
+			_, ok := v.(BNode)
+			return ok
+		}); n != 17 {
+			t.Fatalf("expected %d distinct nodes, got %d", 17, n)
+		}
+		if got := sortedStrings(out); strings.Join(got, "\n") != strings.Join(exp, "\n") {
+			t.Fatalf("labels depend on the order of quads:\n%v\nvs\n%v", got, exp)
+		}
+	}
+}
+
+func TestBlankNodeRenamer(t *testing.T) {
+	quads := []Quad{
+		{Subject: BNode("a"), Predicate: IRI("knows"), Object: BNode("b")},
+		{Subject: BNode("b"), Predicate: IRI("knows"), Object: IRI("carol")},
+	}
+	read := func(rn *BlankNodeRenamer) []Quad {
+		out, err := ReadAll(rn.Reader(NewReader(quads)))
+		if err != nil {
+			t.Fatal(err)
+		}
+		return out
+	}
+	r1, r2 := read(NewBlankNodeRenamer()), read(NewBlankNodeRenamer())
+	if r1[0].Object != r1[1].Subject {
+		t.Fatalf("labels are not consistent: %v", r1)
+	}
+	if r1[0].Subject == BNode("a") || r1[0].Subject == r2[0].Subject {
+		t.Fatalf("labels are not unique: %v vs %v", r1, r2)
+	}
+	if r1[1].Object != IRI("carol") {
+		t.Fatalf("unexpected value: %v", r1[1].Object)
+	}
+
+	// a shared renamer keeps labels across files
+	rn := NewBlankNodeRenamer()
+	r1, r2 = read(rn), read(rn)
+	if r1[0].Subject != r2[0].Subject {
+		t.Fatalf("labels are not consistent across readers: %v vs %v", r1, r2)
+	}
+}
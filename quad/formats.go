@@ -25,6 +25,21 @@ type Format struct {
 	UnmarshalValue func(b []byte) (Value, error)
 }
 
+// NewSafeReader creates a format reader for r, that converts panics of the parser to errors.
+// See the NewSafeReader function for details.
+func (f *Format) NewSafeReader(r io.Reader) (qr ReadCloser, err error) {
+	if f.Reader == nil {
+		return nil, fmt.Errorf("format %s is not supported for reading", f.Name)
+	}
+	// some readers start parsing when created
+	defer func() {
+		if e := recover(); e != nil {
+			qr, err = nil, recoverError(e)
+		}
+	}()
+	return NewSafeReader(f.Reader(r)), nil
+}
+
 var (
 	formatsByName = make(map[string]*Format)
 	formatsByExt  = make(map[string]*Format)
@@ -0,0 +1,101 @@
+package quad
+
+import (
+	"crypto/sha1"
+	"crypto/sha256"
+	"fmt"
+	"hash"
+	"hash/fnv"
+	"sort"
+	"sync"
+)
+
+// Names of built-in value hash functions.
+const (
+	// HashSHA1 is a 160 bit SHA-1 hash. It is the default hash, used by HashOf and HashTo.
+	HashSHA1 = "sha1"
+	// HashSHA256 is a 256 bit SHA-256 hash. It reduces the risk of collisions for very large graphs.
+	HashSHA256 = "sha256"
+	// HashFNV128 is a 128 bit FNV-1a hash. It is fast, but not collision resistant, thus it should only be used on trusted data.
+	HashFNV128 = "fnv128a"
+)
+
+// Hasher is a named hash function for values.
+type Hasher struct {
+	name string
+	size int
+	pool sync.Pool
+}
+
+// Name returns a name the hash function was registered with.
+func (h *Hasher) Name() string { return h.name }
+
+// Size returns the size of a hash in bytes.
+func (h *Hasher) Size() int { return h.size }
+
+// HashOf calculates a hash of value v.
+func (h *Hasher) HashOf(v Value) []byte {
+	key := make([]byte, h.size)
+	h.HashTo(v, key)
+	return key
+}
+
+// HashTo calculates a hash of value v, storing it in a slice p.
+func (h *Hasher) HashTo(v Value, p []byte) {
+	if len(p) < h.size {
+		panic("buffer too small to fit the hash")
+	}
+	hf := h.pool.Get().(hash.Hash)
+	hf.Reset()
+	defer h.pool.Put(hf)
+	if v != nil {
+		hf.Write([]byte(v.String()))
+	}
+	hf.Sum(p[:0])
+}
+
+var hashers = struct {
+	sync.RWMutex
+	byName map[string]*Hasher
+}{byName: make(map[string]*Hasher)}
+
+// RegisterHasher adds a hash function for values with a given name.
+// The size must match the size of hashes returned by the function.
+func RegisterHasher(name string, newHash func() hash.Hash) *Hasher {
+	hs := &Hasher{name: name, size: newHash().Size()}
+	hs.pool.New = func() interface{} { return newHash() }
+	hashers.Lock()
+	defer hashers.Unlock()
+	if _, ok := hashers.byName[name]; ok {
+		panic(fmt.Errorf("hash function %q is already registered", name))
+	}
+	hashers.byName[name] = hs
+	return hs
+}
+
+// HasherByName returns a hash function registered with a given name, or nil if it is not registered.
+func HasherByName(name string) *Hasher {
+	hashers.RLock()
+	defer hashers.RUnlock()
+	return hashers.byName[name]
+}
+
+// Hashers returns names of all registered hash functions.
+func Hashers() []string {
+	hashers.RLock()
+	defer hashers.RUnlock()
+	out := make([]string, 0, len(hashers.byName))
+	for name := range hashers.byName {
+		out = append(out, name)
+	}
+	sort.Strings(out)
+	return out
+}
+
+// defaultHasher is the hash function used by HashOf.
+var defaultHasher = RegisterHasher(HashSHA1, sha1.New)
+
+func init() {
+	RegisterHasher(HashSHA256, sha256.New)
+	RegisterHasher(HashFNV128, fnv.New128a)
+}
@@ -0,0 +1,20 @@
+// +build gofuzz
+
+package jsonld
+
+import (
+	"bytes"
+
+	"github.com/cayleygraph/cayley/quad"
+)
+
+// Fuzz is an entry point for go-fuzz. Corpus seeds are located in testdata/corpus.
+//
+//	go-fuzz-build github.com/cayleygraph/cayley/quad/jsonld
+//	go-fuzz -bin=jsonld-fuzz.zip -workdir=quad/jsonld/testdata
+func Fuzz(data []byte) int {
+	if _, err := quad.ReadAll(NewReader(bytes.NewReader(data))); err != nil {
+		return 0
+	}
+	return 1
+}
@@ -0,0 +1,207 @@
+package neo4j
+
+import (
+	"encoding/csv"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/cayleygraph/cayley/quad"
+)
+
+type columnKind int
+
+const (
+	colProperty = columnKind(iota)
+	colID
+	colLabels
+	colStart
+	colEnd
+	colType
+	colIgnore
+)
+
+type column struct {
+	kind  columnKind
+	name  string // property name
+	typ   string // property type, as declared in the header
+	array bool
+}
+
+// parseColumn parses a header field. Both neo4j-admin import headers (name:int, :ID, :LABEL, :START_ID, etc)
+// and apoc.export.csv headers (_id, _labels, _start, _end, _type) are recognized.
+func parseColumn(field string) column {
+	switch field {
+	case "_id":
+		return column{kind: colID}
+	case "_labels":
+		return column{kind: colLabels}
+	case "_start":
+		return column{kind: colStart}
+	case "_end":
+		return column{kind: colEnd}
+	case "_type":
+		return column{kind: colType}
+	}
+	i := strings.LastIndexByte(field, ':')
+	if i < 0 {
+		return column{kind: colProperty, name: field}
+	}
+	name, typ := field[:i], field[i+1:]
+	// id spaces are not used: ids are expected to be unique across the whole export
+	if j := strings.IndexByte(typ, '('); j >= 0 {
+		typ = typ[:j]
+	}
+	switch strings.ToUpper(typ) {
+	case "ID":
+		return column{kind: colID}
+	case "LABEL":
+		return column{kind: colLabels}
+	case "START_ID":
+		return column{kind: colStart}
+	case "END_ID":
+		return column{kind: colEnd}
+	case "TYPE":
+		return column{kind: colType}
+	case "IGNORE":
+		return column{kind: colIgnore}
+	}
+	c := column{kind: colProperty, name: name, typ: strings.ToLower(typ)}
+	if strings.HasSuffix(c.typ, "[]") {
+		c.typ, c.array = strings.TrimSuffix(c.typ, "[]"), true
+	}
+	return c
+}
+
+// value converts a single field value according to the declared type.
+func (c column) value(s string) (quad.Value, error) {
+	switch c.typ {
+	case "", "string", "char":
+		return quad.String(s), nil
+	case "int", "long", "short", "byte":
+		v, err := strconv.ParseInt(s, 10, 64)
+		if err != nil {
+			return nil, err
+		}
+		return quad.Int(v), nil
+	case "float", "double":
+		v, err := strconv.ParseFloat(s, 64)
+		if err != nil {
+			return nil, err
+		}
+		return quad.Float(v), nil
+	case "boolean":
+		v, err := strconv.ParseBool(s)
+		if err != nil {
+			return nil, err
+		}
+		return quad.Bool(v), nil
+	case "datetime", "date", "localdatetime":
+		for _, layout := range []string{time.RFC3339Nano, "2006-01-02T15:04:05", "2006-01-02"} {
+			if t, err := time.Parse(layout, s); err == nil {
+				return quad.Time(t), nil
+			}
+		}
+	}
+	// keep unknown types as strings
+	return quad.String(s), nil
+}
+
+// splitLabels splits node labels separated by ';' (neo4j-admin) or ':' (APOC).
+func splitLabels(s string) []string {
+	return strings.FieldsFunc(s, func(r rune) bool { return r == ';' || r == ':' })
+}
+
+// NewCSVReader creates a reader for a CSV file with nodes or relationships, or both.
+//
+// Files produced by apoc.export.csv contain both nodes and relationships, while
+// neo4j-admin import uses separate files for each. In the latter case, read all node and
+// relationship files, each with a separate reader. Array values are separated by ';'.
+func NewCSVReader(r io.Reader, m *Mapping) *CSVReader {
+	cr := csv.NewReader(r)
+	cr.FieldsPerRecord = -1
+	return &CSVReader{r: cr, c: converter{m: m}}
+}
+
+// CSVReader decodes Neo4j CSV exports into quads.
+type CSVReader struct {
+	r    *csv.Reader
+	c    converter
+	cols []column
+	n    int // number of records read, including the header
+	err  error
+}
+
+func (r *CSVReader) read() error {
+	rec, err := r.r.Read()
+	if err != nil {
+		return err
+	}
+	r.n++
+	if r.cols == nil {
+		r.cols = make([]column, 0, len(rec))
+		for _, f := range rec {
+			r.cols = append(r.cols, parseColumn(f))
+		}
+		return nil
+	}
+	var (
+		id, start, end, typ string
+		labels              []string
+		props               []property
+	)
+	for i, s := range rec {
+		if i >= len(r.cols) {
+			break
+		}
+		c := r.cols[i]
+		switch c.kind {
+		case colID:
+			id = s
+		case colLabels:
+			labels = splitLabels(s)
+		case colStart:
+			start = s
+		case colEnd:
+			end = s
+		case colType:
+			typ = s
+		case colProperty:
+			if s == "" {
+				continue
+			}
+			vals := []string{s}
+			if c.array {
+				vals = strings.Split(s, ";")
+			}
+			p := property{name: c.name}
+			for _, sv := range vals {
+				v, err := c.value(sv)
+				if err != nil {
+					return fmt.Errorf("neo4j: record %d: property %q: %v", r.n, c.name, err)
+				}
+				p.values = append(p.values, v)
+			}
+			props = append(props, p)
+		}
+	}
+	if start != "" || end != "" || typ != "" {
+		return r.c.addRelationship(start, typ, end, props)
+	}
+	return r.c.addNode(id, labels, props)
+}
+
+// ReadQuad implements quad.Reader.
+func (r *CSVReader) ReadQuad() (quad.Quad, error) {
+	if r.err != nil {
+		return quad.Quad{}, r.err
+	}
+	q, err := r.c.next(r.read)
+	r.err = err
+	return q, err
+}
+
+// Close implements quad.Reader.
+func (r *CSVReader) Close() error { return nil }
@@ -0,0 +1,249 @@
+// Package neo4j provides decoders for property graphs exported from Neo4j.
+//
+// Both CSV exports (neo4j-admin import files or apoc.export.csv) and APOC JSON exports are supported.
+// Nodes and relationships are converted to quads according to a Mapping:
+//
+//	node labels    -> <node> <rdf:type> <Label> .
+//	node property  -> <node> <name> "value" .
+//	relationship   -> <start> <TYPE> <end> .
+//	rel. property  -> << <start> <TYPE> <end> >> <name> "value" .
+//
+// Relationship properties are attached to RDF-star quoted triples.
+package neo4j
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"sort"
+
+	"github.com/cayleygraph/cayley/quad"
+	"github.com/cayleygraph/cayley/voc/rdf"
+)
+
+func init() {
+	quad.RegisterFormat(quad.Format{
+		Name:   "neo4j-csv",
+		Reader: func(r io.Reader) quad.ReadCloser { return NewCSVReader(r, nil) },
+	})
+	quad.RegisterFormat(quad.Format{
+		Name:   "neo4j-json",
+		Reader: func(r io.Reader) quad.ReadCloser { return NewJSONReader(r, nil) },
+	})
+}
+
+// Mapping describes how elements of a property graph are converted to quads.
+// A nil or zero Mapping is valid and uses defaults described for each field.
+type Mapping struct {
+	// NodePrefix is prepended to node ids to form node IRIs. Nodes are blank nodes if prefix is empty.
+	NodePrefix string
+	// LabelPredicate is a predicate used for node labels. Default is rdf:type.
+	LabelPredicate quad.IRI
+	// LabelPrefix is prepended to node labels to form class IRIs.
+	LabelPrefix string
+	// PropertyPrefix is prepended to property names and relationship types to form predicate IRIs.
+	PropertyPrefix string
+	// Predicates overrides predicates for specific property names and relationship types.
+	Predicates map[string]quad.IRI
+}
+
+func (m *Mapping) node(id string) quad.Value {
+	if m == nil || m.NodePrefix == "" {
+		return quad.BNode(id)
+	}
+	return quad.IRI(m.NodePrefix + id)
+}
+
+func (m *Mapping) labelPredicate() quad.IRI {
+	if m == nil || m.LabelPredicate == "" {
+		return quad.IRI(rdf.Type)
+	}
+	return m.LabelPredicate
+}
+
+func (m *Mapping) label(name string) quad.IRI {
+	if m == nil {
+		return quad.IRI(name)
+	}
+	return quad.IRI(m.LabelPrefix + name)
+}
+
+func (m *Mapping) predicate(name string) quad.IRI {
+	if m == nil {
+		return quad.IRI(name)
+	} else if p, ok := m.Predicates[name]; ok {
+		return p
+	}
+	return quad.IRI(m.PropertyPrefix + name)
+}
+
+// property is a single property of a node or relationship. Arrays are stored as multiple values.
+type property struct {
+	name   string
+	values []quad.Value
+}
+
+// converter buffers quads produced from nodes and relationships.
+type converter struct {
+	m   *Mapping
+	buf []quad.Quad
+}
+
+func (c *converter) addProps(s quad.Value, props []property) {
+	for _, p := range props {
+		pred := c.m.predicate(p.name)
+		for _, v := range p.values {
+			c.buf = append(c.buf, quad.Quad{Subject: s, Predicate: pred, Object: v})
+		}
+	}
+}
+
+func (c *converter) addNode(id string, labels []string, props []property) error {
+	if id == "" {
+		return fmt.Errorf("neo4j: node id is not set")
+	}
+	n := c.m.node(id)
+	for _, l := range labels {
+		c.buf = append(c.buf, quad.Quad{Subject: n, Predicate: c.m.labelPredicate(), Object: c.m.label(l)})
+	}
+	c.addProps(n, props)
+	return nil
+}
+
+func (c *converter) addRelationship(start, typ, end string, props []property) error {
+	if start == "" || end == "" {
+		return fmt.Errorf("neo4j: relationship must have both start and end nodes")
+	} else if typ == "" {
+		return fmt.Errorf("neo4j: relationship type is not set")
+	}
+	q := quad.Quad{Subject: c.m.node(start), Predicate: c.m.predicate(typ), Object: c.m.node(end)}
+	c.buf = append(c.buf, q)
+	if len(props) != 0 {
+		c.addProps(quad.QuotedTriple{Subject: q.Subject, Predicate: q.Predicate, Object: q.Object}, props)
+	}
+	return nil
+}
+
+// next returns the next buffered quad, calling read to fill the buffer when it is empty.
+func (c *converter) next(read func() error) (quad.Quad, error) {
+	for len(c.buf) == 0 {
+		if err := read(); err != nil {
+			return quad.Quad{}, err
+		}
+	}
+	q := c.buf[0]
+	c.buf = c.buf[1:]
+	return q, nil
+}
+
+// NewJSONReader creates a reader for a JSON export produced by apoc.export.json.
+// Export contains one JSON object per node or relationship.
+func NewJSONReader(r io.Reader, m *Mapping) *JSONReader {
+	dec := json.NewDecoder(r)
+	dec.UseNumber()
+	return &JSONReader{dec: dec, c: converter{m: m}}
+}
+
+// JSONReader decodes APOC JSON exports into quads.
+type JSONReader struct {
+	dec *json.Decoder
+	c   converter
+	err error
+}
+
+// elementID accepts both numeric and string ids of nodes and relationships.
+type elementID string
+
+func (id *elementID) UnmarshalJSON(b []byte) error {
+	var v interface{}
+	if err := json.Unmarshal(b, &v); err != nil {
+		return err
+	}
+	*id = elementID(fmt.Sprint(v))
+	return nil
+}
+
+type apocElement struct {
+	Type       string                 `json:"type"`
+	ID         elementID              `json:"id"`
+	Labels     []string               `json:"labels"`
+	Label      string                 `json:"label"` // relationship type
+	Properties map[string]interface{} `json:"properties"`
+	Start      *apocElement           `json:"start"`
+	End        *apocElement           `json:"end"`
+}
+
+func (r *JSONReader) read() error {
+	var e apocElement
+	if err := r.dec.Decode(&e); err != nil {
+		return err
+	}
+	props := jsonProps(e.Properties)
+	switch e.Type {
+	case "node":
+		return r.c.addNode(string(e.ID), e.Labels, props)
+	case "relationship":
+		if e.Start == nil || e.End == nil {
+			return r.c.addRelationship("", e.Label, "", props)
+		}
+		return r.c.addRelationship(string(e.Start.ID), e.Label, string(e.End.ID), props)
+	}
+	return fmt.Errorf("neo4j: unsupported element type: %q", e.Type)
+}
+
+// ReadQuad implements quad.Reader.
+func (r *JSONReader) ReadQuad() (quad.Quad, error) {
+	if r.err != nil {
+		return quad.Quad{}, r.err
+	}
+	q, err := r.c.next(r.read)
+	r.err = err
+	return q, err
+}
+
+// Close implements quad.Reader.
+func (r *JSONReader) Close() error { return nil }
+
+func jsonProps(m map[string]interface{}) []property {
+	names := make([]string, 0, len(m))
+	for name := range m {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	props := make([]property, 0, len(names))
+	for _, name := range names {
+		var vals []quad.Value
+		if arr, ok := m[name].([]interface{}); ok {
+			for _, v := range arr {
+				if qv := jsonValue(v); qv != nil {
+					vals = append(vals, qv)
+				}
+			}
+		} else if qv := jsonValue(m[name]); qv != nil {
+			vals = append(vals, qv)
+		}
+		if len(vals) != 0 {
+			props = append(props, property{name: name, values: vals})
+		}
+	}
+	return props
+}
+
+func jsonValue(v interface{}) quad.Value {
+	switch v := v.(type) {
+	case nil:
+		return nil
+	case string:
+		return quad.String(v)
+	case bool:
+		return quad.Bool(v)
+	case json.Number:
+		if i, err := v.Int64(); err == nil {
+			return quad.Int(i)
+		} else if f, err := v.Float64(); err == nil {
+			return quad.Float(f)
+		}
+		return quad.String(v.String())
+	}
+	return quad.String(fmt.Sprint(v))
+}
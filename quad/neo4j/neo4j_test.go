@@ -0,0 +1,89 @@
+package neo4j_test
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/cayleygraph/cayley/quad"
+	"github.com/cayleygraph/cayley/quad/neo4j"
+	"github.com/cayleygraph/cayley/voc/rdf"
+)
+
+var mapping = &neo4j.Mapping{
+	NodePrefix:     "node/",
+	LabelPrefix:    "class/",
+	PropertyPrefix: "prop/",
+	Predicates:     map[string]quad.IRI{"KNOWS": "foaf:knows"},
+}
+
+var (
+	alice = quad.IRI("node/1")
+	bob   = quad.IRI("node/2")
+	knows = quad.Quad{Subject: alice, Predicate: quad.IRI("foaf:knows"), Object: bob}
+)
+
+var expectQuads = []quad.Quad{
+	{Subject: alice, Predicate: quad.IRI(rdf.Type), Object: quad.IRI("class/User")},
+	{Subject: alice, Predicate: quad.IRI(rdf.Type), Object: quad.IRI("class/Admin")},
+	{Subject: alice, Predicate: quad.IRI("prop/age"), Object: quad.Int(30)},
+	{Subject: alice, Predicate: quad.IRI("prop/name"), Object: quad.String("Alice")},
+	{Subject: bob, Predicate: quad.IRI(rdf.Type), Object: quad.IRI("class/User")},
+	{Subject: bob, Predicate: quad.IRI("prop/name"), Object: quad.String("Bob")},
+	knows,
+	{
+		Subject:   quad.QuotedTriple{Subject: knows.Subject, Predicate: knows.Predicate, Object: knows.Object},
+		Predicate: quad.IRI("prop/since"), Object: quad.Int(2001),
+	},
+}
+
+func readAll(t *testing.T, r quad.Reader) []quad.Quad {
+	quads, err := quad.ReadAll(r)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return quads
+}
+
+func TestCSVReader(t *testing.T) {
+	nodes := `:ID,:LABEL,age:int,name
+1,User;Admin,30,Alice
+2,User,,Bob
+`
+	rels := `:START_ID,:END_ID,:TYPE,since:long
+1,2,KNOWS,2001
+`
+	got := readAll(t, neo4j.NewCSVReader(strings.NewReader(nodes), mapping))
+	got = append(got, readAll(t, neo4j.NewCSVReader(strings.NewReader(rels), mapping))...)
+	if !reflect.DeepEqual(got, expectQuads) {
+		t.Fatalf("unexpected quads:\n%v\nvs\n%v", got, expectQuads)
+	}
+}
+
+func TestAPOCCSVReader(t *testing.T) {
+	data := `"_id","_labels","age","name","since","_start","_end","_type"
+"1",":User:Admin","30","Alice",,,,
+"2",":User",,"Bob",,,,
+,,,,"2001","1","2","KNOWS"
+`
+	got := readAll(t, neo4j.NewCSVReader(strings.NewReader(data), mapping))
+	exp := make([]quad.Quad, len(expectQuads))
+	copy(exp, expectQuads)
+	// APOC CSV exports are not typed
+	exp[2].Object = quad.String("30")
+	exp[7].Object = quad.String("2001")
+	if !reflect.DeepEqual(got, exp) {
+		t.Fatalf("unexpected quads:\n%v\nvs\n%v", got, exp)
+	}
+}
+
+func TestJSONReader(t *testing.T) {
+	data := `{"type":"node","id":"1","labels":["User","Admin"],"properties":{"name":"Alice","age":30}}
+{"type":"node","id":"2","labels":["User"],"properties":{"name":"Bob"}}
+{"type":"relationship","id":"0","label":"KNOWS","properties":{"since":2001},"start":{"id":"1","labels":["User"]},"end":{"id":2,"labels":["User"]}}
+`
+	got := readAll(t, neo4j.NewJSONReader(strings.NewReader(data), mapping))
+	if !reflect.DeepEqual(got, expectQuads) {
+		t.Fatalf("unexpected quads:\n%v\nvs\n%v", got, expectQuads)
+	}
+}
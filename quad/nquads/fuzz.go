@@ -0,0 +1,23 @@
+// +build gofuzz
+
+package nquads
+
+import (
+	"bytes"
+
+	"github.com/cayleygraph/cayley/quad"
+)
+
+// Fuzz is an entry point for go-fuzz. Corpus seeds are located in testdata/corpus.
+//
+//	go-fuzz-build github.com/cayleygraph/cayley/quad/nquads
+//	go-fuzz -bin=nquads-fuzz.zip -workdir=quad/nquads/testdata
+func Fuzz(data []byte) int {
+	ret := 0
+	for _, raw := range []bool{false, true} {
+		if _, err := quad.ReadAll(NewReader(bytes.NewReader(data), raw)); err == nil {
+			ret = 1
+		}
+	}
+	return ret
+}
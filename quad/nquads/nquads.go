@@ -22,6 +22,9 @@
 // with the exception that parser will allow relative IRI values,
 // which are prohibited by the N-Quads quad-Quads specifications.
 //
+// Typed parser also accepts RDF-star quoted triples (<< s p o >>) as a subject
+// or an object, see ParseStar.
+//
 // For a complete definition of the grammar, see cquads.rl and nquads.rl.
 package nquads
 
@@ -31,6 +34,7 @@ import (
 	"fmt"
 	"io"
 	"strconv"
+	"unicode/utf8"
 
 	"github.com/cayleygraph/cayley/quad"
 )
@@ -61,24 +65,27 @@ func init() {
 			}
 			return []byte(v.String()), nil
 		},
-		UnmarshalValue: func(b []byte) (quad.Value, error) {
-			// TODO: proper parser for a single value
-			r := NewReader(bytes.NewReader(bytes.Join([][]byte{
-				[]byte("<s> <p> "),
-				b,
-				[]byte(" <l> .\n"),
-			}, nil)), false)
-			q, err := r.ReadQuad()
-			if err == io.EOF {
-				return nil, quad.ErrInvalid
-			} else if err != nil {
-				return nil, err
-			}
-			return q.Object, nil
-		},
+		UnmarshalValue: UnmarshalValue,
 	})
 }
 
+// UnmarshalValue parses a single value in the form returned by quad.Value.String.
+func UnmarshalValue(b []byte) (quad.Value, error) {
+	// TODO: proper parser for a single value
+	r := NewReader(bytes.NewReader(bytes.Join([][]byte{
+		[]byte("<s> <p> "),
+		b,
+		[]byte(" <l> .\n"),
+	}, nil)), false)
+	q, err := r.ReadQuad()
+	if err == io.EOF {
+		return nil, quad.ErrInvalid
+	} else if err != nil {
+		return nil, err
+	}
+	return q.Object, nil
+}
+
 // Reader implements N-Quad document parsing according to the RDF
 // 1.1 N-Quads specification.
 type Reader struct {
@@ -120,7 +127,7 @@ func (dec *Reader) ReadQuad() (quad.Quad, error) {
 	if dec.raw {
 		q, err = ParseRaw(string(line))
 	} else {
-		q, err = Parse(string(line))
+		q, err = ParseStar(string(line))
 	}
 	if err != nil {
 		return quad.Quad{}, fmt.Errorf("failed to parse %q: %v", dec.line, err)
@@ -176,19 +183,11 @@ func unEscape(r []rune, spec int, isQuoted, isEscaped bool) quad.Value {
 				case '\\':
 					c = '\\'
 				case 'u':
-					rc, err := strconv.ParseInt(string(r[i+1:i+5]), 16, 32)
-					if err != nil {
-						panic(fmt.Errorf("internal parser error: %v", err))
-					}
-					buf.WriteRune(rune(rc))
+					buf.WriteRune(unHex(r[i+1 : i+5]))
 					i += 5
 					continue
 				case 'U':
-					rc, err := strconv.ParseInt(string(r[i+1:i+9]), 16, 32)
-					if err != nil {
-						panic(fmt.Errorf("internal parser error: %v", err))
-					}
-					buf.WriteRune(rune(rc))
+					buf.WriteRune(unHex(r[i+1 : i+9]))
 					i += 9
 					continue
 				}
@@ -229,6 +228,16 @@ func unEscape(r []rune, spec int, isQuoted, isEscaped bool) quad.Value {
 	return quad.Raw(string(raw))
 }
 
+// unHex decodes a code point of \u or \U escape sequence.
+// Values that are not valid code points are replaced with utf8.RuneError.
+func unHex(r []rune) rune {
+	rc, err := strconv.ParseUint(string(r), 16, 32)
+	if err != nil || !utf8.ValidRune(rune(rc)) {
+		return utf8.RuneError
+	}
+	return rune(rc)
+}
+
 func unEscapeRaw(r []rune, isEscaped bool) quad.Value {
 	if !isEscaped {
 		return quad.Raw(string(r))
@@ -259,19 +268,11 @@ func unEscapeRaw(r []rune, isEscaped bool) quad.Value {
 			case '\\':
 				c = '\\'
 			case 'u':
-				rc, err := strconv.ParseInt(string(r[i+1:i+5]), 16, 32)
-				if err != nil {
-					panic(fmt.Errorf("internal parser error: %v", err))
-				}
-				buf.WriteRune(rune(rc))
+				buf.WriteRune(unHex(r[i+1 : i+5]))
 				i += 5
 				continue
 			case 'U':
-				rc, err := strconv.ParseInt(string(r[i+1:i+9]), 16, 32)
-				if err != nil {
-					panic(fmt.Errorf("internal parser error: %v", err))
-				}
-				buf.WriteRune(rune(rc))
+				buf.WriteRune(unHex(r[i+1 : i+9]))
 				i += 9
 				continue
 			}
@@ -0,0 +1,164 @@
+// Copyright 2017 The Cayley Authors. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package nquads
+
+import (
+	"errors"
+	"strconv"
+	"strings"
+
+	"github.com/cayleygraph/cayley/quad"
+)
+
+// RDF-star support is implemented as a pass before the generated parser: quoted triples
+// are parsed recursively and replaced with placeholder blank nodes in the statement.
+
+// starPlaceholder is a prefix of blank nodes that replace quoted triples in a statement.
+const starPlaceholder = "cayley-quoted-triple-"
+
+var errQuotedPosition = errors.New("quoted triple is only allowed as a subject or an object")
+
+func init() {
+	quad.RegisterStringConversion(quad.QuotedTripleType, ParseQuotedTriple)
+}
+
+// ParseQuotedTriple parses an RDF-star quoted triple (ex: << <s> <p> <o> >>).
+func ParseQuotedTriple(s string) (quad.Value, error) {
+	s = strings.TrimSpace(s)
+	if !strings.HasPrefix(s, "<<") || !strings.HasSuffix(s, ">>") {
+		return nil, quad.ErrInvalid
+	}
+	q, err := ParseStar(s[2:len(s)-2] + " .")
+	if err != nil {
+		return nil, err
+	} else if q.Label != nil {
+		return nil, quad.ErrInvalid
+	}
+	return quad.QuotedTriple{Subject: q.Subject, Predicate: q.Predicate, Object: q.Object}, nil
+}
+
+// ParseStar is the same as Parse, but also accepts RDF-star quoted triples as a subject or an object.
+func ParseStar(statement string) (quad.Quad, error) {
+	if !strings.Contains(statement, "<<") {
+		return Parse(statement)
+	}
+	var (
+		quoted []quad.Value
+		buf    = make([]byte, 0, len(statement))
+	)
+	for i := 0; i < len(statement); {
+		switch {
+		case statement[i] == '"':
+			j := skipLiteral(statement, i)
+			buf = append(buf, statement[i:j]...)
+			i = j
+		case strings.HasPrefix(statement[i:], "<<"):
+			j, err := matchQuoted(statement, i)
+			if err != nil {
+				return quad.Quad{}, err
+			}
+			v, err := ParseQuotedTriple(statement[i:j])
+			if err != nil {
+				return quad.Quad{}, err
+			}
+			buf = append(buf, " _:"+starPlaceholder+strconv.Itoa(len(quoted))+" "...)
+			quoted = append(quoted, v)
+			i = j
+		case statement[i] == '<':
+			j := skipIRI(statement, i)
+			buf = append(buf, statement[i:j]...)
+			i = j
+		default:
+			buf = append(buf, statement[i])
+			i++
+		}
+	}
+	q, err := Parse(string(buf))
+	if err != nil {
+		return quad.Quad{}, err
+	}
+	if _, ok := quotedIndex(q.Predicate, len(quoted)); ok {
+		return quad.Quad{}, errQuotedPosition
+	} else if _, ok = quotedIndex(q.Label, len(quoted)); ok {
+		return quad.Quad{}, errQuotedPosition
+	}
+	if i, ok := quotedIndex(q.Subject, len(quoted)); ok {
+		q.Subject = quoted[i]
+	}
+	if i, ok := quotedIndex(q.Object, len(quoted)); ok {
+		q.Object = quoted[i]
+	}
+	return q, nil
+}
+
+// quotedIndex returns an index of quoted triple, if the value is a placeholder.
+func quotedIndex(v quad.Value, n int) (int, bool) {
+	b, ok := v.(quad.BNode)
+	if !ok || !strings.HasPrefix(string(b), starPlaceholder) {
+		return 0, false
+	}
+	i, err := strconv.Atoi(string(b[len(starPlaceholder):]))
+	if err != nil || i < 0 || i >= n {
+		return 0, false
+	}
+	return i, true
+}
+
+// skipLiteral returns an index after the end of a string literal starting at i.
+// Invalid literals are left for the parser to report.
+func skipLiteral(s string, i int) int {
+	for i++; i < len(s); i++ {
+		switch s[i] {
+		case '\\':
+			i++
+		case '"':
+			return i + 1
+		}
+	}
+	return len(s)
+}
+
+// skipIRI returns an index after the end of an IRI starting at i.
+func skipIRI(s string, i int) int {
+	if j := strings.IndexByte(s[i:], '>'); j >= 0 {
+		return i + j + 1
+	}
+	return len(s)
+}
+
+// matchQuoted returns an index after the end of a quoted triple starting at i.
+func matchQuoted(s string, i int) (int, error) {
+	depth := 0
+	for i < len(s) {
+		switch {
+		case s[i] == '"':
+			i = skipLiteral(s, i)
+		case strings.HasPrefix(s[i:], "<<"):
+			depth++
+			i += 2
+		case strings.HasPrefix(s[i:], ">>"):
+			depth--
+			i += 2
+			if depth == 0 {
+				return i, nil
+			}
+		case s[i] == '<':
+			i = skipIRI(s, i)
+		default:
+			i++
+		}
+	}
+	return 0, quad.ErrIncomplete
+}
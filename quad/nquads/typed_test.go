@@ -646,6 +646,58 @@ func TestParse(t *testing.T) {
 	}
 }
 
+var testStarQuads = []struct {
+	message string
+	input   string
+	expect  quad.Quad
+	err     error
+}{
+	{
+		message: "parse quoted triple as a subject",
+		input:   `<< <alice> <knows> <bob> >> <source> "met in <<Paris>>" <graph> .`,
+		expect: quad.Quad{
+			Subject:   quad.QuotedTriple{Subject: quad.IRI("alice"), Predicate: quad.IRI("knows"), Object: quad.IRI("bob")},
+			Predicate: quad.IRI("source"),
+			Object:    quad.String("met in <<Paris>>"),
+			Label:     quad.IRI("graph"),
+		},
+	},
+	{
+		message: "parse nested quoted triple as an object",
+		input:   `<carol> <says> <<<< _:a <knows> "b" >> <since> "2001"^^<int>>> .`,
+		expect: quad.Quad{
+			Subject:   quad.IRI("carol"),
+			Predicate: quad.IRI("says"),
+			Object: quad.QuotedTriple{
+				Subject:   quad.QuotedTriple{Subject: quad.BNode("a"), Predicate: quad.IRI("knows"), Object: quad.String("b")},
+				Predicate: quad.IRI("since"),
+				Object:    quad.TypedString{Value: "2001", Type: "int"},
+			},
+		},
+	},
+	{
+		message: "reject quoted triple as a predicate",
+		input:   `<a> << <s> <p> <o> >> <b> .`,
+		err:     errQuotedPosition,
+	},
+	{
+		message: "reject incomplete quoted triple",
+		input:   `<< <s> <p> <o> <a> <b> .`,
+		err:     quad.ErrIncomplete,
+	},
+}
+
+func TestParseStar(t *testing.T) {
+	for _, test := range testStarQuads {
+		got, err := ParseStar(test.input)
+		if err != test.err {
+			t.Errorf("Unexpected error when %s: got:%v expect:%v", test.message, err, test.err)
+		} else if !reflect.DeepEqual(got, test.expect) {
+			t.Errorf("Failed to %s, %q,\ngot:%#v\nexpect:%#v", test.message, test.input, got, test.expect)
+		}
+	}
+}
+
 // This is a sample taken from 30kmoviedata.nq.
 // It has intentional defects:
 // The second comment is inset one space and
@@ -824,6 +876,11 @@ var escapeSequenceTests = []struct {
 	{input: `\U000000b7\r`, expect: "·\r"},
 	{input: `\u00b7\f\U000000b7`, expect: "·\f·"},
 	{input: `\U000000b7\\\u00b7`, expect: "·\\·"},
+
+	// invalid code points
+	{input: `\UFFFFFFFF`, expect: "\uFFFD"},
+	{input: `\U00110000`, expect: "\uFFFD"},
+	{input: `a\uD800b`, expect: "a\uFFFDb"},
 }
 
 func TestUnescape(t *testing.T) {
@@ -846,17 +903,21 @@ func BenchmarkParser(b *testing.B) {
 func TestValueEncoding(t *testing.T) {
 	vals := []quad.Value{
 		quad.String("some val"),
+		quad.String("esc \"val\"\n"),
 		quad.IRI("iri"),
 		quad.BNode("bnode"),
 		quad.TypedString{Value: "10", Type: "int"},
 		quad.LangString{Value: "val", Lang: "en"},
+		quad.QuotedTriple{Subject: quad.IRI("s"), Predicate: quad.IRI("p"), Object: quad.String("o")},
 	}
 	enc := []string{
 		`"some val"`,
+		`"esc \"val\"\n"`,
 		`<iri>`,
 		`_:bnode`,
 		`"10"^^<int>`,
 		`"val"@en`,
+		`<< <s> <p> "o" >>`,
 	}
 	f := quad.FormatByName("nquads")
 	for i, v := range vals {
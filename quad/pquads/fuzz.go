@@ -0,0 +1,20 @@
+// +build gofuzz
+
+package pquads
+
+import (
+	"bytes"
+
+	"github.com/cayleygraph/cayley/quad"
+)
+
+// Fuzz is an entry point for go-fuzz. Corpus seeds are located in testdata/corpus.
+//
+//	go-fuzz-build github.com/cayleygraph/cayley/quad/pquads
+//	go-fuzz -bin=pquads-fuzz.zip -workdir=quad/pquads/testdata
+func Fuzz(data []byte) int {
+	if _, err := quad.ReadAll(NewReader(bytes.NewReader(data), DefaultMaxSize)); err != nil {
+		return 0
+	}
+	return 1
+}
@@ -47,6 +47,10 @@ func MakeValue(qv quad.Value) *Value {
 			Seconds: seconds,
 			Nanos:   nanos,
 		}}}
+	case quad.QuotedTriple:
+		return MakeValue(v.TypedString())
+	case quad.Vector:
+		return MakeValue(v.TypedString())
 	default:
 		panic(fmt.Errorf("unsupported type: %T", qv))
 	}
@@ -87,10 +91,21 @@ func (m *Value) ToNative() (qv quad.Value) {
 	case *Value_Bnode:
 		return quad.BNode(v.Bnode)
 	case *Value_TypedStr:
-		return quad.TypedString{
+		ts := quad.TypedString{
 			Value: quad.String(v.TypedStr.Value),
 			Type:  quad.IRI(v.TypedStr.Type),
 		}
+		if ts.Type == quad.VectorType {
+			if qv, err := ts.ParseValue(); err == nil {
+				return qv
+			}
+		} else if ts.Type == quad.QuotedTripleType {
+			// conversion is available only if nquads package is loaded
+			if qv, err := ts.ParseValue(); err == nil {
+				return qv
+			}
+		}
+		return ts
 	case *Value_LangStr:
 		return quad.LangString{
 			Value: quad.String(v.LangStr.Value),
@@ -1,6 +1,7 @@
 package quad
 
 import (
+	"fmt"
 	"io"
 )
 
@@ -169,3 +170,56 @@ func ReadAll(r Reader) (arr []Quad, err error) {
 		arr = append(arr, q)
 	}
 }
+
+// NewSafeReader wraps a quad reader and converts panics in ReadQuad and Close to errors.
+// It should be used for readers that parse untrusted input, since a bug in a parser
+// must not crash the whole process.
+//
+// After a panic all subsequent calls to ReadQuad return the same error.
+func NewSafeReader(r ReadCloser) ReadCloser {
+	if _, ok := r.(*safeReader); ok {
+		return r
+	}
+	return &safeReader{r: r}
+}
+
+type safeReader struct {
+	r   ReadCloser
+	err error
+}
+
+// PanicError is returned by readers created with NewSafeReader when the parser panics.
+type PanicError struct {
+	Value interface{} // value passed to panic
+}
+
+func (e *PanicError) Error() string {
+	return fmt.Sprintf("failed to parse quads: %v", e.Value)
+}
+
+// recoverError converts a recovered panic value to an error.
+func recoverError(r interface{}) error {
+	return &PanicError{Value: r}
+}
+
+func (r *safeReader) ReadQuad() (q Quad, err error) {
+	if r.err != nil {
+		return Quad{}, r.err
+	}
+	defer func() {
+		if e := recover(); e != nil {
+			r.err = recoverError(e)
+			q, err = Quad{}, r.err
+		}
+	}()
+	return r.r.ReadQuad()
+}
+
+func (r *safeReader) Close() (err error) {
+	defer func() {
+		if e := recover(); e != nil {
+			err = recoverError(e)
+		}
+	}()
+	return r.r.Close()
+}
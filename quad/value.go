@@ -2,12 +2,12 @@ package quad
 
 import (
 	"crypto/sha1"
+	"encoding/binary"
 	"fmt"
-	"hash"
+	"math"
 	"math/rand"
 	"strconv"
 	"strings"
-	"sync"
 	"sync/atomic"
 	"time"
 
@@ -40,10 +40,6 @@ type Equaler interface {
 // HashSize is a size of the slice, returned by HashOf.
 const HashSize = sha1.Size
 
-var hashPool = sync.Pool{
-	New: func() interface{} { return sha1.New() },
-}
-
 // HashOf calculates a hash of value v.
 func HashOf(v Value) []byte {
 	key := make([]byte, HashSize)
@@ -53,17 +49,8 @@ func HashOf(v Value) []byte {
 
 // HashTo calculates a hash of value v, storing it in a slice p.
 func HashTo(v Value, p []byte) {
-	h := hashPool.Get().(hash.Hash)
-	h.Reset()
-	defer hashPool.Put(h)
-	if len(p) < HashSize {
-		panic("buffer too small to fit the hash")
-	}
-	if v != nil {
-		// TODO(kortschak,dennwc) Remove dependence on String() method.
-		h.Write([]byte(v.String()))
-	}
-	h.Sum(p[:0])
+	// TODO(kortschak,dennwc) Remove dependence on String() method.
+	defaultHasher.HashTo(v, p)
 }
 
 // StringOf safely call v.String, returning empty string in case of nil Value.
@@ -107,6 +94,8 @@ func AsValue(v interface{}) (out Value, ok bool) {
 		out = Bool(v)
 	case time.Time:
 		out = Time(v)
+	case []float32:
+		out = NewVector(v...)
 	default:
 		return nil, false
 	}
@@ -241,6 +230,31 @@ func (s BNode) GoString() string {
 }
 func (s BNode) Native() interface{} { return s }
 
+// QuotedTripleType is a datatype used to represent QuotedTriple as a TypedString.
+//
+// Conversion from this type is registered by the nquads package.
+const QuotedTripleType = IRI("cayley:quotedTriple")
+
+// QuotedTriple is an RDF-star quoted triple that can be used as a subject or an object of a quad (ex: << <s> <p> <o> >>).
+type QuotedTriple struct {
+	Subject   Value
+	Predicate Value
+	Object    Value
+}
+
+func (s QuotedTriple) String() string {
+	return `<< ` + StringOf(s.Subject) + ` ` + StringOf(s.Predicate) + ` ` + StringOf(s.Object) + ` >>`
+}
+func (s QuotedTriple) Native() interface{} { return s }
+func (s QuotedTriple) TypedString() TypedString {
+	return TypedString{Value: String(s.String()), Type: QuotedTripleType}
+}
+
+// Quad returns a quad with the same subject, predicate and object as quoted triple.
+func (s QuotedTriple) Quad() Quad {
+	return Quad{Subject: s.Subject, Predicate: s.Predicate, Object: s.Object}
+}
+
 // Native support for basic types
 
 // StringConversion is a function to convert string values with a
@@ -273,6 +287,8 @@ func init() {
 	// time types
 	RegisterStringConversion(defaultTimeType, stringToTime)
 	RegisterStringConversion(nsXSD+`dateTime`, stringToTime)
+	// vector types
+	RegisterStringConversion(VectorType, stringToVector)
 }
 
 var knownConversions = make(map[IRI]StringConversion)
@@ -327,6 +343,26 @@ func stringToTime(s string) (Value, error) {
 	return Time(v), nil
 }
 
+func stringToVector(s string) (Value, error) {
+	if len(s) < 2 || s[0] != '[' || s[len(s)-1] != ']' {
+		return nil, fmt.Errorf("invalid vector: %q", s)
+	}
+	s = strings.TrimSpace(s[1 : len(s)-1])
+	if s == "" {
+		return Vector{}, nil
+	}
+	parts := strings.Split(s, ",")
+	v := make([]float32, 0, len(parts))
+	for _, p := range parts {
+		f, err := strconv.ParseFloat(strings.TrimSpace(p), 32)
+		if err != nil {
+			return nil, err
+		}
+		v = append(v, float32(f))
+	}
+	return NewVector(v...), nil
+}
+
 // Int is a native wrapper for int64 type.
 //
 // It uses NQuad notation similar to TypedString.
@@ -408,6 +444,80 @@ func (s Time) TypedString() TypedString {
 	}
 }
 
+// VectorType is a datatype used to represent Vector as a TypedString.
+const VectorType = IRI("cayley:vector")
+
+var _ Equaler = Vector{}
+
+// Vector is a native wrapper for a vector of float32 values, usually a node embedding.
+//
+// It uses NQuad notation similar to TypedString (ex: "[0.1,0.2]"^^<cayley:vector>).
+// Values are stored in an immutable binary form, thus vectors can be compared with == and used as map keys,
+// as other values. Zero value is an empty vector.
+type Vector struct {
+	b string // little-endian IEEE 754 bits of each component
+}
+
+// NewVector creates a vector from float32 values.
+func NewVector(v ...float32) Vector {
+	buf := make([]byte, 4*len(v))
+	for i, f := range v {
+		binary.LittleEndian.PutUint32(buf[4*i:], math.Float32bits(f))
+	}
+	return Vector{b: string(buf)}
+}
+
+// Len returns the number of components in the vector.
+func (s Vector) Len() int { return len(s.b) / 4 }
+
+// At returns the i-th component of the vector.
+func (s Vector) At(i int) float32 {
+	b := s.b[4*i : 4*i+4]
+	return math.Float32frombits(uint32(b[0]) | uint32(b[1])<<8 | uint32(b[2])<<16 | uint32(b[3])<<24)
+}
+
+// Floats returns a copy of vector components.
+func (s Vector) Floats() []float32 {
+	out := make([]float32, s.Len())
+	for i := range out {
+		out[i] = s.At(i)
+	}
+	return out
+}
+
+func (s Vector) String() string {
+	return s.TypedString().String()
+}
+func (s Vector) Native() interface{} { return s.Floats() }
+func (s Vector) Equal(v Value) bool {
+	v2, ok := v.(Vector)
+	if !ok || s.Len() != v2.Len() {
+		return false
+	}
+	for i, n := 0, s.Len(); i < n; i++ {
+		if s.At(i) != v2.At(i) {
+			return false
+		}
+	}
+	return true
+}
+func (s Vector) TypedString() TypedString {
+	n := s.Len()
+	buf := make([]byte, 0, 2+n*8)
+	buf = append(buf, '[')
+	for i := 0; i < n; i++ {
+		if i != 0 {
+			buf = append(buf, ',')
+		}
+		buf = strconv.AppendFloat(buf, float64(s.At(i)), 'g', -1, 32)
+	}
+	buf = append(buf, ']')
+	return TypedString{
+		Value: String(buf),
+		Type:  VectorType,
+	}
+}
+
 type ByValueString []Value
 
 func (o ByValueString) Len() int           { return len(o) }
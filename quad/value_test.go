@@ -25,3 +25,60 @@ func TestHashOf(t *testing.T) {
 		}
 	}
 }
+
+func TestHashers(t *testing.T) {
+	for _, c := range []struct {
+		name string
+		size int
+	}{
+		{HashSHA1, 20},
+		{HashSHA256, 32},
+		{HashFNV128, 16},
+	} {
+		h := HasherByName(c.name)
+		if h == nil {
+			t.Fatalf("hash function %q is not registered", c.name)
+		}
+		if h.Size() != c.size {
+			t.Errorf("unexpected size for %q: %d vs %d", c.name, h.Size(), c.size)
+		}
+		a, b := h.HashOf(IRI("a")), h.HashOf(IRI("b"))
+		if len(a) != c.size || string(a) == string(b) {
+			t.Errorf("unexpected hashes for %q: %x, %x", c.name, a, b)
+		}
+	}
+	for _, c := range hashCases {
+		if h := hex.EncodeToString(HasherByName(HashSHA1).HashOf(c.val)); h != c.hash {
+			t.Errorf("unexpected hash for %#v: %v vs %v", c.val, h, c.hash)
+		}
+	}
+	if HasherByName("unknown") != nil {
+		t.Error("expected no hash function")
+	}
+}
+
+func TestVector(t *testing.T) {
+	for _, c := range []struct {
+		vec Vector
+		str string
+	}{
+		{Vector{}, `"[]"^^<cayley:vector>`},
+		{NewVector(1, -0.5, 0.25), `"[1,-0.5,0.25]"^^<cayley:vector>`},
+		{NewVector(0.1, 1e-10), `"[0.1,1e-10]"^^<cayley:vector>`},
+	} {
+		if s := c.vec.String(); s != c.str {
+			t.Errorf("unexpected string for %v: %v vs %v", c.vec.Floats(), s, c.str)
+		}
+		v, err := c.vec.TypedString().ParseValue()
+		if err != nil {
+			t.Fatal(err)
+		} else if !c.vec.Equal(v) {
+			t.Errorf("unexpected value after conversion: %#v vs %#v", v, c.vec)
+		} else if v != Value(c.vec) {
+			t.Errorf("expected parsed vector to be comparable with ==: %#v vs %#v", v, c.vec)
+		}
+	}
+	if _, err := (TypedString{Value: "[1,a]", Type: VectorType}).ParseValue(); err == nil {
+		t.Error("expected an error for invalid vector")
+	}
+}
@@ -0,0 +1,73 @@
+// Copyright 2017 The Cayley Authors. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package gizmo
+
+import (
+	"reflect"
+	"sort"
+	"strings"
+
+	"github.com/cayleygraph/cayley/query"
+)
+
+var _ query.REPLCompleter = (*Session)(nil)
+
+var (
+	graphMethods = methodNames(reflect.TypeOf(&graphObject{}))
+	pathMethods  = methodNames(reflect.TypeOf(&pathObject{}))
+)
+
+// methodNames returns a sorted list of methods that are visible from JS.
+func methodNames(rt reflect.Type) []string {
+	names := make([]string, 0, rt.NumMethod())
+	for i := 0; i < rt.NumMethod(); i++ {
+		names = append(names, rt.Method(i).Name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Complete implements query.REPLCompleter.
+//
+// Methods of the graph object are completed after "g." and "graph.", and path methods are completed
+// after any other receiver, e.g. in "g.V().Ou" the word to complete is ".Ou". Without a receiver,
+// the word is completed to one of the global objects and functions.
+func (s *Session) Complete(word string) []string {
+	i := strings.LastIndexByte(word, '.')
+	if i < 0 {
+		names := []string{"g", "graph"}
+		for name := range defaultEnv {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		return completeNames("", word, names)
+	}
+	recv, pref := word[:i+1], word[i+1:]
+	names := pathMethods
+	if recv == "g." || recv == "graph." {
+		names = graphMethods
+	}
+	return completeNames(recv, pref, names)
+}
+
+func completeNames(recv, pref string, names []string) []string {
+	var out []string
+	for _, name := range names {
+		if strings.HasPrefix(name, pref) {
+			out = append(out, recv+name)
+		}
+	}
+	return out
+}
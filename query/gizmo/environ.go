@@ -42,8 +42,13 @@ type graphObject struct {
 }
 
 // Uri creates an IRI values from a given string.
+//
+// Prefixes registered in the session take precedence over global namespaces (see LoadNamespaces).
 func (g *graphObject) Uri(s string) quad.IRI {
-	return quad.IRI(g.s.ns.FullIRI(s))
+	if iri := g.s.ns.FullIRI(s); iri != s {
+		return quad.IRI(iri)
+	}
+	return quad.IRI(voc.FullIRI(s))
 }
 
 // AddNamespace associates prefix with a given IRI namespace.
@@ -86,6 +91,38 @@ func (g *graphObject) Vertex(call goja.FunctionCall) goja.Value {
 	})
 }
 
+// Search starts a query path at nodes with string values that match a full-text query.
+// Quad store must support full-text search.
+// Signature: (query, [limit])
+//
+// Arguments:
+//
+// * `query`: A string with search terms. Syntax of the query depends on the text index.
+// * `limit` (Optional): A maximal number of search results. Results are sorted by relevance.
+//
+// Returns: Path object
+func (g *graphObject) Search(call goja.FunctionCall) goja.Value {
+	args := exportArgs(call.Arguments)
+	if len(args) != 1 && len(args) != 2 {
+		return throwErr(g.s.vm, errArgCount2{Expected: 1, Got: len(args)})
+	}
+	query, ok := args[0].(string)
+	if !ok {
+		return throwErr(g.s.vm, fmt.Errorf("expected string as first argument"))
+	}
+	limit := 0
+	if len(args) > 1 {
+		if limit, ok = toInt(args[1]); !ok {
+			return throwErr(g.s.vm, fmt.Errorf("expected int as second argument"))
+		}
+	}
+	return g.s.vm.ToValue(&pathObject{
+		s:      g.s,
+		finals: true,
+		path:   path.StartMorphism().Search(query, limit),
+	})
+}
+
 // M is a shorthand for Morphism.
 func (g *graphObject) M() *pathObject {
 	return g.Morphism()
@@ -208,6 +245,64 @@ func cmpRegexp(vm *goja.Runtime, call goja.FunctionCall) goja.Value {
 	return vm.ToValue(valFilter{f: shape.Regexp{Re: re, Refs: refs}})
 }
 
+func cmpString(op shape.StringOp, fold bool) func(vm *goja.Runtime, call goja.FunctionCall) goja.Value {
+	return func(vm *goja.Runtime, call goja.FunctionCall) goja.Value {
+		args := exportArgs(call.Arguments)
+		if len(args) != 1 {
+			return throwErr(vm, errArgCount2{Expected: 1, Got: len(args)})
+		}
+		v, err := toQuadValue(args[0])
+		if err != nil {
+			return throwErr(vm, err)
+		}
+		f := shape.StringMatch{Op: op, Fold: fold}
+		switch v := v.(type) {
+		case quad.String:
+			f.Val = string(v)
+		case quad.IRI:
+			f.Val, f.Refs = string(v), true
+		case quad.BNode:
+			f.Val, f.Refs = string(v), true
+		default:
+			return throwErr(vm, fmt.Errorf("%v: unsupported type: %T", op, v))
+		}
+		return vm.ToValue(valFilter{f: f})
+	}
+}
+
+func cmpLength(vm *goja.Runtime, call goja.FunctionCall) goja.Value {
+	args := exportArgs(call.Arguments)
+	if len(args) != 1 && len(args) != 2 {
+		return throwErr(vm, errArgCount2{Expected: 2, Got: len(args)})
+	}
+	f := shape.Length{Max: -1}
+	var ok bool
+	if f.Min, ok = toInt(args[0]); !ok {
+		return throwErr(vm, fmt.Errorf("expected int as first argument"))
+	}
+	if len(args) > 1 {
+		if f.Max, ok = toInt(args[1]); !ok {
+			return throwErr(vm, fmt.Errorf("expected int as second argument"))
+		}
+	}
+	return vm.ToValue(valFilter{f: f})
+}
+
+func cmpModulo(vm *goja.Runtime, call goja.FunctionCall) goja.Value {
+	args := exportArgs(call.Arguments)
+	if len(args) != 2 {
+		return throwErr(vm, errArgCount2{Expected: 2, Got: len(args)})
+	}
+	div, ok1 := toInt(args[0])
+	rem, ok2 := toInt(args[1])
+	if !ok1 || !ok2 {
+		return throwErr(vm, fmt.Errorf("expected int arguments"))
+	} else if div == 0 {
+		return throwErr(vm, fmt.Errorf("modulo by zero"))
+	}
+	return vm.ToValue(valFilter{f: shape.Modulo{Div: int64(div), Rem: int64(rem)}})
+}
+
 type valFilter struct {
 	f shape.ValueFilter
 }
@@ -230,6 +325,13 @@ var defaultEnv = map[string]func(vm *goja.Runtime, call goja.FunctionCall) goja.
 	"gt":    cmpOpType(iterator.CompareGT),
 	"gte":   cmpOpType(iterator.CompareGTE),
 	"regex": cmpRegexp,
+
+	"prefix":    cmpString(shape.StringPrefix, false),
+	"suffix":    cmpString(shape.StringSuffix, false),
+	"contains":  cmpString(shape.StringContains, false),
+	"equalFold": cmpString(shape.StringEqual, true),
+	"length":    cmpLength,
+	"mod":       cmpModulo,
 }
 
 func unwrap(o interface{}) interface{} {
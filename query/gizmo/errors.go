@@ -19,6 +19,7 @@ import "fmt"
 var (
 	errNoVia       = fmt.Errorf("expected predicate list")
 	errRegexpOnIRI = fmt.Errorf("regexps are not allowed on IRIs")
+	errReadOnly    = fmt.Errorf("session is read-only")
 )
 
 type errArgCount2 struct {
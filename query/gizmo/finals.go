@@ -118,12 +118,68 @@ func (p *pathObject) TagValue() (interface{}, error) {
 	return p.toValue(true)
 }
 
+func (p *pathObject) objects(call goja.FunctionCall, emit bool) goja.Value {
+	args := exportArgs(call.Arguments)
+	if len(args) > 1 {
+		return throwErr(p.s.vm, errArgCount2{Expected: 1, Got: len(args)})
+	}
+	limit := -1
+	if len(args) > 0 {
+		limit, _ = toInt(args[0])
+	}
+	it := p.buildIteratorTree()
+	it.Tagger().Add(TopResultTag)
+	if emit {
+		if err := p.s.runIteratorObjects(it, limit); err != nil {
+			return throwErr(p.s.vm, err)
+		}
+		return goja.Null()
+	}
+	array, err := p.s.runIteratorToObjects(it, limit, p.s.nativeValue)
+	if err != nil {
+		return throwErr(p.s.vm, err)
+	}
+	return p.s.vm.ToValue(array)
+}
+
+// AllObjects executes the query and adds one nested object for each node at the end of the path to the output set.
+// Unlike All, tags of all paths to the node are collected into the same object.
+// Tag names with dots are returned as fields of nested objects: a value tagged "friend.name" is returned
+// in the "name" field of the object in the "friend" field. If "friend" is tagged as well, a separate object
+// is returned for each of its nodes, with the node in the "id" field.
+// Fields with multiple values are returned as arrays.
+// Signature: ([limit])
+//
+// Arguments:
+//
+// * `limit` (Optional): A maximal number of objects to return.
+//
+// Example:
+// 	// javascript
+//	// Return bob with statuses of people he follows, grouped by person.
+//	g.V("<bob>").Tag("source").Out("<follows>").Tag("follows").Save("<status>", "follows.status").Back("source").AllObjects()
+func (p *pathObject) AllObjects(call goja.FunctionCall) goja.Value {
+	return p.objects(call, true)
+}
+
+// ObjectArray is the same as AllObjects, but returns the objects as an JS array, as TagArray does.
+//
+// Example:
+// 	// javascript
+//	var bob = g.V("<bob>").Tag("source").Out("<follows>").Tag("follows").Back("source").ObjectArray()[0]
+//	// bob["follows"] contains people bob follows
+func (p *pathObject) ObjectArray(call goja.FunctionCall) goja.Value {
+	return p.objects(call, false)
+}
+
 // Map is a alias for ForEach.
 func (p *pathObject) Map(call goja.FunctionCall) goja.Value {
 	return p.ForEach(call)
 }
 
 // ForEach calls callback(data) for each result, where data is the tag-to-string map as in All case.
+// Results emitted by the callback are streamed to the client as they are produced,
+// and the iteration stops once the callback emits more results than the query limit allows.
 // Signature: (callback) or (limit, callback)
 //
 // Arguments:
@@ -160,6 +216,20 @@ func (p *pathObject) Count() (int64, error) {
 	return p.s.countResults(it)
 }
 
+// CountDistinct returns a number of unique nodes at the end of the path. It is equivalent to Unique().Count().
+//
+// Example:
+// 	// javascript
+//	// People followed by alice, charlie or dani: bob, dani and greg. Returns 3.
+//	g.V("<alice>", "<charlie>", "<dani>").Out("<follows>").CountDistinct()
+func (p *pathObject) CountDistinct() (int64, error) {
+	if p.path == nil {
+		return 0, nil
+	}
+	it := p.s.buildIterator(p.path.Clone().Unique())
+	return p.s.countResults(it)
+}
+
 func quadValueToString(v quad.Value) string {
 	if s, ok := v.(quad.String); ok {
 		return string(s)
@@ -24,6 +24,7 @@ import (
 	"github.com/cayleygraph/cayley/clog"
 	"github.com/cayleygraph/cayley/graph"
 	"github.com/cayleygraph/cayley/graph/iterator"
+	"github.com/cayleygraph/cayley/graph/path"
 	"github.com/cayleygraph/cayley/quad"
 	"github.com/cayleygraph/cayley/query"
 	"github.com/cayleygraph/cayley/voc"
@@ -43,6 +44,9 @@ func init() {
 		REPL: func(qs graph.QuadStore) query.REPLSession {
 			return NewSession(qs)
 		},
+		Prepare: func(qu string) (query.Prepared, error) {
+			return Prepare(qu)
+		},
 	})
 }
 
@@ -64,10 +68,22 @@ type Session struct {
 	last string
 	p    *goja.Program
 
-	out   chan query.Result
-	ctx   context.Context
-	limit int
-	count int
+	// newDate creates JS Date objects
+	newDate goja.Callable
+
+	// qw is set for writable sessions; txs is a stack of nested transactions of the script
+	qw      graph.QuadWriter
+	txs     []*graph.Transaction
+	changed bool
+
+	out     chan query.Result
+	ctx     context.Context
+	limit   int
+	count   int
+	dropped int // results rejected because of the limit
+
+	// shapes caches optimized shapes of a prepared query; it is nil for other sessions
+	shapes *shapeCache
 
 	// used only to collate web results
 	dataOutput []interface{}
@@ -92,32 +108,46 @@ func (s *Session) buildEnv() error {
 			return fnc(s.vm, call)
 		})
 	}
-	return nil
+	return s.setupStdlib()
 }
 
-func (s *Session) tagsToValueMap(m map[string]graph.Value) map[string]interface{} {
+func (s *Session) tagsToValueMap(ctx context.Context, m map[string]graph.Value) (map[string]interface{}, error) {
 	outputMap := make(map[string]interface{})
 	for k, v := range m {
-		if o := quadValueToNative(s.qs.NameOf(v)); o != nil {
+		name, err := graph.NameOf(ctx, s.qs, v)
+		if err != nil {
+			return nil, err
+		}
+		if o := s.nativeValue(name); o != nil {
 			outputMap[k] = o
 		}
 	}
 	if len(outputMap) == 0 {
-		return nil
+		return nil, nil
 	}
-	return outputMap
+	return outputMap, nil
 }
 func (s *Session) runIteratorToArray(it graph.Iterator, limit int) ([]map[string]interface{}, error) {
 	ctx := s.context()
 
 	output := make([]map[string]interface{}, 0)
+	var nerr error
 	err := graph.Iterate(ctx, it).Limit(limit).TagEach(func(tags map[string]graph.Value) {
-		tm := s.tagsToValueMap(tags)
-		if tm == nil {
+		if nerr != nil {
+			return
+		}
+		tm, err := s.tagsToValueMap(ctx, tags)
+		if err != nil {
+			nerr = err
+			return
+		} else if tm == nil {
 			return
 		}
 		output = append(output, tm)
 	})
+	if err == nil {
+		err = nerr
+	}
 	if err != nil {
 		return nil, err
 	}
@@ -129,7 +159,7 @@ func (s *Session) runIteratorToArrayNoTags(it graph.Iterator, limit int) ([]inte
 
 	output := make([]interface{}, 0)
 	err := graph.Iterate(ctx, it).Paths(false).Limit(limit).EachValue(s.qs, func(v quad.Value) {
-		if o := quadValueToNative(v); o != nil {
+		if o := s.nativeValue(v); o != nil {
 			output = append(output, o)
 		}
 	})
@@ -139,6 +169,57 @@ func (s *Session) runIteratorToArrayNoTags(it graph.Iterator, limit int) ([]inte
 	return output, nil
 }
 
+// runIteratorToObjects collects tags of all paths to each result into a nested object. See path.Object.
+// Values in objects are converted with a given function.
+func (s *Session) runIteratorToObjects(it graph.Iterator, limit int, conv func(quad.Value) interface{}) ([]interface{}, error) {
+	output := make([]interface{}, 0)
+	err := path.ObjectEach(s.context(), it, s.qs, limit, func(o map[string]interface{}) {
+		output = append(output, convertObject(o, conv))
+	})
+	if err != nil {
+		return nil, err
+	}
+	return output, nil
+}
+
+func convertObject(v interface{}, conv func(quad.Value) interface{}) interface{} {
+	switch v := v.(type) {
+	case quad.Value:
+		return conv(v)
+	case []interface{}:
+		for i, e := range v {
+			v[i] = convertObject(e, conv)
+		}
+	case map[string]interface{}:
+		for k, e := range v {
+			v[k] = convertObject(e, conv)
+		}
+	}
+	return v
+}
+
+func (s *Session) runIteratorObjects(it graph.Iterator, limit int) error {
+	if s.shape != nil {
+		iterator.OutputQueryShapeForIterator(it, s.qs, s.shape)
+		return nil
+	}
+	conv := quadValueToNative
+	if query.TypedValues(s.context()) {
+		// values will be converted by ConvertResult
+		conv = func(v quad.Value) interface{} { return v }
+	}
+	objs, err := s.runIteratorToObjects(it, limit, conv)
+	if err != nil {
+		return err
+	}
+	for _, o := range objs {
+		if !s.send(nil, &Result{Val: o}) {
+			break
+		}
+	}
+	return nil
+}
+
 func (s *Session) runIteratorWithCallback(it graph.Iterator, callback goja.Value, this goja.FunctionCall, limit int) error {
 	fnc, ok := goja.AssertFunction(callback)
 	if !ok {
@@ -146,25 +227,43 @@ func (s *Session) runIteratorWithCallback(it graph.Iterator, callback goja.Value
 	}
 	ctx, cancel := context.WithCancel(s.context())
 	defer cancel()
-	var gerr error
+	var (
+		gerr error
+		stop bool
+	)
 	err := graph.Iterate(ctx, it).Paths(true).Limit(limit).TagEach(func(tags map[string]graph.Value) {
-		tm := s.tagsToValueMap(tags)
-		if tm == nil {
+		tm, err := s.tagsToValueMap(ctx, tags)
+		if err != nil {
+			gerr = err
+			cancel()
+			return
+		} else if tm == nil {
 			return
 		}
+		dropped := s.dropped
 		if _, err := fnc(this.This, s.vm.ToValue(tm)); err != nil {
 			gerr = err
 			cancel()
+		} else if s.dropped != dropped && len(s.txs) == 0 {
+			// callback emits more results than the limit allows; no reason to continue,
+			// unless the session is writable and callbacks have side effects
+			stop = true
+			cancel()
 		}
 	})
 	if gerr != nil {
 		err = gerr
+	} else if stop {
+		err = nil
 	}
 	return err
 }
 
 func (s *Session) send(ctx context.Context, r *Result) bool {
 	if s.limit >= 0 && s.count >= s.limit {
+		// there are more results than the limit allows
+		graph.SetTruncated(s.context())
+		s.dropped++
 		return false
 	}
 	if s.out == nil {
@@ -179,7 +278,7 @@ func (s *Session) send(ctx context.Context, r *Result) bool {
 		return false
 	}
 	s.count++
-	return s.limit < 0 || s.count < s.limit
+	return true
 }
 
 func (s *Session) runIterator(it graph.Iterator) error {
@@ -236,7 +335,10 @@ func (s *Session) run(qu string) (v goja.Value, err error) {
 		}
 		s.last, s.p = qu, p
 	}
-	v, err = s.vm.RunProgram(p)
+	return s.runProgram(p)
+}
+func (s *Session) runProgram(p *goja.Program) (goja.Value, error) {
+	v, err := s.vm.RunProgram(p)
 	if e, ok := err.(*goja.Exception); ok && e.Value() != nil {
 		if er, ok := e.Value().Export().(error); ok {
 			err = er
@@ -245,21 +347,35 @@ func (s *Session) run(qu string) (v goja.Value, err error) {
 	return v, err
 }
 func (s *Session) Execute(ctx context.Context, qu string, out chan query.Result, limit int) {
+	s.execute(ctx, out, limit, func() (goja.Value, error) {
+		return s.run(qu)
+	})
+}
+func (s *Session) execute(ctx context.Context, out chan query.Result, limit int, run func() (goja.Value, error)) {
 	defer close(out)
 	s.out = out
 	s.limit = limit
-	s.count = 0
+	s.count, s.dropped = 0, 0
 	s.ctx = ctx
-	done := make(chan struct{})
-	defer close(done)
+	done, exited := make(chan struct{}), make(chan struct{})
+	defer func() {
+		close(done)
+		<-exited
+	}()
 	go func() {
+		defer close(exited)
 		select {
 		case <-ctx.Done():
 			s.vm.Interrupt(ctx.Err())
 		case <-done:
 		}
 	}()
-	v, err := s.run(qu)
+	s.begin()
+	v, err := run()
+	if err == nil {
+		err = s.commit()
+	}
+	s.txs = nil
 	if err != nil {
 		select {
 		case <-ctx.Done():
@@ -329,9 +445,10 @@ func (s *Session) FormatREPL(result query.Result) string {
 
 func (s *Session) ShapeOf(qu string) (interface{}, error) {
 	s.shape = make(map[string]interface{})
+	s.begin() // changes are discarded
 	_, err := s.run(qu)
 	out := s.shape
-	s.shape = nil
+	s.shape, s.txs = nil, nil
 	return out, err
 }
 
@@ -340,16 +457,32 @@ func (s *Session) Collate(result query.Result) {
 		s.err = err
 		return
 	}
+	v, err := s.ConvertResult(result)
+	if err != nil {
+		clog.Errorf("%v", err)
+		return
+	} else if v != nil {
+		s.dataOutput = append(s.dataOutput, v)
+	}
+}
+
+// ConvertResult implements query.HTTPStreamer.
+func (s *Session) ConvertResult(result query.Result) (interface{}, error) {
+	if err := result.Err(); err != nil {
+		return nil, err
+	}
 	data, ok := result.(*Result)
 	if !ok {
-		clog.Errorf("unexpected result type: %T", result)
-		return
+		return nil, fmt.Errorf("unexpected result type: %T", result)
 	} else if data.Meta {
-		return
+		return nil, nil
 	}
+	typed := s.ctx != nil && query.TypedValues(s.ctx)
 	if data.Val != nil {
-		s.dataOutput = append(s.dataOutput, data.Val)
-		return
+		if typed {
+			return query.TypedResult(data.Val), nil
+		}
+		return data.Val, nil
 	}
 	obj := make(map[string]interface{})
 	tags := data.Tags
@@ -358,16 +491,27 @@ func (s *Session) Collate(result query.Result) {
 		tagKeys = append(tagKeys, k)
 	}
 	sort.Strings(tagKeys)
+	ctx := s.ctx
+	if ctx == nil {
+		ctx = context.Background()
+	}
 	for _, k := range tagKeys {
-		if name := s.qs.NameOf(tags[k]); name != nil {
+		name, err := graph.NameOf(ctx, s.qs, tags[k])
+		if err != nil {
+			return nil, err
+		}
+		if name != nil && typed {
+			obj[k] = query.TypedValue(name)
+		} else if name != nil {
 			obj[k] = quadValueToNative(name)
 		} else {
 			delete(obj, k)
 		}
 	}
-	if len(obj) != 0 {
-		s.dataOutput = append(s.dataOutput, obj)
+	if len(obj) == 0 {
+		return nil, nil
 	}
+	return obj, nil
 }
 
 func (s *Session) Results() (interface{}, error) {
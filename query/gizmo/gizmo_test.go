@@ -20,9 +20,10 @@ import (
 	"reflect"
 	"sort"
 	"testing"
+	"time"
 
 	"github.com/cayleygraph/cayley/graph"
-	_ "github.com/cayleygraph/cayley/graph/memstore"
+	"github.com/cayleygraph/cayley/graph/memstore"
 	"github.com/cayleygraph/cayley/quad"
 	"github.com/cayleygraph/cayley/query"
 	_ "github.com/cayleygraph/cayley/writer"
@@ -158,6 +159,20 @@ var testQueries = []struct {
 		`,
 		expect: []string{"<charlie>"},
 	},
+	{
+		message: "use .In() with .Filter(prefix with IRIs)",
+		query: `
+			g.V("<bob>").In("<follows>").Filter(prefix(iri("ch"))).All()
+		`,
+		expect: []string{"<charlie>"},
+	},
+	{
+		message: "use .Out() with .Filter(suffix,length)",
+		query: `
+			g.V("<greg>").Out("<status>").Filter(suffix("_person"),length(0,11)).All()
+		`,
+		expect: []string{"cool_person"},
+	},
 	{
 		message: "use .Both()",
 		query: `
@@ -348,6 +363,13 @@ var testQueries = []struct {
 		`,
 		expect: []string{"5"},
 	},
+	{
+		message: "show CountDistinct",
+		query: `
+				g.Emit(g.V("<alice>", "<charlie>", "<dani>").Out("<follows>").CountDistinct())
+		`,
+		expect: []string{"3"},
+	},
 	{
 		message: "use Count value",
 		query: `
@@ -492,6 +514,44 @@ var testQueries = []struct {
 		`,
 		expect: []string{"<alice>", "<charlie>"},
 	},
+	{
+		message: "use Optional",
+		query: `
+			g.V("<alice>", "<greg>").Optional(g.M().Out("<follows>").Tag("target")).All()
+		`,
+		expect: []string{"<alice>", "<greg>"},
+	},
+	{
+		message: "use Optional tags",
+		query: `
+			g.V("<alice>", "<greg>").Optional(g.M().Out("<follows>").Tag("target")).All()
+		`,
+		tag:    "target",
+		expect: []string{"<bob>"},
+	},
+	{
+		message: "show ObjectArray",
+		query: `
+			var o = g.V("<bob>").Tag("source").In("<follows>").Tag("follower").Back("source").ObjectArray()[0]
+			for (i in o.follower) g.Emit(o.follower[i]);
+		`,
+		expect: []string{"<alice>", "<charlie>", "<dani>"},
+	},
+	{
+		message: "show ObjectArray with nested objects",
+		query: `
+			var o = g.V("<charlie>").Tag("source").Out("<follows>").Tag("f").Save("<status>", "f.status").Back("source").ObjectArray()[0]
+			for (i in o.f) g.Emit(o.f[i].id + " " + o.f[i].status);
+		`,
+		expect: []string{"<bob> cool_person", "<dani> cool_person"},
+	},
+	{
+		message: "show AllObjects",
+		query: `
+			g.V("<dani>").Save("<status>", "info.status").AllObjects()
+		`,
+		expect: []string{"map[id:<dani> info:map[status:cool_person]]"},
+	},
 	{
 		message: "show ForEach",
 		query: `
@@ -562,6 +622,67 @@ var testQueries = []struct {
 		`,
 		expect: nil,
 	},
+	{
+		message: "time functions",
+		query: `
+			var d = time.Parse("2017-06-01")
+			g.Emit(time.Format(time.AddDate(d, 0, 1, 2), time.Date))
+			g.Emit(time.Format(time.Add(d, "36h")))
+			g.Emit(String(time.Sub(time.Parse("2017-06-02"), d)))
+			g.Emit(time.Format(time.Parse("01/06/2017", "02/01/2006"), time.Date))
+		`,
+		expect: []string{"2017-07-03", "2017-06-02T12:00:00Z", "86400000", "2017-06-01"},
+	},
+	{
+		message: "uri functions",
+		query: `
+			g.Emit(uri.Encode("a b&c"))
+			g.Emit(uri.Decode("a+b%26c"))
+			g.Emit(uri.DecodePath("John%20Doe"))
+		`,
+		expect: []string{"a+b%26c", "a b&c", "John Doe"},
+	},
+	{
+		message: "strings functions",
+		query: `
+			g.Emit(strings.Split("a-b-c", "-", 2).join("|"))
+			g.Emit(strings.Join([iri("alice"), "bob"], ","))
+			g.Emit(strings.Format("%s has %d friends", g.V("<alice>").ToValue(), g.V("<alice>").Out("<follows>").Count()))
+			g.Emit(strings.Trim(" x "))
+			g.Emit(strings.UUID().length == 36 ? "uuid" : "invalid uuid")
+		`,
+		expect: []string{"a|b-c", "alice,bob", "<alice> has 1 friends", "x", "uuid"},
+	},
+}
+
+func TestDates(t *testing.T) {
+	g := []quad.Quad{
+		{Subject: quad.IRI("alice"), Predicate: quad.IRI("born"), Object: quad.Time(time.Date(1990, 5, 1, 0, 0, 0, 0, time.UTC))},
+		{Subject: quad.IRI("bob"), Predicate: quad.IRI("born"), Object: quad.Time(time.Date(2001, 2, 3, 0, 0, 0, 0, time.UTC))},
+	}
+	const qu = `
+		var d = g.V("<alice>").Out("<born>").ToValue()
+		g.Emit(d instanceof Date ? time.Format(d, time.Date) : "not a date")
+		g.V("<bob>").Out("<born>").ForEach(function(r) {
+			g.Emit(String(r.id.getUTCFullYear()))
+		})
+		g.V().Has("<born>", lt(new Date(Date.UTC(2000, 0, 1)))).ForEach(function(r) {
+			g.Emit(r.id)
+		})
+	`
+	rec := func() {
+		if r := recover(); r != nil {
+			t.Errorf("Unexpected panic: %v", r)
+		}
+	}
+	got, err := runQueryGetTag(rec, g, qu, TopResultTag)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expect := []string{"1990-05-01", "2001", "<alice>"}
+	if !reflect.DeepEqual(got, expect) {
+		t.Errorf("got: %v expected: %v", got, expect)
+	}
 }
 
 func runQueryGetTag(rec func(), g []quad.Quad, qu string, tag string) ([]string, error) {
@@ -662,3 +783,186 @@ func TestIssue160(t *testing.T) {
 		t.Errorf("Unexpected result, got: %q expected: %q", got, expect)
 	}
 }
+
+func TestForEachLimit(t *testing.T) {
+	ses := makeTestSession(issue160TestGraph)
+	c := make(chan query.Result, 5)
+	go ses.Execute(context.TODO(), `var n = 0; g.V().ForEach(function(d) { n++; g.Emit(d.id) })`, c, 2)
+	var got int
+	for res := range c {
+		if err := res.Err(); err != nil {
+			t.Fatal(err)
+		}
+		got++
+	}
+	if got != 2 {
+		t.Errorf("unexpected number of results: %d", got)
+	}
+	// iteration stops at the first rejected result
+	if n := ses.vm.Get("n").ToInteger(); n != 3 {
+		t.Errorf("callback was called %d times", n)
+	}
+}
+
+func TestPrepared(t *testing.T) {
+	qs := makeTestSession(testutil.LoadGraph(t, "../../data/testdata.nq")).qs
+	p, err := query.Prepare(Name, `g.V(params.name).Out("<follows>").All()`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	run := func(name string) []string {
+		out := make(chan query.Result, 5)
+		go p.Execute(context.TODO(), qs, map[string]interface{}{"name": name}, out, -1)
+		var got []string
+		for res := range out {
+			if err := res.Err(); err != nil {
+				t.Fatal(err)
+			}
+			got = append(got, quadValueToString(qs.NameOf(res.(*Result).Tags[TopResultTag])))
+		}
+		sort.Strings(got)
+		return got
+	}
+	for _, c := range []struct {
+		name   string
+		expect []string
+	}{
+		{name: "<alice>", expect: []string{"<bob>"}},
+		{name: "<charlie>", expect: []string{"<bob>", "<dani>"}},
+		{name: "<alice>", expect: []string{"<bob>"}},
+	} {
+		if got := run(c.name); !reflect.DeepEqual(got, c.expect) {
+			t.Errorf("unexpected results for %v: %v", c.name, got)
+		}
+	}
+	if n := len(p.(*Prepared).poolFor(qs).shapes.shapes); n != 2 {
+		t.Errorf("expected 2 cached shapes, got %d", n)
+	}
+	// cached shapes must not be used after the store changes
+	qw, err := graph.NewQuadWriter("single", qs, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = qw.AddQuad(quad.MakeIRI("alice", "follows", "dani", "")); err != nil {
+		t.Fatal(err)
+	}
+	if got, expect := run("<alice>"), []string{"<bob>", "<dani>"}; !reflect.DeepEqual(got, expect) {
+		t.Errorf("unexpected results after a write: %v", got)
+	}
+	if _, err = query.Prepare(Name, `g.V(`); err == nil {
+		t.Error("expected a syntax error")
+	}
+}
+
+func TestPreparedPools(t *testing.T) {
+	p, err := Prepare(`g.V().All()`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	first := memstore.New()
+	pool := p.poolFor(first)
+	if p.poolFor(first) != pool {
+		t.Fatal("expected the pool to be reused")
+	}
+	for i := 0; i < maxPools; i++ {
+		p.poolFor(memstore.New())
+	}
+	if n := len(p.pools); n != maxPools {
+		t.Fatalf("expected %d pools, got %d", maxPools, n)
+	}
+	if p.poolFor(first) == pool {
+		t.Fatal("expected the least recently used pool to be dropped")
+	}
+}
+
+func runWrite(ses *Session, qu string) ([]query.Result, error) {
+	c := make(chan query.Result, 5)
+	go ses.Execute(context.TODO(), qu, c, -1)
+	var out []query.Result
+	for res := range c {
+		if err := res.Err(); err != nil {
+			return out, err
+		}
+		out = append(out, res)
+	}
+	return out, nil
+}
+
+func TestWrite(t *testing.T) {
+	ses := makeTestSession([]quad.Quad{
+		quad.MakeIRI("alice", "follows", "bob", ""),
+	})
+	if _, err := runWrite(ses, `g.AddQuad("<a>", "<b>", "<c>")`); err != errReadOnly {
+		t.Fatalf("expected read-only error, got: %v", err)
+	}
+	qw, err := graph.NewQuadWriter("single", ses.qs, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ses.SetWriter(qw)
+
+	res, err := runWrite(ses, `
+		g.AddQuad("<a>", "<b>", "<c>")
+		g.RemoveQuad("<alice>", "<follows>", "<bob>")
+		try {
+			g.Tx(function() {
+				g.AddQuad("<x>", "<y>", "<z>")
+				throw "rollback"
+			})
+		} catch(e) {}
+		g.Tx(function() {
+			g.AddQuad("<d>", "<e>", "<f>", "<g>")
+		})
+		g.V("<a>").Out("<b>").All()
+	`)
+	if err != nil {
+		t.Fatal(err)
+	} else if len(res) != 0 {
+		t.Fatalf("changes should not be visible to the script: %v", res)
+	} else if !ses.Changed() {
+		t.Fatal("script should modify the graph")
+	}
+	if _, err = runWrite(ses, `g.V("<a>").All()`); err != nil {
+		t.Fatal(err)
+	} else if ses.Changed() {
+		t.Fatal("read-only script should not modify the graph")
+	}
+	_, err = runWrite(ses, `
+		g.AddQuad("<h>", "<i>", "<j>")
+		throw "abort"
+	`)
+	if err == nil {
+		t.Fatal("expected an error")
+	}
+
+	got, err := quad.ReadAll(graph.NewQuadStoreReader(ses.qs))
+	if err != nil {
+		t.Fatal(err)
+	}
+	expect := []quad.Quad{
+		quad.MakeIRI("a", "b", "c", ""),
+		quad.MakeIRI("d", "e", "f", "g"),
+	}
+	sort.Sort(quad.ByQuadString(got))
+	if !reflect.DeepEqual(got, expect) {
+		t.Errorf("unexpected quads, got: %v expected: %v", got, expect)
+	}
+}
+
+func TestComplete(t *testing.T) {
+	ses := makeTestSession(nil)
+	for _, c := range []struct {
+		word   string
+		expect []string
+	}{
+		{word: "gr", expect: []string{"graph"}},
+		{word: "g.Ver", expect: []string{"g.Vertex"}},
+		{word: ".Fol", expect: []string{".Follow", ".FollowR", ".FollowRecursive"}},
+		{word: "p.Unkn", expect: nil},
+	} {
+		got := ses.Complete(c.word)
+		if !reflect.DeepEqual(got, c.expect) {
+			t.Errorf("Unexpected completions for %q, got: %q expected: %q", c.word, got, c.expect)
+		}
+	}
+}
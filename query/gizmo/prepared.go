@@ -0,0 +1,215 @@
+// Copyright 2017 The Cayley Authors. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package gizmo
+
+import (
+	"context"
+	"reflect"
+	"sync"
+
+	"github.com/dop251/goja"
+
+	"github.com/cayleygraph/cayley/graph"
+	"github.com/cayleygraph/cayley/graph/iterator"
+	"github.com/cayleygraph/cayley/graph/path"
+	"github.com/cayleygraph/cayley/graph/shape"
+	"github.com/cayleygraph/cayley/query"
+)
+
+// ParamsName is the name of the global object that holds parameters of prepared queries.
+const ParamsName = "params"
+
+var _ query.Prepared = (*Prepared)(nil)
+
+// Prepared is a compiled Gizmo query. See query.Prepared.
+//
+// Sessions and optimized shapes of the query are reused between executions on the same quad store,
+// thus a Prepared keeps references to the last few quad stores it was executed on (see maxPools).
+type Prepared struct {
+	p *goja.Program
+
+	mu    sync.Mutex
+	pools []*sessionPool // most recently used first
+}
+
+// maxPools is the maximal number of quad stores a prepared query keeps idle sessions for.
+// Stores are often wrapped for each request, thus only the most recently used ones are kept.
+const maxPools = 8
+
+// Prepare compiles a Gizmo query, thus it can be executed multiple times without parsing it again.
+func Prepare(qu string) (*Prepared, error) {
+	p, err := goja.Compile("", qu, false)
+	if err != nil {
+		return nil, err
+	}
+	return &Prepared{p: p}, nil
+}
+
+// Execute runs the query in a read-only session on a given quad store.
+// Parameters are available to the query as fields of the global "params" object:
+//
+//	g.V(params.name).Out("<follows>").All()
+func (q *Prepared) Execute(ctx context.Context, qs graph.QuadStore, params map[string]interface{}, out chan query.Result, limit int) {
+	pool := q.poolFor(qs)
+	s := pool.get()
+	if params == nil {
+		params = make(map[string]interface{})
+	}
+	s.vm.Set(ParamsName, params)
+	s.execute(ctx, out, limit, func() (goja.Value, error) {
+		return s.runProgram(q.p)
+	})
+	if ctx.Err() != nil {
+		// runtime might be interrupted; don't reuse it
+		return
+	}
+	s.out, s.ctx = nil, nil
+	pool.put(s)
+}
+
+func (q *Prepared) poolFor(qs graph.QuadStore) *sessionPool {
+	if qs == nil || !reflect.TypeOf(qs).Comparable() {
+		// cannot be used as a key
+		return &sessionPool{qs: qs}
+	}
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	for i, p := range q.pools {
+		if p.qs == qs {
+			copy(q.pools[1:i+1], q.pools[:i])
+			q.pools[0] = p
+			return p
+		}
+	}
+	p := &sessionPool{qs: qs}
+	if len(q.pools) < maxPools {
+		q.pools = append(q.pools, nil)
+	}
+	copy(q.pools[1:], q.pools)
+	q.pools[0] = p
+	return p
+}
+
+// sessionPool keeps idle sessions of a prepared query for a single quad store.
+type sessionPool struct {
+	qs     graph.QuadStore
+	idle   sync.Pool
+	shapes shapeCache
+}
+
+func (p *sessionPool) get() *Session {
+	if s, ok := p.idle.Get().(*Session); ok {
+		return s
+	}
+	s := NewSession(p.qs)
+	s.shapes = &p.shapes
+	return s
+}
+
+func (p *sessionPool) put(s *Session) {
+	p.idle.Put(s)
+}
+
+// maxCachedShapes is the maximal number of optimized shapes cached for a prepared query on one quad store.
+const maxCachedShapes = 32
+
+// shapeCache keeps optimized shapes of a prepared query, thus they are not optimized again on each execution.
+//
+// Optimized shapes might depend on the content of the store, so they are only cached for versioned
+// stores and are dropped as soon as the store is changed.
+type shapeCache struct {
+	mu      sync.Mutex
+	horizon int64
+	shapes  []cachedShape
+}
+
+type cachedShape struct {
+	in, out shape.Shape
+}
+
+var shapePkg = reflect.TypeOf(shape.Null{}).PkgPath()
+
+// cacheable checks if the shape can be compared with the cached ones.
+// Shapes of other packages (such as the ones wrapping iterators) might be stateful.
+func cacheable(s shape.Shape) bool {
+	ok := true
+	shape.Walk(s, func(s shape.Shape) bool {
+		if reflect.TypeOf(s).PkgPath() != shapePkg {
+			ok = false
+		}
+		return ok
+	})
+	return ok
+}
+
+// reusable checks if an optimized shape can be used to build iterators multiple times.
+// Memo shares results between iterators, thus it cannot be used by more than one query.
+func reusable(s shape.Shape) bool {
+	ok := true
+	shape.Walk(s, func(s shape.Shape) bool {
+		if _, memo := s.(shape.Memo); memo {
+			ok = false
+		}
+		return ok
+	})
+	return ok
+}
+
+// optimize returns an optimized version of the shape. Cached version is returned if the store was not changed.
+func (c *shapeCache) optimize(qs graph.QuadStore, s shape.Shape) shape.Shape {
+	vs, ok := graph.AsVersioned(qs)
+	if !ok || !cacheable(s) {
+		s, _ = shape.Optimize(s, qs)
+		return s
+	}
+	h := vs.Horizon()
+	c.mu.Lock()
+	if c.horizon != h {
+		c.horizon, c.shapes = h, nil
+	}
+	for _, cs := range c.shapes {
+		if reflect.DeepEqual(cs.in, s) {
+			c.mu.Unlock()
+			return cs.out
+		}
+	}
+	c.mu.Unlock()
+
+	out, _ := shape.Optimize(s, qs)
+	if !reusable(out) {
+		return out
+	}
+	c.mu.Lock()
+	if c.horizon == h {
+		if len(c.shapes) >= maxCachedShapes {
+			c.shapes = c.shapes[1:]
+		}
+		c.shapes = append(c.shapes, cachedShape{in: s, out: out})
+	}
+	c.mu.Unlock()
+	return out
+}
+
+// buildIterator builds an iterator for the path. Prepared queries reuse optimized shapes of previous executions.
+func (s *Session) buildIterator(p *path.Path) graph.Iterator {
+	if s.shapes == nil {
+		return p.BuildIteratorOn(s.qs)
+	}
+	sh := s.shapes.optimize(s.qs, p.Shape())
+	if shape.IsNull(sh) {
+		return iterator.NewNull()
+	}
+	return sh.BuildIterator(s.qs)
+}
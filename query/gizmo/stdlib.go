@@ -0,0 +1,460 @@
+// Copyright 2017 The Cayley Authors. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package gizmo
+
+// Standard library of utility functions available to Gizmo scripts.
+
+import (
+	"crypto/rand"
+	"fmt"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/dop251/goja"
+
+	"github.com/cayleygraph/cayley/quad"
+)
+
+// dateLayouts are tried in order when parsing a date without an explicit layout.
+var dateLayouts = []string{
+	time.RFC3339Nano,
+	"2006-01-02T15:04:05",
+	"2006-01-02 15:04:05",
+	"2006-01-02",
+}
+
+// setupStdlib adds objects of the standard library to the environment.
+func (s *Session) setupStdlib() error {
+	v, err := s.vm.RunString(`(function(ms) { return new Date(ms); })`)
+	if err != nil {
+		return err
+	}
+	fnc, ok := goja.AssertFunction(v)
+	if !ok {
+		return fmt.Errorf("cannot create a Date constructor")
+	}
+	s.newDate = fnc
+	s.vm.Set("time", &timeObject{s: s, RFC3339: time.RFC3339, Date: "2006-01-02"})
+	s.vm.Set("uri", &uriObject{s: s})
+	s.vm.Set("strings", &stringsObject{s: s})
+	return nil
+}
+
+// dateValue converts time to a JS Date object.
+func (s *Session) dateValue(t time.Time) goja.Value {
+	v, err := s.newDate(goja.Undefined(), s.vm.ToValue(float64(t.UnixNano())/float64(time.Millisecond)))
+	if err != nil {
+		panic(err)
+	}
+	return v
+}
+
+// nativeValue is the same as quadValueToNative, but converts time values to JS Date objects.
+func (s *Session) nativeValue(v quad.Value) interface{} {
+	o := quadValueToNative(v)
+	if t, ok := o.(time.Time); ok {
+		return s.dateValue(t)
+	}
+	return o
+}
+
+func parseTime(str string) (time.Time, error) {
+	for _, layout := range dateLayouts {
+		if t, err := time.Parse(layout, str); err == nil {
+			return t, nil
+		}
+	}
+	return time.Time{}, fmt.Errorf("cannot parse time: %q", str)
+}
+
+// toTime converts JS Date, time value, date string or a number of milliseconds since epoch to time.
+func toTime(o interface{}) (time.Time, error) {
+	switch v := o.(type) {
+	case time.Time:
+		return v, nil
+	case quad.Time:
+		return time.Time(v), nil
+	case quad.TypedString:
+		if t, ok := v.Native().(time.Time); ok {
+			return t, nil
+		}
+		return parseTime(string(v.Value))
+	case quad.String:
+		return parseTime(string(v))
+	case string:
+		return parseTime(v)
+	}
+	if ms, ok := toInt(o); ok {
+		return time.Unix(0, int64(ms)*int64(time.Millisecond)), nil
+	}
+	return time.Time{}, fmt.Errorf("expected time, got: %T", o)
+}
+
+// toDuration converts a duration string (ex: "1h30m") or a number of milliseconds to duration.
+func toDuration(o interface{}) (time.Duration, error) {
+	if s, ok := o.(string); ok {
+		return time.ParseDuration(s)
+	}
+	switch v := o.(type) {
+	case float64:
+		return time.Duration(v * float64(time.Millisecond)), nil
+	case int64:
+		return time.Duration(v) * time.Millisecond, nil
+	case int:
+		return time.Duration(v) * time.Millisecond, nil
+	}
+	return 0, fmt.Errorf("expected duration, got: %T", o)
+}
+
+// toGoString converts a string or a node value to a string. IRIs are returned without brackets.
+func toGoString(o interface{}) string {
+	switch v := o.(type) {
+	case string:
+		return v
+	case quad.IRI:
+		return string(v)
+	case quad.BNode:
+		return string(v)
+	case quad.Value:
+		return quad.ToString(v)
+	case nil:
+		return ""
+	}
+	return fmt.Sprint(o)
+}
+
+// timeObject provides functions for date and time values.
+//
+// Name: `time`
+//
+// Functions of this object accept JS Date objects, time values of the graph, date strings and numbers
+// of milliseconds since epoch. Dates are returned as JS Date objects. Time values of the graph returned by
+// ToArray, ToValue, TagArray, TagValue and ForEach are converted to JS Date objects as well, and Date objects
+// passed to path functions are converted to time values.
+//
+// Calculations are done in UTC.
+//
+// Durations are either strings like "1h30m" (see Go time.ParseDuration), or numbers of milliseconds.
+//
+// Layouts used for parsing and formatting are Go layouts (see Go time package), for example "2006-01-02".
+// The object has `RFC3339` and `Date` properties with common layouts.
+type timeObject struct {
+	s *Session
+
+	RFC3339 string
+	Date    string
+}
+
+func (o *timeObject) args(call goja.FunctionCall, min, max int) []interface{} {
+	args := exportArgs(call.Arguments)
+	if len(args) < min || len(args) > max {
+		throwErr(o.s.vm, errArgCount2{Expected: min, Got: len(args)})
+	}
+	return args
+}
+
+// time converts the value to time in UTC, thus all calculations are independent of the local time zone.
+func (o *timeObject) time(v interface{}) time.Time {
+	t, err := toTime(v)
+	if err != nil {
+		throwErr(o.s.vm, err)
+	}
+	return t.UTC()
+}
+
+func (o *timeObject) duration(v interface{}) time.Duration {
+	dt, err := toDuration(v)
+	if err != nil {
+		throwErr(o.s.vm, err)
+	}
+	return dt
+}
+
+// Now returns the current time.
+// Signature: ()
+//
+// Example:
+// 	// javascript
+//	var now = time.Now()
+func (o *timeObject) Now(call goja.FunctionCall) goja.Value {
+	o.args(call, 0, 0)
+	return o.s.dateValue(time.Now())
+}
+
+// Parse parses a date string. If the layout is not set, RFC 3339 and "YYYY-MM-DD[ hh:mm:ss]" formats are tried.
+// Signature: (str, [layout])
+//
+// Example:
+// 	// javascript
+//	var d1 = time.Parse("2017-06-01T10:00:00Z")
+//	var d2 = time.Parse("01/06/2017", "02/01/2006")
+func (o *timeObject) Parse(call goja.FunctionCall) goja.Value {
+	args := o.args(call, 1, 2)
+	str := toGoString(args[0])
+	if len(args) == 1 {
+		return o.s.dateValue(o.time(str))
+	}
+	t, err := time.Parse(toGoString(args[1]), str)
+	if err != nil {
+		return throwErr(o.s.vm, err)
+	}
+	return o.s.dateValue(t)
+}
+
+// Format formats a date with a given layout, or as RFC 3339 if the layout is not set.
+// Signature: (date, [layout])
+//
+// Example:
+// 	// javascript
+//	// "2017-06-01"
+//	var s = time.Format(new Date(Date.UTC(2017, 5, 1)), time.Date)
+func (o *timeObject) Format(call goja.FunctionCall) goja.Value {
+	args := o.args(call, 1, 2)
+	layout := time.RFC3339
+	if len(args) > 1 {
+		layout = toGoString(args[1])
+	}
+	return o.s.vm.ToValue(o.time(args[0]).UTC().Format(layout))
+}
+
+// Add adds a duration to a date. Duration can be negative.
+// Signature: (date, duration)
+//
+// Example:
+// 	// javascript
+//	// nodes changed in the last 24 hours
+//	g.V().Has("<updated>", gt(time.Add(time.Now(), "-24h"))).All()
+func (o *timeObject) Add(call goja.FunctionCall) goja.Value {
+	args := o.args(call, 2, 2)
+	return o.s.dateValue(o.time(args[0]).Add(o.duration(args[1])))
+}
+
+// AddDate adds a given number of years, months and days to a date.
+// Signature: (date, years, [months], [days])
+//
+// Example:
+// 	// javascript
+//	var nextMonth = time.AddDate(time.Now(), 0, 1)
+func (o *timeObject) AddDate(call goja.FunctionCall) goja.Value {
+	args := o.args(call, 2, 4)
+	var n [3]int
+	for i, a := range args[1:] {
+		v, ok := toInt(a)
+		if !ok {
+			return throwErr(o.s.vm, fmt.Errorf("expected int arguments"))
+		}
+		n[i] = v
+	}
+	return o.s.dateValue(o.time(args[0]).AddDate(n[0], n[1], n[2]))
+}
+
+// Sub returns a difference between two dates in milliseconds.
+// Signature: (date1, date2)
+//
+// Example:
+// 	// javascript
+//	var age = time.Sub(time.Now(), time.Parse("2017-01-01"))
+func (o *timeObject) Sub(call goja.FunctionCall) goja.Value {
+	args := o.args(call, 2, 2)
+	dt := o.time(args[0]).Sub(o.time(args[1]))
+	return o.s.vm.ToValue(float64(dt) / float64(time.Millisecond))
+}
+
+// Truncate rounds a date down to a multiple of a duration since the zero time.
+// Signature: (date, duration)
+//
+// Example:
+// 	// javascript
+//	var hour = time.Truncate(time.Now(), "1h")
+func (o *timeObject) Truncate(call goja.FunctionCall) goja.Value {
+	args := o.args(call, 2, 2)
+	return o.s.dateValue(o.time(args[0]).Truncate(o.duration(args[1])))
+}
+
+// Unix returns a date for a given number of seconds since epoch.
+// Signature: (seconds)
+func (o *timeObject) Unix(call goja.FunctionCall) goja.Value {
+	args := o.args(call, 1, 1)
+	switch v := args[0].(type) {
+	case float64:
+		return o.s.dateValue(time.Unix(0, int64(v*float64(time.Second))))
+	case int64:
+		return o.s.dateValue(time.Unix(v, 0))
+	}
+	return throwErr(o.s.vm, fmt.Errorf("expected number, got: %T", args[0]))
+}
+
+// uriObject provides functions to encode and decode parts of URIs.
+//
+// Name: `uri`
+type uriObject struct {
+	s *Session
+}
+
+// Encode escapes a string to be used in a URI query.
+//
+// Example:
+// 	// javascript
+//	var node = iri("http://example.com/search?q=" + uri.Encode("a b&c"))
+func (o *uriObject) Encode(s string) string {
+	return url.QueryEscape(s)
+}
+
+// Decode is the reverse of Encode.
+func (o *uriObject) Decode(s string) (string, error) {
+	return url.QueryUnescape(s)
+}
+
+// EncodePath escapes a string to be used as a segment of a URI path.
+//
+// Example:
+// 	// javascript
+//	var node = iri("http://example.com/people/" + uri.EncodePath("John Doe"))
+func (o *uriObject) EncodePath(s string) string {
+	return url.PathEscape(s)
+}
+
+// DecodePath is the reverse of EncodePath.
+func (o *uriObject) DecodePath(s string) (string, error) {
+	return url.PathUnescape(s)
+}
+
+// stringsObject provides string utility functions.
+//
+// Name: `strings`
+//
+// Functions of this object accept node values as well as strings. IRIs are used without brackets.
+type stringsObject struct {
+	s *Session
+}
+
+// Split splits a string by a separator. If n is set, at most n parts are returned.
+// Signature: (str, sep, [n])
+//
+// Example:
+// 	// javascript
+//	// ["2017", "06", "01"]
+//	var parts = strings.Split("2017-06-01", "-")
+func (o *stringsObject) Split(call goja.FunctionCall) goja.Value {
+	args := exportArgs(call.Arguments)
+	if len(args) != 2 && len(args) != 3 {
+		return throwErr(o.s.vm, errArgCount2{Expected: 2, Got: len(args)})
+	}
+	n := -1
+	if len(args) == 3 {
+		var ok bool
+		if n, ok = toInt(args[2]); !ok {
+			return throwErr(o.s.vm, fmt.Errorf("expected int argument"))
+		}
+	}
+	parts := strings.SplitN(toGoString(args[0]), toGoString(args[1]), n)
+	out := make([]interface{}, 0, len(parts))
+	for _, p := range parts {
+		out = append(out, p)
+	}
+	return o.s.vm.ToValue(out)
+}
+
+// Join joins strings or node values with a separator.
+// Signature: (values, sep)
+func (o *stringsObject) Join(call goja.FunctionCall) goja.Value {
+	args := exportArgs(call.Arguments)
+	if len(args) != 2 {
+		return throwErr(o.s.vm, errArgCount2{Expected: 2, Got: len(args)})
+	}
+	arr, ok := args[0].([]interface{})
+	if !ok {
+		return throwErr(o.s.vm, fmt.Errorf("expected array, got: %T", args[0]))
+	}
+	strs := make([]string, 0, len(arr))
+	for _, v := range arr {
+		strs = append(strs, toGoString(v))
+	}
+	return o.s.vm.ToValue(strings.Join(strs, toGoString(args[1])))
+}
+
+// Format formats values according to a format string, as Go fmt.Sprintf does.
+// Signature: (format, [values...])
+//
+// Example:
+// 	// javascript
+//	// "alice has 2 friends"
+//	var s = strings.Format("%s has %d friends", "alice", 2)
+func (o *stringsObject) Format(call goja.FunctionCall) goja.Value {
+	args := exportArgs(call.Arguments)
+	if len(args) == 0 {
+		return throwErr(o.s.vm, errArgCount2{Expected: 1, Got: 0})
+	}
+	vals := make([]interface{}, 0, len(args)-1)
+	for _, v := range args[1:] {
+		switch v := v.(type) {
+		case float64:
+			// JS numbers are always floats
+			if float64(int64(v)) == v {
+				vals = append(vals, int64(v))
+				continue
+			}
+		case quad.Value:
+			vals = append(vals, toGoString(v))
+			continue
+		}
+		vals = append(vals, v)
+	}
+	return o.s.vm.ToValue(fmt.Sprintf(toGoString(args[0]), vals...))
+}
+
+// Trim removes leading and trailing characters contained in cutset, or whitespace if cutset is not set.
+// Signature: (str, [cutset])
+func (o *stringsObject) Trim(call goja.FunctionCall) goja.Value {
+	args := exportArgs(call.Arguments)
+	if len(args) != 1 && len(args) != 2 {
+		return throwErr(o.s.vm, errArgCount2{Expected: 1, Got: len(args)})
+	}
+	s := toGoString(args[0])
+	if len(args) == 1 {
+		return o.s.vm.ToValue(strings.TrimSpace(s))
+	}
+	return o.s.vm.ToValue(strings.Trim(s, toGoString(args[1])))
+}
+
+// Replace replaces all occurrences of a substring.
+// Signature: (str, old, new)
+func (o *stringsObject) Replace(call goja.FunctionCall) goja.Value {
+	args := exportArgs(call.Arguments)
+	if len(args) != 3 {
+		return throwErr(o.s.vm, errArgCount2{Expected: 3, Got: len(args)})
+	}
+	return o.s.vm.ToValue(strings.Replace(toGoString(args[0]), toGoString(args[1]), toGoString(args[2]), -1))
+}
+
+// UUID returns a new random UUID (version 4).
+//
+// Example:
+// 	// javascript
+//	var id = iri("urn:uuid:" + strings.UUID())
+func (o *stringsObject) UUID() (string, error) {
+	return newUUID()
+}
+
+func newUUID() (string, error) {
+	var b [16]byte
+	if _, err := rand.Read(b[:]); err != nil {
+		return "", err
+	}
+	b[6] = (b[6] & 0x0f) | 0x40 // version 4
+	b[8] = (b[8] & 0x3f) | 0x80 // RFC 4122 variant
+	return fmt.Sprintf("%x-%x-%x-%x-%x", b[0:4], b[4:6], b[6:8], b[8:10], b[10:]), nil
+}
@@ -25,6 +25,7 @@ import (
 	"github.com/cayleygraph/cayley/graph/iterator"
 	"github.com/cayleygraph/cayley/graph/path"
 	"github.com/cayleygraph/cayley/graph/shape"
+	"github.com/cayleygraph/cayley/quad"
 )
 
 // pathObject is a Path object in Gizmo.
@@ -81,7 +82,7 @@ func (p *pathObject) buildIteratorTree() graph.Iterator {
 	if p.path == nil {
 		return iterator.NewNull()
 	}
-	return p.path.BuildIteratorOn(p.s.qs)
+	return p.s.buildIterator(p.path)
 }
 
 // Filter all paths to ones which, at this point, are on the given node.
@@ -509,7 +510,28 @@ func (p *pathObject) Except(path *pathObject) *pathObject {
 	return p.new(np)
 }
 
+// Optional follows a morphism from the current nodes, but keeps all of them even if the morphism matches nothing.
+// Tags set inside the morphism are only returned for the nodes it matches, and the traversal continues from the current nodes.
+//
+// Unlike Or, it does not return the same node twice.
+// Example:
+// 	// javascript
+//	// Returns all people bob is followed by, and statuses of people they follow, if any.
+//	g.V("<bob>").In("<follows>").Optional(g.M().Out("<follows>").Out("<status>").Tag("status")).All()
+func (p *pathObject) Optional(path *pathObject) *pathObject {
+	np := p.clonePath().Optional(path.path)
+	return p.new(np)
+}
+
 // Unique removes duplicate values from the path.
+//
+// It can be used at any point of the path to remove duplicates before they are multiplied by the following steps.
+// Only the first path to each node is kept, thus tags set by other paths are lost.
+//
+// Example:
+// 	// javascript
+//	// Statuses of people followed by alice, charlie or dani, with each person counted once.
+//	g.V("<alice>", "<charlie>", "<dani>").Out("<follows>").Unique().Out("<status>").All()
 func (p *pathObject) Unique() *pathObject {
 	np := p.clonePath().Unique()
 	return p.new(np)
@@ -649,3 +671,24 @@ func (p *pathObject) Skip(offset int) *pathObject {
 	np := p.clonePath().Skip(int64(offset))
 	return p.new(np)
 }
+
+// NearestTo selects up to k vector values that are the closest to a given vector.
+// Quad store must support vector search.
+//
+// Arguments:
+//
+// * `vector`: An array of numbers to compare vector values with.
+// * `k`: A maximal number of vectors to select.
+//
+// Example:
+//	// javascript
+//	// Find 5 nodes with embeddings that are the closest to a given one
+//	g.V().NearestTo([0.1, 0.5, 0.2], 5).In("<embedding>").All()
+func (p *pathObject) NearestTo(vector []float64, k int) *pathObject {
+	vec := make([]float32, 0, len(vector))
+	for _, f := range vector {
+		vec = append(vec, float32(f))
+	}
+	np := p.clonePath().NearestTo(quad.NewVector(vec...), k)
+	return p.new(np)
+}
@@ -0,0 +1,184 @@
+// Copyright 2017 The Cayley Authors. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package gizmo
+
+import (
+	"fmt"
+
+	"github.com/dop251/goja"
+
+	"github.com/cayleygraph/cayley/graph"
+	"github.com/cayleygraph/cayley/quad"
+	"github.com/cayleygraph/cayley/query"
+)
+
+var _ query.Writer = (*Session)(nil)
+
+// SetWriter implements query.Writer. Changes made by the script are buffered and applied
+// with a given writer in a single transaction when the script completes successfully.
+func (s *Session) SetWriter(qw graph.QuadWriter) {
+	s.qw = qw
+}
+
+// Changed implements query.Writer.
+func (s *Session) Changed() bool {
+	return s.changed
+}
+
+// begin starts a transaction for a script, if the session is writable.
+func (s *Session) begin() {
+	s.changed = false
+	if s.qw == nil {
+		s.txs = nil
+		return
+	}
+	tx := graph.NewTransaction()
+	if vs, ok := graph.AsVersioned(s.qs); ok {
+		// all reads of the script happen after this point
+		tx.Base = vs.Horizon()
+	}
+	s.txs = []*graph.Transaction{tx}
+}
+
+// commit applies changes made by the script.
+func (s *Session) commit() error {
+	if len(s.txs) == 0 {
+		return nil
+	}
+	tx := s.txs[0]
+	s.txs = nil
+	if len(tx.Deltas) == 0 {
+		return nil
+	}
+	if err := s.qw.ApplyTransaction(tx); err != nil {
+		return err
+	}
+	s.changed = true
+	return nil
+}
+
+func (s *Session) currentTx() (*graph.Transaction, error) {
+	if len(s.txs) == 0 {
+		return nil, errReadOnly
+	}
+	return s.txs[len(s.txs)-1], nil
+}
+
+func toQuad(args []interface{}) (quad.Quad, error) {
+	if len(args) != 3 && len(args) != 4 {
+		return quad.Quad{}, errArgCount{Got: len(args)}
+	}
+	var vals [4]quad.Value
+	for i, a := range args {
+		if a == nil && i == 3 {
+			continue
+		}
+		v, err := toQuadValue(a)
+		if err != nil {
+			return quad.Quad{}, err
+		}
+		vals[i] = v
+	}
+	q := quad.Quad{Subject: vals[0], Predicate: vals[1], Object: vals[2], Label: vals[3]}
+	if !q.IsValid() {
+		return quad.Quad{}, fmt.Errorf("invalid quad: %v", q)
+	}
+	return q, nil
+}
+
+// AddQuad adds a quad to the graph. Session must be writable.
+// Signature: (subject, predicate, object, [label])
+//
+// Changes are buffered and applied atomically when the script completes without errors,
+// thus they are not visible to queries of the same script. If the quad store supports
+// conditional writes, the script fails if quads it changes were modified concurrently.
+//
+// Sessions are writable in the REPL and in HTTP queries sent with POST, unless the database is read-only.
+//
+//	// javascript
+//	if (g.V("<alice>").Out("<status>").Count() == 0) {
+//		g.AddQuad("<alice>", "<status>", "active")
+//	}
+func (g *graphObject) AddQuad(call goja.FunctionCall) goja.Value {
+	q, err := toQuad(exportArgs(call.Arguments))
+	if err != nil {
+		return throwErr(g.s.vm, err)
+	}
+	tx, err := g.s.currentTx()
+	if err != nil {
+		return throwErr(g.s.vm, err)
+	}
+	tx.AddQuad(q)
+	return goja.Null()
+}
+
+// RemoveQuad removes a quad from the graph. Session must be writable.
+// Signature: (subject, predicate, object, [label])
+//
+// See AddQuad for details on how changes are applied.
+func (g *graphObject) RemoveQuad(call goja.FunctionCall) goja.Value {
+	q, err := toQuad(exportArgs(call.Arguments))
+	if err != nil {
+		return throwErr(g.s.vm, err)
+	}
+	tx, err := g.s.currentTx()
+	if err != nil {
+		return throwErr(g.s.vm, err)
+	}
+	tx.RemoveQuad(q)
+	return goja.Null()
+}
+
+// Tx runs a function in a nested transaction and returns its result. Session must be writable.
+// Signature: (func)
+//
+// If the function throws, changes it made are discarded and the exception is propagated.
+// Otherwise, changes are kept and applied together with the rest of the script.
+//
+//	// javascript
+//	try {
+//		g.Tx(function() {
+//			g.RemoveQuad("<alice>", "<follows>", "<bob>")
+//			if (g.V("<bob>").Out("<status>").ToValue() == "cool_person") throw "cannot unfollow"
+//		})
+//	} catch(e) {}
+func (g *graphObject) Tx(call goja.FunctionCall) goja.Value {
+	fnc, ok := goja.AssertFunction(call.Argument(0))
+	if !ok {
+		return throwErr(g.s.vm, fmt.Errorf("expected js function"))
+	}
+	parent, err := g.s.currentTx()
+	if err != nil {
+		return throwErr(g.s.vm, err)
+	}
+	g.s.txs = append(g.s.txs, graph.NewTransaction())
+	v, err := fnc(goja.Undefined())
+	tx := g.s.txs[len(g.s.txs)-1]
+	g.s.txs = g.s.txs[:len(g.s.txs)-1]
+	if e, ok := err.(*goja.Exception); ok {
+		panic(e.Value())
+	} else if err != nil {
+		return throwErr(g.s.vm, err)
+	}
+	for _, d := range tx.Deltas {
+		switch d.Action {
+		case graph.Add:
+			parent.AddQuad(d.Quad)
+		case graph.Delete:
+			parent.RemoveQuad(d.Quad)
+		}
+	}
+	return v
+}
@@ -44,8 +44,9 @@ func init() {
 		REPL: func(qs graph.QuadStore) query.REPLSession {
 			return NewSession(qs)
 		},
-		HTTPError: httpError,
-		HTTPQuery: httpQuery,
+		ContentTypes: []string{"application/graphql"},
+		HTTPError:    httpError,
+		HTTPQuery:    httpQuery,
 	})
 }
 
@@ -77,6 +78,9 @@ func (s *Session) Execute(ctx context.Context, qu string, out chan query.Result,
 	if err != nil {
 		r = query.ErrorResult(err)
 	} else {
+		if query.TypedValues(ctx) {
+			m = query.TypedResult(m).(map[string]interface{})
+		}
 		r = resultMap(m)
 	}
 	select {
@@ -254,7 +258,7 @@ func iterateObject(ctx context.Context, qs graph.QuadStore, f *field, p *path.Pa
 	for _, r := range results {
 		obj := make(map[string]interface{})
 		for k, arr := range r.fields {
-			vals, err := graph.ValuesOf(ctx, qs, arr)
+			vals, err := graph.NamesOf(ctx, qs, arr)
 			if err != nil {
 				return nil, err
 			}
@@ -35,5 +35,11 @@ func httpQuery(ctx context.Context, qs graph.QuadStore, w query.ResponseWriter,
 		httpError(w, err)
 		return
 	}
+	if query.TypedValues(ctx) {
+		m = query.TypedResult(m).(map[string]interface{})
+	}
+	if query.CompactIRIs(ctx) {
+		m = query.CompactResult(m).(map[string]interface{})
+	}
 	json.NewEncoder(w).Encode(httpResult{Data: m})
 }
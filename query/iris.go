@@ -0,0 +1,70 @@
+package query
+
+import (
+	"context"
+
+	"github.com/cayleygraph/cayley/quad"
+	"github.com/cayleygraph/cayley/voc"
+)
+
+type compactIRIsKey struct{}
+
+// WithCompactIRIs returns a context that instructs query languages to compact IRIs in results
+// to prefixed names, using the global namespace registry (see voc).
+func WithCompactIRIs(ctx context.Context) context.Context {
+	return context.WithValue(ctx, compactIRIsKey{}, true)
+}
+
+// CompactIRIs checks if IRIs in query results should be compacted. See WithCompactIRIs.
+func CompactIRIs(ctx context.Context) bool {
+	v, _ := ctx.Value(compactIRIsKey{}).(bool)
+	return v
+}
+
+// CompactResult replaces all IRIs in the query result with prefixed names of registered namespaces.
+// Both quad.IRI values and their string representations (<iri>) are compacted, as well as IRIs of typed values.
+// Map keys are preserved.
+func CompactResult(v interface{}) interface{} {
+	switch v := v.(type) {
+	case quad.IRI:
+		return v.Short()
+	case string:
+		if n := len(v); n > 2 && v[0] == '<' && v[n-1] == '>' {
+			return "<" + voc.ShortIRI(v[1:n-1]) + ">"
+		}
+		return v
+	case []quad.Value:
+		out := make([]quad.Value, 0, len(v))
+		for _, qv := range v {
+			if iri, ok := qv.(quad.IRI); ok {
+				qv = iri.Short()
+			}
+			out = append(out, qv)
+		}
+		return out
+	case []interface{}:
+		out := make([]interface{}, 0, len(v))
+		for _, e := range v {
+			out = append(out, CompactResult(e))
+		}
+		return out
+	case []map[string]interface{}:
+		out := make([]map[string]interface{}, 0, len(v))
+		for _, e := range v {
+			out = append(out, CompactResult(e).(map[string]interface{}))
+		}
+		return out
+	case map[string]interface{}:
+		out := make(map[string]interface{}, len(v))
+		for k, e := range v {
+			if s, ok := e.(string); ok && (k == "@id" || k == "@type") {
+				// typed values, see TypedValue
+				out[k] = voc.ShortIRI(s)
+				continue
+			}
+			out[k] = CompactResult(e)
+		}
+		return out
+	}
+	return v
+}
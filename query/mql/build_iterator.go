@@ -25,10 +25,14 @@ import (
 	"github.com/cayleygraph/cayley/quad"
 )
 
-func (q *Query) buildFixed(s string) graph.Iterator {
+func (q *Query) buildFixed(s string) (graph.Iterator, error) {
+	ref, err := q.valueOf(quad.StringToValue(s))
+	if err != nil {
+		return nil, err
+	}
 	f := iterator.NewFixed()
-	f.Add(q.ses.qs.ValueOf(quad.StringToValue(s)))
-	return f
+	f.Add(ref)
+	return f, nil
 }
 
 func (q *Query) buildResultIterator(path Path) graph.Iterator {
@@ -42,6 +46,7 @@ func (q *Query) BuildIteratorTree(query interface{}) {
 	q.queryStructure = make(map[Path]map[string]interface{})
 	q.queryResult = make(map[ResultPath]map[string]interface{})
 	q.queryResult[""] = make(map[string]interface{})
+	q.options = make(map[Path]*clauseOptions)
 
 	var isOptional bool
 	q.it, isOptional, q.err = q.buildIteratorTreeInternal(query, NewPath())
@@ -59,21 +64,21 @@ func (q *Query) buildIteratorTreeInternal(query interface{}, path Path) (it grap
 		// Treat the bool as a string and call it a day.
 		// Things which are really bool-like are special cases and will be dealt with separately.
 		if t {
-			it = q.buildFixed("true")
+			it, err = q.buildFixed("true")
 		}
-		it = q.buildFixed("false")
+		it, err = q.buildFixed("false")
 	case float64:
 		// for JSON numbers
 		// Damn you, Javascript, and your lack of integer values.
 		if math.Floor(t) == t {
 			// Treat it like an integer.
-			it = q.buildFixed(fmt.Sprintf("%0.f", t))
+			it, err = q.buildFixed(fmt.Sprintf("%0.f", t))
 		} else {
-			it = q.buildFixed(fmt.Sprintf("%f", t))
+			it, err = q.buildFixed(fmt.Sprintf("%f", t))
 		}
 	case string:
 		// for JSON strings
-		it = q.buildFixed(t)
+		it, err = q.buildFixed(t)
 	case []interface{}:
 		// for JSON arrays
 		q.isRepeated[path] = true
@@ -102,10 +107,18 @@ func (q *Query) buildIteratorTreeInternal(query interface{}, path Path) (it grap
 }
 
 func (q *Query) buildIteratorTreeMapInternal(query map[string]interface{}, path Path) (graph.Iterator, error) {
+	query, opts, err := parseOptions(query)
+	if err != nil {
+		return nil, err
+	} else if opts != nil {
+		q.options[path] = opts
+		if opts.count {
+			// collect all results to count them
+			q.isRepeated[path] = true
+		}
+	}
 	it := iterator.NewAnd(q.ses.qs)
 	it.AddSubIterator(q.ses.qs.NodesAllIterator())
-	var err error
-	err = nil
 	outputStructure := make(map[string]interface{})
 	for key, subquery := range query {
 		optional := false
@@ -136,9 +149,13 @@ func (q *Query) buildIteratorTreeMapInternal(query map[string]interface{}, path
 			if err != nil {
 				return nil, err
 			}
+			pref, err := q.valueOf(quad.StringToValue(pred))
+			if err != nil {
+				return nil, err
+			}
 			subAnd := iterator.NewAnd(q.ses.qs)
 			predFixed := iterator.NewFixed()
-			predFixed.Add(q.ses.qs.ValueOf(quad.StringToValue(pred)))
+			predFixed.Add(pref)
 			subAnd.AddSubIterator(iterator.NewLinksTo(q.ses.qs, predFixed, quad.Predicate))
 			if reverse {
 				lto := iterator.NewLinksTo(q.ses.qs, builtIt, quad.Subject)
@@ -15,6 +15,7 @@
 package mql
 
 import (
+	"context"
 	"fmt"
 	"sort"
 
@@ -29,7 +30,7 @@ func (q *Query) treeifyResult(tags map[string]graph.Value) map[ResultPath]string
 		if v == nil {
 			continue
 		}
-		results[Path(k)] = quadValueToNative(q.ses.qs.NameOf(v))
+		results[Path(k)] = q.valueString(q.nameOf(v))
 	}
 	resultPaths := make(map[ResultPath]string)
 	for k, v := range results {
@@ -119,6 +120,26 @@ func (q *Query) buildResults() {
 	}
 }
 
+// finishResults applies clause directives to the results.
+func (q *Query) finishResults() {
+	ctx := q.ctx
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	if q.results == nil && q.options[""] == nil {
+		return
+	}
+	switch v := q.applyOptions(ctx, "", q.results).(type) {
+	case []interface{}:
+		q.results = v
+	default:
+		q.results = []interface{}{v}
+	}
+	if q.typed {
+		q.typedResult(q.results)
+	}
+}
+
 func quadValueToNative(v quad.Value) string {
 	out := quad.NativeOf(v)
 	if nv, ok := out.(quad.Value); ok && v == nv {
@@ -25,6 +25,7 @@ import (
 	_ "github.com/cayleygraph/cayley/graph/memstore"
 	"github.com/cayleygraph/cayley/quad"
 	"github.com/cayleygraph/cayley/query"
+	"github.com/cayleygraph/cayley/voc/schema"
 	_ "github.com/cayleygraph/cayley/writer"
 )
 
@@ -158,6 +159,101 @@ var testQueries = []struct {
 			]
 		`,
 	},
+	{
+		message: "get nested reverse follows",
+		query:   `[{"id": "<greg>", "!<follows>": [{"id": null, "!<follows>": []}]}]`,
+		expect: `
+			[
+				{"id": "<greg>", "!<follows>": [
+					{"id": "<dani>", "!<follows>": ["<charlie>"]},
+					{"id": "<fred>", "!<follows>": ["<bob>", "<emily>"]}
+				]}
+			]
+		`,
+	},
+	{
+		message: "return empty list for optional values",
+		query:   `[{"id": "<dani>", "!<follows>": [{"id": null, "!<follows>": []}]}]`,
+		expect: `
+			[
+				{"id": "<dani>", "!<follows>": [{"id": "<charlie>", "!<follows>": []}]}
+			]
+		`,
+	},
+	{
+		message: "count nested results",
+		query:   `[{"id": null, "<follows>": {"return": "count"}, "<status>": "cool_person"}]`,
+		expect: `
+			[
+				{"id": "<bob>", "<follows>": 1, "<status>": "cool_person"},
+				{"id": "<dani>", "<follows>": 2, "<status>": "cool_person"}
+			]
+		`,
+	},
+	{
+		message: "count top-level results",
+		query:   `[{"id": null, "<status>": "cool_person", "return": "count"}]`,
+		expect:  `[3]`,
+	},
+	{
+		message: "sort and limit results",
+		query:   `[{"id": null, "!<follows>": [{"id": null, "sort": "-id", "limit": 1}], "sort": "-id", "limit": 2}]`,
+		expect: `
+			[
+				{"id": "<greg>", "!<follows>": [{"id": "<fred>"}]},
+				{"id": "<fred>", "!<follows>": [{"id": "<emily>"}]}
+			]
+		`,
+	},
+	{
+		message: "sort by count",
+		query:   `[{"id": null, "!<follows>": {"return": "count"}, "sort": ["-!<follows>", "id"], "limit": 2}]`,
+		expect: `
+			[
+				{"id": "<bob>", "!<follows>": 3},
+				{"id": "<fred>", "!<follows>": 2}
+			]
+		`,
+	},
+	{
+		message: "list all properties",
+		query:   `[{"id": "<dani>", "<follows>": "<greg>", "*": null}]`,
+		expect: `
+			[
+				{"id": "<dani>", "<follows>": "<greg>", "<status>": ["cool_person"]}
+			]
+		`,
+	},
+	{
+		message: "list all properties without id",
+		query:   `[{"<status>": "smart_person", "<follows>": [], "*": null}]`,
+		expect: `
+			[
+				{"<status>": "smart_person", "<follows>": ["<fred>"]},
+				{"<status>": "smart_person", "<follows>": []}
+			]
+		`,
+	},
+}
+
+func TestMQLInvalidDirectives(t *testing.T) {
+	for _, qu := range []string{
+		`[{"id": null, "return": "all"}]`,
+		`[{"id": null, "sort": 1}]`,
+		`[{"id": null, "limit": -1}]`,
+		`[{"id": null, "*": "<bob>"}]`,
+	} {
+		s := makeTestSession(nil)
+		c := make(chan query.Result, 1)
+		go s.Execute(context.TODO(), qu, c, -1)
+		var err error
+		for r := range c {
+			err = r.Err()
+		}
+		if err == nil {
+			t.Errorf("expected an error for %s", qu)
+		}
+	}
 }
 
 func runQuery(g []quad.Quad, qu string) interface{} {
@@ -176,6 +272,11 @@ func TestMQL(t *testing.T) {
 	for _, test := range testQueries {
 		t.Run(test.message, func(t *testing.T) {
 			got := runQuery(simpleGraph, test.query)
+			// counts are integers, while JSON numbers are decoded as floats
+			if data, err := json.Marshal(got); err == nil {
+				got = nil
+				json.Unmarshal(data, &got)
+			}
 			var expect interface{}
 			json.Unmarshal([]byte(test.expect), &expect)
 			if !reflect.DeepEqual(got, expect) {
@@ -188,3 +289,33 @@ func TestMQL(t *testing.T) {
 		})
 	}
 }
+
+func TestMQLTypedValues(t *testing.T) {
+	s := makeTestSession([]quad.Quad{
+		{Subject: quad.IRI("alice"), Predicate: quad.IRI("age"), Object: quad.Int(30)},
+		{Subject: quad.IRI("bob"), Predicate: quad.IRI("age"), Object: quad.Int(9)},
+	})
+	ctx := query.WithTypedValues(context.TODO())
+	c := make(chan query.Result, 5)
+	go s.Execute(ctx, `[{"id": null, "<age>": null, "sort": "-<age>", "limit": 2}]`, c, -1)
+	for result := range c {
+		s.Collate(result)
+	}
+	got, err := s.Results()
+	if err != nil {
+		t.Fatal(err)
+	}
+	expect := []interface{}{
+		map[string]interface{}{
+			"id":    map[string]interface{}{"@id": "alice"},
+			"<age>": map[string]interface{}{"@value": 30, "@type": schema.Integer},
+		},
+		map[string]interface{}{
+			"id":    map[string]interface{}{"@id": "bob"},
+			"<age>": map[string]interface{}{"@value": 9, "@type": schema.Integer},
+		},
+	}
+	if !reflect.DeepEqual(got, expect) {
+		t.Errorf("got: %v expected: %v", got, expect)
+	}
+}
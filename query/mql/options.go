@@ -0,0 +1,282 @@
+// Copyright 2017 The Cayley Authors. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package mql
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/cayleygraph/cayley/graph"
+	"github.com/cayleygraph/cayley/quad"
+)
+
+// Directives that can be used in any clause. They are not treated as predicates.
+const (
+	keyReturn   = "return"
+	keySort     = "sort"
+	keyLimit    = "limit"
+	keyWildcard = "*"
+)
+
+// clauseOptions are directives of a single clause. They are applied after results are collected.
+type clauseOptions struct {
+	count    bool     // return the number of results instead of the results
+	sort     []string // keys to sort results by; "-" prefix means descending order
+	limit    int      // maximal number of results; negative means no limit
+	wildcard bool     // list all properties of the node
+	hideID   bool     // id was added to the query by the wildcard and is not returned
+}
+
+// parseOptions removes directives from the clause and returns the remaining query.
+// It returns nil options if the clause has no directives.
+func parseOptions(query map[string]interface{}) (map[string]interface{}, *clauseOptions, error) {
+	var opts *clauseOptions
+	out := make(map[string]interface{}, len(query))
+	for k, v := range query {
+		switch k {
+		case keyReturn, keySort, keyLimit, keyWildcard:
+		default:
+			out[k] = v
+			continue
+		}
+		if opts == nil {
+			opts = &clauseOptions{limit: -1}
+		}
+		switch k {
+		case keyReturn:
+			if v != "count" {
+				return nil, nil, fmt.Errorf("unsupported return value: %v", v)
+			}
+			opts.count = true
+		case keySort:
+			switch v := v.(type) {
+			case string:
+				opts.sort = []string{v}
+			case []interface{}:
+				for _, s := range v {
+					str, ok := s.(string)
+					if !ok {
+						return nil, nil, fmt.Errorf("sort keys must be strings, got: %T", s)
+					}
+					opts.sort = append(opts.sort, str)
+				}
+			default:
+				return nil, nil, fmt.Errorf("sort keys must be strings, got: %T", v)
+			}
+		case keyLimit:
+			f, ok := v.(float64)
+			if !ok || f < 0 || math.Floor(f) != f {
+				return nil, nil, fmt.Errorf("limit must be a non-negative integer, got: %v", v)
+			}
+			opts.limit = int(f)
+		case keyWildcard:
+			if arr, ok := v.([]interface{}); v != nil && (!ok || len(arr) != 0) {
+				return nil, nil, fmt.Errorf("wildcard only accepts null or an empty list")
+			}
+			opts.wildcard = true
+			if _, ok := query["id"]; !ok {
+				out["id"] = nil
+				opts.hideID = true
+			}
+		}
+	}
+	return out, opts, nil
+}
+
+// applyOptions applies clause directives to the results collected at a given path.
+func (q *Query) applyOptions(ctx context.Context, path Path, v interface{}) interface{} {
+	switch t := v.(type) {
+	case map[string]interface{}:
+		q.applyObjectOptions(ctx, path, t)
+	case []interface{}:
+		for _, e := range t {
+			if m, ok := e.(map[string]interface{}); ok {
+				q.applyObjectOptions(ctx, path, m)
+			}
+		}
+	}
+	if v == nil && q.isRepeated[path] {
+		// empty list was requested
+		v = []interface{}{}
+	}
+	opts := q.options[path]
+	if opts == nil {
+		return v
+	}
+	list, ok := v.([]interface{})
+	if !ok {
+		return v
+	}
+	if len(opts.sort) != 0 {
+		q.sortResults(list, opts.sort)
+	}
+	if opts.limit >= 0 && len(list) > opts.limit {
+		list = list[:opts.limit]
+	}
+	if opts.count {
+		return len(list)
+	}
+	return list
+}
+
+func (q *Query) applyObjectOptions(ctx context.Context, path Path, m map[string]interface{}) {
+	for k, v := range m {
+		m[k] = q.applyOptions(ctx, path.Follow(k), v)
+	}
+	opts := q.options[path]
+	if opts == nil || !opts.wildcard {
+		return
+	}
+	if err := q.fillProperties(ctx, m); err != nil && q.err == nil {
+		q.err = err
+	}
+	if opts.hideID {
+		delete(m, "id")
+	}
+}
+
+// fillProperties sets all properties of the node that are not already in the object. Values are always lists.
+func (q *Query) fillProperties(ctx context.Context, m map[string]interface{}) error {
+	id, ok := m["id"].(string)
+	if !ok {
+		return nil
+	}
+	qs := q.ses.qs
+	ref, err := graph.ValueOf(ctx, qs, quad.StringToValue(id))
+	if err != nil || ref == nil {
+		return err
+	}
+	seen := make(map[[2]string]struct{})
+	props := make(map[string][]interface{})
+	it := qs.QuadIterator(quad.Subject, ref)
+	defer it.Close()
+	var qerr error
+	err = graph.Iterate(ctx, it).Each(func(v graph.Value) {
+		if qerr != nil {
+			return
+		}
+		qd, err := graph.QuadOf(ctx, qs, v)
+		if err != nil {
+			qerr = err
+			return
+		}
+		p, o := quadValueToNative(qd.Predicate), q.valueString(qd.Object)
+		if _, ok := m[p]; ok {
+			return
+		}
+		key := [2]string{p, o}
+		if _, ok := seen[key]; ok {
+			return
+		}
+		seen[key] = struct{}{}
+		props[p] = append(props[p], o)
+	})
+	if err == nil {
+		err = qerr
+	}
+	if err != nil {
+		return err
+	}
+	for p, vals := range props {
+		m[p] = vals
+	}
+	return nil
+}
+
+// sortKey returns a value that is used to sort results.
+func (q *Query) sortKey(v interface{}) interface{} {
+	switch t := v.(type) {
+	case map[string]interface{}:
+		return q.sortKey(t["id"])
+	case []interface{}:
+		if len(t) == 0 {
+			return nil
+		}
+		return q.sortKey(t[0])
+	case string:
+		return q.nativeValue(t)
+	}
+	return v
+}
+
+// compareValues compares results. Nil values go first; numbers and numeric strings are compared as numbers.
+func (q *Query) compareValues(a, b interface{}) int {
+	a, b = q.sortKey(a), q.sortKey(b)
+	if a == nil || b == nil {
+		switch {
+		case a == nil && b == nil:
+			return 0
+		case a == nil:
+			return -1
+		}
+		return +1
+	}
+	if fa, ok := toFloat(a); ok {
+		if fb, ok := toFloat(b); ok {
+			switch {
+			case fa < fb:
+				return -1
+			case fa > fb:
+				return +1
+			}
+			return 0
+		}
+	}
+	return strings.Compare(fmt.Sprint(a), fmt.Sprint(b))
+}
+
+func toFloat(v interface{}) (float64, bool) {
+	switch t := v.(type) {
+	case int:
+		return float64(t), true
+	case int64:
+		return float64(t), true
+	case float64:
+		return t, true
+	case string:
+		f, err := strconv.ParseFloat(t, 64)
+		return f, err == nil
+	}
+	return 0, false
+}
+
+// sortResults sorts results by given keys. Keys with "-" prefix sort in descending order.
+func (q *Query) sortResults(list []interface{}, keys []string) {
+	sort.SliceStable(list, func(i, j int) bool {
+		for _, k := range keys {
+			desc := strings.HasPrefix(k, "-")
+			k = strings.TrimPrefix(k, "-")
+			var a, b interface{} = list[i], list[j]
+			if m, ok := a.(map[string]interface{}); ok {
+				a = m[k]
+			}
+			if m, ok := b.(map[string]interface{}); ok {
+				b = m[k]
+			}
+			c := q.compareValues(a, b)
+			if desc {
+				c = -c
+			}
+			if c != 0 {
+				return c < 0
+			}
+		}
+		return false
+	})
+}
@@ -15,10 +15,13 @@
 package mql
 
 import (
+	"context"
 	"fmt"
 	"strings"
 
 	"github.com/cayleygraph/cayley/graph"
+	"github.com/cayleygraph/cayley/quad"
+	"github.com/cayleygraph/cayley/query"
 )
 
 type (
@@ -27,6 +30,7 @@ type (
 )
 
 type Query struct {
+	ctx            context.Context
 	ses            *Session
 	it             graph.Iterator
 	isRepeated     map[Path]bool
@@ -34,7 +38,11 @@ type Query struct {
 	queryResult    map[ResultPath]map[string]interface{}
 	results        []interface{}
 	resultOrder    []string
-	err            error
+	options        map[Path]*clauseOptions
+	// typed values mode: results are collected as N-Quad strings of values, and converted at the end
+	typed  bool
+	values map[string]quad.Value
+	err    error
 }
 
 func (q *Query) isError() bool {
@@ -111,3 +119,73 @@ func NewQuery(ses *Session) *Query {
 	q.err = nil
 	return &q
 }
+
+// setContext sets the context of the query execution.
+func (q *Query) setContext(ctx context.Context) {
+	q.ctx = ctx
+	if query.TypedValues(ctx) {
+		q.typed = true
+		q.values = make(map[string]quad.Value)
+	}
+}
+
+// nameOf loads a value from the quad store with the context of the query.
+// Errors are saved to the query.
+func (q *Query) nameOf(v graph.Value) quad.Value {
+	ctx := q.ctx
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	nv, err := graph.NameOf(ctx, q.ses.qs, v)
+	if err != nil && q.err == nil {
+		q.err = err
+	}
+	return nv
+}
+
+// valueOf resolves a value in the quad store with the context of the query.
+func (q *Query) valueOf(v quad.Value) (graph.Value, error) {
+	ctx := q.ctx
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	return graph.ValueOf(ctx, q.ses.qs, v)
+}
+
+// valueString converts the value to a string used in results.
+func (q *Query) valueString(v quad.Value) string {
+	if !q.typed {
+		return quadValueToNative(v)
+	}
+	// unlike native values, N-Quad strings of different values never collide
+	s := quad.StringOf(v)
+	q.values[s] = v
+	return s
+}
+
+// typedResult replaces values in results with their typed representation. See query.TypedValue.
+func (q *Query) typedResult(v interface{}) interface{} {
+	switch t := v.(type) {
+	case string:
+		if qv, ok := q.values[t]; ok {
+			return query.TypedValue(qv)
+		}
+	case []interface{}:
+		for i, e := range t {
+			t[i] = q.typedResult(e)
+		}
+	case map[string]interface{}:
+		for k, e := range t {
+			t[k] = q.typedResult(e)
+		}
+	}
+	return v
+}
+
+// nativeValue returns a native value of the result string. It is used for sorting.
+func (q *Query) nativeValue(s string) interface{} {
+	if qv, ok := q.values[s]; ok {
+		return quad.NativeOf(qv)
+	}
+	return s
+}
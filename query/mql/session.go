@@ -81,6 +81,7 @@ func (s *Session) Execute(ctx context.Context, input string, c chan query.Result
 		return
 	}
 	s.query = NewQuery(s)
+	s.query.setContext(ctx)
 	s.query.BuildIteratorTree(mqlQuery)
 	if s.query.isError() {
 		select {
@@ -141,6 +142,7 @@ func (s *Session) Collate(result query.Result) {
 
 func (s *Session) Results() (interface{}, error) {
 	s.query.buildResults()
+	s.query.finishResults()
 	if s.query.isError() {
 		return nil, s.query.err
 	}
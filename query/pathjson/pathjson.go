@@ -0,0 +1,192 @@
+// Copyright 2017 The Cayley Authors. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package pathjson implements a query language that executes paths encoded as JSON.
+// See path.Path.MarshalJSON for the format.
+package pathjson
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"sort"
+
+	"github.com/cayleygraph/cayley/graph"
+	"github.com/cayleygraph/cayley/graph/iterator"
+	"github.com/cayleygraph/cayley/graph/path"
+	"github.com/cayleygraph/cayley/quad"
+	"github.com/cayleygraph/cayley/query"
+)
+
+const Name = "pathjson"
+
+// ResultTag is the name of the field that holds the result node of the path.
+const ResultTag = "id"
+
+func init() {
+	query.RegisterLanguage(query.Language{
+		Name: Name,
+		Session: func(qs graph.QuadStore) query.Session {
+			return NewSession(qs)
+		},
+		HTTP: func(qs graph.QuadStore) query.HTTP {
+			return NewSession(qs)
+		},
+		REPL: func(qs graph.QuadStore) query.REPLSession {
+			return NewSession(qs)
+		},
+		ContentTypes: []string{"application/x-cayley-path+json"},
+	})
+}
+
+var _ query.HTTPStreamer = (*Session)(nil)
+
+type Session struct {
+	qs  graph.QuadStore
+	ctx context.Context
+	out []interface{}
+	err error
+}
+
+func NewSession(qs graph.QuadStore) *Session {
+	return &Session{qs: qs}
+}
+
+// parse decodes the path and tags its results with ResultTag.
+func (s *Session) parse(qu string) (*path.Path, error) {
+	p := path.NewPath(s.qs)
+	if err := json.Unmarshal([]byte(qu), p); err != nil {
+		return nil, err
+	}
+	return p.Tag(ResultTag), nil
+}
+
+func (s *Session) Execute(ctx context.Context, qu string, out chan query.Result, limit int) {
+	defer close(out)
+	s.ctx = ctx
+	p, err := s.parse(qu)
+	if err == nil {
+		err = p.Iterate(ctx).Paths(true).Limit(limit).TagEach(func(tags map[string]graph.Value) {
+			select {
+			case out <- query.TagMapResult(tags):
+			case <-ctx.Done():
+			}
+		})
+	}
+	if err != nil {
+		select {
+		case out <- query.ErrorResult(err):
+		case <-ctx.Done():
+		}
+	}
+}
+
+func (s *Session) ShapeOf(qu string) (interface{}, error) {
+	p, err := s.parse(qu)
+	if err != nil {
+		return nil, err
+	}
+	output := make(map[string]interface{})
+	iterator.OutputQueryShapeForIterator(p.BuildIterator(), s.qs, output)
+	return output, nil
+}
+
+func (s *Session) Collate(result query.Result) {
+	if err := result.Err(); err != nil {
+		s.err = err
+		return
+	}
+	v, err := s.ConvertResult(result)
+	if err != nil {
+		s.err = err
+		return
+	} else if v != nil {
+		s.out = append(s.out, v)
+	}
+}
+
+// ConvertResult implements query.HTTPStreamer.
+func (s *Session) ConvertResult(result query.Result) (interface{}, error) {
+	if err := result.Err(); err != nil {
+		return nil, err
+	}
+	tags, ok := result.Result().(map[string]graph.Value)
+	if !ok {
+		return nil, fmt.Errorf("unexpected result type: %T", result.Result())
+	}
+	ctx := s.ctx
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	typed := query.TypedValues(ctx)
+	obj := make(map[string]interface{}, len(tags))
+	for k, v := range tags {
+		name, err := graph.NameOf(ctx, s.qs, v)
+		if err != nil {
+			return nil, err
+		} else if name == nil {
+			continue
+		}
+		if typed {
+			obj[k] = query.TypedValue(name)
+		} else {
+			obj[k] = nativeValue(name)
+		}
+	}
+	if len(obj) == 0 {
+		return nil, nil
+	}
+	return obj, nil
+}
+
+func (s *Session) Results() (interface{}, error) {
+	out, err := s.out, s.err
+	s.out, s.err = nil, nil
+	if err != nil {
+		return nil, err
+	}
+	if out == nil {
+		out = []interface{}{}
+	}
+	return out, nil
+}
+
+func (s *Session) FormatREPL(result query.Result) string {
+	if err := result.Err(); err != nil {
+		return fmt.Sprintf("Error: %v\n", err)
+	}
+	tags, ok := result.Result().(map[string]graph.Value)
+	if !ok {
+		return ""
+	}
+	keys := make([]string, 0, len(tags))
+	for k := range tags {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	out := fmt.Sprintln("****")
+	for _, k := range keys {
+		out += fmt.Sprintf("%s : %s\n", k, s.qs.NameOf(tags[k]))
+	}
+	return out
+}
+
+// nativeValue converts a value to a native Go type, or to a string if the value has no native representation.
+func nativeValue(v quad.Value) interface{} {
+	out := v.Native()
+	if nv, ok := out.(quad.Value); ok && v == nv {
+		return quad.StringOf(v)
+	}
+	return out
+}
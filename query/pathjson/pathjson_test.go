@@ -0,0 +1,79 @@
+// Copyright 2017 The Cayley Authors. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package pathjson
+
+import (
+	"context"
+	"encoding/json"
+	"reflect"
+	"sort"
+	"testing"
+
+	"github.com/cayleygraph/cayley/graph"
+	_ "github.com/cayleygraph/cayley/graph/memstore"
+	"github.com/cayleygraph/cayley/graph/path"
+	"github.com/cayleygraph/cayley/quad"
+	"github.com/cayleygraph/cayley/query"
+	_ "github.com/cayleygraph/cayley/writer"
+)
+
+func TestExecute(t *testing.T) {
+	qs, _ := graph.NewQuadStore("memstore", "", nil)
+	w, _ := graph.NewQuadWriter("single", qs, nil)
+	err := w.AddQuadSet([]quad.Quad{
+		quad.MakeIRI("alice", "follows", "bob", ""),
+		quad.MakeIRI("alice", "follows", "charlie", ""),
+		quad.Make(quad.IRI("bob"), quad.IRI("age"), quad.Int(30), nil),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	p := path.StartMorphism(quad.IRI("alice")).Out(quad.IRI("follows")).Tag("friend").SaveOptional(quad.IRI("age"), "age")
+	data, err := json.Marshal(p)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	s := NewSession(qs)
+	c := make(chan query.Result, 5)
+	go s.Execute(context.TODO(), string(data), c, -1)
+	for r := range c {
+		s.Collate(r)
+	}
+	res, err := s.Results()
+	if err != nil {
+		t.Fatal(err)
+	}
+	got := res.([]interface{})
+	sort.Slice(got, func(i, j int) bool {
+		return got[i].(map[string]interface{})["id"].(string) < got[j].(map[string]interface{})["id"].(string)
+	})
+	expect := []interface{}{
+		map[string]interface{}{"id": "<bob>", "friend": "<bob>", "age": 30},
+		map[string]interface{}{"id": "<charlie>", "friend": "<charlie>"},
+	}
+	if !reflect.DeepEqual(got, expect) {
+		t.Fatalf("unexpected results: %v", got)
+	}
+
+	c = make(chan query.Result, 5)
+	go s.Execute(context.TODO(), `[{"op": "unknown"}]`, c, -1)
+	for r := range c {
+		s.Collate(r)
+	}
+	if _, err = s.Results(); err == nil {
+		t.Fatal("expected an error for an unknown step")
+	}
+}
@@ -0,0 +1,64 @@
+package query
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/cayleygraph/cayley/graph"
+)
+
+// ErrParamsNotSupported is returned when parameters are passed to a query of the language that does not support them.
+var ErrParamsNotSupported = errors.New("query: parameters are not supported by this language")
+
+// Prepared is a query that was parsed once and can be executed multiple times.
+//
+// Prepared queries are not bound to a quad store and are safe for concurrent use.
+type Prepared interface {
+	// Execute runs the query on a given quad store. Parameters are passed to the query in a language-specific way.
+	// Results are sent on the channel, with the same semantics as Session.Execute.
+	Execute(ctx context.Context, qs graph.QuadStore, params map[string]interface{}, out chan Result, limit int)
+}
+
+// Prepare parses a query in a given language, thus it can be executed multiple times without parsing it again.
+//
+// If the language has no support for prepared queries, the query is executed in a new session each time,
+// and ErrParamsNotSupported is returned for all executions with parameters.
+func Prepare(lang, query string) (Prepared, error) {
+	l := GetLanguage(lang)
+	if l == nil {
+		return nil, fmt.Errorf("query: unknown language: %q", lang)
+	} else if l.Prepare != nil {
+		return l.Prepare(query)
+	}
+	var newSession func(graph.QuadStore) Session
+	switch {
+	case l.Session != nil:
+		newSession = l.Session
+	case l.REPL != nil:
+		newSession = func(qs graph.QuadStore) Session { return l.REPL(qs) }
+	case l.HTTP != nil:
+		newSession = func(qs graph.QuadStore) Session { return l.HTTP(qs) }
+	default:
+		return nil, fmt.Errorf("query: language %q cannot execute queries directly", lang)
+	}
+	return sessionQuery{newSession: newSession, query: query}, nil
+}
+
+// sessionQuery is a prepared query for languages without Prepare support.
+type sessionQuery struct {
+	newSession func(graph.QuadStore) Session
+	query      string
+}
+
+func (q sessionQuery) Execute(ctx context.Context, qs graph.QuadStore, params map[string]interface{}, out chan Result, limit int) {
+	if len(params) != 0 {
+		defer close(out)
+		select {
+		case out <- ErrorResult(ErrParamsNotSupported):
+		case <-ctx.Done():
+		}
+		return
+	}
+	q.newSession(qs).Execute(ctx, q.query, out, limit)
+}
@@ -13,11 +13,21 @@
 // limitations under the License.
 
 // Package query defines the graph session interface general to all query languages.
+//
+// Query languages are registered with RegisterLanguage, usually from the init function of a package
+// that implements the language. Languages implemented outside of this repository are enabled in the same way,
+// by importing their package into the binary.
+//
+// Sessions are created by the Language for a single quad store. The HTTP server creates a new session
+// for each request, while the REPL keeps a session for the lifetime of the console, thus sessions may keep
+// state (like variables) between queries, but must not assume that more than one query is executed.
+// Sessions are not used concurrently.
 package query
 
 import (
 	"context"
 	"errors"
+	"fmt"
 	"io"
 
 	"github.com/cayleygraph/cayley/graph"
@@ -50,10 +60,14 @@ type tagMap map[string]graph.Value
 func (m tagMap) Result() interface{} { return map[string]graph.Value(m) }
 func (tagMap) Err() error            { return nil }
 
+// Session executes queries of a single language.
 type Session interface {
 	// Runs the query and returns individual results on the channel.
 	//
 	// Channel will be closed when function returns.
+	//
+	// Execute must stop and return when the context is cancelled. Errors are sent on the channel with ErrorResult,
+	// and no results are sent after an error. Negative limit means that the number of results is not limited.
 	Execute(ctx context.Context, query string, out chan Result, limit int)
 }
 
@@ -61,18 +75,52 @@ type Session interface {
 // TODO(dennwc): specify exact type to return from ShapeOf
 // TODO(dennwc): add context to ShapeOf?
 
+// HTTP is a session that can be used by the HTTP server.
+//
+// The server runs Execute and passes each result to Collate, unless the session implements HTTPStreamer
+// and results are streamed. After the channel is closed, Results is called to get the response.
 type HTTP interface {
 	Session
+	// ShapeOf returns a description of the query plan without executing it.
 	ShapeOf(string) (interface{}, error)
+	// Collate accumulates a single result, including the error result.
 	Collate(Result)
+	// Results returns collated results as a value that will be encoded as JSON, usually a list,
+	// or an error that was collated.
 	Results() (interface{}, error)
 }
 
+// HTTPStreamer is an optional interface for HTTP sessions that can convert results one by one,
+// thus they can be streamed to the client instead of being collated.
+type HTTPStreamer interface {
+	// ConvertResult returns a value of a single result, as it would appear in the list returned by Results.
+	// It returns nil if the result should be skipped.
+	ConvertResult(Result) (interface{}, error)
+}
+
+// REPLSession is a session that can be used in the interactive console.
 type REPLSession interface {
 	Session
+	// FormatREPL returns a human-readable representation of a single result.
 	FormatREPL(Result) string
 }
 
+// REPLCompleter is an optional interface for REPLSession that provides tab-completion in REPL.
+type REPLCompleter interface {
+	// Complete returns all possible completions for a given word.
+	// Word may contain a receiver of a method call, for example "g.V" or ".Ou".
+	Complete(word string) []string
+}
+
+// Writer is an optional interface for sessions that can modify the graph.
+// Sessions are read-only unless a writer is set.
+type Writer interface {
+	// SetWriter sets a writer that is used to apply changes made by queries.
+	SetWriter(qw graph.QuadWriter)
+	// Changed reports whether the last executed query has modified the graph.
+	Changed() bool
+}
+
 // ResponseWriter is a subset of http.ResponseWriter
 type ResponseWriter interface {
 	Write([]byte) (int, error)
@@ -80,22 +128,56 @@ type ResponseWriter interface {
 }
 
 // Language is a description of query language.
+//
+// All functions are optional, but at least one of Session, REPL, HTTP or HTTPQuery must be set.
 type Language struct {
+	// Name of the language, as used in the "lang" parameter of the HTTP API and in the REPL.
 	Name    string
 	Session func(graph.QuadStore) Session
 	REPL    func(graph.QuadStore) REPLSession
 	HTTP    func(graph.QuadStore) HTTP
 
+	// ContentTypes is a list of MIME types of query documents in this language. The HTTP server uses it
+	// to select the language from the Content-Type of the request, if the language is not set explicitly.
+	ContentTypes []string
+
+	// Prepare parses a query, thus it can be executed multiple times without parsing it again. Optional.
+	// See Prepare for the default behavior.
+	Prepare func(query string) (Prepared, error)
+
 	// Custom HTTP handlers
 
+	// HTTPQuery handles the whole HTTP query request, including encoding of results. If set, HTTP is not used.
 	HTTPQuery func(ctx context.Context, qs graph.QuadStore, w ResponseWriter, r io.Reader)
+	// HTTPError writes an error in the format of the language. JSON object with "error" field is written by default.
 	HTTPError func(w ResponseWriter, err error)
 }
 
-var languages = make(map[string]Language)
+var (
+	languages    = make(map[string]Language)
+	contentTypes = make(map[string]string)
+)
 
 // RegisterLanguage register a new query language.
+//
+// It panics if the language has no name or sessions, or if the name or one of content types was
+// already registered by another language.
 func RegisterLanguage(lang Language) {
+	if lang.Name == "" {
+		panic("query language name must not be empty")
+	} else if lang.Session == nil && lang.REPL == nil && lang.HTTP == nil && lang.HTTPQuery == nil {
+		panic(fmt.Sprintf("query language %q has no sessions", lang.Name))
+	} else if _, ok := languages[lang.Name]; ok {
+		panic(fmt.Sprintf("query language %q is already registered", lang.Name))
+	}
+	for _, typ := range lang.ContentTypes {
+		if name, ok := contentTypes[typ]; ok {
+			panic(fmt.Sprintf("content type %q is already registered by %q", typ, name))
+		}
+	}
+	for _, typ := range lang.ContentTypes {
+		contentTypes[typ] = lang.Name
+	}
 	languages[lang.Name] = lang
 }
 
@@ -118,6 +200,16 @@ func GetLanguage(lang string) *Language {
 	return nil
 }
 
+// GetLanguageByType returns a query language for a given MIME type of query documents.
+// It returns nil if no language was registered for this type.
+func GetLanguageByType(typ string) *Language {
+	name, ok := contentTypes[typ]
+	if !ok {
+		return nil
+	}
+	return GetLanguage(name)
+}
+
 // Languages returns names of registered query languages.
 func Languages() []string {
 	out := make([]string, 0, len(languages))
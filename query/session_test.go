@@ -0,0 +1,77 @@
+package query_test
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/cayleygraph/cayley/graph"
+	"github.com/cayleygraph/cayley/query"
+)
+
+func panics(f func()) (ok bool) {
+	defer func() {
+		ok = recover() != nil
+	}()
+	f()
+	return false
+}
+
+func TestRegisterLanguage(t *testing.T) {
+	newSession := func(qs graph.QuadStore) query.Session { return nil }
+	query.RegisterLanguage(query.Language{
+		Name:         "test_lang",
+		Session:      newSession,
+		ContentTypes: []string{"text/x-test-lang"},
+	})
+	l := query.GetLanguageByType("text/x-test-lang")
+	require.NotNil(t, l)
+	require.Equal(t, "test_lang", l.Name)
+	require.Nil(t, query.GetLanguageByType("text/plain"))
+	require.Contains(t, query.Languages(), "test_lang")
+
+	for _, lang := range []query.Language{
+		{Session: newSession},
+		{Name: "test_no_sessions"},
+		{Name: "test_lang", Session: newSession},
+		{Name: "test_lang2", Session: newSession, ContentTypes: []string{"text/x-test-lang"}},
+	} {
+		require.True(t, panics(func() { query.RegisterLanguage(lang) }), "%+v", lang)
+	}
+	require.Nil(t, query.GetLanguage("test_lang2"))
+}
+
+type echoResult string
+
+func (r echoResult) Result() interface{} { return string(r) }
+func (echoResult) Err() error            { return nil }
+
+type echoSession struct{}
+
+func (echoSession) Execute(ctx context.Context, qu string, out chan query.Result, limit int) {
+	defer close(out)
+	out <- echoResult(qu)
+}
+
+func TestPrepareDefault(t *testing.T) {
+	query.RegisterLanguage(query.Language{
+		Name:    "test_prepare",
+		Session: func(qs graph.QuadStore) query.Session { return echoSession{} },
+	})
+	_, err := query.Prepare("test_unknown", "")
+	require.Error(t, err)
+
+	p, err := query.Prepare("test_prepare", "q")
+	require.NoError(t, err)
+	for i := 0; i < 2; i++ {
+		out := make(chan query.Result, 1)
+		p.Execute(context.TODO(), nil, nil, out, -1)
+		res := <-out
+		require.NoError(t, res.Err())
+		require.Equal(t, "q", res.Result())
+	}
+	out := make(chan query.Result, 1)
+	p.Execute(context.TODO(), nil, map[string]interface{}{"a": 1}, out, -1)
+	require.Equal(t, query.ErrParamsNotSupported, (<-out).Err())
+}
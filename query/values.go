@@ -0,0 +1,90 @@
+package query
+
+import (
+	"context"
+
+	"github.com/cayleygraph/cayley/quad"
+)
+
+type typedValuesKey struct{}
+
+// WithTypedValues returns a context that instructs query languages to encode values in results with
+// explicit type information (see TypedValue) instead of converting them to native JSON values.
+func WithTypedValues(ctx context.Context) context.Context {
+	return context.WithValue(ctx, typedValuesKey{}, true)
+}
+
+// TypedValues checks if values in query results should be typed. See WithTypedValues.
+func TypedValues(ctx context.Context) bool {
+	v, _ := ctx.Value(typedValuesKey{}).(bool)
+	return v
+}
+
+// TypedValue converts a value to a JSON-compatible representation that preserves its type.
+// Values are encoded as JSON-LD value objects:
+//
+//	"name"                                                  // String
+//	{"@id": "http://example.com/alice"}                     // IRI and BNode ("_:" prefix)
+//	{"@value": "name", "@language": "en"}                   // LangString
+//	{"@value": 42, "@type": "http://schema.org/Integer"}    // Int, Float and Bool
+//	{"@value": "2017-01-02T03:04:05Z", "@type": "http://schema.org/DateTime"}
+//
+// All other typed values have a string "@value" and an IRI of the type.
+func TypedValue(v quad.Value) interface{} {
+	switch v := v.(type) {
+	case nil:
+		return nil
+	case quad.String:
+		return string(v)
+	case quad.IRI:
+		return map[string]interface{}{"@id": string(v)}
+	case quad.BNode:
+		return map[string]interface{}{"@id": v.String()}
+	case quad.LangString:
+		return map[string]interface{}{"@value": string(v.Value), "@language": v.Lang}
+	case quad.TypedString:
+		return map[string]interface{}{"@value": string(v.Value), "@type": string(v.Type)}
+	case quad.TypedStringer:
+		ts := v.TypedString()
+		var val interface{} = string(ts.Value)
+		switch nv := v.(quad.Value).Native().(type) {
+		case int, int64, float64, bool:
+			val = nv
+		}
+		return map[string]interface{}{"@value": val, "@type": string(ts.Type)}
+	}
+	return quad.StringOf(v)
+}
+
+// TypedResult replaces all quad values in the query result with their typed representation. See TypedValue.
+func TypedResult(v interface{}) interface{} {
+	switch v := v.(type) {
+	case quad.Value:
+		return TypedValue(v)
+	case []quad.Value:
+		out := make([]interface{}, 0, len(v))
+		for _, qv := range v {
+			out = append(out, TypedValue(qv))
+		}
+		return out
+	case []interface{}:
+		out := make([]interface{}, 0, len(v))
+		for _, e := range v {
+			out = append(out, TypedResult(e))
+		}
+		return out
+	case []map[string]interface{}:
+		out := make([]map[string]interface{}, 0, len(v))
+		for _, e := range v {
+			out = append(out, TypedResult(e).(map[string]interface{}))
+		}
+		return out
+	case map[string]interface{}:
+		out := make(map[string]interface{}, len(v))
+		for k, e := range v {
+			out[k] = TypedResult(e)
+		}
+		return out
+	}
+	return v
+}
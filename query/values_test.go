@@ -0,0 +1,45 @@
+package query_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/cayleygraph/cayley/quad"
+	"github.com/cayleygraph/cayley/query"
+	"github.com/cayleygraph/cayley/voc/schema"
+)
+
+var typedValueCases = []struct {
+	val    quad.Value
+	expect interface{}
+}{
+	{quad.String("bob"), "bob"},
+	{quad.IRI("http://example.org/bob"), map[string]interface{}{"@id": "http://example.org/bob"}},
+	{quad.BNode("b1"), map[string]interface{}{"@id": "_:b1"}},
+	{quad.LangString{Value: "Bob", Lang: "en"}, map[string]interface{}{"@value": "Bob", "@language": "en"}},
+	{quad.TypedString{Value: "x", Type: "http://example.org/type"}, map[string]interface{}{"@value": "x", "@type": "http://example.org/type"}},
+	{quad.Int(42), map[string]interface{}{"@value": 42, "@type": schema.Integer}},
+	{quad.Bool(true), map[string]interface{}{"@value": true, "@type": schema.Boolean}},
+	{quad.Time(time.Date(2017, 1, 2, 3, 4, 5, 0, time.UTC)), map[string]interface{}{"@value": "2017-01-02T03:04:05Z", "@type": schema.DateTime}},
+}
+
+func TestTypedValue(t *testing.T) {
+	for _, c := range typedValueCases {
+		require.Equal(t, c.expect, query.TypedValue(c.val), "%#v", c.val)
+	}
+}
+
+func TestTypedResult(t *testing.T) {
+	in := map[string]interface{}{
+		"id":    quad.IRI("alice"),
+		"age":   []quad.Value{quad.Int(30)},
+		"other": []interface{}{"text", 1},
+	}
+	require.Equal(t, map[string]interface{}{
+		"id":    map[string]interface{}{"@id": "alice"},
+		"age":   []interface{}{map[string]interface{}{"@value": 30, "@type": schema.Integer}},
+		"other": []interface{}{"text", 1},
+	}, query.TypedResult(in))
+}
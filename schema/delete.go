@@ -0,0 +1,221 @@
+package schema
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+
+	"github.com/cayleygraph/cayley/graph"
+	"github.com/cayleygraph/cayley/quad"
+)
+
+// CascadeMode controls which sub-objects are removed together with an object.
+type CascadeMode int
+
+const (
+	// CascadeOwned removes sub-objects that are not referenced by anything except objects being removed.
+	CascadeOwned CascadeMode = iota
+	// CascadeBlankNodes is the same as CascadeOwned, but only removes sub-objects identified by blank nodes.
+	CascadeBlankNodes
+	// CascadeNone removes only the object itself and keeps all sub-objects.
+	CascadeNone
+)
+
+// DeleteOptions controls which quads are removed by DeleteWithOptions.
+type DeleteOptions struct {
+	// Cascade sets the rules for removing sub-objects. Default is CascadeOwned.
+	Cascade CascadeMode
+}
+
+// Delete removes an object from the graph. See DeleteWithOptions for details.
+//
+// Sub-objects referenced only by this object are removed as well, while shared ones are kept.
+func Delete(ctx context.Context, qw graph.QuadWriter, qs graph.QuadStore, obj interface{}) error {
+	return DeleteWithOptions(ctx, qw, qs, obj, DeleteOptions{})
+}
+
+// DeleteWithOptions removes an object from the graph, optionally removing its sub-objects.
+//
+// Only the ID of the object is used; all quads matching the fields of its type are
+// found in the quad store and removed in a single transaction. Quads that are not
+// described by the type, as well as links to the object from other nodes, are kept.
+//
+// Sub-objects are nodes referenced by struct fields. They are removed according to
+// the cascade mode, using the rules of the field's type. Values of other fields and
+// nodes referenced by reverse links are never removed.
+func DeleteWithOptions(ctx context.Context, qw graph.QuadWriter, qs graph.QuadStore, obj interface{}, opts DeleteOptions) error {
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	rv := reflect.ValueOf(obj)
+	if rv.Kind() == reflect.Ptr {
+		rv = rv.Elem()
+	}
+	if rv.Kind() != reflect.Struct {
+		return fmt.Errorf("expected a struct, got %T", obj)
+	}
+	rt := rv.Type()
+	id, err := objectID(rt, rv)
+	if err != nil {
+		return err
+	}
+	ref := qs.ValueOf(id)
+	if ref == nil {
+		return nil
+	}
+	d := &deleter{
+		ctx:     ctx,
+		qs:      qs,
+		mode:    opts.Cascade,
+		tx:      graph.NewTransaction(),
+		removed: make(map[interface{}]struct{}),
+		deleted: make(map[interface{}]struct{}),
+	}
+	if err = d.deleteObject(ref, rt); err != nil {
+		return err
+	}
+	if len(d.tx.Deltas) == 0 {
+		return nil
+	}
+	return qw.ApplyTransaction(d.tx)
+}
+
+type deleter struct {
+	ctx  context.Context
+	qs   graph.QuadStore
+	mode CascadeMode
+	tx   *graph.Transaction
+
+	removed map[interface{}]struct{} // quads removed by the transaction
+	deleted map[interface{}]struct{} // nodes removed by the transaction
+}
+
+func (d *deleter) deleteObject(ref graph.Value, rt reflect.Type) error {
+	key := graph.ToKey(ref)
+	if _, ok := d.deleted[key]; ok {
+		return nil
+	}
+	d.deleted[key] = struct{}{}
+	rules, err := rulesFor(rt)
+	if err != nil {
+		return fmt.Errorf("can't load rules: %v", err)
+	}
+	typesMu.RLock()
+	iri := typeToIRI[rt]
+	typesMu.RUnlock()
+	if iri != quad.IRI("") {
+		if _, err = d.removeLinks(ref, iriType, false, iri); err != nil {
+			return err
+		}
+	}
+	return d.deleteFields(ref, rt, rules, "")
+}
+
+func (d *deleter) deleteFields(ref graph.Value, rt reflect.Type, rules fieldRules, pref string) error {
+	for i := 0; i < rt.NumField(); i++ {
+		f := rt.Field(i)
+		if f.Anonymous {
+			if ft, ok := anonFieldType(f); ok {
+				if err := d.deleteFields(ref, ft, rules, pref+f.Name+"."); err != nil {
+					return err
+				}
+			}
+			continue
+		}
+		switch r := rules[pref+f.Name].(type) {
+		case constraintRule:
+			if _, err := d.removeLinks(ref, r.Pred, r.Rev, r.Val); err != nil {
+				return err
+			}
+		case saveRule:
+			nodes, err := d.removeLinks(ref, r.Pred, r.Rev, nil)
+			if err != nil {
+				return err
+			}
+			et, ok := subObjectType(f.Type)
+			if r.Rev || !ok || d.mode == CascadeNone {
+				continue
+			}
+			for _, n := range nodes {
+				if ok, err := d.owned(n); err != nil {
+					return err
+				} else if !ok {
+					continue
+				}
+				if err := d.deleteObject(n, et); err != nil {
+					return err
+				}
+			}
+		}
+	}
+	return nil
+}
+
+// removeLinks removes all quads with a given predicate that link a node to other nodes.
+// If val is set, only links to this value are removed. It returns nodes on the other side of removed links.
+func (d *deleter) removeLinks(ref graph.Value, pred quad.IRI, rev bool, val quad.Value) ([]graph.Value, error) {
+	pref := d.qs.ValueOf(pred)
+	if pref == nil {
+		return nil, nil
+	}
+	var vref graph.Value
+	if val != nil {
+		if vref = d.qs.ValueOf(val); vref == nil {
+			return nil, nil
+		}
+	}
+	dir, other := quad.Subject, quad.Object
+	if rev {
+		dir, other = other, dir
+	}
+	var nodes []graph.Value
+	it := d.qs.QuadIterator(dir, ref)
+	defer it.Close()
+	for it.Next(d.ctx) {
+		qr := it.Result()
+		if !keysEqual(d.qs.QuadDirection(qr, quad.Predicate), pref) {
+			continue
+		}
+		n := d.qs.QuadDirection(qr, other)
+		if vref != nil && !keysEqual(n, vref) {
+			continue
+		}
+		key := graph.ToKey(qr)
+		if _, ok := d.removed[key]; ok {
+			continue
+		}
+		d.removed[key] = struct{}{}
+		d.tx.RemoveQuad(d.qs.Quad(qr))
+		nodes = append(nodes, n)
+	}
+	return nodes, it.Err()
+}
+
+// owned checks if a node is referenced only by quads that are already removed.
+func (d *deleter) owned(ref graph.Value) (bool, error) {
+	if d.mode == CascadeBlankNodes {
+		if _, ok := d.qs.NameOf(ref).(quad.BNode); !ok {
+			return false, nil
+		}
+	}
+	it := d.qs.QuadIterator(quad.Object, ref)
+	defer it.Close()
+	for it.Next(d.ctx) {
+		if _, ok := d.removed[graph.ToKey(it.Result())]; !ok {
+			return false, it.Err()
+		}
+	}
+	return true, it.Err()
+}
+
+// subObjectType returns a struct type of objects referenced by a field of a given type.
+func subObjectType(ft reflect.Type) (reflect.Type, bool) {
+	for ft.Kind() == reflect.Ptr || ft.Kind() == reflect.Slice {
+		ft = ft.Elem()
+	}
+	if ft.Kind() != reflect.Struct || isNative(ft) ||
+		ft.Implements(reflQuadMarshaler) || reflect.PtrTo(ft).Implements(reflQuadMarshaler) {
+		return nil, false
+	}
+	return ft, true
+}
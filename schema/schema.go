@@ -9,8 +9,10 @@ import (
 	"errors"
 	"fmt"
 	"reflect"
+	"sort"
 	"strings"
 	"sync"
+	"time"
 
 	"github.com/cayleygraph/cayley/graph"
 	"github.com/cayleygraph/cayley/graph/iterator"
@@ -28,6 +30,38 @@ func (e ErrReqFieldNotSet) Error() string {
 	return fmt.Sprintf("required field is not set: %s", e.Field)
 }
 
+// QuadMarshaler is implemented by types that can convert themselves to a quad value.
+//
+// Types implementing it are written as a single value, regardless of their kind and struct tags.
+// It can be implemented for the type of any field, including the "@id" field.
+type QuadMarshaler interface {
+	MarshalQuad() (quad.Value, error)
+}
+
+// QuadUnmarshaler is implemented by types that can load themselves from a quad value.
+// It is usually implemented with a pointer receiver.
+type QuadUnmarshaler interface {
+	UnmarshalQuad(v quad.Value) error
+}
+
+var (
+	reflQuadMarshaler   = reflect.TypeOf((*QuadMarshaler)(nil)).Elem()
+	reflQuadUnmarshaler = reflect.TypeOf((*QuadUnmarshaler)(nil)).Elem()
+)
+
+// marshalQuad converts a value to quad.Value if it implements QuadMarshaler.
+// It returns false if value does not implement the interface.
+func marshalQuad(rv reflect.Value) (quad.Value, bool, error) {
+	if rv.Kind() != reflect.Ptr && rv.CanAddr() && rv.Addr().Type().Implements(reflQuadMarshaler) {
+		rv = rv.Addr()
+	}
+	if !rv.Type().Implements(reflQuadMarshaler) {
+		return nil, false, nil
+	}
+	v, err := rv.Interface().(QuadMarshaler).MarshalQuad()
+	return v, true, err
+}
+
 type rule interface {
 	isRule()
 }
@@ -41,9 +75,11 @@ type constraintRule struct {
 func (constraintRule) isRule() {}
 
 type saveRule struct {
-	Pred quad.IRI
-	Rev  bool
-	Opt  bool
+	Pred    quad.IRI
+	Rev     bool
+	Opt     bool
+	Langs   []string // preferred languages of string values
+	Version bool     // field stores a version of the object; see Update
 }
 
 func (saveRule) isRule() {}
@@ -52,7 +88,10 @@ type idRule struct{}
 
 func (idRule) isRule() {}
 
-const iriType = quad.IRI(rdf.Type)
+const (
+	iriType    = quad.IRI(rdf.Type)
+	iriVersion = quad.IRI("cayley:version")
+)
 
 func toIRI(s string) quad.IRI {
 	if s == "@type" {
@@ -72,6 +111,7 @@ func fieldRule(fld reflect.StructField) (rule, error) {
 		spo, ops  = `>`, `<`
 		any, none = `*`, `-`
 		this      = `@id`
+		version   = `@version`
 	)
 	tag = strings.Trim(tag, trim)
 	jsn := false
@@ -85,9 +125,18 @@ func fieldRule(fld reflect.StructField) (rule, error) {
 	rule := strings.Trim(tag, trim)
 	if rule == this {
 		return idRule{}, nil
+	} else if rule == version {
+		switch fld.Type.Kind() {
+		case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+			reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		default:
+			return nil, fmt.Errorf("version field must be an integer, got %v", fld.Type)
+		}
+		return saveRule{Pred: iriVersion, Opt: true, Version: true}, nil
 	}
 	opt := false
 	req := false
+	var langs []string
 	for _, s := range sub {
 		if s == "opt" || s == "optional" {
 			opt = true
@@ -95,6 +144,9 @@ func fieldRule(fld reflect.StructField) (rule, error) {
 		if s == "req" || s == "required" {
 			req = true
 		}
+		if strings.HasPrefix(s, "lang=") {
+			langs = append(langs, strings.TrimPrefix(s, "lang="))
+		}
 	}
 	if req {
 		opt = false
@@ -130,8 +182,11 @@ func fieldRule(fld reflect.StructField) (rule, error) {
 		return nil, fmt.Errorf("wrong quad format: '%s': no predicate", rule)
 	}
 	p := toIRI(ps)
+	if len(langs) != 0 && rev {
+		return nil, fmt.Errorf("wrong quad tag format: '%s': languages are not supported for reverse links", rule)
+	}
 	if vs == "" || vs == any && fld.Type != reflEmptyStruct {
-		return saveRule{Pred: p, Rev: rev, Opt: opt}, nil
+		return saveRule{Pred: p, Rev: rev, Opt: opt, Langs: langs}, nil
 	} else {
 		return constraintRule{Pred: p, Val: toIRI(vs), Rev: rev}, nil
 	}
@@ -166,8 +221,8 @@ func iteratorFromPath(qs graph.QuadStore, root graph.Iterator, p *path.Path) (gr
 	return it, nil
 }
 
-func iteratorForType(qs graph.QuadStore, root graph.Iterator, rt reflect.Type, rootOnly bool) (graph.Iterator, error) {
-	p, err := makePathForType(rt, "", rootOnly)
+func iteratorForType(qs graph.QuadStore, root graph.Iterator, rt reflect.Type, rootOnly bool, proj projection) (graph.Iterator, error) {
+	p, err := makePathForType(rt, "", rootOnly, proj)
 	if err != nil {
 		return nil, err
 	}
@@ -218,14 +273,15 @@ func RegisterType(iri quad.IRI, obj interface{}) {
 	iriToType[full] = rt
 }
 
-func makePathForType(rt reflect.Type, tagPref string, rootOnly bool) (*path.Path, error) {
+func makePathForType(rt reflect.Type, tagPref string, rootOnly bool, proj projection) (*path.Path, error) {
 	for rt.Kind() == reflect.Ptr {
 		rt = rt.Elem()
 	}
 	if rt.Kind() != reflect.Struct {
 		return nil, fmt.Errorf("expected struct, got %v", rt)
 	}
-	if tagPref != "" {
+	cache := tagPref != "" && proj.all()
+	if cache {
 		pathForTypeMu.RLock()
 		m := pathForType
 		if rootOnly {
@@ -248,7 +304,8 @@ func makePathForType(rt reflect.Type, tagPref string, rootOnly bool) (*path.Path
 	for i := 0; i < rt.NumField(); i++ {
 		f := rt.Field(i)
 		if f.Anonymous {
-			pa, err := makePathForType(f.Type, tagPref+f.Name+".", rootOnly)
+			// fields of embedded structs are selected by their own names
+			pa, err := makePathForType(f.Type, tagPref+f.Name+".", rootOnly, proj)
 			if err != nil {
 				return nil, err
 			}
@@ -284,7 +341,22 @@ func makePathForType(rt reflect.Type, tagPref string, rootOnly bool) (*path.Path
 			}
 		case saveRule:
 			tag := tagPref + name
-			if rule.Opt {
+			if !proj.selected(name) {
+				// field is not loaded, but it's still required to match the type
+				if !rule.Opt {
+					if rule.Rev {
+						p = p.HasReverse(rule.Pred)
+					} else {
+						p = p.Has(rule.Pred)
+					}
+				}
+			} else if len(rule.Langs) != 0 && !rootOnly {
+				if rule.Opt {
+					p = p.SaveOptionalLang(rule.Pred, tag, rule.Langs...)
+				} else {
+					p = p.SaveLang(rule.Pred, tag, rule.Langs...)
+				}
+			} else if rule.Opt {
 				if !rootOnly {
 					if rule.Rev {
 						p = p.SaveOptionalReverse(rule.Pred, tag)
@@ -307,7 +379,7 @@ func makePathForType(rt reflect.Type, tagPref string, rootOnly bool) (*path.Path
 			}
 		}
 	}
-	if tagPref != "" {
+	if cache {
 		pathForTypeMu.Lock()
 		m := pathForType
 		if rootOnly {
@@ -321,7 +393,7 @@ func makePathForType(rt reflect.Type, tagPref string, rootOnly bool) (*path.Path
 
 // PathForType builds a path (morphism) for a given Go type.
 func PathForType(rt reflect.Type) (*path.Path, error) {
-	return makePathForType(rt, "", false)
+	return makePathForType(rt, "", false, projection{})
 }
 
 func anonFieldType(fld reflect.StructField) (reflect.Type, bool) {
@@ -446,7 +518,7 @@ var (
 	errRequiredFieldIsMissing = errors.New("required field is missing")
 )
 
-func loadToValue(ctx context.Context, qs graph.QuadStore, dst reflect.Value, depth int, m map[string][]graph.Value, tagPref string) error {
+func loadToValue(ctx context.Context, qs graph.QuadStore, dst reflect.Value, depth int, proj projection, m map[string][]graph.Value, tagPref string) error {
 	if ctx == nil {
 		ctx = context.TODO()
 	}
@@ -469,7 +541,7 @@ func loadToValue(ctx context.Context, qs graph.QuadStore, dst reflect.Value, dep
 	}
 	if depth != 0 { // do not check required fields if depth limit is reached
 		for name, field := range fields {
-			if r, ok := field.(saveRule); ok && !r.Opt {
+			if r, ok := field.(saveRule); ok && !r.Opt && proj.selected(fieldName(name)) {
 				if vals := m[name]; len(vals) == 0 {
 					return errRequiredFieldIsMissing
 				}
@@ -489,7 +561,7 @@ func loadToValue(ctx context.Context, qs graph.QuadStore, dst reflect.Value, dep
 		}
 		df := dst.Field(i)
 		if f.Anonymous {
-			if err := loadToValue(ctx, qs, df, depth, m, tagPref+name+"."); err != nil {
+			if err := loadToValue(ctx, qs, df, depth, proj, m, tagPref+name+"."); err != nil {
 				return fmt.Errorf("load anonymous field %s failed: %v", f.Name, err)
 			}
 			continue
@@ -497,6 +569,8 @@ func loadToValue(ctx context.Context, qs graph.QuadStore, dst reflect.Value, dep
 		rules := fields[tagPref+name]
 		if rules == nil {
 			continue
+		} else if _, ok := rules.(idRule); !ok && !proj.selected(name) {
+			continue
 		}
 		arr, ok := m[tagPref+name]
 		if !ok || len(arr) == 0 {
@@ -508,25 +582,51 @@ func loadToValue(ctx context.Context, qs graph.QuadStore, dst reflect.Value, dep
 			native = native || isNative(ft)
 			ft = ft.Elem()
 		}
-		recursive := !native && ft.Kind() == reflect.Struct
-		for _, fv := range arr {
+		unmarshal := reflect.PtrTo(ft).Implements(reflQuadUnmarshaler)
+		recursive := !native && !unmarshal && ft.Kind() == reflect.Struct
+		// language-tagged strings can be loaded to string fields directly
+		unwrapLang := false
+		if r, ok := rules.(saveRule); ok && len(r.Langs) != 0 {
+			unwrapLang = ft.Kind() == reflect.String
+		}
+		var names []quad.Value
+		if !recursive {
+			// resolve all values of the field in one batch
+			var err error
+			names, err = graph.NamesOf(ctx, qs, arr)
+			if err != nil {
+				return err
+			}
+		}
+		for i, fv := range arr {
 			var sv reflect.Value
 			if recursive {
 				sv = reflect.New(ft).Elem()
 				sit := iterator.NewFixed()
 				sit.Add(fv)
-				err := loadIteratorToDepth(ctx, qs, sv, depth-1, sit)
+				err := loadIteratorToDepth(ctx, qs, sv, depth-1, proj.sub(name), 0, 0, sit)
 				if err == errRequiredFieldIsMissing {
 					continue
 				} else if err != nil {
 					return err
 				}
 			} else {
-				fv := qs.NameOf(fv)
+				fv := names[i]
 				if fv == nil {
 					continue
 				}
-				sv = reflect.ValueOf(fv)
+				if ls, ok := fv.(quad.LangString); ok && unwrapLang {
+					fv = ls.Value
+				}
+				if unmarshal {
+					pv := reflect.New(ft)
+					if err := pv.Interface().(QuadUnmarshaler).UnmarshalQuad(fv); err != nil {
+						return fmt.Errorf("field %s: %v", f.Name, err)
+					}
+					sv = pv.Elem()
+				} else {
+					sv = reflect.ValueOf(fv)
+				}
 			}
 			if err := DefaultConverter.SetValue(df, sv); err != nil {
 				return fmt.Errorf("field %s: %v", f.Name, err)
@@ -619,6 +719,40 @@ func keysEqual(v1, v2 graph.Value) bool {
 //		ThirdName string `quad:"thirdName,optional"` // can be empty
 //		FollowedBy []quad.IRI `quad:"follows"`
 // 	}
+//
+// String fields can be bound to languages with one or more "lang" options, listed in the order of preference.
+// Only values in the most preferred language available are loaded, and an empty language stands for
+// strings without a language tag. Values are written in the first language.
+//
+//	type Page struct{
+//		ID quad.IRI `json:"@id"`
+//		Title string `quad:"rdfs:label,lang=en,lang=de,lang="` // English, German or untagged title
+// 	}
+//
+// Types can control their own representation by implementing QuadMarshaler and QuadUnmarshaler:
+//
+//	type Money struct{ Cents int64 }
+//	func (m Money) MarshalQuad() (quad.Value, error) {
+//		return quad.TypedString{Value: quad.String(strconv.FormatInt(m.Cents, 10)), Type: "ex:cents"}, nil
+//	}
+//	func (m *Money) UnmarshalQuad(v quad.Value) error { ... }
+//
+//	type Order struct{
+//		ID quad.IRI `json:"@id"`
+//		Total Money `json:"ex:total"` // written as a single value instead of a sub-object
+// 	}
+//
+// An integer field with an "@version" tag stores a version of the object (as "cayley:version" predicate).
+// It is optional when loading, and is checked and incremented by Update to detect concurrent changes.
+//
+//	type Account struct{
+//		ID quad.IRI `json:"@id"`
+//		Version int `quad:"@version"`
+//		Balance int `quad:"balance"`
+// 	}
+//
+// Objects referencing each other are loaded recursively. See LoadToWithOptions to limit
+// the depth of recursion and to select fields to load.
 func LoadTo(ctx context.Context, qs graph.QuadStore, dst interface{}, ids ...quad.Value) error {
 	return LoadToDepth(ctx, qs, dst, -1, ids...)
 }
@@ -626,14 +760,48 @@ func LoadTo(ctx context.Context, qs graph.QuadStore, dst interface{}, ids ...qua
 // LoadToDepth is the same as LoadTo, but stops at a specified depth.
 // Negative value means unlimited depth, and zero means top level only.
 func LoadToDepth(ctx context.Context, qs graph.QuadStore, dst interface{}, depth int, ids ...quad.Value) error {
+	return LoadToWithOptions(ctx, qs, dst, LoadOptions{Depth: depth}, ids...)
+}
+
+// LoadOptions controls which parts of objects are loaded.
+type LoadOptions struct {
+	// Depth limits the depth of nested objects. Negative value means unlimited depth, and zero means top level only.
+	Depth int
+	// Fields is a list of Go field names to load. Fields of nested objects are selected with dot-separated
+	// names, for example "Friends.Name" loads only names of friends. Empty list means all fields.
+	// ID fields are always loaded.
+	Fields []string
+	// Skip is a list of fields that are not loaded, in the same format as Fields.
+	Skip []string
+
+	// Offset and Limit select a page of objects when loading to a slice or a channel.
+	// Zero limit means no limit.
+	Offset, Limit int
+	// OrderBy is a Go field name to sort objects by; it can be prefixed with "-" for descending order.
+	// Numbers and times are compared by value, and other values by their string representation.
+	// Objects without a value for the field are sent last.
+	//
+	// Without ordering, objects are loaded in the order of the quad store, and Offset and Limit count
+	// objects matching the type, not loaded objects.
+	OrderBy string
+}
+
+// LoadToWithOptions is the same as LoadTo, but allows to limit the depth and select fields to load.
+//
+// Fields that are not loaded are still required to be present, unless they are optional.
+func LoadToWithOptions(ctx context.Context, qs graph.QuadStore, dst interface{}, opts LoadOptions, ids ...quad.Value) error {
 	if dst == nil {
 		return fmt.Errorf("nil destination object")
 	}
 	var it graph.Iterator
 	if len(ids) != 0 {
+		refs, err := graph.RefsOf(ctx, qs, ids)
+		if err != nil {
+			return err
+		}
 		fixed := iterator.NewFixed()
-		for _, id := range ids {
-			fixed.Add(qs.ValueOf(id))
+		for _, ref := range refs {
+			fixed.Add(ref)
 		}
 		it = fixed
 	}
@@ -643,7 +811,7 @@ func LoadToDepth(ctx context.Context, qs graph.QuadStore, dst interface{}, depth
 	} else {
 		rv = reflect.ValueOf(dst)
 	}
-	return LoadIteratorToDepth(ctx, qs, rv, depth, it)
+	return LoadIteratorToWithOptions(ctx, qs, rv, opts, it)
 }
 
 // LoadPathTo is the same as LoadTo, but starts loading objects from a given path.
@@ -664,14 +832,263 @@ func LoadIteratorTo(ctx context.Context, qs graph.QuadStore, dst reflect.Value,
 // LoadIteratorToDepth is the same as LoadIteratorTo, but stops at a specified depth.
 // Negative value means unlimited depth, and zero means top level only.
 func LoadIteratorToDepth(ctx context.Context, qs graph.QuadStore, dst reflect.Value, depth int, list graph.Iterator) error {
+	return LoadIteratorToWithOptions(ctx, qs, dst, LoadOptions{Depth: depth}, list)
+}
+
+// LoadIteratorToWithOptions is the same as LoadIteratorTo, but allows to limit the depth and select fields to load.
+func LoadIteratorToWithOptions(ctx context.Context, qs graph.QuadStore, dst reflect.Value, opts LoadOptions, list graph.Iterator) error {
+	depth := opts.Depth
 	if depth >= 0 {
 		// 0 depth means "current level only" for user, but it's easier to make depth=0 a stop condition
 		depth++
 	}
-	return loadIteratorToDepth(ctx, qs, dst, depth, list)
+	proj := projection{only: opts.Fields, skip: opts.Skip}
+	if opts.OrderBy != "" {
+		return loadOrdered(ctx, qs, dst, depth, proj, opts, list)
+	}
+	return loadIteratorToDepth(ctx, qs, dst, depth, proj, opts.Offset, opts.Limit, list)
+}
+
+// LoadChan is the same as LoadToWithOptions, but requires the destination to be a channel of structs.
+//
+// Objects are sent to the channel as soon as they are loaded, and the channel is closed when
+// all objects are sent. Sending is interrupted if the context is canceled.
+func LoadChan(ctx context.Context, qs graph.QuadStore, ch interface{}, opts LoadOptions, ids ...quad.Value) error {
+	rv := reflect.ValueOf(ch)
+	if rv.Kind() != reflect.Chan || rv.Type().ChanDir()&reflect.SendDir == 0 {
+		return fmt.Errorf("expected a channel, got %T", ch)
+	}
+	return LoadToWithOptions(ctx, qs, rv, opts, ids...)
+}
+
+// sendValue sends a value to a channel, unless the context is canceled.
+func sendValue(ctx context.Context, ch, v reflect.Value) error {
+	i, _, _ := reflect.Select([]reflect.SelectCase{
+		{Dir: reflect.SelectSend, Chan: ch, Send: v},
+		{Dir: reflect.SelectRecv, Chan: reflect.ValueOf(ctx.Done())},
+	})
+	if i != 0 {
+		return ctx.Err()
+	}
+	return nil
+}
+
+// loadOrdered loads objects sorted by a field value.
+//
+// It finds all matching objects and their sort keys first, and loads objects of the requested page one by one.
+func loadOrdered(ctx context.Context, qs graph.QuadStore, dst reflect.Value, depth int, proj projection, opts LoadOptions, list graph.Iterator) error {
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	if dst.Kind() == reflect.Ptr {
+		dst = dst.Elem()
+	}
+	chanl := dst.Kind() == reflect.Chan
+	if chanl {
+		defer dst.Close()
+	} else if dst.Kind() != reflect.Slice {
+		return fmt.Errorf("ordering requires a slice or a channel, got %v", dst.Type())
+	}
+	et := dst.Type().Elem()
+	fields, err := rulesFor(et)
+	if err != nil {
+		return err
+	}
+	name := strings.TrimPrefix(opts.OrderBy, "-")
+	desc := name != opts.OrderBy
+	var (
+		order saveRule
+		found bool
+	)
+	for key, r := range fields {
+		if r, ok := r.(saveRule); ok && fieldName(key) == name {
+			order, found = r, true
+			break
+		}
+	}
+	if !found {
+		return fmt.Errorf("cannot order by field %q", name)
+	}
+	// constraints of the type with an additional tag for the sort key
+	p, err := makePathForType(et, "", true, projection{})
+	if err != nil {
+		return err
+	}
+	const orderTag = "__order"
+	if order.Rev {
+		p = p.SaveOptionalReverse(order.Pred, orderTag)
+	} else {
+		p = p.SaveOptional(order.Pred, orderTag)
+	}
+	it, err := iteratorFromPath(qs, list, p)
+	if err != nil {
+		return err
+	}
+	var refs, keys []graph.Value
+	for it.Next(ctx) {
+		mp := make(map[string]graph.Value)
+		it.TagResults(mp)
+		refs = append(refs, it.Result())
+		keys = append(keys, mp[orderTag])
+	}
+	err = it.Err()
+	it.Close()
+	if err != nil {
+		return err
+	}
+	names, err := graph.NamesOf(ctx, qs, keys)
+	if err != nil {
+		return err
+	}
+	inds := make([]int, len(refs))
+	for i := range inds {
+		inds[i] = i
+	}
+	sort.SliceStable(inds, func(i, j int) bool {
+		a, b := names[inds[i]], names[inds[j]]
+		if a == nil || b == nil {
+			// objects without a sort key are always last
+			return a != nil
+		}
+		if desc {
+			return lessValues(b, a)
+		}
+		return lessValues(a, b)
+	})
+	if opts.Offset >= len(inds) {
+		inds = nil
+	} else if opts.Offset > 0 {
+		inds = inds[opts.Offset:]
+	}
+	if opts.Limit > 0 && opts.Limit < len(inds) {
+		inds = inds[:opts.Limit]
+	}
+	for _, i := range inds {
+		cur := reflect.New(et)
+		fixed := iterator.NewFixed()
+		fixed.Add(refs[i])
+		err := loadIteratorToDepth(ctx, qs, cur, depth, proj, 0, 0, fixed)
+		if IsNotFound(err) {
+			continue
+		} else if err != nil {
+			return err
+		}
+		if chanl {
+			if err := sendValue(ctx, dst, cur.Elem()); err != nil {
+				return err
+			}
+		} else {
+			dst.Set(reflect.Append(dst, cur.Elem()))
+		}
+	}
+	return nil
+}
+
+// lessValues compares values of the same type in their natural order, and other values by their string representation.
+func lessValues(a, b quad.Value) bool {
+	switch a := a.(type) {
+	case quad.Int:
+		switch b := b.(type) {
+		case quad.Int:
+			return a < b
+		case quad.Float:
+			return float64(a) < float64(b)
+		}
+	case quad.Float:
+		switch b := b.(type) {
+		case quad.Int:
+			return float64(a) < float64(b)
+		case quad.Float:
+			return a < b
+		}
+	case quad.Time:
+		if b, ok := b.(quad.Time); ok {
+			return time.Time(a).Before(time.Time(b))
+		}
+	case quad.Bool:
+		if b, ok := b.(quad.Bool); ok {
+			return !bool(a) && bool(b)
+		}
+	}
+	return stringKey(a) < stringKey(b)
+}
+
+func stringKey(v quad.Value) string {
+	switch v := v.(type) {
+	case quad.String:
+		return string(v)
+	case quad.LangString:
+		return string(v.Value)
+	case quad.TypedString:
+		return string(v.Value)
+	case quad.IRI:
+		return string(v)
+	}
+	return quad.StringOf(v)
+}
+
+// projection is a set of fields selected for loading.
+type projection struct {
+	only []string // dot-separated field names; empty means all fields
+	skip []string
+}
+
+// all checks if all fields are selected.
+func (p projection) all() bool {
+	return len(p.only) == 0 && len(p.skip) == 0
 }
 
-func loadIteratorToDepth(ctx context.Context, qs graph.QuadStore, dst reflect.Value, depth int, list graph.Iterator) error {
+// selected checks if a field should be loaded.
+func (p projection) selected(name string) bool {
+	for _, s := range p.skip {
+		if s == name {
+			return false
+		}
+	}
+	if len(p.only) == 0 {
+		return true
+	}
+	for _, s := range p.only {
+		if s == name || strings.HasPrefix(s, name+".") {
+			return true
+		}
+	}
+	return false
+}
+
+// sub returns a projection for fields of a nested object.
+func (p projection) sub(name string) projection {
+	var (
+		sp    projection
+		whole bool
+	)
+	pref := name + "."
+	for _, s := range p.only {
+		if s == name {
+			whole = true
+		} else if strings.HasPrefix(s, pref) {
+			sp.only = append(sp.only, s[len(pref):])
+		}
+	}
+	if whole {
+		sp.only = nil
+	}
+	for _, s := range p.skip {
+		if strings.HasPrefix(s, pref) {
+			sp.skip = append(sp.skip, s[len(pref):])
+		}
+	}
+	return sp
+}
+
+// fieldName returns a name of the field from a rule key, omitting names of embedded structs.
+func fieldName(key string) string {
+	return key[strings.LastIndex(key, ".")+1:]
+}
+
+// loadIteratorToDepth loads objects from the list to a destination value. If the destination is a slice or a channel,
+// first offset objects are skipped and at most limit objects are loaded (zero means no limit).
+func loadIteratorToDepth(ctx context.Context, qs graph.QuadStore, dst reflect.Value, depth int, proj projection, offset, limit int, list graph.Iterator) error {
 	if ctx == nil {
 		ctx = context.Background()
 	}
@@ -698,13 +1115,14 @@ func loadIteratorToDepth(ctx context.Context, qs graph.QuadStore, dst reflect.Va
 	default:
 	}
 	rootOnly := depth == 0
-	it, err := iteratorForType(qs, list, et, rootOnly)
+	it, err := iteratorForType(qs, list, et, rootOnly, proj)
 	if err != nil {
 		return err
 	}
 	defer it.Close()
 
 	ctx = context.WithValue(ctx, fieldsCtxKey{}, fields)
+	matched := 0
 	for it.Next(ctx) {
 		select {
 		case <-ctx.Done():
@@ -716,6 +1134,15 @@ func loadIteratorToDepth(ctx context.Context, qs graph.QuadStore, dst reflect.Va
 		if len(mp) == 0 {
 			continue
 		}
+		if slice || chanl {
+			if limit > 0 && matched >= offset+limit {
+				break
+			}
+			matched++
+			if matched <= offset {
+				continue
+			}
+		}
 		cur := dst
 		if slice || chanl {
 			cur = reflect.New(et)
@@ -757,7 +1184,7 @@ func loadIteratorToDepth(ctx context.Context, qs graph.QuadStore, dst reflect.Va
 				}
 			}
 		}
-		err := loadToValue(ctx, qs, cur, depth, mo, "")
+		err := loadToValue(ctx, qs, cur, depth, proj, mo, "")
 		if err == errRequiredFieldIsMissing {
 			if !slice && !chanl {
 				return err
@@ -769,7 +1196,9 @@ func loadIteratorToDepth(ctx context.Context, qs graph.QuadStore, dst reflect.Va
 		if slice {
 			dst.Set(reflect.Append(dst, cur.Elem()))
 		} else if chanl {
-			dst.Send(cur.Elem())
+			if err := sendValue(ctx, dst, cur.Elem()); err != nil {
+				return err
+			}
 		} else {
 			return nil
 		}
@@ -796,11 +1225,16 @@ func isZero(rv reflect.Value) bool {
 	return rv.Interface() == reflect.Zero(rv.Type()).Interface() // TODO(dennwc): rewrite
 }
 
-func writeOneValReflect(w quad.Writer, id quad.Value, pred quad.Value, rv reflect.Value, rev bool) error {
+func writeOneValReflect(w quad.Writer, id quad.Value, pred quad.Value, rv reflect.Value, rev bool, lang string) error {
 	if isZero(rv) {
 		return nil
 	}
-	targ, ok := quad.AsValue(rv.Interface())
+	targ, ok, err := marshalQuad(rv)
+	if err != nil {
+		return err
+	} else if !ok {
+		targ, ok = quad.AsValue(rv.Interface())
+	}
 	if !ok {
 		if rv.Kind() == reflect.Ptr {
 			rv = rv.Elem()
@@ -817,6 +1251,9 @@ func writeOneValReflect(w quad.Writer, id quad.Value, pred quad.Value, rv reflec
 	if !ok {
 		return fmt.Errorf("unsupported type: %T", rv.Interface())
 	}
+	if s, ok := targ.(quad.String); ok && lang != "" {
+		targ = quad.LangString{Value: s, Lang: lang}
+	}
 	s, o := id, targ
 	if rev {
 		s, o = o, s
@@ -855,10 +1292,15 @@ func writeValueAs(w quad.Writer, id quad.Value, rv reflect.Value, pref string, r
 				return err
 			}
 		case saveRule:
+			var lang string
+			if len(r.Langs) != 0 {
+				// values are written in the most preferred language
+				lang = r.Langs[0]
+			}
 			if f.Type.Kind() == reflect.Slice {
 				sl := rv.Field(i)
 				for j := 0; j < sl.Len(); j++ {
-					if err := writeOneValReflect(w, id, r.Pred, sl.Index(j), r.Rev); err != nil {
+					if err := writeOneValReflect(w, id, r.Pred, sl.Index(j), r.Rev, lang); err != nil {
 						return err
 					}
 				}
@@ -867,7 +1309,7 @@ func writeValueAs(w quad.Writer, id quad.Value, rv reflect.Value, pref string, r
 				if !r.Opt && isZero(fv) {
 					return ErrReqFieldNotSet{Field: f.Name}
 				}
-				if err := writeOneValReflect(w, id, r.Pred, fv, r.Rev); err != nil {
+				if err := writeOneValReflect(w, id, r.Pred, fv, r.Rev, lang); err != nil {
 					return err
 				}
 			}
@@ -882,6 +1324,9 @@ func idFor(rules fieldRules, rt reflect.Type, rv reflect.Value, pref string) (id
 		fld := rt.Field(i)
 		hasAnon = hasAnon || fld.Anonymous
 		if _, ok := rules[pref+fld.Name].(idRule); ok {
+			if v, ok, err := marshalQuad(rv.Field(i)); ok {
+				return v, err
+			}
 			vid := rv.Field(i).Interface()
 			switch vid := vid.(type) {
 			case quad.IRI:
@@ -928,6 +1373,8 @@ var GenerateID func(interface{}) quad.Value = func(_ interface{}) quad.Value {
 func WriteAsQuads(w quad.Writer, o interface{}) (quad.Value, error) {
 	if v, ok := o.(quad.Value); ok {
 		return v, nil
+	} else if m, ok := o.(QuadMarshaler); ok {
+		return m.MarshalQuad()
 	}
 	rv := reflect.ValueOf(o)
 	if rv.Kind() == reflect.Ptr {
@@ -998,3 +1445,60 @@ func LoadNamespaces(ctx context.Context, qs graph.QuadStore, dest *voc.Namespace
 	}
 	return nil
 }
+
+// NamespacesGraph is a graph (label) used by PersistNamespace to store namespaces.
+const NamespacesGraph = quad.IRI("cayley:namespaces")
+
+const (
+	iriNamespace = quad.IRI("cayley:namespace")
+	iriPrefix    = quad.IRI("cayley:prefix")
+)
+
+// PersistNamespace stores a namespace in NamespacesGraph, replacing a namespace previously stored with the same prefix.
+// All changes are applied in a single transaction.
+//
+// Stored namespaces can be loaded with LoadNamespaces.
+func PersistNamespace(ctx context.Context, qs graph.QuadStore, qw graph.QuadWriter, ns voc.Namespace) error {
+	if ns.Prefix == "" || ns.Full == "" {
+		return errors.New("namespace prefix and IRI must be set")
+	}
+	pref, full := quad.IRI(ns.Prefix), quad.IRI(ns.Full)
+	old, err := path.StartPath(qs, pref).LabelContext(NamespacesGraph).In(iriPrefix).
+		Iterate(ctx).Paths(false).AllValues(qs)
+	if err != nil {
+		return err
+	}
+	// namespace IRI may be stored with multiple prefixes, thus the type is only
+	// removed with the last prefix and added with the first one
+	prefixes := func(v quad.Value) (int64, error) {
+		return path.StartPath(qs, v).LabelContext(NamespacesGraph).Out(iriPrefix).Iterate(ctx).Count()
+	}
+	tx := graph.NewTransaction()
+	for _, v := range old {
+		if v == full {
+			return nil // already stored
+		}
+		tx.RemoveQuad(quad.Quad{Subject: v, Predicate: iriPrefix, Object: pref, Label: NamespacesGraph})
+		if n, err := prefixes(v); err != nil {
+			return err
+		} else if n <= 1 {
+			tx.RemoveQuad(quad.Quad{Subject: v, Predicate: quad.IRI(rdf.Type), Object: iriNamespace, Label: NamespacesGraph})
+		}
+	}
+	if n, err := prefixes(full); err != nil {
+		return err
+	} else if n == 0 {
+		tx.AddQuad(quad.Quad{Subject: full, Predicate: quad.IRI(rdf.Type), Object: iriNamespace, Label: NamespacesGraph})
+	}
+	tx.AddQuad(quad.Quad{Subject: full, Predicate: iriPrefix, Object: pref, Label: NamespacesGraph})
+	return qw.ApplyTransaction(tx)
+}
+
+// RegisterNamespace persists a namespace in the graph and adds it to the global namespace registry.
+func RegisterNamespace(ctx context.Context, qs graph.QuadStore, qw graph.QuadWriter, ns voc.Namespace) error {
+	if err := PersistNamespace(ctx, qs, qw, ns); err != nil {
+		return err
+	}
+	voc.Register(ns)
+	return nil
+}
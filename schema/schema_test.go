@@ -2,8 +2,11 @@ package schema_test
 
 import (
 	"context"
+	"fmt"
 	"reflect"
 	"sort"
+	"strconv"
+	"strings"
 	"testing"
 
 	"github.com/cayleygraph/cayley/graph"
@@ -13,6 +16,7 @@ import (
 	"github.com/cayleygraph/cayley/schema"
 	"github.com/cayleygraph/cayley/voc"
 	"github.com/cayleygraph/cayley/voc/rdf"
+	"github.com/cayleygraph/cayley/writer"
 )
 
 type item struct {
@@ -84,6 +88,13 @@ func (t *treeItemReq) Sort() {
 	sort.Sort(treeItemReqByIRI(t.Children))
 }
 
+type person struct {
+	ID      quad.IRI `quad:"@id"`
+	Name    string   `quad:"name"`
+	Age     int      `quad:"age,optional"`
+	Friends []person `quad:"friend"`
+}
+
 type genObject struct {
 	ID   quad.IRI `quad:"@id"`
 	Name string   `quad:"name"`
@@ -104,8 +115,61 @@ type Coords struct {
 	Lng float64 `json:"ex:lng"`
 }
 
+type langItem struct {
+	ID    quad.IRI `quad:"@id"`
+	Title string   `quad:"title,lang=en,lang="`
+	Alt   []string `quad:"alt,lang=de"`
+}
+
+// money is stored as a single typed value instead of a sub-object.
+type money struct {
+	Cents int64
+}
+
+func (m money) MarshalQuad() (quad.Value, error) {
+	return quad.TypedString{Value: quad.String(strconv.FormatInt(m.Cents, 10)), Type: "ex:cents"}, nil
+}
+
+func (m *money) UnmarshalQuad(v quad.Value) error {
+	ts, ok := v.(quad.TypedString)
+	if !ok || ts.Type != "ex:cents" {
+		return fmt.Errorf("unexpected value: %v", v)
+	}
+	n, err := strconv.ParseInt(string(ts.Value), 10, 64)
+	m.Cents = n
+	return err
+}
+
+// itemID is stored as an IRI with a prefix.
+type itemID int
+
+func (id itemID) MarshalQuad() (quad.Value, error) {
+	return quad.IRI("item/" + strconv.Itoa(int(id))), nil
+}
+
+func (id *itemID) UnmarshalQuad(v quad.Value) error {
+	s, ok := v.(quad.IRI)
+	if !ok || !strings.HasPrefix(string(s), "item/") {
+		return fmt.Errorf("unexpected value: %v", v)
+	}
+	n, err := strconv.Atoi(strings.TrimPrefix(string(s), "item/"))
+	*id = itemID(n)
+	return err
+}
+
+type order struct {
+	ID     itemID  `quad:"@id"`
+	Total  money   `quad:"total"`
+	Extra  []money `quad:"extra"`
+	Refund *money  `quad:"refund,opt"`
+}
+
+func cents(n string) quad.TypedString { return quad.TypedString{Value: quad.String(n), Type: "ex:cents"} }
+
 func iri(s string) quad.IRI { return quad.IRI(s) }
 
+func lang(s, l string) quad.LangString { return quad.LangString{Value: quad.String(s), Lang: l} }
+
 const typeIRI = quad.IRI(rdf.Type)
 
 var testWriteValueCases = []struct {
@@ -266,6 +330,27 @@ var testWriteValueCases = []struct {
 		},
 		nil,
 	},
+	{
+		"languages",
+		langItem{ID: "l1", Title: "Hi", Alt: []string{"A"}},
+		iri("l1"),
+		[]quad.Quad{
+			{iri("l1"), iri("title"), lang("Hi", "en"), nil},
+			{iri("l1"), iri("alt"), lang("A", "de"), nil},
+		},
+		nil,
+	},
+	{
+		"custom marshaler",
+		order{ID: 1, Total: money{150}, Extra: []money{{5}, {10}}},
+		iri("item/1"),
+		[]quad.Quad{
+			{iri("item/1"), iri("total"), cents("150"), nil},
+			{iri("item/1"), iri("extra"), cents("5"), nil},
+			{iri("item/1"), iri("extra"), cents("10"), nil},
+		},
+		nil,
+	},
 }
 
 type quadSlice []quad.Quad
@@ -314,11 +399,23 @@ var treeQuads = []quad.Quad{
 	{iri("n3"), iri("child"), iri("n4"), nil},
 }
 
+var personQuads = []quad.Quad{
+	{iri("alice"), iri("name"), quad.String("Alice"), nil},
+	{iri("alice"), iri("age"), quad.Int(30), nil},
+	{iri("bob"), iri("name"), quad.String("Bob"), nil},
+	{iri("bob"), iri("age"), quad.Int(25), nil},
+
+	{iri("alice"), iri("friend"), iri("bob"), nil},
+	{iri("bob"), iri("friend"), iri("alice"), nil},
+}
+
 var testFillValueCases = []struct {
 	name   string
 	expect interface{}
 	quads  []quad.Quad
 	depth  int
+	fields []string
+	skip   []string
 	from   []quad.Value
 }{
 	{
@@ -547,6 +644,71 @@ var testFillValueCases = []struct {
 			{iri("c1"), iri("ex:lng"), quad.Float(34.5), nil},
 		},
 	},
+	{
+		name:   "languages",
+		expect: langItem{ID: "l1", Title: "Hi", Alt: []string{"A"}},
+		quads: []quad.Quad{
+			{iri("l1"), iri("title"), lang("Hi", "en"), nil},
+			{iri("l1"), iri("title"), lang("Hallo", "de"), nil},
+			{iri("l1"), iri("title"), quad.String("hi"), nil},
+			{iri("l1"), iri("alt"), lang("A", "de"), nil},
+			{iri("l1"), iri("alt"), lang("C", "en"), nil},
+		},
+		from: []quad.Value{iri("l1")},
+	},
+	{
+		name:   "languages fallback",
+		expect: langItem{ID: "l2", Title: "hi"},
+		quads: []quad.Quad{
+			{iri("l2"), iri("title"), lang("Hallo", "de"), nil},
+			{iri("l2"), iri("title"), quad.String("hi"), nil},
+			{iri("l2"), iri("alt"), lang("C", "en"), nil},
+		},
+		from: []quad.Value{iri("l2")},
+	},
+	{
+		name:   "custom unmarshaler",
+		expect: order{ID: 2, Total: money{150}, Extra: []money{{5}}, Refund: &money{20}},
+		quads: []quad.Quad{
+			{iri("item/2"), iri("total"), cents("150"), nil},
+			{iri("item/2"), iri("extra"), cents("5"), nil},
+			{iri("item/2"), iri("refund"), cents("20"), nil},
+		},
+		from: []quad.Value{iri("item/2")},
+	},
+	{
+		name: "cycle with depth limit",
+		expect: person{ID: "alice", Name: "Alice", Age: 30, Friends: []person{
+			{ID: "bob", Name: "Bob", Age: 25, Friends: []person{
+				{ID: "alice"}, // only IDs are loaded at the depth limit
+			}},
+		}},
+		quads: personQuads,
+		depth: 1,
+		from:  []quad.Value{iri("alice")},
+	},
+	{
+		name: "select fields",
+		expect: person{ID: "alice", Name: "Alice", Friends: []person{
+			{ID: "bob", Name: "Bob", Friends: []person{
+				{ID: "alice", Name: "Alice"},
+			}},
+		}},
+		quads:  personQuads,
+		depth:  2,
+		fields: []string{"Name", "Friends.Name", "Friends.Friends.Name"},
+		from:   []quad.Value{iri("alice")},
+	},
+	{
+		name: "skip fields",
+		expect: person{ID: "alice", Age: 30, Friends: []person{
+			{ID: "bob", Name: "Bob", Age: 25},
+		}},
+		quads: personQuads,
+		depth: 1,
+		skip:  []string{"Name", "Friends.Friends"},
+		from:  []quad.Value{iri("alice")},
+	},
 }
 
 func TestLoadIteratorTo(t *testing.T) {
@@ -566,7 +728,8 @@ func TestLoadIteratorTo(t *testing.T) {
 			if depth == 0 {
 				depth = -1
 			}
-			if err := schema.LoadIteratorToDepth(nil, qs, out, depth, it); err != nil {
+			opts := schema.LoadOptions{Depth: depth, Fields: c.fields, Skip: c.skip}
+			if err := schema.LoadIteratorToWithOptions(nil, qs, out, opts, it); err != nil {
 				t.Errorf("case %d failed: %v", i+1, err)
 				return
 			}
@@ -590,6 +753,131 @@ func TestLoadIteratorTo(t *testing.T) {
 	}
 }
 
+type member struct {
+	ID   quad.IRI `quad:"@id"`
+	Name string   `quad:"name"`
+	Age  int      `quad:"age,optional"`
+}
+
+var memberQuads = []quad.Quad{
+	{iri("a"), iri("name"), quad.String("Ann"), nil},
+	{iri("a"), iri("age"), quad.Int(30), nil},
+	{iri("b"), iri("name"), quad.String("Bob"), nil},
+	{iri("b"), iri("age"), quad.Int(25), nil},
+	{iri("c"), iri("name"), quad.String("Cid"), nil},
+	{iri("d"), iri("name"), quad.String("Dan"), nil},
+	{iri("d"), iri("age"), quad.Int(40), nil},
+	{iri("e"), iri("age"), quad.Int(20), nil}, // not a member
+}
+
+func memberIDs(arr []member) []quad.IRI {
+	ids := make([]quad.IRI, 0, len(arr))
+	for _, m := range arr {
+		ids = append(ids, m.ID)
+	}
+	return ids
+}
+
+func TestLoadPaging(t *testing.T) {
+	qs := memstore.New(memberQuads...)
+	for _, c := range []struct {
+		name   string
+		opts   schema.LoadOptions
+		expect []quad.IRI
+	}{
+		{
+			name:   "order",
+			opts:   schema.LoadOptions{OrderBy: "Age"},
+			expect: []quad.IRI{"b", "a", "d", "c"},
+		},
+		{
+			name:   "order desc",
+			opts:   schema.LoadOptions{OrderBy: "-Age"},
+			expect: []quad.IRI{"d", "a", "b", "c"},
+		},
+		{
+			name:   "order by name",
+			opts:   schema.LoadOptions{OrderBy: "-Name", Offset: 1, Limit: 2},
+			expect: []quad.IRI{"c", "b"},
+		},
+		{
+			name:   "page",
+			opts:   schema.LoadOptions{OrderBy: "Age", Offset: 1, Limit: 2},
+			expect: []quad.IRI{"a", "d"},
+		},
+		{
+			name:   "offset after the end",
+			opts:   schema.LoadOptions{OrderBy: "Age", Offset: 10},
+			expect: []quad.IRI{},
+		},
+	} {
+		t.Run(c.name, func(t *testing.T) {
+			var out []member
+			err := schema.LoadToWithOptions(nil, qs, &out, c.opts)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := memberIDs(out); !reflect.DeepEqual(got, c.expect) {
+				t.Fatalf("unexpected objects: %v vs %v", got, c.expect)
+			}
+		})
+	}
+	t.Run("limit", func(t *testing.T) {
+		var all, out []member
+		if err := schema.LoadTo(nil, qs, &all); err != nil {
+			t.Fatal(err)
+		} else if len(all) != 4 {
+			t.Fatalf("unexpected objects: %v", memberIDs(all))
+		}
+		err := schema.LoadToWithOptions(nil, qs, &out, schema.LoadOptions{Offset: 1, Limit: 2})
+		if err != nil {
+			t.Fatal(err)
+		} else if !reflect.DeepEqual(out, all[1:3]) {
+			t.Fatalf("unexpected objects: %v vs %v", memberIDs(out), memberIDs(all[1:3]))
+		}
+	})
+	t.Run("unknown field", func(t *testing.T) {
+		var out []member
+		err := schema.LoadToWithOptions(nil, qs, &out, schema.LoadOptions{OrderBy: "Height"})
+		if err == nil {
+			t.Fatal("expected an error")
+		}
+	})
+}
+
+func TestLoadChan(t *testing.T) {
+	qs := memstore.New(memberQuads...)
+	ch := make(chan member)
+	errc := make(chan error, 1)
+	go func() {
+		errc <- schema.LoadChan(nil, qs, ch, schema.LoadOptions{OrderBy: "-Age", Limit: 2})
+	}()
+	var out []member
+	for m := range ch {
+		out = append(out, m)
+	}
+	if err := <-errc; err != nil {
+		t.Fatal(err)
+	}
+	expect := []member{
+		{ID: "d", Name: "Dan", Age: 40},
+		{ID: "a", Name: "Ann", Age: 30},
+	}
+	if !reflect.DeepEqual(out, expect) {
+		t.Fatalf("unexpected objects: %v vs %v", out, expect)
+	}
+
+	// canceled context must not block the sender
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if err := schema.LoadChan(ctx, qs, make(chan member), schema.LoadOptions{}); err == nil {
+		t.Fatal("expected an error")
+	}
+	if err := schema.LoadChan(nil, qs, []member{}, schema.LoadOptions{}); err == nil {
+		t.Fatal("expected an error")
+	}
+}
+
 func TestSaveNamespaces(t *testing.T) {
 	save := []voc.Namespace{
 		{Full: "http://example.org/", Prefix: "ex:"},
@@ -634,3 +922,220 @@ func TestSaveNamespaces(t *testing.T) {
 		t.Fatalf("wrong quads returned: got: %v, expect: %v", q, expect)
 	}
 }
+
+func TestPersistNamespace(t *testing.T) {
+	qs := memstore.New()
+	qw, err := writer.NewSingle(qs, graph.IgnoreOpts{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx := context.TODO()
+	for _, ns := range []voc.Namespace{
+		{Full: "http://example.org/", Prefix: "ex:"},
+		{Full: "http://cayley.io/", Prefix: "c:"},
+		{Full: "http://example.net/", Prefix: "ex:"}, // replaces the first one
+		{Full: "http://example.net/", Prefix: "ex:"},
+	} {
+		if err = schema.PersistNamespace(ctx, qs, qw, ns); err != nil {
+			t.Fatal(err)
+		}
+	}
+	var ns voc.Namespaces
+	if err = schema.LoadNamespaces(ctx, qs, &ns); err != nil {
+		t.Fatal(err)
+	}
+	got := ns.List()
+	expect := []voc.Namespace{
+		{Full: "http://cayley.io/", Prefix: "c:"},
+		{Full: "http://example.net/", Prefix: "ex:"},
+	}
+	sort.Sort(voc.ByFullName(got))
+	if !reflect.DeepEqual(expect, got) {
+		t.Fatalf("wrong namespaces returned: got: %v, expect: %v", got, expect)
+	}
+	qr := graph.NewQuadStoreReader(qs)
+	q, err := quad.ReadAll(qr)
+	qr.Close()
+	if err != nil {
+		t.Fatal(err)
+	} else if len(q) != 4 {
+		t.Fatalf("unexpected quads: %v", q)
+	}
+}
+
+type tag struct {
+	ID   quad.IRI `quad:"@id"`
+	Name string   `quad:"name"`
+}
+
+type contact struct {
+	Email string `quad:"email"`
+}
+
+type account struct {
+	ID      quad.IRI `quad:"@id"`
+	Name    string   `quad:"name"`
+	Contact contact  `quad:"contact"`
+	Tags    []tag    `quad:"tag"`
+}
+
+var accountQuads = []quad.Quad{
+	{iri("acc1"), iri("name"), quad.String("One"), nil},
+	{iri("acc1"), iri("contact"), quad.BNode("c1"), nil},
+	{quad.BNode("c1"), iri("email"), quad.String("one@example.org"), nil},
+	{iri("acc1"), iri("tag"), iri("t1"), nil},
+	{iri("acc1"), iri("tag"), iri("t2"), nil},
+	{iri("acc1"), iri("other"), quad.String("kept"), nil},
+	{iri("t1"), iri("name"), quad.String("T1"), nil},
+	{iri("t2"), iri("name"), quad.String("T2"), nil},
+
+	{iri("acc2"), iri("name"), quad.String("Two"), nil},
+	{iri("acc2"), iri("contact"), quad.BNode("c2"), nil},
+	{quad.BNode("c2"), iri("email"), quad.String("two@example.org"), nil},
+	{iri("acc2"), iri("tag"), iri("t1"), nil},
+}
+
+func TestDelete(t *testing.T) {
+	for _, c := range []struct {
+		name string
+		mode schema.CascadeMode
+		kept []quad.Quad
+	}{
+		{
+			name: "owned",
+			mode: schema.CascadeOwned,
+		},
+		{
+			name: "blank nodes",
+			mode: schema.CascadeBlankNodes,
+			kept: []quad.Quad{
+				{iri("t2"), iri("name"), quad.String("T2"), nil},
+			},
+		},
+		{
+			name: "none",
+			mode: schema.CascadeNone,
+			kept: []quad.Quad{
+				{quad.BNode("c1"), iri("email"), quad.String("one@example.org"), nil},
+				{iri("t2"), iri("name"), quad.String("T2"), nil},
+			},
+		},
+	} {
+		t.Run(c.name, func(t *testing.T) {
+			qs := memstore.New(accountQuads...)
+			qw, err := writer.NewSingle(qs, graph.IgnoreOpts{})
+			if err != nil {
+				t.Fatal(err)
+			}
+			err = schema.DeleteWithOptions(nil, qw, qs, account{ID: "acc1"}, schema.DeleteOptions{Cascade: c.mode})
+			if err != nil {
+				t.Fatal(err)
+			}
+			expect := append([]quad.Quad{
+				{iri("acc1"), iri("other"), quad.String("kept"), nil},
+				{iri("t1"), iri("name"), quad.String("T1"), nil},
+			}, accountQuads[8:]...)
+			expect = append(expect, c.kept...)
+			sort.Sort(quad.ByQuadString(expect))
+
+			qr := graph.NewQuadStoreReader(qs)
+			got, err := quad.ReadAll(qr)
+			qr.Close()
+			if err != nil {
+				t.Fatal(err)
+			}
+			sort.Sort(quad.ByQuadString(got))
+			if !reflect.DeepEqual(expect, got) {
+				t.Fatalf("wrong quads left: got: %v, expect: %v", got, expect)
+			}
+		})
+	}
+	t.Run("no id", func(t *testing.T) {
+		qs := memstore.New(accountQuads...)
+		qw, err := writer.NewSingle(qs, graph.IgnoreOpts{})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err = schema.Delete(nil, qw, qs, account{Name: "One"}); err == nil {
+			t.Fatal("expected an error")
+		}
+		if err = schema.Delete(nil, qw, qs, &account{ID: "missing"}); err != nil {
+			t.Fatal(err)
+		}
+	})
+}
+
+type versioned struct {
+	ID      quad.IRI `quad:"@id"`
+	Version int      `quad:"@version"`
+	Name    string   `quad:"name"`
+	Contact *contact `quad:"contact,optional"`
+}
+
+func TestUpdate(t *testing.T) {
+	qs := memstore.New()
+	qw, err := writer.NewSingle(qs, graph.IgnoreOpts{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx := context.TODO()
+	obj := &versioned{ID: "a", Name: "A", Contact: &contact{Email: "a@example.org"}}
+	if err = schema.Update(ctx, qw, qs, obj); err != nil {
+		t.Fatal(err)
+	} else if obj.Version != 1 {
+		t.Fatalf("unexpected version: %d", obj.Version)
+	}
+
+	// two concurrent edits of the same version
+	var v1, v2 versioned
+	if err = schema.LoadTo(ctx, qs, &v1, iri("a")); err != nil {
+		t.Fatal(err)
+	}
+	if err = schema.LoadTo(ctx, qs, &v2, iri("a")); err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(*obj, v1) {
+		t.Fatalf("unexpected object: %#v vs %#v", v1, *obj)
+	}
+	v1.Name, v1.Contact = "B", &contact{Email: "b@example.org"}
+	if err = schema.Update(ctx, qw, qs, &v1); err != nil {
+		t.Fatal(err)
+	}
+	v2.Name = "C"
+	if err = schema.Update(ctx, qw, qs, &v2); err != schema.ErrVersionConflict {
+		t.Fatalf("expected a conflict, got: %v", err)
+	} else if v2.Version != 1 {
+		t.Fatalf("version changed on failure: %d", v2.Version)
+	}
+
+	qr := graph.NewQuadStoreReader(qs)
+	got, err := quad.ReadAll(qr)
+	qr.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i, q := range got {
+		// blank node of a contact is random
+		if _, ok := q.Subject.(quad.BNode); ok {
+			got[i].Subject = quad.BNode("c")
+		}
+		if _, ok := q.Object.(quad.BNode); ok {
+			got[i].Object = quad.BNode("c")
+		}
+	}
+	expect := []quad.Quad{
+		{iri("a"), iri("cayley:version"), quad.Int(2), nil},
+		{iri("a"), iri("name"), quad.String("B"), nil},
+		{iri("a"), iri("contact"), quad.BNode("c"), nil},
+		{quad.BNode("c"), iri("email"), quad.String("b@example.org"), nil},
+	}
+	sort.Sort(quad.ByQuadString(expect))
+	sort.Sort(quad.ByQuadString(got))
+	if !reflect.DeepEqual(expect, got) {
+		t.Fatalf("wrong quads: got: %v, expect: %v", got, expect)
+	}
+
+	if err = schema.Update(ctx, qw, qs, &versioned{ID: "b", Version: 3, Name: "B"}); err != schema.ErrVersionConflict {
+		t.Fatalf("expected a conflict, got: %v", err)
+	}
+}
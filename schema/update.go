@@ -0,0 +1,170 @@
+package schema
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"reflect"
+	"strings"
+
+	"github.com/cayleygraph/cayley/graph"
+	"github.com/cayleygraph/cayley/graph/path"
+	"github.com/cayleygraph/cayley/quad"
+)
+
+// ErrVersionConflict is returned by Update if the version of an object does not match the one stored in the graph.
+var ErrVersionConflict = errors.New("object was modified concurrently")
+
+// Update replaces an object in the graph with a new value in a single transaction.
+// The object is created if it does not exist. Object must have an ID.
+//
+// Quads of all the fields of the object type are replaced, as well as sub-objects identified
+// by blank nodes and referenced only by this object (see CascadeBlankNodes).
+//
+// If the type has a version field (tagged "@version"), its value must match the version stored
+// in the graph (or be zero for new objects), otherwise ErrVersionConflict is returned.
+// On success, the version is incremented both in the graph and in the object.
+// The check is atomic for quad stores that implement graph.Versioned; other quad stores rely on
+// the writer to reject removal of a missing version quad.
+func Update(ctx context.Context, qw graph.QuadWriter, qs graph.QuadStore, obj interface{}) error {
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	rv := reflect.ValueOf(obj)
+	if rv.Kind() != reflect.Ptr || rv.Elem().Kind() != reflect.Struct {
+		return fmt.Errorf("expected a pointer to struct, got %T", obj)
+	}
+	rv = rv.Elem()
+	rt := rv.Type()
+	id, err := objectID(rt, rv)
+	if err != nil {
+		return err
+	}
+	tx := graph.NewTransaction()
+	if vs, ok := graph.AsVersioned(qs); ok {
+		// all reads below must happen after this point
+		tx.Base = vs.Horizon()
+	}
+	vf, versioned := versionField(rt, rv)
+	var cur int64
+	if versioned {
+		cur = fieldInt(vf)
+		stored, err := storedVersion(ctx, qs, id)
+		if err != nil {
+			return err
+		} else if stored != cur {
+			return ErrVersionConflict
+		}
+	}
+	if ref := qs.ValueOf(id); ref != nil {
+		d := &deleter{
+			ctx:     ctx,
+			qs:      qs,
+			mode:    CascadeBlankNodes,
+			tx:      tx,
+			removed: make(map[interface{}]struct{}),
+			deleted: make(map[interface{}]struct{}),
+		}
+		if err = d.deleteObject(ref, rt); err != nil {
+			return err
+		}
+	}
+	if versioned {
+		setFieldInt(vf, cur+1)
+	}
+	if _, err = WriteAsQuads(graph.NewTxWriter(tx, graph.Add), obj); err == nil {
+		err = qw.ApplyTransaction(tx)
+	}
+	if err != nil {
+		if versioned {
+			setFieldInt(vf, cur)
+			if isVersionConflict(err) {
+				return ErrVersionConflict
+			}
+		}
+		return err
+	}
+	return nil
+}
+
+// objectID returns an ID of the object, or an error if the object has no ID.
+func objectID(rt reflect.Type, rv reflect.Value) (quad.Value, error) {
+	rules, err := rulesFor(rt)
+	if err != nil {
+		return nil, fmt.Errorf("can't load rules: %v", err)
+	}
+	id, err := idFor(rules, rt, rv, "")
+	if err != nil {
+		return nil, err
+	} else if id == nil || id == quad.IRI("") || id == quad.BNode("") {
+		return nil, fmt.Errorf("object has no ID: %v", rt)
+	}
+	return id, nil
+}
+
+// versionField finds a field tagged as a version of the object.
+func versionField(rt reflect.Type, rv reflect.Value) (reflect.Value, bool) {
+	rules, err := rulesFor(rt)
+	if err != nil {
+		return reflect.Value{}, false
+	}
+	for key, r := range rules {
+		if r, ok := r.(saveRule); !ok || !r.Version {
+			continue
+		}
+		cur := rv
+		for _, name := range strings.Split(key, ".") {
+			if cur.Kind() == reflect.Ptr {
+				if cur.IsNil() {
+					return reflect.Value{}, false
+				}
+				cur = cur.Elem()
+			}
+			cur = cur.FieldByName(name)
+		}
+		return cur, true
+	}
+	return reflect.Value{}, false
+}
+
+// storedVersion returns the latest version of the object stored in the graph, or zero if there is none.
+func storedVersion(ctx context.Context, qs graph.QuadStore, id quad.Value) (int64, error) {
+	vals, err := path.StartPath(qs, id).Out(iriVersion).Iterate(ctx).AllValues(qs)
+	if err != nil {
+		return 0, err
+	}
+	var ver int64
+	for _, v := range vals {
+		if v, ok := v.(quad.Int); ok && int64(v) > ver {
+			ver = int64(v)
+		}
+	}
+	return ver, nil
+}
+
+// isVersionConflict checks if the transaction failed because the object was changed concurrently.
+func isVersionConflict(err error) bool {
+	if graph.IsConflict(err) {
+		return true
+	}
+	de, ok := err.(*graph.DeltaError)
+	return ok && de.Delta.Quad.Predicate == iriVersion &&
+		(de.Err == graph.ErrQuadExists || de.Err == graph.ErrQuadNotExist)
+}
+
+func fieldInt(rv reflect.Value) int64 {
+	switch rv.Kind() {
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return int64(rv.Uint())
+	}
+	return rv.Int()
+}
+
+func setFieldInt(rv reflect.Value, v int64) {
+	switch rv.Kind() {
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		rv.SetUint(uint64(v))
+	default:
+		rv.SetInt(v)
+	}
+}
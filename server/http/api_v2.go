@@ -15,6 +15,8 @@
 package cayleyhttp
 
 import (
+	"bufio"
+	"bytes"
 	"compress/gzip"
 	"context"
 	"encoding/json"
@@ -22,14 +24,20 @@ import (
 	"fmt"
 	"io"
 	"io/ioutil"
+	"mime"
 	"net/http"
+	"strconv"
+	"sync"
 	"time"
 
 	"github.com/julienschmidt/httprouter"
 
 	"github.com/cayleygraph/cayley/clog"
 	"github.com/cayleygraph/cayley/graph"
+	"github.com/cayleygraph/cayley/graph/audit"
+	"github.com/cayleygraph/cayley/graph/shape"
 	"github.com/cayleygraph/cayley/quad"
+	"github.com/cayleygraph/cayley/quad/nquads"
 	"github.com/cayleygraph/cayley/query"
 	_ "github.com/cayleygraph/cayley/writer"
 )
@@ -39,39 +47,153 @@ func NewAPIv2(h *graph.Handle) *APIv2 {
 }
 
 func NewAPIv2Writer(h *graph.Handle, wtype string, wopts graph.Options) *APIv2 {
-	api := &APIv2{h: h, wtyp: wtype, wopt: wopts, limit: 100}
+	api := &APIv2{h: h, wtyp: wtype, wopt: wopts, set: apiSettings{limit: 100}}
 	api.r = httprouter.New()
 	api.RegisterOn(api.r)
 	return api
 }
 
 type APIv2 struct {
-	h     *graph.Handle
-	r     *httprouter.Router
-	ro    bool
-	batch int
+	h  *graph.Handle
+	r  *httprouter.Router
+	ro bool
 
 	// replication
-	wtyp string
-	wopt graph.Options
+	wtyp     string
+	wopt     graph.Options
+	txs      txSessions
+	sessions graphSessions
+
+	mu       sync.RWMutex
+	set      apiSettings
+	reload   func() error
+	reloadMu sync.Mutex // serializes reloads
+
+	// info
+	backend string
+}
+
+// apiSettings are parameters of the API that can be changed while the server is running.
+type apiSettings struct {
+	batch int
 
 	// query
-	timeout time.Duration
-	limit   int
+	timeout  time.Duration
+	limit    int
+	scanned  int64
+	compact  bool
+	typed    bool
+	parallel int
+
+	cache *queryCache
+
+	// write
+	idem *idempotencyStore
+
+	acl        *accessPolicies
+	adminToken string
+	audit      *auditLog
+}
+
+// current returns a snapshot of the current settings.
+func (api *APIv2) current() apiSettings {
+	api.mu.RLock()
+	defer api.mu.RUnlock()
+	return api.set
 }
 
 func (api *APIv2) SetReadOnly(ro bool) {
 	api.ro = ro
 }
 func (api *APIv2) SetBatchSize(n int) {
-	api.batch = n
+	api.mu.Lock()
+	api.set.batch = n
+	api.mu.Unlock()
 }
 func (api *APIv2) SetQueryTimeout(dt time.Duration) {
-	api.timeout = dt
+	api.mu.Lock()
+	api.set.timeout = dt
+	api.mu.Unlock()
 }
 func (api *APIv2) SetQueryLimit(n int) {
-	api.limit = n
+	api.mu.Lock()
+	api.set.limit = n
+	api.mu.Unlock()
+}
+
+// SetScanLimit sets a maximal number of primitives a single query can read from the backend.
+// Queries that reach the limit will return partial results.
+func (api *APIv2) SetScanLimit(n int64) {
+	api.mu.Lock()
+	api.set.scanned = n
+	api.mu.Unlock()
+}
+
+// SetCompactIRIs enables compaction of IRIs in query results to prefixed names of registered namespaces.
+// It can be overridden with "iris" request parameter ("full" or "compact"). If enabled, prefixed names
+// are also accepted in queries.
+func (api *APIv2) SetCompactIRIs(v bool) {
+	api.mu.Lock()
+	api.set.compact = v
+	api.mu.Unlock()
+}
+
+// SetTypedValues enables encoding of values in query results with explicit type information.
+// See query.TypedValue for details. It can be overridden with "values" request parameter ("native" or "typed").
+func (api *APIv2) SetTypedValues(v bool) {
+	api.mu.Lock()
+	api.set.typed = v
+	api.mu.Unlock()
+}
+
+// SetParallelism sets a maximal number of goroutines a single query can use to evaluate independent
+// branches of the query concurrently. Values less than 2 disable parallel execution.
+func (api *APIv2) SetParallelism(n int) {
+	api.mu.Lock()
+	api.set.parallel = n
+	api.mu.Unlock()
+}
+
+// SetQueryCache enables caching of query results. Size is a maximal number of cached results,
+// and ttl is the maximal age of them (zero means no limit). Cache is disabled if size is zero.
+//
+// Results are cached only for backends that implement graph.Versioned, and only until the next write.
+// Results of GraphQL queries and results streamed in formats other than JSON are not cached.
+func (api *APIv2) SetQueryCache(size int, ttl time.Duration) {
+	api.mu.Lock()
+	defer api.mu.Unlock()
+	if size <= 0 {
+		api.set.cache = nil
+		return
+	} else if c := api.set.cache; c == nil || c.size != size || c.ttl != ttl {
+		api.set.cache = newQueryCache(size, ttl)
+	}
+	if _, ok := graph.AsVersioned(api.h.QuadStore); !ok {
+		clog.Warningf("query cache is enabled, but the backend is not versioned; results will not be cached")
+	}
 }
+
+// SetIdempotency enables processing of Idempotency-Key headers on write endpoints. Size is a maximal number
+// of stored results, and ttl is the time after which a key can be reused (zero means no limit).
+// Keys are ignored if size is zero.
+//
+// A repeated request with the same key returns the stored result of the first request instead of applying
+// the changes again. Results are kept in memory, thus keys are not shared between server instances.
+func (api *APIv2) SetIdempotency(size int, ttl time.Duration) {
+	api.mu.Lock()
+	defer api.mu.Unlock()
+	if size <= 0 {
+		api.set.idem = nil
+	} else if s := api.set.idem; s == nil || s.size != size || s.ttl != ttl {
+		api.set.idem = newIdempotencyStore(size, ttl)
+	}
+}
+
+// SetBackend sets a backend name reported by the info endpoint.
+func (api *APIv2) SetBackend(name string) {
+	api.backend = name
+}
+
 func (api *APIv2) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 	api.r.ServeHTTP(w, r)
 }
@@ -82,6 +204,7 @@ func wrap(h http.HandlerFunc, arr []HandlerWrapper) httprouter.Handle {
 	wh := func(w http.ResponseWriter, r *http.Request, _ httprouter.Params) {
 		h(w, r)
 	}
+	wh = RequestID(wh)
 	for _, w := range arr {
 		wh = w(wh)
 	}
@@ -89,21 +212,56 @@ func wrap(h http.HandlerFunc, arr []HandlerWrapper) httprouter.Handle {
 }
 func (api *APIv2) RegisterDataOn(r *httprouter.Router, wrappers ...HandlerWrapper) {
 	if !api.ro {
-		r.POST("/api/v2/write", wrap(api.ServeWrite, wrappers))
-		r.POST("/api/v2/delete", wrap(api.ServeDelete, wrappers))
-		r.POST("/api/v2/node/delete", wrap(api.ServeNodeDelete, wrappers))
+		r.POST("/api/v2/write", wrap(api.audited(audit.OpWrite, api.idempotent(api.ServeWrite)), wrappers))
+		r.POST("/api/v2/delete", wrap(api.audited(audit.OpWrite, api.idempotent(api.ServeDelete)), wrappers))
+		r.POST("/api/v2/node/delete", wrap(api.audited(audit.OpWrite, api.idempotent(api.ServeNodeDelete)), wrappers))
+		r.POST("/api/v2/node/merge", wrap(api.audited(audit.OpWrite, api.idempotent(api.ServeNodeMerge)), wrappers))
+		r.DELETE("/api/v2/quads", wrap(api.audited(audit.OpWrite, api.idempotent(api.ServeQuadsDelete)), wrappers))
+		r.POST("/api/v2/tx", wrap(api.audited(audit.OpWrite, api.idempotent(api.ServeTx)), wrappers))
+		r.POST("/api/v2/batch", wrap(api.audited(audit.OpWrite, api.idempotent(api.ServeBatch)), wrappers))
+		r.POST("/api/v2/tx/begin", wrap(api.ServeTxBegin, wrappers))
+		r.POST("/api/v2/tx/add", wrap(api.ServeTxAdd, wrappers))
+		r.POST("/api/v2/tx/remove", wrap(api.ServeTxRemove, wrappers))
+		r.POST("/api/v2/tx/commit", wrap(api.audited(audit.OpWrite, api.ServeTxCommit), wrappers))
+		r.POST("/api/v2/tx/abort", wrap(api.ServeTxAbort, wrappers))
+		r.POST("/api/v2/session/begin", wrap(api.ServeSessionBegin, wrappers))
+		r.POST("/api/v2/session/close", wrap(api.ServeSessionClose, wrappers))
+		r.POST("/api/v2/namespaces", wrap(api.ServeNamespaceAdd, wrappers))
 	}
 	r.POST("/api/v2/read", wrap(api.ServeRead, wrappers))
 	r.GET("/api/v2/read", wrap(api.ServeRead, wrappers))
+	r.GET("/api/v2/nodes", wrap(api.ServeNodes, wrappers))
 	r.GET("/api/v2/formats", wrap(api.ServeFormats, wrappers))
+	r.GET("/api/v2/horizon", wrap(api.ServeHorizon, wrappers))
+	r.GET("/api/v2/namespaces", wrap(api.ServeNamespaces, wrappers))
+	r.GET("/api/v2/schema", wrap(api.ServeSchema, wrappers))
+	r.GET("/api/v2/info", wrap(api.ServeInfo, wrappers))
+	r.GET("/api/v2/digest", wrap(api.ServeDigest, wrappers))
+	r.GET("/api/v2/journal", wrap(api.ServeJournal, wrappers))
 }
 func (api *APIv2) RegisterQueryOn(r *httprouter.Router, wrappers ...HandlerWrapper) {
-	r.POST("/api/v2/query", wrap(api.ServeQuery, wrappers))
-	r.GET("/api/v2/query", wrap(api.ServeQuery, wrappers))
+	r.POST("/api/v2/query", wrap(api.audited(audit.OpQuery, api.ServeQuery), wrappers))
+	r.GET("/api/v2/query", wrap(api.audited(audit.OpQuery, api.ServeQuery), wrappers))
+	r.POST("/api/v2/graph", wrap(api.audited(audit.OpQuery, api.ServeGraph), wrappers))
+	r.GET("/api/v2/graph", wrap(api.audited(audit.OpQuery, api.ServeGraph), wrappers))
+}
+func (api *APIv2) RegisterAdminOn(r *httprouter.Router, wrappers ...HandlerWrapper) {
+	r.GET("/api/v2/admin/config", wrap(api.adminOnly(api.ServeConfig), wrappers))
+	if !api.ro {
+		r.POST("/api/v2/admin/reload", wrap(api.adminOnly(api.ServeReload), wrappers))
+		r.POST("/api/v2/admin/compact", wrap(api.adminOnly(api.ServeCompact), wrappers))
+	}
+}
+func (api *APIv2) RegisterHealthOn(r *httprouter.Router, wrappers ...HandlerWrapper) {
+	r.GET("/health", wrap(api.ServeHealth, wrappers))
+	r.GET("/ready", wrap(api.ServeReady, wrappers))
 }
 func (api *APIv2) RegisterOn(r *httprouter.Router, wrappers ...HandlerWrapper) {
 	api.RegisterDataOn(r, wrappers...)
 	api.RegisterQueryOn(r, wrappers...)
+	api.RegisterAdminOn(r, wrappers...)
+	// health checks are called frequently, thus they are not wrapped to avoid flooding request logs
+	api.RegisterHealthOn(r)
 }
 
 const (
@@ -113,6 +271,7 @@ const (
 	hdrAccept          = "Accept"
 	hdrAcceptEncoding  = "Accept-Encoding"
 	contentTypeJSON    = "application/json"
+	contentTypeNodes   = "text/plain; charset=utf-8"
 )
 
 func getFormat(r *http.Request, formKey string, acceptName string) *quad.Format {
@@ -166,13 +325,24 @@ func writerFrom(w http.ResponseWriter, r *http.Request, acceptName string) io.Wr
 }
 
 func (api *APIv2) handleForRequest(r *http.Request) (*graph.Handle, error) {
-	return HandleForRequest(api.h, api.wtyp, api.wopt, r)
+	h, err := api.sessionForRequest(r)
+	if err == nil && h == nil {
+		h, err = HandleForRequest(api.h, api.wtyp, api.wopt, r)
+	}
+	if err != nil {
+		return nil, err
+	}
+	h, err = api.secureHandle(r, h)
+	if err != nil {
+		return nil, err
+	}
+	return api.auditHandle(r, h)
 }
 
 func (api *APIv2) ServeWrite(w http.ResponseWriter, r *http.Request) {
 	defer r.Body.Close()
 	if api.ro {
-		jsonResponse(w, http.StatusForbidden, errors.New("database is read-only"))
+		jsonResponse(w, http.StatusForbidden, graph.ErrNotWritable)
 		return
 	}
 	format := getFormat(r, "", hdrContentType)
@@ -186,7 +356,11 @@ func (api *APIv2) ServeWrite(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 	defer rd.Close()
-	qr := format.Reader(rd)
+	qr, err := format.NewSafeReader(rd)
+	if err != nil {
+		jsonResponse(w, http.StatusBadRequest, err)
+		return
+	}
 	defer qr.Close()
 	h, err := api.handleForRequest(r)
 	if err != nil {
@@ -195,14 +369,14 @@ func (api *APIv2) ServeWrite(w http.ResponseWriter, r *http.Request) {
 	}
 	qw := graph.NewWriter(h.QuadWriter)
 	defer qw.Close()
-	n, err := quad.CopyBatch(qw, qr, api.batch)
+	n, err := quad.CopyBatch(qw, qr, api.current().batch)
 	if err != nil {
-		jsonResponse(w, http.StatusInternalServerError, err)
+		errorResponse(w, err)
 		return
 	}
 	err = qw.Close()
 	if err != nil {
-		jsonResponse(w, http.StatusInternalServerError, err)
+		errorResponse(w, err)
 		return
 	}
 	w.Header().Set(hdrContentType, contentTypeJSON)
@@ -212,7 +386,7 @@ func (api *APIv2) ServeWrite(w http.ResponseWriter, r *http.Request) {
 func (api *APIv2) ServeDelete(w http.ResponseWriter, r *http.Request) {
 	defer r.Body.Close()
 	if api.ro {
-		jsonResponse(w, http.StatusForbidden, errors.New("database is read-only"))
+		jsonResponse(w, http.StatusForbidden, graph.ErrNotWritable)
 		return
 	}
 	format := getFormat(r, "", hdrContentType)
@@ -226,7 +400,11 @@ func (api *APIv2) ServeDelete(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 	defer rd.Close()
-	qr := format.Reader(r.Body)
+	qr, err := format.NewSafeReader(rd)
+	if err != nil {
+		jsonResponse(w, http.StatusBadRequest, err)
+		return
+	}
 	defer qr.Close()
 	h, err := api.handleForRequest(r)
 	if err != nil {
@@ -235,19 +413,39 @@ func (api *APIv2) ServeDelete(w http.ResponseWriter, r *http.Request) {
 	}
 	qw := graph.NewRemover(h.QuadWriter)
 	defer qw.Close()
-	n, err := quad.CopyBatch(qw, qr, api.batch)
+	n, err := quad.CopyBatch(qw, qr, api.current().batch)
 	if err != nil {
-		jsonResponse(w, http.StatusInternalServerError, err)
+		errorResponse(w, err)
 		return
 	}
 	w.Header().Set(hdrContentType, contentTypeJSON)
 	fmt.Fprintf(w, `{"result": "Successfully deleted %d quads.", "count": %d}`+"\n", n, n)
 }
 
+func (api *APIv2) ServeCompact(w http.ResponseWriter, r *http.Request) {
+	if api.ro {
+		jsonResponse(w, http.StatusForbidden, graph.ErrNotWritable)
+		return
+	}
+	m, ok := graph.AsMaintainer(api.h.QuadStore)
+	if !ok || !graph.FeaturesOf(api.h.QuadStore).Compaction {
+		jsonResponse(w, http.StatusNotImplemented, graph.ErrOperationNotSupported)
+		return
+	}
+	start := time.Now()
+	if err := m.Compact(r.Context()); err != nil {
+		errorResponse(w, err)
+		return
+	}
+	dt := time.Since(start)
+	w.Header().Set(hdrContentType, contentTypeJSON)
+	fmt.Fprintf(w, `{"result": "Compaction finished.", "time": %q}`+"\n", dt)
+}
+
 func (api *APIv2) ServeNodeDelete(w http.ResponseWriter, r *http.Request) {
 	defer r.Body.Close()
 	if api.ro {
-		jsonResponse(w, http.StatusForbidden, errors.New("database is read-only"))
+		jsonResponse(w, http.StatusForbidden, graph.ErrNotWritable)
 		return
 	}
 	format := getFormat(r, "", hdrContentType)
@@ -280,7 +478,7 @@ func (api *APIv2) ServeNodeDelete(w http.ResponseWriter, r *http.Request) {
 	}
 	err = h.RemoveNode(v)
 	if err != nil {
-		jsonResponse(w, http.StatusInternalServerError, err)
+		errorResponse(w, err)
 		return
 	}
 	w.Header().Set(hdrContentType, contentTypeJSON)
@@ -288,6 +486,115 @@ func (api *APIv2) ServeNodeDelete(w http.ResponseWriter, r *http.Request) {
 	fmt.Fprintf(w, `{"result": "Successfully deleted %d nodes.", "count": %d}`+"\n", n, n)
 }
 
+// MergeDocument lists nodes that must be replaced with a single node.
+// Nodes are encoded the same way as values of quads in TxDocument.
+type MergeDocument struct {
+	Into  string   `json:"into"`
+	Nodes []string `json:"nodes"`
+}
+
+// ServeNodeMerge replaces nodes with a single node in all quads, in a single transaction.
+func (api *APIv2) ServeNodeMerge(w http.ResponseWriter, r *http.Request) {
+	defer r.Body.Close()
+	if api.ro {
+		jsonResponse(w, http.StatusForbidden, graph.ErrNotWritable)
+		return
+	}
+	var doc MergeDocument
+	if err := json.NewDecoder(r.Body).Decode(&doc); err != nil {
+		jsonResponse(w, http.StatusBadRequest, err)
+		return
+	} else if doc.Into == "" {
+		jsonResponse(w, http.StatusBadRequest, errors.New("no node to merge into"))
+		return
+	} else if len(doc.Nodes) > maxTxDeltas {
+		jsonResponse(w, http.StatusBadRequest, errors.New("too many nodes"))
+		return
+	}
+	m := graph.NodeMerge{Into: quad.StringToValue(doc.Into)}
+	for _, s := range doc.Nodes {
+		if s == "" {
+			jsonResponse(w, http.StatusBadRequest, errors.New("empty node value"))
+			return
+		}
+		m.Nodes = append(m.Nodes, quad.StringToValue(s))
+	}
+	h, err := api.handleForRequest(r)
+	if err != nil {
+		jsonResponse(w, http.StatusBadRequest, err)
+		return
+	}
+	n, err := graph.MergeNodes(r.Context(), h.QuadStore, h.QuadWriter, m)
+	if err != nil {
+		errorResponse(w, err)
+		return
+	}
+	w.Header().Set(hdrContentType, contentTypeJSON)
+	fmt.Fprintf(w, `{"result": "Successfully rewritten %d quads.", "count": %d}`+"\n", n, n)
+}
+
+// ServeQuadsDelete removes all quads matching a pattern from query parameters.
+// Missing parameters match any value, but at least one of them must be set, unless all=true is passed.
+func (api *APIv2) ServeQuadsDelete(w http.ResponseWriter, r *http.Request) {
+	if api.ro {
+		jsonResponse(w, http.StatusForbidden, graph.ErrNotWritable)
+		return
+	}
+	pattern := quadPattern(r)
+	if pattern == (quad.Quad{}) && r.FormValue("all") != "true" {
+		jsonResponse(w, http.StatusBadRequest, "quad pattern is empty; set all=true to delete all quads")
+		return
+	}
+	h, err := api.handleForRequest(r)
+	if err != nil {
+		jsonResponse(w, http.StatusBadRequest, err)
+		return
+	}
+	n, err := graph.RemoveMatching(h.QuadWriter, h.QuadStore, pattern)
+	if err != nil {
+		errorResponse(w, err)
+		return
+	}
+	w.Header().Set(hdrContentType, contentTypeJSON)
+	fmt.Fprintf(w, `{"result": "Successfully deleted %d quads.", "count": %d}`+"\n", n, n)
+}
+
+// quadPattern returns a quad pattern from subject, predicate, object and label query parameters.
+// Missing parameters are left nil.
+func quadPattern(r *http.Request) quad.Quad {
+	var pattern quad.Quad
+	for _, d := range quad.Directions {
+		pattern.Set(d, parseValue(r.FormValue(d.String())))
+	}
+	return pattern
+}
+
+// parseValue parses a value in the form returned by quad.Value.String, unescaping string literals.
+// Values in other forms are parsed with quad.StringToValue.
+func parseValue(s string) quad.Value {
+	if s == "" {
+		return nil
+	}
+	if v, err := nquads.UnmarshalValue([]byte(s)); err == nil && v != nil {
+		return v
+	}
+	return quad.StringToValue(s)
+}
+
+// limitReader stops reading after n quads.
+type limitReader struct {
+	quad.Reader
+	n int
+}
+
+func (r *limitReader) ReadQuad() (quad.Quad, error) {
+	if r.n <= 0 {
+		return quad.Quad{}, io.EOF
+	}
+	r.n--
+	return r.Reader.ReadQuad()
+}
+
 type checkWriter struct {
 	w       io.Writer
 	written bool
@@ -309,8 +616,20 @@ func (api *APIv2) ServeRead(w http.ResponseWriter, r *http.Request) {
 		jsonResponse(w, http.StatusBadRequest, err)
 		return
 	}
-	qr := graph.NewQuadStoreReader(h.QuadStore)
-	defer qr.Close()
+	limit := 0
+	if s := r.FormValue("limit"); s != "" {
+		limit, err = strconv.Atoi(s)
+		if err != nil {
+			jsonResponse(w, http.StatusBadRequest, fmt.Errorf("invalid limit: %v", err))
+			return
+		}
+	}
+	mr := graph.NewMatchingReader(h.QuadStore, quadPattern(r))
+	defer mr.Close()
+	var qr quad.Reader = mr
+	if limit > 0 {
+		qr = &limitReader{Reader: qr, n: limit}
+	}
 
 	wr := writerFrom(w, r, hdrAcceptEncoding)
 	defer wr.Close()
@@ -322,17 +641,51 @@ func (api *APIv2) ServeRead(w http.ResponseWriter, r *http.Request) {
 		w.Header().Set(hdrContentType, format.Mime[0])
 	}
 	if bw, ok := qw.(quad.BatchWriter); ok {
-		_, err = quad.CopyBatch(bw, qr, api.batch)
+		_, err = quad.CopyBatch(bw, qr, api.current().batch)
 	} else {
 		_, err = quad.Copy(qw, qr)
 	}
 	if err != nil && !cw.written {
-		jsonResponse(w, http.StatusInternalServerError, err)
+		errorResponse(w, err)
 		return
 	} else if err != nil {
 		// can do nothing here, since first byte (and header) was written
 		// TODO: check if client just gone away
-		clog.Errorf("read quads error: %v", err)
+		clog.Error(r.Context(), "read quads error", clog.F("error", err))
+	}
+}
+
+// ServeNodes streams all nodes of the database, one per line, in the form returned by quad.Value.String.
+func (api *APIv2) ServeNodes(w http.ResponseWriter, r *http.Request) {
+	h, err := api.handleForRequest(r)
+	if err != nil {
+		jsonResponse(w, http.StatusBadRequest, err)
+		return
+	}
+	limit := 0
+	if s := r.FormValue("limit"); s != "" {
+		limit, err = strconv.Atoi(s)
+		if err != nil {
+			jsonResponse(w, http.StatusBadRequest, fmt.Errorf("invalid limit: %v", err))
+			return
+		}
+	}
+	cw := &checkWriter{w: w}
+	bw := bufio.NewWriter(cw)
+	w.Header().Set(hdrContentType, contentTypeNodes)
+	it := h.QuadStore.NodesAllIterator()
+	defer it.Close()
+	err = graph.Iterate(r.Context(), it).Limit(limit).EachValue(h.QuadStore, func(v quad.Value) {
+		bw.WriteString(v.String())
+		bw.WriteByte('\n')
+	})
+	if err == nil {
+		err = bw.Flush()
+	}
+	if err != nil && !cw.written {
+		errorResponse(w, err)
+	} else if err != nil {
+		clog.Error(r.Context(), "read nodes error", clog.F("error", err))
 	}
 }
 
@@ -361,14 +714,59 @@ func (api *APIv2) ServeFormats(w http.ResponseWriter, r *http.Request) {
 	json.NewEncoder(w).Encode(out)
 }
 
-func (api *APIv2) queryContext(r *http.Request) (ctx context.Context, cancel func()) {
-	ctx = context.TODO() // TODO(dennwc): get from request
-	if api.timeout > 0 {
-		ctx, cancel = context.WithTimeout(ctx, api.timeout)
+// queryLimits returns query limits for the request. Request parameters can only lower server-wide limits.
+func (api *APIv2) queryLimits(r *http.Request) (timeout time.Duration, lim graph.Limits, err error) {
+	cur := api.current()
+	timeout = cur.timeout
+	lim = graph.Limits{MaxResults: cur.limit, MaxScanned: cur.scanned}
+	vals := r.URL.Query()
+	if s := vals.Get("timeout"); s != "" {
+		dt, err := time.ParseDuration(s)
+		if err != nil {
+			return 0, lim, fmt.Errorf("invalid timeout: %v", err)
+		}
+		if timeout <= 0 || (dt > 0 && dt < timeout) {
+			timeout = dt
+		}
+	}
+	if s := vals.Get("limit"); s != "" {
+		n, err := strconv.Atoi(s)
+		if err != nil {
+			return 0, lim, fmt.Errorf("invalid limit: %v", err)
+		}
+		lim = lim.Min(graph.Limits{MaxResults: n})
+	}
+	if s := vals.Get("max_scanned"); s != "" {
+		n, err := strconv.ParseInt(s, 10, 64)
+		if err != nil {
+			return 0, lim, fmt.Errorf("invalid max_scanned: %v", err)
+		}
+		lim = lim.Min(graph.Limits{MaxScanned: n})
+	}
+	return timeout, lim, nil
+}
+
+func (api *APIv2) queryContext(r *http.Request, timeout time.Duration, lim graph.Limits) (ctx context.Context, cancel func()) {
+	ctx = r.Context()
+	if timeout > 0 {
+		ctx, cancel = context.WithTimeout(ctx, timeout)
 	} else {
 		ctx, cancel = context.WithCancel(ctx)
 	}
-	return ctx, cancel
+	ctx = graph.WithParallelism(ctx, api.current().parallel)
+	return graph.WithLimits(ctx, lim), cancel
+}
+
+// QueryContext returns a context with the timeout and limits that API v2 applies to queries of the request.
+// It allows to limit queries of endpoints that are not a part of API v2. Cancel function must be called
+// when the query completes.
+func (api *APIv2) QueryContext(r *http.Request) (context.Context, func(), error) {
+	timeout, lim, err := api.queryLimits(r)
+	if err != nil {
+		return nil, nil, err
+	}
+	ctx, cancel := api.queryContext(r, timeout, lim)
+	return ctx, cancel, nil
 }
 
 func defaultErrorFunc(w query.ResponseWriter, err error) {
@@ -379,9 +777,12 @@ func defaultErrorFunc(w query.ResponseWriter, err error) {
 	w.Write([]byte("}\n"))
 }
 
-func writeResults(w io.Writer, r interface{}) {
+func writeResults(w io.Writer, r interface{}, truncated bool) {
 	w.Write([]byte(`{"result": `))
 	json.NewEncoder(w).Encode(r)
+	if truncated {
+		w.Write([]byte(`, "truncated": true`))
+	}
 	w.Write([]byte("}\n"))
 }
 
@@ -395,17 +796,72 @@ func readLimit(r io.Reader) ([]byte, error) {
 	return data, err
 }
 
+// queryStore returns a quad store for queries on the handle. Prefixed names are accepted in queries
+// if the server is set to return compact IRIs.
+func queryStore(h *graph.Handle, compact bool) graph.QuadStore {
+	if compact {
+		return shape.ExpandIRIs(h.QuadStore)
+	}
+	return h.QuadStore
+}
+
 func (api *APIv2) ServeQuery(w http.ResponseWriter, r *http.Request) {
-	ctx, cancel := api.queryContext(r)
+	timeout, lim, err := api.queryLimits(r)
+	if err != nil {
+		jsonResponse(w, http.StatusBadRequest, err)
+		return
+	}
+	ctx, cancel := api.queryContext(r, timeout, lim)
 	defer cancel()
 	vals := r.URL.Query()
+	cur := api.current()
+	compact := cur.compact
+	switch s := vals.Get("iris"); s {
+	case "":
+	case "full":
+		compact = false
+	case "compact":
+		compact = true
+	default:
+		jsonResponse(w, http.StatusBadRequest, fmt.Errorf("unsupported IRI format: %q", s))
+		return
+	}
+	if compact {
+		ctx = query.WithCompactIRIs(ctx)
+	}
+	typed := cur.typed
+	switch s := vals.Get("values"); s {
+	case "":
+	case "native":
+		typed = false
+	case "typed":
+		typed = true
+	default:
+		jsonResponse(w, http.StatusBadRequest, fmt.Errorf("unsupported value format: %q", s))
+		return
+	}
+	if typed {
+		ctx = query.WithTypedValues(ctx)
+	}
+	rf, err := getResultFormat(r)
+	if err != nil {
+		jsonResponse(w, http.StatusBadRequest, err)
+		return
+	}
 	lang := vals.Get("lang")
+	var l *query.Language
+	if lang != "" {
+		l = query.GetLanguage(lang)
+	} else if typ, _, err := mime.ParseMediaType(r.Header.Get(hdrContentType)); err == nil {
+		// select the language by the type of the query document
+		if l = query.GetLanguageByType(typ); l != nil {
+			lang = l.Name
+		}
+	}
 	if lang == "" {
 		jsonResponse(w, http.StatusBadRequest, "query language not specified")
 		return
-	}
-	l := query.GetLanguage(lang)
-	if l == nil {
+	} else if l == nil {
 		jsonResponse(w, http.StatusBadRequest, "unknown query language")
 		return
 	}
@@ -424,16 +880,30 @@ func (api *APIv2) ServeQuery(w http.ResponseWriter, r *http.Request) {
 		errFunc(w, err)
 		return
 	}
+	qs := queryStore(h, cur.compact)
+	rec := audit.RecordFrom(ctx)
 	if l.HTTPQuery != nil {
 		defer r.Body.Close()
-		l.HTTPQuery(ctx, h.QuadStore, w, r.Body)
+		if rec == nil {
+			l.HTTPQuery(ctx, qs, w, r.Body)
+			return
+		}
+		buf := bytes.NewBuffer(nil)
+		l.HTTPQuery(ctx, qs, w, io.TeeReader(r.Body, buf))
+		rec.SetQuery(lang, buf.String())
 		return
 	}
 	if l.HTTP == nil {
 		errFunc(w, errors.New("HTTP interface is not supported for this query language"))
 		return
 	}
-	ses := l.HTTP(h.QuadStore)
+	ses := l.HTTP(qs)
+	// writes are only allowed on POST, thus links and embedded resources cannot modify the graph
+	sw, writable := ses.(query.Writer)
+	writable = writable && !api.ro && r.Method == "POST"
+	if writable {
+		sw.SetWriter(h.QuadWriter)
+	}
 	var qu string
 	if r.Method == "GET" {
 		qu = vals.Get("qu")
@@ -450,13 +920,44 @@ func (api *APIv2) ServeQuery(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 	if clog.V(1) {
-		clog.Infof("query: %s: %q", lang, qu)
+		clog.Info(ctx, "query", clog.F("lang", lang), clog.F("query", qu))
+	}
+	ctx = graph.WithQueryInfo(ctx, lang, qu)
+	if rec != nil {
+		rec.SetQuery(lang, qu)
+	}
+
+	var (
+		cacheKey string
+		horizon  int64
+	)
+	vs, cacheable := graph.AsVersioned(h.QuadStore)
+	// quad stores created for each request may return different results for different users
+	cacheable = cacheable && cur.cache != nil && rf == nil && h.QuadStore == api.h.QuadStore
+	// queries of writable sessions may have side effects, thus they are always executed
+	cacheable = cacheable && !writable
+	if cacheable {
+		horizon = vs.Horizon()
+		cacheKey = queryCacheKey(lang, qu, lim, compact, typed)
+		if data, ok := cur.cache.Get(horizon, cacheKey); ok {
+			w.Header().Set(hdrCache, "hit")
+			w.Write(data)
+			return
+		}
 	}
 
 	c := make(chan query.Result, 5)
-	go ses.Execute(ctx, qu, c, api.limit)
+	go ses.Execute(ctx, qu, c, executeLimit(lim.MaxResults))
+	results := limitResults(ctx, c, lim.MaxResults)
+	if rec != nil {
+		results = countResults(ctx, rec, results)
+	}
 
-	for res := range c {
+	if rf != nil {
+		streamResults(ctx, w, rf, ses, results, compact, errFunc)
+		return
+	}
+	for res := range results {
 		if err := res.Err(); err != nil {
 			if err == nil {
 				continue // wait for results channel to close
@@ -471,5 +972,15 @@ func (api *APIv2) ServeQuery(w http.ResponseWriter, r *http.Request) {
 		errFunc(w, err)
 		return
 	}
-	writeResults(w, output)
+	if compact {
+		output = query.CompactResult(output)
+	}
+	if !cacheable {
+		writeResults(w, output, graph.Truncated(ctx))
+		return
+	}
+	buf := bytes.NewBuffer(nil)
+	writeResults(buf, output, graph.Truncated(ctx))
+	cur.cache.Put(horizon, cacheKey, buf.Bytes())
+	w.Write(buf.Bytes())
 }
@@ -0,0 +1,138 @@
+// Copyright 2017 The Cayley Authors. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cayleyhttp
+
+import (
+	"crypto/subtle"
+	"errors"
+	"fmt"
+	"net/http"
+
+	"github.com/cayleygraph/cayley/graph"
+	"github.com/cayleygraph/cayley/graph/acl"
+)
+
+// HeaderRole is a default header used to pass the role of the user from an authenticating proxy.
+const HeaderRole = "X-Cayley-Role"
+
+// accessPolicies maps roles of users to access policies.
+type accessPolicies struct {
+	header string
+	roles  map[string]*acl.Policy
+	def    string
+}
+
+// SetAccessPolicies enables role-based access policies (see acl.Policy). Quads denied by the policy of the role
+// are hidden from all queries and reads, and cannot be written.
+//
+// The role is taken from a given request header (HeaderRole if empty), which must be set by a trusted proxy
+// that authenticates users. Requests without the header use the default role, and requests with an unknown
+// role are rejected. Policies are disabled if no roles are defined.
+func (api *APIv2) SetAccessPolicies(header string, roles map[string]*acl.Policy, def string) {
+	api.mu.Lock()
+	defer api.mu.Unlock()
+	if len(roles) == 0 {
+		api.set.acl = nil
+		return
+	}
+	if header == "" {
+		header = HeaderRole
+	}
+	api.set.acl = &accessPolicies{header: header, roles: roles, def: def}
+}
+
+// policyForRequest returns the access policy for the role of the user. It returns false if policies are disabled.
+func (api *APIv2) policyForRequest(r *http.Request) (*acl.Policy, bool, error) {
+	a := api.current().acl
+	if a == nil {
+		return nil, false, nil
+	}
+	role := r.Header.Get(a.header)
+	if role == "" {
+		role = a.def
+	}
+	p, ok := a.roles[role]
+	if !ok {
+		return nil, true, fmt.Errorf("access denied for role %q", role)
+	}
+	return p, true, nil
+}
+
+// errAdminDisabled is returned by administrative endpoints if neither an admin token nor access policies are set.
+var errAdminDisabled = errors.New("administrative endpoints are disabled; set an admin token or access roles")
+
+// SetAdminToken sets a secret token that grants access to administrative endpoints. Requests must pass it in
+// the "Authorization: Bearer <token>" header. Empty token disables the token access.
+func (api *APIv2) SetAdminToken(token string) {
+	api.mu.Lock()
+	api.set.adminToken = token
+	api.mu.Unlock()
+}
+
+// isAdmin checks if the request is allowed to use administrative endpoints. Requests must either pass the admin
+// token, or have a role with access to these endpoints (see acl.Policy). If neither the token nor access
+// policies are set, administrative endpoints are disabled.
+func (api *APIv2) isAdmin(r *http.Request) error {
+	cur := api.current()
+	if cur.adminToken != "" {
+		auth := r.Header.Get("Authorization")
+		if subtle.ConstantTimeCompare([]byte(auth), []byte("Bearer "+cur.adminToken)) == 1 {
+			return nil
+		}
+	}
+	p, ok, err := api.policyForRequest(r)
+	if err != nil {
+		return err
+	} else if !ok {
+		if cur.adminToken != "" {
+			return acl.ErrAccessDenied
+		}
+		return errAdminDisabled
+	} else if !p.Admin {
+		return acl.ErrAccessDenied
+	}
+	return nil
+}
+
+// adminOnly rejects requests that have no access to administrative endpoints. See isAdmin.
+func (api *APIv2) adminOnly(h http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if err := api.isAdmin(r); err != nil {
+			jsonResponse(w, http.StatusForbidden, err)
+			return
+		}
+		h(w, r)
+	}
+}
+
+// HandleFor returns a handle for the request, as used by all API v2 endpoints. It takes sessions and access
+// policies into account.
+func (api *APIv2) HandleFor(r *http.Request) (*graph.Handle, error) {
+	return api.handleForRequest(r)
+}
+
+// secureHandle wraps the handle to enforce the access policy of the request.
+func (api *APIv2) secureHandle(r *http.Request, h *graph.Handle) (*graph.Handle, error) {
+	p, ok, err := api.policyForRequest(r)
+	if err != nil || !ok {
+		return h, err
+	}
+	qs := acl.Wrap(h.QuadStore, p)
+	qw, err := graph.NewQuadWriter(api.wtyp, qs, api.wopt)
+	if err != nil {
+		return nil, err
+	}
+	return &graph.Handle{QuadStore: qs, QuadWriter: qw}, nil
+}
@@ -0,0 +1,124 @@
+// Copyright 2017 The Cayley Authors. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cayleyhttp
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+
+	"github.com/cayleygraph/cayley/clog"
+	"github.com/cayleygraph/cayley/graph"
+)
+
+// ConfigInfo describes the current configuration of the API.
+type ConfigInfo struct {
+	ReadOnly bool   `json:"read_only"`
+	Backend  string `json:"backend,omitempty"`
+	Batch    int    `json:"batch"`
+
+	Timeout     string `json:"timeout"`
+	MaxResults  int    `json:"max_results"`
+	MaxScanned  int64  `json:"max_scanned"`
+	CompactIRIs bool   `json:"compact_iris"`
+	TypedValues bool   `json:"typed_values"`
+	Parallelism int    `json:"parallelism"`
+
+	CacheSize int    `json:"cache_size"`
+	CacheTTL  string `json:"cache_ttl"`
+
+	IdempotencySize int    `json:"idempotency_size"`
+	IdempotencyTTL  string `json:"idempotency_ttl"`
+
+	SlowQuery     string  `json:"slow_query"`
+	SlowQueryPlan float64 `json:"slow_query_plan"`
+
+	Verbosity int `json:"verbosity"`
+}
+
+// Config returns the current configuration of the API.
+func (api *APIv2) Config() ConfigInfo {
+	cur := api.current()
+	slow := graph.CurrentSlowLog()
+	c := ConfigInfo{
+		ReadOnly:      api.ro,
+		Backend:       api.backend,
+		Batch:         cur.batch,
+		Timeout:       cur.timeout.String(),
+		MaxResults:    cur.limit,
+		MaxScanned:    cur.scanned,
+		CompactIRIs:   cur.compact,
+		TypedValues:   cur.typed,
+		Parallelism:   cur.parallel,
+		CacheTTL:      "0s",
+		SlowQuery:     slow.Threshold.String(),
+		SlowQueryPlan: slow.PlanRate,
+	}
+	if cur.cache != nil {
+		c.CacheSize, c.CacheTTL = cur.cache.size, cur.cache.ttl.String()
+	}
+	c.IdempotencyTTL = "0s"
+	if cur.idem != nil {
+		c.IdempotencySize, c.IdempotencyTTL = cur.idem.size, cur.idem.ttl.String()
+	}
+	for c.Verbosity < 10 && clog.V(c.Verbosity+1) {
+		c.Verbosity++
+	}
+	return c
+}
+
+// SetReloadFunc sets a function that reloads the configuration of the server.
+// It is expected to apply new settings with the setters of the API.
+func (api *APIv2) SetReloadFunc(fnc func() error) {
+	api.mu.Lock()
+	api.reload = fnc
+	api.mu.Unlock()
+}
+
+// errReloadNotSupported is returned when the server was started without a reload function.
+var errReloadNotSupported = errors.New("configuration reload is not supported")
+
+// Reload reloads the configuration of the server without restarting it.
+// Concurrent calls are serialized, thus the reload function is never called concurrently.
+func (api *APIv2) Reload() error {
+	api.reloadMu.Lock()
+	defer api.reloadMu.Unlock()
+	api.mu.RLock()
+	fnc := api.reload
+	api.mu.RUnlock()
+	if fnc == nil {
+		return errReloadNotSupported
+	}
+	return fnc()
+}
+
+// ServeConfig returns the current configuration of the server.
+func (api *APIv2) ServeConfig(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set(hdrContentType, contentTypeJSON)
+	json.NewEncoder(w).Encode(api.Config())
+}
+
+// ServeReload reloads the configuration of the server and returns the new one.
+func (api *APIv2) ServeReload(w http.ResponseWriter, r *http.Request) {
+	if err := api.Reload(); err == errReloadNotSupported {
+		jsonResponse(w, http.StatusNotImplemented, err)
+		return
+	} else if err != nil {
+		jsonResponse(w, http.StatusInternalServerError, err)
+		return
+	}
+	clog.Infof("configuration reloaded")
+	api.ServeConfig(w, r)
+}
@@ -0,0 +1,182 @@
+// Copyright 2017 The Cayley Authors. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cayleyhttp
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+
+	"github.com/julienschmidt/httprouter"
+
+	"github.com/cayleygraph/cayley/clog"
+	"github.com/cayleygraph/cayley/graph"
+	"github.com/cayleygraph/cayley/graph/audit"
+	"github.com/cayleygraph/cayley/query"
+)
+
+// HeaderPrincipal is a default header used to pass the name of the user from an authenticating proxy.
+const HeaderPrincipal = "X-Cayley-User"
+
+type auditLog struct {
+	sink   audit.Sink
+	header string
+}
+
+// SetAuditLog enables the audit log of queries and writes. The name of the user is taken from a given request
+// header (HeaderPrincipal if empty), which must be set by a trusted proxy. Audit log is disabled if sink is nil.
+//
+// Events are written to the sink in the request path, thus slow sinks should be wrapped with audit.NewAsync.
+// The sink is not closed by the API.
+func (api *APIv2) SetAuditLog(sink audit.Sink, header string) {
+	api.mu.Lock()
+	defer api.mu.Unlock()
+	if sink == nil {
+		api.set.audit = nil
+		return
+	}
+	if header == "" {
+		header = HeaderPrincipal
+	}
+	api.set.audit = &auditLog{sink: sink, header: header}
+}
+
+// statusWriter remembers the status code of the response.
+type statusWriter struct {
+	http.ResponseWriter
+	code int
+}
+
+func (w *statusWriter) WriteHeader(code int) {
+	if w.code == 0 {
+		w.code = code
+	}
+	w.ResponseWriter.WriteHeader(code)
+}
+
+func (w *statusWriter) Write(p []byte) (int, error) {
+	if w.code == 0 {
+		w.code = http.StatusOK
+	}
+	return w.ResponseWriter.Write(p)
+}
+
+func (w *statusWriter) Flush() {
+	if f, ok := w.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+// serveAudited runs the handler and writes an audit event for a given operation, if the audit log is enabled.
+// Empty operation means that the event is only written if the handler runs a query or applies any changes.
+func (api *APIv2) serveAudited(op string, w http.ResponseWriter, r *http.Request, h func(w http.ResponseWriter, r *http.Request)) {
+	a := api.current().audit
+	if a == nil {
+		h(w, r)
+		return
+	}
+	ctx := r.Context()
+	rec := audit.NewRecord(op, r.Header.Get(a.header))
+	rec.SetRequestID(clog.RequestID(ctx))
+	sw := &statusWriter{ResponseWriter: w}
+	h(sw, r.WithContext(audit.WithRecord(ctx, rec)))
+	var err error
+	if sw.code >= 400 {
+		err = fmt.Errorf("request failed: %d %s", sw.code, http.StatusText(sw.code))
+	}
+	e := rec.Finish(err)
+	if e == nil {
+		return
+	}
+	if err = a.sink.Write(ctx, e); err != nil {
+		clog.Error(ctx, "failed to write audit event", clog.F("error", err))
+	}
+}
+
+// audited wraps a handler to write an audit event for each request.
+func (api *APIv2) audited(op string, h http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		api.serveAudited(op, w, r, h)
+	}
+}
+
+// Audit returns a handler wrapper that writes an audit event for each request with a given operation,
+// using the audit log of the API. It allows to audit endpoints that are not a part of API v2.
+func (api *APIv2) Audit(op string) HandlerWrapper {
+	return func(h httprouter.Handle) httprouter.Handle {
+		return func(w http.ResponseWriter, r *http.Request, params httprouter.Params) {
+			api.serveAudited(op, w, r, func(w http.ResponseWriter, r *http.Request) {
+				h(w, r, params)
+			})
+		}
+	}
+}
+
+// auditHandle wraps the writer of the handle to record applied changes, if the request is audited.
+func (api *APIv2) auditHandle(r *http.Request, h *graph.Handle) (*graph.Handle, error) {
+	rec := audit.RecordFrom(r.Context())
+	if rec == nil {
+		return h, nil
+	}
+	qs := graph.WithWriterMiddleware(h.QuadStore, rec.ObserveDeltas())
+	if vs, ok := graph.AsVersioned(h.QuadStore); ok {
+		// keep conditional transactions working
+		qs = &versionedStore{QuadStore: qs, vs: vs, rec: rec}
+	}
+	qw, err := graph.NewQuadWriter(api.wtyp, qs, api.wopt)
+	if err != nil {
+		return nil, err
+	}
+	// queries use the original store
+	return &graph.Handle{QuadStore: h.QuadStore, QuadWriter: qw}, nil
+}
+
+// versionedStore records changes applied with ApplyDeltasSince.
+type versionedStore struct {
+	graph.QuadStore
+	vs  graph.Versioned
+	rec *audit.Record
+}
+
+func (qs *versionedStore) Horizon() int64 {
+	return qs.vs.Horizon()
+}
+
+func (qs *versionedStore) ApplyDeltasSince(in []graph.Delta, opts graph.IgnoreOpts, horizon int64) error {
+	if err := qs.vs.ApplyDeltasSince(in, opts, horizon); err != nil {
+		return err
+	}
+	qs.rec.AddDeltas(in)
+	return nil
+}
+
+// countResults passes query results through and counts them in the audit record.
+func countResults(ctx context.Context, rec *audit.Record, in <-chan query.Result) <-chan query.Result {
+	out := make(chan query.Result, cap(in))
+	go func() {
+		defer close(out)
+		for res := range in {
+			if res.Err() == nil {
+				rec.AddResults(1)
+			}
+			select {
+			case out <- res:
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+	return out
+}
@@ -0,0 +1,226 @@
+// Copyright 2017 The Cayley Authors. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cayleyhttp
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+
+	"github.com/cayleygraph/cayley/graph"
+	"github.com/cayleygraph/cayley/quad"
+)
+
+// BatchOp is a single change in a batch.
+type BatchOp struct {
+	// Action is either "add" or "remove".
+	Action string    `json:"action"`
+	Quad   quad.Quad `json:"quad"`
+}
+
+// BatchDocument is a list of changes that are applied independently of each other.
+type BatchDocument struct {
+	Ops []BatchOp `json:"ops"`
+}
+
+// Statuses of changes in a batch.
+const (
+	BatchApplied   = "applied"   // change was applied
+	BatchDuplicate = "duplicate" // quad to add already exists
+	BatchNotExist  = "not_exist" // quad to remove does not exist
+	BatchError     = "error"     // change is invalid or failed
+)
+
+// BatchOpResult is a result of a single change in a batch.
+type BatchOpResult struct {
+	Status string `json:"status"`
+	Error  string `json:"error,omitempty"`
+}
+
+// BatchResult is a response for a batch. Results are listed in the same order as changes.
+type BatchResult struct {
+	Applied int             `json:"applied"` // number of applied changes
+	Failed  int             `json:"failed"`  // number of changes that were not applied for any reason
+	Results []BatchOpResult `json:"results"`
+}
+
+func batchAction(s string) (graph.Procedure, error) {
+	switch s {
+	case "add":
+		return graph.Add, nil
+	case "remove", "delete":
+		return graph.Delete, nil
+	}
+	return 0, fmt.Errorf("unknown action: %q", s)
+}
+
+// batchState tracks existence of quads in the store while the batch is validated.
+type batchState struct {
+	ctx context.Context
+	qs  graph.QuadStore
+	has map[string]bool
+}
+
+func (s *batchState) exists(q quad.Quad) (bool, error) {
+	key := q.String()
+	if v, ok := s.has[key]; ok {
+		return v, nil
+	}
+	ref, err := graph.ValueOf(s.ctx, s.qs, q.Subject)
+	if err != nil {
+		return false, err
+	}
+	v := false
+	if ref != nil {
+		it := s.qs.QuadIterator(quad.Subject, ref)
+		for it.Next(s.ctx) {
+			var sq quad.Quad
+			if sq, err = graph.QuadOf(s.ctx, s.qs, it.Result()); err != nil {
+				break
+			} else if sq.String() == key {
+				v = true
+				break
+			}
+		}
+		if err == nil {
+			err = it.Err()
+		}
+		it.Close()
+		if err != nil {
+			return false, err
+		}
+	}
+	s.has[key] = v
+	return v, nil
+}
+
+// applyBatch applies all valid changes from the batch and fills the results.
+//
+// Changes are checked against the store first, and are applied in a single transaction.
+// If the transaction fails because the store was changed concurrently, the failed change
+// is excluded and the rest is applied again.
+func applyBatch(ctx context.Context, h *graph.Handle, ops []BatchOp, res []BatchOpResult) {
+	type pending struct {
+		i int
+		d graph.Delta
+	}
+	st := &batchState{ctx: ctx, qs: h.QuadStore, has: make(map[string]bool)}
+	var list []pending
+	for i, op := range ops {
+		act, err := batchAction(op.Action)
+		if err != nil {
+			res[i] = BatchOpResult{Status: BatchError, Error: err.Error()}
+			continue
+		} else if !op.Quad.IsValid() {
+			res[i] = BatchOpResult{Status: BatchError, Error: fmt.Sprintf("invalid quad: %v", op.Quad)}
+			continue
+		}
+		has, err := st.exists(op.Quad)
+		if err != nil {
+			res[i] = BatchOpResult{Status: BatchError, Error: err.Error()}
+			continue
+		}
+		if act == graph.Add && has {
+			res[i] = BatchOpResult{Status: BatchDuplicate}
+			continue
+		} else if act == graph.Delete && !has {
+			res[i] = BatchOpResult{Status: BatchNotExist}
+			continue
+		}
+		st.has[op.Quad.String()] = act == graph.Add
+		list = append(list, pending{i: i, d: graph.Delta{Action: act, Quad: op.Quad}})
+	}
+	for len(list) != 0 {
+		tx := graph.NewTransaction()
+		for _, p := range list {
+			if p.d.Action == graph.Add {
+				tx.AddQuad(p.d.Quad)
+			} else {
+				tx.RemoveQuad(p.d.Quad)
+			}
+		}
+		err := h.ApplyTransaction(tx)
+		if err == nil {
+			for _, p := range list {
+				res[p.i] = BatchOpResult{Status: BatchApplied}
+			}
+			return
+		}
+		de, ok := err.(*graph.DeltaError)
+		failed := -1
+		if ok {
+			for j, p := range list {
+				if p.d.Action == de.Delta.Action && p.d.Quad.String() == de.Delta.Quad.String() {
+					failed = j
+					break
+				}
+			}
+		}
+		if failed < 0 {
+			// not related to a specific change
+			for _, p := range list {
+				res[p.i] = BatchOpResult{Status: BatchError, Error: err.Error()}
+			}
+			return
+		}
+		p := list[failed]
+		switch {
+		case graph.IsQuadExist(err):
+			res[p.i] = BatchOpResult{Status: BatchDuplicate}
+		case graph.IsQuadNotExist(err):
+			res[p.i] = BatchOpResult{Status: BatchNotExist}
+		default:
+			res[p.i] = BatchOpResult{Status: BatchError, Error: de.Err.Error()}
+		}
+		list = append(list[:failed], list[failed+1:]...)
+	}
+}
+
+// ServeBatch applies a batch of changes, reporting the result of each change separately.
+//
+// Unlike ServeTx, invalid changes, duplicate quads and missing quads do not fail the whole request.
+func (api *APIv2) ServeBatch(w http.ResponseWriter, r *http.Request) {
+	defer r.Body.Close()
+	if api.ro {
+		jsonResponse(w, http.StatusForbidden, graph.ErrNotWritable)
+		return
+	}
+	var doc BatchDocument
+	if err := json.NewDecoder(r.Body).Decode(&doc); err != nil {
+		jsonResponse(w, http.StatusBadRequest, err)
+		return
+	} else if len(doc.Ops) > maxTxDeltas {
+		jsonResponse(w, http.StatusBadRequest, errors.New("batch is too large"))
+		return
+	}
+	h, err := api.handleForRequest(r)
+	if err != nil {
+		jsonResponse(w, http.StatusBadRequest, err)
+		return
+	}
+	out := BatchResult{Results: make([]BatchOpResult, len(doc.Ops))}
+	applyBatch(r.Context(), h, doc.Ops, out.Results)
+	for _, res := range out.Results {
+		if res.Status == BatchApplied {
+			out.Applied++
+		} else {
+			out.Failed++
+		}
+	}
+	w.Header().Set(hdrContentType, contentTypeJSON)
+	json.NewEncoder(w).Encode(out)
+}
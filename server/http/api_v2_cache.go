@@ -0,0 +1,87 @@
+// Copyright 2017 The Cayley Authors. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cayleyhttp
+
+import (
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/cayleygraph/cayley/graph"
+	"github.com/cayleygraph/cayley/internal/lru"
+)
+
+// hdrCache is a response header that is set to "hit" if query results were served from the cache.
+const hdrCache = "X-Cache"
+
+// queryCache stores serialized query results for the current horizon of the database.
+//
+// Any write advances the horizon, thus all cached results are dropped on the first lookup after it.
+type queryCache struct {
+	size int
+	ttl  time.Duration
+
+	mu      sync.Mutex
+	horizon int64
+	lru     *lru.Cache
+}
+
+type cachedResult struct {
+	data    []byte
+	created time.Time
+}
+
+func newQueryCache(size int, ttl time.Duration) *queryCache {
+	return &queryCache{size: size, ttl: ttl, lru: lru.New(size)}
+}
+
+// queryCacheKey returns a cache key for a query with given parameters.
+func queryCacheKey(lang, qu string, lim graph.Limits, compact, typed bool) string {
+	return fmt.Sprintf("%s\x00%d\x00%d\x00%v\x00%v\x00%s", lang, lim.MaxResults, lim.MaxScanned, compact, typed, qu)
+}
+
+// Get returns cached results for a given horizon.
+func (c *queryCache) Get(horizon int64, key string) ([]byte, bool) {
+	c.mu.Lock()
+	if horizon != c.horizon {
+		c.horizon = horizon
+		c.lru = lru.New(c.size)
+	}
+	cl := c.lru
+	c.mu.Unlock()
+	v, ok := cl.Get(key)
+	if !ok {
+		return nil, false
+	}
+	r := v.(cachedResult)
+	if c.ttl > 0 && time.Since(r.created) > c.ttl {
+		cl.Del(key)
+		return nil, false
+	}
+	return r.data, true
+}
+
+// Put stores query results for a given horizon. Horizon must be read before executing the query.
+// Results are not cached if the horizon has changed since then.
+func (c *queryCache) Put(horizon int64, key string, data []byte) {
+	c.mu.Lock()
+	if horizon != c.horizon {
+		c.mu.Unlock()
+		return
+	}
+	cl := c.lru
+	c.mu.Unlock()
+	cl.Put(key, cachedResult{data: data, created: time.Now()})
+}
@@ -0,0 +1,531 @@
+// Copyright 2017 The Cayley Authors. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cayleyhttp
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/cayleygraph/cayley/graph"
+	"github.com/cayleygraph/cayley/graph/audit"
+	"github.com/cayleygraph/cayley/graph/iterator"
+	"github.com/cayleygraph/cayley/quad"
+	"github.com/cayleygraph/cayley/query"
+)
+
+const (
+	defaultGraphLang  = "gizmo"
+	defaultGraphNodes = 500
+	defaultGraphEdges = 2000
+	// maxGraphNodes and maxGraphEdges limit the size of the graph document; requests can only lower them
+	maxGraphNodes = 10000
+	maxGraphEdges = 50000
+)
+
+// graphNode is a node of the graph document. Attributes are selected with the attrs parameter.
+type graphNode struct {
+	ID    string
+	Label string
+	Attrs map[string]interface{}
+}
+
+// graphEdge is a quad that links two nodes of the graph document.
+type graphEdge struct {
+	ID     string
+	Source string
+	Target string
+	Label  string
+	Graph  string // label of the quad
+}
+
+// graphFormat converts nodes and edges into a JSON document expected by a specific visualization library.
+type graphFormat func(nodes []graphNode, edges []graphEdge, truncated bool) interface{}
+
+var graphFormats = map[string]graphFormat{
+	"d3":        d3Graph,
+	"cytoscape": cytoscapeGraph,
+	"vis":       visGraph,
+}
+
+func (n graphNode) fields() map[string]interface{} {
+	m := make(map[string]interface{}, len(n.Attrs)+2)
+	for k, v := range n.Attrs {
+		m[k] = v
+	}
+	m["id"], m["label"] = n.ID, n.Label
+	return m
+}
+
+func (e graphEdge) fields(src, dst string) map[string]interface{} {
+	m := map[string]interface{}{
+		"id": e.ID, src: e.Source, dst: e.Target, "label": e.Label,
+	}
+	if e.Graph != "" {
+		m["graph"] = e.Graph
+	}
+	return m
+}
+
+// d3Graph returns a document for d3-force: {"nodes": [{"id": ...}], "links": [{"source": ..., "target": ...}]}.
+func d3Graph(nodes []graphNode, edges []graphEdge, truncated bool) interface{} {
+	out := map[string]interface{}{}
+	ns := make([]interface{}, 0, len(nodes))
+	for _, n := range nodes {
+		ns = append(ns, n.fields())
+	}
+	es := make([]interface{}, 0, len(edges))
+	for _, e := range edges {
+		es = append(es, e.fields("source", "target"))
+	}
+	out["nodes"], out["links"] = ns, es
+	if truncated {
+		out["truncated"] = true
+	}
+	return out
+}
+
+// cytoscapeGraph returns a document for cytoscape.js: {"elements": {"nodes": [{"data": ...}], "edges": [{"data": ...}]}}.
+func cytoscapeGraph(nodes []graphNode, edges []graphEdge, truncated bool) interface{} {
+	type element struct {
+		Data map[string]interface{} `json:"data"`
+	}
+	ns := make([]element, 0, len(nodes))
+	for _, n := range nodes {
+		ns = append(ns, element{Data: n.fields()})
+	}
+	es := make([]element, 0, len(edges))
+	for _, e := range edges {
+		es = append(es, element{Data: e.fields("source", "target")})
+	}
+	out := map[string]interface{}{
+		"elements": map[string]interface{}{"nodes": ns, "edges": es},
+	}
+	if truncated {
+		out["truncated"] = true
+	}
+	return out
+}
+
+// visGraph returns a document for vis.js: {"nodes": [{"id": ...}], "edges": [{"from": ..., "to": ...}]}.
+func visGraph(nodes []graphNode, edges []graphEdge, truncated bool) interface{} {
+	out := d3Graph(nodes, edges, truncated).(map[string]interface{})
+	es := make([]interface{}, 0, len(edges))
+	for _, e := range edges {
+		es = append(es, e.fields("from", "to"))
+	}
+	delete(out, "links")
+	out["edges"] = es
+	return out
+}
+
+// graphBuilder collects nodes from query results and links them with quads of the store.
+type graphBuilder struct {
+	qs       graph.QuadStore
+	compact  bool
+	maxNodes int
+	maxEdges int
+	preds    map[quad.Value]struct{} // predicates used as edges; all if empty
+	attrs    map[quad.Value]string   // predicates used as node attributes
+
+	refs      []graph.Value
+	index     map[interface{}]int
+	nodes     []graphNode
+	edges     []graphEdge
+	truncated bool
+}
+
+func (b *graphBuilder) label(v quad.Value) string {
+	switch v := v.(type) {
+	case nil:
+		return ""
+	case quad.IRI:
+		if b.compact {
+			v = v.Short()
+		}
+		return string(v)
+	case quad.BNode:
+		return v.String()
+	}
+	return fmt.Sprint(v.Native())
+}
+
+func (b *graphBuilder) nameOf(ctx context.Context, ref graph.Value) (quad.Value, error) {
+	if ref == nil {
+		return nil, nil
+	}
+	return graph.NameOf(ctx, b.qs, ref)
+}
+
+func (b *graphBuilder) attr(v quad.Value) interface{} {
+	switch v.(type) {
+	case quad.IRI, quad.BNode:
+		return b.label(v)
+	}
+	return v.Native()
+}
+
+// addNode adds a node to the graph. It returns false if the graph has reached the size limit.
+func (b *graphBuilder) addNode(ctx context.Context, ref graph.Value) (bool, error) {
+	if ref == nil {
+		return true, nil
+	}
+	k := graph.ToKey(ref)
+	if _, ok := b.index[k]; ok {
+		return true, nil
+	}
+	if len(b.nodes) >= b.maxNodes {
+		b.truncated = true
+		return false, nil
+	}
+	v, err := b.nameOf(ctx, ref)
+	if err != nil || v == nil {
+		return err == nil, err
+	}
+	id := quad.StringOf(v)
+	if b.compact {
+		if iri, ok := v.(quad.IRI); ok {
+			id = quad.StringOf(iri.Short())
+		}
+	}
+	b.index[k] = len(b.nodes)
+	b.refs = append(b.refs, ref)
+	b.nodes = append(b.nodes, graphNode{ID: id, Label: b.label(v)})
+	return true, nil
+}
+
+// addResult adds all nodes of a single query result. It returns false if the graph has reached the size limit.
+func (b *graphBuilder) addResult(ctx context.Context, r interface{}) (bool, error) {
+	switch r := r.(type) {
+	case map[string]graph.Value:
+		keys := make([]string, 0, len(r))
+		for k := range r {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+		for _, k := range keys {
+			if ok, err := b.addNode(ctx, r[k]); !ok || err != nil {
+				return ok, err
+			}
+		}
+	case graph.Value:
+		return b.addNode(ctx, r)
+	}
+	return true, nil
+}
+
+// setAttr loads an attribute of the node from the object of a quad, unless the attribute is already set.
+func (b *graphBuilder) setAttr(ctx context.Context, i int, name string, q graph.Value) error {
+	n := &b.nodes[i]
+	if _, ok := n.Attrs[name]; ok {
+		return nil
+	}
+	v, err := b.nameOf(ctx, b.qs.QuadDirection(q, quad.Object))
+	if err != nil {
+		return err
+	}
+	if n.Attrs == nil {
+		n.Attrs = make(map[string]interface{})
+	}
+	n.Attrs[name] = b.attr(v)
+	return nil
+}
+
+// loadAttrs loads attributes of the node by looking up only quads with attribute predicates.
+func (b *graphBuilder) loadAttrs(ctx context.Context, i int) error {
+	for p, name := range b.attrs {
+		if _, ok := b.nodes[i].Attrs[name]; ok {
+			continue
+		}
+		pref, err := graph.ValueOf(ctx, b.qs, p)
+		if err != nil {
+			return err
+		} else if pref == nil {
+			continue
+		}
+		var it graph.Iterator = iterator.NewAnd(b.qs,
+			b.qs.QuadIterator(quad.Subject, b.refs[i]),
+			b.qs.QuadIterator(quad.Predicate, pref),
+		)
+		it, _ = it.Optimize()
+		if it.Next(ctx) {
+			err = b.setAttr(ctx, i, name, it.Result())
+		}
+		if err == nil {
+			err = it.Err()
+		}
+		it.Close()
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// link adds edges between collected nodes and loads node attributes.
+func (b *graphBuilder) link(ctx context.Context) error {
+	full := false // edge limit is reached
+	for i, ref := range b.refs {
+		if full {
+			// quads of remaining nodes are not scanned; only attributes are loaded
+			if len(b.attrs) == 0 {
+				break
+			} else if err := b.loadAttrs(ctx, i); err != nil {
+				return err
+			}
+			continue
+		}
+		it := b.qs.QuadIterator(quad.Subject, ref)
+		for it.Next(ctx) {
+			q := it.Result()
+			p, err := b.nameOf(ctx, b.qs.QuadDirection(q, quad.Predicate))
+			if err != nil {
+				it.Close()
+				return err
+			}
+			if name, ok := b.attrs[p]; ok {
+				if err = b.setAttr(ctx, i, name, q); err != nil {
+					it.Close()
+					return err
+				}
+				continue
+			}
+			if _, ok := b.preds[p]; !ok && len(b.preds) != 0 {
+				continue
+			}
+			j, ok := b.index[graph.ToKey(b.qs.QuadDirection(q, quad.Object))]
+			if !ok {
+				continue
+			}
+			if len(b.edges) >= b.maxEdges {
+				b.truncated = true
+				full = true
+				break
+			}
+			label, err := b.nameOf(ctx, b.qs.QuadDirection(q, quad.Label))
+			if err != nil {
+				it.Close()
+				return err
+			}
+			b.edges = append(b.edges, graphEdge{
+				ID:     "e" + strconv.Itoa(len(b.edges)),
+				Source: b.nodes[i].ID, Target: b.nodes[j].ID,
+				Label: b.label(p),
+				Graph: b.label(label),
+			})
+		}
+		err := it.Err()
+		it.Close()
+		if err == nil && full {
+			err = b.loadAttrs(ctx, i)
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return ctx.Err()
+}
+
+// graphLimit parses a size limit from the request. Values above the maximum are lowered to it.
+func graphLimit(r *http.Request, name string, def, max int) (int, error) {
+	s := r.URL.Query().Get(name)
+	if s == "" {
+		return def, nil
+	}
+	n, err := strconv.Atoi(s)
+	if err != nil || n <= 0 {
+		return 0, fmt.Errorf("invalid %s: %q", name, s)
+	}
+	if n > max {
+		n = max
+	}
+	return n, nil
+}
+
+// ServeGraph runs a query and returns all nodes bound in its results, together with all quads that link
+// these nodes, as a JSON document for graph visualization libraries.
+//
+// Parameters:
+//
+//	lang       query language (gizmo by default)
+//	qu         query text for GET requests; POST requests send the query in the body
+//	format     d3 (default), cytoscape or vis
+//	preds      comma-separated predicates used as edges; all predicates are used by default
+//	attrs      comma-separated predicates that are added to nodes as attributes instead of edges
+//	max_nodes  maximal number of nodes in the document
+//	max_edges  maximal number of edges in the document
+//
+// The document has a "truncated" field if any of the limits was reached.
+func (api *APIv2) ServeGraph(w http.ResponseWriter, r *http.Request) {
+	timeout, lim, err := api.queryLimits(r)
+	if err != nil {
+		jsonResponse(w, http.StatusBadRequest, err)
+		return
+	}
+	vals := r.URL.Query()
+	fname := vals.Get("format")
+	if fname == "" {
+		fname = "d3"
+	}
+	format := graphFormats[fname]
+	if format == nil {
+		jsonResponse(w, http.StatusBadRequest, fmt.Errorf("unsupported graph format: %q", fname))
+		return
+	}
+	b := &graphBuilder{
+		compact: api.current().compact,
+		index:   make(map[interface{}]int),
+		preds:   make(map[quad.Value]struct{}),
+		attrs:   make(map[quad.Value]string),
+	}
+	if b.maxNodes, err = graphLimit(r, "max_nodes", defaultGraphNodes, maxGraphNodes); err == nil {
+		b.maxEdges, err = graphLimit(r, "max_edges", defaultGraphEdges, maxGraphEdges)
+	}
+	if err != nil {
+		jsonResponse(w, http.StatusBadRequest, err)
+		return
+	}
+	switch s := vals.Get("iris"); s {
+	case "":
+	case "full":
+		b.compact = false
+	case "compact":
+		b.compact = true
+	default:
+		jsonResponse(w, http.StatusBadRequest, fmt.Errorf("unsupported IRI format: %q", s))
+		return
+	}
+	lang := vals.Get("lang")
+	if lang == "" {
+		lang = defaultGraphLang
+	}
+	l := query.GetLanguage(lang)
+	if l == nil {
+		jsonResponse(w, http.StatusBadRequest, "unknown query language")
+		return
+	} else if l.Session == nil && l.HTTP == nil {
+		jsonResponse(w, http.StatusBadRequest, "query language cannot be used for graphs")
+		return
+	}
+	var qu string
+	if r.Method == "GET" {
+		qu = vals.Get("qu")
+	} else {
+		defer r.Body.Close()
+		data, err := readLimit(r.Body)
+		if err != nil {
+			jsonResponse(w, http.StatusBadRequest, err)
+			return
+		}
+		qu = string(data)
+	}
+	if qu == "" {
+		jsonResponse(w, http.StatusBadRequest, "query is empty")
+		return
+	}
+	h, err := api.handleForRequest(r)
+	if err != nil {
+		errorResponse(w, err)
+		return
+	}
+	b.qs = queryStore(h, api.current().compact)
+	// predicates may be set in both full and compact forms
+	for _, p := range valuesFromString(vals.Get("preds")) {
+		b.preds[p] = struct{}{}
+		if iri, ok := p.(quad.IRI); ok {
+			b.preds[iri.Full()] = struct{}{}
+		}
+	}
+	for _, p := range valuesFromString(vals.Get("attrs")) {
+		b.attrs[p] = b.label(p)
+		if iri, ok := p.(quad.IRI); ok {
+			b.attrs[iri.Full()] = b.label(p)
+		}
+	}
+
+	ctx, cancel := api.queryContext(r, timeout, lim)
+	defer cancel()
+	ctx = graph.WithQueryInfo(ctx, lang, qu)
+	if rec := audit.RecordFrom(ctx); rec != nil {
+		rec.SetQuery(lang, qu)
+	}
+	var ses query.Session
+	if l.Session != nil {
+		ses = l.Session(b.qs)
+	} else {
+		ses = l.HTTP(b.qs)
+	}
+	qctx, qcancel := context.WithCancel(ctx)
+	defer qcancel()
+	c := make(chan query.Result, 5)
+	go ses.Execute(qctx, qu, c, executeLimit(lim.MaxResults))
+	results := limitResults(qctx, c, lim.MaxResults)
+	var lerr error // set if nodes cannot be loaded
+	for res := range results {
+		if err = res.Err(); err != nil {
+			break
+		}
+		var ok bool
+		if ok, lerr = b.addResult(ctx, res.Result()); !ok || lerr != nil {
+			// graph is full or a node cannot be loaded; stop the query
+			qcancel()
+			break
+		}
+	}
+	// drain results, thus the query can exit
+	for range results {
+	}
+	if err != nil {
+		queryErrorResponse(w, err)
+		return
+	}
+	if lerr == nil {
+		lerr = b.link(ctx)
+	}
+	if lerr != nil {
+		errorResponse(w, lerr)
+		return
+	}
+	w.Header().Set(hdrContentType, contentTypeJSON)
+	json.NewEncoder(w).Encode(format(b.nodes, b.edges, b.truncated || graph.Truncated(ctx)))
+}
+
+// queryErrorResponse writes an error returned by a query. Errors of the store are written with errorResponse,
+// while all other errors are caused by the query itself.
+func queryErrorResponse(w http.ResponseWriter, err error) {
+	if code := errorStatus(err); code != http.StatusInternalServerError {
+		errorResponse(w, err)
+		return
+	}
+	jsonResponse(w, http.StatusBadRequest, err)
+}
+
+// valuesFromString parses a comma-separated list of values.
+func valuesFromString(s string) []quad.Value {
+	if s == "" {
+		return nil
+	}
+	var out []quad.Value
+	for _, s := range strings.Split(s, ",") {
+		if s = strings.TrimSpace(s); s != "" {
+			out = append(out, quad.StringToValue(s))
+		}
+	}
+	return out
+}
@@ -0,0 +1,143 @@
+// Copyright 2017 The Cayley Authors. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cayleyhttp
+
+import (
+	"context"
+	"encoding/hex"
+	"encoding/json"
+	"net/http"
+	"sort"
+	"time"
+
+	"github.com/cayleygraph/cayley/graph"
+	"github.com/cayleygraph/cayley/quad"
+	"github.com/cayleygraph/cayley/query"
+	"github.com/cayleygraph/cayley/version"
+)
+
+// readyTimeout is a timeout for a backend check, if query timeout is not set.
+const readyTimeout = 10 * time.Second
+
+// ServeHealth reports that the server is running. It never checks the backend, see ServeReady.
+func (api *APIv2) ServeHealth(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set(hdrContentType, contentTypeJSON)
+	w.Write([]byte(`{"status": "ok"}` + "\n"))
+}
+
+// ServeReady reports if the server is ready to serve requests, i.e. the backend is reachable.
+// It returns 503 Service Unavailable otherwise.
+func (api *APIv2) ServeReady(w http.ResponseWriter, r *http.Request) {
+	timeout := api.current().timeout
+	if timeout <= 0 {
+		timeout = readyTimeout
+	}
+	ctx, cancel := context.WithTimeout(r.Context(), timeout)
+	defer cancel()
+	h, err := api.handleForRequest(r)
+	if err == nil {
+		err = graph.Ping(ctx, h.QuadStore)
+	}
+	if err != nil {
+		jsonResponse(w, http.StatusServiceUnavailable, err)
+		return
+	}
+	w.Header().Set(hdrContentType, contentTypeJSON)
+	w.Write([]byte(`{"status": "ready"}` + "\n"))
+}
+
+// InfoDocument describes the server and its backend.
+type InfoDocument struct {
+	Version    string         `json:"version"`
+	GitHash    string         `json:"git_hash,omitempty"`
+	Backend    string         `json:"backend,omitempty"`
+	ReadOnly   bool           `json:"read_only,omitempty"`
+	Size       int64          `json:"size"`
+	Horizon    int64          `json:"horizon,omitempty"`
+	Features   graph.Features `json:"features"`
+	QueryCache bool           `json:"query_cache,omitempty"`
+	Formats    []string       `json:"formats"`
+	Languages  []string       `json:"languages"`
+}
+
+// ServeInfo returns information about the server, its backend and supported quad formats and query languages.
+// Size of the database is an estimate for some backends. Horizon is only returned if the backend is versioned.
+// Features lists optional capabilities of the backend, see graph.Features. QueryCache is set if query results
+// are cached, which requires a versioned backend (see APIv2.SetQueryCache).
+func (api *APIv2) ServeInfo(w http.ResponseWriter, r *http.Request) {
+	h, err := api.handleForRequest(r)
+	if err != nil {
+		jsonResponse(w, http.StatusBadRequest, err)
+		return
+	}
+	size, err := graph.SizeOf(r.Context(), h.QuadStore)
+	if err != nil {
+		errorResponse(w, err)
+		return
+	}
+	out := InfoDocument{
+		Version:   version.Version,
+		GitHash:   version.GitHash,
+		Backend:   api.backend,
+		ReadOnly:  api.ro,
+		Size:      size,
+		Features:  graph.FeaturesOf(h.QuadStore),
+		Languages: query.Languages(),
+	}
+	if vs, ok := graph.AsVersioned(h.QuadStore); ok {
+		out.Horizon = vs.Horizon()
+		// same conditions as in ServeQuery
+		out.QueryCache = api.current().cache != nil && h.QuadStore == api.h.QuadStore
+	}
+	for _, f := range quad.Formats() {
+		out.Formats = append(out.Formats, f.Name)
+	}
+	sort.Strings(out.Formats)
+	sort.Strings(out.Languages)
+	w.Header().Set(hdrContentType, contentTypeJSON)
+	json.NewEncoder(w).Encode(out)
+}
+
+// DigestDocument contains a digest of the database content.
+type DigestDocument struct {
+	Algorithm string `json:"algorithm"`
+	Digest    string `json:"digest"`
+}
+
+// ServeDigest returns a digest of all quads in the database, as calculated by graph.Digest.
+// It reads the whole database, thus the query timeout applies, if it is set.
+func (api *APIv2) ServeDigest(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	if timeout := api.current().timeout; timeout > 0 {
+		var cancel func()
+		ctx, cancel = context.WithTimeout(ctx, timeout)
+		defer cancel()
+	}
+	h, err := api.handleForRequest(r)
+	if err != nil {
+		jsonResponse(w, http.StatusBadRequest, err)
+		return
+	}
+	sum, err := graph.Digest(ctx, h.QuadStore)
+	if err != nil {
+		errorResponse(w, err)
+		return
+	}
+	w.Header().Set(hdrContentType, contentTypeJSON)
+	json.NewEncoder(w).Encode(DigestDocument{
+		Algorithm: "sha256",
+		Digest:    hex.EncodeToString(sum),
+	})
+}
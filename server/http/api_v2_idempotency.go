@@ -0,0 +1,207 @@
+// Copyright 2017 The Cayley Authors. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cayleyhttp
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"errors"
+	"hash"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/cayleygraph/cayley/graph"
+	"github.com/cayleygraph/cayley/internal/lru"
+)
+
+// HeaderIdempotencyKey is a request header with a client-generated key that makes write requests safe to retry.
+const HeaderIdempotencyKey = "Idempotency-Key"
+
+const (
+	// hdrReplayed is a response header that is set to "true" if the response was stored for a previous request.
+	hdrReplayed = "Idempotent-Replayed"
+	// hdrHorizon is a response header with the horizon of the database after the write.
+	hdrHorizon = "X-Horizon"
+)
+
+// maxIdempotentBody is the maximal size of a response that can be stored for replay.
+const maxIdempotentBody = 64 * 1024
+
+// idempotencyStore keeps results of write requests by their idempotency keys.
+type idempotencyStore struct {
+	size int
+	ttl  time.Duration
+
+	mu      sync.Mutex
+	lru     *lru.Cache
+	pending map[string]struct{}
+}
+
+type idempotentResult struct {
+	hash    []byte // hash of the request
+	code    int
+	ctype   string
+	horizon int64
+	body    []byte
+	created time.Time
+}
+
+func newIdempotencyStore(size int, ttl time.Duration) *idempotencyStore {
+	return &idempotencyStore{size: size, ttl: ttl, lru: lru.New(size), pending: make(map[string]struct{})}
+}
+
+// Start returns a stored result for a key, or marks the key as pending if there is none.
+// It returns false if a request with the same key is still in progress.
+func (s *idempotencyStore) Start(key string) (*idempotentResult, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, ok := s.pending[key]; ok {
+		return nil, false
+	}
+	if v, ok := s.lru.Get(key); ok {
+		r := v.(*idempotentResult)
+		if s.ttl <= 0 || time.Since(r.created) <= s.ttl {
+			return r, true
+		}
+		s.lru.Del(key)
+	}
+	s.pending[key] = struct{}{}
+	return nil, true
+}
+
+// Finish stores a result for a pending key. Nil result releases the key without storing anything.
+func (s *idempotencyStore) Finish(key string, r *idempotentResult) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.pending, key)
+	if r != nil {
+		s.lru.Put(key, r)
+	}
+}
+
+// recordingWriter passes the response to the client and keeps a copy of it.
+type recordingWriter struct {
+	http.ResponseWriter
+	api  *APIv2
+	code int
+	buf  bytes.Buffer
+	over bool
+}
+
+func (w *recordingWriter) WriteHeader(code int) {
+	if w.code != 0 {
+		return
+	}
+	w.code = code
+	if vs, ok := graph.AsVersioned(w.api.h.QuadStore); ok {
+		w.Header().Set(hdrHorizon, strconv.FormatInt(vs.Horizon(), 10))
+	}
+	w.ResponseWriter.WriteHeader(code)
+}
+
+func (w *recordingWriter) Write(p []byte) (int, error) {
+	if w.code == 0 {
+		w.WriteHeader(http.StatusOK)
+	}
+	if !w.over {
+		if w.buf.Len()+len(p) > maxIdempotentBody {
+			w.over = true
+			w.buf = bytes.Buffer{}
+		} else {
+			w.buf.Write(p)
+		}
+	}
+	return w.ResponseWriter.Write(p)
+}
+
+// requestHash returns a hash of the request that is stored with the key, and a body that updates it while being read.
+// Closing the returned body has no effect, so that the rest of the body can be hashed after the handler returns.
+func requestHash(r *http.Request) (hash.Hash, io.ReadCloser) {
+	h := sha256.New()
+	io.WriteString(h, r.URL.RawQuery)
+	h.Write([]byte{0})
+	io.WriteString(h, r.Header.Get(hdrContentType))
+	h.Write([]byte{0})
+	io.WriteString(h, r.Header.Get(hdrContentEncoding))
+	h.Write([]byte{0})
+	return h, ioutil.NopCloser(io.TeeReader(r.Body, h))
+}
+
+// idempotent wraps a write handler to process requests with the same idempotency key only once.
+//
+// Responses are stored with a hash of the request, and returned as-is for requests with the same key.
+// Requests that reuse a key with a different content, or while the first request is still in progress,
+// are rejected. Server errors are not stored, thus such requests can be retried.
+func (api *APIv2) idempotent(h http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		s := api.current().idem
+		key := r.Header.Get(HeaderIdempotencyKey)
+		if s == nil || key == "" {
+			h(w, r)
+			return
+		}
+		key = r.Method + " " + r.URL.Path + "\x00" + key
+		res, ok := s.Start(key)
+		if !ok {
+			jsonResponse(w, http.StatusConflict, errors.New("request with the same idempotency key is in progress"))
+			return
+		}
+		defer r.Body.Close()
+		sum, body := requestHash(r)
+		if res != nil {
+			io.Copy(ioutil.Discard, body)
+			if !bytes.Equal(res.hash, sum.Sum(nil)) {
+				jsonResponse(w, http.StatusUnprocessableEntity, errors.New("idempotency key was used for a different request"))
+				return
+			}
+			if res.ctype != "" {
+				w.Header().Set(hdrContentType, res.ctype)
+			}
+			if res.horizon != 0 {
+				w.Header().Set(hdrHorizon, strconv.FormatInt(res.horizon, 10))
+			}
+			w.Header().Set(hdrReplayed, "true")
+			w.WriteHeader(res.code)
+			w.Write(res.body)
+			return
+		}
+		var stored *idempotentResult
+		defer func() {
+			s.Finish(key, stored)
+		}()
+		r.Body = body
+		rw := &recordingWriter{ResponseWriter: w, api: api}
+		h(rw, r)
+		if rw.code == 0 || rw.code >= 500 || rw.over {
+			return
+		}
+		// consume the rest of the body to get the full hash
+		io.Copy(ioutil.Discard, body)
+		stored = &idempotentResult{
+			hash:    sum.Sum(nil),
+			code:    rw.code,
+			ctype:   rw.Header().Get(hdrContentType),
+			body:    rw.buf.Bytes(),
+			created: time.Now(),
+		}
+		if v := rw.Header().Get(hdrHorizon); v != "" {
+			stored.horizon, _ = strconv.ParseInt(v, 10, 64)
+		}
+	}
+}
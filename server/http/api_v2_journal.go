@@ -0,0 +1,105 @@
+// Copyright 2017 The Cayley Authors. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cayleyhttp
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+
+	"github.com/cayleygraph/cayley/clog"
+	"github.com/cayleygraph/cayley/graph"
+	"github.com/cayleygraph/cayley/graph/journal"
+	"github.com/cayleygraph/cayley/graph/patch"
+)
+
+const contentTypeJournal = "text/plain; charset=utf-8"
+
+// JournalFor returns the journal of the database, and a filter that removes changes hidden from the request
+// by access policies. The filter is nil if no policy applies to the request. The journal is nil if it is not enabled.
+func (api *APIv2) JournalFor(r *http.Request) (*journal.Journal, func([]graph.Delta) []graph.Delta, error) {
+	j := journal.From(api.h.QuadStore)
+	if j == nil {
+		return nil, nil, nil
+	}
+	p, secure, err := api.policyForRequest(r)
+	if err != nil {
+		return nil, nil, err
+	} else if !secure {
+		return j, nil, nil
+	}
+	return j, p.Filter, nil
+}
+
+// ServeJournal streams committed entries of the database journal, starting from a horizon set by the from
+// parameter. If follow is set, the response is kept open and new entries are written as they are committed.
+func (api *APIv2) ServeJournal(w http.ResponseWriter, r *http.Request) {
+	j := journal.From(api.h.QuadStore)
+	if j == nil {
+		jsonResponse(w, http.StatusNotFound, errors.New("journal is not enabled"))
+		return
+	}
+	var from int64
+	if s := r.FormValue("from"); s != "" {
+		var err error
+		from, err = strconv.ParseInt(s, 10, 64)
+		if err != nil {
+			jsonResponse(w, http.StatusBadRequest, err)
+			return
+		}
+	}
+	follow, _ := strconv.ParseBool(r.FormValue("follow"))
+	p, secure, err := api.policyForRequest(r)
+	if err != nil {
+		jsonResponse(w, http.StatusForbidden, err)
+		return
+	}
+
+	w.Header().Set(hdrContentType, contentTypeJournal)
+	pw := patch.NewWriter(w)
+	flusher, _ := w.(http.Flusher)
+	write := func(e *journal.Entry) error {
+		if secure {
+			// only return changes visible to the user
+			ne := *e
+			if ne.Deltas = p.Filter(e.Deltas); len(ne.Deltas) == 0 {
+				return nil
+			}
+			e = &ne
+		}
+		if err := journal.WriteEntry(pw, e); err != nil {
+			return err
+		} else if err = pw.Flush(); err != nil {
+			return err
+		}
+		if follow && flusher != nil {
+			flusher.Flush()
+		}
+		return nil
+	}
+	if follow {
+		err = j.Tail(r.Context(), from, write)
+		if err == r.Context().Err() {
+			// client has gone away
+			err = nil
+		}
+	} else {
+		err = journal.ReadFile(j.Path(), from, write)
+	}
+	if err != nil {
+		// can do nothing here, since the header was already written
+		clog.Error(r.Context(), "failed to stream journal", clog.F("error", err))
+	}
+}
@@ -0,0 +1,77 @@
+// Copyright 2017 The Cayley Authors. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cayleyhttp
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"sort"
+	"strings"
+
+	"github.com/cayleygraph/cayley/graph"
+	"github.com/cayleygraph/cayley/schema"
+	"github.com/cayleygraph/cayley/voc"
+)
+
+// NamespaceDocument describes a single namespace prefix.
+type NamespaceDocument struct {
+	Prefix string `json:"prefix"`
+	Full   string `json:"full"`
+}
+
+// ServeNamespaces lists all registered namespaces.
+func (api *APIv2) ServeNamespaces(w http.ResponseWriter, r *http.Request) {
+	list := voc.List()
+	sort.Sort(voc.ByFullName(list))
+	out := make([]NamespaceDocument, 0, len(list))
+	for _, ns := range list {
+		out = append(out, NamespaceDocument{Prefix: ns.Prefix, Full: ns.Full})
+	}
+	w.Header().Set(hdrContentType, contentTypeJSON)
+	json.NewEncoder(w).Encode(out)
+}
+
+// ServeNamespaceAdd registers a namespace and persists it in the database.
+func (api *APIv2) ServeNamespaceAdd(w http.ResponseWriter, r *http.Request) {
+	defer r.Body.Close()
+	if api.ro {
+		jsonResponse(w, http.StatusForbidden, graph.ErrNotWritable)
+		return
+	}
+	var doc NamespaceDocument
+	if err := json.NewDecoder(r.Body).Decode(&doc); err != nil {
+		jsonResponse(w, http.StatusBadRequest, err)
+		return
+	} else if doc.Prefix == "" || doc.Full == "" {
+		jsonResponse(w, http.StatusBadRequest, errors.New("both prefix and full namespace IRI must be set"))
+		return
+	}
+	if !strings.HasSuffix(doc.Prefix, ":") {
+		doc.Prefix += ":"
+	}
+	h, err := api.handleForRequest(r)
+	if err != nil {
+		jsonResponse(w, http.StatusBadRequest, err)
+		return
+	}
+	ns := voc.Namespace{Prefix: doc.Prefix, Full: doc.Full}
+	if err = schema.RegisterNamespace(r.Context(), h.QuadStore, h.QuadWriter, ns); err != nil {
+		errorResponse(w, err)
+		return
+	}
+	w.Header().Set(hdrContentType, contentTypeJSON)
+	json.NewEncoder(w).Encode(doc)
+}
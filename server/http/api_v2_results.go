@@ -0,0 +1,325 @@
+// Copyright 2017 The Cayley Authors. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cayleyhttp
+
+import (
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+
+	"github.com/cayleygraph/cayley/clog"
+	"github.com/cayleygraph/cayley/graph"
+	"github.com/cayleygraph/cayley/query"
+)
+
+const (
+	// hdrTruncated is a trailer that is set if streamed results were truncated by the query limit.
+	hdrTruncated = "X-Truncated"
+	// hdrError is a trailer that is set if an error occurred after the first result was streamed.
+	hdrError = "X-Error"
+)
+
+// resultFormat is an output format that streams query results row by row.
+type resultFormat struct {
+	Name string
+	Mime []string
+	New  func(w io.Writer) rowWriter
+}
+
+// rowWriter writes query results one by one. Rows are either objects with tag values or single values.
+type rowWriter interface {
+	WriteRow(v interface{}) error
+	// WriteError writes an error that occurred in the middle of a stream, if the format allows it.
+	WriteError(err error) error
+	// Flush writes buffered rows to the underlying writer.
+	Flush() error
+	Close() error
+}
+
+var resultFormats = []resultFormat{
+	{
+		Name: "csv", Mime: []string{"text/csv"},
+		New: func(w io.Writer) rowWriter { return newTableWriter(w, ',') },
+	},
+	{
+		Name: "tsv", Mime: []string{"text/tab-separated-values"},
+		New: func(w io.Writer) rowWriter { return newTableWriter(w, '\t') },
+	},
+	{
+		Name: "ndjson", Mime: []string{"application/x-ndjson", "application/ndjson"},
+		New: func(w io.Writer) rowWriter {
+			enc := json.NewEncoder(w)
+			enc.SetEscapeHTML(false)
+			return &ndjsonWriter{enc: enc}
+		},
+	},
+}
+
+// getResultFormat returns a streaming format for query results, requested by "format" parameter
+// or Accept header. It returns nil if results should be returned as a single JSON document.
+func getResultFormat(r *http.Request) (*resultFormat, error) {
+	if name := r.URL.Query().Get("format"); name != "" {
+		if name == "json" {
+			return nil, nil
+		}
+		for i := range resultFormats {
+			if resultFormats[i].Name == name {
+				return &resultFormats[i], nil
+			}
+		}
+		return nil, fmt.Errorf("unsupported result format: %q", name)
+	}
+	for _, spec := range ParseAccept(r.Header, hdrAccept) {
+		if spec.Value == contentTypeJSON {
+			return nil, nil
+		}
+		for i, f := range resultFormats {
+			for _, m := range f.Mime {
+				if m == spec.Value {
+					return &resultFormats[i], nil
+				}
+			}
+		}
+	}
+	return nil, nil
+}
+
+// streamResults writes query results in a given format as soon as they are received from the channel.
+// Results are collated by the session only if it does not implement query.HTTPStreamer.
+//
+// The response is flushed to the client each time the channel is drained, thus a slow client
+// blocks the session instead of making the server buffer results.
+func streamResults(ctx context.Context, w http.ResponseWriter, f *resultFormat, ses query.HTTP, c <-chan query.Result, compact bool, errFunc func(query.ResponseWriter, error)) {
+	var rw rowWriter
+	flusher, _ := w.(http.Flusher)
+	flush := func() error {
+		if err := rw.Flush(); err != nil {
+			return err
+		}
+		if flusher != nil {
+			flusher.Flush()
+		}
+		return nil
+	}
+	write := func(v interface{}) error {
+		if rw == nil {
+			w.Header().Set(hdrContentType, f.Mime[0])
+			w.Header().Set("Trailer", hdrTruncated+", "+hdrError)
+			rw = f.New(w)
+		}
+		if compact {
+			v = query.CompactResult(v)
+		}
+		return rw.WriteRow(v)
+	}
+	fail := func(err error) {
+		if rw == nil {
+			errFunc(w, err)
+			return
+		}
+		clog.Error(ctx, "failed to stream query results", clog.F("error", err))
+		w.Header().Set(hdrError, err.Error())
+		rw.WriteError(err)
+		rw.Close()
+	}
+	conv, ok := ses.(query.HTTPStreamer)
+	for res := range c {
+		if err := res.Err(); err != nil {
+			fail(err)
+			return
+		}
+		if !ok {
+			ses.Collate(res)
+			continue
+		}
+		v, err := conv.ConvertResult(res)
+		if err == nil && v != nil {
+			err = write(v)
+		}
+		if err == nil && rw != nil && len(c) == 0 {
+			// no more results are pending; pass written ones to the client
+			err = flush()
+		}
+		if err != nil {
+			fail(err)
+			return
+		}
+	}
+	if !ok {
+		out, err := ses.Results()
+		if err == nil {
+			if list, isList := out.([]interface{}); isList {
+				for _, v := range list {
+					if err = write(v); err != nil {
+						break
+					}
+				}
+			} else if out != nil {
+				err = write(out)
+			}
+		}
+		if err != nil {
+			fail(err)
+			return
+		}
+	}
+	if rw == nil {
+		// no results; still reply with a correct content type
+		w.Header().Set(hdrContentType, f.Mime[0])
+		return
+	}
+	if err := rw.Close(); err != nil {
+		clog.Error(ctx, "failed to stream query results", clog.F("error", err))
+	}
+	if graph.Truncated(ctx) {
+		w.Header().Set(hdrTruncated, "true")
+	}
+}
+
+type ndjsonWriter struct {
+	enc *json.Encoder
+}
+
+func (w *ndjsonWriter) WriteRow(v interface{}) error {
+	return w.enc.Encode(v)
+}
+
+func (w *ndjsonWriter) WriteError(err error) error {
+	return w.enc.Encode(map[string]string{"error": err.Error()})
+}
+
+func (w *ndjsonWriter) Flush() error { return nil }
+
+func (w *ndjsonWriter) Close() error { return nil }
+
+// tableWriter writes results as CSV or TSV. Columns are taken from the first row: tag names in case of objects,
+// or a single "value" column otherwise. Tags that are missing in the first row are not written.
+type tableWriter struct {
+	w    *csv.Writer
+	cols []string
+	row  []string
+}
+
+func newTableWriter(w io.Writer, sep rune) *tableWriter {
+	cw := csv.NewWriter(w)
+	cw.Comma = sep
+	return &tableWriter{w: cw}
+}
+
+// tableValueColumn is a column name used for results that are not objects.
+const tableValueColumn = "value"
+
+func (w *tableWriter) WriteRow(v interface{}) error {
+	m, isMap := v.(map[string]interface{})
+	if w.cols == nil {
+		if isMap {
+			for k := range m {
+				w.cols = append(w.cols, k)
+			}
+			sort.Strings(w.cols)
+		} else {
+			w.cols = []string{tableValueColumn}
+		}
+		if err := w.w.Write(w.cols); err != nil {
+			return err
+		}
+		w.row = make([]string, len(w.cols))
+	}
+	for i, c := range w.cols {
+		var cell interface{}
+		if isMap {
+			cell = m[c]
+		} else if c == tableValueColumn {
+			cell = v
+		}
+		s, err := tableCell(cell)
+		if err != nil {
+			return err
+		}
+		w.row[i] = s
+	}
+	return w.w.Write(w.row)
+}
+
+// tableCell formats a single value for CSV. Values are encoded as JSON, but strings are written without quotes.
+func tableCell(v interface{}) (string, error) {
+	switch v := v.(type) {
+	case nil:
+		return "", nil
+	case string:
+		return v, nil
+	}
+	data, err := json.Marshal(v)
+	if err != nil {
+		return "", err
+	}
+	var s string
+	if len(data) != 0 && data[0] == '"' && json.Unmarshal(data, &s) == nil {
+		return s, nil
+	}
+	return string(data), nil
+}
+
+func (w *tableWriter) WriteError(err error) error { return nil }
+
+func (w *tableWriter) Flush() error {
+	w.w.Flush()
+	return w.w.Error()
+}
+
+func (w *tableWriter) Close() error {
+	return w.Flush()
+}
+
+// executeLimit returns a result limit for Session.Execute that allows to detect if results
+// will be truncated by the query limit max. See limitResults.
+func executeLimit(max int) int {
+	if max <= 0 {
+		return -1
+	}
+	return max + 1
+}
+
+// limitResults passes at most max successful results from the channel and marks the query
+// as truncated if there are more of them. Errors are always passed through.
+func limitResults(ctx context.Context, in <-chan query.Result, max int) <-chan query.Result {
+	if max <= 0 {
+		return in
+	}
+	out := make(chan query.Result, cap(in))
+	go func() {
+		defer close(out)
+		n := 0
+		for res := range in {
+			if res.Err() == nil {
+				if n >= max {
+					graph.SetTruncated(ctx)
+					continue // drain the rest, thus the query can exit
+				}
+				n++
+			}
+			select {
+			case out <- res:
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+	return out
+}
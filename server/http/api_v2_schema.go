@@ -0,0 +1,192 @@
+// Copyright 2017 The Cayley Authors. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cayleyhttp
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sort"
+	"strconv"
+
+	"github.com/cayleygraph/cayley/graph"
+	"github.com/cayleygraph/cayley/quad"
+	"github.com/cayleygraph/cayley/voc/rdf"
+)
+
+const (
+	defaultSchemaLimit = 100
+	// maxSchemaScan is the number of quads scanned to collect schema statistics
+	maxSchemaScan = 100000
+)
+
+// SchemaCount is a number of quads that use a specific value.
+type SchemaCount struct {
+	Value string `json:"value"`
+	Count int64  `json:"count"`
+}
+
+// SchemaDocument describes predicates and types used in the database.
+type SchemaDocument struct {
+	// Predicates lists the most frequently used predicates, with the number of quads that use them.
+	Predicates []SchemaCount `json:"predicates"`
+	// Types lists the most frequently used node types, with the number of rdf:type quads that use each type.
+	// A node is counted more than once if it has the same type in multiple graphs.
+	Types []SchemaCount `json:"types"`
+	// Sampled is set if only a part of the database was scanned, thus counts are approximate.
+	Sampled bool `json:"sampled,omitempty"`
+}
+
+// schemaCounter counts values used in quads.
+type schemaCounter struct {
+	qs     graph.QuadStore
+	counts map[interface{}]int64
+	refs   map[interface{}]graph.Value
+}
+
+func newSchemaCounter(qs graph.QuadStore) *schemaCounter {
+	return &schemaCounter{
+		qs:     qs,
+		counts: make(map[interface{}]int64),
+		refs:   make(map[interface{}]graph.Value),
+	}
+}
+
+// countQuads counts values of a given direction for all quads returned by the iterator.
+// It returns false if the scan limit was reached.
+func (c *schemaCounter) countQuads(ctx context.Context, it graph.Iterator, d quad.Direction, limit int) (bool, error) {
+	defer it.Close()
+	n := 0
+	for it.Next(ctx) {
+		if n >= limit {
+			return false, nil
+		}
+		n++
+		v := c.qs.QuadDirection(it.Result(), d)
+		k := graph.ToKey(v)
+		if _, ok := c.refs[k]; !ok {
+			c.refs[k] = v
+		}
+		c.counts[k]++
+	}
+	return true, it.Err()
+}
+
+// top returns the most frequent values, ordered by count. Full and compact forms of the same IRI are counted together.
+func (c *schemaCounter) top(ctx context.Context, n int, compact bool) ([]SchemaCount, error) {
+	byName := make(map[string]int64, len(c.counts))
+	for k, cnt := range c.counts {
+		v, err := graph.NameOf(ctx, c.qs, c.refs[k])
+		if err != nil {
+			return nil, err
+		} else if v == nil {
+			continue
+		}
+		if iri, ok := v.(quad.IRI); ok {
+			if compact {
+				v = iri.Short()
+			} else {
+				v = iri.Full()
+			}
+		}
+		byName[quad.StringOf(v)] += cnt
+	}
+	out := make([]SchemaCount, 0, len(byName))
+	for name, cnt := range byName {
+		out = append(out, SchemaCount{Value: name, Count: cnt})
+	}
+	sort.Slice(out, func(i, j int) bool {
+		if out[i].Count != out[j].Count {
+			return out[i].Count > out[j].Count
+		}
+		return out[i].Value < out[j].Value
+	})
+	if len(out) > n {
+		out = out[:n]
+	}
+	return out, nil
+}
+
+// ServeSchema returns the most frequently used predicates and node types. It is used by the UI for autocompletion
+// and schema browsing. Only the first quads of the database are scanned, thus counts may be approximate.
+func (api *APIv2) ServeSchema(w http.ResponseWriter, r *http.Request) {
+	limit := defaultSchemaLimit
+	if s := r.FormValue("limit"); s != "" {
+		n, err := strconv.Atoi(s)
+		if err != nil || n <= 0 {
+			jsonResponse(w, http.StatusBadRequest, fmt.Errorf("invalid limit: %q", s))
+			return
+		}
+		limit = n
+	}
+	compact := api.current().compact
+	switch s := r.FormValue("iris"); s {
+	case "":
+	case "full":
+		compact = false
+	case "compact":
+		compact = true
+	default:
+		jsonResponse(w, http.StatusBadRequest, fmt.Errorf("unsupported IRI format: %q", s))
+		return
+	}
+	h, err := api.handleForRequest(r)
+	if err != nil {
+		jsonResponse(w, http.StatusBadRequest, err)
+		return
+	}
+	ctx := r.Context()
+	qs := h.QuadStore
+
+	var out SchemaDocument
+	preds := newSchemaCounter(qs)
+	full, err := preds.countQuads(ctx, qs.QuadsAllIterator(), quad.Predicate, maxSchemaScan)
+	if err != nil {
+		errorResponse(w, err)
+		return
+	}
+	out.Sampled = !full
+	out.Predicates, err = preds.top(ctx, limit, compact)
+	if err != nil {
+		errorResponse(w, err)
+		return
+	}
+
+	types := newSchemaCounter(qs)
+	for _, p := range []quad.IRI{quad.IRI(rdf.Type), quad.IRI(rdf.Type).Full()} {
+		ref, err := graph.ValueOf(ctx, qs, p)
+		if err != nil {
+			errorResponse(w, err)
+			return
+		} else if ref == nil {
+			continue
+		}
+		full, err = types.countQuads(ctx, qs.QuadIterator(quad.Predicate, ref), quad.Object, maxSchemaScan)
+		if err != nil {
+			errorResponse(w, err)
+			return
+		}
+		out.Sampled = out.Sampled || !full
+	}
+	out.Types, err = types.top(ctx, limit, compact)
+	if err != nil {
+		errorResponse(w, err)
+		return
+	}
+
+	w.Header().Set(hdrContentType, contentTypeJSON)
+	json.NewEncoder(w).Encode(out)
+}
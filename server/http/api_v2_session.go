@@ -0,0 +1,158 @@
+// Copyright 2017 The Cayley Authors. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cayleyhttp
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/cayleygraph/cayley/graph"
+	"github.com/cayleygraph/cayley/graph/memstore"
+	"github.com/cayleygraph/cayley/graph/overlay"
+)
+
+// defaultSessionTimeout is the time after which an idle session is closed.
+const defaultSessionTimeout = 10 * time.Minute
+
+var errSessionNotFound = errors.New("session does not exist or has expired")
+
+// graphSession is a temporary in-memory graph layered on top of the database.
+type graphSession struct {
+	h    *graph.Handle
+	last time.Time
+}
+
+// graphSessions stores temporary graphs created by remote clients.
+type graphSessions struct {
+	mu      sync.Mutex
+	timeout time.Duration
+	byID    map[string]*graphSession
+}
+
+func (s *graphSessions) begin(h *graph.Handle, wtyp string, wopt graph.Options) (string, error) {
+	var b [16]byte
+	if _, err := rand.Read(b[:]); err != nil {
+		return "", err
+	}
+	id := hex.EncodeToString(b[:])
+	qs := overlay.New(h.QuadStore, memstore.New())
+	qw, err := graph.NewQuadWriter(wtyp, qs, wopt)
+	if err != nil {
+		qs.Close()
+		return "", err
+	}
+	now := time.Now()
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.expire(now)
+	if s.byID == nil {
+		s.byID = make(map[string]*graphSession)
+	}
+	s.byID[id] = &graphSession{h: &graph.Handle{QuadStore: qs, QuadWriter: qw}, last: now}
+	return id, nil
+}
+
+// expire closes idle sessions. Caller must hold the lock.
+func (s *graphSessions) expire(now time.Time) {
+	timeout := s.timeout
+	if timeout <= 0 {
+		timeout = defaultSessionTimeout
+	}
+	for id, sess := range s.byID {
+		if now.Sub(sess.last) > timeout {
+			delete(s.byID, id)
+			sess.h.QuadStore.Close()
+		}
+	}
+}
+
+func (s *graphSessions) get(id string) *graphSession {
+	now := time.Now()
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.expire(now)
+	sess := s.byID[id]
+	if sess != nil {
+		sess.last = now
+	}
+	return sess
+}
+
+func (s *graphSessions) remove(id string) *graphSession {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	sess := s.byID[id]
+	delete(s.byID, id)
+	return sess
+}
+
+// SetSessionTimeout sets the time after which idle sessions started with /api/v2/session/begin are closed.
+func (api *APIv2) SetSessionTimeout(dt time.Duration) {
+	api.sessions.mu.Lock()
+	api.sessions.timeout = dt
+	api.sessions.mu.Unlock()
+}
+
+// sessionForRequest returns a handle of a temporary graph selected by the session parameter of the request.
+// It returns nil if the parameter is not set.
+func (api *APIv2) sessionForRequest(r *http.Request) (*graph.Handle, error) {
+	id := r.URL.Query().Get("session")
+	if id == "" {
+		return nil, nil
+	}
+	sess := api.sessions.get(id)
+	if sess == nil {
+		return nil, errSessionNotFound
+	}
+	return sess.h, nil
+}
+
+// ServeSessionBegin creates a temporary graph. Quads written to it with the session parameter are only visible
+// to requests with the same parameter, and are discarded when the session is closed or expires.
+// Removing quads of the database in a session hides them from this session only.
+func (api *APIv2) ServeSessionBegin(w http.ResponseWriter, r *http.Request) {
+	if api.ro {
+		jsonResponse(w, http.StatusForbidden, graph.ErrNotWritable)
+		return
+	}
+	id, err := api.sessions.begin(api.h, api.wtyp, api.wopt)
+	if err != nil {
+		jsonResponse(w, http.StatusInternalServerError, err)
+		return
+	}
+	w.Header().Set(hdrContentType, contentTypeJSON)
+	fmt.Fprintf(w, `{"result": "Session started.", "id": %q}`+"\n", id)
+}
+
+// ServeSessionClose discards a temporary graph.
+func (api *APIv2) ServeSessionClose(w http.ResponseWriter, r *http.Request) {
+	sess := api.sessions.remove(r.FormValue("id"))
+	if sess == nil {
+		jsonResponse(w, http.StatusNotFound, errSessionNotFound)
+		return
+	}
+	if err := sess.h.QuadStore.Close(); err != nil {
+		jsonResponse(w, http.StatusInternalServerError, err)
+		return
+	}
+	w.Header().Set(hdrContentType, contentTypeJSON)
+	io.WriteString(w, `{"result": "Session closed."}`+"\n")
+}
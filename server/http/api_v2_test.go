@@ -1,15 +1,35 @@
 package cayleyhttp
 
 import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io"
+	"io/ioutil"
+	"net/http"
 	"net/http/httptest"
+	"os"
+	"path/filepath"
 	"sort"
+	"strings"
+	"sync"
 	"testing"
+	"time"
 
 	"github.com/cayleygraph/cayley/client"
 	"github.com/cayleygraph/cayley/graph"
+	"github.com/cayleygraph/cayley/graph/acl"
+	"github.com/cayleygraph/cayley/graph/audit"
 	"github.com/cayleygraph/cayley/graph/graphtest"
+	"github.com/cayleygraph/cayley/graph/journal"
 	"github.com/cayleygraph/cayley/graph/memstore"
+	"github.com/cayleygraph/cayley/graph/path"
 	"github.com/cayleygraph/cayley/quad"
+	"github.com/cayleygraph/cayley/query"
+	_ "github.com/cayleygraph/cayley/query/mql"
+	_ "github.com/cayleygraph/cayley/query/pathjson"
+	"github.com/cayleygraph/cayley/schema"
+	"github.com/cayleygraph/cayley/voc"
 	"github.com/cayleygraph/cayley/writer"
 	"github.com/stretchr/testify/require"
 )
@@ -49,6 +69,189 @@ func TestV2Write(t *testing.T) {
 	require.NoError(t, err)
 }
 
+func TestV2Client(t *testing.T) {
+	addr, closer := makeServerV2(t)
+	defer closer()
+	ctx := context.TODO()
+
+	quads := graphtest.MakeQuadSet()
+	cli := client.NewClient(addr, nil)
+	n, err := cli.Load(ctx, quad.NewReader(quads))
+	require.NoError(t, err)
+	require.Equal(t, len(quads), n)
+
+	var buf quad.Quads
+	n, err = cli.Dump(ctx, &buf)
+	require.NoError(t, err)
+	require.Equal(t, len(quads), n)
+	got, err := quad.ReadAll(&buf)
+	require.NoError(t, err)
+	sort.Sort(quad.ByQuadString(got))
+	sort.Sort(quad.ByQuadString(quads))
+	require.Equal(t, quads, got)
+
+	res, err := cli.Query(ctx, "mql", `[{"id": "C", "follows": []}]`, &client.QueryOptions{Limit: 10})
+	require.NoError(t, err)
+	var out []struct {
+		ID      string   `json:"id"`
+		Follows []string `json:"follows"`
+	}
+	err = res.Decode(&out)
+	require.NoError(t, err)
+	require.Len(t, out, 1)
+	sort.Strings(out[0].Follows)
+	require.Equal(t, []string{"B", "D"}, out[0].Follows)
+
+	_, err = cli.Query(ctx, "unknown", "{}", nil)
+	require.Error(t, err)
+	rerr, ok := err.(*client.RequestError)
+	require.True(t, ok, "%T", err)
+	require.Equal(t, http.StatusBadRequest, rerr.StatusCode)
+	require.Equal(t, "unknown query language", rerr.Message)
+}
+
+func TestV2ClientWatch(t *testing.T) {
+	dir, err := ioutil.TempDir("", "cayley_client")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+	j, err := journal.Open(filepath.Join(dir, "journal.nq"), true)
+	require.NoError(t, err)
+	qs := journal.Wrap(memstore.New(), j)
+	wr, err := writer.NewSingleReplication(qs, nil)
+	require.NoError(t, err)
+	h := &graph.Handle{QuadStore: qs, QuadWriter: wr}
+	defer h.Close()
+
+	srv := httptest.NewServer(NewAPIv2(h))
+	defer srv.Close()
+
+	q := quad.MakeIRI("alice", "follows", "bob", "")
+	err = wr.AddQuad(q)
+	require.NoError(t, err)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	cli := client.NewClient(srv.URL, &client.Options{Header: http.Header{"X-Test": {"1"}}})
+	var got []graph.Delta
+	err = cli.Watch(ctx, 0, func(e *journal.Entry) error {
+		got = append(got, e.Deltas...)
+		if len(got) == 1 {
+			// entry written after the watch started
+			return wr.RemoveQuad(q)
+		}
+		cancel()
+		return nil
+	})
+	require.Equal(t, context.Canceled, err)
+	require.Equal(t, []graph.Delta{
+		{Quad: q, Action: graph.Add},
+		{Quad: q, Action: graph.Delete},
+	}, got)
+}
+
+type panicReader struct{}
+
+func (panicReader) ReadQuad() (quad.Quad, error) { panic("parser bug") }
+func (panicReader) Close() error                 { return nil }
+
+func init() {
+	quad.RegisterFormat(quad.Format{
+		Name:   "test-panic",
+		Mime:   []string{"application/x-test-panic"},
+		Reader: func(io.Reader) quad.ReadCloser { return panicReader{} },
+	})
+}
+
+func TestV2WriteMalformed(t *testing.T) {
+	h := makeHandle(t)
+	defer h.Close()
+
+	srv := httptest.NewServer(NewAPIv2(h))
+	defer srv.Close()
+
+	write := func(ctype, body string) int {
+		resp, err := http.Post(srv.URL+"/api/v2/write", ctype, strings.NewReader(body))
+		require.NoError(t, err)
+		resp.Body.Close()
+		return resp.StatusCode
+	}
+	// invalid code point in escape sequence
+	require.Equal(t, http.StatusOK, write("application/n-quads", `<a> <b> "\UFFFFFFFF" .`+"\n"))
+	// parser panics are returned as errors
+	require.Equal(t, http.StatusBadRequest, write("application/x-test-panic", "data"))
+	require.Equal(t, http.StatusOK, write("application/n-quads", "<a> <b> <c> .\n"))
+
+	graphtest.ExpectIteratedQuads(t, h.QuadStore, h.QuadsAllIterator(), []quad.Quad{
+		quad.MakeIRI("a", "b", "c", ""),
+		{Subject: quad.IRI("a"), Predicate: quad.IRI("b"), Object: quad.String("\uFFFD")},
+	}, true)
+}
+
+func TestV2RequestID(t *testing.T) {
+	addr, closer := makeServerV2(t)
+	defer closer()
+
+	req, err := http.NewRequest("GET", addr+"/api/v2/formats", nil)
+	require.NoError(t, err)
+	resp, err := http.DefaultClient.Do(req)
+	require.NoError(t, err)
+	resp.Body.Close()
+	require.Len(t, resp.Header.Get(HeaderRequestID), 16)
+
+	req.Header.Set(HeaderRequestID, "abc")
+	resp, err = http.DefaultClient.Do(req)
+	require.NoError(t, err)
+	resp.Body.Close()
+	require.Equal(t, "abc", resp.Header.Get(HeaderRequestID))
+}
+
+func TestV2Health(t *testing.T) {
+	quads := graphtest.MakeQuadSet()
+	addr, closer := makeServerV2(t, quads...)
+	defer closer()
+
+	get := func(path string) *http.Response {
+		resp, err := http.Get(addr + path)
+		require.NoError(t, err)
+		require.Equal(t, http.StatusOK, resp.StatusCode)
+		return resp
+	}
+	get("/health").Body.Close()
+	get("/ready").Body.Close()
+
+	resp := get("/api/v2/info")
+	defer resp.Body.Close()
+	var info InfoDocument
+	err := json.NewDecoder(resp.Body).Decode(&info)
+	require.NoError(t, err)
+	require.True(t, info.Size > 0)
+	require.True(t, info.Horizon > 0)
+	require.True(t, info.Features.Horizons)
+	require.Contains(t, info.Formats, "nquads")
+	require.Contains(t, info.Languages, "mql")
+}
+
+func TestErrorStatus(t *testing.T) {
+	q := quad.MakeIRI("a", "b", "c", "")
+	for _, c := range []struct {
+		err  error
+		code int
+	}{
+		{graph.ErrNotWritable, http.StatusForbidden},
+		{graph.ErrOperationNotSupported, http.StatusNotImplemented},
+		{&graph.DeltaError{Delta: graph.Delta{Quad: q, Action: graph.Add}, Err: graph.ErrQuadExists}, http.StatusConflict},
+		{graph.ErrConflict, http.StatusConflict},
+		{&graph.DeltaError{Err: &graph.ConstraintError{Kind: graph.ConstraintMaxObjects}}, http.StatusConflict},
+		{&graph.BackendError{Backend: "sql", Err: graph.ErrQuadNotExist}, http.StatusConflict},
+		{graph.WrapBackend("sql", io.ErrUnexpectedEOF), http.StatusBadGateway},
+		{context.DeadlineExceeded, http.StatusServiceUnavailable},
+		{&quad.PanicError{Value: "bug"}, http.StatusBadRequest},
+		{io.ErrUnexpectedEOF, http.StatusInternalServerError},
+	} {
+		require.Equal(t, c.code, errorStatus(c.err), "%v", c.err)
+	}
+}
+
 func TestV2Read(t *testing.T) {
 	expect := graphtest.MakeQuadSet()
 	addr, closer := makeServerV2(t, expect...)
@@ -64,3 +267,888 @@ func TestV2Read(t *testing.T) {
 	sort.Sort(quad.ByQuadString(expect))
 	require.Equal(t, expect, quads)
 }
+
+func TestV2ReadPattern(t *testing.T) {
+	addr, closer := makeServerV2(t, graphtest.MakeQuadSet()...)
+	defer closer()
+
+	cli := client.New(addr)
+	read := func(pattern quad.Quad, limit int) []quad.Quad {
+		qr, err := cli.QuadReaderFor(pattern, limit)
+		require.NoError(t, err)
+		defer qr.Close()
+		quads, err := quad.ReadAll(qr)
+		require.NoError(t, err)
+		sort.Sort(quad.ByQuadString(quads))
+		return quads
+	}
+	require.Equal(t, []quad.Quad{
+		quad.Make("C", "follows", "B", nil),
+		quad.Make("C", "follows", "D", nil),
+	}, read(quad.Quad{Subject: quad.String("C")}, 0))
+	require.Equal(t, []quad.Quad{
+		quad.Make("D", "status", "cool", "status_graph"),
+	}, read(quad.Quad{Subject: quad.String("D"), Label: quad.String("status_graph")}, 0))
+	require.Len(t, read(quad.Quad{Predicate: quad.String("follows")}, 3), 3)
+	require.Len(t, read(quad.Quad{Subject: quad.String("X")}, 0), 0)
+}
+
+func TestV2DeleteMatching(t *testing.T) {
+	h := makeHandle(t, graphtest.MakeQuadSet()...)
+	defer h.Close()
+
+	srv := httptest.NewServer(NewAPIv2(h))
+	defer srv.Close()
+
+	req, err := http.NewRequest("DELETE", srv.URL+"/api/v2/quads?predicate=follows&object=B", nil)
+	require.NoError(t, err)
+	resp, err := http.DefaultClient.Do(req)
+	require.NoError(t, err)
+	resp.Body.Close()
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+
+	var expect []quad.Quad
+	for _, q := range graphtest.MakeQuadSet() {
+		if q.Predicate != quad.String("follows") || q.Object != quad.String("B") {
+			expect = append(expect, q)
+		}
+	}
+	graphtest.ExpectIteratedQuads(t, h.QuadStore, h.QuadsAllIterator(), expect, true)
+
+	// empty pattern must be confirmed explicitly
+	del := func(query string) int {
+		req, err := http.NewRequest("DELETE", srv.URL+"/api/v2/quads"+query, nil)
+		require.NoError(t, err)
+		resp, err := http.DefaultClient.Do(req)
+		require.NoError(t, err)
+		resp.Body.Close()
+		return resp.StatusCode
+	}
+	require.Equal(t, http.StatusBadRequest, del(""))
+	graphtest.ExpectIteratedQuads(t, h.QuadStore, h.QuadsAllIterator(), expect, true)
+	require.Equal(t, http.StatusOK, del("?all=true"))
+	graphtest.ExpectIteratedQuads(t, h.QuadStore, h.QuadsAllIterator(), nil, true)
+}
+
+func TestV2NodeMerge(t *testing.T) {
+	h := makeHandle(t,
+		quad.MakeIRI("alice", "follows", "bob", ""),
+		quad.MakeIRI("alice", "follows", "Bob", ""),
+		quad.MakeIRI("Bob", "follows", "carol", ""),
+	)
+	defer h.Close()
+
+	srv := httptest.NewServer(NewAPIv2(h))
+	defer srv.Close()
+
+	resp, err := http.Post(srv.URL+"/api/v2/node/merge", contentTypeJSON,
+		strings.NewReader(`{"into": "<bob>", "nodes": ["<Bob>"]}`))
+	require.NoError(t, err)
+	resp.Body.Close()
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+
+	graphtest.ExpectIteratedQuads(t, h.QuadStore, h.QuadsAllIterator(), []quad.Quad{
+		quad.MakeIRI("alice", "follows", "bob", ""),
+		quad.MakeIRI("bob", "follows", "carol", ""),
+	}, true)
+}
+
+func TestV2Graph(t *testing.T) {
+	h := makeHandle(t,
+		quad.MakeIRI("alice", "follows", "bob", ""),
+		quad.MakeIRI("bob", "follows", "carol", ""),
+		quad.Make(quad.IRI("bob"), quad.IRI("name"), quad.String("Bob"), nil),
+	)
+	defer h.Close()
+
+	srv := httptest.NewServer(NewAPIv2(h))
+	defer srv.Close()
+
+	const q = `[{"id": null, "<follows>": [{"id": null}]}]`
+	post := func(params string) (int, map[string]interface{}) {
+		resp, err := http.Post(srv.URL+"/api/v2/graph?lang=mql&"+params, "text/plain", strings.NewReader(q))
+		require.NoError(t, err)
+		defer resp.Body.Close()
+		var out map[string]interface{}
+		err = json.NewDecoder(resp.Body).Decode(&out)
+		require.NoError(t, err)
+		return resp.StatusCode, out
+	}
+
+	code, out := post("attrs=<name>")
+	require.Equal(t, http.StatusOK, code)
+	require.Equal(t, map[string]interface{}{
+		"nodes": []interface{}{
+			map[string]interface{}{"id": "<alice>", "label": "alice"},
+			map[string]interface{}{"id": "<bob>", "label": "bob", "name": "Bob"},
+			map[string]interface{}{"id": "<carol>", "label": "carol"},
+		},
+		"links": []interface{}{
+			map[string]interface{}{"id": "e0", "source": "<alice>", "target": "<bob>", "label": "follows"},
+			map[string]interface{}{"id": "e1", "source": "<bob>", "target": "<carol>", "label": "follows"},
+		},
+	}, out)
+
+	code, out = post("format=vis&preds=<likes>")
+	require.Equal(t, http.StatusOK, code)
+	require.Len(t, out["nodes"], 3)
+	require.Len(t, out["edges"], 0)
+
+	code, out = post("format=cytoscape&max_nodes=2")
+	require.Equal(t, http.StatusOK, code)
+	require.Equal(t, true, out["truncated"])
+	elems := out["elements"].(map[string]interface{})
+	require.Len(t, elems["nodes"], 2)
+	require.Equal(t, []interface{}{
+		map[string]interface{}{"data": map[string]interface{}{"id": "e0", "source": "<alice>", "target": "<bob>", "label": "follows"}},
+	}, elems["edges"])
+
+	// attributes are loaded after the edge limit is reached
+	code, out = post("max_edges=1&attrs=<name>")
+	require.Equal(t, http.StatusOK, code)
+	require.Equal(t, true, out["truncated"])
+	require.Len(t, out["links"], 1)
+	require.Contains(t, out["nodes"], map[string]interface{}{"id": "<bob>", "label": "bob", "name": "Bob"})
+
+	code, _ = post("format=dot")
+	require.Equal(t, http.StatusBadRequest, code)
+	code, _ = post("max_nodes=-1")
+	require.Equal(t, http.StatusBadRequest, code)
+}
+
+func TestV2Schema(t *testing.T) {
+	h := makeHandle(t,
+		quad.MakeIRI("alice", "follows", "bob", ""),
+		quad.MakeIRI("bob", "follows", "carol", ""),
+		quad.MakeIRI("alice", "rdf:type", "Person", ""),
+		quad.MakeIRI("bob", "http://www.w3.org/1999/02/22-rdf-syntax-ns#type", "Person", ""),
+		quad.MakeIRI("acme", "rdf:type", "Company", ""),
+	)
+	defer h.Close()
+
+	srv := httptest.NewServer(NewAPIv2(h))
+	defer srv.Close()
+
+	resp, err := http.Get(srv.URL + "/api/v2/schema?iris=compact")
+	require.NoError(t, err)
+	defer resp.Body.Close()
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+	var out SchemaDocument
+	err = json.NewDecoder(resp.Body).Decode(&out)
+	require.NoError(t, err)
+	require.Equal(t, SchemaDocument{
+		Predicates: []SchemaCount{
+			{Value: "<rdf:type>", Count: 3},
+			{Value: "<follows>", Count: 2},
+		},
+		Types: []SchemaCount{
+			{Value: "<Person>", Count: 2},
+			{Value: "<Company>", Count: 1},
+		},
+	}, out)
+
+	resp, err = http.Get(srv.URL + "/api/v2/schema?limit=x")
+	require.NoError(t, err)
+	resp.Body.Close()
+	require.Equal(t, http.StatusBadRequest, resp.StatusCode)
+}
+
+func TestV2Tx(t *testing.T) {
+	h := makeHandle(t, graphtest.MakeQuadSet()...)
+	defer h.Close()
+
+	srv := httptest.NewServer(NewAPIv2(h))
+	defer srv.Close()
+
+	post := func(path, typ string, body interface{}) (int, map[string]interface{}) {
+		var rd io.Reader
+		switch body := body.(type) {
+		case nil:
+		case string:
+			rd = strings.NewReader(body)
+		default:
+			data, err := json.Marshal(body)
+			require.NoError(t, err)
+			rd = bytes.NewReader(data)
+		}
+		resp, err := http.Post(srv.URL+path, typ, rd)
+		require.NoError(t, err)
+		defer resp.Body.Close()
+		var out map[string]interface{}
+		err = json.NewDecoder(resp.Body).Decode(&out)
+		require.NoError(t, err)
+		return resp.StatusCode, out
+	}
+
+	expect := graphtest.MakeQuadSet()
+	check := func() {
+		graphtest.ExpectIteratedQuads(t, h.QuadStore, h.QuadsAllIterator(), expect, true)
+	}
+	remove := func(del quad.Quad) {
+		for i, q := range expect {
+			if q == del {
+				expect = append(expect[:i], expect[i+1:]...)
+				return
+			}
+		}
+	}
+
+	// batched transaction
+	q1, q2 := quad.Make("A", "follows", "B", nil), quad.Make("A", "follows", "C", nil)
+	code, _ := post("/api/v2/tx", contentTypeJSON, TxDocument{
+		Remove: []quad.Quad{q1},
+		Add:    []quad.Quad{q2},
+	})
+	require.Equal(t, http.StatusOK, code)
+	remove(q1)
+	expect = append(expect, q2)
+	check()
+
+	// nothing should be applied if any of the changes fails
+	code, _ = post("/api/v2/tx", contentTypeJSON, TxDocument{
+		Remove: []quad.Quad{quad.Make("X", "follows", "Y", nil)},
+		Add:    []quad.Quad{quad.Make("A", "follows", "D", nil)},
+	})
+	require.Equal(t, http.StatusConflict, code)
+	check()
+
+	// transaction split into multiple requests
+	code, out := post("/api/v2/tx/begin", "", nil)
+	require.Equal(t, http.StatusOK, code)
+	id := out["id"].(string)
+
+	code, _ = post("/api/v2/tx/add?id="+id, "application/n-quads", "<A> <follows> <E> .\n")
+	require.Equal(t, http.StatusOK, code)
+	code, _ = post("/api/v2/tx/remove?id="+id, "application/n-quads", "\"A\" \"follows\" \"C\" .\n")
+	require.Equal(t, http.StatusOK, code)
+	check()
+
+	code, _ = post("/api/v2/tx/commit?id="+id, "", nil)
+	require.Equal(t, http.StatusOK, code)
+	remove(q2)
+	expect = append(expect, quad.MakeIRI("A", "follows", "E", ""))
+	check()
+
+	code, _ = post("/api/v2/tx/commit?id="+id, "", nil)
+	require.Equal(t, http.StatusNotFound, code)
+
+	// aborted transaction
+	code, out = post("/api/v2/tx/begin", "", nil)
+	require.Equal(t, http.StatusOK, code)
+	id = out["id"].(string)
+	code, _ = post("/api/v2/tx/add?id="+id, "application/n-quads", "<B> <follows> <E> .\n")
+	require.Equal(t, http.StatusOK, code)
+	code, _ = post("/api/v2/tx/abort?id="+id, "", nil)
+	require.Equal(t, http.StatusOK, code)
+	code, _ = post("/api/v2/tx/commit?id="+id, "", nil)
+	require.Equal(t, http.StatusNotFound, code)
+	check()
+}
+
+func TestV2TxConditional(t *testing.T) {
+	h := makeHandle(t, graphtest.MakeQuadSet()...)
+	defer h.Close()
+
+	srv := httptest.NewServer(NewAPIv2(h))
+	defer srv.Close()
+
+	resp, err := http.Get(srv.URL + "/api/v2/horizon")
+	require.NoError(t, err)
+	var out struct {
+		Horizon int64 `json:"horizon"`
+	}
+	err = json.NewDecoder(resp.Body).Decode(&out)
+	resp.Body.Close()
+	require.NoError(t, err)
+	require.True(t, out.Horizon > 0)
+
+	err = h.AddQuad(quad.Make("B", "status", "uncool", "status_graph"))
+	require.NoError(t, err)
+
+	data, err := json.Marshal(TxDocument{
+		Base:   out.Horizon,
+		Remove: []quad.Quad{quad.Make("B", "status", "cool", "status_graph")},
+	})
+	require.NoError(t, err)
+	resp, err = http.Post(srv.URL+"/api/v2/tx", contentTypeJSON, bytes.NewReader(data))
+	require.NoError(t, err)
+	resp.Body.Close()
+	require.Equal(t, http.StatusConflict, resp.StatusCode)
+}
+
+func TestV2Namespaces(t *testing.T) {
+	h := makeHandle(t)
+	defer h.Close()
+
+	srv := httptest.NewServer(NewAPIv2(h))
+	defer srv.Close()
+
+	data, err := json.Marshal(NamespaceDocument{Prefix: "apitest", Full: "http://example.org/apitest/"})
+	require.NoError(t, err)
+	resp, err := http.Post(srv.URL+"/api/v2/namespaces", contentTypeJSON, bytes.NewReader(data))
+	require.NoError(t, err)
+	resp.Body.Close()
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+
+	resp, err = http.Get(srv.URL + "/api/v2/namespaces")
+	require.NoError(t, err)
+	var out []NamespaceDocument
+	err = json.NewDecoder(resp.Body).Decode(&out)
+	resp.Body.Close()
+	require.NoError(t, err)
+	require.Contains(t, out, NamespaceDocument{Prefix: "apitest:", Full: "http://example.org/apitest/"})
+
+	var ns voc.Namespaces
+	err = schema.LoadNamespaces(context.TODO(), h.QuadStore, &ns)
+	require.NoError(t, err)
+	require.Equal(t, []voc.Namespace{{Prefix: "apitest:", Full: "http://example.org/apitest/"}}, ns.List())
+}
+
+func TestV2QueryCompactIRIs(t *testing.T) {
+	h := makeHandle(t, quad.MakeIRI("http://example.org/alice", "http://example.org/knows", "http://example.org/bob", ""))
+	defer h.Close()
+
+	api2 := NewAPIv2(h)
+	api2.SetCompactIRIs(true)
+	srv := httptest.NewServer(api2)
+	defer srv.Close()
+
+	voc.RegisterPrefix("ex:", "http://example.org/")
+	const q = `[{"id": "<http://example.org/alice>", "<http://example.org/knows>": []}]`
+	for _, c := range []struct {
+		iris   string
+		expect map[string]interface{}
+	}{
+		{"", map[string]interface{}{
+			"id": "<ex:alice>", "<http://example.org/knows>": []interface{}{"<ex:bob>"},
+		}},
+		{"full", map[string]interface{}{
+			"id": "<http://example.org/alice>", "<http://example.org/knows>": []interface{}{"<http://example.org/bob>"},
+		}},
+	} {
+		resp, err := http.Post(srv.URL+"/api/v2/query?lang=mql&iris="+c.iris, "text/plain", strings.NewReader(q))
+		require.NoError(t, err)
+		var out struct {
+			Result []interface{} `json:"result"`
+		}
+		err = json.NewDecoder(resp.Body).Decode(&out)
+		resp.Body.Close()
+		require.NoError(t, err)
+		require.Equal(t, []interface{}{c.expect}, out.Result, "iris=%q", c.iris)
+	}
+}
+
+func TestV2QueryPathJSON(t *testing.T) {
+	addr, closer := makeServerV2(t, quad.MakeIRI("alice", "follows", "bob", ""))
+	defer closer()
+
+	data, err := json.Marshal(path.StartMorphism(quad.IRI("alice")).Out(quad.IRI("follows")))
+	require.NoError(t, err)
+	// language is selected by the content type
+	resp, err := http.Post(addr+"/api/v2/query", "application/x-cayley-path+json", bytes.NewReader(data))
+	require.NoError(t, err)
+	defer resp.Body.Close()
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+	var out struct {
+		Result []interface{} `json:"result"`
+	}
+	err = json.NewDecoder(resp.Body).Decode(&out)
+	require.NoError(t, err)
+	require.Equal(t, []interface{}{map[string]interface{}{"id": "<bob>"}}, out.Result)
+}
+
+func TestV2QueryTypedValues(t *testing.T) {
+	h := makeHandle(t, quad.Quad{Subject: quad.IRI("alice"), Predicate: quad.IRI("age"), Object: quad.Int(30)})
+	defer h.Close()
+
+	api2 := NewAPIv2(h)
+	api2.SetTypedValues(true)
+	srv := httptest.NewServer(api2)
+	defer srv.Close()
+
+	const q = `[{"id": null, "<age>": null}]`
+	for _, c := range []struct {
+		values string
+		expect map[string]interface{}
+	}{
+		{"", map[string]interface{}{
+			"id": map[string]interface{}{"@id": "alice"}, "<age>": map[string]interface{}{"@value": float64(30), "@type": "schema:Integer"},
+		}},
+		{"native", map[string]interface{}{
+			"id": "<alice>", "<age>": "30",
+		}},
+	} {
+		resp, err := http.Post(srv.URL+"/api/v2/query?lang=mql&values="+c.values, "text/plain", strings.NewReader(q))
+		require.NoError(t, err)
+		var out struct {
+			Result []interface{} `json:"result"`
+		}
+		err = json.NewDecoder(resp.Body).Decode(&out)
+		resp.Body.Close()
+		require.NoError(t, err)
+		require.Contains(t, out.Result, c.expect, "values=%q", c.values)
+	}
+}
+
+func TestV2QueryFormats(t *testing.T) {
+	h := makeHandle(t,
+		quad.MakeIRI("alice", "knows", "bob", ""),
+		quad.MakeIRI("bob", "knows", "carol", ""),
+	)
+	defer h.Close()
+
+	srv := httptest.NewServer(NewAPIv2(h))
+	defer srv.Close()
+
+	const q = `[{"id": null, "<knows>": null}]`
+	for _, c := range []struct {
+		format, accept string
+		ctype, expect  string
+	}{
+		{format: "csv", ctype: "text/csv",
+			expect: "<knows>,id\n<bob>,<alice>\n,<knows>\n<carol>,<bob>\n,<carol>\n"},
+		{format: "tsv", ctype: "text/tab-separated-values",
+			expect: "<knows>\tid\n<bob>\t<alice>\n\t<knows>\n<carol>\t<bob>\n\t<carol>\n"},
+		{accept: "application/x-ndjson", ctype: "application/x-ndjson",
+			expect: `{"<knows>":"<bob>","id":"<alice>"}` + "\n" +
+				`{"<knows>":null,"id":"<knows>"}` + "\n" +
+				`{"<knows>":"<carol>","id":"<bob>"}` + "\n" +
+				`{"<knows>":null,"id":"<carol>"}` + "\n"},
+	} {
+		req, err := http.NewRequest("POST", srv.URL+"/api/v2/query?lang=mql&format="+c.format, strings.NewReader(q))
+		require.NoError(t, err)
+		if c.accept != "" {
+			req.Header.Set("Accept", c.accept)
+		}
+		resp, err := http.DefaultClient.Do(req)
+		require.NoError(t, err)
+		data, err := ioutil.ReadAll(resp.Body)
+		resp.Body.Close()
+		require.NoError(t, err)
+		require.Equal(t, http.StatusOK, resp.StatusCode, "%s", data)
+		require.Equal(t, c.ctype, resp.Header.Get("Content-Type"))
+		require.Equal(t, c.expect, string(data))
+	}
+
+	resp, err := http.Post(srv.URL+"/api/v2/query?lang=mql&format=xml", "text/plain", strings.NewReader(q))
+	require.NoError(t, err)
+	resp.Body.Close()
+	require.Equal(t, http.StatusBadRequest, resp.StatusCode)
+}
+
+func TestV2QueryCache(t *testing.T) {
+	h := makeHandle(t, quad.MakeIRI("alice", "knows", "bob", ""))
+	defer h.Close()
+
+	api2 := NewAPIv2(h)
+	api2.SetQueryCache(10, 0)
+	srv := httptest.NewServer(api2)
+	defer srv.Close()
+
+	resp, err := http.Get(srv.URL + "/api/v2/info")
+	require.NoError(t, err)
+	var info InfoDocument
+	err = json.NewDecoder(resp.Body).Decode(&info)
+	resp.Body.Close()
+	require.NoError(t, err)
+	require.True(t, info.QueryCache)
+
+	const q = `[{"id": null, "<knows>": []}]`
+	run := func(hit bool, expect string) {
+		resp, err := http.Post(srv.URL+"/api/v2/query?lang=mql", "text/plain", strings.NewReader(q))
+		require.NoError(t, err)
+		data, err := ioutil.ReadAll(resp.Body)
+		resp.Body.Close()
+		require.NoError(t, err)
+		require.Equal(t, hit, resp.Header.Get(hdrCache) == "hit")
+		require.Contains(t, string(data), expect)
+	}
+	run(false, "bob")
+	run(true, "bob")
+
+	err = h.QuadWriter.AddQuad(quad.MakeIRI("alice", "knows", "carol", ""))
+	require.NoError(t, err)
+	run(false, "carol")
+	run(true, "carol")
+
+	c := newQueryCache(10, time.Millisecond)
+	c.Get(1, "q")
+	c.Put(1, "q", []byte("a"))
+	c.Put(2, "q2", []byte("b"))
+	data, ok := c.Get(1, "q")
+	require.True(t, ok)
+	require.Equal(t, "a", string(data))
+	_, ok = c.Get(1, "q2")
+	require.False(t, ok, "results for a different horizon must not be cached")
+	time.Sleep(5 * time.Millisecond)
+	_, ok = c.Get(1, "q")
+	require.False(t, ok, "expired results must not be returned")
+}
+
+func TestV2Idempotency(t *testing.T) {
+	h := makeHandle(t)
+	defer h.Close()
+
+	api2 := NewAPIv2(h)
+	api2.SetIdempotency(10, 0)
+	srv := httptest.NewServer(api2)
+	defer srv.Close()
+
+	post := func(path, key, body string) (*http.Response, string) {
+		req, err := http.NewRequest("POST", srv.URL+path, strings.NewReader(body))
+		require.NoError(t, err)
+		req.Header.Set(hdrContentType, "application/n-quads")
+		if key != "" {
+			req.Header.Set(HeaderIdempotencyKey, key)
+		}
+		resp, err := http.DefaultClient.Do(req)
+		require.NoError(t, err)
+		data, err := ioutil.ReadAll(resp.Body)
+		resp.Body.Close()
+		require.NoError(t, err)
+		return resp, string(data)
+	}
+	count := func() int64 {
+		return h.QuadStore.Size()
+	}
+
+	const data = "<a> <b> <c> .\n<a> <b> <d> .\n"
+	resp, body := post("/api/v2/write", "k1", data)
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+	require.Equal(t, "", resp.Header.Get(hdrReplayed))
+	horizon := resp.Header.Get(hdrHorizon)
+	require.NotEqual(t, "", horizon)
+	require.Equal(t, int64(2), count())
+
+	// quads removed in the meantime must not be written again on retry
+	err := h.QuadWriter.RemoveQuad(quad.MakeIRI("a", "b", "c", ""))
+	require.NoError(t, err)
+
+	resp2, body2 := post("/api/v2/write", "k1", data)
+	require.Equal(t, http.StatusOK, resp2.StatusCode)
+	require.Equal(t, "true", resp2.Header.Get(hdrReplayed))
+	require.Equal(t, horizon, resp2.Header.Get(hdrHorizon))
+	require.Equal(t, body, body2)
+	require.Equal(t, int64(1), count())
+
+	resp, _ = post("/api/v2/write", "k1", "<a> <b> <e> .\n")
+	require.Equal(t, http.StatusUnprocessableEntity, resp.StatusCode)
+
+	// keys are scoped to endpoints
+	resp, _ = post("/api/v2/delete", "k1", "<a> <b> <d> .\n")
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+	require.Equal(t, "", resp.Header.Get(hdrReplayed))
+	require.Equal(t, int64(0), count())
+
+	// errors are stored as well
+	resp, body = post("/api/v2/node/delete", "k2", "")
+	require.Equal(t, http.StatusBadRequest, resp.StatusCode)
+	resp2, body2 = post("/api/v2/node/delete", "k2", "")
+	require.Equal(t, http.StatusBadRequest, resp2.StatusCode)
+	require.Equal(t, "true", resp2.Header.Get(hdrReplayed))
+	require.Equal(t, body, body2)
+
+	// requests without a key are not deduplicated
+	for i := 0; i < 2; i++ {
+		resp, _ = post("/api/v2/write", "", data)
+		require.Equal(t, http.StatusOK, resp.StatusCode)
+		require.Equal(t, "", resp.Header.Get(hdrReplayed))
+	}
+
+	s := newIdempotencyStore(10, time.Millisecond)
+	_, ok := s.Start("k")
+	require.True(t, ok)
+	_, ok = s.Start("k")
+	require.False(t, ok, "pending key must not be started twice")
+	s.Finish("k", &idempotentResult{code: http.StatusOK, created: time.Now()})
+	res, ok := s.Start("k")
+	require.True(t, ok)
+	require.NotNil(t, res)
+	time.Sleep(5 * time.Millisecond)
+	res, ok = s.Start("k")
+	require.True(t, ok)
+	require.Nil(t, res, "expired results must not be returned")
+}
+
+func TestV2Batch(t *testing.T) {
+	h := makeHandle(t, quad.MakeIRI("a", "b", "c", ""))
+	defer h.Close()
+
+	srv := httptest.NewServer(NewAPIv2(h))
+	defer srv.Close()
+
+	const doc = `{"ops": [
+		{"action": "add", "quad": {"subject": "<a>", "predicate": "<b>", "object": "<d>"}},
+		{"action": "add", "quad": {"subject": "<a>", "predicate": "<b>", "object": "<c>"}},
+		{"action": "remove", "quad": {"subject": "<a>", "predicate": "<b>", "object": "<e>"}},
+		{"action": "remove", "quad": {"subject": "<a>", "predicate": "<b>", "object": "<c>"}},
+		{"action": "add", "quad": {"subject": "<a>", "predicate": "<b>", "object": "<d>"}},
+		{"action": "update", "quad": {"subject": "<a>", "predicate": "<b>", "object": "<f>"}},
+		{"action": "add", "quad": {"subject": "<a>", "predicate": "<b>"}}
+	]}`
+	resp, err := http.Post(srv.URL+"/api/v2/batch", contentTypeJSON, strings.NewReader(doc))
+	require.NoError(t, err)
+	defer resp.Body.Close()
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+	var out BatchResult
+	err = json.NewDecoder(resp.Body).Decode(&out)
+	require.NoError(t, err)
+
+	var st []string
+	for _, r := range out.Results {
+		st = append(st, r.Status)
+	}
+	require.Equal(t, []string{
+		BatchApplied, BatchDuplicate, BatchNotExist, BatchApplied,
+		BatchDuplicate, BatchError, BatchError,
+	}, st)
+	require.Equal(t, 2, out.Applied)
+	require.Equal(t, 5, out.Failed)
+	require.NotEqual(t, "", out.Results[5].Error)
+
+	qr := graph.NewQuadStoreReader(h.QuadStore)
+	quads, err := quad.ReadAll(qr)
+	qr.Close()
+	require.NoError(t, err)
+	require.Equal(t, []quad.Quad{quad.MakeIRI("a", "b", "d", "")}, quads)
+}
+
+func TestV2Reload(t *testing.T) {
+	h := makeHandle(t)
+	defer h.Close()
+
+	api2 := NewAPIv2(h)
+	api2.SetQueryCache(10, time.Minute)
+	srv := httptest.NewServer(api2)
+	defer srv.Close()
+
+	const token = "secret"
+	auth := "Bearer " + token
+	getConfig := func() ConfigInfo {
+		req, err := http.NewRequest("GET", srv.URL+"/api/v2/admin/config", nil)
+		require.NoError(t, err)
+		req.Header.Set("Authorization", auth)
+		resp, err := http.DefaultClient.Do(req)
+		require.NoError(t, err)
+		defer resp.Body.Close()
+		require.Equal(t, http.StatusOK, resp.StatusCode)
+		var c ConfigInfo
+		require.NoError(t, json.NewDecoder(resp.Body).Decode(&c))
+		return c
+	}
+	reload := func(code int) {
+		req, err := http.NewRequest("POST", srv.URL+"/api/v2/admin/reload", nil)
+		require.NoError(t, err)
+		if auth != "" {
+			req.Header.Set("Authorization", auth)
+		}
+		resp, err := http.DefaultClient.Do(req)
+		require.NoError(t, err)
+		resp.Body.Close()
+		require.Equal(t, code, resp.StatusCode)
+	}
+	// admin endpoints are disabled without a token or access policies
+	reload(http.StatusForbidden)
+	api2.SetAdminToken(token)
+	c := getConfig()
+	require.Equal(t, 100, c.MaxResults)
+	require.Equal(t, 10, c.CacheSize)
+	require.Equal(t, "1m0s", c.CacheTTL)
+
+	reload(http.StatusNotImplemented)
+
+	cache := api2.current().cache
+	api2.SetReloadFunc(func() error {
+		api2.SetQueryTimeout(time.Second)
+		api2.SetScanLimit(50)
+		api2.SetQueryCache(10, time.Minute)
+		return nil
+	})
+	reload(http.StatusOK)
+	c = getConfig()
+	require.Equal(t, "1s", c.Timeout)
+	require.Equal(t, int64(50), c.MaxScanned)
+	require.True(t, cache == api2.current().cache, "cache must be kept if its settings are the same")
+
+	auth = "Bearer wrong"
+	reload(http.StatusForbidden)
+
+	// only admin roles can use the endpoints if policies are enabled
+	api2.SetAccessPolicies("", map[string]*acl.Policy{
+		"user":  {},
+		"admin": {Admin: true},
+	}, "user")
+	auth = ""
+	reload(http.StatusForbidden)
+	auth = "Bearer " + token
+	reload(http.StatusOK)
+	req, err := http.NewRequest("POST", srv.URL+"/api/v2/admin/reload", nil)
+	require.NoError(t, err)
+	req.Header.Set(HeaderRole, "admin")
+	resp, err := http.DefaultClient.Do(req)
+	require.NoError(t, err)
+	resp.Body.Close()
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+}
+
+func TestV2Session(t *testing.T) {
+	h := makeHandle(t, quad.MakeIRI("alice", "knows", "bob", ""))
+	defer h.Close()
+
+	srv := httptest.NewServer(NewAPIv2(h))
+	defer srv.Close()
+
+	post := func(path, typ, body string) (int, string) {
+		resp, err := http.Post(srv.URL+path, typ, strings.NewReader(body))
+		require.NoError(t, err)
+		defer resp.Body.Close()
+		data, err := ioutil.ReadAll(resp.Body)
+		require.NoError(t, err)
+		return resp.StatusCode, string(data)
+	}
+	const q = `[{"id": "alice", "<knows>": []}]`
+
+	code, body := post("/api/v2/session/begin", "", "")
+	require.Equal(t, http.StatusOK, code)
+	var out struct {
+		ID string `json:"id"`
+	}
+	require.NoError(t, json.Unmarshal([]byte(body), &out))
+	id := out.ID
+
+	code, _ = post("/api/v2/write?session="+id, "application/n-quads", "<alice> <knows> <carol> .\n")
+	require.Equal(t, http.StatusOK, code)
+
+	code, body = post("/api/v2/query?lang=mql&session="+id, "text/plain", q)
+	require.Equal(t, http.StatusOK, code)
+	require.Contains(t, body, "bob")
+	require.Contains(t, body, "carol")
+
+	code, body = post("/api/v2/query?lang=mql", "text/plain", q)
+	require.Equal(t, http.StatusOK, code)
+	require.Contains(t, body, "bob")
+	require.False(t, strings.Contains(body, "carol"), "temporary quads must not be visible outside of the session")
+	require.Nil(t, h.QuadStore.ValueOf(quad.IRI("carol")))
+
+	code, _ = post("/api/v2/session/close?id="+id, "", "")
+	require.Equal(t, http.StatusOK, code)
+	code, _ = post("/api/v2/query?lang=mql&session="+id, "text/plain", q)
+	require.Equal(t, http.StatusBadRequest, code)
+}
+
+type memSink struct {
+	mu     sync.Mutex
+	events []*audit.Event
+}
+
+func (s *memSink) Write(_ context.Context, e *audit.Event) error {
+	s.mu.Lock()
+	s.events = append(s.events, e)
+	s.mu.Unlock()
+	return nil
+}
+
+func (s *memSink) Close() error { return nil }
+
+func TestV2Audit(t *testing.T) {
+	h := makeHandle(t, quad.MakeIRI("alice", "knows", "bob", ""))
+	defer h.Close()
+
+	api2 := NewAPIv2(h)
+	sink := &memSink{}
+	api2.SetAuditLog(sink, "")
+	srv := httptest.NewServer(api2)
+	defer srv.Close()
+
+	post := func(path, ctype, body string) int {
+		req, err := http.NewRequest("POST", srv.URL+path, strings.NewReader(body))
+		require.NoError(t, err)
+		req.Header.Set(hdrContentType, ctype)
+		req.Header.Set(HeaderPrincipal, "alice")
+		resp, err := http.DefaultClient.Do(req)
+		require.NoError(t, err)
+		io.Copy(ioutil.Discard, resp.Body)
+		resp.Body.Close()
+		return resp.StatusCode
+	}
+
+	const q = `[{"id": null, "<knows>": []}]`
+	require.Equal(t, http.StatusOK, post("/api/v2/query?lang=mql", "text/plain", q))
+	require.Equal(t, http.StatusOK, post("/api/v2/write", "application/n-quads", "<bob> <knows> <carol> .\n"))
+	require.Equal(t, http.StatusOK, post("/api/v2/read", "", ""))
+	require.NotEqual(t, http.StatusOK, post("/api/v2/query?lang=mql", "text/plain", "{"))
+
+	require.Len(t, sink.events, 3, "reads must not be audited")
+	e := sink.events[0]
+	require.Equal(t, audit.OpQuery, e.Op)
+	require.Equal(t, "alice", e.Principal)
+	require.Equal(t, "mql", e.Lang)
+	require.Equal(t, q, e.Query)
+	require.True(t, e.Results > 0)
+	require.NotEqual(t, "", e.RequestID)
+
+	e = sink.events[1]
+	require.Equal(t, audit.OpWrite, e.Op)
+	require.Equal(t, []quad.Quad{quad.MakeIRI("bob", "knows", "carol", "")}, e.Added)
+	require.Equal(t, int64(1), e.Results)
+	require.Equal(t, "", e.Error)
+
+	require.NotEqual(t, "", sink.events[2].Error)
+}
+
+type valueResult struct {
+	v interface{}
+}
+
+func (r valueResult) Result() interface{} { return r.v }
+func (r valueResult) Err() error          { return nil }
+
+// streamSession passes results as-is.
+type streamSession struct {
+	query.HTTP
+}
+
+func (streamSession) ConvertResult(r query.Result) (interface{}, error) {
+	return r.Result(), nil
+}
+
+type flushRecorder struct {
+	*httptest.ResponseRecorder
+	flushed []string
+}
+
+func (w *flushRecorder) Flush() {
+	w.flushed = append(w.flushed, w.Body.String())
+}
+
+func TestStreamResultsFlush(t *testing.T) {
+	f, err := getResultFormat(httptest.NewRequest("GET", "/?format=csv", nil))
+	require.NoError(t, err)
+	run := func(c chan query.Result, send func()) []string {
+		w := &flushRecorder{ResponseRecorder: httptest.NewRecorder()}
+		done := make(chan struct{})
+		go func() {
+			defer close(done)
+			streamResults(context.TODO(), w, f, streamSession{}, c, false, defaultErrorFunc)
+		}()
+		send()
+		close(c)
+		<-done
+		return w.flushed
+	}
+
+	// client receives each row as soon as it is produced
+	c := make(chan query.Result)
+	got := run(c, func() {
+		c <- valueResult{"a"}
+		c <- valueResult{"b"}
+	})
+	require.Equal(t, []string{"value\na\n", "value\na\nb\n"}, got)
+
+	// pending results are written together
+	c = make(chan query.Result, 2)
+	c <- valueResult{"a"}
+	c <- valueResult{"b"}
+	got = run(c, func() {})
+	require.Equal(t, []string{"value\na\nb\n"}, got)
+}
@@ -0,0 +1,291 @@
+// Copyright 2017 The Cayley Authors. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cayleyhttp
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/cayleygraph/cayley/graph"
+	"github.com/cayleygraph/cayley/quad"
+)
+
+const (
+	// defaultTxTimeout is the time after which an idle transaction is aborted.
+	defaultTxTimeout = time.Minute
+	// maxTxDeltas limits the number of changes in a single transaction.
+	maxTxDeltas = 1000000
+)
+
+var errTxNotFound = errors.New("transaction does not exist or has expired")
+
+// TxDocument is a batched transaction that can be sent in a single request.
+type TxDocument struct {
+	Add    []quad.Quad `json:"add,omitempty"`
+	Remove []quad.Quad `json:"remove,omitempty"`
+	// Base is a horizon returned by /api/v2/horizon. If set, the transaction fails
+	// if quads it changes were modified after that horizon.
+	Base int64 `json:"base,omitempty"`
+}
+
+type txSession struct {
+	mu   sync.Mutex
+	tx   *graph.Transaction
+	last time.Time
+}
+
+// txSessions stores transactions started by remote clients.
+type txSessions struct {
+	mu      sync.Mutex
+	timeout time.Duration
+	byID    map[string]*txSession
+}
+
+func (s *txSessions) begin(base int64) (string, error) {
+	var b [16]byte
+	if _, err := rand.Read(b[:]); err != nil {
+		return "", err
+	}
+	id := hex.EncodeToString(b[:])
+	now := time.Now()
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.expire(now)
+	if s.byID == nil {
+		s.byID = make(map[string]*txSession)
+	}
+	tx := graph.NewTransaction()
+	tx.Base = base
+	s.byID[id] = &txSession{tx: tx, last: now}
+	return id, nil
+}
+
+// expire removes idle transactions. Caller must hold the lock.
+func (s *txSessions) expire(now time.Time) {
+	timeout := s.timeout
+	if timeout <= 0 {
+		timeout = defaultTxTimeout
+	}
+	for id, tx := range s.byID {
+		if now.Sub(tx.last) > timeout {
+			delete(s.byID, id)
+		}
+	}
+}
+
+func (s *txSessions) get(id string) *txSession {
+	now := time.Now()
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.expire(now)
+	tx := s.byID[id]
+	if tx != nil {
+		tx.last = now
+	}
+	return tx
+}
+
+func (s *txSessions) remove(id string) *txSession {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	tx := s.byID[id]
+	delete(s.byID, id)
+	return tx
+}
+
+// SetTxTimeout sets the time after which idle transactions started with /api/v2/tx/begin are aborted.
+func (api *APIv2) SetTxTimeout(dt time.Duration) {
+	api.txs.mu.Lock()
+	api.txs.timeout = dt
+	api.txs.mu.Unlock()
+}
+
+func (api *APIv2) applyTx(w http.ResponseWriter, r *http.Request, tx *graph.Transaction) {
+	h, err := api.handleForRequest(r)
+	if err != nil {
+		jsonResponse(w, http.StatusBadRequest, err)
+		return
+	}
+	if err = h.ApplyTransaction(tx); err != nil {
+		errorResponse(w, err)
+		return
+	}
+	n := len(tx.Deltas)
+	w.Header().Set(hdrContentType, contentTypeJSON)
+	fmt.Fprintf(w, `{"result": "Successfully applied %d changes.", "count": %d}`+"\n", n, n)
+}
+
+// ServeTx applies a batched transaction document atomically.
+func (api *APIv2) ServeTx(w http.ResponseWriter, r *http.Request) {
+	defer r.Body.Close()
+	if api.ro {
+		jsonResponse(w, http.StatusForbidden, graph.ErrNotWritable)
+		return
+	}
+	var doc TxDocument
+	if err := json.NewDecoder(r.Body).Decode(&doc); err != nil {
+		jsonResponse(w, http.StatusBadRequest, err)
+		return
+	} else if len(doc.Add)+len(doc.Remove) > maxTxDeltas {
+		jsonResponse(w, http.StatusBadRequest, errors.New("transaction is too large"))
+		return
+	}
+	tx := graph.NewTransaction()
+	tx.Base = doc.Base
+	for _, q := range doc.Remove {
+		if !q.IsValid() {
+			jsonResponse(w, http.StatusBadRequest, fmt.Errorf("invalid quad: %v", q))
+			return
+		}
+		tx.RemoveQuad(q)
+	}
+	for _, q := range doc.Add {
+		if !q.IsValid() {
+			jsonResponse(w, http.StatusBadRequest, fmt.Errorf("invalid quad: %v", q))
+			return
+		}
+		tx.AddQuad(q)
+	}
+	api.applyTx(w, r, tx)
+}
+
+// ServeHorizon returns a current horizon of the database that can be used as a base for conditional transactions.
+func (api *APIv2) ServeHorizon(w http.ResponseWriter, r *http.Request) {
+	h, err := api.handleForRequest(r)
+	if err != nil {
+		jsonResponse(w, http.StatusBadRequest, err)
+		return
+	}
+	vs, ok := graph.AsVersioned(h.QuadStore)
+	if !ok {
+		jsonResponse(w, http.StatusNotImplemented, graph.ErrOperationNotSupported)
+		return
+	}
+	w.Header().Set(hdrContentType, contentTypeJSON)
+	fmt.Fprintf(w, `{"horizon": %d}`+"\n", vs.Horizon())
+}
+
+// ServeTxBegin starts a new transaction. Changes are buffered on the server until the transaction is committed.
+// If the base parameter is set, the transaction is conditional.
+func (api *APIv2) ServeTxBegin(w http.ResponseWriter, r *http.Request) {
+	if api.ro {
+		jsonResponse(w, http.StatusForbidden, graph.ErrNotWritable)
+		return
+	}
+	var base int64
+	if s := r.FormValue("base"); s != "" {
+		var err error
+		base, err = strconv.ParseInt(s, 10, 64)
+		if err != nil {
+			jsonResponse(w, http.StatusBadRequest, err)
+			return
+		}
+	}
+	id, err := api.txs.begin(base)
+	if err != nil {
+		jsonResponse(w, http.StatusInternalServerError, err)
+		return
+	}
+	w.Header().Set(hdrContentType, contentTypeJSON)
+	fmt.Fprintf(w, `{"result": "Transaction started.", "id": %q}`+"\n", id)
+}
+
+func (api *APIv2) serveTxChange(w http.ResponseWriter, r *http.Request, p graph.Procedure) {
+	defer r.Body.Close()
+	s := api.txs.get(r.FormValue("id"))
+	if s == nil {
+		jsonResponse(w, http.StatusNotFound, errTxNotFound)
+		return
+	}
+	format := getFormat(r, "", hdrContentType)
+	if format == nil || format.Reader == nil {
+		jsonResponse(w, http.StatusBadRequest, errors.New("format is not supported for reading data"))
+		return
+	}
+	rd, err := readerFrom(r, hdrContentEncoding)
+	if err != nil {
+		jsonResponse(w, http.StatusBadRequest, err)
+		return
+	}
+	defer rd.Close()
+	qr, err := format.NewSafeReader(rd)
+	if err != nil {
+		jsonResponse(w, http.StatusBadRequest, err)
+		return
+	}
+	defer qr.Close()
+	// read all quads first, so a malformed request will not leave the transaction half-updated
+	quads, err := quad.ReadAll(qr)
+	if err != nil {
+		jsonResponse(w, http.StatusBadRequest, err)
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if len(s.tx.Deltas)+len(quads) > maxTxDeltas {
+		jsonResponse(w, http.StatusBadRequest, errors.New("transaction is too large"))
+		return
+	}
+	qw := graph.NewTxWriter(s.tx, p)
+	for _, q := range quads {
+		if err = qw.WriteQuad(q); err != nil {
+			jsonResponse(w, http.StatusBadRequest, err)
+			return
+		}
+	}
+	n := len(quads)
+	w.Header().Set(hdrContentType, contentTypeJSON)
+	fmt.Fprintf(w, `{"result": "Successfully buffered %d quads.", "count": %d}`+"\n", n, n)
+}
+
+// ServeTxAdd adds quads to a transaction started with ServeTxBegin.
+func (api *APIv2) ServeTxAdd(w http.ResponseWriter, r *http.Request) {
+	api.serveTxChange(w, r, graph.Add)
+}
+
+// ServeTxRemove removes quads in a transaction started with ServeTxBegin.
+func (api *APIv2) ServeTxRemove(w http.ResponseWriter, r *http.Request) {
+	api.serveTxChange(w, r, graph.Delete)
+}
+
+// ServeTxCommit atomically applies all changes buffered in a transaction.
+func (api *APIv2) ServeTxCommit(w http.ResponseWriter, r *http.Request) {
+	s := api.txs.remove(r.FormValue("id"))
+	if s == nil {
+		jsonResponse(w, http.StatusNotFound, errTxNotFound)
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	api.applyTx(w, r, s.tx)
+}
+
+// ServeTxAbort discards a transaction.
+func (api *APIv2) ServeTxAbort(w http.ResponseWriter, r *http.Request) {
+	if s := api.txs.remove(r.FormValue("id")); s == nil {
+		jsonResponse(w, http.StatusNotFound, errTxNotFound)
+		return
+	}
+	w.Header().Set(hdrContentType, contentTypeJSON)
+	io.WriteString(w, `{"result": "Transaction aborted."}`+"\n")
+}
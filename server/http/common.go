@@ -1,14 +1,84 @@
 package cayleyhttp
 
 import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
 	"encoding/json"
 	"fmt"
 	"net/http"
 
+	"github.com/julienschmidt/httprouter"
+
+	"github.com/cayleygraph/cayley/clog"
 	"github.com/cayleygraph/cayley/graph"
 	"github.com/cayleygraph/cayley/graph/http"
+	"github.com/cayleygraph/cayley/quad"
 )
 
+// HeaderRequestID is a header used to pass request ids from clients and proxies.
+const HeaderRequestID = "X-Request-ID"
+
+func newRequestID() string {
+	var b [8]byte
+	if _, err := rand.Read(b[:]); err != nil {
+		return ""
+	}
+	return hex.EncodeToString(b[:])
+}
+
+// RequestID is a HandlerWrapper that assigns an id to each request. The id is taken from X-Request-ID
+// header, or generated if the header is not set. It is attached to the request context, thus
+// all messages logged by clog with this context (including the slow query log) will contain it.
+// The id is also returned to the client in the response header.
+//
+// If the request context already has an id, the handler is called as-is.
+func RequestID(h httprouter.Handle) httprouter.Handle {
+	return func(w http.ResponseWriter, r *http.Request, params httprouter.Params) {
+		if clog.RequestID(r.Context()) != "" {
+			h(w, r, params)
+			return
+		}
+		id := r.Header.Get(HeaderRequestID)
+		if id == "" {
+			id = newRequestID()
+		}
+		w.Header().Set(HeaderRequestID, id)
+		r = r.WithContext(clog.WithRequestID(r.Context(), id))
+		h(w, r, params)
+	}
+}
+
+// errorStatus returns an HTTP status code for an error returned by the quad store or writer.
+func errorStatus(err error) int {
+	switch {
+	case graph.IsNotWritable(err):
+		return http.StatusForbidden
+	case graph.IsUnsupported(err):
+		return http.StatusNotImplemented
+	case graph.IsQuadExist(err), graph.IsQuadNotExist(err), graph.IsInvalidAction(err), graph.IsConflict(err),
+		graph.IsConstraintViolation(err):
+		return http.StatusConflict
+	case graph.IsBackendError(err):
+		return http.StatusBadGateway
+	}
+	cause := graph.Cause(err)
+	if _, ok := cause.(*quad.PanicError); ok {
+		// parser failed on a malformed input
+		return http.StatusBadRequest
+	}
+	switch cause {
+	case context.Canceled, context.DeadlineExceeded:
+		return http.StatusServiceUnavailable
+	}
+	return http.StatusInternalServerError
+}
+
+// errorResponse writes an error with a status code that matches the error type. See errorStatus.
+func errorResponse(w http.ResponseWriter, err error) {
+	jsonResponse(w, errorStatus(err), err)
+}
+
 func jsonResponse(w http.ResponseWriter, code int, err interface{}) {
 	w.Header().Set("Content-Type", contentTypeJSON)
 	w.WriteHeader(code)
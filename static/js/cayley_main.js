@@ -88,17 +88,109 @@ $(function() {
 		})}, 7000))
 	}
 
+  // languageNames are display names of known query languages; other languages registered on the server are
+  // listed by their id.
+  var languageNames = {
+    "gizmo": "Gizmo",
+    "mql": "MQL",
+    "graphql": "GraphQL",
+    "sexp": "S-expressions"
+  }
+
+  // languageModes are CodeMirror modes used for syntax highlighting.
+  var languageModes = {
+    "gizmo": "javascript",
+    "mql": "application/json",
+    "graphql": "javascript"
+  }
+
   if ($("#code").length != 0) {
     editor = CodeMirror.fromTextArea(document.getElementById("code"), {
       lineNumbers: true,
       matchBrackets: true,
       continueComments: "Enter",
-      //        extraKeys: {"Ctrl-Q": "toggleComment"}
+      extraKeys: {
+        "Ctrl-Space": function(cm) { showSchemaHints(cm) }
+      }
     });
+    editor.on("keyup", function(cm, ev) {
+      // ":" completes names in a namespace, "<" starts an IRI
+      if (ev.key === ":" || ev.key === "<") {
+        showSchemaHints(cm)
+      }
+    })
   } else{
     editor = null;
   }
 
+  // schemaWords is a list of namespace prefixes, predicates and node types used for autocompletion.
+  // It is loaded once from /api/v2/namespaces and /api/v2/schema.
+  schemaWords = null
+  var loadingSchema = null
+
+  loadSchemaWords = function() {
+    if (loadingSchema !== null) {
+      return loadingSchema
+    }
+    var words = {}
+    loadingSchema = $.when(
+      $.getJSON("/api/v2/namespaces").done(function(list) {
+        for (var i = 0; i < list.length; i++) {
+          words[list[i].prefix] = "namespace"
+        }
+      }),
+      $.getJSON("/api/v2/schema", {iris: "compact"}).done(function(doc) {
+        var add = function(items, kind) {
+          for (var i = 0; items && i < items.length; i++) {
+            // strip brackets of IRIs; they are added back if the user typed them
+            words[items[i].value.replace(/^<(.*)>$/, "$1")] = kind
+          }
+        }
+        add(doc.predicates, "predicate")
+        add(doc.types, "type")
+      })
+    ).then(function() {
+      schemaWords = words
+      return words
+    }, function() {
+      // allow to retry on the next request
+      loadingSchema = null
+    })
+    return loadingSchema
+  }
+
+  var isWordChar = function(ch) {
+    return /[^\s"'`()\[\]{},;<>]/.test(ch)
+  }
+
+  var schemaHints = function(cm) {
+    var cur = cm.getCursor()
+    var line = cm.getLine(cur.line)
+    var start = cur.ch
+    while (start > 0 && isWordChar(line.charAt(start - 1))) {
+      start--
+    }
+    var word = line.slice(start, cur.ch)
+    var list = []
+    for (var w in schemaWords) {
+      if (w.lastIndexOf(word, 0) === 0 && w !== word) {
+        list.push(w)
+      }
+    }
+    list.sort()
+    return {
+      list: list,
+      from: CodeMirror.Pos(cur.line, start),
+      to: CodeMirror.Pos(cur.line, cur.ch)
+    }
+  }
+
+  var showSchemaHints = function(cm) {
+    loadSchemaWords().done(function() {
+      CodeMirror.showHint(cm, schemaHints, {completeSingle: false})
+    })
+  }
+
   var defaultQueryStrings = {
     "gizmo": "g.Emit('Hello World')",
     "mql": "[{\n  \"id\": \"Hello World\"\n}]",
@@ -106,72 +198,58 @@ $(function() {
   }
 
   var getLastQueryStringFor = function(type) {
+    var saved = null
     if (typeof(Storage) !== "undefined") {
-      return localStorage.getItem("cayleySavedQueries" + type)
-    } else {
-      return defaultQueryStrings[type]
+      saved = localStorage.getItem("cayleySavedQueries" + type)
     }
+    if (saved === null) {
+      saved = defaultQueryStrings[type] || ""
+    }
+    return saved
+  }
+
+  var languageName = function(type) {
+    return languageNames[type] || type
   }
 
   var switchTo = function(type) {
-    if (type === "gizmo") { switchToGizmo()}
-    if (type === "mql") { switchToMQL()}
-    if (type === "graphql") { switchToGraphQL()}
+    $("#selected-query-lang").html(languageName(type) + caretSpan)
+    selectedQueryLanguage = type
     if (typeof(Storage) !== "undefined") {
       localStorage.setItem("cayleyQueryLang", type);
     }
     if (editor) {
+      editor.setOption("mode", languageModes[type] || "javascript")
       editor.setValue(getLastQueryStringFor(type))
     }
   }
 
-  var switchToGizmo = function () {
-    $("#selected-query-lang").html("Gizmo " + caretSpan)
-    selectedQueryLanguage = "gizmo"
-  }
-
-  var switchToMQL = function() {
-    $("#selected-query-lang").html("MQL" + caretSpan)
-    selectedQueryLanguage = "mql"
-  }
-
-  var switchToGraphQL = function() {
-    $("#selected-query-lang").html("GraphQL" + caretSpan)
-    selectedQueryLanguage = "graphql"
-  }
-
   selectedQueryLanguage = "gizmo"
   var caretSpan = " &nbsp <span class='caret'></span>"
 
+  var lang = null
   if (typeof(Storage) !== "undefined") {
-    savedQueries = localStorage.getItem("cayleySavedQueriesgraphql");
-    if (savedQueries === null) {
-      for (var key in defaultQueryStrings) {
-        localStorage.setItem("cayleySavedQueries" + key, defaultQueryStrings[key])
-      }
-    }
     lang = localStorage.getItem("cayleyQueryLang");
-    if (lang !== null) {
-      switchTo(lang)
-    } else {
-      switchTo("gizmo")
-    }
-  } else {
-    switchTo("gizmo")
   }
+  switchTo(lang !== null ? lang : "gizmo")
 
-
-  $("#gizmo-dropdown").click(function() {
-    switchTo("gizmo")
-  })
-
-  $("#mql-dropdown").click(function() {
-    switchTo("mql")
+  $("#query-lang-menu").on("click", "a[data-lang]", function(ev) {
+    ev.preventDefault()
+    switchTo($(this).data("lang"))
   })
 
-  $("#graphql-dropdown").click(function() {
-    switchTo("graphql")
+  // list all query languages registered on the server
+  $.getJSON("/api/v2/info").done(function(info) {
+    var langs = info.languages
+    if (!langs || langs.length === 0) {
+      return
+    }
+    langs.sort()
+    var menu = $("#query-lang-menu")
+    menu.find("li:not(.dropdown-header)").remove()
+    for (var i = 0; i < langs.length; i++) {
+      var a = $("<a href='#'></a>").attr("data-lang", langs[i]).text(languageName(langs[i]))
+      menu.append($("<li></li>").append(a))
+    }
   })
 });
-
-
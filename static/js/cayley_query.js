@@ -19,23 +19,166 @@ $(function() {
   output_editor = CodeMirror.fromTextArea(document.getElementById("output"), {
     lineNumbers: true,
     matchBrackets: true,
+    mode: "application/json",
   });
 
+  var resultView = "json"
+  if (typeof(Storage) !== "undefined" && localStorage.getItem("cayleyResultView") !== null) {
+    resultView = localStorage.getItem("cayleyResultView")
+  }
+  // lastQuery is the query of the last results; graph view runs it again via /api/v2/graph
+  var lastQuery = null
+  var lastResults = null
+
+  var cellText = function(v) {
+    if (v === null || v === undefined) {
+      return ""
+    } else if (typeof(v) === "object") {
+      return JSON.stringify(v)
+    }
+    return String(v)
+  }
+
+  var renderTable = function(results) {
+    var table = $("#output-table").empty()
+    if (!$.isArray(results)) {
+      results = results === null || results === undefined ? [] : [results]
+    }
+    // columns are the union of keys of all result objects; other values are shown in a single column
+    var cols = [], seen = {}
+    for (var i = 0; i < results.length; i++) {
+      var r = results[i]
+      if (r === null || typeof(r) !== "object" || $.isArray(r)) {
+        r = {"": r}
+      }
+      for (var k in r) {
+        if (!seen[k]) {
+          seen[k] = true
+          cols.push(k)
+        }
+      }
+    }
+    var head = $("<tr></tr>")
+    for (var j = 0; j < cols.length; j++) {
+      head.append($("<th></th>").text(cols[j] === "" ? "value" : cols[j]))
+    }
+    table.append($("<thead></thead>").append(head))
+    var body = $("<tbody></tbody>")
+    for (var i = 0; i < results.length; i++) {
+      var r = results[i]
+      if (r === null || typeof(r) !== "object" || $.isArray(r)) {
+        r = {"": r}
+      }
+      var row = $("<tr></tr>")
+      for (var j = 0; j < cols.length; j++) {
+        row.append($("<td></td>").text(cellText(r[cols[j]])))
+      }
+      body.append(row)
+    }
+    table.append(body)
+  }
+
+  var renderGraph = function(doc) {
+    if (window.sigmaGraph !== undefined) {
+      sigmaGraph.stopForceAtlas2()
+      sigmaGraph.kill()
+      $("#visualize").text("")
+    }
+    var g = {nodes: [], edges: []}
+    for (var i = 0; i < doc.nodes.length; i++) {
+      var n = doc.nodes[i]
+      g.nodes.push({id: n.id, label: n.label || n.id, x: Math.random(), y: Math.random(), size: 10, color: "#001B8A"})
+    }
+    for (var i = 0; i < doc.links.length; i++) {
+      var e = doc.links[i]
+      g.edges.push({id: e.id, source: e.source, target: e.target, label: e.label, size: 5, color: "#ccc"})
+    }
+    sigmaGraph = new sigma({
+      graph: g,
+      container: "visualize",
+      settings: {
+        defaultNodeColor: "#ec5148"
+      }
+    });
+    sigmaGraph.startForceAtlas2();
+    sigmaGraph.forceatlas2.p.linLogMode = true;
+  }
+
+  var showGraph = function() {
+    if (lastQuery === null) {
+      return
+    }
+    animate();
+    $.ajax({
+      type: "POST",
+      url: "/api/v2/graph?" + $.param({lang: lastQuery.lang, format: "d3", iris: "compact"}),
+      data: lastQuery.text,
+      contentType: "text/plain",
+      dataType: "json"
+    }).done(function(doc) {
+      stopAndReset();
+      renderGraph(doc)
+    }).fail(function(jqxhr) {
+      stopAndReset();
+      $("#visualize").text(jqxhr.responseText)
+    })
+  }
+
+  var switchView = function(view) {
+    resultView = view
+    if (typeof(Storage) !== "undefined") {
+      localStorage.setItem("cayleyResultView", view)
+    }
+    showPane(view)
+  }
+
+  // showPane displays results in a given view without changing the preferred one.
+  var showPane = function(view) {
+    $("#result-view button").removeClass("active")
+    $("#result-view button[data-view='" + view + "']").addClass("active")
+    $(".result-pane").hide()
+    $("#result-" + view).show()
+    if (view === "json") {
+      output_editor.refresh()
+    } else if (view === "table" && lastResults !== null) {
+      renderTable(lastResults)
+    } else if (view === "graph") {
+      showGraph()
+    }
+  }
+
+  $("#result-view").on("click", "button", function() {
+    switchView($(this).data("view"))
+  })
+
   $("#run_button").click(function() {
     var data = editor.getValue()
     $("#output").text(editor.getValue())
+    lastQuery = {lang: selectedQueryLanguage, text: data}
     animate();
-    $.post("/api/v1/query/" + selectedQueryLanguage, data)
-      .done(function(return_data) {
+    $.ajax({
+      type: "POST",
+      url: "/api/v2/query?" + $.param({lang: selectedQueryLanguage, iris: "compact"}),
+      data: data,
+      contentType: "text/plain",
+      dataType: "text"
+    }).done(function(return_data) {
         if (typeof(Storage) !== "undefined") {
           localStorage.setItem("cayleySavedQueries" + selectedQueryLanguage, data)
         }
-        output_editor.setValue(JSON.stringify(JSON.parse(return_data), null, '\t'))
+        var doc = JSON.parse(return_data)
+        lastResults = doc.result
+        output_editor.setValue(JSON.stringify(doc, null, '\t'))
         stopAndReset();
+        showPane(resultView)
       })
       .fail(function(jqxhr, textStatus, errorThrown){
+        lastResults = null
         output_editor.setValue(jqxhr.responseText)
         stopAndReset();
+        showPane("json")
       })
   })
+
+  showPane(resultView)
 });
@@ -0,0 +1,81 @@
+// Copyright 2014 The Cayley Authors. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+$(function() {
+  $("#sbSchema").addClass("active");
+
+  // exampleQueries are Gizmo queries that are opened in the query editor when a predicate or a type is clicked.
+  var exampleQueries = {
+    "predicate": function(v) {
+      var p = JSON.stringify(v)
+      return "g.V().Has(" + p + ").Out(" + p + ", \"value\").Limit(20).All()"
+    },
+    "type": function(v) {
+      return "g.V().Has(\"<rdf:type>\", " + JSON.stringify(v) + ").Limit(20).All()"
+    }
+  }
+
+  var openQuery = function(kind, value) {
+    if (typeof(Storage) !== "undefined") {
+      localStorage.setItem("cayleyQueryLang", "gizmo")
+      localStorage.setItem("cayleySavedQueriesgizmo", exampleQueries[kind](value))
+    }
+    window.location = "/"
+  }
+
+  var fillCounts = function(table, kind, items) {
+    table.empty()
+    for (var i = 0; items && i < items.length; i++) {
+      var a = $("<a href='#'></a>").text(items[i].value).data("kind", kind).data("value", items[i].value)
+      table.append($("<tr></tr>").append(
+        $("<td></td>").append(a),
+        $("<td class='text-right'></td>").text(items[i].count)
+      ))
+    }
+  }
+
+  $.getJSON("/api/v2/namespaces").done(function(list) {
+    var table = $("#schema-namespaces")
+    for (var i = 0; i < list.length; i++) {
+      table.append($("<tr></tr>").append(
+        $("<td></td>").text(list[i].prefix),
+        $("<td></td>").text(list[i].full)
+      ))
+    }
+  })
+
+  $.getJSON("/api/v2/schema", {iris: "compact"}).done(function(doc) {
+    fillCounts($("#schema-predicates"), "predicate", doc.predicates)
+    fillCounts($("#schema-types"), "type", doc.types)
+    if (doc.sampled) {
+      $("#schema-sampled").show()
+    }
+  })
+
+  $("#main").on("click", "a", function(ev) {
+    var a = $(this)
+    if (a.data("kind") === undefined) {
+      return
+    }
+    ev.preventDefault()
+    openQuery(a.data("kind"), a.data("value"))
+  })
+
+  $("#schema-filter").on("input", function() {
+    var text = $(this).val().toLowerCase()
+    $("#main table tr").each(function() {
+      $(this).toggle($(this).text().toLowerCase().indexOf(text) >= 0)
+    })
+  })
+});
@@ -0,0 +1,33 @@
+// Package owl contains constants of the Web Ontology Language (OWL)
+package owl
+
+import "github.com/cayleygraph/cayley/voc"
+
+func init() {
+	voc.RegisterPrefix(Prefix, NS)
+}
+
+const (
+	NS     = `http://www.w3.org/2002/07/owl#`
+	Prefix = `owl:`
+)
+
+const (
+	// Classes
+
+	// The class of OWL individuals.
+	Thing = Prefix + `Thing`
+	// The class of OWL classes.
+	Class = Prefix + `Class`
+
+	// Properties
+
+	// The property that determines that two given individuals are equal.
+	SameAs = Prefix + `sameAs`
+	// The property that determines that two given individuals are different.
+	DifferentFrom = Prefix + `differentFrom`
+	// The property that determines that two given classes are equivalent.
+	EquivalentClass = Prefix + `equivalentClass`
+	// The property that determines that two given properties are equivalent.
+	EquivalentProperty = Prefix + `equivalentProperty`
+)
@@ -0,0 +1,179 @@
+package writer
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"time"
+
+	"github.com/cayleygraph/cayley/graph"
+	"github.com/cayleygraph/cayley/quad"
+)
+
+func init() {
+	graph.RegisterWriter("provenance", NewProvenanceReplication)
+}
+
+// NewProvenance creates a quad writer that records an author and time of each added quad.
+// Records can be read with graph.Provenance.
+func NewProvenance(qs graph.QuadStore, author string, opts graph.IgnoreOpts) (graph.QuadWriter, error) {
+	return NewSingle(graph.WithWriterMiddleware(qs, ProvenanceMiddleware(qs, author)), opts)
+}
+
+func NewProvenanceReplication(qs graph.QuadStore, opts graph.Options) (graph.QuadWriter, error) {
+	iopts, err := ignoreOpts(opts)
+	if err != nil {
+		return nil, err
+	}
+	author, err := opts.StringKey("author", "")
+	if err != nil {
+		return nil, err
+	}
+	return NewProvenance(qs, author, iopts)
+}
+
+// ProvenanceMiddleware returns a writer middleware that records provenance of added quads
+// and removes records of deleted quads. A transaction node is removed together with the record
+// of its last quad. All changes are applied in the same call to ApplyDeltas.
+//
+// Quads deleted by other writers keep their records.
+func ProvenanceMiddleware(qs graph.QuadStore, author string) graph.WriterMiddleware {
+	return func(next graph.ApplyDeltasFunc) graph.ApplyDeltasFunc {
+		return func(in []graph.Delta, opts graph.IgnoreOpts) error {
+			out, err := provenanceDeltas(qs, author, in, opts)
+			if err != nil {
+				return err
+			}
+			return next(out, opts)
+		}
+	}
+}
+
+func newTxNode() (quad.BNode, error) {
+	var b [16]byte
+	if _, err := rand.Read(b[:]); err != nil {
+		return "", err
+	}
+	return quad.BNode("tx" + hex.EncodeToString(b[:])), nil
+}
+
+func provenanceDeltas(qs graph.QuadStore, author string, in []graph.Delta, opts graph.IgnoreOpts) ([]graph.Delta, error) {
+	rec := graph.ProvenanceRecord{Author: author, Time: time.Now()}
+	out := make([]graph.Delta, 0, 2*len(in)+2)
+	out = append(out, in...)
+	added := 0
+	deleted := make(map[quad.Quad]struct{})
+	// number of records removed from each transaction
+	removed := make(map[quad.BNode]int)
+	for _, d := range in {
+		if d.Quad.Label == graph.ProvenanceGraph {
+			continue // do not record provenance of provenance records
+		}
+		switch d.Action {
+		case graph.Add:
+			if _, ok := deleted[d.Quad]; !ok && opts.IgnoreDup && hasQuad(qs, d.Quad) {
+				continue // keep the original record
+			}
+			if rec.Tx == "" {
+				tx, err := newTxNode()
+				if err != nil {
+					return nil, err
+				}
+				rec.Tx = tx
+			}
+			out = append(out, graph.Delta{Action: graph.Add, Quad: quad.Quad{
+				Subject: graph.StatementNode(d.Quad), Predicate: graph.ProvenanceTx,
+				Object: rec.Tx, Label: graph.ProvenanceGraph,
+			}})
+			added++
+		case graph.Delete:
+			deleted[d.Quad] = struct{}{}
+			old, err := graph.Provenance(qs, d.Quad)
+			if err != nil {
+				return nil, err
+			} else if old == nil {
+				continue
+			}
+			out = append(out, graph.Delta{Action: graph.Delete, Quad: quad.Quad{
+				Subject: graph.StatementNode(d.Quad), Predicate: graph.ProvenanceTx,
+				Object: old.Tx, Label: graph.ProvenanceGraph,
+			}})
+			removed[old.Tx]++
+		}
+	}
+	if added != 0 {
+		for _, q := range rec.Quads() {
+			out = append(out, graph.Delta{Action: graph.Add, Quad: q})
+		}
+	}
+	for tx, n := range removed {
+		// remove the transaction node if no records will point to it
+		if cnt, err := txRecords(qs, tx); err != nil {
+			return nil, err
+		} else if cnt > n {
+			continue
+		}
+		quads, err := txQuads(qs, tx)
+		if err != nil {
+			return nil, err
+		}
+		for _, q := range quads {
+			out = append(out, graph.Delta{Action: graph.Delete, Quad: q})
+		}
+	}
+	return out, nil
+}
+
+// txRecords returns the number of quads recorded in a given transaction.
+func txRecords(qs graph.QuadStore, tx quad.BNode) (int, error) {
+	gtx, gp, gl := qs.ValueOf(tx), qs.ValueOf(graph.ProvenanceTx), qs.ValueOf(graph.ProvenanceGraph)
+	if gtx == nil || gp == nil || gl == nil {
+		return 0, nil
+	}
+	pk, lk := graph.ToKey(gp), graph.ToKey(gl)
+	it := qs.QuadIterator(quad.Object, gtx)
+	defer it.Close()
+	n := 0
+	ctx := context.TODO()
+	for it.Next(ctx) {
+		ref := it.Result()
+		if graph.ToKey(qs.QuadDirection(ref, quad.Predicate)) == pk && graph.ToKey(qs.QuadDirection(ref, quad.Label)) == lk {
+			n++
+		}
+	}
+	return n, it.Err()
+}
+
+// txQuads returns quads that describe a given transaction.
+func txQuads(qs graph.QuadStore, tx quad.BNode) ([]quad.Quad, error) {
+	gtx := qs.ValueOf(tx)
+	if gtx == nil {
+		return nil, nil
+	}
+	it := qs.QuadIterator(quad.Subject, gtx)
+	defer it.Close()
+	var out []quad.Quad
+	ctx := context.TODO()
+	for it.Next(ctx) {
+		if q := qs.Quad(it.Result()); q.Label == graph.ProvenanceGraph {
+			out = append(out, q)
+		}
+	}
+	return out, it.Err()
+}
+
+func hasQuad(qs graph.QuadStore, q quad.Quad) bool {
+	gs := qs.ValueOf(q.Subject)
+	if gs == nil {
+		return false
+	}
+	it := qs.QuadIterator(quad.Subject, gs)
+	defer it.Close()
+	ctx := context.TODO()
+	for it.Next(ctx) {
+		if qs.Quad(it.Result()) == q {
+			return true
+		}
+	}
+	return false
+}
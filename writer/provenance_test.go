@@ -0,0 +1,105 @@
+package writer_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/cayleygraph/cayley/graph"
+	"github.com/cayleygraph/cayley/graph/memstore"
+	"github.com/cayleygraph/cayley/graph/path"
+	"github.com/cayleygraph/cayley/quad"
+	"github.com/cayleygraph/cayley/writer"
+)
+
+func TestProvenance(t *testing.T) {
+	qs := memstore.New()
+	qw, err := writer.NewProvenance(qs, "alice", graph.IgnoreOpts{IgnoreDup: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	start := time.Now().Add(-time.Second)
+	q1 := quad.MakeIRI("a", "follows", "b", "")
+	q2 := quad.MakeIRI("b", "follows", "c", "")
+	if err = qw.AddQuadSet([]quad.Quad{q1, q2}); err != nil {
+		t.Fatal(err)
+	}
+	r1, err := graph.Provenance(qs, q1)
+	if err != nil {
+		t.Fatal(err)
+	} else if r1 == nil {
+		t.Fatal("expected provenance record")
+	} else if r1.Author != "alice" || r1.Time.Before(start) {
+		t.Fatalf("unexpected record: %+v", r1)
+	}
+	r2, err := graph.Provenance(qs, q2)
+	if err != nil {
+		t.Fatal(err)
+	} else if r2 == nil || r2.Tx != r1.Tx {
+		t.Fatalf("expected quads to share a transaction: %+v vs %+v", r1, r2)
+	}
+
+	// adding a duplicate must keep the original record
+	qw2, err := writer.NewProvenance(qs, "bob", graph.IgnoreOpts{IgnoreDup: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = qw2.AddQuad(q1); err != nil {
+		t.Fatal(err)
+	}
+	if r, err := graph.Provenance(qs, q1); err != nil {
+		t.Fatal(err)
+	} else if r == nil || r.Author != "alice" {
+		t.Fatalf("unexpected record: %+v", r)
+	}
+
+	var authors []quad.Value
+	p := path.StartPath(qs, quad.IRI("a")).OutWithProvenance("author", "time", quad.IRI("follows"))
+	err = p.Iterate(context.TODO()).TagEach(func(tags map[string]graph.Value) {
+		authors = append(authors, qs.NameOf(tags["author"]))
+		if _, ok := tags["time"]; !ok {
+			t.Errorf("expected time tag: %v", tags)
+		}
+	})
+	if err != nil {
+		t.Fatal(err)
+	} else if len(authors) != 1 || authors[0] != quad.String("alice") {
+		t.Fatalf("unexpected authors: %v", authors)
+	}
+
+	if err = qw2.RemoveQuad(q1); err != nil {
+		t.Fatal(err)
+	}
+	if r, err := graph.Provenance(qs, q1); err != nil {
+		t.Fatal(err)
+	} else if r != nil {
+		t.Fatalf("expected record to be removed: %+v", r)
+	}
+
+	// transaction is removed with the record of its last quad
+	if n := len(provenanceQuads(t, qs)); n != 3 {
+		t.Fatalf("expected transaction to be kept, got %d quads", n)
+	}
+	if err = qw2.RemoveQuad(q2); err != nil {
+		t.Fatal(err)
+	}
+	if quads := provenanceQuads(t, qs); len(quads) != 0 {
+		t.Fatalf("expected all records to be removed: %v", quads)
+	}
+}
+
+func provenanceQuads(t testing.TB, qs graph.QuadStore) []quad.Quad {
+	it := qs.QuadsAllIterator()
+	defer it.Close()
+	var out []quad.Quad
+	ctx := context.TODO()
+	for it.Next(ctx) {
+		if q := qs.Quad(it.Result()); q.Label == graph.ProvenanceGraph {
+			out = append(out, q)
+		}
+	}
+	if err := it.Err(); err != nil {
+		t.Fatal(err)
+	}
+	return out
+}
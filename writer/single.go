@@ -15,6 +15,8 @@
 package writer
 
 import (
+	"context"
+
 	"github.com/cayleygraph/cayley/graph"
 	"github.com/cayleygraph/cayley/quad"
 )
@@ -23,6 +25,8 @@ func init() {
 	graph.RegisterWriter("single", NewSingleReplication)
 }
 
+var _ graph.IgnoreOptsWriter = (*Single)(nil)
+
 type Single struct {
 	qs         graph.QuadStore
 	ignoreOpts graph.IgnoreOpts
@@ -36,20 +40,28 @@ func NewSingle(qs graph.QuadStore, opts graph.IgnoreOpts) (graph.QuadWriter, err
 }
 
 func NewSingleReplication(qs graph.QuadStore, opts graph.Options) (graph.QuadWriter, error) {
-	ignoreMissing, err := opts.BoolKey("ignore_missing", graph.IgnoreMissing)
+	iopts, err := ignoreOpts(opts)
 	if err != nil {
 		return nil, err
 	}
+	return NewSingle(qs, iopts)
+}
+
+func ignoreOpts(opts graph.Options) (graph.IgnoreOpts, error) {
+	ignoreMissing, err := opts.BoolKey("ignore_missing", graph.IgnoreMissing)
+	if err != nil {
+		return graph.IgnoreOpts{}, err
+	}
 
 	ignoreDuplicate, err := opts.BoolKey("ignore_duplicate", graph.IgnoreDuplicates)
 	if err != nil {
-		return nil, err
+		return graph.IgnoreOpts{}, err
 	}
 
-	return NewSingle(qs, graph.IgnoreOpts{
+	return graph.IgnoreOpts{
 		IgnoreMissing: ignoreMissing,
 		IgnoreDup:     ignoreDuplicate,
-	})
+	}, nil
 }
 
 func (s *Single) AddQuad(q quad.Quad) error {
@@ -72,6 +84,35 @@ func (s *Single) AddQuadSet(set []quad.Quad) error {
 	return s.qs.ApplyDeltas(deltas, s.ignoreOpts)
 }
 
+// AddQuadSetOpts adds a set of quads with given ignore options instead of options of the writer.
+// Quads that already exist are listed in the report if duplicates are ignored.
+func (s *Single) AddQuadSetOpts(set []quad.Quad, opts graph.IgnoreOpts) (*graph.WriteReport, error) {
+	deltas := make([]graph.Delta, len(set))
+	for i, q := range set {
+		deltas[i] = graph.Delta{
+			Quad:   q,
+			Action: graph.Add,
+		}
+	}
+	return s.ApplyDeltasOpts(deltas, opts)
+}
+
+// ApplyDeltasOpts applies deltas with given ignore options instead of options of the writer.
+// Skipped deltas are listed in the report.
+func (s *Single) ApplyDeltasOpts(in []graph.Delta, opts graph.IgnoreOpts) (*graph.WriteReport, error) {
+	deltas, rep, err := graph.SkipIgnored(s.qs, in, opts)
+	if err != nil {
+		return nil, err
+	}
+	if len(deltas) == 0 {
+		return rep, nil
+	}
+	if err = s.qs.ApplyDeltas(deltas, opts); err != nil {
+		return nil, err
+	}
+	return rep, nil
+}
+
 func (s *Single) RemoveQuad(q quad.Quad) error {
 	deltas := make([]graph.Delta, 1)
 	deltas[0] = graph.Delta{
@@ -81,6 +122,87 @@ func (s *Single) RemoveQuad(q quad.Quad) error {
 	return s.qs.ApplyDeltas(deltas, s.ignoreOpts)
 }
 
+// ReplaceQuad removes the old quad and adds the new one in a single call to ApplyDeltas.
+func (s *Single) ReplaceQuad(old, new quad.Quad) error {
+	if old == new {
+		return nil
+	}
+	return s.qs.ApplyDeltas([]graph.Delta{
+		{Quad: old, Action: graph.Delete},
+		{Quad: new, Action: graph.Add},
+	}, s.ignoreOpts)
+}
+
+// SetQuad removes all quads with a given subject, predicate and label, except the one with the object o,
+// and adds a new quad in a single call to ApplyDeltas.
+//
+// If the store supports conditional writes, the deltas are applied only if no quads with the same subject,
+// predicate and label were changed after existing quads were read, and the operation is retried otherwise.
+// For other stores, concurrent writers may still add other values.
+func (s *Single) SetQuad(sub, pred, obj, label quad.Value) error {
+	nq := quad.Quad{Subject: sub, Predicate: pred, Object: obj, Label: label}
+	vs, ok := graph.AsVersioned(s.qs)
+	if !ok {
+		deltas, err := s.setDeltas(nq)
+		if err != nil || len(deltas) == 0 {
+			return err
+		}
+		return s.qs.ApplyDeltas(deltas, s.ignoreOpts)
+	}
+	for {
+		horizon := vs.Horizon()
+		deltas, err := s.setDeltas(nq)
+		if err != nil || len(deltas) == 0 {
+			return err
+		}
+		err = vs.ApplyDeltasSince(deltas, s.ignoreOpts, horizon)
+		if !graph.IsConflict(err) {
+			return err
+		}
+	}
+}
+
+// setDeltas returns deltas that remove all quads with the same subject, predicate and label as nq,
+// except nq itself, and add nq if it does not exist.
+func (s *Single) setDeltas(nq quad.Quad) ([]graph.Delta, error) {
+	var deltas []graph.Delta
+	exists := false
+	if gs, gp := s.qs.ValueOf(nq.Subject), s.qs.ValueOf(nq.Predicate); gs != nil && gp != nil {
+		var lk interface{}
+		if nq.Label != nil {
+			lk = graph.ToKey(s.qs.ValueOf(nq.Label))
+		}
+		pk := graph.ToKey(gp)
+		it := s.qs.QuadIterator(quad.Subject, gs)
+		ctx := context.TODO()
+		for it.Next(ctx) {
+			ref := it.Result()
+			if graph.ToKey(s.qs.QuadDirection(ref, quad.Predicate)) != pk {
+				continue
+			}
+			q := s.qs.Quad(ref)
+			if (nq.Label == nil) != (q.Label == nil) ||
+				(nq.Label != nil && graph.ToKey(s.qs.QuadDirection(ref, quad.Label)) != lk) {
+				continue
+			}
+			if q == nq {
+				exists = true
+				continue
+			}
+			deltas = append(deltas, graph.Delta{Quad: q, Action: graph.Delete})
+		}
+		err := it.Err()
+		it.Close()
+		if err != nil {
+			return nil, err
+		}
+	}
+	if !exists {
+		deltas = append(deltas, graph.Delta{Quad: nq, Action: graph.Add})
+	}
+	return deltas, nil
+}
+
 // RemoveNode removes all quads with the given value.
 //
 // It returns ErrNodeNotExists if node is missing.
@@ -118,5 +240,12 @@ func (s *Single) Close() error {
 }
 
 func (s *Single) ApplyTransaction(t *graph.Transaction) error {
+	if t.Base != 0 {
+		vs, ok := graph.AsVersioned(s.qs)
+		if !ok {
+			return graph.ErrOperationNotSupported
+		}
+		return vs.ApplyDeltasSince(t.Deltas, s.ignoreOpts, t.Base)
+	}
 	return s.qs.ApplyDeltas(t.Deltas, s.ignoreOpts)
 }
@@ -0,0 +1,147 @@
+package writer_test
+
+import (
+	"reflect"
+	"sort"
+	"testing"
+
+	"github.com/cayleygraph/cayley/graph"
+	"github.com/cayleygraph/cayley/graph/memstore"
+	"github.com/cayleygraph/cayley/quad"
+	"github.com/cayleygraph/cayley/writer"
+)
+
+func TestSingleIgnoreOpts(t *testing.T) {
+	q1 := quad.MakeIRI("a", "follows", "b", "")
+	q2 := quad.MakeIRI("b", "follows", "c", "")
+	q3 := quad.MakeIRI("c", "follows", "d", "")
+	qs := memstore.New(q1)
+	// writer defaults are strict; options of each call are used instead
+	qw, err := writer.NewSingle(qs, graph.IgnoreOpts{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	ow := qw.(graph.IgnoreOptsWriter)
+
+	rep, err := ow.AddQuadSetOpts([]quad.Quad{q1, q2, q2}, graph.IgnoreOpts{IgnoreDup: true})
+	if err != nil {
+		t.Fatal(err)
+	} else if !reflect.DeepEqual(rep.Duplicates, []quad.Quad{q1, q2}) || rep.Skipped() != 2 {
+		t.Fatalf("unexpected report: %+v", rep)
+	}
+	if err = qw.AddQuadSet([]quad.Quad{q1}); !graph.IsQuadExist(err) {
+		t.Fatalf("expected writer options to be unchanged, got: %v", err)
+	}
+
+	rep, err = graph.ApplyDeltasOpts(qw, []graph.Delta{
+		{Quad: q3, Action: graph.Delete},
+		{Quad: q2, Action: graph.Delete},
+		{Quad: q2, Action: graph.Delete},
+		{Quad: q3, Action: graph.Add},
+	}, graph.IgnoreOpts{IgnoreMissing: true})
+	if err != nil {
+		t.Fatal(err)
+	} else if len(rep.Duplicates) != 0 || !reflect.DeepEqual(rep.Missing, []quad.Quad{q3, q2}) {
+		t.Fatalf("unexpected report: %+v", rep)
+	}
+	quads, err := quad.ReadAll(graph.NewQuadStoreReader(qs))
+	if err != nil {
+		t.Fatal(err)
+	}
+	sort.Sort(quad.ByQuadString(quads))
+	if exp := []quad.Quad{q1, q3}; !reflect.DeepEqual(quads, exp) {
+		t.Fatalf("unexpected quads: %v", quads)
+	}
+
+	// missing quads are not ignored with strict options
+	_, err = ow.ApplyDeltasOpts([]graph.Delta{{Quad: q2, Action: graph.Delete}}, graph.IgnoreOpts{})
+	if !graph.IsQuadNotExist(err) {
+		t.Fatalf("expected an error, got: %v", err)
+	}
+}
+
+func TestSingleVectorTransaction(t *testing.T) {
+	q := quad.Quad{Subject: quad.IRI("a"), Predicate: quad.IRI("embedding"), Object: quad.NewVector(0.5, -1)}
+	qs := memstore.New()
+	qw, err := writer.NewSingle(qs, graph.IgnoreOpts{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	tx := graph.NewTransaction()
+	tx.AddQuad(q)
+	// vectors are comparable, thus a duplicate is detected by the transaction
+	tx.AddQuad(quad.Quad{Subject: quad.IRI("a"), Predicate: quad.IRI("embedding"), Object: quad.NewVector(0.5, -1)})
+	if n := len(tx.Deltas); n != 1 {
+		t.Fatalf("unexpected number of deltas: %d", n)
+	}
+	if err = qw.ApplyTransaction(tx); err != nil {
+		t.Fatal(err)
+	}
+	quads, err := quad.ReadAll(graph.NewQuadStoreReader(qs))
+	if err != nil {
+		t.Fatal(err)
+	} else if len(quads) != 1 || quads[0] != q {
+		t.Fatalf("unexpected quads: %v", quads)
+	}
+	if v := qs.NameOf(qs.ValueOf(q.Object)); v != q.Object {
+		t.Fatalf("unexpected value: %#v", v)
+	}
+
+	tx = graph.NewTransaction()
+	tx.RemoveQuad(q)
+	if err = qw.ApplyTransaction(tx); err != nil {
+		t.Fatal(err)
+	}
+	quads, err = quad.ReadAll(graph.NewQuadStoreReader(qs))
+	if err != nil {
+		t.Fatal(err)
+	} else if len(quads) != 0 {
+		t.Fatalf("unexpected quads: %v", quads)
+	}
+}
+
+// racyStore adds a concurrent write before the first write to the store.
+type racyStore struct {
+	*memstore.QuadStore
+	race quad.Quad
+}
+
+func (qs *racyStore) write() {
+	if qs.race != (quad.Quad{}) {
+		qs.QuadStore.ApplyDeltas([]graph.Delta{{Quad: qs.race, Action: graph.Add}}, graph.IgnoreOpts{})
+		qs.race = quad.Quad{}
+	}
+}
+
+func (qs *racyStore) ApplyDeltas(in []graph.Delta, opts graph.IgnoreOpts) error {
+	qs.write()
+	return qs.QuadStore.ApplyDeltas(in, opts)
+}
+
+func (qs *racyStore) ApplyDeltasSince(in []graph.Delta, opts graph.IgnoreOpts, horizon int64) error {
+	qs.write()
+	return qs.QuadStore.ApplyDeltasSince(in, opts, horizon)
+}
+
+func TestSingleSetQuadConflict(t *testing.T) {
+	a, status := quad.IRI("a"), quad.IRI("status")
+	qs := &racyStore{
+		QuadStore: memstore.New(),
+		race:      quad.Quad{Subject: a, Predicate: status, Object: quad.String("other")},
+	}
+	qw, err := writer.NewSingle(qs, graph.IgnoreOpts{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = qw.SetQuad(a, status, quad.String("set"), nil); err != nil {
+		t.Fatal(err)
+	}
+	quads, err := quad.ReadAll(graph.NewQuadStoreReader(qs))
+	if err != nil {
+		t.Fatal(err)
+	}
+	exp := []quad.Quad{{Subject: a, Predicate: status, Object: quad.String("set")}}
+	if !reflect.DeepEqual(quads, exp) {
+		t.Fatalf("unexpected quads: %v", quads)
+	}
+}